@@ -0,0 +1,190 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// maxArchiveSize is the most bytes which are extracted from one archive,
+// so that a small archive cannot expand to fill memory.
+const maxArchiveSize = 1 << 30
+
+// IsArchive reports whether RouteInput treats contents as an archive: a ZIP
+// file (but not an office document, which is also a ZIP file), a tar file
+// or a gzipped tar file.
+func IsArchive(contents []byte) bool {
+	return archiveHandler{}.Match(contents)
+}
+
+type archiveHandler struct{}
+
+func isZip(contents []byte) bool {
+	return bytes.HasPrefix(contents, []byte("PK\x03\x04")) || bytes.HasPrefix(contents, []byte("PK\x05\x06"))
+}
+
+func isTar(contents []byte) bool {
+	return len(contents) >= 262 && string(contents[257:262]) == "ustar"
+}
+
+func isGzip(contents []byte) bool {
+	return bytes.HasPrefix(contents, []byte("\x1f\x8b"))
+}
+
+func (archiveHandler) Match(contents []byte) bool {
+	if isZip(contents) {
+		return !(officeHandler{}).Match(contents)
+	}
+	return isTar(contents) || isGzip(contents)
+}
+
+// Files returns the files in the archive, each routed as an input of its
+// own, named name/path where path is its path within the archive. Like the
+// attachments of an email, files which cannot be submitted are skipped,
+// unless no file can be submitted. A gzipped file which is not a tar file
+// is routed as the file it decompresses to.
+func (archiveHandler) Files(name string, contents []byte) ([]File, error) {
+	if isGzip(contents) {
+		zr, err := gzip.NewReader(bytes.NewReader(contents))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip file: %v", err)
+		}
+		contents, err = readLimited(zr, maxArchiveSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip file: %v", err)
+		}
+		if !isTar(contents) {
+			return RouteInput(strings.TrimSuffix(name, ".gz"), contents)
+		}
+	}
+	var files []File
+	var skipped []string
+	add := func(entry string, data []byte) {
+		fs, err := RouteInput(path.Join(name, entry), data)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%v (%v)", entry, err))
+			return
+		}
+		files = append(files, fs...)
+	}
+	var err error
+	if isZip(contents) {
+		err = walkZip(contents, add)
+	} else {
+		err = walkTar(contents, add)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %v", err)
+	}
+	if len(files) == 0 {
+		if len(skipped) != 0 {
+			return nil, fmt.Errorf("no file in the archive can be submitted: %v", strings.Join(skipped, ", "))
+		}
+		return nil, errors.New("the archive has no files")
+	}
+	return files, nil
+}
+
+// archivePath cleans the path of a file in an archive, so that it cannot
+// refer outside of the archive. ok is false for files which are not
+// documents, such as the resource forks macOS adds to ZIP files.
+func archivePath(name string) (_ string, ok bool) {
+	p := strings.TrimPrefix(path.Clean("/"+strings.Replace(name, "\\", "/", -1)), "/")
+	if p == "" || strings.HasPrefix(p, "__MACOSX/") || strings.HasPrefix(path.Base(p), "._") {
+		return "", false
+	}
+	return p, true
+}
+
+// walkZip calls file with the path and contents of every regular file in a
+// ZIP file, in the order they are stored.
+func walkZip(contents []byte, file func(path string, data []byte)) error {
+	zr, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return err
+	}
+	budget := int64(maxArchiveSize)
+	for _, f := range zr.File {
+		p, ok := archivePath(f.Name)
+		if !ok || !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("%v: %v", p, err)
+		}
+		data, err := readLimited(rc, budget)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%v: %v", p, err)
+		}
+		budget -= int64(len(data))
+		file(p, data)
+	}
+	return nil
+}
+
+// walkTar calls file with the path and contents of every regular file in a
+// tar file, in the order they are stored.
+func walkTar(contents []byte, file func(path string, data []byte)) error {
+	tr := tar.NewReader(bytes.NewReader(contents))
+	budget := int64(maxArchiveSize)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		p, ok := archivePath(hdr.Name)
+		if !ok || (hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA) {
+			continue
+		}
+		data, err := readLimited(tr, budget)
+		if err != nil {
+			return fmt.Errorf("%v: %v", p, err)
+		}
+		budget -= int64(len(data))
+		file(p, data)
+	}
+}
+
+// readLimited reads all of r, failing if there are more than limit bytes.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("the archive expands to more than %v MB", maxArchiveSize>>20)
+	}
+	return data, nil
+}
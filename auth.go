@@ -0,0 +1,103 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// AuthScheme is the scheme of the Authorization header which carries the
+// API key, or token, of a Client.
+type AuthScheme string
+
+const (
+	// AuthBasic sends the API key as "Authorization: Basic <key>", as
+	// the Sight API has always accepted. It is the default.
+	AuthBasic AuthScheme = "Basic"
+	// AuthBearer sends it as "Authorization: Bearer <token>", for
+	// short-lived tokens issued in place of API keys.
+	AuthBearer AuthScheme = "Bearer"
+)
+
+// KeyProvider returns the API key, or token, to send with a request, e.g.,
+// one fetched from Vault or a security token service. It is called before
+// every request, from any goroutine, with the context of the request, so it
+// should cache what it fetches until shortly before it expires.
+type KeyProvider func(ctx context.Context) (string, error)
+
+// WithAuthScheme makes the Client send its API key with scheme instead of
+// AuthBasic.
+func WithAuthScheme(scheme AuthScheme) Option {
+	return func(c *Client) {
+		c.authScheme = scheme
+	}
+}
+
+// WithKeyProvider makes the Client ask provider for the API key to send with
+// each request instead of sending the one passed to NewClient, so that keys
+// or tokens can be rotated without creating a new Client. A request for
+// which provider fails is not sent, and fails with a *KeyProviderError.
+// Jobs already started are polled with whatever key provider returns,
+// which the Sight API accepts if it belongs to the same account.
+func WithKeyProvider(provider KeyProvider) Option {
+	return func(c *Client) {
+		c.keyProvider = provider
+	}
+}
+
+// KeyProviderError is the error of a request which was not sent because the
+// KeyProvider of the Client failed.
+type KeyProviderError struct {
+	Err error
+}
+
+func (e *KeyProviderError) Error() string {
+	return fmt.Sprintf("failed to get an API key: %v", e.Err)
+}
+
+func (e *KeyProviderError) Unwrap() error {
+	return e.Err
+}
+
+// authorize sets the Authorization header of req, and returns the key in it.
+func (c *Client) authorize(req *http.Request) (string, error) {
+	key := c.apiKey
+	switch {
+	case c.keyPool != nil:
+		if pinned, ok := req.Context().Value(apiKeyContextKey{}).(string); ok {
+			key = pinned
+		} else {
+			var err error
+			if key, err = c.keyPool.pick(); err != nil {
+				return "", err
+			}
+		}
+	case c.keyProvider != nil:
+		var err error
+		if key, err = c.keyProvider(req.Context()); err != nil {
+			return "", &KeyProviderError{Err: err}
+		}
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("%v %v", c.authScheme, key))
+	return key, nil
+}
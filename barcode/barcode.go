@@ -0,0 +1,142 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package barcode decodes the barcodes most used on documents in images of
+// their pages: QR codes, and Code 128 and Code 39 linear barcodes. It is
+// meant for routing scans by the document identifiers printed on them, such
+// as the separator sheets of batch scanning, before or alongside
+// recognizing their text:
+//
+//	for _, b := range barcode.Scan(img) {
+//		fmt.Println(b.Format, b.Text)
+//	}
+//
+// Barcodes must be upright or rotated by a multiple of 90 degrees, give or
+// take a little skew, as on scanned or rendered pages; barcodes seen in
+// perspective, as in photographs, are not found reliably.
+package barcode
+
+import (
+	"image"
+	"image/color"
+)
+
+// Format is a kind of barcode.
+type Format string
+
+const (
+	QRCode  Format = "qr-code"
+	Code128 Format = "code-128"
+	Code39  Format = "code-39"
+)
+
+// Barcode is a barcode found in an image. Its corners are in pixels of the
+// image, and are named as if the barcode were upright, so that a barcode
+// upside down has its TopLeft at the bottom right of the image.
+type Barcode struct {
+	Format Format
+	// Text is the decoded contents of the barcode.
+	Text                                                 string
+	TopLeftX, TopLeftY, TopRightX, TopRightY             int
+	BottomLeftX, BottomLeftY, BottomRightX, BottomRightY int
+}
+
+// Scan returns the barcodes found in img: QR codes first, in no particular
+// order, then linear barcodes.
+func Scan(img image.Image) []Barcode {
+	b := binarize(img)
+	return append(scanQR(b), scanLinear(b)...)
+}
+
+// bitmap is an image reduced to black and white.
+type bitmap struct {
+	w, h  int
+	black []bool
+}
+
+// at reports whether the pixel at x, y is black. Pixels outside the image
+// are white.
+func (b *bitmap) at(x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.w && y < b.h && b.black[y*b.w+x]
+}
+
+// inside reports whether x, y is a pixel of the image.
+func (b *bitmap) inside(x, y int) bool {
+	return x >= 0 && y >= 0 && x < b.w && y < b.h
+}
+
+// binarize reduces img to black and white with a single threshold chosen by
+// Otsu's method, which suits pages printed in black on a light background.
+func binarize(img image.Image) *bitmap {
+	r := img.Bounds()
+	w, h := r.Dx(), r.Dy()
+	gray := make([]uint8, w*h)
+	switch m := img.(type) {
+	case *image.Gray:
+		for y := 0; y < h; y++ {
+			copy(gray[y*w:(y+1)*w], m.Pix[m.PixOffset(r.Min.X, r.Min.Y+y):])
+		}
+	case *image.YCbCr:
+		// The luma of a JPEG is its gray level.
+		for y := 0; y < h; y++ {
+			copy(gray[y*w:(y+1)*w], m.Y[m.YOffset(r.Min.X, r.Min.Y+y):])
+		}
+	default:
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				gray[y*w+x] = color.GrayModel.Convert(img.At(r.Min.X+x, r.Min.Y+y)).(color.Gray).Y
+			}
+		}
+	}
+	var histogram [256]int
+	for _, g := range gray {
+		histogram[g]++
+	}
+	// Otsu's method chooses the threshold which maximizes the variance
+	// between the dark and light pixels.
+	var sum float64
+	for i, n := range histogram {
+		sum += float64(i * n)
+	}
+	var sumDark float64
+	threshold, best, dark := 128, -1.0, 0
+	for t := 0; t < 256; t++ {
+		dark += histogram[t]
+		if dark == 0 {
+			continue
+		}
+		light := len(gray) - dark
+		if light == 0 {
+			break
+		}
+		sumDark += float64(t * histogram[t])
+		meanDark := sumDark / float64(dark)
+		meanLight := (sum - sumDark) / float64(light)
+		v := float64(dark) * float64(light) * (meanDark - meanLight) * (meanDark - meanLight)
+		if v > best {
+			best, threshold = v, t
+		}
+	}
+	b := &bitmap{w: w, h: h, black: make([]bool, w*h)}
+	for i, g := range gray {
+		b.black[i] = int(g) <= threshold
+	}
+	return b
+}
@@ -0,0 +1,461 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package barcode
+
+import "math"
+
+// code128Patterns are the widths of the bars and spaces of the symbols of
+// Code 128, in modules, by value. 103, 104 and 105 start the barcode in
+// code set A, B or C; 106 stops it, followed by a final bar two modules
+// wide.
+var code128Patterns = [107][6]int{
+	{2, 1, 2, 2, 2, 2}, {2, 2, 2, 1, 2, 2}, {2, 2, 2, 2, 2, 1}, {1, 2, 1, 2, 2, 3}, {1, 2, 1, 3, 2, 2},
+	{1, 3, 1, 2, 2, 2}, {1, 2, 2, 2, 1, 3}, {1, 2, 2, 3, 1, 2}, {1, 3, 2, 2, 1, 2}, {2, 2, 1, 2, 1, 3},
+	{2, 2, 1, 3, 1, 2}, {2, 3, 1, 2, 1, 2}, {1, 1, 2, 2, 3, 2}, {1, 2, 2, 1, 3, 2}, {1, 2, 2, 2, 3, 1},
+	{1, 1, 3, 2, 2, 2}, {1, 2, 3, 1, 2, 2}, {1, 2, 3, 2, 2, 1}, {2, 2, 3, 2, 1, 1}, {2, 2, 1, 1, 3, 2},
+	{2, 2, 1, 2, 3, 1}, {2, 1, 3, 2, 1, 2}, {2, 2, 3, 1, 1, 2}, {3, 1, 2, 1, 3, 1}, {3, 1, 1, 2, 2, 2},
+	{3, 2, 1, 1, 2, 2}, {3, 2, 1, 2, 2, 1}, {3, 1, 2, 2, 1, 2}, {3, 2, 2, 1, 1, 2}, {3, 2, 2, 2, 1, 1},
+	{2, 1, 2, 1, 2, 3}, {2, 1, 2, 3, 2, 1}, {2, 3, 2, 1, 2, 1}, {1, 1, 1, 3, 2, 3}, {1, 3, 1, 1, 2, 3},
+	{1, 3, 1, 3, 2, 1}, {1, 1, 2, 3, 1, 3}, {1, 3, 2, 1, 1, 3}, {1, 3, 2, 3, 1, 1}, {2, 1, 1, 3, 1, 3},
+	{2, 3, 1, 1, 1, 3}, {2, 3, 1, 3, 1, 1}, {1, 1, 2, 1, 3, 3}, {1, 1, 2, 3, 3, 1}, {1, 3, 2, 1, 3, 1},
+	{1, 1, 3, 1, 2, 3}, {1, 1, 3, 3, 2, 1}, {1, 3, 3, 1, 2, 1}, {3, 1, 3, 1, 2, 1}, {2, 1, 1, 3, 3, 1},
+	{2, 3, 1, 1, 3, 1}, {2, 1, 3, 1, 1, 3}, {2, 1, 3, 3, 1, 1}, {2, 1, 3, 1, 3, 1}, {3, 1, 1, 1, 2, 3},
+	{3, 1, 1, 3, 2, 1}, {3, 3, 1, 1, 2, 1}, {3, 1, 2, 1, 1, 3}, {3, 1, 2, 3, 1, 1}, {3, 3, 2, 1, 1, 1},
+	{3, 1, 4, 1, 1, 1}, {2, 2, 1, 4, 1, 1}, {4, 3, 1, 1, 1, 1}, {1, 1, 1, 2, 2, 4}, {1, 1, 1, 4, 2, 2},
+	{1, 2, 1, 1, 2, 4}, {1, 2, 1, 4, 2, 1}, {1, 4, 1, 1, 2, 2}, {1, 4, 1, 2, 2, 1}, {1, 1, 2, 2, 1, 4},
+	{1, 1, 2, 4, 1, 2}, {1, 2, 2, 1, 1, 4}, {1, 2, 2, 4, 1, 1}, {1, 4, 2, 1, 1, 2}, {1, 4, 2, 2, 1, 1},
+	{2, 4, 1, 2, 1, 1}, {2, 2, 1, 1, 1, 4}, {4, 1, 3, 1, 1, 1}, {2, 4, 1, 1, 1, 2}, {1, 3, 4, 1, 1, 1},
+	{1, 1, 1, 2, 4, 2}, {1, 2, 1, 1, 4, 2}, {1, 2, 1, 2, 4, 1}, {1, 1, 4, 2, 1, 2}, {1, 2, 4, 1, 1, 2},
+	{1, 2, 4, 2, 1, 1}, {4, 1, 1, 2, 1, 2}, {4, 2, 1, 1, 1, 2}, {4, 2, 1, 2, 1, 1}, {2, 1, 2, 1, 4, 1},
+	{2, 1, 4, 1, 2, 1}, {4, 1, 2, 1, 2, 1}, {1, 1, 1, 1, 4, 3}, {1, 1, 1, 3, 4, 1}, {1, 3, 1, 1, 4, 1},
+	{1, 1, 4, 1, 1, 3}, {1, 1, 4, 3, 1, 1}, {4, 1, 1, 1, 1, 3}, {4, 1, 1, 3, 1, 1}, {1, 1, 3, 1, 4, 1},
+	{1, 1, 4, 1, 3, 1}, {3, 1, 1, 1, 4, 1}, {4, 1, 1, 1, 3, 1}, {2, 1, 1, 4, 1, 2}, {2, 1, 1, 2, 1, 4},
+	{2, 1, 1, 2, 3, 2}, {2, 3, 3, 1, 1, 1},
+}
+
+// Code 128 values with special meanings.
+const (
+	code128Shift  = 98
+	code128CodeC  = 99
+	code128CodeB  = 100
+	code128CodeA  = 101
+	code128FNC1   = 102
+	code128StartA = 103
+	code128StartC = 105
+	code128Stop   = 106
+)
+
+// code39Chars are the characters of Code 39, and code39Patterns which of
+// their nine bars and spaces are wide, from the most significant bit.
+// Asterisks start and stop the barcode.
+const code39Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ-. $/+%*"
+
+var code39Patterns = [44]int{
+	0x034, 0x121, 0x061, 0x160, 0x031, 0x130, 0x070, 0x025, 0x124, 0x064,
+	0x109, 0x049, 0x148, 0x019, 0x118, 0x058, 0x00d, 0x10c, 0x04c, 0x01c,
+	0x103, 0x043, 0x142, 0x013, 0x112, 0x052, 0x007, 0x106, 0x046, 0x016,
+	0x181, 0x0c1, 0x1c0, 0x091, 0x190, 0x0d0, 0x085, 0x184, 0x0c4, 0x0a8,
+	0x0a2, 0x08a, 0x02a, 0x094,
+}
+
+const (
+	// maxAverageVariance and maxVariance bound how far the widths of a
+	// symbol may be from its pattern, on average and each, as fractions
+	// of a module.
+	maxAverageVariance = 0.25
+	maxVariance        = 0.7
+)
+
+// reading is a linear barcode read along one scan line, between the pixels
+// start and end of the line.
+type reading struct {
+	format     Format
+	text       string
+	start, end int
+}
+
+// Directions in which lines are scanned.
+const (
+	right = iota
+	left
+	down
+	up
+)
+
+// scanLinear scans rows and columns of b, each both ways, for linear
+// barcodes. A barcode is only reported if it is read the same on at least
+// two lines, which makes misreadings unlikely.
+func scanLinear(b *bitmap) []Barcode {
+	step := b.w
+	if b.h < step {
+		step = b.h
+	}
+	if step /= 300; step < 2 {
+		step = 2
+	}
+	type sighting struct {
+		reading
+		direction            int
+		minAcross, maxAcross int
+		lines                int
+	}
+	var sightings []*sighting
+	see := func(r reading, direction, across int) {
+		for _, s := range sightings {
+			if s.format == r.format && s.text == r.text && s.direction == direction &&
+				r.start < s.end && s.start < r.end && across <= s.maxAcross+3*step {
+				if r.start < s.start {
+					s.start = r.start
+				}
+				if r.end > s.end {
+					s.end = r.end
+				}
+				s.maxAcross = across
+				s.lines++
+				return
+			}
+		}
+		sightings = append(sightings, &sighting{r, direction, across, across, 1})
+	}
+	line := make([]bool, 0, b.w+b.h)
+	for y := step / 2; y < b.h; y += step {
+		line = line[:0]
+		for x := 0; x < b.w; x++ {
+			line = append(line, b.at(x, y))
+		}
+		for direction, rs := range readLine(line) {
+			for _, r := range rs {
+				see(r, right+direction, y)
+			}
+		}
+	}
+	for x := step / 2; x < b.w; x += step {
+		line = line[:0]
+		for y := 0; y < b.h; y++ {
+			line = append(line, b.at(x, y))
+		}
+		for direction, rs := range readLine(line) {
+			for _, r := range rs {
+				see(r, down+direction, x)
+			}
+		}
+	}
+	var found []Barcode
+	for _, s := range sightings {
+		if s.lines < 2 {
+			continue
+		}
+		code := Barcode{Format: s.format, Text: s.text}
+		l, t, r, b := s.start, s.minAcross, s.end, s.maxAcross
+		if s.direction == down || s.direction == up {
+			l, t, r, b = s.minAcross, s.start, s.maxAcross, s.end
+		}
+		corners := [4][2]int{{l, t}, {r, t}, {r, b}, {l, b}}
+		// The corners are rotated so that the first is at the top left of
+		// the barcode as it is read.
+		first := [4]int{right: 0, down: 1, left: 2, up: 3}[s.direction]
+		c := func(i int) (int, int) {
+			p := corners[(first+i)%4]
+			return p[0], p[1]
+		}
+		code.TopLeftX, code.TopLeftY = c(0)
+		code.TopRightX, code.TopRightY = c(1)
+		code.BottomRightX, code.BottomRightY = c(2)
+		code.BottomLeftX, code.BottomLeftY = c(3)
+		found = append(found, code)
+	}
+	return found
+}
+
+// readLine reads the linear barcodes along a line of pixels, true for black
+// ones, forwards and backwards. The readings backwards are located in the
+// pixels of the line forwards.
+func readLine(line []bool) [2][]reading {
+	var readings [2][]reading
+	readings[0] = readRuns(runs(line, false))
+	n := len(line)
+	for _, r := range readRuns(runs(line, true)) {
+		r.start, r.end = n-r.end, n-r.start
+		readings[1] = append(readings[1], r)
+	}
+	return readings
+}
+
+// runs returns the lengths of the runs of white and black pixels of line,
+// starting with a white one, which may be empty, and the pixel at which
+// each starts.
+func runs(line []bool, backwards bool) (lengths, starts []int) {
+	lengths, starts = []int{0}, []int{0}
+	black := false
+	for i := range line {
+		p := line[i]
+		if backwards {
+			p = line[len(line)-1-i]
+		}
+		if p != black {
+			lengths, starts = append(lengths, 0), append(starts, i)
+			black = p
+		}
+		lengths[len(lengths)-1]++
+	}
+	return lengths, starts
+}
+
+// readRuns reads the barcodes in a line of runs of white and black pixels.
+func readRuns(lengths, starts []int) []reading {
+	var readings []reading
+	for i := 1; i < len(lengths); i += 2 {
+		text, end, ok := readCode128(lengths, i)
+		format := Code128
+		if !ok {
+			text, end, ok = readCode39(lengths, i)
+			format = Code39
+		}
+		if !ok {
+			continue
+		}
+		readings = append(readings, reading{format, text, starts[i], starts[end-1] + lengths[end-1]})
+		i = end - 1
+	}
+	return readings
+}
+
+// variance returns how far the runs are from the widths of pattern, in
+// modules, as a fraction of their total length. It is infinite if any
+// single run is too far from its width.
+func variance(runs []int, pattern []int) float64 {
+	total, modules := 0, 0
+	for i, r := range runs {
+		total += r
+		modules += pattern[i]
+	}
+	if total < modules {
+		return math.Inf(1)
+	}
+	module := float64(total) / float64(modules)
+	var sum float64
+	for i, r := range runs {
+		v := math.Abs(float64(r) - float64(pattern[i])*module)
+		if v > maxVariance*module {
+			return math.Inf(1)
+		}
+		sum += v
+	}
+	return sum / float64(total)
+}
+
+// matchCode128 returns the value of the Code 128 symbol whose widths best
+// match the six runs from i, among the values from first to last.
+func matchCode128(runs []int, i, first, last int) (int, bool) {
+	if i+6 > len(runs) {
+		return 0, false
+	}
+	best, bestVariance := 0, maxAverageVariance
+	for v := first; v <= last; v++ {
+		if d := variance(runs[i:i+6], code128Patterns[v][:]); d < bestVariance {
+			best, bestVariance = v, d
+		}
+	}
+	return best, bestVariance < maxAverageVariance
+}
+
+// quietZone reports whether the white run before the black run i is at
+// least half as long as the width of a symbol.
+func quietZone(runs []int, i, width int) bool {
+	return i == 0 || 2*runs[i-1] >= width
+}
+
+func sum(runs []int) int {
+	total := 0
+	for _, r := range runs {
+		total += r
+	}
+	return total
+}
+
+// readCode128 reads a Code 128 barcode starting at the black run i. end is
+// the index of the run after its last bar.
+func readCode128(runs []int, i int) (text string, end int, ok bool) {
+	start, ok := matchCode128(runs, i, code128StartA, code128StartC)
+	if !ok || !quietZone(runs, i, sum(runs[i:i+6])) {
+		return "", 0, false
+	}
+	values := []int{start}
+	for i += 6; ; i += 6 {
+		v, ok := matchCode128(runs, i, 0, code128Stop)
+		if !ok || (v >= code128StartA && v < code128Stop) {
+			return "", 0, false
+		}
+		if v == code128Stop {
+			if i+7 > len(runs) {
+				return "", 0, false
+			}
+			module := float64(sum(runs[i:i+6])) / 11
+			if math.Abs(float64(runs[i+6])-2*module) > maxVariance*module ||
+				(i+7 < len(runs) && 2*runs[i+7] < sum(runs[i:i+7])) {
+				return "", 0, false
+			}
+			end = i + 7
+			break
+		}
+		values = append(values, v)
+	}
+	if len(values) < 3 {
+		return "", 0, false
+	}
+	check := values[0]
+	for k := 1; k < len(values)-1; k++ {
+		check += k * values[k]
+	}
+	if check%103 != values[len(values)-1] {
+		return "", 0, false
+	}
+	return code128Text(values[0], values[1:len(values)-1]), end, true
+}
+
+// code128Text returns the text of the Code 128 values, which follow the
+// start value start. FNC1 is written as the ASCII group separator, except
+// in the first position, where it only marks GS1 data; other function
+// codes are dropped.
+func code128Text(start int, values []int) string {
+	var text []byte
+	set := start - code128StartA // 0, 1 or 2 for code sets A, B and C
+	shift := false
+	for k, v := range values {
+		current := set
+		if shift {
+			current = 1 - set
+			shift = false
+		}
+		if v == code128FNC1 {
+			if k > 0 {
+				text = append(text, 0x1d)
+			}
+			continue
+		}
+		if current == 2 {
+			switch {
+			case v < 100:
+				text = append(text, byte('0'+v/10), byte('0'+v%10))
+			case v == code128CodeB:
+				set = 1
+			case v == code128CodeA:
+				set = 0
+			}
+			continue
+		}
+		switch {
+		case v < 64 || (current == 1 && v < 96):
+			text = append(text, byte(' '+v))
+		case v < 96:
+			text = append(text, byte(v-64))
+		case v == code128Shift:
+			shift = true
+		case v == code128CodeC:
+			set = 2
+		case v == code128CodeB && current == 0:
+			set = 1
+		case v == code128CodeA && current == 1:
+			set = 0
+		}
+	}
+	return string(text)
+}
+
+// narrowWide returns which of nine runs are wide, from the most significant
+// bit, if exactly three of them are clearly wider than the others.
+func narrowWide(runs []int) (int, bool) {
+	narrow := 0
+	for {
+		// Each width is tried in turn as the widest narrow run.
+		next := math.MaxInt32
+		for _, r := range runs {
+			if r > narrow && r < next {
+				next = r
+			}
+		}
+		narrow = next
+		pattern, wide, wideTotal := 0, 0, 0
+		for i, r := range runs {
+			if r > narrow {
+				pattern |= 1 << uint(8-i)
+				wide++
+				wideTotal += r
+			}
+		}
+		if wide < 3 {
+			return 0, false
+		}
+		if wide == 3 {
+			for _, r := range runs {
+				if r > narrow && 2*r >= wideTotal {
+					return 0, false
+				}
+			}
+			return pattern, true
+		}
+	}
+}
+
+// matchCode39 returns the Code 39 character of the nine runs from i.
+func matchCode39(runs []int, i int) (byte, bool) {
+	if i+9 > len(runs) {
+		return 0, false
+	}
+	pattern, ok := narrowWide(runs[i : i+9])
+	if !ok {
+		return 0, false
+	}
+	for k, p := range code39Patterns {
+		if p == pattern {
+			return code39Chars[k], true
+		}
+	}
+	return 0, false
+}
+
+// readCode39 reads a Code 39 barcode starting at the black run i. end is
+// the index of the run after its last bar.
+func readCode39(runs []int, i int) (text string, end int, ok bool) {
+	if c, ok := matchCode39(runs, i); !ok || c != '*' || !quietZone(runs, i, sum(runs[i:i+9])) {
+		return "", 0, false
+	}
+	var chars []byte
+	for i += 10; ; i += 10 {
+		c, ok := matchCode39(runs, i)
+		if !ok {
+			return "", 0, false
+		}
+		// The gap between characters is narrow, if a little wider
+		// than the narrow bars and spaces.
+		if 3*runs[i-1] > sum(runs[i:i+9]) {
+			return "", 0, false
+		}
+		if c == '*' {
+			break
+		}
+		chars = append(chars, c)
+	}
+	if len(chars) == 0 || (i+9 < len(runs) && 2*runs[i+9] < sum(runs[i:i+9])) {
+		return "", 0, false
+	}
+	return string(chars), i + 9, true
+}
@@ -0,0 +1,152 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package barcode
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// drawBars draws bars and spaces of the given widths, in modules, starting
+// with a bar, between quiet zones of quiet pixels.
+func drawBars(widths []int, module, height, quiet int) *image.Gray {
+	w := 2 * quiet
+	for _, n := range widths {
+		w += n * module
+	}
+	img := image.NewGray(image.Rect(0, 0, w, height+2*quiet))
+	for i := range img.Pix {
+		img.Pix[i] = 240
+	}
+	x := quiet
+	for i, n := range widths {
+		if i%2 == 0 {
+			for dx := 0; dx < n*module; dx++ {
+				for y := quiet; y < quiet+height; y++ {
+					img.SetGray(x+dx, y, color.Gray{10})
+				}
+			}
+		}
+		x += n * module
+	}
+	return img
+}
+
+// code128Widths returns the widths of a Code 128 barcode of values, which
+// begin with a start value, with its check value and stop pattern.
+func code128Widths(values []int, check int) []int {
+	var widths []int
+	for _, v := range append(append(values[:len(values):len(values)], check), code128Stop) {
+		widths = append(widths, code128Patterns[v][:]...)
+	}
+	return append(widths, 2)
+}
+
+func code128Check(values []int) int {
+	sum := values[0]
+	for i, v := range values[1:] {
+		sum += (i + 1) * v
+	}
+	return sum % 103
+}
+
+// code39Widths returns the widths of a Code 39 barcode of text, which
+// includes the asterisks, with wide elements wide modules wide.
+func code39Widths(text string, wide int) []int {
+	var widths []int
+	for i := 0; i < len(text); i++ {
+		if i > 0 {
+			widths = append(widths, 1)
+		}
+		pattern := code39Patterns[strings.IndexByte(code39Chars, text[i])]
+		for b := 8; b >= 0; b-- {
+			if pattern&(1<<uint(b)) != 0 {
+				widths = append(widths, wide)
+			} else {
+				widths = append(widths, 1)
+			}
+		}
+	}
+	return widths
+}
+
+// rotate90 returns src rotated clockwise by 90 degrees.
+func rotate90(src *image.Gray) *image.Gray {
+	b := src.Bounds()
+	dst := image.NewGray(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			dst.SetGray(b.Dy()-1-y, x, src.GrayAt(x, y))
+		}
+	}
+	return dst
+}
+
+// scanRotated scans img rotated by 0, 90, 180 and 270 degrees and checks
+// that a single barcode of the format and text is found in each.
+func scanRotated(t *testing.T, img *image.Gray, format Format, text string) {
+	t.Helper()
+	for angle := 0; angle < 360; angle += 90 {
+		codes := Scan(img)
+		if len(codes) != 1 || codes[0].Format != format || codes[0].Text != text {
+			t.Errorf("Scan(rotated by %v) = %+v; want a %v barcode of %q", angle, codes, format, text)
+		}
+		img = rotate90(img)
+	}
+}
+
+func TestScanCode128(t *testing.T) {
+	values := []int{code128StartA + 1}
+	for _, c := range "Sep-42/x" {
+		values = append(values, int(c)-' ')
+	}
+	scanRotated(t, drawBars(code128Widths(values, code128Check(values)), 3, 60, 40), Code128, "Sep-42/x")
+
+	// Code set C, then B.
+	values = []int{code128StartC, 12, 34, 56, code128CodeB, 'A' - ' '}
+	scanRotated(t, drawBars(code128Widths(values, code128Check(values)), 2, 50, 30), Code128, "123456A")
+}
+
+func TestScanCode128BadCheck(t *testing.T) {
+	values := []int{code128StartA + 1, 'A' - ' ', 'B' - ' ', 'C' - ' '}
+	check := (code128Check(values) + 1) % 103
+	if codes := Scan(drawBars(code128Widths(values, check), 3, 60, 40)); len(codes) != 0 {
+		t.Errorf("Scan found %+v in a barcode with a wrong check value", codes)
+	}
+}
+
+func TestScanCode39(t *testing.T) {
+	for _, wide := range []int{2, 3} {
+		scanRotated(t, drawBars(code39Widths("*DOC-0042*", wide), 3, 50, 40), Code39, "DOC-0042")
+	}
+}
+
+func TestScanBlank(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 200, 100))
+	for i := range img.Pix {
+		img.Pix[i] = 240
+	}
+	if codes := Scan(img); len(codes) != 0 {
+		t.Errorf("Scan found %+v in a blank image", codes)
+	}
+}
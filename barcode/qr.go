@@ -0,0 +1,360 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package barcode
+
+import (
+	"math"
+	"sort"
+)
+
+// finder is a finder pattern of a QR code, one of the three nested squares
+// at its corners, whose dark, light, dark, light and dark modules cross any
+// line through its center in the ratio 1:1:3:1:1.
+type finder struct {
+	// x and y are the center of the pattern, in pixels.
+	x, y float64
+	// module is the size of a module, a square of the code, in pixels.
+	module float64
+	// count is the number of rows on which the pattern was found.
+	count int
+}
+
+// maxFinders bounds the finder patterns combined into QR codes, the most
+// often found first, as every three of them are tried.
+const maxFinders = 15
+
+func scanQR(b *bitmap) []Barcode {
+	finders := findFinders(b)
+	sort.SliceStable(finders, func(i, j int) bool { return finders[i].count > finders[j].count })
+	if len(finders) > maxFinders {
+		finders = finders[:maxFinders]
+	}
+	type triple struct {
+		corners [3]int
+		score   float64
+	}
+	var triples []triple
+	for i := range finders {
+		for j := i + 1; j < len(finders); j++ {
+			for k := j + 1; k < len(finders); k++ {
+				if c, score, ok := orient(finders, i, j, k); ok {
+					triples = append(triples, triple{c, score})
+				}
+			}
+		}
+	}
+	sort.SliceStable(triples, func(i, j int) bool { return triples[i].score < triples[j].score })
+	var found []Barcode
+	used := make(map[int]bool)
+	for _, t := range triples {
+		c := t.corners
+		if used[c[0]] || used[c[1]] || used[c[2]] {
+			continue
+		}
+		if code, ok := decodeQR(b, finders[c[0]], finders[c[1]], finders[c[2]]); ok {
+			found = append(found, code)
+			used[c[0]], used[c[1]], used[c[2]] = true, true, true
+		}
+	}
+	return found
+}
+
+// orient returns the finder patterns i, j and k in the order top left, top
+// right and bottom left, if they could be the corners of a QR code: of
+// similar size, and at the corners of a right isosceles triangle. The lower
+// the score, the more nearly they are.
+func orient(finders []finder, i, j, k int) (corners [3]int, score float64, ok bool) {
+	a, b, c := finders[i], finders[j], finders[k]
+	small := math.Min(a.module, math.Min(b.module, c.module))
+	large := math.Max(a.module, math.Max(b.module, c.module))
+	if large > 1.5*small {
+		return corners, 0, false
+	}
+	// The top left pattern is at the right angle, opposite the longest side.
+	ab, bc, ac := distance(a, b), distance(b, c), distance(a, c)
+	tl, p, q := i, j, k
+	hypotenuse, leg1, leg2 := bc, ab, ac
+	if ac > hypotenuse && ac >= ab {
+		tl, p, q = j, i, k
+		hypotenuse, leg1, leg2 = ac, ab, bc
+	} else if ab > hypotenuse && ab > ac {
+		tl, p, q = k, i, j
+		hypotenuse, leg1, leg2 = ab, ac, bc
+	}
+	angle := math.Abs(hypotenuse*hypotenuse-leg1*leg1-leg2*leg2) / (hypotenuse * hypotenuse)
+	skew := math.Abs(leg1-leg2) / math.Max(leg1, leg2)
+	if angle > 0.2 || skew > 0.2 || math.Min(leg1, leg2) < 10*large {
+		return corners, 0, false
+	}
+	// Going clockwise, as the y axis points down, the top right pattern
+	// comes before the bottom left one.
+	o, u, v := finders[tl], finders[p], finders[q]
+	if (u.x-o.x)*(v.y-o.y)-(u.y-o.y)*(v.x-o.x) < 0 {
+		p, q = q, p
+	}
+	return [3]int{tl, p, q}, angle + skew, true
+}
+
+func distance(a, b finder) float64 {
+	return math.Hypot(a.x-b.x, a.y-b.y)
+}
+
+// findFinders scans every row of b for finder patterns, and confirms each
+// by crossing it vertically and horizontally through its center.
+func findFinders(b *bitmap) []finder {
+	var finders []finder
+	for y := 0; y < b.h; y++ {
+		// counts are the lengths of the last runs of dark, light, dark,
+		// light and dark pixels; state is the index of the current one.
+		var counts [5]int
+		state := 0
+		for x := 0; x <= b.w; x++ {
+			if x < b.w && b.at(x, y) {
+				if state%2 == 1 {
+					state++
+				}
+				counts[state]++
+				continue
+			}
+			if state%2 == 1 {
+				counts[state]++
+				continue
+			}
+			if state < 4 {
+				if counts[0] > 0 {
+					state++
+					counts[state]++
+				}
+				continue
+			}
+			if finderRatio(counts) {
+				if f, ok := confirmFinder(b, counts, x, y); ok {
+					finders = addFinder(finders, f)
+				}
+			}
+			// The last dark, light and dark runs may begin another pattern.
+			counts = [5]int{counts[2], counts[3], counts[4], 1, 0}
+			state = 3
+		}
+	}
+	return finders
+}
+
+// finderRatio reports whether the lengths of five runs are in the ratio
+// 1:1:3:1:1, give or take half a module each.
+func finderRatio(counts [5]int) bool {
+	total := 0
+	for _, c := range counts {
+		if c == 0 {
+			return false
+		}
+		total += c
+	}
+	if total < 7 {
+		return false
+	}
+	module := float64(total) / 7
+	slack := module / 2
+	return math.Abs(module-float64(counts[0])) < slack &&
+		math.Abs(module-float64(counts[1])) < slack &&
+		math.Abs(3*module-float64(counts[2])) < 3*slack &&
+		math.Abs(module-float64(counts[3])) < slack &&
+		math.Abs(module-float64(counts[4])) < slack
+}
+
+// confirmFinder crosses the pattern found in row y, ending at x, vertically
+// and then horizontally through its center, and returns it with its center
+// as found by the crossings.
+func confirmFinder(b *bitmap, counts [5]int, x, y int) (finder, bool) {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	cx := float64(x-counts[4]-counts[3]) - float64(counts[2])/2
+	cy, vertical, ok := crossFinder(b, int(cx), y, 0, 1, counts[2], total)
+	if !ok {
+		return finder{}, false
+	}
+	cx, horizontal, ok := crossFinder(b, int(cx), int(cy), 1, 0, counts[2], total)
+	if !ok {
+		return finder{}, false
+	}
+	return finder{x: cx, y: cy, module: float64(vertical+horizontal) / 14, count: 1}, true
+}
+
+// crossFinder crosses a finder pattern from the pixel x, y, which must be in
+// its central dark square, along the direction dx, dy. It returns the
+// coordinate of the center along that direction and the length of the
+// crossing, which must be about total, with runs in the ratio 1:1:3:1:1 and
+// the outer ones no longer than maxCount.
+func crossFinder(b *bitmap, x, y, dx, dy, maxCount, total int) (center float64, length int, ok bool) {
+	at := func(t int) bool { return b.at(x+t*dx, y+t*dy) }
+	inside := func(t int) bool { return b.inside(x+t*dx, y+t*dy) }
+	var counts [5]int
+	t := 0
+	for at(t) {
+		counts[2]++
+		t--
+	}
+	first := t + 1
+	for inside(t) && !at(t) && counts[1] <= maxCount {
+		counts[1]++
+		t--
+	}
+	for inside(t) && at(t) && counts[0] <= maxCount {
+		counts[0]++
+		t--
+	}
+	t = 1
+	for at(t) {
+		counts[2]++
+		t++
+	}
+	last := t - 1
+	for inside(t) && !at(t) && counts[3] <= maxCount {
+		counts[3]++
+		t++
+	}
+	for inside(t) && at(t) && counts[4] <= maxCount {
+		counts[4]++
+		t++
+	}
+	length = 0
+	for _, c := range counts {
+		length += c
+	}
+	if counts[0] > maxCount || counts[1] > maxCount || counts[3] > maxCount || counts[4] > maxCount ||
+		5*abs(length-total) >= 2*total || !finderRatio(counts) {
+		return 0, 0, false
+	}
+	base := x
+	if dy != 0 {
+		base = y
+	}
+	return float64(base) + float64(first+last+1)/2, length, true
+}
+
+// addFinder adds f to finders, merging it into a pattern found before at
+// about the same place.
+func addFinder(finders []finder, f finder) []finder {
+	for i, e := range finders {
+		if math.Abs(f.x-e.x) <= e.module && math.Abs(f.y-e.y) <= e.module &&
+			math.Abs(f.module-e.module) <= math.Max(1, e.module/2) {
+			n := float64(e.count)
+			finders[i] = finder{
+				x:      (e.x*n + f.x) / (n + 1),
+				y:      (e.y*n + f.y) / (n + 1),
+				module: (e.module*n + f.module) / (n + 1),
+				count:  e.count + 1,
+			}
+			return finders
+		}
+	}
+	return append(finders, f)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// qrTransform maps the modules of a QR code of dim modules a side, whose
+// finder patterns are centered at tl, tr and bl, to pixels. The mapping is
+// affine, which suits codes which were scanned rather than photographed.
+type qrTransform struct {
+	x, y             float64
+	dxRight, dyRight float64
+	dxDown, dyDown   float64
+}
+
+func newQRTransform(tl, tr, bl finder, dim int) qrTransform {
+	span := float64(dim - 7)
+	return qrTransform{
+		x: tl.x, y: tl.y,
+		dxRight: (tr.x - tl.x) / span, dyRight: (tr.y - tl.y) / span,
+		dxDown: (bl.x - tl.x) / span, dyDown: (bl.y - tl.y) / span,
+	}
+}
+
+// point returns the pixel at column u and row v of the modules, where the
+// top left corner of the code is at 0, 0 and the centers of the top left
+// finder pattern at 3.5, 3.5.
+func (t qrTransform) point(u, v float64) (x, y float64) {
+	u, v = u-3.5, v-3.5
+	return t.x + u*t.dxRight + v*t.dxDown, t.y + u*t.dyRight + v*t.dyDown
+}
+
+// sample reads the modules of the code, true for dark ones, row by row.
+func (t qrTransform) sample(b *bitmap, dim int) []bool {
+	grid := make([]bool, dim*dim)
+	for v := 0; v < dim; v++ {
+		for u := 0; u < dim; u++ {
+			x, y := t.point(float64(u)+0.5, float64(v)+0.5)
+			grid[v*dim+u] = b.at(int(math.Floor(x)), int(math.Floor(y)))
+		}
+	}
+	return grid
+}
+
+// decodeQR decodes the QR code whose finder patterns are tl, tr and bl. The
+// version, and so the size, of the code is estimated from their distance,
+// and the neighbouring versions are tried as well, as the estimate may be
+// off by one.
+func decodeQR(b *bitmap, tl, tr, bl finder) (Barcode, bool) {
+	module := (tl.module + tr.module + bl.module) / 3
+	modules := (distance(tl, tr)+distance(tl, bl))/2/module + 7
+	estimate := int(math.Round((modules - 17) / 4))
+	tried := make(map[int]bool)
+	versions := []int{estimate, estimate - 1, estimate + 1}
+	for i := 0; i < len(versions); i++ {
+		v := versions[i]
+		if v < 1 || v > 40 || tried[v] {
+			continue
+		}
+		tried[v] = true
+		dim := 17 + 4*v
+		t := newQRTransform(tl, tr, bl, dim)
+		text, read, err := decodeGrid(t.sample(b, dim), dim)
+		if err == errVersionMismatch {
+			// The version information of the code is more reliable than
+			// the estimate.
+			versions = append(versions, read)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		d := float64(dim)
+		code := Barcode{Format: QRCode, Text: text}
+		code.TopLeftX, code.TopLeftY = round(t.point(0, 0))
+		code.TopRightX, code.TopRightY = round(t.point(d, 0))
+		code.BottomLeftX, code.BottomLeftY = round(t.point(0, d))
+		code.BottomRightX, code.BottomRightY = round(t.point(d, d))
+		return code, true
+	}
+	return Barcode{}, false
+}
+
+func round(x, y float64) (int, int) {
+	return int(math.Round(x)), int(math.Round(y))
+}
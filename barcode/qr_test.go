@@ -0,0 +1,360 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package barcode
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// rsEncode returns data followed by eccLen Reed-Solomon error correction
+// codewords, as a QR code encoder computes them.
+func rsEncode(data []int, eccLen int) []int {
+	divisor := make([]int, eccLen)
+	divisor[eccLen-1] = 1
+	root := 1
+	for i := 0; i < eccLen; i++ {
+		for j := range divisor {
+			divisor[j] = gfMul(divisor[j], root)
+			if j+1 < len(divisor) {
+				divisor[j] ^= divisor[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	ecc := make([]int, eccLen)
+	for _, c := range data {
+		factor := c ^ ecc[0]
+		ecc = append(ecc[1:], 0)
+		for i, d := range divisor {
+			ecc[i] ^= gfMul(d, factor)
+		}
+	}
+	return append(append([]int(nil), data...), ecc...)
+}
+
+// encodeQR returns the modules of a QR code of version v with the given
+// error correction level and mask, holding data in a byte mode segment.
+func encodeQR(t *testing.T, data []byte, v, level, mask int) []bool {
+	dim := 17 + 4*v
+	grid := make([]bool, dim*dim)
+	set := func(x, y int, dark bool) { grid[y*dim+x] = dark }
+
+	// Function patterns: timing, finders, alignment.
+	for i := 0; i < dim; i++ {
+		set(6, i, i%2 == 0)
+		set(i, 6, i%2 == 0)
+	}
+	square := func(cx, cy, radius int, dark func(d int) bool) {
+		for dy := -radius; dy <= radius; dy++ {
+			for dx := -radius; dx <= radius; dx++ {
+				d := abs(dx)
+				if abs(dy) > d {
+					d = abs(dy)
+				}
+				x, y := cx+dx, cy+dy
+				if x >= 0 && y >= 0 && x < dim && y < dim {
+					set(x, y, dark(d))
+				}
+			}
+		}
+	}
+	for _, c := range [][2]int{{3, 3}, {dim - 4, 3}, {3, dim - 4}} {
+		square(c[0], c[1], 4, func(d int) bool { return d != 2 && d != 4 })
+	}
+	positions := alignmentPositions(v)
+	last := len(positions) - 1
+	for i := range positions {
+		for j := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			square(positions[i], positions[j], 2, func(d int) bool { return d != 1 })
+		}
+	}
+
+	// Format and version information.
+	format := [4]int{1, 0, 3, 2}[level]<<3 | mask
+	rem := format
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	formatBits := (format<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return formatBits>>uint(i)&1 != 0 }
+	for i := 0; i <= 5; i++ {
+		set(8, i, bit(i))
+	}
+	set(8, 7, bit(6))
+	set(8, 8, bit(7))
+	set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		set(dim-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		set(8, dim-15+i, bit(i))
+	}
+	set(8, dim-8, true)
+	if v >= 7 {
+		rem := v
+		for i := 0; i < 12; i++ {
+			rem = rem<<1 ^ (rem>>11)*0x1f25
+		}
+		versionBits := v<<12 | rem
+		for i := 0; i < 18; i++ {
+			dark := versionBits>>uint(i)&1 != 0
+			a, b := dim-11+i%3, i/3
+			set(a, b, dark)
+			set(b, a, dark)
+		}
+	}
+
+	// Data codewords, split into blocks and interleaved.
+	raw := rawModules(v) / 8
+	eccLen := eccCodewordsPerBlock[level][v]
+	numBlocks := eccBlocks[level][v]
+	capacity := raw - eccLen*numBlocks
+	var stream []bool
+	put := func(value, n int) {
+		for i := n - 1; i >= 0; i-- {
+			stream = append(stream, value>>uint(i)&1 != 0)
+		}
+	}
+	put(4, 4)
+	if v < 10 {
+		put(len(data), 8)
+	} else {
+		put(len(data), 16)
+	}
+	for _, b := range data {
+		put(int(b), 8)
+	}
+	if len(stream) > capacity*8 {
+		t.Fatalf("%v bytes do not fit in a version %v QR code", len(data), v)
+	}
+	for i := 0; i < 4 && len(stream) < capacity*8; i++ {
+		stream = append(stream, false)
+	}
+	for len(stream)%8 != 0 {
+		stream = append(stream, false)
+	}
+	var codewords []int
+	for i := 0; i < len(stream); i += 8 {
+		c := 0
+		for _, dark := range stream[i : i+8] {
+			c <<= 1
+			if dark {
+				c |= 1
+			}
+		}
+		codewords = append(codewords, c)
+	}
+	for i := 0; len(codewords) < capacity; i++ {
+		codewords = append(codewords, []int{0xec, 0x11}[i%2])
+	}
+	numShort := numBlocks - raw%numBlocks
+	shortLen := raw / numBlocks
+	var blocks [][]int
+	for b, k := 0, 0; b < numBlocks; b++ {
+		n := shortLen - eccLen
+		if b >= numShort {
+			n++
+		}
+		blocks = append(blocks, rsEncode(codewords[k:k+n], eccLen))
+		k += n
+	}
+	var interleaved []int
+	for i := 0; i <= shortLen; i++ {
+		for _, block := range blocks {
+			if i < len(block)-eccLen {
+				interleaved = append(interleaved, block[i])
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for _, block := range blocks {
+			interleaved = append(interleaved, block[len(block)-eccLen+i])
+		}
+	}
+
+	// Placement in the zigzag order, then masking.
+	function := functionPatterns(v)
+	i := 0
+	for right := dim - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < dim; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = dim - 1 - vert
+				}
+				if !function[y*dim+x] && i < len(interleaved)*8 {
+					grid[y*dim+x] = interleaved[i>>3]>>uint(7-i&7)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+	for y := 0; y < dim; y++ {
+		for x := 0; x < dim; x++ {
+			if !function[y*dim+x] && masked(mask, y, x) {
+				grid[y*dim+x] = !grid[y*dim+x]
+			}
+		}
+	}
+	return grid
+}
+
+// renderQR draws the dim by dim modules of grid in the middle of a size by
+// size image, scale pixels to a module and rotated by angle degrees.
+func renderQR(grid []bool, dim int, scale, angle float64, size int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	center := float64(size) / 2
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := float64(x)+0.5-center, float64(y)+0.5-center
+			u := int(math.Floor((cos*dx+sin*dy)/scale + float64(dim)/2))
+			v := int(math.Floor((-sin*dx+cos*dy)/scale + float64(dim)/2))
+			gray := uint8(235)
+			if u >= 0 && v >= 0 && u < dim && v < dim && grid[v*dim+u] {
+				gray = 20
+			}
+			img.SetGray(x, y, color.Gray{gray})
+		}
+	}
+	return img
+}
+
+func TestScanQR(t *testing.T) {
+	tests := []struct {
+		text           string
+		version, level int
+		mask           int
+		scale, angle   float64
+		size           int
+	}{
+		{"SEP-000123", 1, levelM, 2, 4, 0, 200},
+		{"hello, world", 2, levelL, 5, 3.3, 90, 200},
+		{"https://example.com/documents/4711?batch=19", 4, levelQ, 7, 5, 180, 300},
+		{"Grüße aus Köln", 3, levelH, 1, 6, 2, 300},
+		// Versions from 7 carry version information.
+		{"A payload long enough to need version eight: 0123456789 ABCDEFGHIJ", 8, levelM, 3, 4, 270, 400},
+		// Several blocks of two lengths.
+		{"Twelve, at level H, interleaves blocks of two lengths: abcdefghijklmnopqrstuvwxyz 0123456789", 12, levelH, 6, 3, -1.5, 400},
+	}
+	for _, tt := range tests {
+		dim := 17 + 4*tt.version
+		grid := encodeQR(t, []byte(tt.text), tt.version, tt.level, tt.mask)
+		if text, version, err := decodeGrid(grid, dim); err != nil || text != tt.text || version != tt.version {
+			t.Errorf("decodeGrid(version %v) = %q, %v, %v; want %q, %v, nil", tt.version, text, version, err, tt.text, tt.version)
+			continue
+		}
+		codes := Scan(renderQR(grid, dim, tt.scale, tt.angle, tt.size))
+		if len(codes) != 1 || codes[0].Format != QRCode || codes[0].Text != tt.text {
+			t.Errorf("Scan(version %v rotated by %v) = %+v; want a QR code of %q", tt.version, tt.angle, codes, tt.text)
+		}
+	}
+}
+
+func TestScanQRCorners(t *testing.T) {
+	grid := encodeQR(t, []byte("SEP-000123"), 1, levelM, 2)
+	// 21 modules of 4 pixels, from 58 to 142.
+	// The top left, top right and bottom left corners.
+	for _, tt := range []struct {
+		angle float64
+		want  [6]int
+	}{
+		{0, [6]int{58, 58, 142, 58, 58, 142}},
+		{180, [6]int{142, 142, 58, 142, 142, 58}},
+	} {
+		codes := Scan(renderQR(grid, 21, 4, tt.angle, 200))
+		if len(codes) != 1 {
+			t.Fatalf("Scan(rotated by %v) found %v barcodes; want 1", tt.angle, len(codes))
+		}
+		c := codes[0]
+		got := [6]int{c.TopLeftX, c.TopLeftY, c.TopRightX, c.TopRightY, c.BottomLeftX, c.BottomLeftY}
+		for i := range got {
+			if abs(got[i]-tt.want[i]) > 2 {
+				t.Errorf("Scan(rotated by %v) corners = %v; want %v", tt.angle, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestDecodeGridCorrectsErrors(t *testing.T) {
+	const text = "correct me please"
+	grid := encodeQR(t, []byte(text), 3, levelM, 0)
+	const dim = 29
+	for _, p := range [][2]int{{20, 20}, {21, 22}, {15, 25}, {24, 12}, {10, 18}} {
+		grid[p[1]*dim+p[0]] = !grid[p[1]*dim+p[0]]
+	}
+	if got, _, err := decodeGrid(grid, dim); err != nil || got != text {
+		t.Errorf("decodeGrid = %q, %v; want %q", got, err, text)
+	}
+}
+
+func TestCorrectErrors(t *testing.T) {
+	data := []int{0x40, 0xd2, 0x75, 0x47, 0x76, 0x17, 0x32, 0x06, 0x27, 0x26, 0x96, 0xc6, 0xc6, 0x96, 0x70, 0xec}
+	const eccLen = 10
+	want := rsEncode(data, eccLen)
+	tests := []struct {
+		name      string
+		positions []int
+	}{
+		{"none", nil},
+		{"one data codeword", []int{3}},
+		{"first and last", []int{0, len(want) - 1}},
+		{"error correction codewords", []int{17, 20, 23}},
+		{"as many as correctable", []int{1, 5, 9, 16, 25}},
+	}
+	for _, tt := range tests {
+		block := append([]int(nil), want...)
+		for i, p := range tt.positions {
+			block[p] ^= 0x5a + i
+		}
+		if err := correctErrors(block, eccLen); err != nil {
+			t.Errorf("%v: correctErrors: %v", tt.name, err)
+			continue
+		}
+		for i := range block {
+			if block[i] != want[i] {
+				t.Errorf("%v: correctErrors left %v; want %v", tt.name, block, want)
+				break
+			}
+		}
+	}
+
+	block := append([]int(nil), want...)
+	for _, p := range []int{0, 2, 4, 6, 8, 10, 12} {
+		block[p] ^= 0xff
+	}
+	if err := correctErrors(block, eccLen); err == nil {
+		t.Error("correctErrors corrected 7 errors with 10 error correction codewords")
+	}
+}
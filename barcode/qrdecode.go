@@ -0,0 +1,484 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package barcode
+
+import (
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	errFormat          = errors.New("barcode: unreadable QR code format information")
+	errVersionMismatch = errors.New("barcode: QR code version differs from its size")
+	errCodewords       = errors.New("barcode: unexpected number of QR code codewords")
+	errSegment         = errors.New("barcode: malformed or unsupported QR code data segment")
+)
+
+// Error correction levels of QR codes, in the order of the tables below.
+const (
+	levelL = iota
+	levelM
+	levelQ
+	levelH
+)
+
+// eccCodewordsPerBlock and eccBlocks give, for each error correction level
+// and version, the number of error correction codewords in each block and
+// the number of blocks.
+var eccCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+var eccBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// rawModules returns the number of modules of a QR code of version v which
+// hold codewords, rather than function patterns and format and version
+// information.
+func rawModules(v int) int {
+	n := (16*v+128)*v + 64
+	if v >= 2 {
+		align := v/7 + 2
+		n -= (25*align-10)*align - 55
+		if v >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// alignmentPositions returns the rows, and columns, of the centers of the
+// alignment patterns of a QR code of version v.
+func alignmentPositions(v int) []int {
+	if v == 1 {
+		return nil
+	}
+	n := v/7 + 2
+	step := 26
+	if v != 32 {
+		step = (v*4 + n*2 + 1) / (n*2 - 2) * 2
+	}
+	positions := make([]int, n)
+	positions[0] = 6
+	for i, p := n-1, 17+4*v-7; i > 0; i, p = i-1, p-step {
+		positions[i] = p
+	}
+	return positions
+}
+
+// bch returns data followed by the remainder of its division by the
+// generator polynomial, whose degree is n.
+func bch(data, generator uint32, n uint) uint32 {
+	rem := data << n
+	for i := 31; i >= int(n); i-- {
+		if rem&(1<<uint(i)) != 0 {
+			rem ^= generator << uint(i-int(n))
+		}
+	}
+	return data<<n | rem
+}
+
+// decodeGrid decodes the modules of a QR code of dim modules a side, true
+// for dark ones, row by row. If the version information of the code does
+// not match its size, it returns errVersionMismatch and the version read.
+func decodeGrid(grid []bool, dim int) (text string, version int, err error) {
+	get := func(x, y int) bool { return grid[y*dim+x] }
+	version = (dim - 17) / 4
+	level, mask, err := readFormat(get, dim)
+	if err != nil {
+		return "", 0, err
+	}
+	if version >= 7 {
+		read, ok := readVersion(get, dim)
+		if !ok {
+			return "", 0, errFormat
+		}
+		if read != version {
+			return "", read, errVersionMismatch
+		}
+	}
+	function := functionPatterns(version)
+	codewords := make([]byte, 0, rawModules(version)/8)
+	var bitsRead, current uint
+	up := true
+	for j := dim - 1; j > 0; j -= 2 {
+		if j == 6 {
+			// The vertical timing pattern is skipped.
+			j--
+		}
+		for count := 0; count < dim; count++ {
+			i := count
+			if up {
+				i = dim - 1 - count
+			}
+			for col := 0; col < 2; col++ {
+				x := j - col
+				if function[i*dim+x] {
+					continue
+				}
+				current <<= 1
+				if get(x, i) != masked(mask, i, x) {
+					current |= 1
+				}
+				if bitsRead++; bitsRead == 8 {
+					codewords = append(codewords, byte(current))
+					bitsRead, current = 0, 0
+				}
+			}
+		}
+		up = !up
+	}
+	if len(codewords) != rawModules(version)/8 {
+		return "", 0, errCodewords
+	}
+	data, err := correct(codewords, version, level)
+	if err != nil {
+		return "", 0, err
+	}
+	text, err = decodeSegments(data, version)
+	return text, version, err
+}
+
+// readFormat reads the error correction level and the data mask of a QR
+// code from either copy of its format information, allowing up to three
+// bit errors.
+func readFormat(get func(x, y int) bool, dim int) (level, mask int, err error) {
+	var first, second uint32
+	bit := func(bits *uint32, x, y int) {
+		*bits <<= 1
+		if get(x, y) {
+			*bits |= 1
+		}
+	}
+	for i := 0; i < 6; i++ {
+		bit(&first, i, 8)
+	}
+	bit(&first, 7, 8)
+	bit(&first, 8, 8)
+	bit(&first, 8, 7)
+	for j := 5; j >= 0; j-- {
+		bit(&first, 8, j)
+	}
+	for j := dim - 1; j >= dim-7; j-- {
+		bit(&second, 8, j)
+	}
+	for i := dim - 8; i < dim; i++ {
+		bit(&second, i, 8)
+	}
+	best, bestDistance := 0, 4
+	for data := uint32(0); data < 32; data++ {
+		code := bch(data, 0x537, 10) ^ 0x5412
+		for _, read := range []uint32{first, second} {
+			if d := bits.OnesCount32(code ^ read); d < bestDistance {
+				best, bestDistance = int(data), d
+			}
+		}
+	}
+	if bestDistance > 3 {
+		return 0, 0, errFormat
+	}
+	// The two bits of the level are 01 for L, 00 for M, 11 for Q and 10
+	// for H.
+	level = [4]int{levelM, levelL, levelH, levelQ}[best>>3]
+	return level, best & 7, nil
+}
+
+// readVersion reads the version of a QR code of version 7 or more from
+// either copy of its version information, allowing up to three bit errors.
+func readVersion(get func(x, y int) bool, dim int) (int, bool) {
+	var first, second uint32
+	for j := 5; j >= 0; j-- {
+		for i := dim - 9; i >= dim-11; i-- {
+			first <<= 1
+			if get(i, j) {
+				first |= 1
+			}
+		}
+	}
+	for i := 5; i >= 0; i-- {
+		for j := dim - 9; j >= dim-11; j-- {
+			second <<= 1
+			if get(i, j) {
+				second |= 1
+			}
+		}
+	}
+	best, bestDistance := 0, 4
+	for v := uint32(7); v <= 40; v++ {
+		code := bch(v, 0x1f25, 12)
+		for _, read := range []uint32{first, second} {
+			if d := bits.OnesCount32(code ^ read); d < bestDistance {
+				best, bestDistance = int(v), d
+			}
+		}
+	}
+	return best, bestDistance <= 3
+}
+
+// functionPatterns returns which modules of a QR code of version v are not
+// data: the finder, alignment and timing patterns and the format and
+// version information.
+func functionPatterns(v int) []bool {
+	dim := 17 + 4*v
+	function := make([]bool, dim*dim)
+	set := func(left, top, width, height int) {
+		for y := top; y < top+height; y++ {
+			for x := left; x < left+width; x++ {
+				function[y*dim+x] = true
+			}
+		}
+	}
+	set(0, 0, 9, 9)
+	set(dim-8, 0, 8, 9)
+	set(0, dim-8, 9, 8)
+	positions := alignmentPositions(v)
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			// No alignment pattern overlaps a finder pattern.
+			if (i == 0 && (j == 0 || j == last)) || (i == last && j == 0) {
+				continue
+			}
+			set(x-2, y-2, 5, 5)
+		}
+	}
+	set(6, 9, 1, dim-17)
+	set(9, 6, dim-17, 1)
+	if v >= 7 {
+		set(dim-11, 0, 3, 6)
+		set(0, dim-11, 6, 3)
+	}
+	return function
+}
+
+// masked reports whether the data mask flips the module in row i and column
+// j.
+func masked(mask, i, j int) bool {
+	switch mask {
+	case 0:
+		return (i+j)%2 == 0
+	case 1:
+		return i%2 == 0
+	case 2:
+		return j%3 == 0
+	case 3:
+		return (i+j)%3 == 0
+	case 4:
+		return (i/2+j/3)%2 == 0
+	case 5:
+		return (i*j)%2+(i*j)%3 == 0
+	case 6:
+		return ((i*j)%2+(i*j)%3)%2 == 0
+	default:
+		return ((i+j)%2+(i*j)%3)%2 == 0
+	}
+}
+
+// correct separates the interleaved blocks of codewords of a QR code,
+// corrects the errors in each, and returns their data codewords.
+func correct(codewords []byte, version, level int) ([]byte, error) {
+	numBlocks := eccBlocks[level][version]
+	eccLen := eccCodewordsPerBlock[level][version]
+	numShort := numBlocks - len(codewords)%numBlocks
+	shortLen := len(codewords) / numBlocks
+	blocks := make([][]int, numBlocks)
+	dataLen := make([]int, numBlocks)
+	for i := range blocks {
+		dataLen[i] = shortLen - eccLen
+		if i >= numShort {
+			dataLen[i]++
+		}
+		blocks[i] = make([]int, dataLen[i]+eccLen)
+	}
+	k := 0
+	for i := 0; i <= shortLen-eccLen; i++ {
+		for b := range blocks {
+			if i < dataLen[b] {
+				blocks[b][i] = int(codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for b := range blocks {
+			blocks[b][dataLen[b]+i] = int(codewords[k])
+			k++
+		}
+	}
+	var data []byte
+	for b, block := range blocks {
+		if err := correctErrors(block, eccLen); err != nil {
+			return nil, err
+		}
+		for _, c := range block[:dataLen[b]] {
+			data = append(data, byte(c))
+		}
+	}
+	return data, nil
+}
+
+// bitReader reads a big-endian stream of bits.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) available() int {
+	return 8*len(r.data) - r.pos
+}
+
+func (r *bitReader) read(n int) (int, bool) {
+	if n > r.available() {
+		return 0, false
+	}
+	v := 0
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if r.data[r.pos/8]&(0x80>>uint(r.pos%8)) != 0 {
+			v |= 1
+		}
+		r.pos++
+	}
+	return v, true
+}
+
+const alphanumeric = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ $%*+-./:"
+
+// decodeSegments decodes the data of a QR code of version v. Numeric,
+// alphanumeric and byte segments are supported; bytes are taken as UTF-8 if
+// they are valid UTF-8, and as ISO 8859-1 otherwise.
+func decodeSegments(data []byte, v int) (string, error) {
+	size := 0
+	if v >= 27 {
+		size = 2
+	} else if v >= 10 {
+		size = 1
+	}
+	r := &bitReader{data: data}
+	var text strings.Builder
+	for r.available() >= 4 {
+		mode, _ := r.read(4)
+		switch mode {
+		case 0:
+			return text.String(), nil
+		case 1:
+			n, ok := r.read([3]int{10, 12, 14}[size])
+			for ; ok && n >= 3; n -= 3 {
+				var d int
+				if d, ok = r.read(10); ok && d < 1000 {
+					text.WriteString(leftPad(d, 3))
+				}
+			}
+			if ok && n == 2 {
+				var d int
+				if d, ok = r.read(7); ok && d < 100 {
+					text.WriteString(leftPad(d, 2))
+				}
+			} else if ok && n == 1 {
+				var d int
+				if d, ok = r.read(4); ok && d < 10 {
+					text.WriteString(leftPad(d, 1))
+				}
+			}
+			if !ok {
+				return "", errSegment
+			}
+		case 2:
+			n, ok := r.read([3]int{9, 11, 13}[size])
+			for ; ok && n >= 2; n -= 2 {
+				var d int
+				if d, ok = r.read(11); ok && d < 45*45 {
+					text.WriteByte(alphanumeric[d/45])
+					text.WriteByte(alphanumeric[d%45])
+				}
+			}
+			if ok && n == 1 {
+				var d int
+				if d, ok = r.read(6); ok && d < 45 {
+					text.WriteByte(alphanumeric[d])
+				}
+			}
+			if !ok {
+				return "", errSegment
+			}
+		case 4:
+			n, ok := r.read([3]int{8, 16, 16}[size])
+			bytes := make([]byte, 0, n)
+			for ; ok && n > 0; n-- {
+				var c int
+				if c, ok = r.read(8); ok {
+					bytes = append(bytes, byte(c))
+				}
+			}
+			if !ok {
+				return "", errSegment
+			}
+			if utf8.Valid(bytes) {
+				text.Write(bytes)
+			} else {
+				for _, c := range bytes {
+					text.WriteRune(rune(c))
+				}
+			}
+		case 7:
+			// The ECI designator, which names a character set, is
+			// skipped; byte segments are decoded as described above.
+			first, ok := r.read(8)
+			if ok && first&0xc0 == 0x80 {
+				_, ok = r.read(8)
+			} else if ok && first&0xe0 == 0xc0 {
+				_, ok = r.read(16)
+			}
+			if !ok {
+				return "", errSegment
+			}
+		case 3:
+			// Structured append: the position of the code in a sequence.
+			if _, ok := r.read(16); !ok {
+				return "", errSegment
+			}
+		case 5:
+			// FNC1 in the first position marks GS1 data, which is read as is.
+		case 9:
+			if _, ok := r.read(8); !ok {
+				return "", errSegment
+			}
+		default:
+			return "", errSegment
+		}
+	}
+	return text.String(), nil
+}
+
+func leftPad(n, width int) string {
+	s := strconv.Itoa(n)
+	return strings.Repeat("0", width-len(s)) + s
+}
@@ -0,0 +1,217 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package barcode
+
+import "errors"
+
+var errTooManyErrors = errors.New("barcode: too many errors to correct")
+
+// gfExp and gfLog are the powers of the generator of GF(256), with the
+// primitive polynomial x^8 + x^4 + x^3 + x^2 + 1 of QR codes, and their
+// logarithms.
+var gfExp, gfLog = func() (exp [512]int, log [256]int) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i], exp[i+255] = x, x
+		log[x] = i
+		if x <<= 1; x >= 256 {
+			x ^= 0x11d
+		}
+	}
+	return exp, log
+}()
+
+func gfMul(a, b int) int {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[gfLog[a]+gfLog[b]]
+}
+
+func gfInverse(a int) int {
+	return gfExp[255-gfLog[a]]
+}
+
+// poly is a polynomial over GF(256), with its coefficients from the highest
+// degree down and no leading zeros, except for the zero polynomial, {0}.
+type poly []int
+
+func newPoly(c []int) poly {
+	for len(c) > 1 && c[0] == 0 {
+		c = c[1:]
+	}
+	return poly(c)
+}
+
+func monomial(degree, c int) poly {
+	if c == 0 {
+		return poly{0}
+	}
+	p := make(poly, degree+1)
+	p[0] = c
+	return p
+}
+
+func (p poly) degree() int    { return len(p) - 1 }
+func (p poly) zero() bool     { return p[0] == 0 }
+func (p poly) coef(d int) int { return p[len(p)-1-d] }
+
+func (p poly) eval(x int) int {
+	if x == 0 {
+		return p.coef(0)
+	}
+	y := 0
+	for _, c := range p {
+		y = gfMul(y, x) ^ c
+	}
+	return y
+}
+
+func (p poly) add(q poly) poly {
+	if len(p) < len(q) {
+		p, q = q, p
+	}
+	sum := make([]int, len(p))
+	copy(sum, p)
+	for i, c := range q {
+		sum[len(p)-len(q)+i] ^= c
+	}
+	return newPoly(sum)
+}
+
+func (p poly) mul(q poly) poly {
+	if p.zero() || q.zero() {
+		return poly{0}
+	}
+	product := make([]int, len(p)+len(q)-1)
+	for i, a := range p {
+		for j, b := range q {
+			product[i+j] ^= gfMul(a, b)
+		}
+	}
+	return newPoly(product)
+}
+
+func (p poly) scale(degree, c int) poly {
+	if c == 0 {
+		return poly{0}
+	}
+	product := make([]int, len(p)+degree)
+	for i, a := range p {
+		product[i] = gfMul(a, c)
+	}
+	return newPoly(product)
+}
+
+// correctErrors corrects the errors in a Reed-Solomon block of codewords,
+// the last eccLen of which are error correction codewords, in place.
+func correctErrors(block []int, eccLen int) error {
+	received := newPoly(append([]int(nil), block...))
+	syndromes := make([]int, eccLen)
+	clean := true
+	for i := range syndromes {
+		s := received.eval(gfExp[i])
+		syndromes[eccLen-1-i] = s
+		if s != 0 {
+			clean = false
+		}
+	}
+	if clean {
+		return nil
+	}
+	sigma, omega, err := euclid(monomial(eccLen, 1), newPoly(syndromes), eccLen)
+	if err != nil {
+		return err
+	}
+	locations, err := errorLocations(sigma)
+	if err != nil {
+		return err
+	}
+	for _, l := range locations {
+		inverse := gfInverse(l)
+		denominator := 1
+		for _, m := range locations {
+			if m != l {
+				denominator = gfMul(denominator, gfMul(m, inverse)^1)
+			}
+		}
+		position := len(block) - 1 - gfLog[l]
+		if position < 0 {
+			return errTooManyErrors
+		}
+		block[position] ^= gfMul(omega.eval(inverse), gfInverse(denominator))
+	}
+	return nil
+}
+
+// euclid finds the error locator and error evaluator polynomials by the
+// extended Euclidean algorithm.
+func euclid(a, b poly, r int) (sigma, omega poly, err error) {
+	if a.degree() < b.degree() {
+		a, b = b, a
+	}
+	rLast, rCur := a, b
+	tLast, tCur := poly{0}, poly{1}
+	for 2*rCur.degree() >= r {
+		rLastLast, tLastLast := rLast, tLast
+		rLast, tLast = rCur, tCur
+		if rLast.zero() {
+			return nil, nil, errTooManyErrors
+		}
+		rCur = rLastLast
+		q := poly{0}
+		inverse := gfInverse(rLast.coef(rLast.degree()))
+		for rCur.degree() >= rLast.degree() && !rCur.zero() {
+			diff := rCur.degree() - rLast.degree()
+			c := gfMul(rCur.coef(rCur.degree()), inverse)
+			q = q.add(monomial(diff, c))
+			rCur = rCur.add(rLast.scale(diff, c))
+		}
+		tCur = q.mul(tLast).add(tLastLast)
+		if rCur.degree() >= rLast.degree() {
+			return nil, nil, errTooManyErrors
+		}
+	}
+	c := tCur.coef(0)
+	if c == 0 {
+		return nil, nil, errTooManyErrors
+	}
+	inverse := gfInverse(c)
+	return tCur.scale(0, inverse), rCur.scale(0, inverse), nil
+}
+
+// errorLocations returns the inverses of the roots of the error locator.
+func errorLocations(sigma poly) ([]int, error) {
+	n := sigma.degree()
+	if n == 1 {
+		return []int{sigma.coef(1)}, nil
+	}
+	var locations []int
+	for x := 1; x < 256 && len(locations) < n; x++ {
+		if sigma.eval(x) == 0 {
+			locations = append(locations, gfInverse(x))
+		}
+	}
+	if len(locations) != n {
+		return nil, errTooManyErrors
+	}
+	return locations, nil
+}
@@ -0,0 +1,153 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"math"
+
+	"github.com/siftrics/sight/barcode"
+	"github.com/siftrics/sight/internal/pdf"
+)
+
+// ScanBarcodes decodes the barcodes on each page of f, an image or a PDF,
+// without submitting it, so that pages can be routed by the identifiers
+// printed on them before their text is recognized, e.g., to split a batch
+// of scans at its separator sheets. The barcodes of page n are at index
+// n-1. Barcodes of an image are located in its pixels, as it is, before
+// any rotation. Those of a PDF are only found in the images drawn on its
+// pages, such as scans, and are located at 72 DPI, where a pixel is a PDF
+// point. passwords are tried for an encrypted PDF after the empty password.
+// Images in BMP format are not supported.
+func ScanBarcodes(f File, passwords ...string) ([][]barcode.Barcode, error) {
+	if !isPDF(f) {
+		img, _, err := image.Decode(bytes.NewReader(f.Contents))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode image: %v", err)
+		}
+		return [][]barcode.Barcode{barcode.Scan(img)}, nil
+	}
+	r, err := openPDF(f.Contents, append([]string{""}, passwords...))
+	if err != nil {
+		return nil, err
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		return nil, err
+	}
+	found := make([][]barcode.Barcode, len(pages))
+	for i, p := range pages {
+		content, err := r.PageContent(p)
+		if err != nil {
+			return nil, err
+		}
+		for _, placed := range content.Images {
+			if placed.Ref == (pdf.Ref{}) {
+				continue
+			}
+			o, err := r.Resolve(placed.Ref)
+			if err != nil {
+				return nil, err
+			}
+			stm, ok := o.(pdf.Stream)
+			if !ok {
+				continue
+			}
+			// Images which cannot be decoded, such as bilevel ones,
+			// are skipped rather than failing the whole file.
+			img, err := r.DecodeImage(stm)
+			if err != nil {
+				continue
+			}
+			for _, b := range barcode.Scan(img) {
+				found[i] = append(found[i], placeBarcode(b, img.Bounds(), placed.Matrix, p))
+			}
+		}
+	}
+	return found, nil
+}
+
+// placeBarcode moves b from the pixels of an image, drawn on p with matrix
+// m, to the pixels of p at 72 DPI.
+func placeBarcode(b barcode.Barcode, bounds image.Rectangle, m [6]float64, p pdf.Page) barcode.Barcode {
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	place := func(x, y *int) {
+		// Images are drawn in the unit square, with their first row at
+		// the top.
+		u, v := float64(*x)/w, 1-float64(*y)/h
+		px, py := p.FromUserSpace(m[0]*u+m[2]*v+m[4], m[1]*u+m[3]*v+m[5])
+		*x, *y = int(math.Round(px)), int(math.Round(py))
+	}
+	place(&b.TopLeftX, &b.TopLeftY)
+	place(&b.TopRightX, &b.TopRightY)
+	place(&b.BottomLeftX, &b.BottomLeftY)
+	place(&b.BottomRightX, &b.BottomRightY)
+	return b
+}
+
+// scaleBarcodes returns barcodes with their coordinates multiplied by
+// scale.
+func scaleBarcodes(barcodes []barcode.Barcode, scale float64) []barcode.Barcode {
+	scaled := make([]barcode.Barcode, len(barcodes))
+	for i, b := range barcodes {
+		for _, c := range []*int{&b.TopLeftX, &b.TopLeftY, &b.TopRightX, &b.TopRightY,
+			&b.BottomLeftX, &b.BottomLeftY, &b.BottomRightX, &b.BottomRightY} {
+			*c = int(math.Round(float64(*c) * scale))
+		}
+		scaled[i] = b
+	}
+	return scaled
+}
+
+// barcodeDetector returns a PostProcessor which sets the Barcodes of the
+// pages of files with ScanBarcodes, scanning each file when its first page
+// arrives. The barcodes of a PDF page are scaled to its DPI if the Sight
+// API reported it. Files which cannot be scanned are logged, and their
+// pages are left without barcodes.
+func (c *Client) barcodeDetector(cfg Config, files []File) PostProcessorFunc {
+	scanned := make(map[int][][]barcode.Barcode)
+	return func(p RecognizedPage) RecognizedPage {
+		if p.FileIndex < 0 || p.FileIndex >= len(files) || p.PageNumber <= 0 {
+			return p
+		}
+		f := files[p.FileIndex]
+		found, ok := scanned[p.FileIndex]
+		if !ok {
+			var err error
+			found, err = ScanBarcodes(f, pdfPasswords(cfg, f)[1:]...)
+			if err != nil {
+				c.logger.Warn("failed to scan a file for barcodes", "file", fileName(f, p.FileIndex), "error", err)
+			}
+			scanned[p.FileIndex] = found
+		}
+		if p.PageNumber <= len(found) && len(found[p.PageNumber-1]) > 0 {
+			scale := 1.0
+			if isPDF(f) && p.DPI > 0 {
+				scale = float64(p.DPI) / 72
+			}
+			p.Barcodes = scaleBarcodes(found[p.PageNumber-1], scale)
+		}
+		return p
+	}
+}
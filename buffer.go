@@ -0,0 +1,182 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"os"
+)
+
+// defaultChannelBuffer is the number of pages a channel of results holds
+// if Config.ChannelBuffer is not set.
+const defaultChannelBuffer = 16
+
+// bufferPages sends the pages from in on the channel it returns, holding up
+// to buffer pages which have not been read yet in memory. If dir is not
+// empty, pages beyond those are written to a temporary file in dir and read
+// back in turn, so that in is always read promptly, however slow the reader
+// of the channel; otherwise reading in waits while the buffer is full.
+func (c *Client) bufferPages(in <-chan RecognizedPage, buffer int, dir string) <-chan RecognizedPage {
+	if buffer <= 0 {
+		buffer = defaultChannelBuffer
+	}
+	if dir == "" {
+		out := make(chan RecognizedPage, buffer)
+		go func() {
+			for p := range in {
+				out <- p
+			}
+			close(out)
+		}()
+		return out
+	}
+	out := make(chan RecognizedPage)
+	go func() {
+		s := &spill{dir: dir, log: c.logger}
+		var queue []RecognizedPage
+		for in != nil || len(queue) > 0 {
+			// Sending on a nil channel blocks, so nothing is sent while
+			// the queue is empty.
+			var send chan<- RecognizedPage
+			var next RecognizedPage
+			if len(queue) > 0 {
+				send, next = out, queue[0]
+			}
+			select {
+			case p, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				if s.len() == 0 && len(queue) < buffer {
+					queue = append(queue, p)
+				} else {
+					s.write(p)
+				}
+			case send <- next:
+				queue[0] = RecognizedPage{}
+				queue = queue[1:]
+				for len(queue) < buffer && s.len() > 0 {
+					p, ok := s.read()
+					if !ok {
+						break
+					}
+					queue = append(queue, p)
+				}
+			}
+		}
+		s.close()
+		close(out)
+	}()
+	return out
+}
+
+// spill is a temporary file of pages, first in, first out. Pages are
+// written with encoding/gob, so those with JobFailed set keep the text of
+// their Err but not the *PollError. Once writing to the file has failed,
+// it is not tried again, and later pages are kept in memory after those
+// in the file, so that they are still read in the order they were
+// written.
+type spill struct {
+	dir string
+	log Logger
+	w   *os.File
+	enc *gob.Encoder
+	dec *gob.Decoder
+	rf  *os.File
+	// pending is the number of pages in the file which have not been
+	// read, and held those kept in memory after them.
+	pending int
+	held    []RecognizedPage
+	failed  bool
+}
+
+// len returns the number of pages which have not been read.
+func (s *spill) len() int {
+	return s.pending + len(s.held)
+}
+
+// write appends p to the file, creating it if need be, or to the pages
+// held in memory if writing to the file has failed.
+func (s *spill) write(p RecognizedPage) {
+	if !s.failed && s.w == nil {
+		w, err := ioutil.TempFile(s.dir, "sight-pages-*.gob")
+		if err != nil {
+			s.fail(err)
+		} else {
+			s.w = w
+			if s.rf, err = os.Open(w.Name()); err != nil {
+				s.fail(err)
+			}
+			s.enc, s.dec = gob.NewEncoder(s.w), gob.NewDecoder(s.rf)
+		}
+	}
+	if !s.failed {
+		if err := s.enc.Encode(&p); err != nil {
+			s.fail(err)
+		} else {
+			s.pending++
+			return
+		}
+	}
+	s.held = append(s.held, p)
+}
+
+// read returns the oldest page which has not been read.
+func (s *spill) read() (RecognizedPage, bool) {
+	if s.pending > 0 {
+		var p RecognizedPage
+		err := s.dec.Decode(&p)
+		if err == nil {
+			s.pending--
+			return p, true
+		}
+		// The pages left in the file are lost, as if polling for them
+		// had been given up on.
+		s.log.Error("failed to read pages back from the spill file; they are lost", "file", s.w.Name(), "pages", s.pending, "error", err)
+		s.pending = 0
+		s.failed = true
+	}
+	if len(s.held) == 0 {
+		return RecognizedPage{}, false
+	}
+	p := s.held[0]
+	s.held[0] = RecognizedPage{}
+	s.held = s.held[1:]
+	return p, true
+}
+
+func (s *spill) fail(err error) {
+	s.failed = true
+	s.log.Warn("failed to write pages to a spill file; keeping the rest in memory", "dir", s.dir, "error", err)
+}
+
+// close removes the file.
+func (s *spill) close() {
+	if s.rf != nil {
+		s.rf.Close()
+	}
+	if s.w != nil {
+		s.w.Close()
+		os.Remove(s.w.Name())
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// checkInOrder reads n pages from out and checks that they are numbered
+// from 1 to n and that out is then closed.
+func checkInOrder(t *testing.T, out <-chan RecognizedPage, n int) {
+	t.Helper()
+	i := 0
+	for p := range out {
+		i++
+		if p.PageNumber != i {
+			t.Fatalf("page %v received as number %v", p.PageNumber, i)
+		}
+	}
+	if i != n {
+		t.Errorf("received %v pages, want %v", i, n)
+	}
+}
+
+// spillFiles returns the spill files in dir.
+func spillFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "sight-pages-*.gob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestBufferPagesSpill(t *testing.T) {
+	dir := t.TempDir()
+	in := make(chan RecognizedPage)
+	out := NewClient("key").bufferPages(in, 2, dir)
+	// Every page is taken from in without out being read, with all but
+	// the first two spilled.
+	const n = 50
+	for i := 1; i <= n; i++ {
+		in <- RecognizedPage{PageNumber: i, RecognizedText: []RecognizedText{{Text: "text"}}}
+	}
+	close(in)
+	if files := spillFiles(t, dir); len(files) != 1 {
+		t.Errorf("spill files = %q, want one", files)
+	}
+	checkInOrder(t, out, n)
+	if files := spillFiles(t, dir); len(files) != 0 {
+		t.Errorf("spill files %q were left behind", files)
+	}
+}
+
+func TestBufferPagesSpillDirMissing(t *testing.T) {
+	in := make(chan RecognizedPage)
+	out := NewClient("key").bufferPages(in, 2, filepath.Join(t.TempDir(), "missing"))
+	const n = 10
+	for i := 1; i <= n; i++ {
+		in <- RecognizedPage{PageNumber: i}
+	}
+	close(in)
+	checkInOrder(t, out, n)
+}
+
+func TestSpillWriteFails(t *testing.T) {
+	dir := t.TempDir()
+	s := &spill{dir: dir, log: nopLogger{}}
+	for i := 1; i <= 3; i++ {
+		s.write(RecognizedPage{PageNumber: i})
+	}
+	// Writes to the file fail from now on, so the pages after those in it
+	// are held in memory.
+	s.w.Close()
+	for i := 4; i <= 6; i++ {
+		s.write(RecognizedPage{PageNumber: i})
+	}
+	if s.pending != 3 || len(s.held) != 3 {
+		t.Fatalf("%v pages in the file and %v in memory, want 3 and 3", s.pending, len(s.held))
+	}
+	for i := 1; i <= 6; i++ {
+		p, ok := s.read()
+		if !ok || p.PageNumber != i {
+			t.Fatalf("read page %v (%v), want %v", p.PageNumber, ok, i)
+		}
+	}
+	if p, ok := s.read(); ok || s.len() != 0 {
+		t.Errorf("read page %v after every page was read", p.PageNumber)
+	}
+	s.close()
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%v files were left behind", len(files))
+	}
+}
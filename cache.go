@@ -0,0 +1,160 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Cache stores the pages recognized in files, so that a file which has been
+// recognized before is not submitted (or paid for) again. Keys are made by
+// CacheKey. The pages of a file are stored as the Sight API numbers them:
+// their FileIndex is 0 and their PageNumber counts the pages submitted.
+type Cache interface {
+	// Get returns the pages stored under key, if any.
+	Get(key string) ([]RecognizedPage, bool)
+	// Put stores the pages of a file under key.
+	Put(key string, pages []RecognizedPage) error
+}
+
+// WithCache makes the Client look up each file in cache before submitting
+// it, and store the results of each file it submits, once every page of
+// the file has been recognized without error.
+func WithCache(cache Cache) Option {
+	return func(c *Client) {
+		c.cache = cache
+	}
+}
+
+// CacheKey returns the key under which the results of a file with the given
+// MIME type and contents, recognized with cfg, are cached: the SHA-256
+// digest of the contents and of the options of cfg which affect results.
+func CacheKey(cfg Config, mimeType string, contents []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "sight cache 1\n%v\n%v %v %v\n%v\n", mimeType,
+		cfg.MakeSentences, cfg.DoExifRotate, cfg.DoAutoRotate, strings.Join(cfg.ScriptHints, ","))
+	h.Write(contents)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// DirCache is a Cache which stores the pages of each file as a JSON file
+// named after its key in the directory.
+type DirCache string
+
+func (d DirCache) path(key string) string {
+	return filepath.Join(string(d), key+".json")
+}
+
+func (d DirCache) Get(key string) ([]RecognizedPage, bool) {
+	buf, err := ioutil.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var pages []RecognizedPage
+	if err := json.Unmarshal(buf, &pages); err != nil || len(pages) == 0 {
+		return nil, false
+	}
+	return pages, true
+}
+
+func (d DirCache) Put(key string, pages []RecognizedPage) error {
+	buf, err := json.Marshal(pages)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(string(d), 0755); err != nil {
+		return err
+	}
+	// Write atomically, so that a concurrent Get never reads a partly
+	// written file.
+	tmp, err := ioutil.TempFile(string(d), "."+key)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), d.path(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func (c *Client) putCache(key string, pages []RecognizedPage, requestID string) {
+	if err := c.cache.Put(key, pages); err != nil {
+		c.logger.Warn("failed to cache results", "request", requestID, "error", err)
+	}
+}
+
+// cachePages passes the pages of job from in to out, closing out at the
+// end, and caches the pages of each file under its key in keys once every
+// page of the file has been received without error.
+func (c *Client) cachePages(job Job, keys []string, requestID string, in <-chan RecognizedPage, out chan<- RecognizedPage) {
+	// filePages holds the pages of each file received so far, by the
+	// FileIndex and PageNumber reported by the Sight API.
+	filePages := make(map[int]map[int]RecognizedPage)
+	// settled are the files which have been cached or have failed.
+	settled := make(map[int]bool)
+	for p := range in {
+		out <- p
+		fileIndex, pageNumber, ok := job.apiPage(p)
+		if !ok || settled[fileIndex] {
+			continue
+		}
+		if p.Error != "" {
+			settled[fileIndex] = true
+			delete(filePages, fileIndex)
+			continue
+		}
+		if filePages[fileIndex] == nil {
+			filePages[fileIndex] = make(map[int]RecognizedPage)
+		}
+		p.FileIndex, p.PageNumber = 0, pageNumber
+		filePages[fileIndex][pageNumber] = p
+		if len(filePages[fileIndex]) < p.NumberOfPagesInFile {
+			continue
+		}
+		pages := make([]RecognizedPage, 0, len(filePages[fileIndex]))
+		for _, page := range filePages[fileIndex] {
+			pages = append(pages, page)
+		}
+		sort.Slice(pages, func(i, j int) bool { return pages[i].PageNumber < pages[j].PageNumber })
+		c.putCache(keys[fileIndex], pages, requestID)
+		settled[fileIndex] = true
+		delete(filePages, fileIndex)
+	}
+	close(out)
+}
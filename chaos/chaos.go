@@ -0,0 +1,157 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package chaos injects failures into the HTTP traffic between a sight.Client
+// and the Sight API, so that code built on the client can be tested against
+// a misbehaving API. It is meant for tests only:
+//
+//	t := &chaos.Transport{ErrorRate: 0.2, DuplicateRate: 0.1}
+//	c := sight.NewClient(apiKey, sight.WithTransport(t))
+package chaos
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport is an http.RoundTripper which forwards requests to Base and
+// tampers with them according to its fields. The initial request (a POST) is
+// only subject to ErrorRate; polling requests (GETs) are subject to all
+// failures.
+type Transport struct {
+	// Base is the transport requests are forwarded to. If nil,
+	// http.DefaultTransport is used.
+	Base http.RoundTripper
+	// PollDelay is added before every polling request is sent.
+	PollDelay time.Duration
+	// ErrorRate is the probability that a response is replaced with a 500
+	// Internal Server Error.
+	ErrorRate float64
+	// MalformedRate is the probability that the body of a polling response
+	// is truncated so that it is no longer valid JSON.
+	MalformedRate float64
+	// DuplicateRate is the probability that each page in a polling response
+	// is sent twice.
+	DuplicateRate float64
+	// Seed seeds the random failures, so that a failing test can be
+	// reproduced. The zero value is a valid seed.
+	Seed int64
+
+	once sync.Once
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (t *Transport) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	t.once.Do(func() {
+		t.rand = rand.New(rand.NewSource(t.Seed))
+	})
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rand.Float64() < p
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	isPoll := req.Method == "GET"
+	if isPoll && t.PollDelay > 0 {
+		time.Sleep(t.PollDelay)
+	}
+	if t.chance(t.ErrorRate) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return &http.Response{
+			Status:     "500 Internal Server Error",
+			StatusCode: 500,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+			Body:       ioutil.NopCloser(strings.NewReader("chaos: injected internal server error")),
+			Request:    req,
+		}, nil
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil || !isPoll || resp.StatusCode != 200 {
+		return resp, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if t.DuplicateRate > 0 {
+		body = t.duplicatePages(body)
+	}
+	if t.chance(t.MalformedRate) {
+		body = body[:len(body)/2]
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// duplicatePages sends some of the pages in a polling response twice. Bodies
+// which cannot be decoded are returned unchanged.
+func (t *Transport) duplicatePages(body []byte) []byte {
+	var resp map[string]json.RawMessage
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return body
+	}
+	var pages []json.RawMessage
+	if err := json.Unmarshal(resp["Pages"], &pages); err != nil {
+		return body
+	}
+	var out []json.RawMessage
+	for _, p := range pages {
+		out = append(out, p)
+		if t.chance(t.DuplicateRate) {
+			out = append(out, p)
+		}
+	}
+	if len(out) == len(pages) {
+		return body
+	}
+	buf, err := json.Marshal(out)
+	if err != nil {
+		return body
+	}
+	resp["Pages"] = buf
+	tampered, err := json.Marshal(resp)
+	if err != nil {
+		return body
+	}
+	return tampered
+}
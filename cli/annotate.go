@@ -0,0 +1,151 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/internal/pdf"
+)
+
+// annotateOptions configures which recognized text is annotated by
+// annotatePDF.
+type annotateOptions struct {
+	// match selects text to highlight. It is nil if no text is highlighted.
+	match *regexp.Regexp
+	// belowConfidence selects text to underline with a squiggly line. It
+	// is 0 if no text is underlined.
+	belowConfidence float64
+	// dpi is the resolution at which the Sight API rasterized the PDF, used
+	// to convert pixel coordinates into PDF points.
+	dpi float64
+}
+
+// annotatePDF writes a copy of the PDF src to dest, with a highlight
+// annotation over every recognized text element matching opts.match and a
+// squiggly annotation under every element whose confidence is below
+// opts.belowConfidence. Each annotation carries the recognized text (unless
+// it is redacted) as its popup contents. The annotations are appended as an
+// incremental update, so the original content of the PDF is untouched. It
+// returns the number of annotations written.
+func annotatePDF(src sight.File, dest string, pages []sight.RecognizedPage, opts annotateOptions) (int, error) {
+	r, err := pdf.NewReader(src.Contents)
+	if err != nil {
+		return 0, err
+	}
+	if r.Encrypted() {
+		return 0, fmt.Errorf("%v is encrypted", src.Name)
+	}
+	pdfPages, err := r.Pages()
+	if err != nil {
+		return 0, err
+	}
+	scale := 72 / opts.dpi
+	u := r.NewUpdate()
+	count := 0
+	for _, page := range pages {
+		if page.Error != "" || page.PageNumber < 1 || page.PageNumber > len(pdfPages) {
+			continue
+		}
+		pp := pdfPages[page.PageNumber-1]
+		var annots pdf.Array
+		for _, t := range page.RecognizedText {
+			var subtype pdf.Name
+			var color pdf.Array
+			var contents string
+			if opts.match != nil && opts.match.MatchString(t.Text) {
+				subtype = "Highlight"
+				color = pdf.Array{1.0, 1.0, 0.0}
+				contents = loggable(t.Text)
+			} else if t.Confidence < opts.belowConfidence {
+				subtype = "Squiggly"
+				color = pdf.Array{1.0, 0.0, 0.0}
+				contents = fmt.Sprintf("%v (confidence %.2f)", loggable(t.Text), t.Confidence)
+			} else {
+				continue
+			}
+			corners := [4][2]int{
+				{t.TopLeftX, t.TopLeftY},
+				{t.TopRightX, t.TopRightY},
+				{t.BottomLeftX, t.BottomLeftY},
+				{t.BottomRightX, t.BottomRightY},
+			}
+			quad := make(pdf.Array, 0, 8)
+			minX, minY := math.Inf(1), math.Inf(1)
+			maxX, maxY := math.Inf(-1), math.Inf(-1)
+			for _, c := range corners {
+				x, y := pp.ToUserSpace(float64(c[0])*scale, float64(c[1])*scale)
+				quad = append(quad, round2(x), round2(y))
+				minX, minY = math.Min(minX, x), math.Min(minY, y)
+				maxX, maxY = math.Max(maxX, x), math.Max(maxY, y)
+			}
+			annot := pdf.Dict{
+				"Type":       pdf.Name("Annot"),
+				"Subtype":    subtype,
+				"Rect":       pdf.Array{round2(minX), round2(minY), round2(maxX), round2(maxY)},
+				"QuadPoints": quad,
+				"C":          color,
+				"Contents":   pdf.TextString(contents),
+				"T":          pdf.String("Sight"),
+				"F":          int64(4),
+			}
+			if pp.Ref.Num != 0 {
+				annot["P"] = pp.Ref
+			}
+			annots = append(annots, u.Add(annot))
+		}
+		if len(annots) == 0 {
+			continue
+		}
+		if pp.Ref.Num == 0 {
+			return 0, fmt.Errorf("page %v of %v is not an indirect object and cannot be updated", page.PageNumber, src)
+		}
+		existing, err := r.Resolve(pp.Dict["Annots"])
+		if err != nil {
+			return 0, err
+		}
+		ea, _ := existing.(pdf.Array)
+		d := make(pdf.Dict, len(pp.Dict)+1)
+		for k, v := range pp.Dict {
+			d[k] = v
+		}
+		d["Annots"] = append(append(pdf.Array(nil), ea...), annots...)
+		u.Set(pp.Ref, d)
+		count += len(annots)
+	}
+	f, err := os.Create(dest)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := u.WriteTo(f); err != nil {
+		f.Close()
+		return 0, err
+	}
+	return count, f.Close()
+}
+
+func round2(f float64) float64 {
+	return math.Round(f*100) / 100
+}
@@ -0,0 +1,134 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+)
+
+// azureStore is Azure Blob Storage. Its URLs are az://account/container/blob,
+// and the "bucket" is the storage account. Credentials are found by the
+// default Azure credential chain: the environment (AZURE_CLIENT_ID, etc.),
+// a managed identity, or the login of the Azure CLI.
+type azureStore struct {
+	cred *azidentity.DefaultAzureCredential
+
+	mu      sync.Mutex
+	clients map[string]*azblob.Client
+}
+
+func newAzureStore(ctx context.Context) (objectStore, error) {
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &azureStore{cred: cred, clients: make(map[string]*azblob.Client)}, nil
+}
+
+// client returns the client of the storage account.
+func (s *azureStore) client(account string) (*azblob.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.clients[account]; ok {
+		return c, nil
+	}
+	c, err := azblob.NewClient(fmt.Sprintf("https://%v.blob.core.windows.net/", account), s.cred, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.clients[account] = c
+	return c, nil
+}
+
+// splitContainer splits key, the path of an az:// URL, into the container
+// and the name of the blob.
+func splitContainer(key string) (container, blob string, err error) {
+	i := strings.Index(key, "/")
+	if i <= 0 {
+		if key == "" {
+			return "", "", fmt.Errorf("az:// URLs must name a container, as in az://account/container/blob")
+		}
+		return key, "", nil
+	}
+	return key[:i], key[i+1:], nil
+}
+
+func (s *azureStore) list(ctx context.Context, account, prefix string) ([]string, error) {
+	container, blobPrefix, err := splitContainer(prefix)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.client(account)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	pager := c.NewListBlobsFlatPager(container, &azblob.ListBlobsFlatOptions{Prefix: &blobPrefix})
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Segment.BlobItems {
+			if item.Name != nil {
+				keys = append(keys, container+"/"+*item.Name)
+			}
+		}
+	}
+	return keys, nil
+}
+
+func (s *azureStore) read(ctx context.Context, account, key string) ([]byte, error) {
+	container, blob, err := splitContainer(key)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.client(account)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.DownloadStream(ctx, container, blob, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (s *azureStore) write(ctx context.Context, account, key string, data []byte) error {
+	container, blob, err := splitContainer(key)
+	if err != nil {
+		return err
+	}
+	c, err := s.client(account)
+	if err != nil {
+		return err
+	}
+	_, err = c.UploadBuffer(ctx, container, blob, data, nil)
+	return err
+}
@@ -0,0 +1,491 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/layout"
+	"github.com/siftrics/sight/normalize"
+)
+
+const batchUsage = `usage: ./sight batch <manifest.csv|manifest.json> <--prompt-api-key|--api-key-file filename> [-o output directory]
+
+Recognizes text in the files listed in a manifest, each with its own options, and
+writes a manifest of outcomes. A CSV manifest has a header row naming its columns; a
+JSON manifest is an array of objects with the same keys:
+
+ path          The image or document, or the URL of an object in S3, Google Cloud
+                 Storage or Azure Blob Storage. Required.
+ script_hints  Comma-delimited script hint codes for the file, e.g., latin,cyrillic.
+ pages         The pages of a PDF to recognize, e.g., 1-3,7.
+ output        Where to write the results of the file. Defaults to
+                 <output directory>/<file name>.json.
+ tags          Labels carried into the outcomes, delimited by semicolons in CSV.
+
+example manifest.csv:
+ path,script_hints,pages,output,tags
+ invoices/march.pdf,latin,1-2,results/march.json,invoice;q1
+ contracts/lease.pdf,"latin,cyrillic",,,contract
+
+example:
+ ./sight batch manifest.csv -o results/ --outcomes outcomes.csv --api-key-file my_api_key.txt
+
+Files with the same script hints are submitted together. Outputs which already exist
+are not overwritten unless --force is given; their files are skipped.
+
+optional flags:
+ [-o|--output directory]     The directory of outputs which the manifest does not give.
+ [--outcomes filename]       Write the outcomes to this CSV or JSON file, by extension, instead
+                               of to stdout as JSON. Each outcome is the path, output and tags
+                               of a file, its status (succeeded, failed or skipped), its
+                               number of pages and of failed pages, and the first error.
+ [--force]                   Overwrite outputs which already exist.
+ [-w|--words]                Return word-level bounding boxes.
+ [-e|--obey-exif]            Use EXIF orientation for bounding box coordinate system.
+ [-r|--auto-rotate]          Rotate images so the majority of the text is upright.
+ [-s|--script-hints]         Script hint codes for files whose script_hints are empty.
+ [--skip-text-pdfs]          Extract the text of PDF pages which already have a text layer.
+ [--pdf-passwords filename]  Decrypt password-protected PDFs; see ./sight -h.
+ [--normalize list]          Normalize the recognized text; see ./sight -h.
+ [--vocabulary filename]     Correct words to the terms in this file; see ./sight -h.
+ [--reading-order]           Order the text of each page column by column; see ./sight -h.
+ [-v|--verbose]              Log every polling attempt and other details.
+ [--log-json]                Write log messages as JSON objects, one per line.
+`
+
+// manifestEntry is a file listed in a batch manifest, with its options.
+type manifestEntry struct {
+	Path        string   `json:"path"`
+	ScriptHints []string `json:"script_hints,omitempty"`
+	Pages       string   `json:"pages,omitempty"`
+	Output      string   `json:"output,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// batchOutcome is the outcome of a manifestEntry.
+type batchOutcome struct {
+	Path        string   `json:"path"`
+	Output      string   `json:"output"`
+	Tags        []string `json:"tags,omitempty"`
+	Status      string   `json:"status"`
+	Pages       int      `json:"pages"`
+	FailedPages int      `json:"failed_pages"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// batchMain implements "sight batch", which recognizes text in the files of
+// a manifest with per-file options.
+func batchMain(args []string) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stderr, batchUsage)
+		os.Exit(1)
+	}
+	cfg := sight.Config{MakeSentences: true, ScriptHints: make([]string, 0)}
+	var normalization normalize.Mode
+	logger := &cliLogger{minLevel: levelInfo}
+	promptApiKey, force := false, false
+	var manifestFile, apiKeyFile, outputDir, outcomesFile string
+	for i := 0; i < len(args); i++ {
+		s := args[i]
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: %v was specified but no value came after it.\nRun ./sight batch -h for more help.\n", s)
+				os.Exit(1)
+			}
+			i++
+			return args[i]
+		}
+		switch s {
+		case "--prompt-api-key":
+			promptApiKey = true
+		case "--api-key-file":
+			apiKeyFile = value()
+		case "-o", "--output":
+			outputDir = value()
+		case "--outcomes":
+			outcomesFile = value()
+		case "--force":
+			force = true
+		case "-w", "--words":
+			cfg.MakeSentences = false
+		case "-e", "--obey-exif":
+			cfg.DoExifRotate = true
+		case "-r", "--auto-rotate":
+			cfg.DoAutoRotate = true
+		case "-s", "--script-hints":
+			cfg.ScriptHints = strings.Split(value(), ",")
+			if err := sight.ValidateScriptHints(cfg.ScriptHints); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		case "--skip-text-pdfs":
+			cfg.SkipTextPDFs = true
+		case "--pdf-passwords":
+			passwords, err := loadPDFPasswords(value())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.PDFPasswords = passwords
+		case "--normalize":
+			m, err := normalize.Parse(value())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			normalization = m
+		case "--vocabulary":
+			terms, err := loadVocabulary(value())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			cfg.Vocabulary = terms
+		case "--reading-order":
+			cfg.PostProcessors = append(cfg.PostProcessors, sight.PostProcessorFunc(layout.ReadingOrder))
+		case "-v", "--verbose":
+			logger.minLevel = levelDebug
+		case "--log-json":
+			logger.json = true
+		default:
+			if manifestFile != "" || strings.HasPrefix(s, "-") {
+				fmt.Fprintf(os.Stderr, "error: unexpected argument %v.\nRun ./sight batch -h for more help.\n", s)
+				os.Exit(1)
+			}
+			manifestFile = s
+		}
+	}
+	addNormalization(&cfg, normalization)
+	if manifestFile == "" {
+		fmt.Fprintf(os.Stderr, "error: You must specify a manifest.\nRun ./sight batch -h for more help.\n")
+		os.Exit(1)
+	}
+	entries, err := loadManifest(manifestFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	for i, e := range entries {
+		if e.Output == "" && outputDir == "" {
+			fmt.Fprintf(os.Stderr, "error: %v has no output in the manifest, and no output directory (-o) was given.\nRun ./sight batch -h for more help.\n", e.Path)
+			os.Exit(1)
+		}
+		if e.Output == "" {
+			entries[i].Output = filepath.Join(outputDir, filepath.Base(e.Path)+".json")
+		}
+	}
+	apiKey := loadAPIKey(promptApiKey, apiKeyFile)
+	b := &batch{
+		client: newClient(apiKey, sight.WithLogger(logger)),
+		cfg:    cfg,
+		log:    logger,
+		force:  force,
+	}
+	outcomes := b.run(entries)
+	if err := writeOutcomes(outcomesFile, outcomes); err != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to write the outcomes: %v\n", err)
+		os.Exit(1)
+	}
+	failed := 0
+	for _, o := range outcomes {
+		if o.Status == "failed" {
+			failed++
+		}
+	}
+	if failed == len(outcomes) {
+		os.Exit(exitTotalFailure)
+	} else if failed != 0 {
+		os.Exit(exitPartialFailure)
+	}
+}
+
+// loadManifest reads a CSV or JSON manifest, by the extension of path.
+func loadManifest(path string) ([]manifestEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []manifestEntry
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.NewDecoder(f).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+	} else if entries, err = readCSVManifest(f); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%v lists no files", path)
+	}
+	for i, e := range entries {
+		if e.Path == "" {
+			return nil, fmt.Errorf("%v: entry %v has no path", path, i+1)
+		}
+		if len(e.ScriptHints) != 0 {
+			if err := sight.ValidateScriptHints(e.ScriptHints); err != nil {
+				return nil, fmt.Errorf("%v: %v: %v", path, e.Path, err)
+			}
+		}
+		if e.Pages != "" {
+			if _, err := sight.ParsePageRanges(e.Pages); err != nil {
+				return nil, fmt.Errorf("%v: %v: %v", path, e.Path, err)
+			}
+		}
+	}
+	return entries, nil
+}
+
+// readCSVManifest reads a manifest whose first row names its columns.
+func readCSVManifest(r io.Reader) ([]manifestEntry, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	columns := make(map[string]int)
+	for i, name := range rows[0] {
+		columns[strings.TrimSpace(strings.ToLower(name))] = i
+	}
+	if _, ok := columns["path"]; !ok {
+		return nil, fmt.Errorf("the header row has no path column")
+	}
+	split := func(s, sep string) []string {
+		var parts []string
+		for _, p := range strings.Split(s, sep) {
+			if p = strings.TrimSpace(p); p != "" {
+				parts = append(parts, p)
+			}
+		}
+		return parts
+	}
+	var entries []manifestEntry
+	for _, row := range rows[1:] {
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		entries = append(entries, manifestEntry{
+			Path:        field("path"),
+			ScriptHints: split(field("script_hints"), ","),
+			Pages:       field("pages"),
+			Output:      field("output"),
+			Tags:        split(field("tags"), ";"),
+		})
+	}
+	return entries, nil
+}
+
+type batch struct {
+	client sight.Recognizer
+	cfg    sight.Config
+	log    *cliLogger
+	force  bool
+}
+
+// run recognizes the files of entries, submitting those with the same
+// script hints together, and writes the results of each to its output.
+func (b *batch) run(entries []manifestEntry) []batchOutcome {
+	outcomes := make([]batchOutcome, len(entries))
+	// groups maps script hints to the entries which use them, in the
+	// order of the manifest.
+	groups := make(map[string][]int)
+	var order []string
+	for i, e := range entries {
+		outcomes[i] = batchOutcome{Path: e.Path, Output: e.Output, Tags: e.Tags}
+		if !b.force && outputExists(e.Output) {
+			outcomes[i].Status = "skipped"
+			b.log.Info("skipping file whose output already exists", "file", e.Path, "output", e.Output)
+			continue
+		}
+		hints := strings.Join(e.ScriptHints, ",")
+		if len(e.ScriptHints) == 0 {
+			hints = strings.Join(b.cfg.ScriptHints, ",")
+		}
+		if _, ok := groups[hints]; !ok {
+			order = append(order, hints)
+		}
+		groups[hints] = append(groups[hints], i)
+	}
+	for _, hints := range order {
+		cfg := b.cfg
+		cfg.ScriptHints = make([]string, 0)
+		if hints != "" {
+			cfg.ScriptHints = strings.Split(hints, ",")
+		}
+		b.recognize(cfg, entries, groups[hints], outcomes)
+	}
+	return outcomes
+}
+
+// recognize recognizes the files of the entries at indices in one run and
+// records their outcomes.
+func (b *batch) recognize(cfg sight.Config, entries []manifestEntry, indices []int, outcomes []batchOutcome) {
+	var files []sight.File
+	// owners maps indices into files to indices into entries, and first
+	// maps the latter to the index of their first file.
+	var owners []int
+	first := make(map[int]int)
+	var inputs []string
+	for _, i := range indices {
+		e := entries[i]
+		fail := func(err error) {
+			outcomes[i].Status = "failed"
+			outcomes[i].Error = err.Error()
+			b.log.Warn("skipping file which cannot be submitted", "file", e.Path, "error", err)
+		}
+		contents, err := readInput(e.Path)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		routed, err := sight.RouteInput(e.Path, contents)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		if e.Pages != "" {
+			if len(routed) != 1 {
+				fail(fmt.Errorf("pages were given, but the file holds %v documents", len(routed)))
+				continue
+			}
+			routed[0].Pages, _ = sight.ParsePageRanges(e.Pages)
+		}
+		first[i] = len(files)
+		for _, f := range routed {
+			files = append(files, f)
+			owners = append(owners, i)
+			inputs = append(inputs, f.Name)
+		}
+	}
+	if len(files) == 0 {
+		return
+	}
+	metadata := newJobMetadata(cfg, inputs)
+	cfg.OnJobStarted = metadata.addJob
+	results := make(map[int][]sight.RecognizedPage)
+	pagesChan, err := b.client.RecognizeFiles(cfg, files...)
+	if err != nil {
+		for _, i := range owners {
+			outcomes[i].Status = "failed"
+			outcomes[i].Error = err.Error()
+		}
+		b.log.Error("failed to recognize files", "files", len(files), "error", err)
+		return
+	}
+	for page := range pagesChan {
+		i := owners[page.FileIndex]
+		// Each output holds only the files of its entry.
+		page.FileIndex -= first[i]
+		results[i] = append(results[i], page)
+		outcomes[i].Pages++
+		if page.Error != "" {
+			outcomes[i].FailedPages++
+			if outcomes[i].Error == "" {
+				outcomes[i].Error = page.Error
+			}
+		}
+	}
+	metadata.finish()
+	for _, i := range indices {
+		if outcomes[i].Status != "" {
+			continue
+		}
+		if err := writeBatchResults(entries[i], results[i], metadata); err != nil {
+			outcomes[i].Status = "failed"
+			outcomes[i].Error = err.Error()
+			b.log.Error("failed to write results", "file", entries[i].Path, "output", entries[i].Output, "error", err)
+			continue
+		}
+		outcomes[i].Status = "succeeded"
+		if outcomes[i].FailedPages != 0 {
+			outcomes[i].Status = "failed"
+		}
+		b.log.Info("recognized file", "file", entries[i].Path, "pages", outcomes[i].Pages, "output", entries[i].Output)
+	}
+}
+
+// writeBatchResults writes the pages of an entry to its output.
+func writeBatchResults(e manifestEntry, pages []sight.RecognizedPage, metadata *jobMetadata) error {
+	if !isRemote(e.Output) {
+		if err := os.MkdirAll(filepath.Dir(e.Output), 0755); err != nil {
+			return err
+		}
+	}
+	out, err := createOutput(e.Output)
+	if err != nil {
+		return err
+	}
+	results := struct {
+		Pages    []sight.RecognizedPage
+		Metadata *jobMetadata
+		Tags     []string `json:",omitempty"`
+	}{pages, metadata, e.Tags}
+	if err := json.NewEncoder(out).Encode(&results); err != nil {
+		return err
+	}
+	return out.commit()
+}
+
+// writeOutcomes writes the outcomes to path, as CSV if its extension is
+// .csv and as JSON otherwise, or to stdout as JSON if path is empty.
+func writeOutcomes(path string, outcomes []batchOutcome) error {
+	if path == "" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(outcomes)
+	}
+	out, err := createAtomic(path)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		w := csv.NewWriter(out)
+		w.Write([]string{"path", "output", "tags", "status", "pages", "failed_pages", "error"})
+		for _, o := range outcomes {
+			w.Write([]string{o.Path, o.Output, strings.Join(o.Tags, ";"), o.Status, strconv.Itoa(o.Pages), strconv.Itoa(o.FailedPages), o.Error})
+		}
+		w.Flush()
+		err = w.Error()
+	} else {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(outcomes)
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return err
+	}
+	return out.commit()
+}
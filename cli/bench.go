@@ -0,0 +1,230 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/siftrics/sight"
+)
+
+const benchUsage = `usage: ./sight bench <--prompt-api-key|--api-key-file filename> <image/document, ...>
+
+Submits a sample corpus, one request per file, and reports the throughput in pages per
+second, the latency of each request from submission until its last page was received,
+and the rate of errors. Every page is billed as usual.
+
+example:
+ ./sight bench samples/ --concurrency 8 --repeat 3 --api-key-file my_api_key.txt
+
+optional flags:
+ [--concurrency n]   The most requests in flight at once. Defaults to 4.
+ [--repeat n]        Submit the corpus n times. Defaults to 1.
+ [--json]            Print the results as JSON.
+`
+
+func benchMain(args []string) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stderr, benchUsage)
+		os.Exit(1)
+	}
+	promptApiKey, asJSON := false, false
+	var apiKeyFile string
+	var inputArgs []string
+	concurrency, repeat := 4, 1
+	for i := 0; i < len(args); i++ {
+		s := args[i]
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: %v was specified but no value came after it.\nRun ./sight bench -h for more help.\n", s)
+				os.Exit(1)
+			}
+			i++
+			return args[i]
+		}
+		count := func() int {
+			n, err := strconv.Atoi(value())
+			if err != nil || n < 1 {
+				fmt.Fprintf(os.Stderr, "error: %v must be followed by a positive number.\nRun ./sight bench -h for more help.\n", s)
+				os.Exit(1)
+			}
+			return n
+		}
+		switch s {
+		case "--prompt-api-key":
+			promptApiKey = true
+		case "--api-key-file":
+			apiKeyFile = value()
+		case "--concurrency":
+			concurrency = count()
+		case "--repeat":
+			repeat = count()
+		case "--json":
+			asJSON = true
+		default:
+			if len(s) > 1 && s[0] == '-' {
+				fmt.Fprintf(os.Stderr, "error: unexpected argument %v.\nRun ./sight bench -h for more help.\n", s)
+				os.Exit(1)
+			}
+			inputArgs = append(inputArgs, s)
+		}
+	}
+	if len(inputArgs) == 0 || (!promptApiKey && apiKeyFile == "") {
+		fmt.Fprint(os.Stderr, benchUsage)
+		os.Exit(1)
+	}
+	paths, err := expandInputs(inputArgs, nil, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	var files []sight.File
+	for _, path := range paths {
+		contents, err := readInput(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		routed, err := sight.RouteInput(path, contents)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v: %v\n", path, err)
+			os.Exit(1)
+		}
+		files = append(files, routed...)
+	}
+	client := newClient(loadAPIKey(promptApiKey, apiKeyFile))
+	result := runBench(client, files, concurrency, repeat)
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+	} else {
+		writeBench(os.Stdout, result)
+	}
+}
+
+// benchResult is what a benchmark measured. Latencies are in seconds so
+// that the JSON is easy to consume.
+type benchResult struct {
+	Concurrency    int
+	Requests       int
+	FailedRequests int
+	Pages          int
+	FailedPages    int
+	ElapsedSeconds float64
+	PagesPerSecond float64
+	LatencyP50     float64
+	LatencyP95     float64
+	LatencyMax     float64
+}
+
+// runBench submits each of files repeat times, one request per file, with
+// up to concurrency requests in flight, and measures them. A request fails
+// if it cannot be made or if any of its pages has an error.
+func runBench(client sight.Recognizer, files []sight.File, concurrency, repeat int) benchResult {
+	result := benchResult{Concurrency: concurrency, Requests: len(files) * repeat}
+	next := make(chan sight.File)
+	var mu sync.Mutex
+	var latencies []float64
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range next {
+				sent := time.Now()
+				pages, failed := 0, 0
+				pagesChan, err := client.RecognizeFiles(sight.Config{MakeSentences: true}, f)
+				if err == nil {
+					for page := range pagesChan {
+						pages++
+						if page.Error != "" {
+							failed++
+						}
+					}
+				}
+				latency := time.Since(sent).Seconds()
+				mu.Lock()
+				result.Pages += pages
+				result.FailedPages += failed
+				if err != nil || failed > 0 {
+					result.FailedRequests++
+				}
+				latencies = append(latencies, latency)
+				mu.Unlock()
+				fmt.Fprintf(os.Stderr, "%v: %v pages in %.1fs\n", f.Name, pages, latency)
+			}
+		}()
+	}
+	for r := 0; r < repeat; r++ {
+		for _, f := range files {
+			next <- f
+		}
+	}
+	close(next)
+	wg.Wait()
+	result.ElapsedSeconds = time.Since(start).Seconds()
+	if result.ElapsedSeconds > 0 {
+		result.PagesPerSecond = float64(result.Pages-result.FailedPages) / result.ElapsedSeconds
+	}
+	sort.Float64s(latencies)
+	result.LatencyP50 = percentile(latencies, 50)
+	result.LatencyP95 = percentile(latencies, 95)
+	result.LatencyMax = percentile(latencies, 100)
+	return result
+}
+
+// percentile returns the p-th percentile of sorted by the nearest-rank
+// method, or 0 if sorted is empty.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+// writeBench prints r for a person to read.
+func writeBench(w io.Writer, r benchResult) {
+	rate := func(n, of int) float64 {
+		if of == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(of)
+	}
+	fmt.Fprintf(w, "Requests:    %v, %v at once (%v failed, %.1f%%)\n", r.Requests, r.Concurrency, r.FailedRequests, rate(r.FailedRequests, r.Requests))
+	fmt.Fprintf(w, "Pages:       %v (%v with errors, %.1f%%)\n", r.Pages, r.FailedPages, rate(r.FailedPages, r.Pages))
+	fmt.Fprintf(w, "Elapsed:     %.1fs\n", r.ElapsedSeconds)
+	fmt.Fprintf(w, "Throughput:  %.2f pages/second\n", r.PagesPerSecond)
+	fmt.Fprintf(w, "Latency:     p50 %.1fs, p95 %.1fs, max %.1fs\n", r.LatencyP50, r.LatencyP95, r.LatencyMax)
+}
@@ -0,0 +1,112 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/siftrics/sight"
+)
+
+// version is the version of the tool, set at build time with
+// -ldflags "-X main.version=v1.2.3".
+var version = "devel"
+
+// newClient returns a Client which identifies the tool and its version in
+// the User-Agent header of its requests.
+func newClient(apiKey string, opts ...sight.Option) *sight.Client {
+	return sight.NewClient(apiKey, append([]sight.Option{sight.WithAppName("sight-cli/" + version)}, opts...)...)
+}
+
+// command is a subcommand of the tool, run as ./sight <name> [arguments].
+type command struct {
+	name    string
+	summary string
+	run     func(args []string)
+}
+
+// commands lists every subcommand, in the order they are shown in help.
+// It is populated in init because helpMain refers to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"recognize", "Recognize text in images and documents. This is the default command.", recognizeMain},
+		{"batch", "Recognize text in the files of a manifest, each with its own options.", batchMain},
+		{"watch", "Watch a directory and recognize text in files as they appear.", watchMain},
+		{"mail-watch", "Poll an IMAP folder and recognize text in email attachments.", mailWatchMain},
+		{"serve", "Run an HTTP server which recognizes text for clients without API keys.", serveMain},
+		{"jobs", "List the jobs of runs started with --job-file, or resume one which was interrupted.", jobsMain},
+		{"usage", "Print the pages used and remaining in the current billing period.", usageMain},
+		{"ping", "Check that the Sight API can be reached and accepts the API key.", pingMain},
+		{"diff", "Compare two JSON output files, e.g., to check a change for regressions.", diffMain},
+		{"eval", "Measure the accuracy of results against ground truth text.", evalMain},
+		{"bench", "Measure the throughput and latency of the Sight API on a sample corpus.", benchMain},
+		{"demo", "Run an end-to-end example pipeline, e.g., invoice-pipeline.", demoMain},
+		{"completion", "Print a shell completion script for bash, zsh, fish or PowerShell.", completionMain},
+		{"version", "Print the version of the tool.", versionMain},
+		{"help", "Show help for a command.", helpMain},
+	}
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		for _, c := range commands {
+			if os.Args[1] == c.name {
+				c.run(os.Args[2:])
+				return
+			}
+		}
+	}
+	// Without a command, the arguments are those of recognize, as they were
+	// before the tool had commands.
+	recognizeMain(os.Args[1:])
+}
+
+// writeCommands lists the commands with their summaries.
+func writeCommands(w io.Writer) {
+	fmt.Fprintf(w, "commands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, " %-10v %v\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nRun ./sight <command> -h for help with a command.\n")
+}
+
+func versionMain(args []string) {
+	fmt.Printf("sight %v (sight-go %v, %v, %v/%v)\n", version, sight.Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+func helpMain(args []string) {
+	if len(args) != 0 {
+		for _, c := range commands {
+			if args[0] == c.name && c.name != "help" {
+				c.run([]string{"-h"})
+				return
+			}
+		}
+	}
+	fmt.Fprintf(os.Stderr, "usage: ./sight <command> [arguments]\n\n")
+	writeCommands(os.Stderr)
+	os.Exit(1)
+}
@@ -0,0 +1,272 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/siftrics/sight"
+)
+
+const completionUsage = `usage: ./sight completion <bash|zsh|fish|powershell>
+
+Prints a script which makes the shell complete commands, flags, script hint codes
+and MIME types. For example:
+
+ bash:       source <(./sight completion bash)
+ zsh:        source <(./sight completion zsh)
+ fish:       ./sight completion fish | source
+ powershell: ./sight completion powershell | Out-String | Invoke-Expression
+
+Add the line to your shell's startup file to keep completion in new shells.
+`
+
+// usageFlagPattern matches a flag in a usage message where it is introduced,
+// as in "[-w|--words]" or "[--tag key=value]", along with the name of its
+// value, if it has one.
+var usageFlagPattern = regexp.MustCompile(`[\[<|](--?[a-z][-a-z]*)( [a-z][a-z:=]*(?: [a-z]+)?)?[\]>|]`)
+
+// usageFlags returns the flags introduced in a usage message, sorted, and
+// which of them take a value: those with the name of a value, and those
+// which fs, if it is not nil, parses with a value. Completion is generated
+// from the usage messages so that it cannot fall out of step with them.
+func usageFlags(usage string, fs *flag.FlagSet) (flags []string, valueFlags map[string]bool) {
+	valueFlags = make(map[string]bool)
+	seen := make(map[string]bool)
+	// Matches overlap at the "|" between alternatives, so search from
+	// the end of each flag rather than the end of each match.
+	for i := 0; ; {
+		m := usageFlagPattern.FindStringSubmatchIndex(usage[i:])
+		if m == nil {
+			break
+		}
+		flag := usage[i+m[2] : i+m[3]]
+		if !seen[flag] {
+			seen[flag] = true
+			flags = append(flags, flag)
+		}
+		if m[4] >= 0 {
+			valueFlags[flag] = true
+		} else if fs != nil {
+			if f := fs.Lookup(strings.TrimLeft(flag, "-")); f != nil && takesValue(f) {
+				valueFlags[flag] = true
+			}
+		}
+		i += m[3]
+	}
+	sort.Strings(flags)
+	return flags, valueFlags
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func completionMain(args []string) {
+	if len(args) != 1 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stderr, completionUsage)
+		os.Exit(1)
+	}
+	var names []string
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	recognizeFlags, recognizeValues := usageFlags(recognizeUsage, newRecognizeFlags(&sight.Config{}, &recognizeOptions{logger: &cliLogger{}}))
+	watchFlags, watchValues := usageFlags(watchUsage, nil)
+	valueFlags := make(map[string]bool)
+	for f := range recognizeValues {
+		valueFlags[f] = true
+	}
+	for f := range watchValues {
+		valueFlags[f] = true
+	}
+	c := completion{
+		commands:       names,
+		recognizeFlags: recognizeFlags,
+		watchFlags:     watchFlags,
+		valueFlags:     sortedKeys(valueFlags),
+		scripts:        sight.SupportedScriptCodes(),
+		mimeTypes:      sortedKeys(sight.SupportedMimeTypes),
+		formats:        sortedKeys(outputFormats),
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(c.bash())
+	case "zsh":
+		fmt.Print("autoload -U +X bashcompinit && bashcompinit\n" + c.bash())
+	case "fish":
+		fmt.Print(c.fish())
+	case "powershell":
+		fmt.Print(c.powershell())
+	default:
+		fmt.Fprintf(os.Stderr, "error: unsupported shell %v.\nRun ./sight completion -h for more help.\n", args[0])
+		os.Exit(1)
+	}
+}
+
+// completion holds what the generated scripts complete.
+type completion struct {
+	commands       []string
+	recognizeFlags []string
+	watchFlags     []string
+	valueFlags     []string
+	scripts        []string
+	mimeTypes      []string
+	formats        []string
+}
+
+func (c completion) bash() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `# bash completion for sight
+_sight() {
+    local cur prev cmd flags
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    cmd=recognize
+    case "${COMP_WORDS[1]}" in
+        %v) cmd="${COMP_WORDS[1]}" ;;
+    esac
+    case "$prev" in
+        -s|--script-hints)
+            local done=""
+            [[ "$cur" == *,* ]] && done="${cur%%,*},"
+            compopt -o nospace 2>/dev/null
+            COMPREPLY=( $(compgen -P "$done" -W "%v" -S , -- "${cur##*,}") )
+            return ;;
+        --mime)
+            COMPREPLY=( $(compgen -W "%v" -- "$cur") )
+            return ;;
+        --format)
+            COMPREPLY=( $(compgen -W "%v" -- "$cur") )
+            return ;;
+        %v)
+            COMPREPLY=( $(compgen -f -- "$cur") )
+            return ;;
+    esac
+    if [[ $COMP_CWORD -eq 1 && "$cur" != -* ]]; then
+        COMPREPLY=( $(compgen -W "%v" -- "$cur") $(compgen -f -- "$cur") )
+        return
+    fi
+    case "$cmd" in
+        completion)
+            COMPREPLY=( $(compgen -W "bash zsh fish powershell" -- "$cur") )
+            return ;;
+        help)
+            COMPREPLY=( $(compgen -W "%v" -- "$cur") )
+            return ;;
+        watch) flags="%v" ;;
+        recognize) flags="%v" ;;
+        *) flags="" ;;
+    esac
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=( $(compgen -W "$flags" -- "$cur") )
+    else
+        COMPREPLY=( $(compgen -f -- "$cur") )
+    fi
+}
+complete -o filenames -F _sight sight
+`,
+		strings.Join(c.commands, "|"),
+		strings.Join(c.scripts, " "),
+		strings.Join(c.mimeTypes, " "),
+		strings.Join(c.formats, " "),
+		strings.Join(c.valueFlags, "|"),
+		strings.Join(c.commands, " "),
+		strings.Join(c.commands, " "),
+		strings.Join(c.watchFlags, " "),
+		strings.Join(c.recognizeFlags, " "))
+	return b.String()
+}
+
+func (c completion) fish() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# fish completion for sight\n")
+	fmt.Fprintf(&b, "complete -c sight -n __fish_use_subcommand -a '%v'\n", strings.Join(c.commands, " "))
+	fishFlags := func(condition string, flags []string) {
+		for _, f := range flags {
+			opt := "-l " + strings.TrimPrefix(f, "--")
+			if !strings.HasPrefix(f, "--") {
+				opt = "-s " + strings.TrimPrefix(f, "-")
+			}
+			switch f {
+			case "-s", "--script-hints":
+				fmt.Fprintf(&b, "complete -c sight -n '%v' %v -x -a '%v'\n", condition, opt, strings.Join(c.scripts, " "))
+			case "--mime":
+				fmt.Fprintf(&b, "complete -c sight -n '%v' %v -x -a '%v'\n", condition, opt, strings.Join(c.mimeTypes, " "))
+			case "--format":
+				fmt.Fprintf(&b, "complete -c sight -n '%v' %v -x -a '%v'\n", condition, opt, strings.Join(c.formats, " "))
+			default:
+				requires := ""
+				for _, v := range c.valueFlags {
+					if v == f {
+						requires = " -r"
+					}
+				}
+				fmt.Fprintf(&b, "complete -c sight -n '%v' %v%v\n", condition, opt, requires)
+			}
+		}
+	}
+	fishFlags("__fish_seen_subcommand_from watch", c.watchFlags)
+	fishFlags("not __fish_seen_subcommand_from batch watch mail-watch serve jobs usage ping diff eval bench demo completion version help", c.recognizeFlags)
+	fmt.Fprintf(&b, "complete -c sight -n '__fish_seen_subcommand_from completion' -x -a 'bash zsh fish powershell'\n")
+	return b.String()
+}
+
+func (c completion) powershell() string {
+	quote := func(words []string) string {
+		q := make([]string, len(words))
+		for i, w := range words {
+			q[i] = "'" + w + "'"
+		}
+		return strings.Join(q, ", ")
+	}
+	return fmt.Sprintf(`# PowerShell completion for sight
+Register-ArgumentCompleter -Native -CommandName sight -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    $prev = if ($wordToComplete -eq '') { $words[-1] } else { $words[-2] }
+    $candidates = switch -Regex ($prev) {
+        '^(-s|--script-hints)$' { @(%v) }
+        '^--mime$' { @(%v) }
+        '^--format$' { @(%v) }
+        '^completion$' { @('bash', 'zsh', 'fish', 'powershell') }
+        default {
+            if ($words.Count -le 2 -and -not $wordToComplete.StartsWith('-')) { @(%v) }
+            elseif ($words.Count -gt 1 -and $words[1] -eq 'watch') { @(%v) }
+            else { @(%v) }
+        }
+    }
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`, quote(c.scripts), quote(c.mimeTypes), quote(c.formats), quote(c.commands), quote(c.watchFlags), quote(c.recognizeFlags))
+}
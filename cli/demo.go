@@ -0,0 +1,263 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/siftrics/sight"
+)
+
+const demoUsage = `usage: ./sight demo <example> [arguments]
+
+Runs an end-to-end example built only from the public API of the sight package.
+The source of each example (cli/demo.go) is meant to be copied as the starting point
+of a real deployment.
+
+examples:
+ invoice-pipeline  Watch a directory for invoices, recognize them, extract the invoice
+                   number, date and total, and append them to a CSV file.
+
+Run ./sight demo <example> -h for help with an example.
+`
+
+const invoicePipelineUsage = `usage: ./sight demo invoice-pipeline <directory> <--prompt-api-key|--api-key-file filename> <-o CSV filename>
+
+Watches a directory for invoices and recognizes the text in each one which appears,
+including those already there when the example starts. The invoice number, date and
+total are extracted from the text and appended to the CSV file as one row per input,
+together with any error.
+
+example:
+ ./sight demo invoice-pipeline inbox/ -o invoices.csv --api-key-file my_api_key.txt
+
+optional flags:
+ [--once]         Process the files already in the directory, then exit instead of
+                    watching for more. Useful for testing a deployment end to end.
+ [--poll seconds] How often to look for new files. Defaults to 2.
+`
+
+func demoMain(args []string) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stderr, demoUsage)
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "invoice-pipeline":
+		invoicePipelineMain(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "error: unknown example %v.\nRun ./sight demo -h for more help.\n", args[0])
+		os.Exit(1)
+	}
+}
+
+func invoicePipelineMain(args []string) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stderr, invoicePipelineUsage)
+		os.Exit(1)
+	}
+	promptApiKey, once := false, false
+	var dir, apiKeyFile, csvFile string
+	poll := 2 * time.Second
+	for i := 0; i < len(args); i++ {
+		s := args[i]
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: %v was specified but no value came after it.\nRun ./sight demo invoice-pipeline -h for more help.\n", s)
+				os.Exit(1)
+			}
+			i++
+			return args[i]
+		}
+		switch s {
+		case "--prompt-api-key":
+			promptApiKey = true
+		case "--api-key-file":
+			apiKeyFile = value()
+		case "-o", "--output":
+			csvFile = value()
+		case "--once":
+			once = true
+		case "--poll":
+			var seconds float64
+			if _, err := fmt.Sscan(value(), &seconds); err != nil || seconds <= 0 {
+				fmt.Fprintf(os.Stderr, "error: --poll must be followed by a positive number of seconds.\n")
+				os.Exit(1)
+			}
+			poll = time.Duration(seconds * float64(time.Second))
+		default:
+			if dir != "" || strings.HasPrefix(s, "-") {
+				fmt.Fprintf(os.Stderr, "error: unexpected argument %v.\nRun ./sight demo invoice-pipeline -h for more help.\n", s)
+				os.Exit(1)
+			}
+			dir = s
+		}
+	}
+	if dir == "" || csvFile == "" {
+		fmt.Fprintf(os.Stderr, "error: You must specify a directory to watch and a CSV file (-o).\nRun ./sight demo invoice-pipeline -h for more help.\n")
+		os.Exit(1)
+	}
+	client := newClient(loadAPIKey(promptApiKey, apiKeyFile))
+	if err := runInvoicePipeline(client, dir, csvFile, poll, once); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// invoice holds the fields extracted from one input.
+type invoice struct {
+	File   string
+	Pages  int
+	Number string
+	Date   string
+	Total  string
+	Error  string
+}
+
+var invoiceCSVHeader = []string{"File", "Pages", "InvoiceNumber", "Date", "Total", "Error"}
+
+// runInvoicePipeline is the whole pipeline: it looks for new files in dir
+// every poll, recognizes each one, extracts its fields and appends them to
+// csvFile. Files are remembered by name, so each is processed once per run.
+func runInvoicePipeline(client sight.Recognizer, dir, csvFile string, poll time.Duration, once bool) error {
+	f, err := os.OpenFile(csvFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	if fi, err := f.Stat(); err == nil && fi.Size() == 0 {
+		w.Write(invoiceCSVHeader)
+		w.Flush()
+	}
+
+	seen := make(map[string]bool)
+	for {
+		entries, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		var paths []string
+		for _, fi := range entries {
+			// A file is left until it has gone unmodified for one poll, so
+			// that it is not read while it is still being written.
+			if !fi.Mode().IsRegular() || strings.HasPrefix(fi.Name(), ".") || seen[fi.Name()] ||
+				(!once && time.Since(fi.ModTime()) < poll) {
+				continue
+			}
+			seen[fi.Name()] = true
+			paths = append(paths, filepath.Join(dir, fi.Name()))
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			inv := recognizeInvoice(client, path)
+			w.Write([]string{inv.File, fmt.Sprint(inv.Pages), inv.Number, inv.Date, inv.Total, inv.Error})
+			w.Flush()
+			if err := w.Error(); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "%v: invoice %q dated %q, total %q\n", path, inv.Number, inv.Date, inv.Total)
+		}
+		if once {
+			return nil
+		}
+		time.Sleep(poll)
+	}
+}
+
+// recognizeInvoice recognizes the text in the file at path and extracts the
+// fields of an invoice from it. Errors are recorded in the result rather
+// than returned, so that one bad file does not stop the pipeline.
+func recognizeInvoice(client sight.Recognizer, path string) invoice {
+	inv := invoice{File: path}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		inv.Error = err.Error()
+		return inv
+	}
+	files, err := sight.RouteInput(path, contents)
+	if err != nil {
+		inv.Error = err.Error()
+		return inv
+	}
+	pagesChan, err := client.RecognizeFiles(sight.Config{MakeSentences: true}, files...)
+	if err != nil {
+		inv.Error = err.Error()
+		return inv
+	}
+	var pages []sight.RecognizedPage
+	for page := range pagesChan {
+		if page.Error != "" {
+			inv.Error = page.Error
+			continue
+		}
+		pages = append(pages, page)
+	}
+	// Pages arrive in no particular order, but the fields are searched
+	// for in reading order.
+	sort.Slice(pages, func(i, j int) bool {
+		if pages[i].FileIndex != pages[j].FileIndex {
+			return pages[i].FileIndex < pages[j].FileIndex
+		}
+		return pages[i].PageNumber < pages[j].PageNumber
+	})
+	var text strings.Builder
+	for _, page := range pages {
+		for _, rt := range page.RecognizedText {
+			text.WriteString(rt.Text)
+			text.WriteString("\n")
+		}
+	}
+	inv.Pages = len(pages)
+	inv.Number, inv.Date, inv.Total = extractInvoiceFields(text.String())
+	return inv
+}
+
+var (
+	invoiceNumberPattern = regexp.MustCompile(`(?i)invoice\s*(?:no\.?|number|#)?\s*[:#]?\s*([A-Z0-9/-]*\d[A-Z0-9/-]*)`)
+	invoiceDatePattern   = regexp.MustCompile(`\b(\d{4}-\d{2}-\d{2}|\d{1,2}[./]\d{1,2}[./]\d{2,4})\b`)
+	invoiceTotalPattern  = regexp.MustCompile(`(?i)\btotal\b\D{0,20}?(\d[\d,]*\.\d{2})\b`)
+)
+
+// extractInvoiceFields finds the invoice number, the first date and the
+// last total in text. These patterns suit simple English invoices; a real
+// deployment would replace them with rules for its own documents.
+func extractInvoiceFields(text string) (number, date, total string) {
+	if m := invoiceNumberPattern.FindStringSubmatch(text); m != nil {
+		number = m[1]
+	}
+	if m := invoiceDatePattern.FindStringSubmatch(text); m != nil {
+		date = m[1]
+	}
+	// Subtotals come before the total, so the last match is the total.
+	if ms := invoiceTotalPattern.FindAllStringSubmatch(text, -1); ms != nil {
+		total = ms[len(ms)-1][1]
+	}
+	return number, date, total
+}
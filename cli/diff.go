@@ -0,0 +1,223 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/siftrics/sight"
+)
+
+const diffUsage = `usage: ./sight diff <results a> <results b>
+
+Compares two JSON output files, e.g., from before and after a change to preprocessing,
+and reports the text which changed, moved, was added or removed, and changes of
+confidence, page by page. Files are matched by their names in the metadata of the
+results, or by their order if there is none. Exits with status 2 if there are
+differences.
+
+example:
+ ./sight diff before.json after.json --move-tolerance 3 --confidence-tolerance 0.05
+
+optional flags:
+ [--json]                         Print the differences as JSON.
+ [--move-tolerance pixels]        Ignore boxes which moved less than this. Defaults to 0.
+ [--confidence-tolerance delta]   Ignore changes of confidence smaller than this.
+                                    Defaults to 0.
+`
+
+func diffMain(args []string) {
+	asJSON := false
+	var opts sight.DiffOptions
+	var paths []string
+	for i := 0; i < len(args); i++ {
+		s := args[i]
+		tolerance := func() float64 {
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: %v was specified but no value came after it.\nRun ./sight diff -h for more help.\n", s)
+				os.Exit(1)
+			}
+			i++
+			v, err := strconv.ParseFloat(args[i], 64)
+			if err != nil || v < 0 {
+				fmt.Fprintf(os.Stderr, "error: %v must be followed by a non-negative number.\nRun ./sight diff -h for more help.\n", s)
+				os.Exit(1)
+			}
+			return v
+		}
+		switch s {
+		case "-h", "--help":
+			fmt.Fprint(os.Stderr, diffUsage)
+			os.Exit(1)
+		case "--json":
+			asJSON = true
+		case "--move-tolerance":
+			opts.MoveTolerance = tolerance()
+		case "--confidence-tolerance":
+			opts.ConfidenceTolerance = tolerance()
+		default:
+			if len(s) > 1 && s[0] == '-' {
+				fmt.Fprintf(os.Stderr, "error: unexpected argument %v.\nRun ./sight diff -h for more help.\n", s)
+				os.Exit(1)
+			}
+			paths = append(paths, s)
+		}
+	}
+	if len(paths) != 2 {
+		fmt.Fprint(os.Stderr, diffUsage)
+		os.Exit(1)
+	}
+	a, err := loadResults(paths[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	b, err := loadResults(paths[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	inputs := alignInputs(&a, &b)
+	d := sight.DiffResults(a.Pages, b.Pages, opts)
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(d)
+	} else {
+		writeDiff(os.Stdout, d, inputs, paths[0], paths[1])
+	}
+	if !d.Equal() {
+		os.Exit(2)
+	}
+}
+
+// resultsFile is the contents of a JSON output file.
+type resultsFile struct {
+	Pages    []sight.RecognizedPage
+	Metadata *jobMetadata
+}
+
+func loadResults(path string) (resultsFile, error) {
+	var r resultsFile
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return r, err
+	}
+	if err := json.Unmarshal(buf, &r); err != nil {
+		return r, fmt.Errorf("%v is not a JSON output file: %v", path, err)
+	}
+	return r, nil
+}
+
+// alignInputs renumbers the files of b so that each has the FileIndex of
+// the file with the same name in a, if both name their inputs, and returns
+// the names of the files by FileIndex.
+func alignInputs(a, b *resultsFile) []string {
+	if a.Metadata == nil || b.Metadata == nil || len(a.Metadata.Inputs) == 0 || len(b.Metadata.Inputs) == 0 {
+		if a.Metadata != nil {
+			return a.Metadata.Inputs
+		}
+		return nil
+	}
+	inputs := append([]string(nil), a.Metadata.Inputs...)
+	index := make(map[string]int)
+	for i, name := range inputs {
+		index[name] = i
+	}
+	renumber := make([]int, len(b.Metadata.Inputs))
+	for i, name := range b.Metadata.Inputs {
+		j, ok := index[name]
+		if !ok {
+			j = len(inputs)
+			inputs = append(inputs, name)
+			index[name] = j
+		}
+		renumber[i] = j
+	}
+	for k, p := range b.Pages {
+		if p.FileIndex >= 0 && p.FileIndex < len(renumber) {
+			b.Pages[k].FileIndex = renumber[p.FileIndex]
+		}
+	}
+	return inputs
+}
+
+// writeDiff prints d for a person to read. inputs are the names of the
+// files, and nameA and nameB those of the results compared.
+func writeDiff(w io.Writer, d sight.ResultsDiff, inputs []string, nameA, nameB string) {
+	for _, pd := range d.Pages {
+		name := fmt.Sprintf("file %v", pd.FileIndex)
+		if pd.FileIndex >= 0 && pd.FileIndex < len(inputs) {
+			name = inputs[pd.FileIndex]
+		}
+		switch pd.Missing {
+		case "a":
+			fmt.Fprintf(w, "%v page %v: only in %v\n", name, pd.PageNumber, nameB)
+			continue
+		case "b":
+			fmt.Fprintf(w, "%v page %v: only in %v\n", name, pd.PageNumber, nameA)
+			continue
+		}
+		fmt.Fprintf(w, "%v page %v:\n", name, pd.PageNumber)
+		if pd.ErrorA != "" || pd.ErrorB != "" {
+			fmt.Fprintf(w, "  %-11v %q -> %q\n", "error", pd.ErrorA, pd.ErrorB)
+		}
+		for _, td := range pd.Texts {
+			switch td.Kind {
+			case sight.TextChanged:
+				fmt.Fprintf(w, "  %-11v %q -> %q\n", td.Kind, td.A.Text, td.B.Text)
+			case sight.TextMoved:
+				fmt.Fprintf(w, "  %-11v %q by %.1f pixels\n", td.Kind, td.A.Text, td.Moved)
+			case sight.ConfidenceDiff:
+				fmt.Fprintf(w, "  %-11v %q %.2f -> %.2f\n", td.Kind, td.A.Text, td.A.Confidence, td.B.Confidence)
+			case sight.TextRemoved:
+				fmt.Fprintf(w, "  %-11v %q\n", td.Kind, td.A.Text)
+			case sight.TextAdded:
+				fmt.Fprintf(w, "  %-11v %q\n", td.Kind, td.B.Text)
+			}
+		}
+	}
+	if d.Equal() {
+		fmt.Fprintf(w, "No differences.\n")
+		return
+	}
+	var counts []string
+	for _, kind := range []string{sight.TextChanged, sight.TextMoved, sight.ConfidenceDiff, sight.TextRemoved, sight.TextAdded} {
+		if n := d.Counts[kind]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%v %v", n, kind))
+		}
+	}
+	if len(d.Pages) == 1 {
+		fmt.Fprintf(w, "1 page differs")
+	} else {
+		fmt.Fprintf(w, "%v pages differ", len(d.Pages))
+	}
+	if len(counts) != 0 {
+		fmt.Fprintf(w, ": %v", strings.Join(counts, ", "))
+	}
+	fmt.Fprintf(w, ".\n")
+}
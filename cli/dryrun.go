@@ -0,0 +1,50 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/siftrics/sight"
+)
+
+// dryRun prints how many pages files would be billed for and what that
+// would cost, without submitting anything. skipped are the files which
+// cannot be submitted at all. PDFs longer than cfg.MaxPagesPerFile are
+// counted as they would be submitted.
+func dryRun(w io.Writer, cfg sight.Config, files []sight.File, skipped []fileFailure) {
+	e := sight.EstimateFilesCost(cfg, sight.DefaultPricing, files...)
+	uncounted := append([]fileFailure(nil), skipped...)
+	for _, f := range e.Uncounted {
+		uncounted = append(uncounted, fileFailure{f.Name, f.Error})
+	}
+	fmt.Fprintf(w, "Dry run: nothing was submitted.\n")
+	fmt.Fprintf(w, " %v PDF files and %v images\n", e.PDFs, e.Images)
+	fmt.Fprintf(w, " %v billable pages\n", e.Pages)
+	fmt.Fprintf(w, " estimated cost: $%.2f (at $%.2f per 1,000 pages)\n", e.Dollars, 1000*sight.DefaultPricing.DollarsPerPage)
+	if len(uncounted) != 0 {
+		fmt.Fprintf(w, "%v files cannot be submitted or their pages could not be counted, so they are not included above:\n", len(uncounted))
+		for _, f := range uncounted {
+			fmt.Fprintf(w, " %v: %v\n", f.path, f.reason)
+		}
+	}
+}
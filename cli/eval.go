@@ -0,0 +1,142 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/eval"
+)
+
+const evalUsage = `usage: ./sight eval <results> <--truth directory>
+
+Measures the accuracy of a JSON output file against ground truth: the character error rate
+(CER) and word error rate (WER) of each input and of all of them together. The ground truth
+of an input is a text file in the truth directory with the same name and the extension
+.txt, e.g., truth/invoice.txt for inputs/invoice.pdf. Inputs without one are skipped.
+
+example:
+ ./sight eval results.json --truth truth/
+
+optional flags:
+ [--json]   Print the report as JSON.
+`
+
+func evalMain(args []string) {
+	asJSON := false
+	var resultsPath, truthDir string
+	for i := 0; i < len(args); i++ {
+		s := args[i]
+		switch s {
+		case "-h", "--help":
+			fmt.Fprint(os.Stderr, evalUsage)
+			os.Exit(1)
+		case "--truth":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: --truth was specified but no directory came after it.\nRun ./sight eval -h for more help.\n")
+				os.Exit(1)
+			}
+			i++
+			truthDir = args[i]
+		case "--json":
+			asJSON = true
+		default:
+			if resultsPath != "" || (len(s) > 1 && s[0] == '-') {
+				fmt.Fprintf(os.Stderr, "error: unexpected argument %v.\nRun ./sight eval -h for more help.\n", s)
+				os.Exit(1)
+			}
+			resultsPath = s
+		}
+	}
+	if resultsPath == "" || truthDir == "" {
+		fmt.Fprint(os.Stderr, evalUsage)
+		os.Exit(1)
+	}
+	r, err := loadResults(resultsPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if r.Metadata == nil || len(r.Metadata.Inputs) == 0 {
+		fmt.Fprintf(os.Stderr, "error: %v does not name its inputs, so their ground truth cannot be found.\n", resultsPath)
+		os.Exit(1)
+	}
+	report := evaluate(r, truthDir)
+	if len(report.Files) == 0 {
+		fmt.Fprintf(os.Stderr, "error: no ground truth was found in %v for any input.\n", truthDir)
+		os.Exit(1)
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		writeEval(os.Stdout, report)
+	}
+}
+
+// evaluate scores the text recognized in each input of r which has ground
+// truth in truthDir.
+func evaluate(r resultsFile, truthDir string) eval.Report {
+	pagesByFile := make(map[int][]sight.RecognizedPage)
+	for _, p := range r.Pages {
+		pagesByFile[p.FileIndex] = append(pagesByFile[p.FileIndex], p)
+	}
+	var report eval.Report
+	for i, input := range r.Metadata.Inputs {
+		base := filepath.Base(input)
+		truthFile := filepath.Join(truthDir, strings.TrimSuffix(base, filepath.Ext(base))+".txt")
+		truth, err := ioutil.ReadFile(truthFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping %v, which has no ground truth: %v\n", input, err)
+			continue
+		}
+		s := eval.Compare(eval.PageText(pagesByFile[i]), string(truth))
+		s.Name = input
+		report.Add(s)
+	}
+	return report
+}
+
+// writeEval prints r as a table.
+func writeEval(w io.Writer, r eval.Report) {
+	width := len("Total")
+	for _, s := range r.Files {
+		if len(s.Name) > width {
+			width = len(s.Name)
+		}
+	}
+	row := func(name string, s eval.Score) {
+		fmt.Fprintf(w, "%-*v  %7.2f%%  %7.2f%%  %10v  %6v\n", width, name, 100*s.CER, 100*s.WER, s.Characters, s.Words)
+	}
+	fmt.Fprintf(w, "%-*v  %8v  %8v  %10v  %6v\n", width, "File", "CER", "WER", "Characters", "Words")
+	for _, s := range r.Files {
+		row(s.Name, s)
+	}
+	row("Total", r.Total)
+}
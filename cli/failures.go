@@ -0,0 +1,171 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/siftrics/sight"
+)
+
+// Exit codes of a run which got as far as submitting files.
+const (
+	exitOK             = 0
+	exitTotalFailure   = 1
+	exitPartialFailure = 2
+)
+
+// checkPages reports why f cannot be submitted because it is a PDF with
+// more than maxPages pages, if maxPages is positive.
+func checkPages(f sight.File, maxPages int) error {
+	if maxPages <= 0 {
+		return nil
+	}
+	if n, err := sight.CountPages(f); err == nil && n > maxPages {
+		return fmt.Errorf("%v pages, more than the maximum of %v (--max-pages)", n, maxPages)
+	}
+	return nil
+}
+
+type pageKey struct {
+	file, page int
+}
+
+// runResults tracks which pages of each input file have been recognized, so
+// that files with failed or missing pages can be retried and reported.
+// Pages whose Error is set are held back rather than written, in case a
+// retry recognizes them.
+type runResults struct {
+	numPages  map[int]int
+	succeeded map[pageKey]bool
+	failed    map[pageKey]sight.RecognizedPage
+}
+
+func newRunResults() *runResults {
+	return &runResults{
+		numPages:  make(map[int]int),
+		succeeded: make(map[pageKey]bool),
+		failed:    make(map[pageKey]sight.RecognizedPage),
+	}
+}
+
+// add records page and reports whether it should be written to the output:
+// that is, whether it was recognized and was not already recognized by an
+// earlier attempt.
+func (rr *runResults) add(page sight.RecognizedPage) bool {
+	if page.NumberOfPagesInFile > 0 {
+		rr.numPages[page.FileIndex] = page.NumberOfPagesInFile
+	}
+	key := pageKey{page.FileIndex, page.PageNumber}
+	if rr.succeeded[key] {
+		return false
+	}
+	if page.Error != "" {
+		rr.failed[key] = page
+		return false
+	}
+	delete(rr.failed, key)
+	rr.succeeded[key] = true
+	return true
+}
+
+// failedFiles returns the reason each of the first numFiles input files
+// failed, by index. A file fails if any of its pages has an error or was
+// never received.
+func (rr *runResults) failedFiles(numFiles int) map[int]string {
+	reasons := make(map[int]string)
+	for _, page := range rr.heldPages() {
+		if _, ok := reasons[page.FileIndex]; !ok {
+			reason := fmt.Sprintf("page %v: %v", page.PageNumber, page.Error)
+			if page.RequestID != "" {
+				reason += fmt.Sprintf(" (request ID %v)", page.RequestID)
+			}
+			reasons[page.FileIndex] = reason
+		}
+	}
+	for i := 0; i < numFiles; i++ {
+		if _, ok := reasons[i]; ok {
+			continue
+		}
+		if _, ok := rr.numPages[i]; !ok {
+			reasons[i] = "no results were received"
+		} else if rr.hasMissingPages(i) {
+			reasons[i] = "no results were received for some pages"
+		}
+	}
+	return reasons
+}
+
+// hasFailedPages reports whether any page of the file has an error.
+func (rr *runResults) hasFailedPages(file int) bool {
+	for key := range rr.failed {
+		if key.file == file {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMissingPages reports whether any page of the file has not been
+// recognized, whether because it failed or because it was never received.
+func (rr *runResults) hasMissingPages(file int) bool {
+	n, ok := rr.numPages[file]
+	if !ok {
+		return true
+	}
+	succeeded := 0
+	for key := range rr.succeeded {
+		if key.file == file {
+			succeeded++
+		}
+	}
+	return succeeded < n
+}
+
+// heldPages returns the pages which are still failed, in input order.
+func (rr *runResults) heldPages() []sight.RecognizedPage {
+	pages := make([]sight.RecognizedPage, 0, len(rr.failed))
+	for _, page := range rr.failed {
+		pages = append(pages, page)
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		if pages[i].FileIndex != pages[j].FileIndex {
+			return pages[i].FileIndex < pages[j].FileIndex
+		}
+		return pages[i].PageNumber < pages[j].PageNumber
+	})
+	return pages
+}
+
+// fileFailure is an input file which failed and why.
+type fileFailure struct {
+	path, reason string
+}
+
+// writeFailures prints why each failed file failed.
+func writeFailures(w io.Writer, failures []fileFailure, numFiles int) {
+	fmt.Fprintf(w, "\n%v of %v input files failed:\n", len(failures), numFiles)
+	for _, f := range failures {
+		fmt.Fprintf(w, " %v: %v\n", f.path, f.reason)
+	}
+}
@@ -0,0 +1,490 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/siftrics/sight"
+)
+
+// textFilter is a compiled --filter expression, which decides for each
+// recognized sentence (or word) whether it is written. Expressions combine
+// the fields of the text with comparisons, &&, || and !, and a few
+// functions, e.g.,
+//
+//	confidence > 0.9 && matches(text, "[0-9]{4}-")
+type textFilter struct {
+	eval func(*filterEnv) interface{}
+}
+
+// filterEnv is the text element a filter is evaluated for.
+type filterEnv struct {
+	file string
+	page *sight.RecognizedPage
+	text *sight.RecognizedText
+}
+
+type filterKind int
+
+const (
+	kindNumber filterKind = iota
+	kindString
+	kindBool
+)
+
+func (k filterKind) String() string {
+	return [...]string{"number", "string", "boolean"}[k]
+}
+
+// filterExpr is a compiled subexpression and the kind of its value.
+// literal is set for string literals, whose value is known when the
+// expression is compiled.
+type filterExpr struct {
+	kind    filterKind
+	eval    func(*filterEnv) interface{}
+	literal *string
+}
+
+// filterFields are the fields of a text element which filters can use.
+var filterFields = map[string]filterExpr{
+	"text":       {kind: kindString, eval: func(e *filterEnv) interface{} { return e.text.Text }},
+	"confidence": {kind: kindNumber, eval: func(e *filterEnv) interface{} { return e.text.Confidence }},
+	"language":   {kind: kindString, eval: func(e *filterEnv) interface{} { return e.text.Language }},
+	"x":          {kind: kindNumber, eval: func(e *filterEnv) interface{} { return float64(e.text.TopLeftX) }},
+	"y":          {kind: kindNumber, eval: func(e *filterEnv) interface{} { return float64(e.text.TopLeftY) }},
+	"width":      {kind: kindNumber, eval: func(e *filterEnv) interface{} { return float64(e.text.TopRightX - e.text.TopLeftX) }},
+	"height":     {kind: kindNumber, eval: func(e *filterEnv) interface{} { return float64(e.text.BottomLeftY - e.text.TopLeftY) }},
+	"page":       {kind: kindNumber, eval: func(e *filterEnv) interface{} { return float64(e.page.PageNumber) }},
+	"pages":      {kind: kindNumber, eval: func(e *filterEnv) interface{} { return float64(e.page.NumberOfPagesInFile) }},
+	"file":       {kind: kindString, eval: func(e *filterEnv) interface{} { return e.file }},
+}
+
+// filterFuncs are the functions which filters can call.
+var filterFuncs = map[string]struct {
+	args   []filterKind
+	result filterKind
+	call   func(args []interface{}) interface{}
+}{
+	"contains":   {[]filterKind{kindString, kindString}, kindBool, func(a []interface{}) interface{} { return strings.Contains(a[0].(string), a[1].(string)) }},
+	"startsWith": {[]filterKind{kindString, kindString}, kindBool, func(a []interface{}) interface{} { return strings.HasPrefix(a[0].(string), a[1].(string)) }},
+	"endsWith":   {[]filterKind{kindString, kindString}, kindBool, func(a []interface{}) interface{} { return strings.HasSuffix(a[0].(string), a[1].(string)) }},
+	"lower":      {[]filterKind{kindString}, kindString, func(a []interface{}) interface{} { return strings.ToLower(a[0].(string)) }},
+	"upper":      {[]filterKind{kindString}, kindString, func(a []interface{}) interface{} { return strings.ToUpper(a[0].(string)) }},
+	"len":        {[]filterKind{kindString}, kindNumber, func(a []interface{}) interface{} { return float64(utf8.RuneCountInString(a[0].(string))) }},
+}
+
+// parseFilter compiles a --filter expression.
+func parseFilter(expr string) (*textFilter, error) {
+	toks, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{toks: toks}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at column %v", t.text, t.pos+1)
+	}
+	if e.kind != kindBool {
+		return nil, fmt.Errorf("the expression is a %v, not a boolean", e.kind)
+	}
+	return &textFilter{eval: e.eval}, nil
+}
+
+// apply returns page with only the text elements for which f is true.
+func (f *textFilter) apply(file string, page sight.RecognizedPage) sight.RecognizedPage {
+	kept := make([]sight.RecognizedText, 0, len(page.RecognizedText))
+	env := &filterEnv{file: file, page: &page}
+	for i := range page.RecognizedText {
+		env.text = &page.RecognizedText[i]
+		if f.eval(env).(bool) {
+			kept = append(kept, page.RecognizedText[i])
+		}
+	}
+	page.RecognizedText = kept
+	return page
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOp
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+	pos  int
+	// value is the value of a number or string.
+	value interface{}
+}
+
+func lexFilter(s string) ([]filterToken, error) {
+	var toks []filterToken
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			n, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at column %v", s[i:j], i+1)
+			}
+			toks = append(toks, filterToken{tokNumber, s[i:j], i, n})
+			i = j
+		case c == '"' || c == '\'':
+			// Single-quoted strings are raw, which suits regular
+			// expressions; double-quoted ones have Go escapes.
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' && c == '"' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at column %v", i+1)
+			}
+			text := s[i+1 : j]
+			if c == '"' {
+				var err error
+				if text, err = strconv.Unquote(s[i : j+1]); err != nil {
+					return nil, fmt.Errorf("invalid string at column %v: %v", i+1, err)
+				}
+			}
+			toks = append(toks, filterToken{tokString, s[i : j+1], i, text})
+			i = j + 1
+		case c == '_' || isLetter(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || isLetter(s[j]) || s[j] >= '0' && s[j] <= '9') {
+				j++
+			}
+			toks = append(toks, filterToken{tokIdent, s[i:j], i, nil})
+			i = j
+		default:
+			op := ""
+			for _, o := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", ",", "-"} {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at column %v", c, i+1)
+			}
+			toks = append(toks, filterToken{tokOp, op, i, nil})
+			i += len(op)
+		}
+	}
+	return append(toks, filterToken{tokEOF, "end of expression", len(s), nil}), nil
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// filterParser parses tokens by recursive descent, from the operator which
+// binds least tightly, ||, to the most tightly, !.
+type filterParser struct {
+	toks []filterToken
+	i    int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.toks[p.i]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *filterParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return fmt.Errorf("expected %v but found %q at column %v", op, t.text, t.pos+1)
+	}
+	return nil
+}
+
+// logical parses operands of && or ||, which must be booleans.
+func (p *filterParser) logical(op string, operand func() (filterExpr, error)) (filterExpr, error) {
+	x, err := operand()
+	if err != nil {
+		return x, err
+	}
+	for {
+		t := p.peek()
+		if !p.accept(op) {
+			return x, nil
+		}
+		y, err := operand()
+		if err != nil {
+			return x, err
+		}
+		if x.kind != kindBool || y.kind != kindBool {
+			return x, fmt.Errorf("%v at column %v needs booleans on both sides", op, t.pos+1)
+		}
+		a, b := x.eval, y.eval
+		if op == "&&" {
+			x.eval = func(e *filterEnv) interface{} { return a(e).(bool) && b(e).(bool) }
+		} else {
+			x.eval = func(e *filterEnv) interface{} { return a(e).(bool) || b(e).(bool) }
+		}
+	}
+}
+
+func (p *filterParser) or() (filterExpr, error) {
+	return p.logical("||", p.and)
+}
+
+func (p *filterParser) and() (filterExpr, error) {
+	return p.logical("&&", p.comparison)
+}
+
+func (p *filterParser) comparison() (filterExpr, error) {
+	x, err := p.unary()
+	if err != nil {
+		return x, err
+	}
+	t := p.peek()
+	op := t.text
+	switch {
+	case t.kind != tokOp:
+		return x, nil
+	case op == "==" || op == "!=" || op == "<" || op == "<=" || op == ">" || op == ">=":
+	default:
+		return x, nil
+	}
+	p.next()
+	y, err := p.unary()
+	if err != nil {
+		return x, err
+	}
+	if x.kind != y.kind {
+		return x, fmt.Errorf("%v at column %v compares a %v with a %v", op, t.pos+1, x.kind, y.kind)
+	}
+	if x.kind == kindBool && op != "==" && op != "!=" {
+		return x, fmt.Errorf("%v at column %v cannot compare booleans", op, t.pos+1)
+	}
+	a, b, kind := x.eval, y.eval, x.kind
+	return filterExpr{kind: kindBool, eval: func(e *filterEnv) interface{} {
+		return compare(op, kind, a(e), b(e))
+	}}, nil
+}
+
+func compare(op string, kind filterKind, a, b interface{}) bool {
+	var c int
+	switch kind {
+	case kindBool:
+		if a.(bool) != b.(bool) {
+			c = 1
+		}
+	case kindNumber:
+		switch x, y := a.(float64), b.(float64); {
+		case x < y:
+			c = -1
+		case x > y:
+			c = 1
+		}
+	default:
+		c = strings.Compare(a.(string), b.(string))
+	}
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+func (p *filterParser) unary() (filterExpr, error) {
+	t := p.peek()
+	switch {
+	case p.accept("!"):
+		x, err := p.unary()
+		if err != nil {
+			return x, err
+		}
+		if x.kind != kindBool {
+			return x, fmt.Errorf("! at column %v needs a boolean", t.pos+1)
+		}
+		a := x.eval
+		return filterExpr{kind: kindBool, eval: func(e *filterEnv) interface{} { return !a(e).(bool) }}, nil
+	case p.accept("-"):
+		x, err := p.unary()
+		if err != nil {
+			return x, err
+		}
+		if x.kind != kindNumber {
+			return x, fmt.Errorf("- at column %v needs a number", t.pos+1)
+		}
+		a := x.eval
+		return filterExpr{kind: kindNumber, eval: func(e *filterEnv) interface{} { return -a(e).(float64) }}, nil
+	}
+	return p.primary()
+}
+
+func (p *filterParser) primary() (filterExpr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return filterExpr{kind: kindNumber, eval: func(*filterEnv) interface{} { return t.value }}, nil
+	case tokString:
+		v := t.value.(string)
+		return filterExpr{kind: kindString, eval: func(*filterEnv) interface{} { return v }, literal: &v}, nil
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			v := t.text == "true"
+			return filterExpr{kind: kindBool, eval: func(*filterEnv) interface{} { return v }}, nil
+		case "matches":
+			return p.matches(t)
+		}
+		if f, ok := filterFields[t.text]; ok {
+			return f, nil
+		}
+		if _, ok := filterFuncs[t.text]; ok {
+			return p.call(t)
+		}
+		return filterExpr{}, fmt.Errorf("unknown name %v at column %v", t.text, t.pos+1)
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.or()
+			if err != nil {
+				return x, err
+			}
+			return x, p.expect(")")
+		}
+	}
+	return filterExpr{}, fmt.Errorf("unexpected %q at column %v", t.text, t.pos+1)
+}
+
+// args parses the arguments of a call to fn, which must be of kinds.
+func (p *filterParser) args(fn filterToken, kinds []filterKind) ([]filterExpr, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []filterExpr
+	for !p.accept(")") {
+		if len(args) != 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		x, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, x)
+	}
+	if len(args) != len(kinds) {
+		plural := "s"
+		if len(kinds) == 1 {
+			plural = ""
+		}
+		return nil, fmt.Errorf("%v at column %v takes %v argument%v, not %v", fn.text, fn.pos+1, len(kinds), plural, len(args))
+	}
+	for i, x := range args {
+		if x.kind != kinds[i] {
+			return nil, fmt.Errorf("argument %v of %v at column %v must be a %v, not a %v", i+1, fn.text, fn.pos+1, kinds[i], x.kind)
+		}
+	}
+	return args, nil
+}
+
+func (p *filterParser) call(fn filterToken) (filterExpr, error) {
+	f := filterFuncs[fn.text]
+	args, err := p.args(fn, f.args)
+	if err != nil {
+		return filterExpr{}, err
+	}
+	return filterExpr{kind: f.result, eval: func(e *filterEnv) interface{} {
+		values := make([]interface{}, len(args))
+		for i, a := range args {
+			values[i] = a.eval(e)
+		}
+		return f.call(values)
+	}}, nil
+}
+
+// matches parses matches(s, pattern), which reports whether the regular
+// expression pattern matches part of s. Patterns which are literals are
+// compiled once; others are compiled as they are evaluated.
+func (p *filterParser) matches(fn filterToken) (filterExpr, error) {
+	args, err := p.args(fn, []filterKind{kindString, kindString})
+	if err != nil {
+		return filterExpr{}, err
+	}
+	s, pattern := args[0].eval, args[1].eval
+	if lit := args[1].literal; lit != nil {
+		re, err := regexp.Compile(*lit)
+		if err != nil {
+			return filterExpr{}, fmt.Errorf("invalid regular expression in %v at column %v: %v", fn.text, fn.pos+1, err)
+		}
+		return filterExpr{kind: kindBool, eval: func(e *filterEnv) interface{} { return re.MatchString(s(e).(string)) }}, nil
+	}
+	cache := make(map[string]*regexp.Regexp)
+	return filterExpr{kind: kindBool, eval: func(e *filterEnv) interface{} {
+		expr := pattern(e).(string)
+		re, ok := cache[expr]
+		if !ok {
+			// An invalid pattern matches nothing.
+			re, _ = regexp.Compile(expr)
+			cache[expr] = re
+		}
+		return re != nil && re.MatchString(s(e).(string))
+	}}, nil
+}
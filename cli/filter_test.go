@@ -0,0 +1,182 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/siftrics/sight"
+)
+
+// filterPage is a page of three text elements for filters to be evaluated
+// against.
+var filterPage = sight.RecognizedPage{
+	PageNumber:          2,
+	NumberOfPagesInFile: 3,
+	RecognizedText: []sight.RecognizedText{
+		{Text: "Invoice 2020-0042", Confidence: 0.95, TopLeftX: 10, TopLeftY: 20, TopRightX: 110, BottomLeftY: 40},
+		{Text: "Total", Confidence: 0.5, TopLeftX: 10, TopLeftY: 300, TopRightX: 50, BottomLeftY: 312},
+		{Text: "ünïcode", Confidence: 0.8, Language: "de", TopLeftX: 200, TopLeftY: 300, TopRightX: 260, BottomLeftY: 312},
+	},
+}
+
+func TestFilterEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		// && binds more tightly than ||, and ! more tightly than both.
+		{"true || false && false", true},
+		{"(true || false) && false", false},
+		{"false && false || true", true},
+		{"false && (false || true)", false},
+		{"!false && false", false},
+		{"!(false && false)", true},
+		{"!true == false", true},
+		{"!!true", true},
+		{"1 < 2 && 2 < 1 || 3 == 3", true},
+		{"((true))", true},
+		{"-1 < 0", true},
+		{"- -1 == 1", true},
+
+		{`text == "Invoice 2020-0042"`, true},
+		{`text != "Invoice 2020-0042"`, false},
+		{`"a" < "b"`, true},
+		{"confidence > 0.9", true},
+		{"confidence >= 0.95 && confidence <= .95", true},
+		{"x == 10 && y == 20 && width == 100 && height == 20", true},
+		{"page == 2 && pages == 3", true},
+		{`file == "scan.pdf"`, true},
+		{`language == ""`, true},
+		{"true == true && true != false", true},
+
+		{`contains(text, "2020")`, true},
+		{`startsWith(text, "Inv") && endsWith(text, "42")`, true},
+		{`lower(text) == "invoice 2020-0042"`, true},
+		{`upper("abc") == "ABC"`, true},
+		{"len(text) == 17", true},
+		{`len("ü") == 1`, true},
+		{`matches(text, '[0-9]{4}-[0-9]+$')`, true},
+		{`matches(text, "^total")`, false},
+		{`matches(text, "\\d")`, true},
+		// A pattern which is not a literal is compiled as the filter is
+		// evaluated, and one which is invalid matches nothing.
+		{`matches(text, lower("[0-9]"))`, true},
+		{`matches(text, lower("["))`, false},
+	}
+	text := &filterPage.RecognizedText[0]
+	for _, tt := range tests {
+		f, err := parseFilter(tt.expr)
+		if err != nil {
+			t.Errorf("parseFilter(%q): %v", tt.expr, err)
+			continue
+		}
+		env := &filterEnv{file: "scan.pdf", page: &filterPage, text: text}
+		if got := f.eval(env).(bool); got != tt.want {
+			t.Errorf("%q = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		// err is a substring of the error.
+		err string
+	}{
+		{`confidence > "high"`, "compares a number with a string"},
+		{`text == 1`, "compares a string with a number"},
+		{`true == 1`, "compares a boolean with a number"},
+		{"true < false", "cannot compare booleans"},
+		{"confidence && true", "needs booleans on both sides"},
+		{`true || text`, "needs booleans on both sides"},
+		{"!confidence", "! at column 1 needs a boolean"},
+		{`-text`, "- at column 1 needs a number"},
+		{"confidence", "is a number, not a boolean"},
+		{`lower(text)`, "is a string, not a boolean"},
+
+		{`matches(text, "[")`, "invalid regular expression in matches at column 1"},
+		{`matches(text, 'a**')`, "invalid regular expression"},
+		{`matches(text)`, "takes 2 arguments, not 1"},
+		{`matches(text, 1)`, "argument 2 of matches at column 1 must be a string, not a number"},
+		{`len(text, text) > 1`, "takes 1 argument, not 2"},
+		{`contains(confidence, "a")`, "must be a string, not a number"},
+
+		{"size > 1", "unknown name size at column 1"},
+		{`text == "a" && Text == "b"`, "unknown name Text at column 16"},
+		{"nope()", "unknown name nope"},
+
+		{"(true", "expected ) but found \"end of expression\""},
+		{"true)", `unexpected ")" at column 5`},
+		{"true true", `unexpected "true" at column 6`},
+		{"", "unexpected \"end of expression\""},
+		{"confidence > 1..2", `invalid number "1..2" at column 14`},
+		{`text == "abc`, "unterminated string at column 9"},
+		{`text == "\q"`, "invalid string at column 9"},
+		{"confidence > 0.5 & true", `unexpected '&' at column 18`},
+		{"contains(text \"a\")", "expected , but found"},
+	}
+	for _, tt := range tests {
+		_, err := parseFilter(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("parseFilter(%q) = %v, want an error containing %q", tt.expr, err, tt.err)
+		}
+	}
+}
+
+func TestFilterApply(t *testing.T) {
+	tests := []struct {
+		expr string
+		file string
+		want []string
+	}{
+		{"confidence > 0.9", "scan.pdf", []string{"Invoice 2020-0042"}},
+		{"y == 300", "scan.pdf", []string{"Total", "ünïcode"}},
+		{`!(y == 300) || language == "de"`, "scan.pdf", []string{"Invoice 2020-0042", "ünïcode"}},
+		{"true", "scan.pdf", []string{"Invoice 2020-0042", "Total", "ünïcode"}},
+		{"false", "scan.pdf", []string{}},
+		{`file == "other.pdf"`, "scan.pdf", []string{}},
+		{`file == "other.pdf"`, "other.pdf", []string{"Invoice 2020-0042", "Total", "ünïcode"}},
+		{"page == 1", "scan.pdf", []string{}},
+	}
+	for _, tt := range tests {
+		f, err := parseFilter(tt.expr)
+		if err != nil {
+			t.Fatalf("parseFilter(%q): %v", tt.expr, err)
+		}
+		page := f.apply(tt.file, filterPage)
+		got := []string{}
+		for _, text := range page.RecognizedText {
+			got = append(got, text.Text)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q on %v kept %q, want %q", tt.expr, tt.file, got, tt.want)
+		}
+		if page.PageNumber != filterPage.PageNumber {
+			t.Errorf("%q changed PageNumber to %v", tt.expr, page.PageNumber)
+		}
+	}
+	if len(filterPage.RecognizedText) != 3 {
+		t.Errorf("apply modified the page passed to it")
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"strconv"
+)
+
+// parseInterspersed parses the flags of fs in args, where they may come
+// before, between and after the positional arguments, which it returns in
+// order. Every argument after "--" is positional, so that files whose
+// names start with "-" can be given.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// alias defines name as another name of the flag of fs named existing, as
+// in -o and --output.
+func alias(fs *flag.FlagSet, name, existing string) {
+	f := fs.Lookup(existing)
+	fs.Var(f.Value, name, f.Usage)
+}
+
+// setFlag is a boolean flag which calls its function when it is given.
+type setFlag func()
+
+func (f setFlag) String() string {
+	return "false"
+}
+
+func (f setFlag) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err == nil && v {
+		f()
+	}
+	return err
+}
+
+func (f setFlag) IsBoolFlag() bool {
+	return true
+}
+
+// takesValue reports whether f is followed by a value, i.e., whether it is
+// not a boolean flag.
+func takesValue(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
+// flagName returns the name of f as it is written in usage messages, with
+// one dash if it is a single letter and two otherwise.
+func flagName(f *flag.Flag) string {
+	if len(f.Name) == 1 {
+		return "-" + f.Name
+	}
+	return "--" + f.Name
+}
+
+// positiveInt returns the function of a flag which sets *n to a positive
+// number of what, e.g., "pages".
+func positiveInt(n *int, what string) func(string) error {
+	return func(s string) error {
+		v, err := strconv.Atoi(s)
+		if err != nil || v <= 0 {
+			return errors.New("must be a positive number of " + what)
+		}
+		*n = v
+		return nil
+	}
+}
+
+// positiveFloat returns the function of a flag which sets *n to a positive
+// number.
+func positiveFloat(n *float64) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v <= 0 {
+			return errors.New("must be a positive number")
+		}
+		*n = v
+		return nil
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/siftrics/sight"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		output     string
+		force      bool
+	}{
+		{[]string{"a.pdf", "-o", "out.json", "b.png", "--force"}, []string{"a.pdf", "b.png"}, "out.json", true},
+		{[]string{"--output", "-", "a.pdf"}, []string{"a.pdf"}, "-", false},
+		{[]string{"--output=out.json", "a.pdf", "--force=false"}, []string{"a.pdf"}, "out.json", false},
+		// Arguments after -- are positional even if they look like
+		// flags.
+		{[]string{"-o", "out.json", "--", "jobs", "--force", "-o"}, []string{"jobs", "--force", "-o"}, "out.json", false},
+		{[]string{"a.pdf", "--", "--"}, []string{"a.pdf", "--"}, "", false},
+		{nil, nil, "", false},
+	}
+	for _, tt := range tests {
+		var output string
+		var force bool
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(ioutil.Discard)
+		fs.StringVar(&output, "output", "", "")
+		alias(fs, "o", "output")
+		fs.BoolVar(&force, "force", false, "")
+		positional, err := parseInterspersed(fs, tt.args)
+		if err != nil {
+			t.Errorf("parseInterspersed(%q): %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(positional, tt.positional) || output != tt.output || force != tt.force {
+			t.Errorf("parseInterspersed(%q) = %q with -o %q, --force %v; want %q, %q, %v",
+				tt.args, positional, output, force, tt.positional, tt.output, tt.force)
+		}
+	}
+}
+
+// parseRecognizeArgs parses args as recognizeMain does.
+func parseRecognizeArgs(args ...string) (sight.Config, recognizeOptions, []string, error) {
+	cfg := sight.Config{MakeSentences: true}
+	o := recognizeOptions{
+		annotate:       annotateOptions{dpi: 72},
+		logger:         &cliLogger{minLevel: levelWarn},
+		parallel:       1,
+		pageSelections: make(map[string][]int),
+		format:         "json",
+	}
+	inputs, err := parseInterspersed(newRecognizeFlags(&cfg, &o), args)
+	return cfg, o, inputs, err
+}
+
+func TestRecognizeFlags(t *testing.T) {
+	cfg, o, inputs, err := parseRecognizeArgs("a.pdf", "-o", "out.json", "-w", "--tag", "tenant=acme", "b.png",
+		"--tag", "batch=7", "--pages", "a.pdf:1-2", "--pages", "3", "--include", "*.pdf", "--include", "*.png",
+		"-s", "latin,cyrillic", "-q", "--parallel", "4", "--format", "text", "--reading-order", "--", "-c.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a.pdf", "b.png", "-c.jpg"}; !reflect.DeepEqual(inputs, want) {
+		t.Errorf("inputs = %q, want %q", inputs, want)
+	}
+	if o.outputFile != "out.json" || cfg.MakeSentences || !o.quiet || o.logger.minLevel != levelError || o.parallel != 4 || o.format != "text" {
+		t.Errorf("parsed -o %q, -w %v, -q %v (log level %v), --parallel %v, --format %q",
+			o.outputFile, !cfg.MakeSentences, o.quiet, o.logger.minLevel, o.parallel, o.format)
+	}
+	if want := map[string]string{"tenant": "acme", "batch": "7"}; !reflect.DeepEqual(cfg.Tags, want) {
+		t.Errorf("tags = %v, want %v", cfg.Tags, want)
+	}
+	if want := map[string][]int{"a.pdf": {1, 2}, "": {3}}; !reflect.DeepEqual(o.pageSelections, want) {
+		t.Errorf("page selections = %v, want %v", o.pageSelections, want)
+	}
+	if want := []string{"*.pdf", "*.png"}; !reflect.DeepEqual(o.includes, want) {
+		t.Errorf("includes = %q, want %q", o.includes, want)
+	}
+	if want := []string{"latin", "cyrillic"}; !reflect.DeepEqual(cfg.ScriptHints, want) {
+		t.Errorf("script hints = %q, want %q", cfg.ScriptHints, want)
+	}
+	if len(cfg.PostProcessors) != 1 {
+		t.Errorf("%v post-processors, want 1 for --reading-order", len(cfg.PostProcessors))
+	}
+}
+
+func TestPageSelectionKeys(t *testing.T) {
+	_, o, _, err := parseRecognizeArgs("--pages", "scans/../a.pdf:1", "--pages", "s3://bucket/scans//b.pdf:2",
+		"--pages", "gs://bucket/c.pdf:3-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]int{"a.pdf": {1}, "s3://bucket/scans//b.pdf": {2}, "gs://bucket/c.pdf": {3, 4}}
+	if !reflect.DeepEqual(o.pageSelections, want) {
+		t.Errorf("page selections = %v, want %v", o.pageSelections, want)
+	}
+	for name, key := range map[string]string{
+		"./a.pdf":                  "a.pdf",
+		"s3://bucket/scans//b.pdf": "s3://bucket/scans//b.pdf",
+		"gs://bucket/c.pdf":        "gs://bucket/c.pdf",
+	} {
+		if got := selectionKey(name); got != key {
+			t.Errorf("selectionKey(%q) = %q, want %q", name, got, key)
+		}
+	}
+}
+
+func TestSelectPages(t *testing.T) {
+	// The contents are not a readable PDF, so only the pages selected
+	// with --pages are counted against --max-pages.
+	stdin := sight.File{Name: "stdin", MimeType: "application/pdf", Contents: []byte("%PDF-1.7\n")}
+	tests := []struct {
+		args  []string
+		pages []int
+		fails bool
+	}{
+		{nil, nil, false},
+		{[]string{"--pages", "stdin:1-2"}, []int{1, 2}, false},
+		{[]string{"--pages", "2-3"}, []int{2, 3}, false},
+		{[]string{"--pages", "2-3", "--pages", "stdin:1-4"}, []int{1, 2, 3, 4}, true},
+		{[]string{"--pages", "a.pdf:1-4"}, nil, false},
+	}
+	for _, tt := range tests {
+		_, o, _, err := parseRecognizeArgs(tt.args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := o.selectPages("stdin", stdin, 3)
+		if !reflect.DeepEqual(f.Pages, tt.pages) || (err != nil) != tt.fails {
+			t.Errorf("selectPages with %q = pages %v, error %v; want %v, failure %v", tt.args, f.Pages, err, tt.pages, tt.fails)
+		}
+	}
+}
+
+func TestRecognizeFlagErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"-o"},
+		{"-o", "a.json", "--output", "b.json"},
+		{"--parallel", "0"},
+		{"--max-pages", "many"},
+		{"--priority", "urgent"},
+		{"--tag", "=x"},
+		{"--region", "mars"},
+		{"--format", "xml"},
+		{"--mime", "text/plain"},
+		{"--pages", "3-1"},
+		{"--redact", "("},
+		{"--annotate-dpi", "-1"},
+		{"-s", "latin", "-s", "cyrillic"},
+		{"--no-such-flag"},
+	} {
+		if _, _, _, err := parseRecognizeArgs(args...); err == nil {
+			t.Errorf("parsing %q succeeded", args)
+		}
+	}
+	if _, _, _, err := parseRecognizeArgs("-h"); err != flag.ErrHelp {
+		t.Errorf("parsing -h returned %v, want flag.ErrHelp", err)
+	}
+}
+
+func TestRecognizeUsageMatchesFlags(t *testing.T) {
+	fs := newRecognizeFlags(&sight.Config{}, &recognizeOptions{logger: &cliLogger{}})
+	flags, values := usageFlags(recognizeUsage, fs)
+	documented := make(map[string]bool)
+	for _, name := range flags {
+		documented[name] = true
+		f := fs.Lookup(strings.TrimLeft(name, "-"))
+		if f == nil {
+			t.Errorf("%v is in the usage message but is not a flag", name)
+			continue
+		}
+		if values[name] != takesValue(f) {
+			t.Errorf("%v takes a value: %v in the usage message, %v as a flag", name, values[name], takesValue(f))
+		}
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		if !documented[flagName(f)] {
+			t.Errorf("%v is not in the usage message", flagName(f))
+		}
+	})
+}
@@ -0,0 +1,149 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/encoding"
+	"github.com/siftrics/sight/layout"
+)
+
+// outputFormats are the values of --format. Only json, protobuf and msgpack
+// are meant to be parsed; the others are for reading in a terminal.
+var outputFormats = map[string]bool{"json": true, "text": true, "table": true, "prose": true, "protobuf": true, "msgpack": true}
+
+// encodingSink returns a Sink which writes pages to w in a binary format,
+// protobuf or msgpack, or nil if format is not one of them.
+func encodingSink(w io.Writer, format string) sight.Sink {
+	switch format {
+	case "protobuf":
+		return encoding.ProtoSink{W: w}
+	case "msgpack":
+		return encoding.MsgpackSink{W: w}
+	}
+	return nil
+}
+
+// sortedPages returns a copy of pages sorted by input file and then page
+// number, so that the output of a run does not depend on the order in which
+// pages arrived.
+func sortedPages(pages []sight.RecognizedPage) []sight.RecognizedPage {
+	sorted := make([]sight.RecognizedPage, len(pages))
+	copy(sorted, pages)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].FileIndex != sorted[j].FileIndex {
+			return sorted[i].FileIndex < sorted[j].FileIndex
+		}
+		return sorted[i].PageNumber < sorted[j].PageNumber
+	})
+	return sorted
+}
+
+// writeJSON writes pages, sorted, and metadata in the json format, indented
+// if pretty is set. The same pages and metadata are always written the same
+// way, so the outputs of two runs can be diffed.
+func writeJSON(w io.Writer, pages []sight.RecognizedPage, metadata *jobMetadata, pretty bool) error {
+	enc := json.NewEncoder(w)
+	if pretty {
+		enc.SetIndent("", "  ")
+	}
+	return enc.Encode(struct {
+		Pages    []sight.RecognizedPage
+		Metadata *jobMetadata
+	}{sortedPages(pages), metadata})
+}
+
+// writeReadable writes pages in the text, table or prose format, grouped by input
+// file and in page order. Pages arrive in no particular order, so they are
+// only written once all of them have been recognized.
+func writeReadable(w io.Writer, format string, pages []sight.RecognizedPage, inputFiles []string, withConfidence bool) error {
+	sorted := sortedPages(pages)
+	fileName := func(page sight.RecognizedPage) string {
+		if page.FileIndex < 0 || page.FileIndex >= len(inputFiles) {
+			return fmt.Sprintf("file %v", page.FileIndex)
+		}
+		return inputFiles[page.FileIndex]
+	}
+	if format == "table" {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		if withConfidence {
+			fmt.Fprintf(tw, "FILE\tPAGE\tCONFIDENCE\tTEXT\n")
+		} else {
+			fmt.Fprintf(tw, "FILE\tPAGE\tTEXT\n")
+		}
+		for _, page := range sorted {
+			rows := make([][2]string, 0, len(page.RecognizedText))
+			if page.Error != "" {
+				rows = append(rows, [2]string{"", "error: " + page.Error})
+			}
+			for _, t := range page.RecognizedText {
+				rows = append(rows, [2]string{fmt.Sprintf("%.2f", t.Confidence), tableCell(t.Text)})
+			}
+			for _, row := range rows {
+				if withConfidence {
+					fmt.Fprintf(tw, "%v\t%v\t%v\t%v\n", fileName(page), page.PageNumber, row[0], row[1])
+				} else {
+					fmt.Fprintf(tw, "%v\t%v\t%v\n", fileName(page), page.PageNumber, row[1])
+				}
+			}
+		}
+		return tw.Flush()
+	}
+	lastFile := -1
+	for _, page := range sorted {
+		if page.FileIndex != lastFile {
+			if lastFile != -1 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "== %v ==\n", fileName(page))
+			lastFile = page.FileIndex
+		}
+		fmt.Fprintf(w, "-- page %v of %v --\n", page.PageNumber, page.NumberOfPagesInFile)
+		if page.Error != "" {
+			fmt.Fprintf(w, "error: %v\n", page.Error)
+		}
+		if format == "prose" {
+			for _, para := range layout.Paragraphs(page) {
+				fmt.Fprintf(w, "%v\n\n", para.Text)
+			}
+			continue
+		}
+		for _, t := range page.RecognizedText {
+			if withConfidence {
+				fmt.Fprintf(w, "[%.2f] ", t.Confidence)
+			}
+			fmt.Fprintln(w, t.Text)
+		}
+	}
+	return nil
+}
+
+// tableCell keeps text on one line so that it does not break the table.
+func tableCell(s string) string {
+	return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,190 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/encoding"
+)
+
+// The gRPC service is defined in proto/sight.proto. Its few messages are
+// encoded by hand, by the encoding package, rather than by generated code,
+// so that building the tool does not need protoc.
+
+// sightService is the interface of the handler of the service.
+type sightService interface {
+	recognizeRPC(req *recognizeRequest, stream grpc.ServerStream) error
+}
+
+var sightServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sight.v1.Sight",
+	HandlerType: (*sightService)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Recognize",
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			req := new(recognizeRequest)
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			return srv.(sightService).recognizeRPC(req, stream)
+		},
+	}},
+	Metadata: "proto/sight.proto",
+}
+
+// serveGRPC serves the gRPC service on addr.
+func (s *server) serveGRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	gs := grpc.NewServer(grpc.ForceServerCodec(wireCodec{}))
+	gs.RegisterService(&sightServiceDesc, s)
+	s.log.Info("serving gRPC", "address", addr)
+	return gs.Serve(lis)
+}
+
+func (s *server) recognizeRPC(req *recognizeRequest, stream grpc.ServerStream) error {
+	if s.tokens != nil {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		auth := md.Get("authorization")
+		if len(auth) == 0 || !s.validToken(auth[0]) {
+			return status.Error(codes.Unauthenticated, "a valid bearer token is required")
+		}
+	}
+	if len(req.files) == 0 {
+		return status.Error(codes.InvalidArgument, "the request has no files")
+	}
+	if len(req.cfg.ScriptHints) != 0 {
+		if err := sight.ValidateScriptHints(req.cfg.ScriptHints); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	switch req.cfg.Priority {
+	case "", sight.PriorityHigh, sight.PriorityLow:
+	default:
+		return status.Errorf(codes.InvalidArgument, "unsupported priority %q", string(req.cfg.Priority))
+	}
+	var files []sight.File
+	for _, f := range req.files {
+		if f.MimeType != "" {
+			files = append(files, f)
+			continue
+		}
+		routed, err := sight.RouteInput(f.Name, f.Contents)
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "%v: %v", f.Name, err)
+		}
+		for _, r := range routed {
+			r.Pages = f.Pages
+			files = append(files, r)
+		}
+	}
+	pagesChan, err := s.client.RecognizeFiles(req.cfg, files...)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	s.log.Info("started gRPC request", "files", len(files))
+	for page := range pagesChan {
+		s.stats.add(time.Now(), page)
+		if err := stream.SendMsg(pageMessage{page}); err != nil {
+			// The client has gone away; the remaining pages are
+			// received and dropped so that polling stops.
+			for page := range pagesChan {
+				s.stats.add(time.Now(), page)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// wireMessage is a message of the service, which encodes itself.
+type wireMessage interface {
+	marshal() ([]byte, error)
+	unmarshal(b []byte) error
+}
+
+// wireCodec encodes the messages of the service in the protobuf wire
+// format.
+type wireCodec struct{}
+
+func (wireCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return nil, fmt.Errorf("cannot marshal %T", v)
+	}
+	return m.marshal()
+}
+
+func (wireCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(wireMessage)
+	if !ok {
+		return fmt.Errorf("cannot unmarshal %T", v)
+	}
+	return m.unmarshal(data)
+}
+
+func (wireCodec) Name() string {
+	return "proto"
+}
+
+// recognizeRequest is a RecognizeRequest.
+type recognizeRequest struct {
+	files []sight.File
+	cfg   sight.Config
+}
+
+func (r *recognizeRequest) marshal() ([]byte, error) {
+	return nil, fmt.Errorf("RecognizeRequest is only received")
+}
+
+func (r *recognizeRequest) unmarshal(b []byte) error {
+	var req encoding.RecognizeRequest
+	if err := encoding.UnmarshalRecognizeRequest(b, &req); err != nil {
+		return err
+	}
+	r.files, r.cfg = req.Files, req.Config
+	return nil
+}
+
+// pageMessage is a RecognizedPage.
+type pageMessage struct {
+	page sight.RecognizedPage
+}
+
+func (m pageMessage) unmarshal(b []byte) error {
+	return fmt.Errorf("RecognizedPage is only sent")
+}
+
+func (m pageMessage) marshal() ([]byte, error) {
+	return encoding.MarshalProto(m.page)
+}
@@ -0,0 +1,56 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"github.com/siftrics/sight"
+)
+
+// sampleFiles picks up to n of files, spread evenly across the list so that
+// the sample is not drawn from a single directory of a sorted corpus.
+func sampleFiles(files []sight.File, n int) []sight.File {
+	if n >= len(files) {
+		return files
+	}
+	sample := make([]sight.File, n)
+	for i := range sample {
+		sample[i] = files[i*len(files)/n]
+	}
+	return sample
+}
+
+// sampleScriptHints recognizes the text in a sample of n files without
+// script hints and returns the script hints suggested by the characters
+// recognized in it, along with the number of pages sampled.
+func sampleScriptHints(client sight.Recognizer, cfg sight.Config, files []sight.File, n int) ([]string, int, error) {
+	cfg.ScriptHints = make([]string, 0)
+	cfg.DoAutoRotate = false
+	cfg.OnUploadProgress = nil
+	pagesChan, err := client.RecognizeFiles(cfg, sampleFiles(files, n)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	var pages []sight.RecognizedPage
+	for page := range pagesChan {
+		pages = append(pages, page)
+	}
+	return sight.SuggestScriptHints(pages...), len(pages), nil
+}
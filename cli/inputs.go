@@ -0,0 +1,229 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/siftrics/sight"
+)
+
+// expandInputs turns the input arguments given on the command line into a
+// list of files. Plain file paths are kept as-is. Directories are walked
+// recursively and glob patterns (which may contain "**" to match any number
+// of directories) are expanded. URLs of object stores, such as
+// s3://bucket/prefix/, are listed like directories. Files found by walking
+// a directory or by expanding a glob are then filtered through the include
+// and exclude patterns; files named explicitly are never filtered.
+func expandInputs(args, includes, excludes []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		if isRemote(arg) {
+			urls, err := expandRemote(arg)
+			if err != nil {
+				return nil, err
+			}
+			if len(urls) == 1 && urls[0] == arg {
+				files = append(files, arg)
+			} else {
+				files = append(files, filterPaths(urls, includes, excludes)...)
+			}
+			continue
+		}
+		if hasGlobMeta(arg) {
+			matches, err := expandGlob(arg)
+			if err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("the pattern %v did not match any files", arg)
+			}
+			files = append(files, filterPaths(matches, includes, excludes)...)
+			continue
+		}
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		var found []string
+		err = filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.Mode().IsRegular() {
+				found = append(found, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, filterPaths(found, includes, excludes)...)
+	}
+	return files, nil
+}
+
+// filterPaths keeps the paths which match at least one include pattern (or
+// all paths, if there are no include patterns) and no exclude pattern.
+// Archives are kept unless they are excluded, since the include patterns
+// are meant for the files in them; see filterArchive.
+func filterPaths(paths, includes, excludes []string) []string {
+	var kept []string
+	for _, p := range paths {
+		if len(includes) != 0 && !matchesAny(includes, p) && !isArchiveName(p) {
+			continue
+		}
+		if matchesAny(excludes, p) {
+			continue
+		}
+		kept = append(kept, p)
+	}
+	return kept
+}
+
+// archiveExtensions are the extensions of the archives whose files are
+// recognized; see sight.IsArchive.
+var archiveExtensions = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+func isArchiveName(path string) bool {
+	lower := strings.ToLower(path)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterArchive filters the files routed from an archive through the
+// include and exclude patterns, which are matched against their names, e.g.,
+// exports/2020.zip/invoices/1.pdf. Files in archives are filtered even if the
+// archive was named explicitly.
+func filterArchive(files []sight.File, includes, excludes []string) []sight.File {
+	var kept []sight.File
+	for _, f := range files {
+		if len(includes) != 0 && !matchesAny(includes, f.Name) {
+			continue
+		}
+		if matchesAny(excludes, f.Name) {
+			continue
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// matchesAny reports whether path matches any of the patterns. A pattern
+// without a slash is matched against the base name of path (so "*.pdf"
+// matches PDFs at any depth); a pattern with a slash is matched against the
+// whole path and may use "**".
+func matchesAny(patterns []string, path string) bool {
+	slashPath := filepath.ToSlash(path)
+	for _, pattern := range patterns {
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+				return true
+			}
+			continue
+		}
+		if matchSegments(strings.Split(pattern, "/"), strings.Split(slashPath, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// expandGlob expands a glob pattern that may contain "**" path segments. The
+// leading segments without any glob characters are used as the root of the
+// walk, so "scans/**/*.pdf" only walks the scans directory.
+func expandGlob(pattern string) ([]string, error) {
+	segments := strings.Split(filepath.ToSlash(pattern), "/")
+	rootLen := 0
+	for rootLen < len(segments)-1 && !hasGlobMeta(segments[rootLen]) {
+		rootLen++
+	}
+	root := strings.Join(segments[:rootLen], "/")
+	if root == "" {
+		if rootLen > 0 {
+			root = "/"
+		} else {
+			root = "."
+		}
+	}
+	var matches []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if matchSegments(segments[rootLen:], strings.Split(filepath.ToSlash(rel), "/")) {
+			matches = append(matches, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// matchSegments matches a slash-separated path against a slash-separated
+// pattern, segment by segment. A "**" segment matches zero or more path
+// segments.
+func matchSegments(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchSegments(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
@@ -0,0 +1,445 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/siftrics/sight"
+)
+
+const jobsUsage = `usage: ./sight jobs list <job file, ...>
+       ./sight jobs resume <job file> <--prompt-api-key|--api-key-file filename>
+
+jobs list prints the jobs recorded in job files written with --job-file: the ID (or URL)
+of each job, when it was submitted, its files and how many pages of it were received.
+
+jobs resume resumes a run which was started with --job-file and interrupted before all of
+its results were received, e.g., by a network failure. The jobs the run started are polled
+for the pages which were not received yet; nothing is uploaded again, so no page is paid for
+twice. The results of the whole run are written to the output file of the original run, in
+its format. Progress is added to the job file, so an interrupted resume can itself be
+resumed.
+
+examples:
+ ./sight jobs list batch.state
+ ./sight jobs resume batch.state --api-key-file my_api_key.txt
+
+optional flags of jobs resume:
+ [--force]  Overwrite the output file if it exists.
+`
+
+// journalEntry is one line of a job file. A job file starts with the run,
+// followed by the jobs the run started and the pages it received, in the
+// order they happened.
+type journalEntry struct {
+	Run  *journalRun  `json:",omitempty"`
+	Job  *journalJob  `json:",omitempty"`
+	Page *journalPage `json:",omitempty"`
+}
+
+// journalRun is what is needed to write the output of a run.
+type journalRun struct {
+	Output string
+	Format string
+	// Template is the absolute path of the --template file, if any.
+	Template   string `json:",omitempty"`
+	Confidence bool
+	Pretty     bool `json:",omitempty"`
+	// Filter is the --filter expression, if any.
+	Filter   string `json:",omitempty"`
+	Metadata *jobMetadata
+}
+
+// journalJob is a job started by one request. Files are the indices, among
+// the input files of the run, of the files submitted in the request.
+type journalJob struct {
+	Job   sight.Job
+	Files []int
+}
+
+// journalPage is a page received for the job with the URL Job, which is
+// empty if the results were returned immediately. Its FileIndex is that
+// of its input file in the run.
+type journalPage struct {
+	Job  string
+	Page sight.RecognizedPage
+}
+
+// jobJournal appends to a job file. It is safe for concurrent use.
+type jobJournal struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+	err error
+}
+
+// createJobJournal creates a job file for run. It refuses to replace an
+// existing job file, whose run may still need to be resumed.
+func createJobJournal(name string, run *journalRun) (*jobJournal, error) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j := &jobJournal{f: f, enc: json.NewEncoder(f)}
+	j.write(journalEntry{Run: run})
+	return j, j.err
+}
+
+// write appends e as a line. The first error is kept and reported by close,
+// so that a failing job file does not interrupt the run it records.
+func (j *jobJournal) write(e journalEntry) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.err == nil {
+		j.err = j.enc.Encode(e)
+	}
+}
+
+func (j *jobJournal) addJob(job sight.Job, indices []int) {
+	j.write(journalEntry{Job: &journalJob{Job: job, Files: indices}})
+}
+
+// addPage records page, numbered as RecognizeFiles numbered it for the
+// files at indices among the input files of the run.
+func (j *jobJournal) addPage(jobURL string, page sight.RecognizedPage, indices []int) {
+	if page.FileIndex >= 0 && page.FileIndex < len(indices) {
+		page.FileIndex = indices[page.FileIndex]
+	}
+	j.write(journalEntry{Page: &journalPage{Job: jobURL, Page: page}})
+}
+
+func (j *jobJournal) close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.f.Close(); err != nil && j.err == nil {
+		j.err = err
+	}
+	return j.err
+}
+
+// readJobJournal reads a job file. A last line which was only partly
+// written, because the run was interrupted, is ignored.
+func readJobJournal(r io.Reader) (*journalRun, []journalJob, []journalPage, error) {
+	var run *journalRun
+	var jobs []journalJob
+	var pages []journalPage
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64<<20)
+	var lineErr error
+	for lineNumber := 1; sc.Scan(); lineNumber++ {
+		if lineErr != nil {
+			return nil, nil, nil, lineErr
+		}
+		var e journalEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			lineErr = fmt.Errorf("line %v: %v", lineNumber, err)
+			continue
+		}
+		switch {
+		case e.Run != nil:
+			run = e.Run
+		case e.Job != nil:
+			jobs = append(jobs, *e.Job)
+		case e.Page != nil:
+			pages = append(pages, *e.Page)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	if run == nil || run.Metadata == nil {
+		return nil, nil, nil, fmt.Errorf("it does not describe a run")
+	}
+	return run, jobs, pages, nil
+}
+
+func jobsMain(args []string) {
+	if len(args) != 0 {
+		switch args[0] {
+		case "list":
+			jobsListMain(args[1:])
+			return
+		case "resume":
+			jobsResumeMain(args[1:])
+			return
+		}
+	}
+	fmt.Fprint(os.Stderr, jobsUsage)
+	os.Exit(1)
+}
+
+// jobsFlagError reports an error parsing the arguments of a jobs command.
+func jobsFlagError(err error) {
+	if err == flag.ErrHelp {
+		fmt.Fprint(os.Stderr, jobsUsage)
+	} else {
+		fmt.Fprintf(os.Stderr, "error: %v\nRun ./sight jobs -h for more help.\n", err)
+	}
+	os.Exit(1)
+}
+
+func jobsListMain(args []string) {
+	fs := flag.NewFlagSet("jobs list", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	jobFiles, err := parseInterspersed(fs, args)
+	if err != nil {
+		jobsFlagError(err)
+	}
+	if len(jobFiles) == 0 {
+		fmt.Fprintf(os.Stderr, "error: You must specify the job files whose jobs to list.\nRun ./sight jobs -h for more help.\n")
+		os.Exit(1)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "JOB FILE\tJOB\tSUBMITTED\tPAGES\tFILES\n")
+	failed := false
+	for _, jobFile := range jobFiles {
+		f, err := os.Open(jobFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			failed = true
+			continue
+		}
+		run, jobs, received, err := readJobJournal(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v is not a valid job file: %v\n", jobFile, err)
+			failed = true
+			continue
+		}
+		listJobs(tw, jobFile, run, jobs, received)
+	}
+	tw.Flush()
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// listJobs writes a row for each of jobs, from the job file named jobFile,
+// to tw.
+func listJobs(tw io.Writer, jobFile string, run *journalRun, jobs []journalJob, received []journalPage) {
+	pages := make(map[string]int)
+	for _, p := range received {
+		pages[p.Job]++
+	}
+	for _, j := range jobs {
+		id := j.Job.ID
+		if id == "" {
+			id = j.Job.URL
+		}
+		submitted := "-"
+		if j.Job.SubmittedAt != nil {
+			submitted = j.Job.SubmittedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		var names []string
+		for _, i := range j.Files {
+			if i >= 0 && i < len(run.Metadata.Inputs) {
+				names = append(names, run.Metadata.Inputs[i])
+			}
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", jobFile, id, submitted, pages[j.Job.URL], strings.Join(names, ", "))
+	}
+}
+
+func jobsResumeMain(args []string) {
+	var promptApiKey, force bool
+	var apiKeyFile string
+	fs := flag.NewFlagSet("jobs resume", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.BoolVar(&promptApiKey, "prompt-api-key", false, "")
+	fs.StringVar(&apiKeyFile, "api-key-file", "", "")
+	fs.BoolVar(&force, "force", false, "")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		jobsFlagError(err)
+	}
+	if len(positional) == 0 {
+		fmt.Fprintf(os.Stderr, "error: You must specify the job file of the run to resume.\nRun ./sight jobs -h for more help.\n")
+		os.Exit(1)
+	}
+	if len(positional) > 1 {
+		fmt.Fprintf(os.Stderr, "error: unexpected argument %v.\nRun ./sight jobs -h for more help.\n", positional[1])
+		os.Exit(1)
+	}
+	jobFile := positional[0]
+	f, err := os.Open(jobFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	run, jobs, received, err := readJobJournal(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v is not a valid job file: %v\n", jobFile, err)
+		os.Exit(1)
+	}
+	if run.Output != "-" {
+		if _, err := os.Stat(run.Output); err == nil && !force {
+			fmt.Fprintf(os.Stderr, "error: The output file %v already exists. Pass --force to overwrite it.\nRun ./sight jobs -h for more help.\n", run.Output)
+			os.Exit(1)
+		}
+	} else {
+		progress = os.Stderr
+	}
+	client := newClient(loadAPIKey(promptApiKey, apiKeyFile))
+
+	jf, err := os.OpenFile(jobFile, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	journal := &jobJournal{f: jf, enc: json.NewEncoder(jf)}
+	run.Metadata.Jobs = nil
+	for _, j := range jobs {
+		run.Metadata.Jobs = append(run.Metadata.Jobs, j.Job.URL)
+	}
+	pages := make([]sight.RecognizedPage, 0, len(received))
+	for _, p := range received {
+		pages = append(pages, p.Page)
+	}
+	for n, j := range jobs {
+		// ResumeJob expects pages numbered as RecognizeFiles numbered
+		// them, by their position among the files of the request.
+		position := make(map[int]int)
+		for k, i := range j.Files {
+			position[i] = k
+		}
+		var jobPages []sight.RecognizedPage
+		for _, p := range received {
+			if k, ok := position[p.Page.FileIndex]; ok && p.Job == j.Job.URL {
+				p.Page.FileIndex = k
+				jobPages = append(jobPages, p.Page)
+			}
+		}
+		pagesChan, err := client.ResumeJob(j.Job, jobPages...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to resume job %v: %v\n", j.Job.URL, err)
+			continue
+		}
+		numPages := 0
+		for page := range pagesChan {
+			journal.addPage(j.Job.URL, page, j.Files)
+			if page.FileIndex >= 0 && page.FileIndex < len(j.Files) {
+				page.FileIndex = j.Files[page.FileIndex]
+			}
+			pages = append(pages, page)
+			numPages++
+		}
+		fmt.Fprintf(progress, "Job %v of %v: received %v more pages.\n", n+1, len(jobs), numPages)
+	}
+	if err := journal.close(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to update %v: %v\n", jobFile, err)
+	}
+
+	// Pages which failed and were retried are written once, as in the
+	// original run.
+	results := newRunResults()
+	var output []sight.RecognizedPage
+	for _, page := range pages {
+		if results.add(page) {
+			output = append(output, page)
+		}
+	}
+	output = append(output, results.heldPages()...)
+	inputFiles := run.Metadata.Inputs
+	if run.Filter != "" {
+		filter, err := parseFilter(run.Filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: invalid filter in %v: %v\n", jobFile, err)
+			os.Exit(1)
+		}
+		for i, page := range output {
+			if page.FileIndex >= 0 && page.FileIndex < len(inputFiles) {
+				output[i] = filter.apply(inputFiles[page.FileIndex], page)
+			}
+		}
+	}
+	var of io.Writer = os.Stdout
+	var out resultWriter
+	var sink sight.Sink
+	if isSink(run.Output) {
+		if sink, err = openSink(run.Output); err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to open %v: %v\n", run.Output, err)
+			os.Exit(1)
+		}
+	} else if run.Output != "-" {
+		if out, err = createOutput(run.Output); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		of = out
+	}
+	if sink == nil {
+		sink = encodingSink(of, run.Format)
+	}
+	if sink != nil {
+		// The pages written before the run was interrupted are
+		// replaced.
+		for _, page := range output {
+			if err = sink.WritePage(inputFiles[page.FileIndex], page); err != nil {
+				break
+			}
+		}
+		if closeErr := sink.Close(); err == nil {
+			err = closeErr
+		}
+	} else if run.Template != "" {
+		var tmpl *template.Template
+		if tmpl, err = loadTemplate(run.Template); err == nil {
+			err = writeTemplate(of, tmpl, output, inputFiles, run.Metadata.finish())
+		}
+	} else if run.Format == "json" || run.Format == "" {
+		err = writeJSON(of, output, run.Metadata.finish(), run.Pretty)
+	} else {
+		err = writeReadable(of, run.Format, output, inputFiles, run.Confidence)
+	}
+	if err == nil && out != nil {
+		err = out.commit()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to write %v: %v\n", run.Output, err)
+		os.Exit(1)
+	}
+	var failures []fileFailure
+	failed := results.failedFiles(len(inputFiles))
+	for i, inputFile := range inputFiles {
+		if reason, ok := failed[i]; ok {
+			failures = append(failures, fileFailure{inputFile, reason})
+		}
+	}
+	if len(failures) != 0 {
+		writeFailures(os.Stderr, failures, len(inputFiles))
+		if len(failures) == len(inputFiles) {
+			os.Exit(exitTotalFailure)
+		}
+		os.Exit(exitPartialFailure)
+	}
+}
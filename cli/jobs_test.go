@@ -0,0 +1,66 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siftrics/sight"
+)
+
+func TestListJobs(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "batch.state")
+	run := &journalRun{Output: "out.json", Format: "json", Metadata: &jobMetadata{Inputs: []string{"a.pdf", "b.png", "c.pdf"}}}
+	j, err := createJobJournal(name, run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	submitted := time.Date(2020, 3, 1, 12, 0, 0, 0, time.Local)
+	j.addJob(sight.Job{URL: "https://siftrics.com/api/sight/1", ID: "job-1", SubmittedAt: &submitted}, []int{0, 2})
+	j.addJob(sight.Job{URL: "https://siftrics.com/api/sight/2"}, []int{1})
+	j.addPage("https://siftrics.com/api/sight/1", sight.RecognizedPage{FileIndex: 0, PageNumber: 1}, []int{0, 2})
+	j.addPage("https://siftrics.com/api/sight/1", sight.RecognizedPage{FileIndex: 1, PageNumber: 1}, []int{0, 2})
+	if err := j.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	run, jobs, received, err := readJobJournal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	listJobs(&buf, "batch.state", run, jobs, received)
+	want := "batch.state\tjob-1\t2020-03-01 12:00:00\t2\ta.pdf, c.pdf\n" +
+		"batch.state\thttps://siftrics.com/api/sight/2\t-\t0\tb.png\n"
+	if got := buf.String(); got != want {
+		t.Errorf("listJobs wrote\n%v\nwant\n%v", strings.Replace(got, "\t", "|", -1), strings.Replace(want, "\t", "|", -1))
+	}
+}
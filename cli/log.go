@@ -0,0 +1,107 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+func (l logLevel) String() string {
+	switch l {
+	case levelDebug:
+		return "debug"
+	case levelInfo:
+		return "info"
+	case levelWarn:
+		return "warn"
+	}
+	return "error"
+}
+
+// cliLogger implements sight.Logger, writing to stderr either as text
+// ("time level message key=value ...") or as one JSON object per line.
+type cliLogger struct {
+	mu       sync.Mutex
+	minLevel logLevel
+	json     bool
+}
+
+func (l *cliLogger) Debug(msg string, keyvals ...interface{}) { l.log(levelDebug, msg, keyvals) }
+func (l *cliLogger) Info(msg string, keyvals ...interface{})  { l.log(levelInfo, msg, keyvals) }
+func (l *cliLogger) Warn(msg string, keyvals ...interface{})  { l.log(levelWarn, msg, keyvals) }
+func (l *cliLogger) Error(msg string, keyvals ...interface{}) { l.log(levelError, msg, keyvals) }
+
+func (l *cliLogger) log(level logLevel, msg string, keyvals []interface{}) {
+	if level < l.minLevel {
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	var line string
+	if l.json {
+		m := map[string]interface{}{"time": now, "level": level.String(), "msg": msg}
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			v := keyvals[i+1]
+			if err, ok := v.(error); ok {
+				v = err.Error()
+			}
+			m[fmt.Sprint(keyvals[i])] = v
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			b = []byte(fmt.Sprintf(`{"time":%q,"level":"error","msg":"failed to encode log message"}`, now))
+		}
+		line = string(b) + "\n"
+	} else {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "%v %v %v", now, strings.ToUpper(level.String()), msg)
+		for i := 0; i+1 < len(keyvals); i += 2 {
+			v := fmt.Sprint(keyvals[i+1])
+			if strings.ContainsAny(v, " \"=") {
+				v = fmt.Sprintf("%q", v)
+			}
+			fmt.Fprintf(&sb, " %v=%v", keyvals[i], v)
+		}
+		line = sb.String() + "\n"
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bar != nil {
+		bar.interrupt(func() {
+			fmt.Fprint(os.Stderr, line)
+		})
+	} else {
+		fmt.Fprint(os.Stderr, line)
+	}
+}
@@ -0,0 +1,501 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+
+	"github.com/siftrics/sight"
+)
+
+const mailWatchUsage = `usage: ./sight mail-watch <imap server:port> <--user name> <--password-file filename> <--prompt-api-key|--api-key-file filename> <-o output directory>
+
+Polls a folder of an IMAP mailbox and recognizes text in the PDF and image attachments
+of every unread email in it. The results for each email are written to
+<output directory>/<UID validity>-<UID>.json, along with the sender, subject and date of
+the email. The email is then marked as read. Emails without attachments which can be
+submitted are marked as read and skipped.
+
+The connection to the IMAP server uses TLS. The password is read from the first line
+of the password file.
+
+example:
+ ./sight mail-watch imap.example.com:993 --user invoices@example.com --password-file pw.txt \
+   -o results/ --move-to Processed --api-key-file my_api_key.txt
+
+optional flags:
+ [--folder name]         The folder to poll. Defaults to INBOX.
+ [--poll seconds]        The time between checks for new email. Defaults to 60.
+ [--once]                Check for new email once and exit, e.g., to run from cron.
+ [--move-to folder]      Move each processed email into this folder.
+ [--reply-smtp address]  Reply to the sender of each email with its results, sent through
+                           the SMTP server at this server:port, which is logged into with
+                           the same user name and password.
+ [--reply-from address]  The sender of the replies. Defaults to the user name.
+ [-w|--words]            Return word-level bounding boxes.
+ [-e|--obey-exif]        Use EXIF orientation for bounding box coordinate system.
+ [-r|--auto-rotate]      Rotate images so the majority of the text is upright.
+ [-s|--script-hints]     Comma-delimited script hint codes, e.g., latin,cyrillic.
+ [-v|--verbose]          Log every polling attempt and other details.
+ [--log-json]            Write log messages as JSON objects, one per line.
+`
+
+// mailWatchMain implements "sight mail-watch", which recognizes text in the
+// attachments of emails as they arrive in an IMAP folder.
+func mailWatchMain(args []string) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stderr, mailWatchUsage)
+		os.Exit(1)
+	}
+	cfg := sight.Config{MakeSentences: true, ScriptHints: make([]string, 0)}
+	logger := &cliLogger{minLevel: levelInfo}
+	promptApiKey, once := false, false
+	var w mailWatcher
+	var apiKeyFile, passwordFile string
+	w.folder = "INBOX"
+	poll := 60 * time.Second
+	for i := 0; i < len(args); i++ {
+		s := args[i]
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: %v was specified but no value came after it.\nRun ./sight mail-watch -h for more help.\n", s)
+				os.Exit(1)
+			}
+			i++
+			return args[i]
+		}
+		switch s {
+		case "--prompt-api-key":
+			promptApiKey = true
+		case "--api-key-file":
+			apiKeyFile = value()
+		case "--user":
+			w.user = value()
+		case "--password-file":
+			passwordFile = value()
+		case "-o", "--output":
+			w.outputDir = value()
+		case "--folder":
+			w.folder = value()
+		case "--poll":
+			var seconds float64
+			if _, err := fmt.Sscan(value(), &seconds); err != nil || seconds <= 0 {
+				fmt.Fprintf(os.Stderr, "error: --poll must be followed by a positive number of seconds.\n")
+				os.Exit(1)
+			}
+			poll = time.Duration(seconds * float64(time.Second))
+		case "--once":
+			once = true
+		case "--move-to":
+			w.moveTo = value()
+		case "--reply-smtp":
+			w.smtpAddr = value()
+		case "--reply-from":
+			w.replyFrom = value()
+		case "-w", "--words":
+			cfg.MakeSentences = false
+		case "-e", "--obey-exif":
+			cfg.DoExifRotate = true
+		case "-r", "--auto-rotate":
+			cfg.DoAutoRotate = true
+		case "-s", "--script-hints":
+			cfg.ScriptHints = strings.Split(value(), ",")
+			if err := sight.ValidateScriptHints(cfg.ScriptHints); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		case "-v", "--verbose":
+			logger.minLevel = levelDebug
+		case "--log-json":
+			logger.json = true
+		default:
+			if w.addr != "" || strings.HasPrefix(s, "-") {
+				fmt.Fprintf(os.Stderr, "error: unexpected argument %v.\nRun ./sight mail-watch -h for more help.\n", s)
+				os.Exit(1)
+			}
+			w.addr = s
+		}
+	}
+	if w.addr == "" || w.user == "" || passwordFile == "" || w.outputDir == "" {
+		fmt.Fprintf(os.Stderr, "error: You must specify an IMAP server, a user name (--user), a password file (--password-file) and an output directory (-o).\nRun ./sight mail-watch -h for more help.\n")
+		os.Exit(1)
+	}
+	if _, _, err := net.SplitHostPort(w.addr); err != nil {
+		fmt.Fprintf(os.Stderr, "error: the IMAP server must be given as server:port, e.g., imap.example.com:993.\n")
+		os.Exit(1)
+	}
+	if w.smtpAddr != "" {
+		if _, _, err := net.SplitHostPort(w.smtpAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "error: --reply-smtp must be followed by server:port, e.g., smtp.example.com:587.\n")
+			os.Exit(1)
+		}
+	}
+	if w.replyFrom == "" {
+		w.replyFrom = w.user
+	}
+	password, err := ioutil.ReadFile(passwordFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: failed to read the password file: %v\n", err)
+		os.Exit(1)
+	}
+	w.password = strings.TrimSpace(strings.SplitN(string(password), "\n", 2)[0])
+	if err := os.MkdirAll(w.outputDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	apiKey := loadAPIKey(promptApiKey, apiKeyFile)
+	w.client = newClient(apiKey, sight.WithLogger(logger))
+	w.cfg = cfg
+	w.log = logger
+	if once {
+		if err := w.check(); err != nil {
+			logger.Error("failed to check for new email", "server", w.addr, "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	w.run(poll)
+}
+
+type mailWatcher struct {
+	client    sight.Recognizer
+	cfg       sight.Config
+	log       *cliLogger
+	addr      string
+	user      string
+	password  string
+	folder    string
+	outputDir string
+	moveTo    string
+	smtpAddr  string
+	replyFrom string
+}
+
+// mailResults is the output file of an email.
+type mailResults struct {
+	Pages    []sight.RecognizedPage
+	Metadata *jobMetadata
+	Email    emailInfo
+}
+
+// emailInfo identifies the email whose attachments were recognized.
+type emailInfo struct {
+	From      string
+	Subject   string
+	Date      string
+	MessageID string
+}
+
+// run checks for new email every poll interval until interrupted. Failures
+// to reach the server are logged and tried again at the next check.
+func (w *mailWatcher) run(poll time.Duration) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	w.log.Info("watching for new email", "server", w.addr, "folder", w.folder, "poll", poll)
+	for {
+		if err := w.check(); err != nil {
+			w.log.Error("failed to check for new email", "server", w.addr, "error", err)
+		}
+		select {
+		case <-interrupt:
+			w.log.Info("interrupted; stopping")
+			return
+		case <-time.After(poll):
+		}
+	}
+}
+
+// check logs in to the server and processes every unread email in the
+// folder.
+func (w *mailWatcher) check() error {
+	c, err := client.DialTLS(w.addr, nil)
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+	if err := c.Login(w.user, w.password); err != nil {
+		return err
+	}
+	mbox, err := c.Select(w.folder, false)
+	if err != nil {
+		return err
+	}
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag}
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return err
+	}
+	w.log.Debug("checked for new email", "folder", w.folder, "unread", len(uids))
+	for _, uid := range uids {
+		if err := w.process(c, mbox.UidValidity, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// process recognizes the text in the attachments of one email, writes the
+// results and marks the email as read. An email which could not be
+// recognized is left unread, to be tried again at the next check. The
+// returned error is that of the connection to the server; other failures
+// are logged.
+func (w *mailWatcher) process(c *client.Client, validity, uid uint32) error {
+	name := fmt.Sprintf("%v-%v", validity, uid)
+	dest := filepath.Join(w.outputDir, name+".json")
+	if _, err := os.Stat(dest); err == nil {
+		// The results were written but the email was not marked as read,
+		// e.g., because the connection was lost.
+		w.log.Debug("skipping email whose results already exist", "uid", uid, "output", dest)
+		return w.finish(c, uid)
+	}
+	raw, err := fetchMessage(c, uid)
+	if err != nil {
+		return err
+	}
+	info := emailInfo{}
+	var header mail.Header
+	if msg, err := mail.ReadMessage(bytes.NewReader(raw)); err == nil {
+		header = msg.Header
+		dec := new(mime.WordDecoder)
+		info.From = header.Get("From")
+		if info.Subject, err = dec.DecodeHeader(header.Get("Subject")); err != nil {
+			info.Subject = header.Get("Subject")
+		}
+		info.Date = header.Get("Date")
+		info.MessageID = header.Get("Message-Id")
+	}
+	files, err := sight.RouteInput(name+".eml", raw)
+	if err != nil {
+		w.log.Warn("skipping email which has no attachments that can be submitted", "uid", uid, "from", info.From, "subject", info.Subject, "error", err)
+		return w.finish(c, uid)
+	}
+	inputs := make([]string, len(files))
+	for i, f := range files {
+		inputs[i] = f.Name
+	}
+	cfg := w.cfg
+	metadata := newJobMetadata(cfg, inputs)
+	cfg.OnJobStarted = metadata.addJob
+	pagesChan, err := w.client.RecognizeFiles(cfg, files...)
+	if err != nil {
+		w.log.Error("failed to recognize the attachments of an email", "uid", uid, "subject", info.Subject, "error", err)
+		return nil
+	}
+	results := mailResults{Email: info}
+	for page := range pagesChan {
+		results.Pages = append(results.Pages, page)
+	}
+	results.Metadata = metadata.finish()
+	buf, err := json.Marshal(&results)
+	if err != nil {
+		w.log.Error("failed to serialize JSON", "uid", uid, "error", err)
+		return nil
+	}
+	f, err := createAtomic(dest)
+	if err == nil {
+		if _, err = f.Write(buf); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		} else {
+			err = f.commit()
+		}
+	}
+	if err != nil {
+		w.log.Error("failed to write results", "uid", uid, "output", dest, "error", err)
+		return nil
+	}
+	w.log.Info("recognized email", "uid", uid, "from", info.From, "subject", info.Subject, "attachments", len(files), "pages", len(results.Pages), "output", dest)
+	if w.smtpAddr != "" && header != nil {
+		if err := w.reply(header, inputs, results.Pages, buf); err != nil {
+			w.log.Warn("failed to reply to email", "uid", uid, "server", w.smtpAddr, "error", err)
+		}
+	}
+	return w.finish(c, uid)
+}
+
+// fetchMessage returns the whole of the email with the given UID, without
+// marking it as read.
+func fetchMessage(c *client.Client, uid uint32) ([]byte, error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- c.UidFetch(seqset, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages)
+	}()
+	var raw []byte
+	var readErr error
+	for msg := range messages {
+		if body := msg.GetBody(section); body != nil && raw == nil && readErr == nil {
+			raw, readErr = ioutil.ReadAll(body)
+		}
+	}
+	if err := <-done; err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("the server returned no email with UID %v", uid)
+	}
+	return raw, nil
+}
+
+// finish marks the email with the given UID as read and, with --move-to,
+// moves it out of the folder.
+func (w *mailWatcher) finish(c *client.Client, uid uint32) error {
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(uid)
+	if err := c.UidStore(seqset, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.SeenFlag}, nil); err != nil {
+		return err
+	}
+	if w.moveTo != "" {
+		if err := c.UidMove(seqset, w.moveTo); err != nil {
+			return fmt.Errorf("failed to move email to %v: %v", w.moveTo, err)
+		}
+	}
+	return nil
+}
+
+// reply sends the sender of an email a summary of its results, with the
+// output file attached.
+func (w *mailWatcher) reply(header mail.Header, inputs []string, pages []sight.RecognizedPage, results []byte) error {
+	to, msg, err := w.replyMessage(header, inputs, pages, results)
+	if err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(w.smtpAddr)
+	auth := smtp.PlainAuth("", w.user, w.password, host)
+	from := w.replyFrom
+	if addr, err := mail.ParseAddress(from); err == nil {
+		from = addr.Address
+	}
+	return smtp.SendMail(w.smtpAddr, auth, from, []string{to}, msg)
+}
+
+// replyMessage returns the address to reply to and the reply for reply.
+func (w *mailWatcher) replyMessage(header mail.Header, inputs []string, pages []sight.RecognizedPage, results []byte) (string, []byte, error) {
+	replyTo := header.Get("Reply-To")
+	if replyTo == "" {
+		replyTo = header.Get("From")
+	}
+	to, err := mail.ParseAddress(replyTo)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid sender address %q: %v", replyTo, err)
+	}
+	subject := header.Get("Subject")
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(subject); err == nil {
+		subject = decoded
+	}
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = "Re: " + subject
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fmt.Fprintf(&body, "From: %v\r\n", w.replyFrom)
+	fmt.Fprintf(&body, "To: %v\r\n", to.String())
+	fmt.Fprintf(&body, "Subject: %v\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&body, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	if id := header.Get("Message-Id"); id != "" {
+		fmt.Fprintf(&body, "In-Reply-To: %v\r\n", id)
+		fmt.Fprintf(&body, "References: %v\r\n", strings.TrimSpace(header.Get("References")+" "+id))
+	}
+	fmt.Fprintf(&body, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&body, "Content-Type: multipart/mixed; boundary=%v\r\n\r\n", mw.Boundary())
+
+	part, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return "", nil, err
+	}
+	pageCounts := make([]int, len(inputs))
+	pageErrors := make([]int, len(inputs))
+	for _, p := range pages {
+		if p.FileIndex < 0 || p.FileIndex >= len(inputs) {
+			continue
+		}
+		pageCounts[p.FileIndex]++
+		if p.Error != "" {
+			pageErrors[p.FileIndex]++
+		}
+	}
+	fmt.Fprintf(part, "The text of %v attachment(s) was recognized:\r\n\r\n", len(inputs))
+	for i, name := range inputs {
+		fmt.Fprintf(part, " %v: %v page(s)", filepath.Base(name), pageCounts[i])
+		if pageErrors[i] != 0 {
+			fmt.Fprintf(part, ", %v with errors", pageErrors[i])
+		}
+		fmt.Fprintf(part, "\r\n")
+	}
+	fmt.Fprintf(part, "\r\nThe results are attached.\r\n")
+
+	part, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"application/json"},
+		"Content-Disposition":       {`attachment; filename="results.json"`},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if err := writeBase64Lines(part, results); err != nil {
+		return "", nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return "", nil, err
+	}
+	return to.Address, body.Bytes(), nil
+}
+
+// writeBase64Lines writes data base64-encoded in lines of 76 characters, as
+// MIME requires.
+func writeBase64Lines(w io.Writer, data []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
+}
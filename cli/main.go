@@ -21,37 +21,347 @@
 package main
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
+	"text/template"
+	"time"
+	"unicode/utf8"
 
 	"golang.org/x/crypto/ssh/terminal"
 
 	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/layout"
+	"github.com/siftrics/sight/normalize"
+	"github.com/siftrics/sight/pii"
 )
 
-func main() {
-	containsHelp := false
-	for _, s := range os.Args[1:] {
-		if s == "-h" || s == "--help" {
-			containsHelp = true
-			break
+// progress is where human-facing progress messages are written. It is
+// stderr when the results are written to stdout.
+var progress io.Writer = os.Stdout
+
+// bar is the progress bar, or nil if progress is printed line by line.
+var bar *progressBar
+
+// statusf prints a progress message, above the progress bar if there is one.
+func statusf(format string, args ...interface{}) {
+	if bar != nil {
+		bar.printf(format, args...)
+	} else {
+		fmt.Fprintf(progress, format, args...)
+	}
+}
+
+// redactText is whether recognized text must be kept out of everything but
+// the output file. Messages and reports quote recognized text through
+// loggable.
+var redactText = false
+
+// loggable returns s, recognized text, or a placeholder if redactText is set.
+func loggable(s string) string {
+	if redactText {
+		return fmt.Sprintf("[%v characters redacted]", utf8.RuneCountInString(s))
+	}
+	return s
+}
+
+// recognizeOptions are the options of recognize other than those of its
+// sight.Config.
+type recognizeOptions struct {
+	promptApiKey       bool
+	apiKeyFile         string
+	outputFile         string
+	includes, excludes []string
+	annotate           annotateOptions
+	redact             redactOptions
+	statsFile          string
+	readStdin          bool
+	noProgress         bool
+	printSummary       bool
+	quiet              bool
+	debugHTTP          bool
+	skipUnsupported    bool
+	pretty             bool
+	logger             *cliLogger
+	stdinMimeType      string
+	sampleSize         int
+	applySampledHints  bool
+	retryFailed        int
+	parallel           int
+	jobFile, cacheDir  string
+	previews           previewOptions
+	requestsPerSecond  float64
+	pagesPerMinute     float64
+	pollsPerSecond     float64
+	maxConcurrentPolls int
+	region             sight.Region
+	// pageSelections maps input files to the pages selected with --pages;
+	// the selection for "" applies to every PDF without one of its own.
+	pageSelections map[string][]int
+	dryRunOnly     bool
+	format         string
+	templateFile   string
+	tmpl           *template.Template
+	filterExpr     string
+	filter         *textFilter
+	showConfidence bool
+	force          bool
+	normalization  normalize.Mode
+}
+
+// newRecognizeFlags returns the flags of recognize, which set cfg and o.
+// The errors of their values are worded to follow "invalid value for
+// flag: ".
+func newRecognizeFlags(cfg *sight.Config, o *recognizeOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("recognize", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	fs.BoolVar(&o.promptApiKey, "prompt-api-key", false, "")
+	fs.StringVar(&o.apiKeyFile, "api-key-file", "", "")
+	fs.Func("output", "", func(s string) error {
+		if o.outputFile != "" {
+			return errors.New("the output file was given twice but should only be given once")
+		}
+		o.outputFile = s
+		return nil
+	})
+	alias(fs, "o", "output")
+	fs.Func("script-hints", "", func(s string) error {
+		if len(cfg.ScriptHints) != 0 {
+			return errors.New("script hints were given twice but should only be given once")
+		}
+		cfg.ScriptHints = strings.Split(s, ",")
+		return sight.ValidateScriptHints(cfg.ScriptHints)
+	})
+	alias(fs, "s", "script-hints")
+	fs.Func("suggest-script-hints", "", positiveInt(&o.sampleSize, "files to sample"))
+	fs.Func("auto-script-hints", "", func(s string) error {
+		o.applySampledHints = true
+		return positiveInt(&o.sampleSize, "files to sample")(s)
+	})
+	fs.Func("pages", "", func(s string) error {
+		file, ranges := "", s
+		if j := strings.LastIndex(ranges, ":"); j >= 0 {
+			file, ranges = selectionKey(ranges[:j]), ranges[j+1:]
+		}
+		pages, err := sight.ParsePageRanges(ranges)
+		if err != nil {
+			return err
+		}
+		o.pageSelections[file] = pages
+		return nil
+	})
+	fs.Func("retry-failed", "", func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return errors.New("must be a number of retries")
+		}
+		o.retryFailed = n
+		return nil
+	})
+	fs.Func("parallel", "", positiveInt(&o.parallel, "requests"))
+	fs.Func("requests-per-second", "", positiveFloat(&o.requestsPerSecond))
+	fs.Func("pages-per-minute", "", positiveFloat(&o.pagesPerMinute))
+	fs.Func("polls-per-second", "", positiveFloat(&o.pollsPerSecond))
+	fs.Func("max-concurrent-polls", "", positiveInt(&o.maxConcurrentPolls, "polls"))
+	fs.Func("priority", "", func(s string) error {
+		cfg.Priority = sight.Priority(s)
+		if cfg.Priority != sight.PriorityHigh && cfg.Priority != sight.PriorityLow {
+			return errors.New("must be high or low")
+		}
+		return nil
+	})
+	fs.Func("tag", "", func(s string) error {
+		eq := strings.Index(s, "=")
+		if eq <= 0 {
+			return errors.New("must be key=value, e.g., --tag tenant=acme")
+		}
+		if cfg.Tags == nil {
+			cfg.Tags = make(map[string]string)
 		}
+		cfg.Tags[s[:eq]] = s[eq+1:]
+		return nil
+	})
+	fs.Func("region", "", func(s string) error {
+		o.region = sight.Region(s)
+		if _, ok := sight.RegionEndpoints[o.region]; !ok {
+			return errors.New("must be eu or us")
+		}
+		return nil
+	})
+	fs.Func("job-file", "", func(s string) error {
+		o.jobFile = s
+		cfg.DoAsync = true
+		return nil
+	})
+	fs.StringVar(&o.previews.dir, "previews", "", "")
+	fs.Func("preview-size", "", func(s string) error {
+		var n int
+		if err := positiveInt(&n, "pixels")(s); err != nil {
+			return err
+		}
+		o.previews.opts.MaxWidth, o.previews.opts.MaxHeight = n, n
+		return nil
+	})
+	fs.BoolVar(&o.previews.opts.Boxes, "preview-boxes", false, "")
+	fs.StringVar(&o.cacheDir, "cache", "", "")
+	fs.Func("pdf-passwords", "", func(s string) error {
+		passwords, err := loadPDFPasswords(s)
+		cfg.PDFPasswords = passwords
+		return err
+	})
+	fs.Func("normalize", "", func(s string) error {
+		m, err := normalize.Parse(s)
+		o.normalization = m
+		return err
+	})
+	fs.Func("vocabulary", "", func(s string) error {
+		terms, err := loadVocabulary(s)
+		cfg.Vocabulary = terms
+		return err
+	})
+	fs.Func("include", "", func(s string) error {
+		o.includes = append(o.includes, s)
+		return nil
+	})
+	fs.Func("exclude", "", func(s string) error {
+		o.excludes = append(o.excludes, s)
+		return nil
+	})
+	fs.Var(setFlag(func() { o.logger.minLevel = levelDebug }), "verbose", "")
+	alias(fs, "v", "verbose")
+	fs.Var(setFlag(func() {
+		o.quiet = true
+		o.logger.minLevel = levelError
+	}), "quiet", "")
+	alias(fs, "q", "quiet")
+	fs.BoolVar(&o.logger.json, "log-json", false, "")
+	fs.BoolVar(&o.debugHTTP, "debug-http", false, "")
+	fs.BoolVar(&o.skipUnsupported, "skip-unsupported", false, "")
+	fs.BoolVar(&o.pretty, "pretty", false, "")
+	fs.Func("max-pages", "", positiveInt(&cfg.MaxPagesPerFile, "pages"))
+	fs.BoolVar(&cfg.TruncateLongFiles, "truncate", false, "")
+	fs.BoolVar(&o.dryRunOnly, "dry-run", false, "")
+	fs.Func("format", "", func(s string) error {
+		if !outputFormats[s] {
+			return errors.New("use json, text, table, prose, protobuf or msgpack")
+		}
+		o.format = s
+		return nil
+	})
+	fs.Func("template", "", func(s string) error {
+		var err error
+		o.templateFile = s
+		o.tmpl, err = loadTemplate(s)
+		return err
+	})
+	fs.Func("filter", "", func(s string) error {
+		var err error
+		o.filterExpr = s
+		o.filter, err = parseFilter(s)
+		return err
+	})
+	fs.BoolVar(&o.showConfidence, "confidence", false, "")
+	fs.BoolVar(&o.force, "force", false, "")
+	fs.BoolVar(&o.printSummary, "summary", false, "")
+	fs.BoolVar(&o.noProgress, "no-progress", false, "")
+	fs.BoolVar(&redactText, "redact-text", false, "")
+	fs.BoolVar(&o.readStdin, "stdin", false, "")
+	fs.Func("mime", "", func(s string) error {
+		if !sight.SupportedMimeTypes[s] {
+			return errors.New("not a supported MIME type")
+		}
+		o.stdinMimeType = s
+		return nil
+	})
+	fs.StringVar(&o.statsFile, "stats-csv", "", "")
+	fs.Func("annotate-match", "", func(s string) error {
+		var err error
+		o.annotate.match, err = regexp.Compile(s)
+		return err
+	})
+	fs.Float64Var(&o.annotate.belowConfidence, "annotate-below", 0, "")
+	fs.Func("annotate-dpi", "", positiveFloat(&o.annotate.dpi))
+	fs.Func("redact", "", func(s string) error {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return err
+		}
+		o.redact.patterns = append(o.redact.patterns, re)
+		return nil
+	})
+	fs.Func("redact-pii", "", func(s string) error {
+		detectors, err := pii.ParseCategories(s)
+		o.redact.detectors = append(o.redact.detectors, detectors...)
+		return err
+	})
+	fs.Var(setFlag(func() { cfg.MakeSentences = false }), "words", "")
+	alias(fs, "w", "words")
+	fs.BoolVar(&cfg.DoExifRotate, "obey-exif", false, "")
+	alias(fs, "e", "obey-exif")
+	fs.BoolVar(&cfg.DoAutoRotate, "auto-rotate", false, "")
+	alias(fs, "r", "auto-rotate")
+	fs.BoolVar(&cfg.DetectLanguage, "detect-language", false, "")
+	fs.BoolVar(&cfg.DetectBarcodes, "barcodes", false, "")
+	fs.Var(setFlag(func() {
+		cfg.PostProcessors = append(cfg.PostProcessors, sight.PostProcessorFunc(layout.ReadingOrder))
+	}), "reading-order", "")
+	fs.BoolVar(&cfg.SkipTextPDFs, "skip-text-pdfs", false, "")
+	return fs
+}
+
+// selectionKey returns the key of the input name in pageSelections: its
+// cleaned path, or name itself if it is the URL of a remote object, whose
+// slashes filepath.Clean would collapse.
+func selectionKey(name string) string {
+	if isRemote(name) {
+		return name
 	}
-	if len(os.Args) == 1 || containsHelp {
-		fmt.Fprintf(os.Stderr, `usage: ./sight <--prompt-api-key|--api-key-file filename> <-o output filename> <image/document, ...>
+	return filepath.Clean(name)
+}
+
+// selectPages returns f, a file of the input name, with the pages selected
+// for it with --pages, or an error if it has more than maxPages of them.
+func (o *recognizeOptions) selectPages(name string, f sight.File, maxPages int) (sight.File, error) {
+	if f.MimeType == "application/pdf" {
+		if pages, ok := o.pageSelections[selectionKey(name)]; ok {
+			f.Pages = pages
+		} else {
+			f.Pages = o.pageSelections[""]
+		}
+	}
+	return f, checkPages(f, maxPages)
+}
+
+const recognizeUsage = `usage: ./sight [recognize] <--prompt-api-key|--api-key-file filename> <-o|--output filename> <image/document, ...>
 
 examples:
  ./sight receipt_1.jpg receipt_2.pdf -o recognized_text.json --prompt-api-key invoice.png
  ./sight invoice.pdf receipt.png -o recognized_text.json --api-key-file my_api_key.txt
+ ./sight invoice.pdf -o - --api-key-file my_api_key.txt | jq .
+
+Flags may come before, between or after the files. Every argument after -- is a file, e.g.,
+./sight -o out.json --api-key-file key.txt -- jobs -scan.pdf recognizes the files "jobs" and
+"-scan.pdf", whose names would otherwise be taken for a command and a flag.
+
+Use -o - to write the recognized text to stdout; progress messages then go to stderr.
+An existing output file is not overwritten unless --force is given, and the output file
+only appears once the run is complete.
+Use -o sqlite://results.db to add the pages and sentences (or words) to tables in a SQLite
+database instead, indexed by text and file, as each page is received, and the metadata of
+the run and its jobs to the runs and jobs tables, or
+-o elasticsearch+http://localhost:9200/documents to index them in Elasticsearch or
+OpenSearch.
 
 optional flags:
+ [--force]           Overwrite the output file if it exists.
  [-w|--words]        Return word-level bounding boxes instead of coalescing them
                        into sentence-level bounding boxes.
  [-e|--obey-exif]    Use EXIF orientation for bounding box coordinate system.
@@ -62,206 +372,575 @@ optional flags:
                        E.g., --script-hints latin,thai,cyrillic
 
                        See https://siftrics.com/docs/sight.html for a full list of script codes.
-`)
-		os.Exit(1)
-	}
+ [--detect-language] Add the language of each sentence (or word) to the output, as a BCP 47
+                       tag, guessed from its script if the Sight API does not report it.
+ [--barcodes]        Add the QR codes and Code 128 and Code 39 barcodes on each page to the
+                       output, e.g., to split batches of scans at separator sheets.
+ [--normalize list]   Normalize the recognized text in the comma-delimited ways: nfc (Unicode
+                       Normalization Form C), space (collapse exotic whitespace), punctuation
+                       (straighten quotes and dashes) and zero-width (strip zero-width
+                       characters), or all of them.
+ [--vocabulary filename] Correct words which nearly match a term in this file, one per
+                       line, such as part numbers and product names, to the term.
+ [--reading-order]   Order the text of each page line by line and column by column, so
+                       that the lines of newspaper and two-column pages are not interleaved.
+ [--skip-text-pdfs]  Extract the text of PDF pages which already have a text layer, e.g.,
+                       born-digital invoices, instead of submitting them. Only scanned
+                       pages are submitted and paid for.
+ [--pdf-passwords filename] Decrypt password-protected PDFs before submitting them,
+                       with the passwords in a CSV file of file,password rows. Rows
+                       with an empty file are tried for every PDF. Encrypted PDFs which
+                       none of the passwords opens are reported as failures.
+
+Reading from stdin:
+ [--stdin]           Recognize text in a single image or document read from stdin,
+                       in addition to any other inputs. Cannot be combined with
+                       --prompt-api-key.
+ [--mime type]       The MIME type of the data read from stdin (application/pdf,
+                       image/png, image/jpeg, image/gif or image/bmp). If it is not
+                       given, it is inferred from the data.
 
+                       E.g., cat page.png | ./sight --stdin --mime image/png -o out.json --api-key-file key.txt
+
+Inputs are told apart by their contents rather than their extensions. PDFs and
+images are submitted as they are, emails (e.g., .eml files) are replaced by
+their attachments, and ZIP, tar and .tar.gz archives are replaced by the files in them,
+named e.g. export.zip/invoices/1.pdf. TIFF images and office documents must be
+converted to PDF first.
+
+Inputs may be files, directories, or glob patterns. Directories are searched
+recursively and glob patterns may use ** to match any number of directories,
+e.g., 'scans/**/*.pdf' (quote patterns so your shell does not expand them).
+Inputs may also be objects in Amazon S3 (s3://bucket/scans/), Google Cloud Storage
+(gs://bucket/scans/) or Azure Blob Storage (az://account/container/scans/), which are
+listed like directories and read without touching the local disk, and the output file may
+be such an object too. Credentials are found as by each provider's own tools.
+
+ [--include pattern] Only use files found in directories, by glob patterns or in
+                       archives which match the pattern. May be given more than once.
+ [--exclude pattern] Skip files found in directories, by glob patterns or in
+                       archives which match the pattern. May be given more than once.
+
+                       Patterns without a slash match file names, e.g., --exclude '*.gif'.
+                       Patterns with a slash match whole paths, e.g., --include 'scans/2020/**'
+                       or --include 'export.zip/invoices/**'.
+ [--skip-unsupported] Skip inputs of types the Sight API does not accept, such as .txt,
+                       .docx and .xlsx files, listing them on stderr, rather than counting
+                       them as failures, which makes the exit status nonzero.
+
+Output format:
+ [--format format]   The format of the output: json (the default), text, table, prose,
+                       protobuf or msgpack. text prints the recognized text grouped by file
+                       and page, table prints one row per sentence (or word, with -w), for
+                       reading in a terminal, e.g., -o - --format table. prose prints each
+                       page as paragraphs, with words hyphenated across lines joined, for
+                       NLP pipelines. protobuf writes each page as a length-delimited
+                       RecognizedPage message of proto/sight.proto, and msgpack as a
+                       MessagePack map, which are far smaller than json for high-volume
+                       pipelines.
+ [--confidence]      With --format text or table, show the confidence of each sentence.
+ [--pretty]          With --format json, indent the output. Pages are always sorted by input
+                       file and page number, so the outputs of two runs can be diffed.
+ [--template filename] Render the results with a Go text/template file instead, e.g., into
+                       custom XML or a fixed-width export. The template is executed with
+                       .Files (each with .Name, .Index and .Pages), .Pages (every page,
+                       with .FileIndex, .PageNumber, .Error and .RecognizedText, whose
+                       elements have .Text, .Confidence and coordinates) and .Metadata.
+                       Besides the built-in functions, text (the text of a page, a
+                       sentence per line), xml, json and csv (escaping), pad and padLeft
+                       (fixed-width columns, e.g., {{pad 20 .Text}}), oneLine, base,
+                       join, upper, lower, trim, replace and add are available.
+
+Filtering:
+ [--filter expression] Write only the sentences (or words) for which the expression is true,
+                       e.g., --filter 'confidence > 0.9 && matches(text, "[0-9]{4}-")'.
+                       Expressions compare the fields text, confidence, language, x, y,
+                       width, height, page, pages (in the file) and file with ==, !=, <,
+                       <=, > and >=, combine them with &&, || and !, and may call
+                       matches(s, regexp), contains(s, t), startsWith(s, t),
+                       endsWith(s, t), lower(s), upper(s) and len(s). Strings are
+                       quoted with "..." (with escapes) or '...' (without). Pages are
+                       written even if none of their text is left.
+
+Summary:
+ [--summary]         After all files are complete, print a summary of each file: pages,
+                       text orientation, auto-rotated pages and the scripts recognized,
+                       with hints for --auto-rotate and --script-hints.
+
+Cost:
+ [--dry-run]         Count the pages of the input files locally and print how many pages
+                       would be billed and the estimated cost, then exit without calling
+                       the Sight API. Neither -o nor an API key is needed.
+
+Page selection:
+ [--pages file:ranges]  Only submit the given pages of a PDF, e.g., --pages invoice.pdf:1-2,5.
+                          May be given once per file. Without "file:", the ranges apply to
+                          every PDF without a selection of its own. Page numbers in the
+                          output are those of the whole PDF.
+
+Page limit:
+ [--max-pages n]     Skip PDFs with more than n pages, reporting them as failed, so that
+                       a huge document is never submitted by accident.
+ [--truncate]        With --max-pages, submit only the first n pages of longer PDFs
+                       instead of skipping them.
+
+Concurrency:
+ [--parallel n]      Submit each file in its own request, with up to n requests in flight
+                       at once. Many small files, such as single-page receipts, are
+                       recognized much sooner this way. Progress covers all requests.
+ [--requests-per-second n] Make at most n requests to the Sight API per second, polls
+                       included, across all requests in flight.
+ [--pages-per-minute n] Submit at most n pages per minute, so that large batches stay
+                       within the rate limits of your account.
+ [--polls-per-second n] Poll for results at most n times per second across all jobs in
+                       flight, polling each job less often as more are in flight.
+ [--max-concurrent-polls n] Let at most n polls await a response at once.
+
+Priority and tags:
+ [--priority level]  Ask the Sight API to process the files at a high or low priority, e.g.,
+                       high for a document someone is waiting for, low for batch work.
+ [--tag key=value]   Send a tag with the request, e.g., --tag tenant=acme, which is echoed
+                       in the Tags of each page. May be given more than once.
+
+Data residency:
+ [--region region]   Send the files to the Sight API in the region eu or us, where they are
+                       processed and their results kept, rather than to the default endpoint.
+
+Caching:
+ [--cache directory] Keep the results of each file in the directory, keyed by a digest of
+                       its contents and of the options which affect results, and reuse
+                       them instead of submitting (and paying for) a file again.
+
+Resuming:
+ [--job-file filename] Record the jobs the run starts and the pages received in a new file,
+                         so that the run can be finished with ./sight jobs resume <filename>
+                         if it is interrupted, without uploading (or paying for) anything
+                         again. Files are submitted asynchronously.
+
+Failures:
+ [--retry-failed n]  Submit files with failed or missing pages again, up to n times.
+                       Pages which still failed are written at the end of the output.
+
+                       Files which cannot be submitted (unsupported or unreadable) and
+                       files which fail are listed on stderr once the run is complete.
+                       The exit code is 0 if all files succeeded, 2 if some failed, and
+                       1 if all failed or the run could not be started.
+
+Script hint suggestion:
+ [--suggest-script-hints n] Recognize text in a sample of n of the input files without script
+                              hints, print the script hints suggested by the characters found,
+                              and exit. -o is not needed.
+ [--auto-script-hints n]    Do the same, then recognize text in all of the input files (the
+                              sample included) with the suggested script hints. The sampled
+                              files are paid for twice.
+
+Logging:
+ [-v|--verbose]      Log every polling attempt and other details to stderr.
+ [-q|--quiet]        Only log errors, and print no progress.
+ [--log-json]        Write log messages as JSON objects, one per line.
+ [--debug-http]      Describe every HTTP request and response on stderr, with the API key
+                       and the contents of files left out.
+
+Progress:
+ [--no-progress]     Print a line as each file completes instead of drawing a progress
+                       bar. This is the default when progress is not shown on a terminal.
+
+Privacy:
+ [--redact-text]     Never include recognized text in messages, statistics or
+                       annotations (only counts, confidences and geometry). The
+                       output file still contains the recognized text.
+
+Statistics:
+ [--stats-csv filename]     Add the pages of this run to rolling daily statistics (pages,
+                              error rate, mean confidence, characters per script) kept in
+                              a CSV file. The file is created if it does not exist.
+
+PDF annotation (writes annotated-<name>.pdf next to each input PDF):
+ [--annotate-match regexp]  Highlight recognized text matching the regular expression.
+ [--annotate-below number]  Underline recognized text with confidence below the number
+                              (between 0 and 1) with a red squiggly line.
+ [--annotate-dpi number]    The resolution at which the Sight API rasterized the PDF
+                              pages. Defaults to 72 (one pixel per PDF point).
+
+                              Each annotation shows the recognized text in its popup.
+
+Redaction (writes redacted-<name> next to each input with matches):
+ [--redact regexp]          Black out recognized text matching the regular expression.
+                              Can be given more than once.
+ [--redact-pii categories]  Black out comma-delimited categories of personal data:
+                              email, iban, credit-card, ssn or phone. Numbers
+                              with check digits must pass their check.
+
+                              Images are written in the format they were in. PDFs are
+                              rewritten with the text and the pixels of images under
+                              matches removed. --annotate-dpi gives the resolution of
+                              the PDF pages.
+
+Previews:
+ [--previews directory]     Save a PNG preview of each page, scaled down to fit in 256 by
+                              256 pixels, to <directory>/<name>-page-<n>.png, e.g., for a
+                              review UI. Pages of PDFs have previews only with -r.
+ [--preview-size pixels]    The most pixels a preview may be wide or tall.
+ [--preview-boxes]          Draw the bounding boxes of the recognized text on previews.
+`
+
+// recognizeMain implements "sight recognize", which is also what runs when
+// no command is given.
+func recognizeMain(args []string) {
 	cfg := sight.Config{
 		MakeSentences: true,
 		DoExifRotate:  false,
 		DoAutoRotate:  false,
 		ScriptHints:   make([]string, 0),
 	}
-	promptApiKey := false
-	var apiKeyFile, outputFile string
-	var inputFiles []string
-	for i, s := range os.Args {
-		if i == 0 {
-			continue
-		}
-		switch s {
-		case "--prompt-api-key":
-			promptApiKey = true
-		case "--api-key-file":
-			if promptApiKey {
-				fmt.Fprintf(os.Stderr, `error: Both --prompt-api-key and --api-key-file were specified.
+	o := recognizeOptions{
+		annotate:       annotateOptions{dpi: 72},
+		logger:         &cliLogger{minLevel: levelWarn},
+		parallel:       1,
+		pageSelections: make(map[string][]int),
+		format:         "json",
+	}
+	inputArgs, err := parseInterspersed(newRecognizeFlags(&cfg, &o), args)
+	if len(args) == 0 || err == flag.ErrHelp {
+		fmt.Fprint(os.Stderr, recognizeUsage)
+		fmt.Fprintln(os.Stderr)
+		writeCommands(os.Stderr)
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, `error: %v
+Run ./sight -h for more help.
+`, err)
+		os.Exit(1)
+	}
+	if o.promptApiKey && o.apiKeyFile != "" {
+		fmt.Fprintf(os.Stderr, `error: Both --prompt-api-key and --api-key-file were specified.
 This does not make sense, since each flag is used to pass in an API key but the program does not require two API keys.
 Run ./sight -h for more help.
 `)
-				os.Exit(1)
-			}
-			if i+1 >= len(os.Args) {
-				fmt.Fprintf(os.Stderr, `error: --api-key-file was specified but no filename came after it.
---api-key-file is supposed to be followed by the name of a file which contains an API key on a single line of text.
+		os.Exit(1)
+	}
+	addNormalization(&cfg, o.normalization)
+	suggestOnly := o.sampleSize != 0 && !o.applySampledHints
+	if o.outputFile == "" && !suggestOnly && !o.dryRunOnly {
+		fmt.Fprintf(os.Stderr, `error: You must specify --output <filename> (you can use -o for shorthand).
 Run ./sight -h for more help.
 `)
-				os.Exit(1)
-			}
-			apiKeyFile = os.Args[i+1]
-		case "-o":
-			fallthrough
-		case "--output":
-			if i+1 >= len(os.Args) {
-				fmt.Fprintf(os.Stderr, `error: -o (or --output) was specified but no filename came after it.
---output is supposed to be followed by the name of the file which will contain the recognized text from your images/documents.
+		os.Exit(1)
+	}
+	if o.outputFile == "-" {
+		progress = os.Stderr
+	} else if !o.force && !suggestOnly && !o.dryRunOnly && !isSink(o.outputFile) && outputExists(o.outputFile) {
+		fmt.Fprintf(os.Stderr, `error: The output file %v already exists. Pass --force to overwrite it.
+Run ./sight -h for more help.
+`, o.outputFile)
+		os.Exit(1)
+	}
+	if o.jobFile != "" {
+		if _, err := os.Stat(o.jobFile); err == nil {
+			fmt.Fprintf(os.Stderr, `error: The job file %v already exists. To finish the run which it records, use ./sight jobs resume %v.
+Run ./sight -h for more help.
+`, o.jobFile, o.jobFile)
+			os.Exit(1)
+		}
+	}
+	if len(inputArgs) == 0 && !o.readStdin {
+		fmt.Fprintf(os.Stderr, `error: You must specify documents or images in which to recognize text.
 Run ./sight -h for more help.
 `)
-				os.Exit(1)
-			}
-			if outputFile != "" {
-				fmt.Fprintf(os.Stderr, `error: -o (or --output) was specified twice but it should only be specified once.
+		os.Exit(1)
+	}
+	if o.stdinMimeType != "" && !o.readStdin {
+		fmt.Fprintf(os.Stderr, `error: --mime was specified without --stdin.
 Run ./sight -h for more help.
 `)
-				os.Exit(1)
-			}
-			outputFile = os.Args[i+1]
-		case "-s":
-			fallthrough
-		case "--script-hints":
-			if i+1 >= len(os.Args) {
-				fmt.Fprintf(os.Stderr, `error: -s (or --script-hints) was specified but no script hints came after it.
---script-hints is supposed to be followed by the a script code (latin, cyrillic, etc.).
-
-See https://siftrics.com/docs/sight.html for a full list of script codes.
+		os.Exit(1)
+	}
+	if o.tmpl != nil && o.format != "json" {
+		fmt.Fprintf(os.Stderr, `error: --template cannot be combined with --format.
+Run ./sight -h for more help.
 `)
-				os.Exit(1)
-			}
-			if len(cfg.ScriptHints) != 0 {
-				fmt.Fprintf(os.Stderr, `error: -s (or --script-hints) was specified twice but it should only be specified once.
+		os.Exit(1)
+	}
+	doRedact := len(o.redact.patterns) != 0 || len(o.redact.detectors) != 0
+	if doRedact && (cfg.DoExifRotate || cfg.DoAutoRotate) {
+		fmt.Fprintf(os.Stderr, `error: --redact and --redact-pii cannot be combined with --obey-exif or --auto-rotate.
+The boxes of rotated text do not match the pixels of the input.
 Run ./sight -h for more help.
 `)
-				os.Exit(1)
-			}
-			cfg.ScriptHints = strings.Split(os.Args[i+1], ",")
-			for _, hint := range cfg.ScriptHints {
-				if _, ok := sight.SupportedScripts[hint]; !ok {
-					fmt.Fprintf(os.Stderr, `error: "%v" is not a supported script.
+		os.Exit(1)
+	}
+	if o.pretty && (o.format != "json" || o.templateFile != "") {
+		fmt.Fprintf(os.Stderr, `error: --pretty was specified with an output format other than json.
 Run ./sight -h for more help.
-`, hint)
-					os.Exit(1)
-				}
-			}
-		case "-w":
-			fallthrough
-		case "--words":
-			cfg.MakeSentences = false
-		case "-e":
-			fallthrough
-		case "--obey-exif":
-			cfg.DoExifRotate = true
-		case "-r":
-			fallthrough
-		case "--auto-rotate":
-			cfg.DoAutoRotate = true
-		default:
-			if !(os.Args[i-1] == "--api-key-file" ||
-				os.Args[i-1] == "-o" || os.Args[i-1] == "--output" ||
-				os.Args[i-1] == "-s" || os.Args[i-1] == "--script-hints") {
-				inputFiles = append(inputFiles, s)
-			}
-		}
+`)
+		os.Exit(1)
 	}
-	if outputFile == "" {
-		fmt.Fprintf(os.Stderr, `error: You must specify --output <filename> (you can use -o for shorthand).
+	if o.showConfidence && o.format != "text" && o.format != "table" {
+		fmt.Fprintf(os.Stderr, `error: --confidence was specified without --format text or --format table.
+Run ./sight -h for more help.
+`)
+		os.Exit(1)
+	}
+	if cfg.TruncateLongFiles && cfg.MaxPagesPerFile == 0 {
+		fmt.Fprintf(os.Stderr, `error: --truncate was specified without --max-pages.
 Run ./sight -h for more help.
 `)
 		os.Exit(1)
 	}
+	if o.sampleSize != 0 && len(cfg.ScriptHints) != 0 {
+		fmt.Fprintf(os.Stderr, `error: --script-hints cannot be combined with --suggest-script-hints or --auto-script-hints.
+Run ./sight -h for more help.
+`)
+		os.Exit(1)
+	}
+	if o.readStdin && o.promptApiKey {
+		fmt.Fprintf(os.Stderr, `error: Both --stdin and --prompt-api-key were specified.
+The API key cannot be prompted for while stdin is used for input. Use --api-key-file instead.
+Run ./sight -h for more help.
+`)
+		os.Exit(1)
+	}
+	inputFiles, err := expandInputs(inputArgs, o.includes, o.excludes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	// Inputs are routed by their contents: emails yield their attachments,
+	// for example. Inputs which cannot be submitted are reported with the
+	// files which fail, rather than stopping the run.
+	maxPages := cfg.MaxPagesPerFile
+	if cfg.TruncateLongFiles {
+		maxPages = 0
+	}
+	var failures []fileFailure
+	var files []sight.File
+	var unsupported []fileFailure
+	// addFile selects the pages of f, a file of the input name, and adds it
+	// to files, or to failures if it cannot be submitted.
+	addFile := func(name string, f sight.File) {
+		f, err := o.selectPages(name, f, maxPages)
+		if err != nil {
+			failures = append(failures, fileFailure{f.Name, err.Error()})
+			o.logger.Warn("skipping file which cannot be submitted", "file", f.Name, "error", err)
+		} else {
+			files = append(files, f)
+		}
+	}
+	addInput := func(name string, contents []byte) {
+		routed, err := sight.RouteInput(name, contents)
+		if o.skipUnsupported && errors.Is(err, sight.ErrUnsupportedInput) {
+			unsupported = append(unsupported, fileFailure{name, err.Error()})
+			o.logger.Debug("skipping unsupported file", "file", name, "error", err)
+			return
+		}
+		if err == nil && sight.IsArchive(contents) {
+			routed = filterArchive(routed, o.includes, o.excludes)
+		}
+		if err == nil {
+			for _, f := range routed {
+				addFile(name, f)
+			}
+			return
+		}
+		failures = append(failures, fileFailure{name, err.Error()})
+		o.logger.Warn("skipping file which cannot be submitted", "file", name, "error", err)
+	}
+	for _, fp := range inputFiles {
+		contents, err := readInput(fp)
+		if err != nil {
+			failures = append(failures, fileFailure{fp, err.Error()})
+			o.logger.Warn("skipping file which cannot be read", "file", fp, "error", err)
+			continue
+		}
+		addInput(fp, contents)
+	}
+	if o.readStdin {
+		contents, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to read stdin: %v\n", err)
+			os.Exit(1)
+		}
+		if o.stdinMimeType != "" {
+			addFile("stdin", sight.File{Name: "stdin", MimeType: o.stdinMimeType, Contents: contents})
+		} else {
+			addInput("stdin", contents)
+		}
+	}
+	if len(unsupported) != 0 && !o.quiet {
+		fmt.Fprintf(os.Stderr, "Skipping %v unsupported input files:\n", len(unsupported))
+		for _, f := range unsupported {
+			fmt.Fprintf(os.Stderr, " %v: %v\n", f.path, f.reason)
+		}
+	}
+	numInputs := len(files) + len(failures)
+	inputFiles = make([]string, len(files))
+	for i, f := range files {
+		inputFiles[i] = f.Name
+	}
+	if len(inputFiles) == 0 && len(failures) != 0 {
+		writeFailures(os.Stderr, failures, numInputs)
+		os.Exit(exitTotalFailure)
+	}
 	if len(inputFiles) == 0 {
-		fmt.Fprintf(os.Stderr, `error: You must specify documents or images in which to recognize text.
+		fmt.Fprintf(os.Stderr, `error: No documents or images were left after searching directories and applying --include, --exclude and --skip-unsupported.
 Run ./sight -h for more help.
 `)
 		os.Exit(1)
 	}
+	if o.dryRunOnly {
+		dryRun(progress, cfg, files, failures)
+		os.Exit(0)
+	}
 
 	var client *sight.Client
-	var apiKeyBytes []byte
-	var err error
-	if promptApiKey {
-		fmt.Print("enter your Sight API key: ")
-		apiKeyBytes, err = terminal.ReadPassword(int(syscall.Stdin))
+	apiKey := loadAPIKey(o.promptApiKey, o.apiKeyFile)
+	var stats *corpusStats
+	if o.statsFile != "" {
+		stats, err = loadCorpusStats(o.statsFile)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "error: failed to read api key from stdin: %v\n", err)
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
-		fmt.Println("")
-	} else {
-		if apiKeyFile == "" {
-			fmt.Fprintf(os.Stderr, `error: You must specify either --prompt-api-key or --api-key-file <filename>.
-Run ./sight -h for more help.
-`)
+	}
+	if o.previews.dir != "" {
+		if err := os.MkdirAll(o.previews.dir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
-		apiKeyBytes, err = ioutil.ReadFile(apiKeyFile)
+	}
+	if o.quiet {
+		progress = ioutil.Discard
+	}
+	clientOpts := []sight.Option{sight.WithLogger(o.logger)}
+	if o.cacheDir != "" {
+		clientOpts = append(clientOpts, sight.WithCache(sight.DirCache(o.cacheDir)))
+	}
+	if o.requestsPerSecond != 0 || o.pagesPerMinute != 0 {
+		clientOpts = append(clientOpts, sight.WithRateLimit(o.requestsPerSecond, o.pagesPerMinute))
+	}
+	if o.pollsPerSecond != 0 || o.maxConcurrentPolls != 0 {
+		clientOpts = append(clientOpts, sight.WithPoller(sight.NewPoller(o.maxConcurrentPolls, o.pollsPerSecond)))
+	}
+	if o.region != "" {
+		clientOpts = append(clientOpts, sight.WithRegion(o.region))
+	}
+	if o.debugHTTP {
+		clientOpts = append(clientOpts, sight.WithDebugTransport(os.Stderr))
+	}
+	client = newClient(apiKey, clientOpts...)
+	if o.sampleSize != 0 {
+		fmt.Fprintf(progress, "Sampling %v of %v files to suggest script hints...\n", len(sampleFiles(files, o.sampleSize)), len(files))
+		hints, numPages, err := sampleScriptHints(client, cfg, files, o.sampleSize)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
+		if len(hints) == 0 {
+			fmt.Fprintf(progress, "No text was recognized in the %v sampled pages, so no script hints are suggested.\n", numPages)
+		} else {
+			fmt.Fprintf(progress, "Suggested script hints from %v sampled pages: --script-hints %v\n", numPages, strings.Join(hints, ","))
+		}
+		if suggestOnly {
+			os.Exit(0)
+		}
+		if len(hints) != 0 {
+			cfg.ScriptHints = hints
+		}
 	}
-	apiKey := strings.TrimSpace(string(apiKeyBytes))
-	if len(apiKey) != len("xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx") {
-		fmt.Fprintf(os.Stderr, "error: the provided API key is not valid\nAPI keys should look like xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx\n")
-		if apiKeyFile != "" {
-			fmt.Fprintf(os.Stderr, "you specified to read the API key from the file %v\n", apiKeyFile)
+	var of io.Writer = os.Stdout
+	var out resultWriter
+	var sink sight.Sink
+	if isSink(o.outputFile) {
+		sink, err = openSink(o.outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to open %v: %v\n", o.outputFile, err)
+			os.Exit(1)
 		}
-		fmt.Fprintf(os.Stderr, "run ./sight --help to see how to provide an API key\n")
-		os.Exit(1)
+		of = ioutil.Discard
+	} else if o.outputFile != "-" {
+		out, err = createOutput(o.outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		of = out
 	}
-	client = sight.NewClient(apiKey)
-	of, err := os.Create(outputFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "error: %v\n", err)
-		os.Exit(1)
+	if sink == nil {
+		sink = encodingSink(of, o.format)
+	}
+	if f, ok := progress.(*os.File); ok && !o.noProgress && terminal.IsTerminal(int(f.Fd())) {
+		bar = newProgressBar(progress, len(inputFiles))
+		cfg.OnUploadProgress = bar.upload
+	} else {
+		fmt.Fprintln(progress, "Uploading files...")
 	}
-	fmt.Println("Uploading files...")
 
-	pagesChan, err := client.RecognizeCfg(cfg, inputFiles...)
+	metadata := newJobMetadata(cfg, inputFiles)
+	if o.region != "" {
+		metadata.Endpoint = sight.RegionEndpoints[o.region]
+	}
+	cfg.OnJobStarted = metadata.addJob
+	r := &recognizer{client: client, parallel: o.parallel}
+	if o.jobFile != "" {
+		run := &journalRun{Output: o.outputFile, Format: o.format, Confidence: o.showConfidence, Pretty: o.pretty, Filter: o.filterExpr, Metadata: metadata}
+		if o.templateFile != "" {
+			run.Template, _ = filepath.Abs(o.templateFile)
+		}
+		r.journal, err = createJobJournal(o.jobFile, run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to create job file: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	allFiles := make([]int, len(files))
+	for i := range allFiles {
+		allFiles[i] = i
+	}
+	pagesChan, err := r.recognize(cfg, files, allFiles)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error: %v\n", err)
 		os.Exit(1)
 	}
-	fmt.Fprintf(of, `{"Pages":[`)
+	// readablePages are the pages written at the end, sorted, as JSON, in
+	// a text format or with a template.
+	var readablePages []sight.RecognizedPage
 	fileIndex2HaveSeenPage := make(map[int][]bool)
-	numFilesComplete := 0
-	isFirstPage := true
-	for {
-		page, isOpen := <-pagesChan
-		if !isOpen {
-			break
+	fileIndex2Pages := make(map[int][]sight.RecognizedPage)
+	doAnnotate := o.annotate.match != nil || o.annotate.belowConfidence > 0
+	o.redact.dpi = o.annotate.dpi
+	// finishInput annotates and redacts an input once all its pages have
+	// been received.
+	finishInput := func(i int, pages []sight.RecognizedPage) {
+		if doAnnotate && files[i].MimeType == "application/pdf" {
+			annotateInput(files[i], pages, o.annotate)
 		}
-		if !isFirstPage {
-			fmt.Fprintf(of, ",")
-		} else {
-			isFirstPage = false
+		if doRedact {
+			redactInput(files[i], pages, o.redact)
 		}
+	}
+	numFilesComplete := 0
+	numPagesComplete := 0
+	summary := newRunSummary(inputFiles)
+	results := newRunResults()
+	deferredAnnotations := make(map[int]bool)
+	// writePage writes page to the output file, or keeps it to be written
+	// at the end in a text format, and saves everything else which is kept
+	// for each page.
+	writePage := func(page sight.RecognizedPage) {
 		if page.Base64Image != "" {
-			fn := fmt.Sprintf("autoRotated-%v", filepath.Base(inputFiles[page.FileIndex]))
-			dest := fn
-			number := 1
-			dontSave := false
-			for {
-				_, err := os.Stat(dest)
-				if err == nil {
-					dest = fmt.Sprintf("%v-%v", number, fn)
-					number++
-					continue
-				} else if os.IsNotExist(err) {
-					break
-				} else {
-					fmt.Fprintf(os.Stderr, "\nerror: failed to save auto-rotated %v because stat failed with error:\n%v\n",
-						inputFiles[page.FileIndex], err)
-					dontSave = true
-					break
-				}
-			}
-			if !dontSave {
-				fmt.Printf("Saving auto-rotated %v to %v.\n", inputFiles[page.FileIndex], dest)
+			dest, err := unusedFileName(fmt.Sprintf("autoRotated-%v", filepath.Base(inputFiles[page.FileIndex])))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "\nerror: failed to save auto-rotated %v because stat failed with error:\n%v\n",
+					inputFiles[page.FileIndex], err)
+			} else {
+				statusf("Saving auto-rotated %v to %v.\n", inputFiles[page.FileIndex], dest)
 				f, err := os.Create(dest)
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "\nerror: failed to save auto-rotated %v to %v:\n%v\n",
 						inputFiles[page.FileIndex], dest, err)
 				} else {
-					if _, err := io.Copy(f, base64.NewDecoder(base64.StdEncoding, strings.NewReader(page.Base64Image))); err != nil {
+					if _, err := io.Copy(f, sight.RotatedImageReader(page)); err != nil {
 						fmt.Fprintf(os.Stderr, "\nerror: failed to save auto-rotated %v to %v:\n%v\n",
 							inputFiles[page.FileIndex], dest, err)
 					}
@@ -269,19 +948,40 @@ Run ./sight -h for more help.
 				}
 			}
 		}
-		jsonBytes, err := json.Marshal(page)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "\nerror: failed to serialize JSON: %v\n", err)
-			os.Exit(1)
+		if o.previews.dir != "" {
+			savePreview(files[page.FileIndex], page, o.previews)
+		}
+		if stats != nil {
+			stats.add(time.Now(), page)
+		}
+		summary.add(page)
+		if o.filter != nil {
+			page = o.filter.apply(inputFiles[page.FileIndex], page)
+		}
+		if sink != nil {
+			if err := sink.WritePage(inputFiles[page.FileIndex], page); err != nil {
+				fmt.Fprintf(os.Stderr, "\nerror: failed to write to %v: %v\n", o.outputFile, err)
+				os.Exit(1)
+			}
+			return
+		}
+		readablePages = append(readablePages, page)
+	}
+	for {
+		page, isOpen := <-pagesChan
+		if !isOpen {
+			break
+		}
+		if results.add(page) {
+			writePage(page)
 		}
-		of.Write(jsonBytes)
 
 		_, ok := fileIndex2HaveSeenPage[page.FileIndex]
 		if !ok {
 			fileIndex2HaveSeenPage[page.FileIndex] = make([]bool, page.NumberOfPagesInFile, page.NumberOfPagesInFile)
 		}
-		if page.PageNumber > 0 {
-			fileIndex2HaveSeenPage[page.FileIndex][page.PageNumber-1] = true
+		if i := pageIndex(files[page.FileIndex], page.PageNumber); i >= 0 && i < len(fileIndex2HaveSeenPage[page.FileIndex]) {
+			fileIndex2HaveSeenPage[page.FileIndex][i] = true
 		}
 		seenAllPages := true
 		for _, b := range fileIndex2HaveSeenPage[page.FileIndex] {
@@ -290,10 +990,229 @@ Run ./sight -h for more help.
 				break
 			}
 		}
+		if (doAnnotate && files[page.FileIndex].MimeType == "application/pdf") || doRedact {
+			fileIndex2Pages[page.FileIndex] = append(fileIndex2Pages[page.FileIndex], page)
+			if seenAllPages && o.retryFailed > 0 && results.hasFailedPages(page.FileIndex) {
+				// Files with failed pages are annotated after they are retried.
+				deferredAnnotations[page.FileIndex] = true
+			} else if seenAllPages {
+				finishInput(page.FileIndex, fileIndex2Pages[page.FileIndex])
+				delete(fileIndex2Pages, page.FileIndex)
+			}
+		}
 		if seenAllPages {
 			numFilesComplete++
-			fmt.Printf("%v out of %v input files are complete\n", numFilesComplete, len(inputFiles))
+			if bar == nil {
+				fmt.Fprintf(progress, "%v out of %v input files are complete\n", numFilesComplete, len(inputFiles))
+			}
+		}
+		numPagesComplete++
+		if bar != nil {
+			// Files which have not returned a page yet count as one page.
+			pagesTotal := len(inputFiles) - len(fileIndex2HaveSeenPage)
+			for _, haveSeenPage := range fileIndex2HaveSeenPage {
+				pagesTotal += len(haveSeenPage)
+			}
+			bar.pages(numPagesComplete, pagesTotal, numFilesComplete)
+		}
+	}
+	if bar != nil {
+		bar.finish()
+	}
+	for attempt := 1; attempt <= o.retryFailed; attempt++ {
+		failed := results.failedFiles(len(inputFiles))
+		if len(failed) == 0 {
+			break
+		}
+		var retried []int
+		var retryFiles []sight.File
+		for i, f := range files {
+			if _, ok := failed[i]; ok {
+				retried = append(retried, i)
+				retryFiles = append(retryFiles, f)
+			}
+		}
+		statusf("Retrying %v failed files (attempt %v of %v)...\n", len(retryFiles), attempt, o.retryFailed)
+		retryCfg := cfg
+		retryCfg.OnUploadProgress = nil
+		retryChan, err := r.recognize(retryCfg, retryFiles, retried)
+		if err != nil {
+			o.logger.Warn("failed to retry failed files", "attempt", attempt, "error", err)
+			continue
+		}
+		for page := range retryChan {
+			if page.FileIndex < 0 || page.FileIndex >= len(retried) {
+				continue
+			}
+			page.FileIndex = retried[page.FileIndex]
+			if results.add(page) {
+				writePage(page)
+				if _, ok := fileIndex2Pages[page.FileIndex]; ok {
+					fileIndex2Pages[page.FileIndex] = append(fileIndex2Pages[page.FileIndex], page)
+				}
+			}
+		}
+	}
+	// Pages which still failed after all retries are written last.
+	for _, page := range results.heldPages() {
+		writePage(page)
+	}
+	if sink != nil {
+		if ms, ok := sink.(metadataSink); ok {
+			if err := ms.writeMetadata(metadata.finish()); err != nil {
+				fmt.Fprintf(os.Stderr, "\nerror: failed to save the metadata of the run to %v: %v\n", o.outputFile, err)
+				os.Exit(1)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "\nerror: failed to save %v: %v\n", o.outputFile, err)
+			os.Exit(1)
+		}
+	} else if o.tmpl != nil {
+		if err := writeTemplate(of, o.tmpl, readablePages, inputFiles, metadata.finish()); err != nil {
+			fmt.Fprintf(os.Stderr, "\nerror: failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+	} else if o.format == "json" {
+		if err := writeJSON(of, readablePages, metadata.finish(), o.pretty); err != nil {
+			fmt.Fprintf(os.Stderr, "\nerror: failed to write output: %v\n", err)
+			os.Exit(1)
+		}
+	} else if err := writeReadable(of, o.format, readablePages, inputFiles, o.showConfidence); err != nil {
+		fmt.Fprintf(os.Stderr, "\nerror: failed to write output: %v\n", err)
+		os.Exit(1)
+	}
+	if out != nil {
+		if err := out.commit(); err != nil {
+			fmt.Fprintf(os.Stderr, "\nerror: failed to save %v: %v\n", o.outputFile, err)
+			os.Exit(1)
+		}
+	}
+	if r.journal != nil {
+		if err := r.journal.close(); err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to write job file %v: %v\n", o.jobFile, err)
+		}
+	}
+	if o.retryFailed > 0 {
+		for i := range files {
+			if pages, ok := fileIndex2Pages[i]; ok && (deferredAnnotations[i] || !results.hasMissingPages(i)) {
+				finishInput(i, pages)
+			}
 		}
 	}
-	fmt.Fprintf(of, "]}")
+	summary.writeTiming(progress)
+	if o.printSummary {
+		summary.write(progress, cfg)
+	}
+	if stats != nil {
+		if err := stats.save(o.statsFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to save statistics to %v: %v\n", o.statsFile, err)
+			os.Exit(1)
+		}
+	}
+	failed := results.failedFiles(len(inputFiles))
+	for i, inputFile := range inputFiles {
+		if reason, ok := failed[i]; ok {
+			failures = append(failures, fileFailure{inputFile, reason})
+		}
+	}
+	if len(failures) != 0 {
+		writeFailures(os.Stderr, failures, numInputs)
+		if len(failures) == numInputs {
+			os.Exit(exitTotalFailure)
+		}
+		os.Exit(exitPartialFailure)
+	}
+}
+
+// pageIndex returns the index of the page numbered pageNumber among the
+// pages of f which were submitted, or -1 if it is not one of them.
+func pageIndex(f sight.File, pageNumber int) int {
+	if len(f.Pages) == 0 {
+		return pageNumber - 1
+	}
+	selected := 0
+	for _, p := range f.Pages {
+		if p < pageNumber {
+			selected++
+		} else if p == pageNumber {
+			return selected
+		}
+	}
+	return -1
+}
+
+// unusedFileName returns fn, or fn prefixed with a number if a file named fn
+// already exists, so that saving a file never overwrites another.
+func unusedFileName(fn string) (string, error) {
+	dest := fn
+	number := 1
+	for {
+		_, err := os.Stat(dest)
+		if err == nil {
+			dest = fmt.Sprintf("%v-%v", number, fn)
+			number++
+			continue
+		} else if os.IsNotExist(err) {
+			return dest, nil
+		} else {
+			return "", err
+		}
+	}
+}
+
+// annotateInput saves a copy of the input PDF with annotations over the
+// recognized text selected by opts.
+func annotateInput(input sight.File, pages []sight.RecognizedPage, opts annotateOptions) {
+	inputFile := input.Name
+	dest, err := unusedFileName(fmt.Sprintf("annotated-%v", filepath.Base(inputFile)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nerror: failed to save annotated %v because stat failed with error:\n%v\n", inputFile, err)
+		return
+	}
+	n, err := annotatePDF(input, dest, pages, opts)
+	if err != nil {
+		os.Remove(dest)
+		fmt.Fprintf(os.Stderr, "\nerror: failed to save annotated %v to %v:\n%v\n", inputFile, dest, err)
+		return
+	}
+	statusf("Saved %v with %v annotations to %v.\n", inputFile, n, dest)
+}
+
+// loadAPIKey prompts for the API key or reads it from apiKeyFile, and exits
+// if it is missing or malformed.
+func loadAPIKey(promptApiKey bool, apiKeyFile string) string {
+	var apiKeyBytes []byte
+	var err error
+	if promptApiKey {
+		fmt.Fprint(progress, "enter your Sight API key: ")
+		apiKeyBytes, err = terminal.ReadPassword(int(syscall.Stdin))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to read api key from stdin: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Fprintln(progress, "")
+	} else {
+		if apiKeyFile == "" {
+			fmt.Fprintf(os.Stderr, `error: You must specify either --prompt-api-key or --api-key-file <filename>.
+Run ./sight -h for more help.
+`)
+			os.Exit(1)
+		}
+		apiKeyBytes, err = ioutil.ReadFile(apiKeyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	apiKey := strings.TrimSpace(string(apiKeyBytes))
+	if len(apiKey) != len("xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx") {
+		fmt.Fprintf(os.Stderr, "error: the provided API key is not valid\nAPI keys should look like xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx\n")
+		if apiKeyFile != "" {
+			fmt.Fprintf(os.Stderr, "you specified to read the API key from the file %v\n", apiKeyFile)
+		}
+		fmt.Fprintf(os.Stderr, "run ./sight --help to see how to provide an API key\n")
+		os.Exit(1)
+	}
+	return apiKey
 }
@@ -0,0 +1,98 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/siftrics/sight"
+)
+
+// jobMetadata describes how a set of results was produced. It is written
+// with the results so that output files remain self-describing long after
+// the run which produced them.
+type jobMetadata struct {
+	Tool      string
+	Version   string
+	GoVersion string
+	Endpoint  string
+	Started   time.Time
+	Finished  time.Time
+	Inputs    []string
+	Config    metadataConfig
+	// Jobs are the URLs of the jobs the Sight API started for the run.
+	Jobs []string
+
+	mu sync.Mutex
+}
+
+// metadataConfig is the part of sight.Config which affects results.
+type metadataConfig struct {
+	MakeSentences     bool
+	DoExifRotate      bool
+	DoAutoRotate      bool
+	ScriptHints       []string
+	MaxPagesPerFile   int  `json:",omitempty"`
+	TruncateLongFiles bool `json:",omitempty"`
+	DetectLanguage    bool `json:",omitempty"`
+	DetectBarcodes    bool `json:",omitempty"`
+	SkipTextPDFs      bool `json:",omitempty"`
+}
+
+// newJobMetadata starts the metadata of a run which submits inputs with cfg.
+// The caller sets cfg.OnJobStarted to md.addJob to record job URLs.
+func newJobMetadata(cfg sight.Config, inputs []string) *jobMetadata {
+	return &jobMetadata{
+		Tool:      "sight",
+		Version:   version,
+		GoVersion: runtime.Version(),
+		Endpoint:  sight.Endpoint,
+		Started:   time.Now().UTC(),
+		Inputs:    inputs,
+		Config: metadataConfig{
+			MakeSentences:     cfg.MakeSentences,
+			DoExifRotate:      cfg.DoExifRotate,
+			DoAutoRotate:      cfg.DoAutoRotate,
+			ScriptHints:       cfg.ScriptHints,
+			MaxPagesPerFile:   cfg.MaxPagesPerFile,
+			TruncateLongFiles: cfg.TruncateLongFiles,
+			DetectLanguage:    cfg.DetectLanguage,
+			DetectBarcodes:    cfg.DetectBarcodes,
+			SkipTextPDFs:      cfg.SkipTextPDFs,
+		},
+	}
+}
+
+func (md *jobMetadata) addJob(job sight.Job) {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	md.Jobs = append(md.Jobs, job.URL)
+}
+
+// finish records the end of the run and returns md for serialization.
+func (md *jobMetadata) finish() *jobMetadata {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+	md.Finished = time.Now().UTC()
+	return md
+}
@@ -0,0 +1,96 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// resultWriter is an output file of a run. Nothing appears at its
+// destination until it is committed.
+type resultWriter interface {
+	io.Writer
+	commit() error
+}
+
+// createOutput creates the output file dest, which may be a local path or
+// the URL of an object in an object store.
+func createOutput(dest string) (resultWriter, error) {
+	if isRemote(dest) {
+		if _, _, _, err := remoteObject(dest); err != nil {
+			return nil, err
+		}
+		return &remoteFile{dest: dest}, nil
+	}
+	f, err := createAtomic(dest)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// outputExists reports whether there is already an output file at dest.
+func outputExists(dest string) bool {
+	if isRemote(dest) {
+		exists, _ := remoteExists(dest)
+		return exists
+	}
+	_, err := os.Stat(dest)
+	return err == nil
+}
+
+// atomicFile is written in a temporary file next to its destination, which
+// is renamed into place when it is committed. Until then, any file at the
+// destination is untouched, and a run which is interrupted leaves behind no
+// truncated output.
+type atomicFile struct {
+	*os.File
+	dest string
+}
+
+func createAtomic(dest string) (*atomicFile, error) {
+	f, err := ioutil.TempFile(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &atomicFile{File: f, dest: dest}, nil
+}
+
+// commit closes the file and moves it to its destination.
+func (f *atomicFile) commit() error {
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), f.dest); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
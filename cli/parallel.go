@@ -0,0 +1,173 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"sync"
+
+	"github.com/siftrics/sight"
+)
+
+// recognizer submits the files of a run, as one request or as one request
+// per file, and records the jobs it starts in the run's job file, if any.
+type recognizer struct {
+	client sight.Recognizer
+	// parallel is the most requests in flight at once. If it is 1, all
+	// the files are submitted in one request.
+	parallel int
+	journal  *jobJournal
+}
+
+// recognize recognizes the text in files like client.RecognizeFiles, but
+// with up to r.parallel requests in flight at once, one per file. The
+// FileIndex of each page is that of its file in files, as it would be if
+// they had been submitted together. indices are the indices of files among
+// the input files of the run, for the job file.
+//
+// A file whose request cannot be made yields a single error page rather
+// than stopping the others, so that it is reported and retried like any
+// other failed file. cfg.OnUploadProgress is told the progress of all the
+// requests together.
+func (r *recognizer) recognize(cfg sight.Config, files []sight.File, indices []int) (<-chan sight.RecognizedPage, error) {
+	parallel := r.parallel
+	if parallel <= 1 || len(files) <= 1 {
+		return r.submit(cfg, files, indices)
+	}
+	if parallel > len(files) {
+		parallel = len(files)
+	}
+	var upload *mergedUpload
+	if cfg.OnUploadProgress != nil {
+		upload = newMergedUpload(files, cfg.OnUploadProgress)
+	}
+	next := make(chan int)
+	pagesChan := make(chan sight.RecognizedPage, 16)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fileCfg := cfg
+				if upload != nil {
+					fileCfg.OnUploadProgress = upload.forFile(i)
+				}
+				pages, err := r.submit(fileCfg, files[i:i+1], indices[i:i+1])
+				if err != nil {
+					if r.journal != nil {
+						r.journal.addPage("", failedFilePage(files[i], 0, err), indices[i:i+1])
+					}
+					pagesChan <- failedFilePage(files[i], i, err)
+					continue
+				}
+				for page := range pages {
+					page.FileIndex = i
+					pagesChan <- page
+				}
+			}
+		}()
+	}
+	go func() {
+		for i := range files {
+			next <- i
+		}
+		close(next)
+		wg.Wait()
+		close(pagesChan)
+	}()
+	return pagesChan, nil
+}
+
+// submit submits files in one request, recording the job it starts and the
+// pages received in the job file, if there is one.
+func (r *recognizer) submit(cfg sight.Config, files []sight.File, indices []int) (<-chan sight.RecognizedPage, error) {
+	if r.journal == nil {
+		return r.client.RecognizeFiles(cfg, files...)
+	}
+	jobURL := ""
+	onJobStarted := cfg.OnJobStarted
+	cfg.OnJobStarted = func(job sight.Job) {
+		jobURL = job.URL
+		r.journal.addJob(job, indices)
+		if onJobStarted != nil {
+			onJobStarted(job)
+		}
+	}
+	pages, err := r.client.RecognizeFiles(cfg, files...)
+	if err != nil {
+		return nil, err
+	}
+	pagesChan := make(chan sight.RecognizedPage, 16)
+	go func() {
+		for page := range pages {
+			r.journal.addPage(jobURL, page, indices)
+			pagesChan <- page
+		}
+		close(pagesChan)
+	}()
+	return pagesChan, nil
+}
+
+// failedFilePage is the page reported for f, the file at index i, when its
+// request fails with err.
+func failedFilePage(f sight.File, i int, err error) sight.RecognizedPage {
+	page := sight.RecognizedPage{Error: err.Error(), FileIndex: i, PageNumber: 1, NumberOfPagesInFile: 1}
+	if len(f.Pages) != 0 {
+		page.PageNumber = f.Pages[0]
+	}
+	return page
+}
+
+// mergedUpload adds up the upload progress of concurrent requests. Until a
+// request starts, its size is estimated from the size of its file.
+type mergedUpload struct {
+	mu          sync.Mutex
+	sent, total []int64
+	onProgress  func(sent, total int64)
+}
+
+func newMergedUpload(files []sight.File, onProgress func(sent, total int64)) *mergedUpload {
+	m := &mergedUpload{
+		sent:       make([]int64, len(files)),
+		total:      make([]int64, len(files)),
+		onProgress: onProgress,
+	}
+	for i, f := range files {
+		// Files are sent base64-encoded.
+		m.total[i] = int64((len(f.Contents) + 2) / 3 * 4)
+	}
+	return m
+}
+
+// forFile returns the OnUploadProgress callback for the request of file i.
+func (m *mergedUpload) forFile(i int) func(sent, total int64) {
+	return func(sent, total int64) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.sent[i], m.total[i] = sent, total
+		var allSent, allTotal int64
+		for j := range m.sent {
+			allSent += m.sent[j]
+			allTotal += m.total[j]
+		}
+		m.onProgress(allSent, allTotal)
+	}
+}
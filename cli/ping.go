@@ -0,0 +1,136 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/siftrics/sight"
+)
+
+const pingUsage = `usage: ./sight ping <--prompt-api-key|--api-key-file filename>
+
+Checks that the Sight API can be reached and accepts your API key, without submitting
+anything, so nothing is billed. The exit status is 0 if it does, 2 if the API key was
+rejected and 1 if the Sight API could not be reached, so the command can serve as a
+deployment health check.
+
+example:
+ ./sight ping --api-key-file my_api_key.txt --timeout 5
+
+optional flags:
+ [--json]            Print the result as JSON.
+ [--timeout seconds] Give up after this many seconds. Defaults to 10.
+ [--region region]   Ping the Sight API in the region eu or us rather than the default endpoint.
+`
+
+func pingMain(args []string) {
+	promptApiKey, asJSON := false, false
+	var apiKeyFile string
+	var opts []sight.Option
+	timeout := 10 * time.Second
+	for i := 0; i < len(args); i++ {
+		s := args[i]
+		switch s {
+		case "-h", "--help":
+			fmt.Fprint(os.Stderr, pingUsage)
+			os.Exit(1)
+		case "--prompt-api-key":
+			promptApiKey = true
+		case "--api-key-file":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: --api-key-file was specified but no filename came after it.\nRun ./sight ping -h for more help.\n")
+				os.Exit(1)
+			}
+			i++
+			apiKeyFile = args[i]
+		case "--json":
+			asJSON = true
+		case "--timeout":
+			var seconds float64
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: --timeout was specified but no number of seconds came after it.\nRun ./sight ping -h for more help.\n")
+				os.Exit(1)
+			}
+			i++
+			if _, err := fmt.Sscan(args[i], &seconds); err != nil || seconds <= 0 {
+				fmt.Fprintf(os.Stderr, "error: --timeout must be followed by a number of seconds.\nRun ./sight ping -h for more help.\n")
+				os.Exit(1)
+			}
+			timeout = time.Duration(seconds * float64(time.Second))
+		case "--region":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: --region was specified but no region came after it.\nRun ./sight ping -h for more help.\n")
+				os.Exit(1)
+			}
+			i++
+			if _, ok := sight.RegionEndpoints[sight.Region(args[i])]; !ok {
+				fmt.Fprintf(os.Stderr, "error: --region must be followed by eu or us.\nRun ./sight ping -h for more help.\n")
+				os.Exit(1)
+			}
+			opts = append(opts, sight.WithRegion(sight.Region(args[i])))
+		default:
+			fmt.Fprintf(os.Stderr, "error: unexpected argument %v.\nRun ./sight ping -h for more help.\n", s)
+			os.Exit(1)
+		}
+	}
+	if !promptApiKey && apiKeyFile == "" {
+		fmt.Fprint(os.Stderr, pingUsage)
+		os.Exit(1)
+	}
+	client := newClient(loadAPIKey(promptApiKey, apiKeyFile), opts...)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	result, err := client.Ping(ctx)
+	if asJSON {
+		out := struct {
+			OK         bool
+			Error      string `json:",omitempty"`
+			LatencyMS  int64
+			APIVersion string `json:",omitempty"`
+		}{err == nil, "", result.Latency.Milliseconds(), result.APIVersion}
+		if err != nil {
+			out.Error = err.Error()
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(out)
+	} else if err == nil {
+		fmt.Printf("ok: the Sight API accepted the API key in %v", result.Latency.Round(time.Millisecond))
+		if result.APIVersion != "" {
+			fmt.Printf(" (API version %v)", result.APIVersion)
+		}
+		fmt.Printf("\n")
+	} else {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+	}
+	switch {
+	case errors.Is(err, sight.ErrUnauthorized):
+		os.Exit(2)
+	case err != nil:
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/siftrics/sight"
+)
+
+// previewOptions are the options of --previews.
+type previewOptions struct {
+	dir  string
+	opts sight.PreviewOptions
+}
+
+// savePreview saves a PNG preview of page, from input, to
+// <dir>/<input name>-page-<n>.png. Pages of PDFs without an image are
+// skipped.
+func savePreview(input sight.File, page sight.RecognizedPage, opts previewOptions) {
+	if page.Error != "" {
+		return
+	}
+	img, err := sight.PagePreview(page, input, opts.opts)
+	if err == sight.ErrNoPageImage {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nerror: failed to preview page %v of %v:\n%v\n", page.PageNumber, input.Name, err)
+		return
+	}
+	dest, err := unusedFileName(filepath.Join(opts.dir, fmt.Sprintf("%v-page-%v.png", filepath.Base(input.Name), page.PageNumber)))
+	if err == nil {
+		var f *os.File
+		if f, err = os.Create(dest); err == nil {
+			err = png.Encode(f, img)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nerror: failed to save preview of page %v of %v:\n%v\n", page.PageNumber, input.Name, err)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+const progressBarWidth = 30
+
+// progressBar draws a single, continually redrawn line showing upload and
+// recognition progress. Messages printed through it appear above the bar.
+type progressBar struct {
+	mu sync.Mutex
+	w  io.Writer
+
+	uploadStart           time.Time
+	uploaded, uploadTotal int64
+
+	recognizeStart        time.Time
+	pagesDone, pagesTotal int
+	filesDone, filesTotal int
+
+	line     string
+	lastDraw time.Time
+}
+
+func newProgressBar(w io.Writer, filesTotal int) *progressBar {
+	return &progressBar{w: w, filesTotal: filesTotal, uploadStart: time.Now()}
+}
+
+// upload records that sent out of total bytes of the initial request have
+// been sent. It is safe to call from any goroutine.
+func (p *progressBar) upload(sent, total int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.uploaded, p.uploadTotal = sent, total
+	p.draw(sent == total)
+}
+
+// pages records recognition progress. pagesTotal is an estimate until every
+// file has returned at least one page.
+func (p *progressBar) pages(pagesDone, pagesTotal, filesDone int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.recognizeStart.IsZero() {
+		p.recognizeStart = time.Now()
+	}
+	p.pagesDone, p.pagesTotal, p.filesDone = pagesDone, pagesTotal, filesDone
+	p.draw(filesDone == p.filesTotal)
+}
+
+// printf prints a message above the bar.
+func (p *progressBar) printf(format string, args ...interface{}) {
+	p.interrupt(func() {
+		fmt.Fprintf(p.w, format, args...)
+	})
+}
+
+// interrupt clears the bar, calls f to write to the terminal, and redraws the
+// bar below whatever f wrote.
+func (p *progressBar) interrupt(f func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	f()
+	if p.line != "" {
+		fmt.Fprint(p.w, p.line)
+	}
+}
+
+// finish leaves the last state of the bar on its own line.
+func (p *progressBar) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.draw(true)
+	if p.line != "" {
+		fmt.Fprintln(p.w)
+		p.line = ""
+	}
+}
+
+func (p *progressBar) clear() {
+	if p.line != "" {
+		fmt.Fprintf(p.w, "\r%v\r", strings.Repeat(" ", len(p.line)))
+	}
+}
+
+func (p *progressBar) draw(force bool) {
+	now := time.Now()
+	if !force && now.Sub(p.lastDraw) < 100*time.Millisecond {
+		return
+	}
+	p.lastDraw = now
+	var line string
+	if p.recognizeStart.IsZero() {
+		if p.uploadTotal == 0 {
+			return
+		}
+		frac := float64(p.uploaded) / float64(p.uploadTotal)
+		line = fmt.Sprintf("Uploading   %v %3.0f%% %v / %v%v",
+			drawBar(frac), 100*frac, formatBytes(p.uploaded), formatBytes(p.uploadTotal),
+			eta(p.uploadStart, frac))
+	} else {
+		frac := 0.0
+		if p.pagesTotal > 0 {
+			frac = float64(p.pagesDone) / float64(p.pagesTotal)
+		}
+		line = fmt.Sprintf("Recognizing %v %3.0f%% %v / %v pages, %v / %v files%v",
+			drawBar(frac), 100*frac, p.pagesDone, p.pagesTotal, p.filesDone, p.filesTotal,
+			eta(p.recognizeStart, frac))
+	}
+	p.clear()
+	fmt.Fprint(p.w, line)
+	p.line = line
+}
+
+func drawBar(frac float64) string {
+	n := int(frac * progressBarWidth)
+	if n > progressBarWidth {
+		n = progressBarWidth
+	}
+	return "[" + strings.Repeat("#", n) + strings.Repeat("-", progressBarWidth-n) + "]"
+}
+
+// eta estimates the time remaining, assuming progress continues at the rate
+// observed since start.
+func eta(start time.Time, frac float64) string {
+	if frac <= 0 || frac >= 1 {
+		return ""
+	}
+	elapsed := time.Since(start)
+	remaining := time.Duration(float64(elapsed) * (1 - frac) / frac)
+	return fmt.Sprintf(", ETA %v", remaining.Round(time.Second))
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%v B", n)
+}
@@ -0,0 +1,409 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/internal/pdf"
+	"github.com/siftrics/sight/pii"
+)
+
+// redactOptions configures which recognized text is blacked out in the
+// redacted copies of the inputs.
+type redactOptions struct {
+	patterns  []*regexp.Regexp
+	detectors []pii.Detector
+	// dpi is the resolution at which the Sight API rasterized PDFs, as
+	// for annotateOptions.
+	dpi float64
+}
+
+// quad is a box as four corners, in order around it.
+type quad [4][2]float64
+
+// redactionQuads returns the boxes, in the pixel coordinates of page, of
+// the text matching opts. The box of a match is estimated from its place
+// in the text of its sentence (or word), widened by half a character on
+// each side since characters differ in width.
+func redactionQuads(page sight.RecognizedPage, opts redactOptions) []quad {
+	var quads []quad
+	for _, t := range page.RecognizedText {
+		var spans [][2]int
+		for _, re := range opts.patterns {
+			for _, m := range re.FindAllStringIndex(t.Text, -1) {
+				spans = append(spans, [2]int{m[0], m[1]})
+			}
+		}
+		if len(opts.detectors) != 0 {
+			for _, sp := range pii.Find(t.Text, opts.detectors...) {
+				spans = append(spans, [2]int{sp.Start, sp.End})
+			}
+		}
+		if len(spans) == 0 {
+			continue
+		}
+		n := float64(utf8.RuneCountInString(t.Text))
+		for _, span := range mergeSpans(spans) {
+			from := (float64(utf8.RuneCountInString(t.Text[:span[0]])) - 0.5) / n
+			to := (float64(utf8.RuneCountInString(t.Text[:span[1]])) + 0.5) / n
+			from, to = math.Max(from, 0), math.Min(to, 1)
+			lerp := func(x0, y0, x1, y1 int, f float64) [2]float64 {
+				return [2]float64{float64(x0) + f*float64(x1-x0), float64(y0) + f*float64(y1-y0)}
+			}
+			quads = append(quads, quad{
+				lerp(t.TopLeftX, t.TopLeftY, t.TopRightX, t.TopRightY, from),
+				lerp(t.TopLeftX, t.TopLeftY, t.TopRightX, t.TopRightY, to),
+				lerp(t.BottomLeftX, t.BottomLeftY, t.BottomRightX, t.BottomRightY, to),
+				lerp(t.BottomLeftX, t.BottomLeftY, t.BottomRightX, t.BottomRightY, from),
+			})
+		}
+	}
+	return quads
+}
+
+// mergeSpans sorts byte ranges and merges those which overlap.
+func mergeSpans(spans [][2]int) [][2]int {
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	merged := spans[:1]
+	for _, s := range spans[1:] {
+		last := &merged[len(merged)-1]
+		if s[0] <= last[1] {
+			if s[1] > last[1] {
+				last[1] = s[1]
+			}
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
+
+// contains reports whether the convex quad q contains the point (x, y).
+func (q quad) contains(x, y float64) bool {
+	sign := 0.0
+	for i := range q {
+		a, b := q[i], q[(i+1)%4]
+		cross := (b[0]-a[0])*(y-a[1]) - (b[1]-a[1])*(x-a[0])
+		if cross*sign < 0 {
+			return false
+		}
+		if cross != 0 {
+			sign = cross
+		}
+	}
+	return true
+}
+
+// overlaps reports whether the convex quads q and o overlap, by looking for
+// an edge of either which separates them.
+func (q quad) overlaps(o quad) bool {
+	for _, pair := range [2][2]quad{{q, o}, {o, q}} {
+		for i := range pair[0] {
+			a, b := pair[0][i], pair[0][(i+1)%4]
+			nx, ny := a[1]-b[1], b[0]-a[0]
+			minA, maxA := math.Inf(1), math.Inf(-1)
+			minB, maxB := math.Inf(1), math.Inf(-1)
+			for j := range pair[0] {
+				p := pair[0][j][0]*nx + pair[0][j][1]*ny
+				minA, maxA = math.Min(minA, p), math.Max(maxA, p)
+				p = pair[1][j][0]*nx + pair[1][j][1]*ny
+				minB, maxB = math.Min(minB, p), math.Max(maxB, p)
+			}
+			if maxA < minB || maxB < minA {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fill paints the pixels of img whose centers are in q black.
+func (q quad) fill(img draw.Image) {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, c := range q {
+		minX, minY = math.Min(minX, c[0]), math.Min(minY, c[1])
+		maxX, maxY = math.Max(maxX, c[0]), math.Max(maxY, c[1])
+	}
+	r := image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX))+1, int(math.Ceil(maxY))+1).Intersect(img.Bounds())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if q.contains(float64(x)+0.5, float64(y)+0.5) {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+}
+
+// redactInput writes a copy of input to redacted-<name> in the current
+// directory with the text matching opts blacked out, if any does.
+func redactInput(input sight.File, pages []sight.RecognizedPage, opts redactOptions) {
+	inputFile := input.Name
+	var n int
+	for _, page := range pages {
+		if page.Error == "" {
+			n += len(redactionQuads(page, opts))
+		}
+	}
+	if n == 0 {
+		statusf("Found nothing to redact in %v.\n", inputFile)
+		return
+	}
+	mimeType := input.MimeType
+	if mimeType == "" {
+		mimeType = http.DetectContentType(input.Contents)
+	}
+	var redacted []byte
+	var err error
+	if mimeType == "application/pdf" {
+		redacted, err = redactPDF(input.Contents, pages, opts)
+	} else {
+		redacted, err = redactImage(input.Contents, pages, opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nerror: failed to redact %v:\n%v\n", inputFile, err)
+		return
+	}
+	dest, err := unusedFileName(fmt.Sprintf("redacted-%v", filepath.Base(inputFile)))
+	if err == nil {
+		err = ioutil.WriteFile(dest, redacted, 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\nerror: failed to save redacted %v:\n%v\n", inputFile, err)
+		return
+	}
+	statusf("Saved %v with %v redactions to %v.\n", inputFile, n, dest)
+}
+
+// redactImage returns the image contents with the text matching opts
+// blacked out, in the format it was in.
+func redactImage(contents []byte, pages []sight.RecognizedPage, opts redactOptions) ([]byte, error) {
+	img, format, err := image.Decode(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("the image cannot be decoded: %v", err)
+	}
+	dst, ok := img.(draw.Image)
+	if !ok {
+		rgba := image.NewRGBA(img.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+		dst = rgba
+	}
+	for _, page := range pages {
+		if page.Error != "" {
+			continue
+		}
+		for _, q := range redactionQuads(page, opts) {
+			q.fill(dst)
+		}
+	}
+	var buf bytes.Buffer
+	switch format {
+	case "png":
+		err = png.Encode(&buf, dst)
+	case "jpeg":
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 95})
+	case "gif":
+		err = gif.Encode(&buf, dst, nil)
+	default:
+		err = fmt.Errorf("%v images cannot be redacted", format)
+	}
+	return buf.Bytes(), err
+}
+
+// redactPDF returns the PDF contents with the text matching opts blacked
+// out. The pixels under each match are painted black in the images of the
+// page, the glyphs under it are removed from the text of the page
+// (including an invisible text layer), and a black box is drawn over it.
+// The file is rewritten rather than updated, so that nothing which was
+// blacked out remains in it.
+func redactPDF(contents []byte, pages []sight.RecognizedPage, opts redactOptions) ([]byte, error) {
+	r, err := pdf.NewReader(contents)
+	if err != nil {
+		return nil, err
+	}
+	if r.Encrypted() {
+		return nil, fmt.Errorf("the PDF is encrypted")
+	}
+	pdfPages, err := r.Pages()
+	if err != nil {
+		return nil, err
+	}
+	scale := 72 / opts.dpi
+	u := r.NewUpdate()
+	images := make(map[pdf.Ref]draw.Image)
+	var imageOrder []pdf.Ref
+	for _, page := range pages {
+		if page.Error != "" || page.PageNumber < 1 || page.PageNumber > len(pdfPages) {
+			continue
+		}
+		pp := pdfPages[page.PageNumber-1]
+		var quads []quad
+		for _, q := range redactionQuads(page, opts) {
+			for i, c := range q {
+				q[i][0], q[i][1] = pp.ToUserSpace(c[0]*scale, c[1]*scale)
+			}
+			quads = append(quads, q)
+		}
+		if len(quads) == 0 {
+			continue
+		}
+		if pp.Ref.Num == 0 {
+			return nil, fmt.Errorf("page %v is not an indirect object and cannot be updated", page.PageNumber)
+		}
+		content, err := r.PageContent(pp)
+		if err != nil {
+			return nil, err
+		}
+		for _, placed := range content.Images {
+			m := placed.Matrix
+			det := m[0]*m[3] - m[1]*m[2]
+			if det == 0 {
+				continue
+			}
+			for _, q := range quads {
+				// Map the match into the unit square where the image
+				// is drawn.
+				var unit quad
+				for i, c := range q {
+					x, y := c[0]-m[4], c[1]-m[5]
+					unit[i] = [2]float64{(m[3]*x - m[2]*y) / det, (m[0]*y - m[1]*x) / det}
+				}
+				if !unit.overlaps(quad{{0, 0}, {1, 0}, {1, 1}, {0, 1}}) {
+					continue
+				}
+				if placed.Ref.Num == 0 {
+					return nil, fmt.Errorf("page %v has an inline image under text to redact, which is not supported", page.PageNumber)
+				}
+				img, ok := images[placed.Ref]
+				if !ok {
+					o, err := r.Resolve(placed.Ref)
+					if err != nil {
+						return nil, err
+					}
+					stm, _ := o.(pdf.Stream)
+					if img, err = r.DecodeImage(stm); err != nil {
+						return nil, fmt.Errorf("page %v has an image under text to redact which cannot be redacted: %v", page.PageNumber, err)
+					}
+					images[placed.Ref] = img
+					imageOrder = append(imageOrder, placed.Ref)
+				}
+				// Image space has its origin at the bottom left, and
+				// pixels are counted from the top left.
+				b := img.Bounds()
+				for i, c := range unit {
+					unit[i] = [2]float64{c[0] * float64(b.Dx()), (1 - c[1]) * float64(b.Dy())}
+				}
+				unit.fill(img)
+			}
+		}
+		d := make(pdf.Dict, len(pp.Dict))
+		for k, v := range pp.Dict {
+			d[k] = v
+		}
+		var overlay strings.Builder
+		overlay.WriteString("Q\nq 0 g\n")
+		for _, q := range quads {
+			fmt.Fprintf(&overlay, "%v %v m %v %v l %v %v l %v %v l h f\n", round2(q[0][0]), round2(q[0][1]), round2(q[1][0]), round2(q[1][1]), round2(q[2][0]), round2(q[2][1]), round2(q[3][0]), round2(q[3][1]))
+		}
+		overlay.WriteString("Q\n")
+		if textUnder(content, quads) {
+			data, err := r.StripText(pp, func(g pdf.Glyph) bool { return quad(g.Quad).overlapsAny(quads) })
+			if err != nil {
+				return nil, err
+			}
+			stripped := pp
+			stripped.Dict = d
+			d["Contents"] = pdf.Stream{Dict: pdf.Dict{}, Data: data}
+			if content, err := r.PageContent(stripped); err != nil || textUnder(content, quads) {
+				return nil, fmt.Errorf("page %v draws text to redact in a form XObject, which is not supported", page.PageNumber)
+			}
+			d["Contents"] = u.Add(pdf.Stream{Dict: pdf.Dict{}, Data: append(append([]byte("q\n"), data...), overlay.String()...)})
+		} else {
+			existing, err := r.Resolve(pp.Dict["Contents"])
+			if err != nil {
+				return nil, err
+			}
+			streams := pdf.Array{u.Add(pdf.Stream{Dict: pdf.Dict{}, Data: []byte("q\n")})}
+			if a, ok := existing.(pdf.Array); ok {
+				streams = append(streams, a...)
+			} else if existing != nil {
+				streams = append(streams, pp.Dict["Contents"])
+			}
+			d["Contents"] = append(streams, u.Add(pdf.Stream{Dict: pdf.Dict{}, Data: []byte("\n" + overlay.String())}))
+		}
+		u.Set(pp.Ref, d)
+	}
+	for _, ref := range imageOrder {
+		o, err := r.Resolve(ref)
+		if err != nil {
+			return nil, err
+		}
+		stm, err := pdf.EncodeImage(o.(pdf.Stream), images[ref])
+		if err != nil {
+			return nil, err
+		}
+		u.Set(ref, stm)
+	}
+	var buf bytes.Buffer
+	if _, err := u.Rewrite(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// textUnder reports whether any glyph drawn on a page is under one of
+// quads, in default user space.
+func textUnder(content *pdf.PageContent, quads []quad) bool {
+	for _, g := range content.Glyphs {
+		if quad(g.Quad).overlapsAny(quads) {
+			return true
+		}
+	}
+	return false
+}
+
+// overlapsAny reports whether q overlaps any of quads.
+func (q quad) overlapsAny(quads []quad) bool {
+	for _, o := range quads {
+		if q.overlaps(o) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,485 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/siftrics/sight"
+)
+
+const serveUsage = `usage: ./sight serve <--prompt-api-key|--api-key-file filename>
+
+Runs an HTTP server (and optionally a gRPC server) which recognizes text with the Sight API
+on behalf of its clients, using the server's API key, so that applications can use OCR
+without an API key of their own.
+
+  POST /recognize   Submit the files of a multipart/form-data request, in one or more fields
+                    named "file". The form may also set words, obey-exif and auto-rotate to
+                    true, and script-hints to a comma-delimited list. Responds with 202 and
+                    {"ID": ..., "URL": "/jobs/<ID>"}, or with ?stream=true streams the pages
+                    as they are received, as one JSON object per line.
+  GET /jobs/<ID>    Respond with {"ID", "Files", "Done", "Pages"}: the pages received so far.
+                    With ?stream=true, stream every page, then close the response once all
+                    pages are received.
+  GET /stats        Respond with daily statistics of the pages recognized, as CSV: the
+                    columns of --stats-csv in ./sight -h.
+
+Jobs are kept in memory until an hour after they are done.
+
+example:
+ ./sight serve --listen :8080 --token-file tokens.txt --api-key-file my_api_key.txt
+ curl -H "Authorization: Bearer $TOKEN" -F file=@invoice.pdf 'localhost:8080/recognize?stream=true'
+
+optional flags:
+ [--listen address]      The address to listen on. Defaults to 127.0.0.1:8080, which only
+                           accepts connections from this machine.
+ [--token-file filename] Require clients to send one of the tokens in the file, one per
+                           line, in an "Authorization: Bearer <token>" header. Required to
+                           listen on any address but a loopback one, as anyone who can
+                           reach the server could otherwise spend your API key.
+ [--max-upload MB]       The largest request accepted, in megabytes. Defaults to 32.
+ [--stats-csv filename]  Keep the statistics of GET /stats in a CSV file, so that they
+                           outlast the server. Otherwise they are only kept in memory.
+ [--grpc address]        Also serve the gRPC service defined in proto/sight.proto on this
+                           address, e.g., :9090. Tokens are sent as "Bearer <token>" in
+                           "authorization" metadata.
+ [-v|--verbose]          Log every polling attempt and other details.
+ [--log-json]            Write log messages as JSON objects, one per line.
+`
+
+func serveMain(args []string) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stderr, serveUsage)
+		os.Exit(1)
+	}
+	logger := &cliLogger{minLevel: levelInfo}
+	promptApiKey := false
+	var apiKeyFile, tokenFile, grpcAddr, statsFile string
+	listen := "127.0.0.1:8080"
+	maxUpload := int64(32)
+	for i := 0; i < len(args); i++ {
+		s := args[i]
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: %v was specified but no value came after it.\nRun ./sight serve -h for more help.\n", s)
+				os.Exit(1)
+			}
+			i++
+			return args[i]
+		}
+		switch s {
+		case "--prompt-api-key":
+			promptApiKey = true
+		case "--api-key-file":
+			apiKeyFile = value()
+		case "--listen":
+			listen = value()
+		case "--token-file":
+			tokenFile = value()
+		case "--grpc":
+			grpcAddr = value()
+		case "--stats-csv":
+			statsFile = value()
+		case "--max-upload":
+			if _, err := fmt.Sscan(value(), &maxUpload); err != nil || maxUpload <= 0 {
+				fmt.Fprintf(os.Stderr, "error: --max-upload must be followed by a positive number of megabytes.\n")
+				os.Exit(1)
+			}
+		case "-v", "--verbose":
+			logger.minLevel = levelDebug
+		case "--log-json":
+			logger.json = true
+		default:
+			fmt.Fprintf(os.Stderr, "error: unexpected argument %v.\nRun ./sight serve -h for more help.\n", s)
+			os.Exit(1)
+		}
+	}
+	if !promptApiKey && apiKeyFile == "" {
+		fmt.Fprint(os.Stderr, serveUsage)
+		os.Exit(1)
+	}
+	var tokens []string
+	if tokenFile != "" {
+		buf, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, line := range strings.Split(string(buf), "\n") {
+			if t := strings.TrimSpace(line); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+		if len(tokens) == 0 {
+			fmt.Fprintf(os.Stderr, "error: %v contains no tokens.\n", tokenFile)
+			os.Exit(1)
+		}
+	} else {
+		for _, addr := range []string{listen, grpcAddr} {
+			if addr != "" && !isLoopback(addr) {
+				fmt.Fprintf(os.Stderr, "error: --token-file is required to listen on %v, which is not a loopback address.\nRun ./sight serve -h for more help.\n", addr)
+				os.Exit(1)
+			}
+		}
+	}
+	apiKey := loadAPIKey(promptApiKey, apiKeyFile)
+	srv := newServer(newClient(apiKey, sight.WithLogger(logger)), logger)
+	srv.tokens = tokens
+	srv.maxUpload = maxUpload << 20
+	if statsFile != "" {
+		var err error
+		if srv.stats, err = loadCorpusStats(statsFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		srv.statsFile = statsFile
+	}
+	if grpcAddr != "" {
+		go func() {
+			if err := srv.serveGRPC(grpcAddr); err != nil {
+				logger.Error("gRPC server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+	if err := srv.run(listen); err != nil {
+		logger.Error("server failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+// jobTTL is how long a job is kept after it is done.
+const jobTTL = time.Hour
+
+// server is the HTTP server of sight serve.
+type server struct {
+	client sight.Recognizer
+	log    *cliLogger
+	// tokens are those clients must send one of, or nil if clients need
+	// not send any, in which case the server only listens on loopback
+	// addresses.
+	tokens    []string
+	maxUpload int64
+	// stats are the statistics of the pages received for every job,
+	// saved to statsFile, if it is set, every minute and when stopping.
+	stats     *corpusStats
+	statsFile string
+
+	mu   sync.Mutex
+	jobs map[string]*serverJob
+}
+
+// serverJob is the state of one POST /recognize.
+type serverJob struct {
+	ID    string
+	Files []string
+
+	mu    sync.Mutex
+	pages []sight.RecognizedPage
+	done  time.Time
+	// changed is closed and replaced whenever a page is received or the
+	// job is done, to wake the requests streaming the job.
+	changed chan struct{}
+}
+
+func newServer(client sight.Recognizer, log *cliLogger) *server {
+	return &server{client: client, log: log, maxUpload: 32 << 20, stats: newCorpusStats(), jobs: make(map[string]*serverJob)}
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/recognize", s.authorized(s.recognize))
+	mux.HandleFunc("/jobs/", s.authorized(s.job))
+	mux.HandleFunc("/stats", s.authorized(s.stats.ServeHTTP))
+	return mux
+}
+
+// run serves on addr until interrupted.
+func (s *server) run(addr string) error {
+	hs := &http.Server{Addr: addr, Handler: s.handler()}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		s.log.Info("interrupted; stopping")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		hs.Shutdown(ctx)
+	}()
+	go s.expireJobs()
+	s.log.Info("serving", "address", addr)
+	if err := hs.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	s.saveStats()
+	return nil
+}
+
+// saveStats writes the statistics to s.statsFile, if it is set.
+func (s *server) saveStats() {
+	if s.statsFile == "" {
+		return
+	}
+	if err := s.stats.save(s.statsFile); err != nil {
+		s.log.Warn("failed to save statistics", "file", s.statsFile, "error", err)
+	}
+}
+
+// expireJobs forgets jobs which have been done for longer than jobTTL, and
+// saves the statistics.
+func (s *server) expireJobs() {
+	for range time.Tick(time.Minute) {
+		s.saveStats()
+		s.mu.Lock()
+		for id, j := range s.jobs {
+			j.mu.Lock()
+			if !j.done.IsZero() && time.Since(j.done) > jobTTL {
+				delete(s.jobs, id)
+			}
+			j.mu.Unlock()
+		}
+		s.mu.Unlock()
+	}
+}
+
+// isLoopback reports whether the host of addr is a loopback address, so
+// that only clients on this machine can connect to it.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// validToken reports whether auth, the value of an Authorization header or
+// of authorization metadata, is "Bearer " followed by one of s.tokens, or
+// whether s has none. Tokens are compared in constant time, and all of
+// them are compared, so that the time taken does not reveal how much of a
+// token was guessed.
+func (s *server) validToken(auth string) bool {
+	if s.tokens == nil {
+		return true
+	}
+	const prefix = "Bearer "
+	if !strings.HasPrefix(auth, prefix) {
+		return false
+	}
+	token := []byte(auth[len(prefix):])
+	valid := 0
+	for _, t := range s.tokens {
+		valid |= subtle.ConstantTimeCompare(token, []byte(t))
+	}
+	return valid == 1
+}
+
+func (s *server) authorized(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.validToken(r.Header.Get("Authorization")) {
+			httpError(w, http.StatusUnauthorized, "a valid bearer token is required")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func httpError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct{ Error string }{msg})
+}
+
+func (s *server) recognize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		httpError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	if err := r.ParseMultipartForm(s.maxUpload); err != nil {
+		httpError(w, http.StatusBadRequest, fmt.Sprintf("invalid multipart form: %v", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	cfg := sight.Config{
+		MakeSentences: r.FormValue("words") != "true",
+		DoExifRotate:  r.FormValue("obey-exif") == "true",
+		DoAutoRotate:  r.FormValue("auto-rotate") == "true",
+		ScriptHints:   make([]string, 0),
+	}
+	if hints := r.FormValue("script-hints"); hints != "" {
+		cfg.ScriptHints = strings.Split(hints, ",")
+		if err := sight.ValidateScriptHints(cfg.ScriptHints); err != nil {
+			httpError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	var files []sight.File
+	for _, fh := range r.MultipartForm.File["file"] {
+		f, err := fh.Open()
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		contents, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			httpError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		routed, err := sight.RouteInput(fh.Filename, contents)
+		if err != nil {
+			httpError(w, http.StatusBadRequest, fmt.Sprintf("%v: %v", fh.Filename, err))
+			return
+		}
+		files = append(files, routed...)
+	}
+	if len(files) == 0 {
+		httpError(w, http.StatusBadRequest, `the form has no files; send them in fields named "file"`)
+		return
+	}
+	pagesChan, err := s.client.RecognizeFiles(cfg, files...)
+	if err != nil {
+		httpError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	j := &serverJob{ID: newJobID(), changed: make(chan struct{})}
+	for _, f := range files {
+		j.Files = append(j.Files, f.Name)
+	}
+	s.mu.Lock()
+	s.jobs[j.ID] = j
+	s.mu.Unlock()
+	s.log.Info("started job", "job", j.ID, "files", len(files), "client", r.RemoteAddr)
+	go j.receive(pagesChan, s.stats, s.log)
+	if r.URL.Query().Get("stream") == "true" {
+		j.stream(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(struct{ ID, URL string }{j.ID, "/jobs/" + j.ID})
+}
+
+func (s *server) job(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	s.mu.Lock()
+	j, ok := s.jobs[id]
+	s.mu.Unlock()
+	if !ok {
+		httpError(w, http.StatusNotFound, "no such job; jobs are forgotten an hour after they are done")
+		return
+	}
+	if r.URL.Query().Get("stream") == "true" {
+		j.stream(w, r)
+		return
+	}
+	j.mu.Lock()
+	status := struct {
+		ID    string
+		Files []string
+		Done  bool
+		Pages []sight.RecognizedPage
+	}{j.ID, j.Files, !j.done.IsZero(), append([]sight.RecognizedPage{}, j.pages...)}
+	j.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// receive records the pages of the job, and adds them to stats, as they are
+// received.
+func (j *serverJob) receive(pagesChan <-chan sight.RecognizedPage, stats *corpusStats, log *cliLogger) {
+	for page := range pagesChan {
+		stats.add(time.Now(), page)
+		j.mu.Lock()
+		j.pages = append(j.pages, page)
+		close(j.changed)
+		j.changed = make(chan struct{})
+		j.mu.Unlock()
+	}
+	j.mu.Lock()
+	j.done = time.Now()
+	close(j.changed)
+	log.Info("job done", "job", j.ID, "pages", len(j.pages))
+	j.mu.Unlock()
+}
+
+// stream writes every page of the job, one JSON object per line, as they
+// are received, and returns once all of them have been written or the
+// client has gone away.
+func (j *serverJob) stream(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	for sent := 0; ; {
+		j.mu.Lock()
+		pages := j.pages[sent:]
+		done := !j.done.IsZero()
+		changed := j.changed
+		j.mu.Unlock()
+		for _, page := range pages {
+			if err := enc.Encode(page); err != nil {
+				return
+			}
+		}
+		sent += len(pages)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// newJobID returns a random, unguessable job ID.
+func newJobID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
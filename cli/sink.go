@@ -0,0 +1,157 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/siftrics/sight"
+	_ "modernc.org/sqlite"
+)
+
+// sinkSchemes are the prefixes of an --output which names a database
+// rather than a file.
+var sinkSchemes = []string{"sqlite://", "elasticsearch+http://", "elasticsearch+https://"}
+
+// isSink reports whether output names a database rather than a file.
+func isSink(output string) bool {
+	for _, scheme := range sinkSchemes {
+		if strings.HasPrefix(output, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// openSink opens the database named by output, one of sinkSchemes. An
+// Elasticsearch index is named by the URL of the cluster, with the scheme
+// prefixed by "elasticsearch+", and the name of the index as its path.
+func openSink(output string) (sight.Sink, error) {
+	if strings.HasPrefix(output, "elasticsearch+") {
+		u, err := url.Parse(strings.TrimPrefix(output, "elasticsearch+"))
+		if err != nil {
+			return nil, err
+		}
+		index := strings.Trim(u.Path, "/")
+		if index == "" || strings.Contains(index, "/") {
+			return nil, fmt.Errorf("the URL must end with the name of the index, e.g., elasticsearch+http://localhost:9200/documents")
+		}
+		u.Path = ""
+		return &sight.ElasticsearchSink{URL: u.String(), Index: index}, nil
+	}
+	path := strings.TrimPrefix(output, "sqlite://")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	sink, err := sight.NewSQLiteSink(db)
+	if err == nil {
+		for _, stmt := range sqliteRunSchema {
+			if _, err = db.Exec(stmt); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return dbSink{sink, db}, nil
+}
+
+// metadataSink is a sink which also stores the metadata of the run, which
+// the json output includes.
+type metadataSink interface {
+	writeMetadata(md *jobMetadata) error
+}
+
+// sqliteRunSchema adds a row to runs for each run which writes to a SQLite
+// database, with its metadata, and a row to jobs for each job the Sight
+// API started for it. Inputs and config are JSON.
+var sqliteRunSchema = []string{
+	`CREATE TABLE IF NOT EXISTS runs (
+		id INTEGER PRIMARY KEY,
+		tool TEXT NOT NULL,
+		version TEXT NOT NULL,
+		go_version TEXT NOT NULL,
+		endpoint TEXT NOT NULL,
+		started TEXT NOT NULL,
+		finished TEXT NOT NULL,
+		inputs TEXT NOT NULL,
+		config TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY,
+		run_id INTEGER NOT NULL REFERENCES runs (id),
+		url TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS jobs_run ON jobs (run_id)`,
+}
+
+// dbSink closes its database when it is closed.
+type dbSink struct {
+	sight.Sink
+	db *sql.DB
+}
+
+func (s dbSink) writeMetadata(md *jobMetadata) error {
+	inputs, err := json.Marshal(md.Inputs)
+	if err != nil {
+		return err
+	}
+	config, err := json.Marshal(md.Config)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`INSERT INTO runs (tool, version, go_version, endpoint, started, finished, inputs, config) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		md.Tool, md.Version, md.GoVersion, md.Endpoint, md.Started.Format(time.RFC3339Nano), md.Finished.Format(time.RFC3339Nano), string(inputs), string(config))
+	if err != nil {
+		return err
+	}
+	runID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for _, job := range md.Jobs {
+		if _, err := tx.Exec(`INSERT INTO jobs (run_id, url) VALUES (?, ?)`, runID, job); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s dbSink) Close() error {
+	if err := s.Sink.Close(); err != nil {
+		s.db.Close()
+		return err
+	}
+	return s.db.Close()
+}
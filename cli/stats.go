@@ -0,0 +1,236 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/siftrics/sight"
+)
+
+// corpusStats keeps rolling statistics about recognized pages, bucketed by
+// UTC day. It is safe for concurrent use, so that a long-running process can
+// update it from one goroutine while serving it from another (see
+// ServeHTTP).
+type corpusStats struct {
+	mu   sync.Mutex
+	days map[string]*dayStats
+}
+
+type dayStats struct {
+	Pages         int
+	ErrorPages    int
+	TextElements  int
+	ConfidenceSum float64
+	ScriptChars   map[string]int
+}
+
+func newCorpusStats() *corpusStats {
+	return &corpusStats{days: make(map[string]*dayStats)}
+}
+
+func (cs *corpusStats) day(date string) *dayStats {
+	d, ok := cs.days[date]
+	if !ok {
+		d = &dayStats{ScriptChars: make(map[string]int)}
+		cs.days[date] = d
+	}
+	return d
+}
+
+// add records a page recognized at time t.
+func (cs *corpusStats) add(t time.Time, page sight.RecognizedPage) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	d := cs.day(t.UTC().Format("2006-01-02"))
+	d.Pages++
+	if page.Error != "" {
+		d.ErrorPages++
+	}
+	for _, rt := range page.RecognizedText {
+		d.TextElements++
+		d.ConfidenceSum += rt.Confidence
+		for code, n := range sight.CountScripts(rt.Text) {
+			d.ScriptChars[code] += n
+		}
+	}
+}
+
+// statsScripts returns the script hint codes in CSV column order.
+func statsScripts() []string {
+	return sight.SupportedScriptCodes()
+}
+
+var statsHeader = []string{"date", "pages", "error_pages", "error_rate", "text_elements", "mean_confidence"}
+
+// writeCSV writes one row per day, oldest first. Script columns hold the
+// number of recognized characters in each script.
+func (cs *corpusStats) writeCSV(w io.Writer) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	scripts := statsScripts()
+	cw := csv.NewWriter(w)
+	header := append([]string(nil), statsHeader...)
+	for _, code := range scripts {
+		header = append(header, "chars_"+code)
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	dates := make([]string, 0, len(cs.days))
+	for date := range cs.days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+	for _, date := range dates {
+		d := cs.days[date]
+		errorRate, meanConfidence := 0.0, 0.0
+		if d.Pages > 0 {
+			errorRate = float64(d.ErrorPages) / float64(d.Pages)
+		}
+		if d.TextElements > 0 {
+			meanConfidence = d.ConfidenceSum / float64(d.TextElements)
+		}
+		row := []string{
+			date,
+			strconv.Itoa(d.Pages),
+			strconv.Itoa(d.ErrorPages),
+			strconv.FormatFloat(errorRate, 'f', 4, 64),
+			strconv.Itoa(d.TextElements),
+			strconv.FormatFloat(meanConfidence, 'f', 4, 64),
+		}
+		for _, code := range scripts {
+			row = append(row, strconv.Itoa(d.ScriptChars[code]))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ServeHTTP responds to GET /stats with the statistics, in the CSV format
+// of the statistics file. They are written to a buffer first, so that a
+// slow client does not hold up add.
+func (cs *corpusStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		httpError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	var buf bytes.Buffer
+	if err := cs.writeCSV(&buf); err != nil {
+		httpError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// readCSV merges rows previously written by writeCSV into cs.
+func (cs *corpusStats) readCSV(r io.Reader) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	header := rows[0]
+	if len(header) < len(statsHeader) || header[0] != statsHeader[0] {
+		return fmt.Errorf("not a statistics file written by this program")
+	}
+	for _, row := range rows[1:] {
+		if len(row) != len(header) {
+			return fmt.Errorf("malformed statistics row for %v", row[0])
+		}
+		d := cs.day(row[0])
+		pages, err1 := strconv.Atoi(row[1])
+		errorPages, err2 := strconv.Atoi(row[2])
+		textElements, err3 := strconv.Atoi(row[4])
+		meanConfidence, err4 := strconv.ParseFloat(row[5], 64)
+		for _, err := range []error{err1, err2, err3, err4} {
+			if err != nil {
+				return fmt.Errorf("malformed statistics row for %v: %v", row[0], err)
+			}
+		}
+		d.Pages += pages
+		d.ErrorPages += errorPages
+		d.TextElements += textElements
+		d.ConfidenceSum += meanConfidence * float64(textElements)
+		for i := len(statsHeader); i < len(header); i++ {
+			n, err := strconv.Atoi(row[i])
+			if err != nil {
+				return fmt.Errorf("malformed statistics row for %v: %v", row[0], err)
+			}
+			if len(header[i]) > len("chars_") {
+				d.ScriptChars[header[i][len("chars_"):]] += n
+			}
+		}
+	}
+	return nil
+}
+
+// loadCorpusStats reads the statistics file at path, if it exists.
+func loadCorpusStats(path string) (*corpusStats, error) {
+	cs := newCorpusStats()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return cs, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if err := cs.readCSV(f); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return cs, nil
+}
+
+// save writes the statistics to path, replacing the file atomically.
+func (cs *corpusStats) save(path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := cs.writeCSV(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
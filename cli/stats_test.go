@@ -0,0 +1,102 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/siftrics/sight"
+)
+
+func TestCorpusStatsServeHTTP(t *testing.T) {
+	cs := newCorpusStats()
+	day := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	cs.add(day, sight.RecognizedPage{RecognizedText: []sight.RecognizedText{{Text: "abc", Confidence: 0.5}}})
+	cs.add(day, sight.RecognizedPage{Error: "failed"})
+
+	rec := httptest.NewRecorder()
+	cs.ServeHTTP(rec, httptest.NewRequest("GET", "/stats", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("GET /stats responded %v with %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "date,pages,") || !strings.HasPrefix(lines[1], "2020-03-01,2,1,0.5000,1,0.5000,") {
+		t.Errorf("GET /stats responded with\n%v", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	cs.ServeHTTP(rec, httptest.NewRequest("POST", "/stats", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /stats responded %v; want 405", rec.Code)
+	}
+}
+
+func TestServerStatsRequiresToken(t *testing.T) {
+	s := newServer(nil, &cliLogger{})
+	s.tokens = []string{"secret"}
+	for _, tt := range []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Basic secret", http.StatusUnauthorized},
+		{"Bearer ", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", "/stats", nil)
+		if tt.auth != "" {
+			req.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		s.handler().ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("GET /stats with %q responded %v; want %v", tt.auth, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestValidToken(t *testing.T) {
+	s := newServer(nil, &cliLogger{})
+	if !s.validToken("") {
+		t.Errorf("validToken(%q) = false with no tokens; want true", "")
+	}
+	s.tokens = []string{"secret", "other"}
+	for auth, want := range map[string]bool{
+		"Bearer secret":  true,
+		"Bearer other":   true,
+		"secret":         false,
+		"bearer secret":  false,
+		"Bearer  secret": false,
+		"Bearer secret2": false,
+		"Bearer ":        false,
+		"":               false,
+	} {
+		if got := s.validToken(auth); got != want {
+			t.Errorf("validToken(%q) = %v; want %v", auth, got, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// objectStore is a cloud storage service whose objects are named by URLs
+// such as s3://bucket/key or gs://bucket/key. Inputs can be read from it
+// and output files written to it without touching the local disk.
+type objectStore interface {
+	// list returns the keys of the objects in bucket which begin with
+	// prefix.
+	list(ctx context.Context, bucket, prefix string) ([]string, error)
+	read(ctx context.Context, bucket, key string) ([]byte, error)
+	write(ctx context.Context, bucket, key string, data []byte) error
+}
+
+// objectStores opens the object store of each URL scheme. Stores are
+// opened when they are first used, so credentials are only needed for the
+// stores a run uses.
+var objectStores = map[string]func(ctx context.Context) (objectStore, error){
+	"s3": newS3Store,
+	"gs": newGCSStore,
+	"az": newAzureStore,
+}
+
+var (
+	openStoresMu sync.Mutex
+	openStores   = make(map[string]objectStore)
+)
+
+// isRemote reports whether name is the URL of an object in an object store
+// rather than a local path.
+func isRemote(name string) bool {
+	i := strings.Index(name, "://")
+	if i < 0 {
+		return false
+	}
+	_, ok := objectStores[name[:i]]
+	return ok
+}
+
+// remoteObject opens the object store of name, a URL for which isRemote is
+// true, and splits it into its bucket and key.
+func remoteObject(name string) (store objectStore, bucket, key string, err error) {
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if u.Host == "" {
+		return nil, "", "", fmt.Errorf("%v does not name a bucket", name)
+	}
+	openStoresMu.Lock()
+	defer openStoresMu.Unlock()
+	store, ok := openStores[u.Scheme]
+	if !ok {
+		store, err = objectStores[u.Scheme](context.Background())
+		if err != nil {
+			return nil, "", "", fmt.Errorf("failed to open %v: %v", name, err)
+		}
+		openStores[u.Scheme] = store
+	}
+	return store, u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// expandRemote returns the URLs of the objects named by name: the object
+// itself if there is one with its exact name, and otherwise those in the
+// "directory" it names.
+func expandRemote(name string) ([]string, error) {
+	store, bucket, key, err := remoteObject(name)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := store.list(context.Background(), bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	dir := key
+	if dir != "" && !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	scheme := name[:strings.Index(name, "://")]
+	var urls []string
+	for _, k := range keys {
+		// Consoles create empty objects ending in a slash to stand
+		// for directories.
+		if k == key && !strings.HasSuffix(k, "/") {
+			return []string{name}, nil
+		}
+		if strings.HasPrefix(k, dir) && !strings.HasSuffix(k, "/") {
+			urls = append(urls, scheme+"://"+bucket+"/"+k)
+		}
+	}
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no objects were found at %v", name)
+	}
+	return urls, nil
+}
+
+// remoteExists reports whether there is an object named name.
+func remoteExists(name string) (bool, error) {
+	store, bucket, key, err := remoteObject(name)
+	if err != nil {
+		return false, err
+	}
+	keys, err := store.list(context.Background(), bucket, key)
+	if err != nil {
+		return false, err
+	}
+	for _, k := range keys {
+		if k == key {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// readInput reads the input file or object named name.
+func readInput(name string) ([]byte, error) {
+	if !isRemote(name) {
+		return ioutil.ReadFile(name)
+	}
+	store, bucket, key, err := remoteObject(name)
+	if err != nil {
+		return nil, err
+	}
+	return store.read(context.Background(), bucket, key)
+}
+
+// remoteFile is an output file which is kept in memory and uploaded to an
+// object store when it is committed, so that, like an atomicFile, nothing
+// appears at its destination until the run is complete.
+type remoteFile struct {
+	bytes.Buffer
+	dest string
+}
+
+func (f *remoteFile) commit() error {
+	store, bucket, key, err := remoteObject(f.dest)
+	if err != nil {
+		return err
+	}
+	return store.write(context.Background(), bucket, key, f.Bytes())
+}
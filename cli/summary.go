@@ -0,0 +1,182 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/siftrics/sight"
+)
+
+// fileSummary describes the pages recognized in one input file.
+type fileSummary struct {
+	pages       int
+	errorPages  int
+	autoRotated int
+	// orientations counts pages by the orientation of most of their text.
+	orientations map[int]int
+	scriptChars  map[string]int
+}
+
+// runSummary collects a fileSummary per input file for the summary printed
+// at the end of a run.
+type runSummary struct {
+	inputFiles []string
+	files      []fileSummary
+	started    time.Time
+	// processing holds the ProcessingDuration of each page which has one.
+	processing []time.Duration
+}
+
+func newRunSummary(inputFiles []string) *runSummary {
+	rs := &runSummary{inputFiles: inputFiles, files: make([]fileSummary, len(inputFiles)), started: time.Now()}
+	for i := range rs.files {
+		rs.files[i].orientations = make(map[int]int)
+		rs.files[i].scriptChars = make(map[string]int)
+	}
+	return rs
+}
+
+func (rs *runSummary) add(page sight.RecognizedPage) {
+	if page.FileIndex < 0 || page.FileIndex >= len(rs.files) {
+		return
+	}
+	fs := &rs.files[page.FileIndex]
+	fs.pages++
+	if page.ProcessingDuration > 0 {
+		rs.processing = append(rs.processing, page.ProcessingDuration)
+	}
+	if page.Error != "" {
+		fs.errorPages++
+		return
+	}
+	if page.Base64Image != "" {
+		fs.autoRotated++
+	}
+	if len(page.RecognizedText) != 0 {
+		fs.orientations[sight.PageOrientation(page)]++
+	}
+	for _, t := range page.RecognizedText {
+		for code, n := range sight.CountScripts(t.Text) {
+			fs.scriptChars[code] += n
+		}
+	}
+}
+
+// write prints the summary of every file, followed by suggestions for
+// --auto-rotate and --script-hints.
+func (rs *runSummary) write(w io.Writer, cfg sight.Config) {
+	fmt.Fprintf(w, "\nSummary:\n")
+	totalScriptChars := make(map[string]int)
+	rotatedPages := 0
+	for i, fs := range rs.files {
+		fmt.Fprintf(w, " %v: %v pages", rs.inputFiles[i], fs.pages)
+		if fs.errorPages != 0 {
+			fmt.Fprintf(w, " (%v with errors)", fs.errorPages)
+		}
+		fmt.Fprintln(w)
+		if len(fs.orientations) != 0 {
+			var parts []string
+			for _, deg := range []int{0, 90, 180, 270} {
+				if n := fs.orientations[deg]; n != 0 {
+					parts = append(parts, fmt.Sprintf("%v° on %v pages", deg, n))
+					if deg != 0 {
+						rotatedPages += n
+					}
+				}
+			}
+			fmt.Fprintf(w, "   text orientation: %v\n", strings.Join(parts, ", "))
+		}
+		if fs.autoRotated != 0 {
+			fmt.Fprintf(w, "   auto-rotated pages: %v\n", fs.autoRotated)
+		}
+		if len(fs.scriptChars) != 0 {
+			fmt.Fprintf(w, "   scripts: %v\n", formatScriptShares(fs.scriptChars))
+		}
+		for code, n := range fs.scriptChars {
+			totalScriptChars[code] += n
+		}
+	}
+	if rotatedPages != 0 && !cfg.DoAutoRotate {
+		fmt.Fprintf(w, "Hint: %v pages contain mostly sideways or upside-down text; consider --auto-rotate.\n", rotatedPages)
+	}
+	if len(cfg.ScriptHints) == 0 && len(totalScriptChars) != 0 {
+		var hints []string
+		total := 0
+		for _, n := range totalScriptChars {
+			total += n
+		}
+		for code, n := range totalScriptChars {
+			if float64(n) >= sight.MinScriptShare*float64(total) {
+				hints = append(hints, code)
+			}
+		}
+		sort.Strings(hints)
+		fmt.Fprintf(w, "Hint: the text is mostly in these scripts; consider --script-hints %v\n", strings.Join(hints, ","))
+	}
+}
+
+// writeTiming prints the wall time of the run, the throughput and, if any
+// page was received from the Sight API, the distribution of the time from
+// submission to receipt, for monitoring service levels.
+func (rs *runSummary) writeTiming(w io.Writer) {
+	elapsed := time.Since(rs.started)
+	pages := 0
+	for _, fs := range rs.files {
+		pages += fs.pages
+	}
+	fmt.Fprintf(w, "Recognized %v pages in %v (%.2f pages/s)", pages, elapsed.Round(time.Millisecond), float64(pages)/elapsed.Seconds())
+	if n := len(rs.processing); n != 0 {
+		sorted := append([]time.Duration(nil), rs.processing...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		percentile := func(p float64) time.Duration {
+			return sorted[int(p*float64(n-1)+0.5)].Round(time.Millisecond)
+		}
+		fmt.Fprintf(w, "; time per page from submission: median %v, 95th percentile %v, max %v", percentile(0.5), percentile(0.95), sorted[n-1].Round(time.Millisecond))
+	}
+	fmt.Fprintln(w)
+}
+
+// formatScriptShares formats character counts per script as percentages,
+// most common first.
+func formatScriptShares(counts map[string]int) string {
+	total := 0
+	codes := make([]string, 0, len(counts))
+	for code, n := range counts {
+		total += n
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if counts[codes[i]] != counts[codes[j]] {
+			return counts[codes[i]] > counts[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	parts := make([]string, len(codes))
+	for i, code := range codes {
+		parts[i] = fmt.Sprintf("%v %.0f%%", code, 100*float64(counts[code])/float64(total))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,153 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/siftrics/sight"
+)
+
+// templateData is what --template files are executed with.
+type templateData struct {
+	// Files are the input files, in the order they were given.
+	Files []templateFile
+	// Pages are the pages of every file, grouped by file and in page
+	// order.
+	Pages    []sight.RecognizedPage
+	Metadata *jobMetadata
+}
+
+// templateFile is an input file and its pages, in page order.
+type templateFile struct {
+	Name  string
+	Index int
+	Pages []sight.RecognizedPage
+}
+
+// templateFuncs are the functions available to --template files, besides
+// those built into text/template.
+var templateFuncs = template.FuncMap{
+	// text joins the recognized text of a page, one sentence (or word)
+	// per line.
+	"text": func(page sight.RecognizedPage) string {
+		lines := make([]string, len(page.RecognizedText))
+		for i, t := range page.RecognizedText {
+			lines[i] = t.Text
+		}
+		return strings.Join(lines, "\n")
+	},
+	"xml": func(s string) (string, error) {
+		var b strings.Builder
+		err := xml.EscapeText(&b, []byte(s))
+		return b.String(), err
+	},
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"csv": func(s string) string {
+		if strings.ContainsAny(s, "\",\r\n") {
+			return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+		}
+		return s
+	},
+	// pad and padLeft fit a value into a fixed-width column, truncating
+	// it if it is too long, for fixed-width exports.
+	"pad": func(width int, v interface{}) string {
+		s, n := fitWidth(fmt.Sprint(v), width)
+		return s + strings.Repeat(" ", width-n)
+	},
+	"padLeft": func(width int, v interface{}) string {
+		s, n := fitWidth(fmt.Sprint(v), width)
+		return strings.Repeat(" ", width-n) + s
+	},
+	"oneLine": tableCell,
+	"base":    filepath.Base,
+	"join":    strings.Join,
+	"upper":   strings.ToUpper,
+	"lower":   strings.ToLower,
+	"trim":    strings.TrimSpace,
+	"replace": func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+	"add":     func(a, b int) int { return a + b },
+}
+
+// fitWidth truncates s to at most width characters and returns it with its
+// length in characters.
+func fitWidth(s string, width int) (string, int) {
+	n := 0
+	for i := range s {
+		if n == width {
+			return s[:i], n
+		}
+		n++
+	}
+	return s, n
+}
+
+// loadTemplate parses the template file at path.
+func loadTemplate(path string) (*template.Template, error) {
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(filepath.Base(path)).Funcs(templateFuncs).Parse(string(text))
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// writeTemplate executes tmpl with pages, which are grouped by input file
+// and sorted by page number first. Like the text and table formats, it is
+// only written once all pages have been recognized.
+func writeTemplate(w io.Writer, tmpl *template.Template, pages []sight.RecognizedPage, inputFiles []string, metadata *jobMetadata) error {
+	data := templateData{
+		Files:    make([]templateFile, len(inputFiles)),
+		Pages:    make([]sight.RecognizedPage, len(pages)),
+		Metadata: metadata,
+	}
+	copy(data.Pages, pages)
+	sort.SliceStable(data.Pages, func(i, j int) bool {
+		if data.Pages[i].FileIndex != data.Pages[j].FileIndex {
+			return data.Pages[i].FileIndex < data.Pages[j].FileIndex
+		}
+		return data.Pages[i].PageNumber < data.Pages[j].PageNumber
+	})
+	for i, name := range inputFiles {
+		data.Files[i] = templateFile{Name: name, Index: i}
+	}
+	for _, page := range data.Pages {
+		if page.FileIndex >= 0 && page.FileIndex < len(data.Files) {
+			f := &data.Files[page.FileIndex]
+			f.Pages = append(f.Pages, page)
+		}
+	}
+	return tmpl.Execute(w, data)
+}
@@ -0,0 +1,127 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/siftrics/sight"
+)
+
+const usageUsage = `usage: ./sight usage <--prompt-api-key|--api-key-file filename>
+
+Prints the pages recognized in the current billing period, the remaining quota and the
+state of the rate limit of your account. Nothing is billed.
+
+example:
+ ./sight usage --api-key-file my_api_key.txt --min-remaining 5000
+
+optional flags:
+ [--json]              Print the usage as JSON.
+ [--min-remaining n]   Exit with status 2 if fewer than n pages of the quota remain, so that
+                         a script can stop before a batch is charged as overage.
+`
+
+func usageMain(args []string) {
+	promptApiKey, asJSON := false, false
+	var apiKeyFile string
+	minRemaining := -1
+	for i := 0; i < len(args); i++ {
+		s := args[i]
+		switch s {
+		case "-h", "--help":
+			fmt.Fprint(os.Stderr, usageUsage)
+			os.Exit(1)
+		case "--prompt-api-key":
+			promptApiKey = true
+		case "--api-key-file":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: --api-key-file was specified but no filename came after it.\nRun ./sight usage -h for more help.\n")
+				os.Exit(1)
+			}
+			i++
+			apiKeyFile = args[i]
+		case "--json":
+			asJSON = true
+		case "--min-remaining":
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: --min-remaining was specified but no number of pages came after it.\nRun ./sight usage -h for more help.\n")
+				os.Exit(1)
+			}
+			i++
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 {
+				fmt.Fprintf(os.Stderr, "error: --min-remaining must be followed by a number of pages.\nRun ./sight usage -h for more help.\n")
+				os.Exit(1)
+			}
+			minRemaining = n
+		default:
+			fmt.Fprintf(os.Stderr, "error: unexpected argument %v.\nRun ./sight usage -h for more help.\n", s)
+			os.Exit(1)
+		}
+	}
+	if !promptApiKey && apiKeyFile == "" {
+		fmt.Fprint(os.Stderr, usageUsage)
+		os.Exit(1)
+	}
+	client := newClient(loadAPIKey(promptApiKey, apiKeyFile))
+	u, err := client.Usage(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(u)
+	} else {
+		writeUsage(u)
+	}
+	if minRemaining >= 0 && u.PageQuota > 0 && u.PagesRemaining < minRemaining {
+		fmt.Fprintf(os.Stderr, "error: only %v pages of the quota remain, fewer than %v.\n", u.PagesRemaining, minRemaining)
+		os.Exit(2)
+	}
+}
+
+// writeUsage prints u for a person to read.
+func writeUsage(u sight.Usage) {
+	if !u.PeriodStart.IsZero() {
+		fmt.Printf("Billing period:  %v to %v\n", u.PeriodStart.Format("2006-01-02"), u.PeriodEnd.Format("2006-01-02"))
+	}
+	fmt.Printf("Pages processed: %v\n", u.PagesProcessed)
+	if u.PageQuota > 0 {
+		fmt.Printf("Page quota:      %v (%v remaining)\n", u.PageQuota, u.PagesRemaining)
+	} else {
+		fmt.Printf("Page quota:      none\n")
+	}
+	if rl := u.RateLimit; rl.Limit > 0 {
+		fmt.Printf("Rate limit:      %v of %v requests remaining", rl.Remaining, rl.Limit)
+		if !rl.Reset.IsZero() {
+			fmt.Printf(", resets in %v", time.Until(rl.Reset).Round(time.Second))
+		}
+		fmt.Printf("\n")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/normalize"
+)
+
+// addNormalization makes cfg normalize the recognized text in the ways of
+// m before any other PostProcessor. The correction to cfg.Vocabulary is
+// moved after it, so that text is normalized before it is corrected.
+func addNormalization(cfg *sight.Config, m normalize.Mode) {
+	if m == 0 {
+		return
+	}
+	processors := []sight.PostProcessor{m}
+	if len(cfg.Vocabulary) > 0 {
+		processors = append(processors, sight.NewVocabulary(cfg.Vocabulary))
+		cfg.Vocabulary = nil
+	}
+	cfg.PostProcessors = append(processors, cfg.PostProcessors...)
+}
+
+// loadVocabulary reads the file of vocabulary terms at path, one per line.
+// Blank lines and lines starting with # are skipped.
+func loadVocabulary(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var terms []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		terms = append(terms, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return terms, nil
+}
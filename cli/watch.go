@@ -0,0 +1,329 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/siftrics/sight"
+)
+
+const watchUsage = `usage: ./sight watch <directory> <--prompt-api-key|--api-key-file filename> <-o output directory>
+
+Watches a directory and recognizes text in every image or document which appears in it,
+including those already there when the command starts. The results for each file are
+written to <output directory>/<file name>.json. Files whose results already exist are skipped.
+
+example:
+ ./sight watch inbox/ -o results/ --done-dir done/ --api-key-file my_api_key.txt
+
+optional flags:
+ [--done-dir directory] Move each file into this directory once it has been processed.
+ [--settle seconds]     How long a file must go unmodified before it is processed, so that
+                          files are not read while they are still being written. Defaults to 2.
+ [-w|--words]           Return word-level bounding boxes.
+ [-e|--obey-exif]       Use EXIF orientation for bounding box coordinate system.
+ [-r|--auto-rotate]     Rotate images so the majority of the text is upright.
+ [-s|--script-hints]    Comma-delimited script hint codes, e.g., latin,cyrillic.
+ [--stats-csv filename] Keep rolling daily statistics in a CSV file.
+ [--stats-listen address]
+                        Serve the daily statistics, as CSV, at GET /stats on this address,
+                          e.g., 127.0.0.1:9100. Anyone who can reach it can read them.
+ [-v|--verbose]         Log every polling attempt and other details.
+ [--log-json]           Write log messages as JSON objects, one per line.
+`
+
+// watchMain implements "sight watch", a drop-folder daemon: it watches a
+// directory with fsnotify and recognizes text in each file that appears.
+func watchMain(args []string) {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprint(os.Stderr, watchUsage)
+		os.Exit(1)
+	}
+	cfg := sight.Config{MakeSentences: true, ScriptHints: make([]string, 0)}
+	logger := &cliLogger{minLevel: levelInfo}
+	promptApiKey := false
+	var watchDir, apiKeyFile, outputDir, doneDir, statsFile, statsListen string
+	settle := 2 * time.Second
+	for i := 0; i < len(args); i++ {
+		s := args[i]
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "error: %v was specified but no value came after it.\nRun ./sight watch -h for more help.\n", s)
+				os.Exit(1)
+			}
+			i++
+			return args[i]
+		}
+		switch s {
+		case "--prompt-api-key":
+			promptApiKey = true
+		case "--api-key-file":
+			apiKeyFile = value()
+		case "-o", "--output":
+			outputDir = value()
+		case "--done-dir":
+			doneDir = value()
+		case "--settle":
+			var seconds float64
+			if _, err := fmt.Sscan(value(), &seconds); err != nil || seconds < 0 {
+				fmt.Fprintf(os.Stderr, "error: --settle must be followed by a number of seconds.\n")
+				os.Exit(1)
+			}
+			settle = time.Duration(seconds * float64(time.Second))
+		case "--stats-csv":
+			statsFile = value()
+		case "--stats-listen":
+			statsListen = value()
+		case "-w", "--words":
+			cfg.MakeSentences = false
+		case "-e", "--obey-exif":
+			cfg.DoExifRotate = true
+		case "-r", "--auto-rotate":
+			cfg.DoAutoRotate = true
+		case "-s", "--script-hints":
+			cfg.ScriptHints = strings.Split(value(), ",")
+			if err := sight.ValidateScriptHints(cfg.ScriptHints); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		case "-v", "--verbose":
+			logger.minLevel = levelDebug
+		case "--log-json":
+			logger.json = true
+		default:
+			if watchDir != "" || strings.HasPrefix(s, "-") {
+				fmt.Fprintf(os.Stderr, "error: unexpected argument %v.\nRun ./sight watch -h for more help.\n", s)
+				os.Exit(1)
+			}
+			watchDir = s
+		}
+	}
+	if watchDir == "" || outputDir == "" {
+		fmt.Fprintf(os.Stderr, "error: You must specify a directory to watch and an output directory (-o).\nRun ./sight watch -h for more help.\n")
+		os.Exit(1)
+	}
+	for _, dir := range []string{outputDir, doneDir} {
+		if dir == "" {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var stats *corpusStats
+	if statsFile != "" {
+		var err error
+		if stats, err = loadCorpusStats(statsFile); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if statsListen != "" {
+		if stats == nil {
+			stats = newCorpusStats()
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/stats", stats)
+		go func() {
+			logger.Info("serving statistics", "address", statsListen)
+			if err := http.ListenAndServe(statsListen, mux); err != nil {
+				logger.Error("statistics server failed", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+	apiKey := loadAPIKey(promptApiKey, apiKeyFile)
+	w := &watcher{
+		client:    newClient(apiKey, sight.WithLogger(logger)),
+		cfg:       cfg,
+		log:       logger,
+		outputDir: outputDir,
+		doneDir:   doneDir,
+		stats:     stats,
+		statsFile: statsFile,
+	}
+	if err := w.run(watchDir, settle); err != nil {
+		logger.Error("watch failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+type watcher struct {
+	client    sight.Recognizer
+	cfg       sight.Config
+	log       *cliLogger
+	outputDir string
+	doneDir   string
+	stats     *corpusStats
+	statsFile string
+}
+
+// run watches dir until interrupted. A file is processed once no event has
+// been seen for it for the settle duration.
+func (w *watcher) run(dir string, settle time.Duration) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer fsw.Close()
+	if err := fsw.Add(dir); err != nil {
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+
+	// pending maps paths to the time of their most recent event.
+	pending := make(map[string]time.Time)
+	existing, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range existing {
+		if fi.Mode().IsRegular() {
+			pending[filepath.Join(dir, fi.Name())] = time.Time{}
+		}
+	}
+	w.log.Info("watching for new files", "dir", dir, "existing", len(pending))
+	ticker := time.NewTicker(settle/4 + 100*time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-interrupt:
+			w.log.Info("interrupted; stopping")
+			return nil
+		case ev, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op&(fsnotify.Create|fsnotify.Write|fsnotify.Chmod) != 0 {
+				pending[ev.Name] = time.Now()
+			} else if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				delete(pending, ev.Name)
+			}
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			w.log.Warn("error watching directory", "dir", dir, "error", err)
+		case now := <-ticker.C:
+			var ready []string
+			for path, last := range pending {
+				if now.Sub(last) >= settle {
+					ready = append(ready, path)
+				}
+			}
+			sort.Strings(ready)
+			for _, path := range ready {
+				delete(pending, path)
+				w.process(path)
+			}
+		}
+	}
+}
+
+// process recognizes the text in one file and writes the results.
+func (w *watcher) process(path string) {
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return
+	}
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") {
+		return
+	}
+	dest := filepath.Join(w.outputDir, name+".json")
+	if _, err := os.Stat(dest); err == nil {
+		w.log.Debug("skipping file whose results already exist", "file", path, "output", dest)
+		return
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		w.log.Error("failed to read file", "file", path, "error", err)
+		return
+	}
+	files, err := sight.RouteInput(path, contents)
+	if err != nil {
+		w.log.Warn("skipping file which cannot be submitted", "file", path, "error", err)
+		return
+	}
+	cfg := w.cfg
+	metadata := newJobMetadata(cfg, []string{path})
+	cfg.OnJobStarted = metadata.addJob
+	pagesChan, err := w.client.RecognizeFiles(cfg, files...)
+	if err != nil {
+		w.log.Error("failed to recognize file", "file", path, "error", err)
+		return
+	}
+	var results struct {
+		Pages    []sight.RecognizedPage
+		Metadata *jobMetadata
+	}
+	for page := range pagesChan {
+		results.Pages = append(results.Pages, page)
+		if w.stats != nil {
+			w.stats.add(time.Now(), page)
+		}
+	}
+	results.Metadata = metadata.finish()
+	buf, err := json.Marshal(&results)
+	if err != nil {
+		w.log.Error("failed to serialize JSON", "file", path, "error", err)
+		return
+	}
+	tmp := dest + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf, 0644); err != nil {
+		w.log.Error("failed to write results", "file", path, "output", dest, "error", err)
+		return
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		w.log.Error("failed to write results", "file", path, "output", dest, "error", err)
+		return
+	}
+	w.log.Info("recognized file", "file", path, "pages", len(results.Pages), "output", dest)
+	if w.statsFile != "" {
+		if err := w.stats.save(w.statsFile); err != nil {
+			w.log.Warn("failed to save statistics", "file", w.statsFile, "error", err)
+		}
+	}
+	if w.doneDir != "" {
+		done, err := unusedFileName(filepath.Join(w.doneDir, name))
+		if err == nil {
+			err = os.Rename(path, done)
+		}
+		if err != nil {
+			w.log.Warn("failed to move processed file", "file", path, "dir", w.doneDir, "error", err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// CropBox returns the part of img under the bounding box of t, extended by
+// padding pixels on every side, e.g., to pass a signature or a single field
+// to another classifier. img must be the image in whose coordinates t is
+// located: the image submitted, the auto-rotated image of its page (see
+// DecodeRotatedImage) or a PDF page rendered at the DPI of its page.
+//
+// If the box is an upright rectangle and img has a SubImage method, as the
+// images of the standard library do, the sub-image is returned, sharing
+// pixels with img. Otherwise the quadrilateral is mapped onto an upright
+// rectangle as wide as its longer horizontal edge and as tall as its longer
+// vertical edge, so that rotated and skewed text comes out level, and the
+// pixels are interpolated into a new *image.RGBA. Parts of the crop which
+// lie outside img are transparent.
+func CropBox(img image.Image, t RecognizedText, padding int) image.Image {
+	if padding < 0 {
+		padding = 0
+	}
+	bounds := img.Bounds()
+	if t.TopLeftY == t.TopRightY && t.BottomLeftY == t.BottomRightY && t.TopLeftX == t.BottomLeftX && t.TopRightX == t.BottomRightX &&
+		t.TopLeftX < t.TopRightX && t.TopLeftY < t.BottomLeftY {
+		if sub, ok := img.(interface {
+			SubImage(r image.Rectangle) image.Image
+		}); ok {
+			r := image.Rect(t.TopLeftX, t.TopLeftY, t.TopRightX, t.BottomLeftY)
+			return sub.SubImage(r.Inset(-padding).Add(bounds.Min).Intersect(bounds))
+		}
+	}
+	dist := func(x0, y0, x1, y1 int) float64 {
+		return math.Hypot(float64(x1-x0), float64(y1-y0))
+	}
+	w := int(math.Ceil(math.Max(dist(t.TopLeftX, t.TopLeftY, t.TopRightX, t.TopRightY), dist(t.BottomLeftX, t.BottomLeftY, t.BottomRightX, t.BottomRightY))))
+	h := int(math.Ceil(math.Max(dist(t.TopLeftX, t.TopLeftY, t.BottomLeftX, t.BottomLeftY), dist(t.TopRightX, t.TopRightY, t.BottomRightX, t.BottomRightY))))
+	if w == 0 || h == 0 {
+		return image.NewRGBA(image.Rectangle{})
+	}
+	crop := image.NewRGBA(image.Rect(0, 0, w+2*padding, h+2*padding))
+	// lerp interpolates between the corners of the box, where u and v
+	// are fractions of its width and height, beyond 0 and 1 in the padding.
+	lerp := func(tl, tr, bl, br int, u, v float64) float64 {
+		top := float64(tl) + (float64(tr)-float64(tl))*u
+		bottom := float64(bl) + (float64(br)-float64(bl))*u
+		return top + (bottom-top)*v
+	}
+	for y := 0; y < h+2*padding; y++ {
+		v := (float64(y-padding) + 0.5) / float64(h)
+		for x := 0; x < w+2*padding; x++ {
+			u := (float64(x-padding) + 0.5) / float64(w)
+			sx := lerp(t.TopLeftX, t.TopRightX, t.BottomLeftX, t.BottomRightX, u, v) + float64(bounds.Min.X)
+			sy := lerp(t.TopLeftY, t.TopRightY, t.BottomLeftY, t.BottomRightY, u, v) + float64(bounds.Min.Y)
+			crop.SetRGBA(x, y, sample(img, bounds, sx, sy))
+		}
+	}
+	return crop
+}
+
+// sample returns the color of img at the point (x, y), interpolated between
+// the four pixels nearest to it, or transparent if it is outside bounds.
+func sample(img image.Image, bounds image.Rectangle, x, y float64) color.RGBA {
+	if x < float64(bounds.Min.X) || y < float64(bounds.Min.Y) || x >= float64(bounds.Max.X) || y >= float64(bounds.Max.Y) {
+		return color.RGBA{}
+	}
+	// Pixel centers are at half-integer coordinates.
+	x, y = x-0.5, y-0.5
+	x0, y0 := int(math.Floor(x)), int(math.Floor(y))
+	fx, fy := x-float64(x0), y-float64(y0)
+	clamp := func(v, min, max int) int {
+		if v < min {
+			return min
+		}
+		if v > max-1 {
+			return max - 1
+		}
+		return v
+	}
+	var sum [4]float64
+	for _, n := range [4]struct {
+		dx, dy int
+		weight float64
+	}{{0, 0, (1 - fx) * (1 - fy)}, {1, 0, fx * (1 - fy)}, {0, 1, (1 - fx) * fy}, {1, 1, fx * fy}} {
+		r, g, b, a := img.At(clamp(x0+n.dx, bounds.Min.X, bounds.Max.X), clamp(y0+n.dy, bounds.Min.Y, bounds.Max.Y)).RGBA()
+		sum[0] += float64(r) * n.weight
+		sum[1] += float64(g) * n.weight
+		sum[2] += float64(b) * n.weight
+		sum[3] += float64(a) * n.weight
+	}
+	return color.RGBA{uint8(sum[0]/257 + 0.5), uint8(sum[1]/257 + 0.5), uint8(sum[2]/257 + 0.5), uint8(sum[3]/257 + 0.5)}
+}
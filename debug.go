@@ -0,0 +1,231 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithDebugTransport makes the Client write a description of every HTTP
+// exchange with the Sight API to w, for troubleshooting: the method and URL
+// of the request, the status of the response, how long it took, the
+// headers and the start of both bodies. The API key and other credentials
+// are redacted, and base64 data, such as the contents of the files
+// submitted, is replaced by its length. w is written to from several
+// goroutines, but one exchange at a time.
+func WithDebugTransport(w io.Writer) Option {
+	return func(c *Client) {
+		c.debugOut = w
+	}
+}
+
+const (
+	// maxDebugBody is the most bytes of a body which are written by
+	// WithDebugTransport, after base64 data has been elided.
+	maxDebugBody = 4 << 10
+	// minElidedBase64 is the length of the shortest run of base64
+	// characters which is elided from bodies.
+	minElidedBase64 = 64
+)
+
+// redactedHeaders are the headers whose values are not written.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// debugTransport is the transport of a Client made with WithDebugTransport.
+// An exchange is written once the body of its response is closed, so that
+// the body can be included.
+type debugTransport struct {
+	base http.RoundTripper
+	w    io.Writer
+
+	mu sync.Mutex
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	var reqBody bodyCapture
+	if req.Body != nil {
+		req = req.Clone(req.Context())
+		req.Body = &captureReader{req.Body, &reqBody}
+	}
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	latency := time.Since(start)
+	// The body of the request has been sent, as far as it will be, so it
+	// can be described now.
+	var b strings.Builder
+	fmt.Fprintf(&b, "--> %v %v\n", req.Method, req.URL.Redacted())
+	writeHeaders(&b, req.Header)
+	writeBody(&b, &reqBody)
+	if err != nil {
+		fmt.Fprintf(&b, "<-- error after %v: %v\n\n", latency, err)
+		t.write(b.String())
+		return nil, err
+	}
+	fmt.Fprintf(&b, "<-- %v (%v)\n", resp.Status, latency)
+	writeHeaders(&b, resp.Header)
+	respBody := &debugBody{ReadCloser: resp.Body}
+	respBody.onClose = func() {
+		writeBody(&b, &respBody.capture)
+		b.WriteString("\n")
+		t.write(b.String())
+	}
+	resp.Body = respBody
+	return resp, nil
+}
+
+func (t *debugTransport) write(s string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	io.WriteString(t.w, s)
+}
+
+// writeHeaders writes h, sorted, with the values of redactedHeaders
+// replaced.
+func writeHeaders(b *strings.Builder, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range h[name] {
+			if redactedHeaders[http.CanonicalHeaderKey(name)] {
+				v = "[redacted]"
+			}
+			fmt.Fprintf(b, "    %v: %v\n", name, v)
+		}
+	}
+}
+
+func writeBody(b *strings.Builder, c *bodyCapture) {
+	if s := c.String(); s != "" {
+		fmt.Fprintf(b, "    %v\n", s)
+	}
+}
+
+// captureReader copies what is read from a request body to a bodyCapture.
+type captureReader struct {
+	io.ReadCloser
+	capture *bodyCapture
+}
+
+func (r *captureReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.capture.Write(p[:n])
+	return n, err
+}
+
+// debugBody is the body of a response of a debugTransport. It captures
+// what is read from it and calls onClose when first closed.
+type debugBody struct {
+	io.ReadCloser
+	capture bodyCapture
+	onClose func()
+	once    sync.Once
+}
+
+func (b *debugBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.capture.Write(p[:n])
+	return n, err
+}
+
+func (b *debugBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.onClose)
+	return err
+}
+
+// bodyCapture keeps the first maxDebugBody bytes written to it, with each
+// run of at least minElidedBase64 base64 characters replaced by its length,
+// so that a body of any size is captured in bounded memory.
+type bodyCapture struct {
+	buf bytes.Buffer
+	// run holds the start of the current run of base64 characters, and
+	// runLen its whole length.
+	run       []byte
+	runLen    int
+	total     int64
+	truncated bool
+}
+
+func (c *bodyCapture) Write(p []byte) (int, error) {
+	for _, ch := range p {
+		c.total++
+		if isBase64Char(ch) {
+			if len(c.run) < minElidedBase64 {
+				c.run = append(c.run, ch)
+			}
+			c.runLen++
+			continue
+		}
+		c.endRun()
+		c.emit([]byte{ch})
+	}
+	return len(p), nil
+}
+
+func (c *bodyCapture) endRun() {
+	if c.runLen >= minElidedBase64 {
+		c.emit([]byte(fmt.Sprintf("[%v bytes of base64]", c.runLen)))
+	} else {
+		c.emit(c.run)
+	}
+	c.run, c.runLen = c.run[:0], 0
+}
+
+func (c *bodyCapture) emit(p []byte) {
+	if c.truncated || c.buf.Len()+len(p) > maxDebugBody {
+		c.truncated = true
+		return
+	}
+	c.buf.Write(p)
+}
+
+// String returns what has been captured.
+func (c *bodyCapture) String() string {
+	c.endRun()
+	s := c.buf.String()
+	if c.truncated {
+		s += fmt.Sprintf("... (%v bytes in all)", c.total)
+	}
+	return s
+}
+
+func isBase64Char(ch byte) bool {
+	return 'A' <= ch && ch <= 'Z' || 'a' <= ch && ch <= 'z' || '0' <= ch && ch <= '9' || ch == '+' || ch == '/' || ch == '='
+}
@@ -0,0 +1,86 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// dedupFiles returns the distinct files among files, and for each of them
+// the indices in files of the files which are the same. Empty files are
+// never submitted, so they are kept apart to be reported by name.
+func dedupFiles(files []File) (unique []File, copies [][]int) {
+	seen := make(map[[sha256.Size]byte]int)
+	for i, f := range files {
+		if len(f.Contents) == 0 {
+			unique = append(unique, f)
+			copies = append(copies, []int{i})
+			continue
+		}
+		h := sha256.New()
+		fmt.Fprintf(h, "%v\n%v\n", f.MimeType, f.Pages)
+		h.Write(f.Contents)
+		var digest [sha256.Size]byte
+		copy(digest[:], h.Sum(nil))
+		if u, ok := seen[digest]; ok {
+			copies[u] = append(copies[u], i)
+			continue
+		}
+		seen[digest] = len(unique)
+		unique = append(unique, f)
+		copies = append(copies, []int{i})
+	}
+	return unique, copies
+}
+
+// withCopies returns job, a job for the distinct files returned by
+// dedupFiles, as a job for all the files.
+func (job Job) withCopies(copies [][]int) Job {
+	fileIndices := make([]int, len(job.FileIndices))
+	for j, u := range job.FileIndices {
+		fileIndices[j] = copies[u][0]
+		if len(copies[u]) > 1 {
+			if job.Duplicates == nil {
+				job.Duplicates = make(map[int][]int)
+			}
+			job.Duplicates[copies[u][0]] = copies[u][1:]
+		}
+	}
+	job.FileIndices = fileIndices
+	return job
+}
+
+// fanOut sends a copy of each page from in for each FileIndex returned by
+// indices.
+func fanOut(in <-chan RecognizedPage, indices func(RecognizedPage) []int) <-chan RecognizedPage {
+	out := make(chan RecognizedPage, 16)
+	go func() {
+		for p := range in {
+			for _, i := range indices(p) {
+				p.FileIndex = i
+				out <- p
+			}
+		}
+		close(out)
+	}()
+	return out
+}
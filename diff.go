@@ -0,0 +1,261 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"math"
+	"sort"
+)
+
+// DiffOptions are the tolerances of DiffResults. Differences within them
+// are not reported; the zero value reports every difference.
+type DiffOptions struct {
+	// MoveTolerance is how many pixels the center of a box may move.
+	MoveTolerance float64
+	// ConfidenceTolerance is how much the confidence of a text element
+	// may change.
+	ConfidenceTolerance float64
+}
+
+// The kinds of TextDiff.
+const (
+	TextAdded      = "added"
+	TextRemoved    = "removed"
+	TextChanged    = "changed"
+	TextMoved      = "moved"
+	ConfidenceDiff = "confidence"
+)
+
+// TextDiff is a difference in one text element between two results. A is
+// the element in the first results and B in the second; one of them is nil
+// if the element was added or removed. Kind is the most significant of the
+// differences: a changed text may also have moved.
+type TextDiff struct {
+	Kind string
+	A    *RecognizedText `json:",omitempty"`
+	B    *RecognizedText `json:",omitempty"`
+	// Moved is the distance in pixels between the centers of A and B,
+	// and ConfidenceDelta is the confidence of B less that of A.
+	Moved           float64 `json:",omitempty"`
+	ConfidenceDelta float64 `json:",omitempty"`
+}
+
+// PageDiff is the differences on one page. Missing is "a" or "b" if the
+// page is only in the other results, in which case its text is not
+// compared.
+type PageDiff struct {
+	FileIndex  int
+	PageNumber int
+	Missing    string `json:",omitempty"`
+	ErrorA     string `json:",omitempty"`
+	ErrorB     string `json:",omitempty"`
+	Texts      []TextDiff
+}
+
+// ResultsDiff is the outcome of DiffResults.
+type ResultsDiff struct {
+	// Pages are the pages which differ, ordered by file and page number.
+	Pages []PageDiff
+	// Counts is the number of TextDiffs of each kind.
+	Counts map[string]int
+}
+
+// Equal reports whether no differences were found.
+func (d ResultsDiff) Equal() bool {
+	return len(d.Pages) == 0
+}
+
+// DiffResults compares two sets of results for the same files, e.g., from
+// before and after a change to preprocessing, page by page. Pages are
+// matched by FileIndex and PageNumber. On each page, text elements with
+// the same text are paired by proximity, then the remaining elements whose
+// boxes largely overlap are paired as changed text, and whatever is left
+// was removed from a or added in b.
+func DiffResults(a, b []RecognizedPage, opts DiffOptions) ResultsDiff {
+	type key struct{ file, page int }
+	pagesA := make(map[key]RecognizedPage)
+	pagesB := make(map[key]RecognizedPage)
+	var keys []key
+	for _, p := range a {
+		k := key{p.FileIndex, p.PageNumber}
+		if _, ok := pagesA[k]; !ok {
+			keys = append(keys, k)
+		}
+		pagesA[k] = p
+	}
+	for _, p := range b {
+		k := key{p.FileIndex, p.PageNumber}
+		if _, ok := pagesA[k]; !ok {
+			if _, ok := pagesB[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		pagesB[k] = p
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].file != keys[j].file {
+			return keys[i].file < keys[j].file
+		}
+		return keys[i].page < keys[j].page
+	})
+	d := ResultsDiff{Counts: make(map[string]int)}
+	for _, k := range keys {
+		pa, okA := pagesA[k]
+		pb, okB := pagesB[k]
+		pd := PageDiff{FileIndex: k.file, PageNumber: k.page}
+		switch {
+		case !okA:
+			pd.Missing = "a"
+		case !okB:
+			pd.Missing = "b"
+		default:
+			if pa.Error != pb.Error {
+				pd.ErrorA, pd.ErrorB = pa.Error, pb.Error
+			}
+			pd.Texts = diffTexts(pa.RecognizedText, pb.RecognizedText, opts)
+			if pd.ErrorA == "" && pd.ErrorB == "" && len(pd.Texts) == 0 {
+				continue
+			}
+		}
+		for _, td := range pd.Texts {
+			d.Counts[td.Kind]++
+		}
+		d.Pages = append(d.Pages, pd)
+	}
+	return d
+}
+
+// diffTexts compares the text elements of one page.
+func diffTexts(a, b []RecognizedText, opts DiffOptions) []TextDiff {
+	type pair struct {
+		i, j  int
+		score float64
+	}
+	matchedA := make([]bool, len(a))
+	matchedB := make([]bool, len(b))
+	var diffs []TextDiff
+	// match pairs the candidates greedily, lowest score first.
+	match := func(candidates []pair, kind string) {
+		sort.SliceStable(candidates, func(x, y int) bool { return candidates[x].score < candidates[y].score })
+		for _, c := range candidates {
+			if matchedA[c.i] || matchedB[c.j] {
+				continue
+			}
+			matchedA[c.i], matchedB[c.j] = true, true
+			ta, tb := a[c.i], b[c.j]
+			td := TextDiff{
+				Kind:            kind,
+				A:               &ta,
+				B:               &tb,
+				Moved:           centerDistance(ta, tb),
+				ConfidenceDelta: tb.Confidence - ta.Confidence,
+			}
+			if kind != TextChanged {
+				if td.Moved > opts.MoveTolerance {
+					td.Kind = TextMoved
+				} else if math.Abs(td.ConfidenceDelta) > opts.ConfidenceTolerance {
+					td.Kind = ConfidenceDiff
+				} else {
+					continue
+				}
+			}
+			diffs = append(diffs, td)
+		}
+	}
+	var same []pair
+	for i := range a {
+		for j := range b {
+			if a[i].Text == b[j].Text {
+				same = append(same, pair{i, j, centerDistance(a[i], b[j])})
+			}
+		}
+	}
+	match(same, "")
+	var overlapping []pair
+	for i := range a {
+		if matchedA[i] {
+			continue
+		}
+		for j := range b {
+			if !matchedB[j] {
+				// Boxes of neighboring words may touch, so a small
+				// overlap does not make them the same element.
+				if o := boxOverlap(a[i], b[j]); o >= 0.2 {
+					overlapping = append(overlapping, pair{i, j, -o})
+				}
+			}
+		}
+	}
+	match(overlapping, TextChanged)
+	for i := range a {
+		if !matchedA[i] {
+			t := a[i]
+			diffs = append(diffs, TextDiff{Kind: TextRemoved, A: &t})
+		}
+	}
+	for j := range b {
+		if !matchedB[j] {
+			t := b[j]
+			diffs = append(diffs, TextDiff{Kind: TextAdded, B: &t})
+		}
+	}
+	return diffs
+}
+
+// textBounds returns the axis-aligned rectangle around t.
+func textBounds(t RecognizedText) (minX, minY, maxX, maxY float64) {
+	xs := []int{t.TopLeftX, t.TopRightX, t.BottomLeftX, t.BottomRightX}
+	ys := []int{t.TopLeftY, t.TopRightY, t.BottomLeftY, t.BottomRightY}
+	minX, minY, maxX, maxY = math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for k := range xs {
+		minX = math.Min(minX, float64(xs[k]))
+		maxX = math.Max(maxX, float64(xs[k]))
+		minY = math.Min(minY, float64(ys[k]))
+		maxY = math.Max(maxY, float64(ys[k]))
+	}
+	return minX, minY, maxX, maxY
+}
+
+// centerDistance returns the distance between the centers of a and b.
+func centerDistance(a, b RecognizedText) float64 {
+	ax0, ay0, ax1, ay1 := textBounds(a)
+	bx0, by0, bx1, by1 := textBounds(b)
+	return math.Hypot((ax0+ax1-bx0-bx1)/2, (ay0+ay1-by0-by1)/2)
+}
+
+// boxOverlap returns the area of the intersection of the bounds of a and b
+// divided by that of their union: 0 if they are disjoint and 1 if they are
+// the same.
+func boxOverlap(a, b RecognizedText) float64 {
+	ax0, ay0, ax1, ay1 := textBounds(a)
+	bx0, by0, bx1, by1 := textBounds(b)
+	w := math.Min(ax1, bx1) - math.Max(ax0, bx0)
+	h := math.Min(ay1, by1) - math.Max(ay0, by0)
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	inter := w * h
+	union := (ax1-ax0)*(ay1-ay0) + (bx1-bx0)*(by1-by0) - inter
+	if union <= 0 {
+		return 0
+	}
+	return inter / union
+}
@@ -0,0 +1,224 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/siftrics/sight"
+)
+
+// box returns a text element with an axis-aligned box of width w and
+// height h whose top left corner is at x, y.
+func box(text string, x, y, w, h int, confidence float64) sight.RecognizedText {
+	return sight.RecognizedText{
+		Text:         text,
+		TopLeftX:     x,
+		TopLeftY:     y,
+		TopRightX:    x + w,
+		TopRightY:    y,
+		BottomLeftX:  x,
+		BottomLeftY:  y + h,
+		BottomRightX: x + w,
+		BottomRightY: y + h,
+		Confidence:   confidence,
+	}
+}
+
+// onePage returns the results of one page of one file.
+func onePage(texts ...sight.RecognizedText) []sight.RecognizedPage {
+	return []sight.RecognizedPage{{FileIndex: 0, PageNumber: 1, NumberOfPagesInFile: 1, RecognizedText: texts}}
+}
+
+// diffKinds returns the kinds of the differences on the only page of d,
+// with the text of A and B of each.
+func diffKinds(t *testing.T, d sight.ResultsDiff) []string {
+	t.Helper()
+	if len(d.Pages) == 0 {
+		return nil
+	}
+	if len(d.Pages) != 1 {
+		t.Fatalf("got %v differing pages, want 1", len(d.Pages))
+	}
+	var kinds []string
+	for _, td := range d.Pages[0].Texts {
+		s := td.Kind + ":"
+		if td.A != nil {
+			s += td.A.Text
+		}
+		s += ">"
+		if td.B != nil {
+			s += td.B.Text
+		}
+		kinds = append(kinds, s)
+	}
+	return kinds
+}
+
+func TestDiffTexts(t *testing.T) {
+	hello := box("hello", 100, 100, 50, 20, 0.9)
+	world := box("world", 200, 100, 50, 20, 0.9)
+	tests := []struct {
+		name string
+		a, b []sight.RecognizedText
+		opts sight.DiffOptions
+		want []string
+	}{
+		{
+			name: "unchanged",
+			a:    []sight.RecognizedText{hello, world},
+			b:    []sight.RecognizedText{world, hello},
+		},
+		{
+			name: "moved",
+			a:    []sight.RecognizedText{hello},
+			b:    []sight.RecognizedText{box("hello", 110, 100, 50, 20, 0.9)},
+			opts: sight.DiffOptions{MoveTolerance: 5},
+			want: []string{"moved:hello>hello"},
+		},
+		{
+			name: "moved within tolerance",
+			a:    []sight.RecognizedText{hello},
+			b:    []sight.RecognizedText{box("hello", 103, 104, 50, 20, 0.9)},
+			opts: sight.DiffOptions{MoveTolerance: 5},
+		},
+		{
+			name: "confidence",
+			a:    []sight.RecognizedText{hello},
+			b:    []sight.RecognizedText{box("hello", 100, 100, 50, 20, 0.5)},
+			opts: sight.DiffOptions{ConfidenceTolerance: 0.1},
+			want: []string{"confidence:hello>hello"},
+		},
+		{
+			name: "confidence within tolerance",
+			a:    []sight.RecognizedText{hello},
+			b:    []sight.RecognizedText{box("hello", 100, 100, 50, 20, 0.85)},
+			opts: sight.DiffOptions{ConfidenceTolerance: 0.1},
+		},
+		{
+			name: "changed",
+			a:    []sight.RecognizedText{hello, world},
+			b:    []sight.RecognizedText{box("hallo", 102, 100, 50, 20, 0.9), world},
+			want: []string{"changed:hello>hallo"},
+		},
+		{
+			name: "removed and added",
+			a:    []sight.RecognizedText{hello, world},
+			b:    []sight.RecognizedText{world, box("there", 400, 300, 50, 20, 0.9)},
+			want: []string{"removed:hello>", "added:>there"},
+		},
+		{
+			// Neighboring words touch, so they are not paired as changed
+			// text.
+			name: "small overlap",
+			a:    []sight.RecognizedText{hello},
+			b:    []sight.RecognizedText{box("there", 145, 100, 50, 20, 0.9)},
+			want: []string{"removed:hello>", "added:>there"},
+		},
+		{
+			// Repeated words are paired with the nearest, whatever their
+			// order.
+			name: "repeated text",
+			a:    []sight.RecognizedText{box("the", 0, 0, 30, 20, 0.9), box("the", 300, 0, 30, 20, 0.9)},
+			b:    []sight.RecognizedText{box("the", 302, 0, 30, 20, 0.9), box("the", 1, 0, 30, 20, 0.9)},
+			opts: sight.DiffOptions{MoveTolerance: 5},
+		},
+		{
+			// The pair of the same text is made before the changed one,
+			// so the other element is left to be paired as changed.
+			name: "same text before overlap",
+			a:    []sight.RecognizedText{box("one", 100, 100, 50, 20, 0.9), box("two", 100, 130, 50, 20, 0.9)},
+			b:    []sight.RecognizedText{box("one", 100, 110, 50, 20, 0.9), box("too", 100, 132, 50, 20, 0.9)},
+			opts: sight.DiffOptions{MoveTolerance: 20},
+			want: []string{"changed:two>too"},
+		},
+		{
+			// Of two elements overlapping a changed one, the one which
+			// overlaps it most is paired with it.
+			name: "greatest overlap",
+			a:    []sight.RecognizedText{box("cat", 100, 100, 50, 20, 0.9)},
+			b:    []sight.RecognizedText{box("cut", 120, 100, 50, 20, 0.9), box("cot", 101, 100, 50, 20, 0.9)},
+			want: []string{"changed:cat>cot", "added:>cut"},
+		},
+	}
+	for _, tt := range tests {
+		d := sight.DiffResults(onePage(tt.a...), onePage(tt.b...), tt.opts)
+		if got := diffKinds(t, d); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v: got %q, want %q", tt.name, got, tt.want)
+		}
+		if d.Equal() != (len(tt.want) == 0) {
+			t.Errorf("%v: Equal() = %v", tt.name, d.Equal())
+		}
+	}
+}
+
+func TestDiffMoved(t *testing.T) {
+	a := box("hello", 100, 100, 50, 20, 0.9)
+	b := box("hello", 103, 104, 50, 20, 0.7)
+	d := sight.DiffResults(onePage(a), onePage(b), sight.DiffOptions{MoveTolerance: 1})
+	if len(d.Pages) != 1 || len(d.Pages[0].Texts) != 1 {
+		t.Fatalf("got %+v, want one difference", d.Pages)
+	}
+	td := d.Pages[0].Texts[0]
+	if td.Kind != sight.TextMoved || td.Moved != 5 || td.ConfidenceDelta > -0.19 || td.ConfidenceDelta < -0.21 {
+		t.Errorf("got %v moved %v, confidence %v; want moved 5, confidence -0.2", td.Kind, td.Moved, td.ConfidenceDelta)
+	}
+}
+
+func TestDiffPages(t *testing.T) {
+	hello := box("hello", 100, 100, 50, 20, 0.9)
+	a := []sight.RecognizedPage{
+		{FileIndex: 1, PageNumber: 1, RecognizedText: []sight.RecognizedText{hello}},
+		{FileIndex: 0, PageNumber: 2, RecognizedText: []sight.RecognizedText{hello}},
+		{FileIndex: 0, PageNumber: 1, RecognizedText: []sight.RecognizedText{hello}},
+		{FileIndex: 0, PageNumber: 3, Error: "timed out"},
+	}
+	b := []sight.RecognizedPage{
+		{FileIndex: 0, PageNumber: 1, RecognizedText: []sight.RecognizedText{hello}},
+		{FileIndex: 0, PageNumber: 3, RecognizedText: []sight.RecognizedText{hello}},
+		{FileIndex: 0, PageNumber: 2},
+		{FileIndex: 2, PageNumber: 1},
+	}
+	d := sight.DiffResults(a, b, sight.DiffOptions{})
+	type page struct {
+		file, page int
+		missing    string
+		errA, errB string
+		kinds      int
+	}
+	var got []page
+	for _, p := range d.Pages {
+		got = append(got, page{p.FileIndex, p.PageNumber, p.Missing, p.ErrorA, p.ErrorB, len(p.Texts)})
+	}
+	want := []page{
+		{0, 2, "", "", "", 1},
+		{0, 3, "", "timed out", "", 1},
+		{1, 1, "b", "", "", 0},
+		{2, 1, "a", "", "", 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got pages %+v, want %+v", got, want)
+	}
+	if want := map[string]int{sight.TextRemoved: 1, sight.TextAdded: 1}; !reflect.DeepEqual(d.Counts, want) {
+		t.Errorf("got counts %v, want %v", d.Counts, want)
+	}
+}
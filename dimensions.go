@@ -0,0 +1,129 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+)
+
+// NormalizedText is a RecognizedText whose coordinates are fractions of
+// the width and height of its page, from 0 at the top left to 1 at the
+// bottom right, so that it can be drawn over an image of the page at any
+// size. See NormalizePage.
+type NormalizedText struct {
+	Text                                                 string
+	TopLeftX, TopLeftY, TopRightX, TopRightY             float64
+	BottomLeftX, BottomLeftY, BottomRightX, BottomRightY float64
+	Confidence                                           float64
+	Language                                             string `json:",omitempty"`
+}
+
+// ErrNoDimensions is returned by NormalizePage for a page whose Width and
+// Height are not known.
+var ErrNoDimensions = errors.New("the size of the page is not known")
+
+// NormalizePage returns the recognized text of p with its coordinates
+// divided by p.Width and p.Height. Coordinates are not clamped, so a box
+// which extends past the edge of the page lies partly outside 0 to 1.
+func NormalizePage(p RecognizedPage) ([]NormalizedText, error) {
+	if p.Width <= 0 || p.Height <= 0 {
+		return nil, ErrNoDimensions
+	}
+	w, h := float64(p.Width), float64(p.Height)
+	texts := make([]NormalizedText, len(p.RecognizedText))
+	for i, t := range p.RecognizedText {
+		texts[i] = NormalizedText{
+			Text:         t.Text,
+			TopLeftX:     float64(t.TopLeftX) / w,
+			TopLeftY:     float64(t.TopLeftY) / h,
+			TopRightX:    float64(t.TopRightX) / w,
+			TopRightY:    float64(t.TopRightY) / h,
+			BottomLeftX:  float64(t.BottomLeftX) / w,
+			BottomLeftY:  float64(t.BottomLeftY) / h,
+			BottomRightX: float64(t.BottomRightX) / w,
+			BottomRightY: float64(t.BottomRightY) / h,
+			Confidence:   t.Confidence,
+			Language:     t.Language,
+		}
+	}
+	return texts, nil
+}
+
+// fillDimensions sets the Width, Height and DPI of p from its Base64Image
+// where the Sight API did not report them. The image is only decoded as far
+// as its header.
+func fillDimensions(p *RecognizedPage) {
+	if p.Base64Image == "" || (p.Width > 0 && p.Height > 0 && p.DPI > 0) {
+		return
+	}
+	r := base64.NewDecoder(base64.StdEncoding, strings.NewReader(p.Base64Image))
+	// 64KB covers the headers of PNG and JPEG images, which are all that
+	// is needed for their size and resolution.
+	header := make([]byte, 64<<10)
+	n, _ := io.ReadFull(r, header)
+	header = header[:n]
+	if p.Width <= 0 || p.Height <= 0 {
+		if cfg, _, err := image.DecodeConfig(bytes.NewReader(header)); err == nil {
+			p.Width, p.Height = cfg.Width, cfg.Height
+		}
+	}
+	if p.DPI <= 0 {
+		p.DPI = imageDPI(header)
+	}
+}
+
+// imageDPI returns the horizontal resolution recorded in the pHYs chunk of
+// a PNG image or the JFIF header of a JPEG image, or 0 if there is none.
+func imageDPI(b []byte) int {
+	switch {
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")):
+		for i := 8; i+8 <= len(b); {
+			size := int(binary.BigEndian.Uint32(b[i:]))
+			kind := string(b[i+4 : i+8])
+			if kind == "IDAT" || kind == "IEND" || i+8+size > len(b) {
+				return 0
+			}
+			// The pHYs unit 1 is the meter.
+			if kind == "pHYs" && size >= 9 && b[i+16] == 1 {
+				return int(float64(binary.BigEndian.Uint32(b[i+8:]))*0.0254 + 0.5)
+			}
+			i += 12 + size
+		}
+	case bytes.HasPrefix(b, []byte{0xff, 0xd8, 0xff, 0xe0}) && len(b) >= 18 &&
+		string(b[6:11]) == "JFIF\x00":
+		x := int(binary.BigEndian.Uint16(b[14:]))
+		switch b[13] {
+		case 1: // dots per inch
+			return x
+		case 2: // dots per centimeter
+			return int(float64(x)*2.54 + 0.5)
+		}
+	}
+	return 0
+}
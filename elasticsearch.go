@@ -0,0 +1,224 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ElasticsearchSink is a Sink which indexes recognized text into an
+// Elasticsearch or OpenSearch index with the bulk API, one document per
+// text element, so that it can be searched as soon as it is recognized. A
+// page with an Error is indexed as one document with an error field and no
+// text. Documents are identified by file, page and position, so a page
+// which is written again updates its documents rather than duplicating
+// them.
+//
+// Documents are sent in batches; Close sends the last one.
+type ElasticsearchSink struct {
+	// URL is the base URL of the cluster, e.g., http://localhost:9200.
+	// User info in the URL is sent as HTTP basic authentication.
+	URL string
+	// Index is the name of the index, which is created with dynamic
+	// mappings if it does not exist.
+	Index string
+	// APIKey, if set, is sent in an "Authorization: ApiKey" header.
+	APIKey string
+	// BatchSize is the number of documents sent in each bulk request. If
+	// it is not positive, 500 documents are sent at once.
+	BatchSize int
+	// HTTPClient sends the requests. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	mu    sync.Mutex
+	batch bytes.Buffer
+	n     int
+}
+
+var _ Sink = (*ElasticsearchSink)(nil)
+
+// elasticsearchDocument is the document indexed for a text element.
+type elasticsearchDocument struct {
+	File         string  `json:"file"`
+	FileIndex    int     `json:"file_index"`
+	Page         int     `json:"page"`
+	PagesInFile  int     `json:"pages_in_file"`
+	Position     int     `json:"position"`
+	Text         string  `json:"text,omitempty"`
+	Confidence   float64 `json:"confidence"`
+	Language     string  `json:"language,omitempty"`
+	Error        string  `json:"error,omitempty"`
+	TopLeftX     int     `json:"top_left_x"`
+	TopLeftY     int     `json:"top_left_y"`
+	TopRightX    int     `json:"top_right_x"`
+	TopRightY    int     `json:"top_right_y"`
+	BottomLeftX  int     `json:"bottom_left_x"`
+	BottomLeftY  int     `json:"bottom_left_y"`
+	BottomRightX int     `json:"bottom_right_x"`
+	BottomRightY int     `json:"bottom_right_y"`
+	Width        int     `json:"width,omitempty"`
+	Height       int     `json:"height,omitempty"`
+}
+
+// WritePage adds the documents of page to the batch, and sends the batch
+// if it is full.
+func (s *ElasticsearchSink) WritePage(file string, page RecognizedPage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	base := elasticsearchDocument{
+		File:        file,
+		FileIndex:   page.FileIndex,
+		Page:        page.PageNumber,
+		PagesInFile: page.NumberOfPagesInFile,
+		Error:       page.Error,
+		Width:       page.Width,
+		Height:      page.Height,
+	}
+	if page.Error != "" {
+		return s.add(base)
+	}
+	for i, t := range page.RecognizedText {
+		doc := base
+		doc.Position = i
+		doc.Text = t.Text
+		doc.Confidence = t.Confidence
+		doc.Language = t.Language
+		doc.TopLeftX, doc.TopLeftY = t.TopLeftX, t.TopLeftY
+		doc.TopRightX, doc.TopRightY = t.TopRightX, t.TopRightY
+		doc.BottomLeftX, doc.BottomLeftY = t.BottomLeftX, t.BottomLeftY
+		doc.BottomRightX, doc.BottomRightY = t.BottomRightX, t.BottomRightY
+		if err := s.add(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close sends the last batch.
+func (s *ElasticsearchSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.flush()
+}
+
+func (s *ElasticsearchSink) add(doc elasticsearchDocument) error {
+	action := map[string]map[string]string{"index": {
+		"_index": s.Index,
+		"_id":    fmt.Sprintf("%v:%v:%v", doc.File, doc.Page, doc.Position),
+	}}
+	for _, v := range []interface{}{action, doc} {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		s.batch.Write(buf)
+		s.batch.WriteByte('\n')
+	}
+	s.n++
+	batchSize := s.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	if s.n >= batchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush sends the batch in one bulk request.
+func (s *ElasticsearchSink) flush() error {
+	if s.n == 0 {
+		return nil
+	}
+	defer func() {
+		s.batch.Reset()
+		s.n = 0
+	}()
+	u, err := url.Parse(strings.TrimSuffix(s.URL, "/") + "/_bulk")
+	if err != nil {
+		return err
+	}
+	// The credentials are kept out of the URL, which is quoted in errors.
+	user := u.User
+	u.User = nil
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(s.batch.Bytes()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+	}
+	if s.APIKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+s.APIKey)
+	}
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("bulk request to %v failed with status %v: %v", u, resp.StatusCode, string(body))
+	}
+	// The bulk API reports the failure of each document separately.
+	var result struct {
+		Errors bool
+		Items  []map[string]struct {
+			Status int
+			Error  json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("invalid response to bulk request to %v: %v", u, err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	failed := 0
+	var first string
+	for _, item := range result.Items {
+		for _, r := range item {
+			if r.Status >= 300 {
+				if failed == 0 {
+					first = string(r.Error)
+				}
+				failed++
+			}
+		}
+	}
+	return fmt.Errorf("%v of %v documents were not indexed; the first error was: %v", failed, s.n, first)
+}
@@ -0,0 +1,77 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package encoding
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/siftrics/sight"
+)
+
+// MarshalMsgpack encodes p in MessagePack, as a map with the fields of its
+// JSON, which is smaller than the JSON and faster to decode. Any MessagePack
+// decoder reads it, e.g., msgpack.unpackb in Python. Err is not encoded.
+func MarshalMsgpack(p sight.RecognizedPage) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	// Fields without a msgpack tag are named and omitted as in the JSON.
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(&p); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalMsgpack decodes a page encoded by MarshalMsgpack into p.
+func UnmarshalMsgpack(b []byte, p *sight.RecognizedPage) error {
+	*p = sight.RecognizedPage{}
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(p)
+}
+
+// MsgpackSink is a sight.Sink which writes each page to W in MessagePack, one
+// after another, as MarshalMsgpack encodes them. They are read back by
+// decoding from a stream, e.g., with msgpack.NewDecoder(r).Decode until it
+// returns io.EOF. W is not closed by Close.
+type MsgpackSink struct {
+	W io.Writer
+}
+
+var _ sight.Sink = MsgpackSink{}
+
+// WritePage writes page. The file name is not written; page.FileIndex
+// identifies the file.
+func (s MsgpackSink) WritePage(file string, page sight.RecognizedPage) error {
+	b, err := MarshalMsgpack(page)
+	if err != nil {
+		return err
+	}
+	_, err = s.W.Write(b)
+	return err
+}
+
+func (s MsgpackSink) Close() error {
+	return nil
+}
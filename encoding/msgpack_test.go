@@ -0,0 +1,96 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package encoding
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/siftrics/sight"
+)
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	for _, p := range []sight.RecognizedPage{testPage(), {}} {
+		b, err := MarshalMsgpack(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got sight.RecognizedPage
+		if err := UnmarshalMsgpack(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got = inUTC(got); !reflect.DeepEqual(got, p) {
+			t.Errorf("UnmarshalMsgpack(MarshalMsgpack(%+v)) = %+v", p, got)
+		}
+	}
+}
+
+func TestMsgpackFieldNames(t *testing.T) {
+	b, err := MarshalMsgpack(sight.RecognizedPage{Error: "failed", PageNumber: 2, FileName: "a.pdf"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := msgpack.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Error", "PageNumber", "FileName", "RecognizedText"} {
+		if _, ok := m[name]; !ok {
+			t.Errorf("no %v in %v", name, m)
+		}
+	}
+	// Fields which are omitted from the JSON when empty are omitted here.
+	for _, name := range []string{"Base64Image", "JobID", "Tags"} {
+		if _, ok := m[name]; ok {
+			t.Errorf("%v in %v", name, m)
+		}
+	}
+}
+
+func TestMsgpackSink(t *testing.T) {
+	pages := []sight.RecognizedPage{testPage(), {FileIndex: 1, PageNumber: 1}}
+	var buf bytes.Buffer
+	sink := MsgpackSink{W: &buf}
+	for _, p := range pages {
+		if err := sink.WritePage("invoice.pdf", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dec := msgpack.NewDecoder(&buf)
+	dec.SetCustomStructTag("json")
+	for i, want := range pages {
+		var got sight.RecognizedPage
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("page %v: %v", i, err)
+		}
+		if got = inUTC(got); !reflect.DeepEqual(got, want) {
+			t.Errorf("page %v = %+v, want %+v", i, got, want)
+		}
+	}
+	var p sight.RecognizedPage
+	if err := dec.Decode(&p); err != io.EOF {
+		t.Errorf("Decode after the last page returned %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package encoding encodes recognized pages in formats other than JSON:
+// as protobuf messages of proto/sight.proto and in MessagePack.
+package encoding
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/barcode"
+)
+
+// The RecognizedPage, RecognizedText and Barcode messages of
+// proto/sight.proto are encoded by hand below rather than by generated
+// code, so that building the package does not need protoc. Code generated
+// from proto/sight.proto, in any language, reads and writes the same bytes.
+
+// MarshalProto encodes p as a RecognizedPage message of proto/sight.proto,
+// which is several times smaller than its JSON. The auto-rotated image is
+// encoded as bytes rather than base64. Err is not encoded.
+func MarshalProto(p sight.RecognizedPage) ([]byte, error) {
+	var b []byte
+	b = appendString(b, 1, p.Error)
+	b = appendInt(b, 2, p.FileIndex)
+	b = appendInt(b, 3, p.PageNumber)
+	b = appendInt(b, 4, p.NumberOfPagesInFile)
+	for _, t := range p.RecognizedText {
+		var tb []byte
+		tb = appendString(tb, 1, t.Text)
+		tb = appendInt(tb, 2, t.TopLeftX)
+		tb = appendInt(tb, 3, t.TopLeftY)
+		tb = appendInt(tb, 4, t.TopRightX)
+		tb = appendInt(tb, 5, t.TopRightY)
+		tb = appendInt(tb, 6, t.BottomLeftX)
+		tb = appendInt(tb, 7, t.BottomLeftY)
+		tb = appendInt(tb, 8, t.BottomRightX)
+		tb = appendInt(tb, 9, t.BottomRightY)
+		if t.Confidence != 0 {
+			tb = protowire.AppendTag(tb, 10, protowire.Fixed64Type)
+			tb = protowire.AppendFixed64(tb, math.Float64bits(t.Confidence))
+		}
+		tb = appendString(tb, 11, t.Language)
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, tb)
+	}
+	if p.Base64Image != "" {
+		image, err := base64.StdEncoding.DecodeString(p.Base64Image)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, image)
+	}
+	b = appendInt(b, 7, p.Width)
+	b = appendInt(b, 8, p.Height)
+	b = appendInt(b, 9, p.DPI)
+	b = appendInt(b, 10, p.AppliedRotationDegrees)
+	if p.JobFailed {
+		b = protowire.AppendTag(b, 11, protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	for _, c := range p.Barcodes {
+		var cb []byte
+		cb = appendString(cb, 1, string(c.Format))
+		cb = appendString(cb, 2, c.Text)
+		cb = appendInt(cb, 3, c.TopLeftX)
+		cb = appendInt(cb, 4, c.TopLeftY)
+		cb = appendInt(cb, 5, c.TopRightX)
+		cb = appendInt(cb, 6, c.TopRightY)
+		cb = appendInt(cb, 7, c.BottomLeftX)
+		cb = appendInt(cb, 8, c.BottomLeftY)
+		cb = appendInt(cb, 9, c.BottomRightX)
+		cb = appendInt(cb, 10, c.BottomRightY)
+		b = protowire.AppendTag(b, 12, protowire.BytesType)
+		b = protowire.AppendBytes(b, cb)
+	}
+	b = appendString(b, 13, p.RequestID)
+	b = appendString(b, 14, p.JobID)
+	b = appendString(b, 15, p.FileName)
+	b = appendString(b, 16, p.FilePath)
+	b = appendString(b, 17, p.FileSHA256)
+	b = appendInt64(b, 18, p.FileSizeBytes)
+	if p.SubmittedAt != nil {
+		b = appendInt64(b, 19, p.SubmittedAt.UnixNano())
+	}
+	if p.FirstSeenAt != nil {
+		b = appendInt64(b, 20, p.FirstSeenAt.UnixNano())
+	}
+	b = appendInt64(b, 21, int64(p.ProcessingDuration))
+	keys := make([]string, 0, len(p.Tags))
+	for k := range p.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var eb []byte
+		eb = appendString(eb, 1, k)
+		eb = appendString(eb, 2, p.Tags[k])
+		b = protowire.AppendTag(b, 22, protowire.BytesType)
+		b = protowire.AppendBytes(b, eb)
+	}
+	return b, nil
+}
+
+// UnmarshalProto decodes a RecognizedPage message of proto/sight.proto,
+// such as one encoded by MarshalProto, into p. Unknown fields are skipped.
+func UnmarshalProto(b []byte, p *sight.RecognizedPage) error {
+	*p = sight.RecognizedPage{}
+	fields := map[protowire.Number]*int{2: &p.FileIndex, 3: &p.PageNumber, 4: &p.NumberOfPagesInFile,
+		7: &p.Width, 8: &p.Height, 9: &p.DPI, 10: &p.AppliedRotationDegrees}
+	strs := map[protowire.Number]*string{1: &p.Error, 13: &p.RequestID, 14: &p.JobID,
+		15: &p.FileName, 16: &p.FilePath, 17: &p.FileSHA256}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case typ == protowire.BytesType && strs[num] != nil:
+			v, n := protowire.ConsumeString(b)
+			*strs[num] = v
+			return n, nil
+		case num == 5 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			var t sight.RecognizedText
+			if err := unmarshalText(v, &t); err != nil {
+				return 0, err
+			}
+			p.RecognizedText = append(p.RecognizedText, t)
+			return n, nil
+		case num == 6 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			p.Base64Image = base64.StdEncoding.EncodeToString(v)
+			return n, nil
+		case num == 11 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			p.JobFailed = v != 0
+			return n, nil
+		case num == 12 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			var c barcode.Barcode
+			if err := unmarshalBarcode(v, &c); err != nil {
+				return 0, err
+			}
+			p.Barcodes = append(p.Barcodes, c)
+			return n, nil
+		case num == 18 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			p.FileSizeBytes = int64(v)
+			return n, nil
+		case num == 19 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			t := time.Unix(0, int64(v))
+			p.SubmittedAt = &t
+			return n, nil
+		case num == 20 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			t := time.Unix(0, int64(v))
+			p.FirstSeenAt = &t
+			return n, nil
+		case num == 21 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			p.ProcessingDuration = time.Duration(v)
+			return n, nil
+		case num == 22 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			var key, value string
+			if err := unmarshalEntry(v, &key, &value); err != nil {
+				return 0, err
+			}
+			if p.Tags == nil {
+				p.Tags = make(map[string]string)
+			}
+			p.Tags[key] = value
+			return n, nil
+		case typ == protowire.VarintType && fields[num] != nil:
+			v, n := protowire.ConsumeVarint(b)
+			*fields[num] = int(int32(v))
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+func unmarshalText(b []byte, t *sight.RecognizedText) error {
+	fields := map[protowire.Number]*int{2: &t.TopLeftX, 3: &t.TopLeftY, 4: &t.TopRightX, 5: &t.TopRightY,
+		6: &t.BottomLeftX, 7: &t.BottomLeftY, 8: &t.BottomRightX, 9: &t.BottomRightY}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			t.Text = v
+			return n, nil
+		case num == 10 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			t.Confidence = math.Float64frombits(v)
+			return n, nil
+		case num == 11 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			t.Language = v
+			return n, nil
+		case typ == protowire.VarintType && fields[num] != nil:
+			v, n := protowire.ConsumeVarint(b)
+			*fields[num] = int(int32(v))
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+func unmarshalBarcode(b []byte, c *barcode.Barcode) error {
+	fields := map[protowire.Number]*int{3: &c.TopLeftX, 4: &c.TopLeftY, 5: &c.TopRightX, 6: &c.TopRightY,
+		7: &c.BottomLeftX, 8: &c.BottomLeftY, 9: &c.BottomRightX, 10: &c.BottomRightY}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			c.Format = barcode.Format(v)
+			return n, nil
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			c.Text = v
+			return n, nil
+		case typ == protowire.VarintType && fields[num] != nil:
+			v, n := protowire.ConsumeVarint(b)
+			*fields[num] = int(int32(v))
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+// unmarshalEntry decodes an entry of a map<string, string> field.
+func unmarshalEntry(b []byte, key, value *string) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			*key = v
+			return n, nil
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			*value = v
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+// consumeFields calls field for each field of the message b, which
+// consumes the value of the field and returns its length, or a negative
+// length if it is malformed.
+func consumeFields(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		m, err := field(num, typ, b)
+		if err != nil {
+			return err
+		}
+		if m < 0 {
+			return protowire.ParseError(m)
+		}
+		b = b[m:]
+	}
+	return nil
+}
+
+// appendString appends a string field, unless it has the default value.
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// appendInt appends an int32 field, unless it has the default value.
+// Negative numbers take ten bytes, as in other encoders.
+func appendInt(b []byte, num protowire.Number, v int) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(int64(int32(v))))
+}
+
+// appendInt64 appends an int64 field, unless it has the default value.
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+// ProtoSink is a sight.Sink which writes each page to W as a RecognizedPage
+// message prefixed by its length as a varint: the framing of delimited
+// protobuf messages, as written by writeDelimitedTo in Java and protodelim
+// in Go. ReadProto reads them back. W is not closed by Close.
+type ProtoSink struct {
+	W io.Writer
+}
+
+var _ sight.Sink = ProtoSink{}
+
+// WritePage writes page. The file name is not written; page.FileIndex
+// identifies the file.
+func (s ProtoSink) WritePage(file string, page sight.RecognizedPage) error {
+	b, err := MarshalProto(page)
+	if err != nil {
+		return err
+	}
+	_, err = s.W.Write(append(protowire.AppendVarint(nil, uint64(len(b))), b...))
+	return err
+}
+
+func (s ProtoSink) Close() error {
+	return nil
+}
+
+// ReadProto reads a page written by ProtoSink from r. It returns io.EOF
+// after the last page.
+func ReadProto(r *bufio.Reader) (sight.RecognizedPage, error) {
+	var p sight.RecognizedPage
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return p, err
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return p, fmt.Errorf("reading a page of %v bytes: %v", size, err)
+	}
+	return p, UnmarshalProto(b, &p)
+}
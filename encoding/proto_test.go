@@ -0,0 +1,362 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/barcode"
+)
+
+// protoField is a field of a message of proto/sight.proto.
+type protoField struct {
+	name string
+	typ  string
+}
+
+var (
+	protoMessage = regexp.MustCompile(`^message (\w+) \{$`)
+	protoLine    = regexp.MustCompile(`^\s*(?:repeated\s+)?(map<[^>]+>|\w+)\s+(\w+)\s*=\s*(\d+);`)
+)
+
+// readProtoFile returns the fields of each message of proto/sight.proto by
+// number.
+func readProtoFile(t *testing.T) map[string]map[protowire.Number]protoField {
+	b, err := ioutil.ReadFile("../proto/sight.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := make(map[string]map[protowire.Number]protoField)
+	var fields map[protowire.Number]protoField
+	for _, line := range strings.Split(string(b), "\n") {
+		if m := protoMessage.FindStringSubmatch(line); m != nil {
+			fields = make(map[protowire.Number]protoField)
+			messages[m[1]] = fields
+			continue
+		}
+		if line == "}" {
+			fields = nil
+			continue
+		}
+		if m := protoLine.FindStringSubmatch(line); m != nil && fields != nil {
+			num, _ := strconv.Atoi(m[3])
+			fields[protowire.Number(num)] = protoField{name: m[2], typ: m[1]}
+		}
+	}
+	for _, name := range []string{"RecognizedPage", "RecognizedText", "Barcode"} {
+		if len(messages[name]) == 0 {
+			t.Fatalf("no message %v in proto/sight.proto", name)
+		}
+	}
+	return messages
+}
+
+// wireType returns the wire type of a field of type typ.
+func wireType(typ string) protowire.Type {
+	switch typ {
+	case "int32", "int64", "bool":
+		return protowire.VarintType
+	case "double":
+		return protowire.Fixed64Type
+	}
+	return protowire.BytesType
+}
+
+// goFields are the fields of the Go types whose names are not those of
+// the fields of proto/sight.proto without underscores.
+var goFields = map[string]string{
+	"image":                     "Base64Image",
+	"submitted_at_unix_nanos":   "SubmittedAt",
+	"first_seen_at_unix_nanos":  "FirstSeenAt",
+	"processing_duration_nanos": "ProcessingDuration",
+}
+
+// goField returns the field of v which the proto field name is encoded from.
+func goField(t *testing.T, v reflect.Value, name string) reflect.Value {
+	if n, ok := goFields[name]; ok {
+		return v.FieldByName(n)
+	}
+	want := strings.Replace(name, "_", "", -1)
+	f := v.FieldByNameFunc(func(n string) bool { return strings.EqualFold(n, want) })
+	if !f.IsValid() {
+		t.Fatalf("%v has no field for %v", v.Type(), name)
+	}
+	return f
+}
+
+// checkMessage checks that the message b, of type message, has each field
+// of message with the wire type and value of the corresponding field of v.
+func checkMessage(t *testing.T, messages map[string]map[protowire.Number]protoField, message string, b []byte, v reflect.Value) {
+	fields := messages[message]
+	seen := make(map[protowire.Number]int)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			t.Fatalf("%v: %v", message, protowire.ParseError(n))
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			t.Fatalf("%v: %v", message, protowire.ParseError(n))
+		}
+		value := b[:n]
+		b = b[n:]
+		f, ok := fields[num]
+		if !ok {
+			t.Errorf("%v: field %v is not in proto/sight.proto", message, num)
+			continue
+		}
+		if want := wireType(f.typ); typ != want {
+			t.Errorf("%v.%v: wire type %v, want %v for %v", message, f.name, typ, want, f.typ)
+			continue
+		}
+		seen[num]++
+		checkField(t, messages, message, f, value, goField(t, v, f.name), seen[num]-1)
+	}
+	for num, f := range fields {
+		if seen[num] == 0 {
+			t.Errorf("%v.%v (%v) was not encoded", message, f.name, num)
+		}
+	}
+}
+
+// checkField checks the value of the i'th occurrence of field f.
+func checkField(t *testing.T, messages map[string]map[protowire.Number]protoField, message string, f protoField, b []byte, v reflect.Value, i int) {
+	switch f.typ {
+	case "int32", "int64", "bool":
+		u, _ := protowire.ConsumeVarint(b)
+		var want int64
+		switch x := v.Interface().(type) {
+		case *time.Time:
+			want = x.UnixNano()
+		case bool:
+			if x {
+				want = 1
+			}
+		default:
+			want = v.Int()
+		}
+		if int64(u) != want {
+			t.Errorf("%v.%v = %v, want %v", message, f.name, int64(u), want)
+		}
+	case "double":
+		u, _ := protowire.ConsumeFixed64(b)
+		if got := math.Float64frombits(u); got != v.Float() {
+			t.Errorf("%v.%v = %v, want %v", message, f.name, got, v.Float())
+		}
+	case "string":
+		s, _ := protowire.ConsumeString(b)
+		if s != v.String() {
+			t.Errorf("%v.%v = %q, want %q", message, f.name, s, v.String())
+		}
+	case "bytes":
+		s, _ := protowire.ConsumeBytes(b)
+		if got := base64.StdEncoding.EncodeToString(s); got != v.String() {
+			t.Errorf("%v.%v = %q, want %q", message, f.name, got, v.String())
+		}
+	case "map<string, string>":
+		entry, _ := protowire.ConsumeBytes(b)
+		keys := v.MapKeys()
+		var key, value string
+		if err := unmarshalEntry(entry, &key, &value); err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(keys) {
+			t.Errorf("%v.%v has more than %v entries", message, f.name, len(keys))
+		} else if want := v.MapIndex(reflect.ValueOf(key)); !want.IsValid() || want.String() != value {
+			t.Errorf("%v.%v[%q] = %q, want %v", message, f.name, key, value, want)
+		}
+	default:
+		nested, _ := protowire.ConsumeBytes(b)
+		if i >= v.Len() {
+			t.Errorf("%v.%v has more than %v elements", message, f.name, v.Len())
+			return
+		}
+		checkMessage(t, messages, f.typ, nested, v.Index(i))
+	}
+}
+
+// testPage is a page with every field set.
+func testPage() sight.RecognizedPage {
+	return sight.RecognizedPage{
+		Error:               "partial failure",
+		FileIndex:           3,
+		PageNumber:          2,
+		NumberOfPagesInFile: 5,
+		RecognizedText: []sight.RecognizedText{{
+			Text:         "Invoice",
+			TopLeftX:     -4,
+			TopLeftY:     10,
+			TopRightX:    120,
+			TopRightY:    11,
+			BottomLeftX:  -3,
+			BottomLeftY:  40,
+			BottomRightX: 121,
+			BottomRightY: 41,
+			Confidence:   0.97,
+			Language:     "en",
+		}, {
+			Text:         "Total",
+			TopLeftX:     1,
+			TopLeftY:     2,
+			TopRightX:    3,
+			TopRightY:    4,
+			BottomLeftX:  5,
+			BottomLeftY:  6,
+			BottomRightX: 7,
+			BottomRightY: 8,
+			Confidence:   0.5,
+			Language:     "de",
+		}},
+		Base64Image:            base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n")),
+		Width:                  1700,
+		Height:                 2200,
+		DPI:                    200,
+		AppliedRotationDegrees: 90,
+		JobFailed:              true,
+		Barcodes: []barcode.Barcode{{
+			Format:       barcode.QRCode,
+			Text:         "https://siftrics.com",
+			TopLeftX:     10,
+			TopLeftY:     20,
+			TopRightX:    30,
+			TopRightY:    21,
+			BottomLeftX:  11,
+			BottomLeftY:  40,
+			BottomRightX: 31,
+			BottomRightY: 41,
+		}},
+		RequestID:          "req-1",
+		JobID:              "job-1",
+		FileName:           "invoice.pdf",
+		FilePath:           "scans/invoice.pdf",
+		FileSHA256:         "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08",
+		FileSizeBytes:      1 << 33,
+		SubmittedAt:        timeAt(1600000000, 123),
+		FirstSeenAt:        timeAt(1600000004, 456),
+		ProcessingDuration: 4*time.Second + 333,
+		Tags:               map[string]string{"customer": "acme", "batch": "7"},
+	}
+}
+
+// timeAt returns the time in UTC sec seconds and nsec nanoseconds after
+// the Unix epoch.
+func timeAt(sec, nsec int64) *time.Time {
+	t := time.Unix(sec, nsec).UTC()
+	return &t
+}
+
+// inUTC returns p with its times in UTC, which decoding does not keep.
+func inUTC(p sight.RecognizedPage) sight.RecognizedPage {
+	if p.SubmittedAt != nil {
+		p.SubmittedAt = timeAt(0, p.SubmittedAt.UnixNano())
+	}
+	if p.FirstSeenAt != nil {
+		p.FirstSeenAt = timeAt(0, p.FirstSeenAt.UnixNano())
+	}
+	return p
+}
+
+func TestMarshalProtoMatchesProtoFile(t *testing.T) {
+	messages := readProtoFile(t)
+	p := testPage()
+	b, err := MarshalProto(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMessage(t, messages, "RecognizedPage", b, reflect.ValueOf(p))
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	for _, p := range []sight.RecognizedPage{testPage(), {}, {PageNumber: 1, RecognizedText: []sight.RecognizedText{{Text: "a"}}}} {
+		b, err := MarshalProto(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got sight.RecognizedPage
+		if err := UnmarshalProto(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got = inUTC(got); !reflect.DeepEqual(got, p) {
+			t.Errorf("UnmarshalProto(MarshalProto(%+v)) = %+v", p, got)
+		}
+	}
+}
+
+func TestUnmarshalProtoSkipsUnknownFields(t *testing.T) {
+	b, err := MarshalProto(sight.RecognizedPage{PageNumber: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b = protowire.AppendTag(b, 99, protowire.BytesType)
+	b = protowire.AppendString(b, "from a newer version")
+	var got sight.RecognizedPage
+	if err := UnmarshalProto(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.PageNumber != 2 {
+		t.Errorf("PageNumber = %v, want 2", got.PageNumber)
+	}
+	if err := UnmarshalProto(b[:len(b)-3], &got); err == nil {
+		t.Error("UnmarshalProto of a truncated message succeeded")
+	}
+}
+
+func TestProtoSink(t *testing.T) {
+	pages := []sight.RecognizedPage{testPage(), {FileIndex: 1, PageNumber: 1}, {}}
+	var buf bytes.Buffer
+	sink := ProtoSink{W: &buf}
+	for _, p := range pages {
+		if err := sink.WritePage("invoice.pdf", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(&buf)
+	for i, want := range pages {
+		got, err := ReadProto(r)
+		if err != nil {
+			t.Fatalf("page %v: %v", i, err)
+		}
+		if got = inUTC(got); !reflect.DeepEqual(got, want) {
+			t.Errorf("page %v = %+v, want %+v", i, got, want)
+		}
+	}
+	if _, err := ReadProto(r); err != io.EOF {
+		t.Errorf("ReadProto after the last page returned %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package encoding
+
+import (
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/siftrics/sight"
+)
+
+// RecognizeRequest is a RecognizeRequest message of proto/sight.proto: the
+// files to recognize, and the config to recognize them with.
+type RecognizeRequest struct {
+	Files  []sight.File
+	Config sight.Config
+}
+
+// UnmarshalRecognizeRequest decodes a RecognizeRequest message into r. The
+// fields of r.Config which the message does not set are those of
+// sight.Client.Recognize, so that sentences are made unless words is set.
+// Unknown fields are skipped.
+func UnmarshalRecognizeRequest(b []byte, r *RecognizeRequest) error {
+	*r = RecognizeRequest{Config: sight.Config{MakeSentences: true, ScriptHints: make([]string, 0)}}
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			var f sight.File
+			if err := unmarshalFile(&f, v); err != nil {
+				return 0, err
+			}
+			r.Files = append(r.Files, f)
+			return n, nil
+		case typ == protowire.VarintType && (num == 2 || num == 3 || num == 4 || num == 6 || num == 7):
+			v, n := protowire.ConsumeVarint(b)
+			switch num {
+			case 2:
+				r.Config.MakeSentences = v == 0
+			case 3:
+				r.Config.DoExifRotate = v != 0
+			case 4:
+				r.Config.DoAutoRotate = v != 0
+			case 6:
+				r.Config.DetectLanguage = v != 0
+			case 7:
+				r.Config.DetectBarcodes = v != 0
+			}
+			return n, nil
+		case num == 5 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			r.Config.ScriptHints = append(r.Config.ScriptHints, v)
+			return n, nil
+		case num == 8 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			r.Config.Priority = sight.Priority(v)
+			return n, nil
+		case num == 9 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			var key, value string
+			if err := unmarshalEntry(v, &key, &value); err != nil {
+				return 0, err
+			}
+			if r.Config.Tags == nil {
+				r.Config.Tags = make(map[string]string)
+			}
+			r.Config.Tags[key] = value
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
+
+// unmarshalFile decodes a File message into f.
+func unmarshalFile(f *sight.File, b []byte) error {
+	return consumeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			f.Name = v
+			return n, nil
+		case num == 2 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeString(b)
+			f.MimeType = v
+			return n, nil
+		case num == 3 && typ == protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			f.Contents = append([]byte(nil), v...)
+			return n, nil
+		case num == 4 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			f.Pages = append(f.Pages, int(int32(v)))
+			return n, nil
+		case num == 4 && typ == protowire.BytesType:
+			// Repeated numbers are usually packed.
+			v, n := protowire.ConsumeBytes(b)
+			for len(v) > 0 {
+				p, m := protowire.ConsumeVarint(v)
+				if m < 0 {
+					return m, nil
+				}
+				f.Pages = append(f.Pages, int(int32(p)))
+				v = v[m:]
+			}
+			return n, nil
+		}
+		return protowire.ConsumeFieldValue(num, typ, b), nil
+	})
+}
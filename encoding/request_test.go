@@ -0,0 +1,145 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package encoding
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/siftrics/sight"
+)
+
+// fieldNumbers returns the numbers of the fields of message in
+// proto/sight.proto, by name.
+func fieldNumbers(t *testing.T, messages map[string]map[protowire.Number]protoField, message string) map[string]protowire.Number {
+	t.Helper()
+	fields, ok := messages[message]
+	if !ok {
+		t.Fatalf("proto/sight.proto has no message %v", message)
+	}
+	nums := make(map[string]protowire.Number)
+	for num, f := range fields {
+		nums[f.name] = num
+	}
+	return nums
+}
+
+func TestUnmarshalRecognizeRequest(t *testing.T) {
+	messages := readProtoFile(t)
+	req, file := fieldNumbers(t, messages, "RecognizeRequest"), fieldNumbers(t, messages, "File")
+
+	var f []byte
+	f = protowire.AppendTag(f, file["name"], protowire.BytesType)
+	f = protowire.AppendString(f, "scan.pdf")
+	f = protowire.AppendTag(f, file["mime_type"], protowire.BytesType)
+	f = protowire.AppendString(f, "application/pdf")
+	f = protowire.AppendTag(f, file["contents"], protowire.BytesType)
+	f = protowire.AppendBytes(f, []byte("%PDF-1.7"))
+	// Pages, packed and then not.
+	var packed []byte
+	packed = protowire.AppendVarint(packed, 3)
+	packed = protowire.AppendVarint(packed, 1)
+	f = protowire.AppendTag(f, file["pages"], protowire.BytesType)
+	f = protowire.AppendBytes(f, packed)
+	f = protowire.AppendTag(f, file["pages"], protowire.VarintType)
+	f = protowire.AppendVarint(f, 7)
+
+	var entry []byte
+	entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+	entry = protowire.AppendString(entry, "tenant")
+	entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+	entry = protowire.AppendString(entry, "acme")
+
+	var b []byte
+	b = protowire.AppendTag(b, req["files"], protowire.BytesType)
+	b = protowire.AppendBytes(b, f)
+	b = protowire.AppendTag(b, req["files"], protowire.BytesType)
+	b = protowire.AppendBytes(b, nil)
+	for _, name := range []string{"words", "auto_rotate", "detect_barcodes"} {
+		b = protowire.AppendTag(b, req[name], protowire.VarintType)
+		b = protowire.AppendVarint(b, 1)
+	}
+	for _, hint := range []string{"latin", "cyrillic"} {
+		b = protowire.AppendTag(b, req["script_hints"], protowire.BytesType)
+		b = protowire.AppendString(b, hint)
+	}
+	b = protowire.AppendTag(b, req["priority"], protowire.BytesType)
+	b = protowire.AppendString(b, "high")
+	b = protowire.AppendTag(b, req["tags"], protowire.BytesType)
+	b = protowire.AppendBytes(b, entry)
+	// An unknown field is skipped.
+	b = protowire.AppendTag(b, 99, protowire.BytesType)
+	b = protowire.AppendString(b, "from a newer client")
+
+	var r RecognizeRequest
+	if err := UnmarshalRecognizeRequest(b, &r); err != nil {
+		t.Fatal(err)
+	}
+	want := RecognizeRequest{
+		Files: []sight.File{
+			{Name: "scan.pdf", MimeType: "application/pdf", Contents: []byte("%PDF-1.7"), Pages: []int{3, 1, 7}},
+			{},
+		},
+		Config: sight.Config{
+			MakeSentences:  false,
+			DoAutoRotate:   true,
+			DetectBarcodes: true,
+			ScriptHints:    []string{"latin", "cyrillic"},
+			Priority:       sight.Priority("high"),
+			Tags:           map[string]string{"tenant": "acme"},
+		},
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("UnmarshalRecognizeRequest = %+v, want %+v", r, want)
+	}
+}
+
+func TestUnmarshalRecognizeRequestDefaults(t *testing.T) {
+	var r RecognizeRequest
+	if err := UnmarshalRecognizeRequest(nil, &r); err != nil {
+		t.Fatal(err)
+	}
+	want := RecognizeRequest{Config: sight.Config{MakeSentences: true, ScriptHints: []string{}}}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("UnmarshalRecognizeRequest(nil) = %+v, want %+v", r, want)
+	}
+}
+
+func TestUnmarshalRecognizeRequestMalformed(t *testing.T) {
+	var f []byte
+	f = protowire.AppendTag(f, 1, protowire.BytesType)
+	f = append(f, 10, 'a')
+	for _, b := range [][]byte{
+		// A truncated tag.
+		{0x80},
+		// A file cut short.
+		protowire.AppendBytes(protowire.AppendTag(nil, 1, protowire.BytesType), f),
+		// A length beyond the end.
+		{0x0a, 0x05, 0x01},
+	} {
+		var r RecognizeRequest
+		if err := UnmarshalRecognizeRequest(b, &r); err == nil {
+			t.Errorf("UnmarshalRecognizeRequest(%x) = %+v, want an error", b, r)
+		}
+	}
+}
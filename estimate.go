@@ -0,0 +1,148 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/siftrics/sight/internal/pdf"
+)
+
+// Pricing is the price of recognizing text with the Sight API.
+type Pricing struct {
+	DollarsPerPage float64
+}
+
+// DefaultPricing is the published price of the Sight API, $0.50 per 1,000
+// pages.
+var DefaultPricing = Pricing{DollarsPerPage: 0.50 / 1000}
+
+// CostEstimate is the number of pages which files would be billed for and
+// what they would cost, as counted locally by EstimateCost.
+type CostEstimate struct {
+	Pages   int
+	PDFs    int
+	Images  int
+	Dollars float64
+	// Uncounted are the files which would not be submitted or whose pages
+	// could not be counted. They are not included in the other fields.
+	Uncounted []UncountedFile
+}
+
+// UncountedFile is a file left out of a CostEstimate, and why.
+type UncountedFile struct {
+	Name  string
+	Error string
+}
+
+// EstimateCost counts the pages of the files at filePaths and estimates
+// what recognizing them would cost at pricing, without submitting
+// anything. Like RecognizeCfg, it returns an error if a file cannot be read
+// or its MIME type cannot be inferred from its path.
+func EstimateCost(filePaths []string, pricing Pricing) (CostEstimate, error) {
+	files := make([]File, len(filePaths))
+	for i, fp := range filePaths {
+		mimeType, err := mimeTypeFromPath(fp)
+		if err != nil {
+			return CostEstimate{}, err
+		}
+		contents, err := ioutil.ReadFile(fp)
+		if err != nil {
+			return CostEstimate{}, err
+		}
+		files[i] = File{Name: fp, MimeType: mimeType, Contents: contents}
+	}
+	return EstimateFilesCost(Config{}, pricing, files...), nil
+}
+
+// EstimateFilesCost is like EstimateCost, but the files are given in
+// memory. Their selected Pages and cfg.MaxPagesPerFile are taken into
+// account as RecognizeFiles would: a PDF with too many pages is counted as
+// MaxPagesPerFile pages if cfg.TruncateLongFiles is set, and is otherwise
+// uncounted.
+func EstimateFilesCost(cfg Config, pricing Pricing, files ...File) CostEstimate {
+	var e CostEstimate
+	for i, f := range files {
+		n, err := CountPages(f)
+		if err == nil && cfg.MaxPagesPerFile > 0 && n > cfg.MaxPagesPerFile {
+			if !cfg.TruncateLongFiles {
+				err = fmt.Errorf("%v pages, more than the maximum of %v pages per file", n, cfg.MaxPagesPerFile)
+			}
+			n = cfg.MaxPagesPerFile
+		}
+		if err != nil {
+			e.Uncounted = append(e.Uncounted, UncountedFile{fileName(f, i), err.Error()})
+			continue
+		}
+		if isPDF(f) {
+			e.PDFs++
+		} else {
+			e.Images++
+		}
+		e.Pages += n
+	}
+	e.Dollars = float64(e.Pages) * pricing.DollarsPerPage
+	return e
+}
+
+// CountPages returns the number of billable pages in f: the number of pages
+// of a PDF (or of those selected from it), or one for an image. If
+// f.MimeType is empty, it is inferred as RecognizeFiles would infer it.
+func CountPages(f File) (int, error) {
+	mimeType := fileMimeType(f)
+	if !SupportedMimeTypes[mimeType] {
+		return 0, fmt.Errorf("the MIME type %v is not supported", mimeType)
+	}
+	if err := checkContents(mimeType, f.Contents); err != nil {
+		return 0, err
+	}
+	if !isPDF(f) {
+		return 1, nil
+	}
+	if len(f.Pages) != 0 {
+		return len(f.Pages), nil
+	}
+	r, err := pdf.NewReader(f.Contents)
+	if err != nil {
+		return 0, err
+	}
+	return r.NumPages()
+}
+
+func isPDF(f File) bool {
+	return fileMimeType(f) == "application/pdf"
+}
+
+// fileMimeType returns the MIME type of f, inferred from its name or
+// contents if it is not set.
+func fileMimeType(f File) string {
+	if f.MimeType != "" {
+		return f.MimeType
+	}
+	if f.Name != "" {
+		if mimeType, err := mimeTypeFromPath(f.Name); err == nil {
+			return mimeType
+		}
+	}
+	return http.DetectContentType(f.Contents)
+}
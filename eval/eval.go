@@ -0,0 +1,162 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package eval measures the accuracy of recognized text against ground
+// truth, as the character error rate (CER) and word error rate (WER) which
+// are customary for comparing OCR engines:
+//
+//	s := eval.Compare(eval.PageText(pages), truth)
+//	fmt.Printf("CER %.2f%%, WER %.2f%%\n", 100*s.CER, 100*s.WER)
+//
+// Both texts are normalized first: runs of whitespace, including line
+// breaks, count as a single space, so that differences of layout are not
+// counted as errors.
+package eval
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/siftrics/sight"
+)
+
+// Score is the accuracy of the recognized text of one file, or of several
+// added together with Add.
+type Score struct {
+	Name string `json:",omitempty"`
+	// Characters and Words are the length of the ground truth, and
+	// CharacterErrors and WordErrors the number of insertions, deletions
+	// and substitutions which turn the recognized text into it.
+	Characters      int
+	CharacterErrors int
+	Words           int
+	WordErrors      int
+	// CER and WER are CharacterErrors per character and WordErrors per
+	// word. They exceed 1 if much more text was recognized than there is.
+	CER float64
+	WER float64
+}
+
+// Compare scores recognized against truth.
+func Compare(recognized, truth string) Score {
+	rw, tw := strings.Fields(recognized), strings.Fields(truth)
+	rc, tc := []rune(strings.Join(rw, " ")), []rune(strings.Join(tw, " "))
+	s := Score{
+		Characters:      len(tc),
+		CharacterErrors: distance(len(rc), len(tc), func(i, j int) bool { return rc[i] == tc[j] }),
+		Words:           len(tw),
+		WordErrors:      distance(len(rw), len(tw), func(i, j int) bool { return rw[i] == tw[j] }),
+	}
+	s.rates()
+	return s
+}
+
+// Add adds the counts of t to s, so that s is the score of both together.
+// The rates are of all the characters and words, not an average of rates.
+func (s *Score) Add(t Score) {
+	s.Characters += t.Characters
+	s.CharacterErrors += t.CharacterErrors
+	s.Words += t.Words
+	s.WordErrors += t.WordErrors
+	s.rates()
+}
+
+func (s *Score) rates() {
+	s.CER = rate(s.CharacterErrors, s.Characters)
+	s.WER = rate(s.WordErrors, s.Words)
+}
+
+// rate is errors per item. Any error in an empty ground truth is a rate
+// of 1.
+func rate(errors, n int) float64 {
+	if n == 0 {
+		if errors > 0 {
+			return 1
+		}
+		return 0
+	}
+	return float64(errors) / float64(n)
+}
+
+// Report is the scores of a set of files and their Total.
+type Report struct {
+	Files []Score
+	Total Score
+}
+
+// Add adds the score of a file to r.
+func (r *Report) Add(s Score) {
+	r.Files = append(r.Files, s)
+	r.Total.Add(s)
+}
+
+// PageText returns the recognized text of pages, which may arrive in any
+// order, in page order with a line per text element. Pages with an Error
+// are skipped.
+func PageText(pages []sight.RecognizedPage) string {
+	sorted := make([]sight.RecognizedPage, 0, len(pages))
+	for _, p := range pages {
+		if p.Error == "" {
+			sorted = append(sorted, p)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].FileIndex != sorted[j].FileIndex {
+			return sorted[i].FileIndex < sorted[j].FileIndex
+		}
+		return sorted[i].PageNumber < sorted[j].PageNumber
+	})
+	var b strings.Builder
+	for _, p := range sorted {
+		for _, t := range p.RecognizedText {
+			b.WriteString(t.Text)
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+// distance returns the Levenshtein distance between sequences of length n
+// and m whose elements are compared with equal.
+func distance(n, m int, equal func(i, j int) bool) int {
+	prev := make([]int, m+1)
+	cur := make([]int, m+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= n; i++ {
+		cur[0] = i
+		for j := 1; j <= m; j++ {
+			cost := 1
+			if equal(i-1, j-1) {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[m]
+}
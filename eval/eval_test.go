@@ -0,0 +1,118 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package eval
+
+import (
+	"math"
+	"testing"
+
+	"github.com/siftrics/sight"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		recognized, truth string
+		characters        int
+		characterErrors   int
+		words             int
+		wordErrors        int
+	}{
+		{"", "", 0, 0, 0, 0},
+		{"hello world", "hello world", 11, 0, 2, 0},
+		// Whitespace, including line breaks, is normalized.
+		{" hello\n\n world\t", "hello world", 11, 0, 2, 0},
+		{"hel1o world", "hello world", 11, 1, 2, 1},
+		{"helo world", "hello world", 11, 1, 2, 1},
+		{"helllo world", "hello world", 11, 1, 2, 1},
+		{"world hello", "hello world", 11, 8, 2, 2},
+		{"hello", "hello world", 11, 6, 2, 1},
+		{"hello big world", "hello world", 11, 4, 2, 1},
+		{"", "hello world", 11, 11, 2, 2},
+		// Characters, not bytes, are counted.
+		{"Grüsse", "Grüße", 5, 2, 1, 1},
+		{"kitten", "sitting", 7, 3, 1, 1},
+	}
+	for _, tt := range tests {
+		s := Compare(tt.recognized, tt.truth)
+		if s.Characters != tt.characters || s.CharacterErrors != tt.characterErrors || s.Words != tt.words || s.WordErrors != tt.wordErrors {
+			t.Errorf("Compare(%q, %q) = %v/%v characters, %v/%v words; want %v/%v, %v/%v",
+				tt.recognized, tt.truth, s.CharacterErrors, s.Characters, s.WordErrors, s.Words,
+				tt.characterErrors, tt.characters, tt.wordErrors, tt.words)
+		}
+		if want := rate(tt.characterErrors, tt.characters); s.CER != want {
+			t.Errorf("Compare(%q, %q).CER = %v; want %v", tt.recognized, tt.truth, s.CER, want)
+		}
+		if want := rate(tt.wordErrors, tt.words); s.WER != want {
+			t.Errorf("Compare(%q, %q).WER = %v; want %v", tt.recognized, tt.truth, s.WER, want)
+		}
+	}
+}
+
+func TestRates(t *testing.T) {
+	if s := Compare("hello", ""); s.CER != 1 || s.WER != 1 {
+		t.Errorf("rates of text against an empty ground truth = %v, %v; want 1, 1", s.CER, s.WER)
+	}
+	// Much more text than there is.
+	if s := Compare("a b c d", "a"); s.CER != 6 || s.WER != 3 {
+		t.Errorf("rates = %v, %v; want 6, 3", s.CER, s.WER)
+	}
+}
+
+func TestReport(t *testing.T) {
+	var r Report
+	r.Add(Compare("hello world", "hello world"))
+	r.Add(Compare("abc", "abcdefghij"))
+	if len(r.Files) != 2 {
+		t.Fatalf("report has %v files; want 2", len(r.Files))
+	}
+	// The total is of all characters, not an average of the two rates.
+	if r.Total.Characters != 21 || r.Total.CharacterErrors != 7 {
+		t.Errorf("total = %v/%v characters; want 7/21", r.Total.CharacterErrors, r.Total.Characters)
+	}
+	if math.Abs(r.Total.CER-1.0/3) > 1e-12 {
+		t.Errorf("total CER = %v; want 1/3", r.Total.CER)
+	}
+	if r.Total.Words != 3 || r.Total.WordErrors != 1 || math.Abs(r.Total.WER-1.0/3) > 1e-12 {
+		t.Errorf("total = %v/%v words, WER %v; want 1/3 words, 1/3", r.Total.WordErrors, r.Total.Words, r.Total.WER)
+	}
+}
+
+func TestPageText(t *testing.T) {
+	page := func(file, number int, text ...string) sight.RecognizedPage {
+		p := sight.RecognizedPage{FileIndex: file, PageNumber: number}
+		for _, s := range text {
+			p.RecognizedText = append(p.RecognizedText, sight.RecognizedText{Text: s})
+		}
+		return p
+	}
+	failed := page(0, 3, "lost")
+	failed.Error = "failed"
+	pages := []sight.RecognizedPage{
+		page(1, 1, "second file"),
+		page(0, 2, "page", "two"),
+		failed,
+		page(0, 1, "page one"),
+	}
+	want := "page one\npage\ntwo\nsecond file\n"
+	if got := PageText(pages); got != want {
+		t.Errorf("PageText = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package extract finds the fields of common business documents, such as
+// the total of an invoice, in recognized pages:
+//
+//	inv := extract.ParseInvoice(pages)
+//	if inv.Total.Value != "" {
+//		fmt.Printf("total %v %v (confidence %.2f)\n", inv.Total.Value, inv.Currency, inv.Total.Confidence)
+//	}
+//
+// Fields are found by heuristics over the text and its layout: a value is
+// looked for after its label ("Invoice No.", "Due Date", "Total") in the
+// same text element, then in the element to the right of the label, then
+// in the element below it. The labels are in English. Fields which are not
+// found are left zero.
+package extract
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/siftrics/sight"
+)
+
+// Field is a value found in recognized text.
+type Field struct {
+	// Value is the value, normalized: dates are written as 2006-01-02 and
+	// amounts with a decimal point and no thousands separators. It is empty
+	// if the field was not found.
+	Value string `json:",omitempty"`
+	// Confidence is how likely the value is to be right, between 0 and 1:
+	// that of the heuristic which found it times the recognition
+	// confidence of its text.
+	Confidence float64 `json:",omitempty"`
+	// FileIndex and PageNumber are those of the page the value was found
+	// on, and Source is the value as recognized there, with a bounding box
+	// estimated as by sight.SubText.
+	FileIndex  int `json:",omitempty"`
+	PageNumber int `json:",omitempty"`
+	Source     sight.RecognizedText
+}
+
+// element is a recognized text element with its page and the bounds of
+// its box.
+type element struct {
+	page                     *sight.RecognizedPage
+	text                     sight.RecognizedText
+	left, right, top, bottom float64
+}
+
+// elements returns the recognized text of pages without errors.
+func elements(pages []sight.RecognizedPage) []element {
+	var es []element
+	for i := range pages {
+		p := &pages[i]
+		if p.Error != "" {
+			continue
+		}
+		for _, t := range p.RecognizedText {
+			xs := []int{t.TopLeftX, t.TopRightX, t.BottomLeftX, t.BottomRightX}
+			ys := []int{t.TopLeftY, t.TopRightY, t.BottomLeftY, t.BottomRightY}
+			e := element{page: p, text: t, left: math.Inf(1), top: math.Inf(1), right: math.Inf(-1), bottom: math.Inf(-1)}
+			for j := range xs {
+				e.left, e.right = math.Min(e.left, float64(xs[j])), math.Max(e.right, float64(xs[j]))
+				e.top, e.bottom = math.Min(e.top, float64(ys[j])), math.Max(e.bottom, float64(ys[j]))
+			}
+			es = append(es, e)
+		}
+	}
+	return es
+}
+
+func (e element) height() float64 {
+	return math.Max(e.bottom-e.top, 1)
+}
+
+// confidence is the recognition confidence of e, taken to be 1 if it was
+// not reported.
+func (e element) confidence() float64 {
+	if e.text.Confidence <= 0 {
+		return 1
+	}
+	return e.text.Confidence
+}
+
+// field returns the field of the value from the byte offset start to end
+// in the text of e, found by a heuristic with the confidence conf.
+func (e element) field(value string, start, end int, conf float64) Field {
+	return Field{
+		Value:      value,
+		Confidence: math.Round(conf*e.confidence()*1000) / 1000,
+		FileIndex:  e.page.FileIndex,
+		PageNumber: e.page.PageNumber,
+		Source:     sight.SubText(e.text, start, end),
+	}
+}
+
+// rightOf returns the nearest element on the same line as e and right of
+// it, if there is one.
+func rightOf(es []element, e element) (element, bool) {
+	var best element
+	found := false
+	for _, o := range es {
+		if o.page != e.page || o.left < e.right-e.height()/2 {
+			continue
+		}
+		overlap := math.Min(e.bottom, o.bottom) - math.Max(e.top, o.top)
+		if overlap < math.Min(e.height(), o.height())/2 {
+			continue
+		}
+		if !found || o.left < best.left {
+			best, found = o, true
+		}
+	}
+	return best, found
+}
+
+// below returns the nearest element under e, within two lines of it, which
+// overlaps it horizontally.
+func below(es []element, e element) (element, bool) {
+	var best element
+	found := false
+	for _, o := range es {
+		if o.page != e.page || o.top < e.bottom-e.height()/2 || o.top > e.bottom+2*e.height() {
+			continue
+		}
+		if math.Min(e.right, o.right) <= math.Max(e.left, o.left) {
+			continue
+		}
+		if !found || o.top < best.top {
+			best, found = o, true
+		}
+	}
+	return best, found
+}
+
+// label is a label of a field, with the confidence that a value after it
+// is the field.
+type label struct {
+	pattern *regexp.Regexp
+	weight  float64
+	// unless, if set, matches text in which the label is part of another,
+	// such as "Date" in "Due Date".
+	unless *regexp.Regexp
+}
+
+// parser finds a value in s, returning it normalized, with its byte offsets
+// and the confidence that it is right.
+type parser func(s string) (value string, start, end int, conf float64, ok bool)
+
+// Confidences of values by where they are found relative to their label.
+const (
+	sameElement  = 0.9
+	rightElement = 0.8
+	belowElement = 0.6
+)
+
+// findLabeled returns the values found after the labels in es by parse.
+// The text after a label is cut at the next label of any field, matched by
+// stop, so that a line with several labels yields the value of each; a
+// label directly followed by another, as "Invoice" in "Invoice Date", is
+// not a label.
+func findLabeled(es []element, labels []label, stop *regexp.Regexp, parse parser) []Field {
+	var found []Field
+	for _, e := range es {
+		for _, l := range labels {
+			m := l.pattern.FindStringIndex(e.text.Text)
+			if m == nil || (l.unless != nil && l.unless.MatchString(e.text.Text)) {
+				continue
+			}
+			rest := e.text.Text[m[1]:]
+			if s := stop.FindStringIndex(rest); s != nil {
+				if strings.TrimSpace(rest[:s[0]]) == "" {
+					continue
+				}
+				rest = rest[:s[0]]
+			}
+			if v, start, end, conf, ok := parse(rest); ok {
+				found = append(found, e.field(v, m[1]+start, m[1]+end, l.weight*conf*sameElement))
+				break
+			}
+			for _, next := range []struct {
+				find func([]element, element) (element, bool)
+				conf float64
+			}{{rightOf, rightElement}, {below, belowElement}} {
+				o, ok := next.find(es, e)
+				if !ok || stop.MatchString(o.text.Text) {
+					continue
+				}
+				if v, start, end, conf, ok := parse(o.text.Text); ok {
+					found = append(found, o.field(v, start, end, l.weight*conf*next.conf))
+					break
+				}
+			}
+			break
+		}
+	}
+	return found
+}
+
+// best returns the most confident of fields, the first of those which are
+// as confident.
+func best(fields []Field) Field {
+	var b Field
+	for _, f := range fields {
+		if f.Confidence > b.Confidence {
+			b = f
+		}
+	}
+	return b
+}
+
+// largest returns the most confident of amounts, the largest of those
+// which are as confident, since a total is larger than what it adds up.
+func largest(amounts []Field) Field {
+	var b Field
+	var bv float64
+	for _, f := range amounts {
+		v, _ := strconv.ParseFloat(f.Value, 64)
+		if f.Confidence > b.Confidence || (f.Confidence == b.Confidence && v > bv) {
+			b, bv = f, v
+		}
+	}
+	return b
+}
+
+var datePattern = regexp.MustCompile(`(?i)\b(?:\d{4}-\d{1,2}-\d{1,2}|\d{1,2}[./-]\d{1,2}[./-](?:\d{4}|\d{2})|\d{1,2}(?:st|nd|rd|th)?[ -](?:[a-z]{3,9}\.?)[ -,]+\d{4}|[a-z]{3,9}\.? \d{1,2}(?:st|nd|rd|th)?,? \d{4})\b`)
+
+var ordinalPattern = regexp.MustCompile(`(?i)(\d)(?:st|nd|rd|th)\b`)
+
+// parseDate finds the first date in s. Numeric dates are read as day,
+// month and year if written with dots or if the first number is above 12,
+// and otherwise as month, day and year, with less confidence.
+func parseDate(s string) (value string, start, end int, conf float64, ok bool) {
+	for _, m := range datePattern.FindAllStringIndex(s, -1) {
+		d := s[m[0]:m[1]]
+		if t, conf, ok := readDate(d); ok {
+			return t.Format("2006-01-02"), m[0], m[1], conf, true
+		}
+	}
+	return "", 0, 0, 0, false
+}
+
+func readDate(d string) (time.Time, float64, bool) {
+	if t, err := time.Parse("2006-1-2", d); err == nil {
+		return t, 1, true
+	}
+	f := strings.FieldsFunc(d, func(r rune) bool { return r == '.' || r == '/' || r == '-' })
+	if len(f) == 3 {
+		if first, err := strconv.Atoi(f[0]); err == nil {
+			layout, conf := "1/2/2006", 0.8
+			if strings.Contains(d, ".") || first > 12 {
+				layout, conf = "2/1/2006", 1.0
+			}
+			if len(f[2]) == 2 {
+				f[2] = "20" + f[2]
+			}
+			t, err := time.Parse(layout, strings.Join(f, "/"))
+			return t, conf, err == nil
+		}
+	}
+	// Written months: drop ordinals, commas and the dots of abbreviations.
+	d = ordinalPattern.ReplaceAllString(d, "$1")
+	d = strings.NewReplacer(",", " ", ".", " ", "-", " ").Replace(d)
+	d = strings.Title(strings.ToLower(strings.Join(strings.Fields(d), " ")))
+	d = strings.Replace(d, "Sept ", "Sep ", 1)
+	for _, layout := range []string{"2 January 2006", "2 Jan 2006", "January 2 2006", "Jan 2 2006"} {
+		if t, err := time.Parse(layout, d); err == nil {
+			return t, 1, true
+		}
+	}
+	return time.Time{}, 0, false
+}
+
+// currencies maps the symbols and codes of currencies to their codes.
+var currencies = map[string]string{
+	"$": "USD", "US$": "USD", "€": "EUR", "£": "GBP", "¥": "JPY",
+	"USD": "USD", "EUR": "EUR", "GBP": "GBP", "JPY": "JPY", "CAD": "CAD",
+	"AUD": "AUD", "CHF": "CHF",
+}
+
+var amountPattern = regexp.MustCompile(`(?:(US\$|[$€£¥]|\b(?:USD|EUR|GBP|JPY|CAD|AUD|CHF)\b) ?)?(-?\d{1,3}(?:[,.']\d{3})+(?:[.,]\d{1,2})?|-?\d+(?:[.,]\d{1,2})?)\b(?: ?(US\$|[$€£¥]|\b(?:USD|EUR|GBP|JPY|CAD|AUD|CHF)\b))?`)
+
+// amount is an amount of money found in text.
+type amount struct {
+	value    string
+	number   float64
+	currency string
+	start    int
+	end      int
+}
+
+// findAmounts returns the amounts in s, leaving out percentages.
+func findAmounts(s string) []amount {
+	var amounts []amount
+	for _, m := range amountPattern.FindAllStringSubmatchIndex(s, -1) {
+		if rest := strings.TrimLeftFunc(s[m[1]:], unicode.IsSpace); strings.HasPrefix(rest, "%") {
+			continue
+		}
+		value, ok := normalizeAmount(s[m[4]:m[5]])
+		if !ok {
+			continue
+		}
+		a := amount{value: value, start: m[0], end: m[1]}
+		a.number, _ = strconv.ParseFloat(value, 64)
+		for _, g := range []int{2, 6} {
+			if m[g] >= 0 {
+				a.currency = currencies[s[m[g]:m[g+1]]]
+			}
+		}
+		amounts = append(amounts, a)
+	}
+	return amounts
+}
+
+// normalizeAmount removes the thousands separators of n and writes its
+// decimal separator as a point. A separator followed by one or two digits
+// at the end is a decimal separator.
+func normalizeAmount(n string) (string, bool) {
+	i := strings.LastIndexAny(n, ",.")
+	if i >= 0 && len(n)-i-1 <= 2 {
+		return strings.NewReplacer(",", "", ".", "", "'", "").Replace(n[:i]) + "." + n[i+1:], true
+	}
+	return strings.NewReplacer(",", "", ".", "", "'", "").Replace(n), n != ""
+}
+
+// parseAmount finds the last amount in s, as the amount after a label is
+// usually last, e.g., in "Total (3 items) 42.00".
+func parseAmount(s string) (value string, start, end int, conf float64, ok bool) {
+	amounts := findAmounts(s)
+	if len(amounts) == 0 {
+		return "", 0, 0, 0, false
+	}
+	a := amounts[len(amounts)-1]
+	return a.value, a.start, a.end, 1, true
+}
@@ -0,0 +1,184 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package extract
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/siftrics/sight"
+)
+
+// Invoice is the fields of an invoice.
+type Invoice struct {
+	Number  Field
+	Date    Field
+	DueDate Field
+	Vendor  Field
+	// Total is the amount to pay, and Tax the tax included in it.
+	Total Field
+	Tax   Field
+	// Currency is the ISO 4217 code of the currency of Total, or of Tax,
+	// if either is written with a symbol or code, e.g., "$" or "EUR".
+	Currency string `json:",omitempty"`
+}
+
+var (
+	numberLabels = []label{
+		{pattern: regexp.MustCompile(`(?i)\b(?:invoice|inv\.?|bill)\s*(?:no\b\.?|number\b|num\b\.?|#|id\b)\s*[:#.]?`), weight: 1},
+		{pattern: regexp.MustCompile(`(?i)\binvoice\b\s*[:#]?`), weight: 0.6},
+	}
+	dateLabels = []label{
+		{pattern: regexp.MustCompile(`(?i)\b(?:(?:invoice|issue|billing)\s+date|date\s+of\s+(?:issue|invoice))\b\s*:?`), weight: 1},
+		{pattern: regexp.MustCompile(`(?i)\bdated?\b\s*:?`), weight: 0.7, unless: regexp.MustCompile(`(?i)\bdue\b`)},
+	}
+	dueDateLabels = []label{
+		{pattern: regexp.MustCompile(`(?i)\b(?:due\s+date|payment\s+due|due\s+(?:by|on)|pay\s+by|due)\b\s*:?`), weight: 1},
+	}
+	totalLabels = []label{
+		{pattern: regexp.MustCompile(`(?i)\b(?:total\s+(?:amount\s+)?due|amount\s+due|balance\s+due|grand\s+total|total\s+amount|invoice\s+total|(?:total\s+|amount\s+)payable)\b\s*:?`), weight: 1},
+		{pattern: regexp.MustCompile(`(?i)\btotal\b\s*:?`), weight: 0.8, unless: regexp.MustCompile(`(?i)\bsub[\s-]?total\b|\btotal\s+(?:tax|vat|gst)\b`)},
+	}
+	taxLabels = []label{
+		{
+			pattern: regexp.MustCompile(`(?i)\b(?:total\s+)?(?:vat|gst|hst|sales\s+tax|tax)(?:\s+amount)?\b(?:\s*\(?\d+(?:[.,]\d+)?\s*%\)?)?\s*:?`),
+			weight:  1,
+			unless:  regexp.MustCompile(`(?i)\b(?:vat|gst|hst|tax)\s*(?:id|no|number|reg|registration|code|exempt)\b|\b(?:incl|including|excl|excluding|before|after|plus)\.?\s+(?:vat|gst|hst|tax)\b`),
+		},
+	}
+	vendorLabels = []label{
+		{pattern: regexp.MustCompile(`(?i)\b(?:from|vendor|seller|supplier|sold\s+by|issued\s+by|bill(?:ed)?\s+from|payee)\s*:`), weight: 0.8},
+	}
+)
+
+// invoiceLabels matches any label of an invoice field.
+var invoiceLabels = anyLabel(numberLabels, dateLabels, dueDateLabels, totalLabels, taxLabels, vendorLabels)
+
+// anyLabel returns a pattern which matches any of the labels.
+func anyLabel(lists ...[]label) *regexp.Regexp {
+	var alternatives []string
+	for _, labels := range lists {
+		for _, l := range labels {
+			alternatives = append(alternatives, strings.TrimPrefix(l.pattern.String(), "(?i)"))
+		}
+	}
+	return regexp.MustCompile(`(?i)` + strings.Join(alternatives, "|"))
+}
+
+var tokenPattern = regexp.MustCompile(`[A-Za-z0-9][A-Za-z0-9/_.-]*[A-Za-z0-9]|[0-9]`)
+
+// parseNumber finds the first token in s which has a digit and is not a
+// date, such as "INV-2021-0042".
+func parseNumber(s string) (value string, start, end int, conf float64, ok bool) {
+	for _, m := range tokenPattern.FindAllStringIndex(s, -1) {
+		token := s[m[0]:m[1]]
+		if !strings.ContainsAny(token, "0123456789") {
+			continue
+		}
+		if _, _, ok := readDate(token); ok {
+			continue
+		}
+		return token, m[0], m[1], 1, true
+	}
+	return "", 0, 0, 0, false
+}
+
+// parseName takes s, trimmed, as a name if it has at least two letters.
+func parseName(s string) (value string, start, end int, conf float64, ok bool) {
+	start = len(s) - len(strings.TrimLeftFunc(s, unicode.IsSpace))
+	end = len(strings.TrimRightFunc(s, func(r rune) bool { return unicode.IsSpace(r) || r == ',' }))
+	if start >= end || letters(s[start:end]) < 2 {
+		return "", 0, 0, 0, false
+	}
+	return s[start:end], start, end, 1, true
+}
+
+func letters(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// ParseInvoice returns the fields of the invoice recognized in pages, which
+// are those of one file.
+func ParseInvoice(pages []sight.RecognizedPage) Invoice {
+	es := elements(pages)
+	inv := Invoice{
+		Number:  best(findLabeled(es, numberLabels, invoiceLabels, parseNumber)),
+		Date:    best(findLabeled(es, dateLabels, invoiceLabels, parseDate)),
+		DueDate: best(findLabeled(es, dueDateLabels, invoiceLabels, parseDate)),
+		Total:   largest(findLabeled(es, totalLabels, invoiceLabels, parseAmount)),
+		Tax:     best(findLabeled(es, taxLabels, invoiceLabels, parseAmount)),
+		Vendor:  best(findLabeled(es, vendorLabels, invoiceLabels, parseName)),
+	}
+	if inv.Vendor.Value == "" {
+		inv.Vendor = letterhead(es)
+	}
+	for _, f := range []Field{inv.Total, inv.Tax} {
+		if a := findAmounts(f.Source.Text); len(a) != 0 && a[len(a)-1].currency != "" {
+			inv.Currency = a[len(a)-1].currency
+			break
+		}
+	}
+	return inv
+}
+
+// letterhead guesses the name of the vendor of an invoice without a label
+// for it: the text in the largest letters in the top quarter of its first
+// page, which is not a label, a date, an amount or an email address.
+func letterhead(es []element) Field {
+	if len(es) == 0 {
+		return Field{}
+	}
+	first := es[0].page
+	height := float64(first.Height)
+	if height <= 0 {
+		for _, e := range es {
+			if e.page == first && e.bottom > height {
+				height = e.bottom
+			}
+		}
+	}
+	var b element
+	found := false
+	for _, e := range es {
+		t := e.text.Text
+		if e.page != first || e.top > height/4 || letters(t) < 2 || letters(t) < len(t)/2 {
+			continue
+		}
+		if invoiceLabels.MatchString(t) || datePattern.MatchString(t) || strings.Contains(t, "@") {
+			continue
+		}
+		if !found || e.height() > b.height() {
+			b, found = e, true
+		}
+	}
+	if !found {
+		return Field{}
+	}
+	value, start, end, _, _ := parseName(b.text.Text)
+	return b.field(value, start, end, 0.5)
+}
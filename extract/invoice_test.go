@@ -0,0 +1,159 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package extract
+
+import (
+	"testing"
+
+	"github.com/siftrics/sight"
+)
+
+// el returns a text element with the box from left, top to right, bottom.
+func el(text string, left, top, right, bottom int) sight.RecognizedText {
+	return sight.RecognizedText{
+		Text:         text,
+		TopLeftX:     left,
+		TopLeftY:     top,
+		TopRightX:    right,
+		TopRightY:    top,
+		BottomLeftX:  left,
+		BottomLeftY:  bottom,
+		BottomRightX: right,
+		BottomRightY: bottom,
+		Confidence:   1,
+	}
+}
+
+// checkField checks that f has the value want, and the confidence conf if
+// it is not zero.
+func checkField(t *testing.T, name string, f Field, want string, conf float64) {
+	t.Helper()
+	if f.Value != want {
+		t.Errorf("%v = %q, want %q", name, f.Value, want)
+	}
+	if conf != 0 && f.Confidence != conf {
+		t.Errorf("%v has confidence %v, want %v", name, f.Confidence, conf)
+	}
+}
+
+func TestParseInvoice(t *testing.T) {
+	page := sight.RecognizedPage{FileIndex: 2, PageNumber: 1, RecognizedText: []sight.RecognizedText{
+		el("ACME Supplies Ltd", 10, 10, 400, 60),
+		el("billing@acme.example", 10, 65, 200, 80),
+		el("Invoice No: INV-2021-0042", 10, 100, 300, 120),
+		// Labels and their values on separate elements: to the right,
+		// and below.
+		el("Invoice Date", 10, 130, 120, 150),
+		el("15/03/2021", 200, 130, 300, 150),
+		el("Due Date:", 10, 160, 120, 180),
+		el("April 14th, 2021", 10, 185, 150, 205),
+		el("Subtotal 1,000.00", 10, 250, 300, 270),
+		el("VAT (20%) €200.00", 10, 280, 300, 300),
+		el("Total due: €1,200.00", 10, 310, 300, 330),
+	}}
+	inv := ParseInvoice([]sight.RecognizedPage{page})
+	checkField(t, "Number", inv.Number, "INV-2021-0042", 0.9)
+	checkField(t, "Date", inv.Date, "2021-03-15", 0.8)
+	checkField(t, "DueDate", inv.DueDate, "2021-04-14", 0.6)
+	checkField(t, "Total", inv.Total, "1200.00", 0.9)
+	checkField(t, "Tax", inv.Tax, "200.00", 0.9)
+	checkField(t, "Vendor", inv.Vendor, "ACME Supplies Ltd", 0.5)
+	if inv.Currency != "EUR" {
+		t.Errorf("Currency = %q, want EUR", inv.Currency)
+	}
+	if inv.Total.Source.Text != "€1,200.00" || inv.Total.FileIndex != 2 || inv.Total.PageNumber != 1 {
+		t.Errorf("Total is %q in file %v, page %v; want %q in file 2, page 1",
+			inv.Total.Source.Text, inv.Total.FileIndex, inv.Total.PageNumber, "€1,200.00")
+	}
+	if inv.Date.Source.Text != "15/03/2021" {
+		t.Errorf("Date is %q, want the element right of its label", inv.Date.Source.Text)
+	}
+}
+
+func TestParseInvoiceSeveralLabelsOnALine(t *testing.T) {
+	page := sight.RecognizedPage{PageNumber: 1, RecognizedText: []sight.RecognizedText{
+		el("From: Globex Corporation", 10, 10, 300, 30),
+		el("Invoice # 7731 Date: 03/04/2021 Terms: Net 30", 10, 40, 500, 60),
+		el("Payment due 2021-05-01", 10, 70, 300, 90),
+		el("Amount due US$ 89.50", 10, 100, 300, 120),
+	}}
+	inv := ParseInvoice([]sight.RecognizedPage{page})
+	checkField(t, "Number", inv.Number, "7731", 0)
+	// A numeric date with a first number of 12 or less is read as
+	// month, day and year, with less confidence.
+	checkField(t, "Date", inv.Date, "2021-03-04", 0.504)
+	checkField(t, "DueDate", inv.DueDate, "2021-05-01", 0)
+	checkField(t, "Total", inv.Total, "89.50", 0)
+	checkField(t, "Vendor", inv.Vendor, "Globex Corporation", 0.72)
+	if inv.Currency != "USD" {
+		t.Errorf("Currency = %q, want USD", inv.Currency)
+	}
+}
+
+func TestParseInvoiceNoTotal(t *testing.T) {
+	pages := []sight.RecognizedPage{
+		{PageNumber: 1, Error: "failed to recognize", RecognizedText: []sight.RecognizedText{el("Total: 99.00", 10, 10, 200, 30)}},
+		{PageNumber: 2, RecognizedText: []sight.RecognizedText{
+			el("Invoice Number 12", 10, 10, 200, 30),
+			el("Thank you for your business", 10, 40, 300, 60),
+			el("Subtotal 50.00", 10, 70, 200, 90),
+		}},
+	}
+	inv := ParseInvoice(pages)
+	checkField(t, "Number", inv.Number, "12", 0)
+	if inv.Total != (Field{}) || inv.Tax != (Field{}) || inv.Currency != "" {
+		t.Errorf("found total %q, tax %q, currency %q on a page without them", inv.Total.Value, inv.Tax.Value, inv.Currency)
+	}
+	if inv.Date.Value != "" || inv.DueDate.Value != "" {
+		t.Errorf("found date %q, due date %q on a page without them", inv.Date.Value, inv.DueDate.Value)
+	}
+}
+
+func TestParseInvoiceEmpty(t *testing.T) {
+	if inv := ParseInvoice(nil); inv != (Invoice{}) {
+		t.Errorf("ParseInvoice(nil) = %+v, want the zero Invoice", inv)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		s, want string
+		conf    float64
+	}{
+		{"2021-03-15", "2021-03-15", 1},
+		{"on 15.03.2021", "2021-03-15", 1},
+		{"15/03/21", "2021-03-15", 1},
+		{"03/15/2021", "2021-03-15", 0.8},
+		{"03/04/2021", "2021-03-04", 0.8},
+		{"1st March 2021", "2021-03-01", 1},
+		{"2 Sept. 2021", "2021-09-02", 1},
+		{"Mar 3, 2021", "2021-03-03", 1},
+		{"December 25th 2020", "2020-12-25", 1},
+		{"13/13/2021", "", 0},
+		{"no date here", "", 0},
+	}
+	for _, tt := range tests {
+		v, _, _, conf, ok := parseDate(tt.s)
+		if v != tt.want || conf != tt.conf || ok != (tt.want != "") {
+			t.Errorf("parseDate(%q) = %q, %v, %v; want %q, %v", tt.s, v, conf, ok, tt.want, tt.conf)
+		}
+	}
+}
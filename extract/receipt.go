@@ -0,0 +1,334 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package extract
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/siftrics/sight"
+)
+
+// Receipt is the fields and line items of a receipt.
+type Receipt struct {
+	Merchant Field
+	Date     Field
+	Items    []LineItem
+	Subtotal Field
+	Tax      Field
+	Total    Field
+	// Currency is the ISO 4217 code of the currency of Total, if it is
+	// written with a symbol or code.
+	Currency string `json:",omitempty"`
+}
+
+// LineItem is a line of a receipt for something bought. Numbers are
+// normalized as the amounts of a Field are.
+type LineItem struct {
+	Description string
+	// Quantity and UnitPrice are empty if they are not written on the
+	// line, as for most items bought once.
+	Quantity  string `json:",omitempty"`
+	UnitPrice string `json:",omitempty"`
+	Amount    string
+	// Confidence is how likely the item is to be right, between 0 and 1:
+	// lower if its amount is out of line with those of the other items or
+	// is not its quantity times its unit price, times the mean recognition
+	// confidence of its words.
+	Confidence float64
+	// FileIndex and PageNumber are those of the page of the item, and
+	// Source is its line, with a box around its words.
+	FileIndex  int `json:",omitempty"`
+	PageNumber int `json:",omitempty"`
+	Source     sight.RecognizedText
+}
+
+var subtotalLabels = []label{
+	{pattern: regexp.MustCompile(`(?i)\bsub[\s-]?total\b\s*:?`), weight: 1},
+}
+
+// receiptLabels matches any label of a receipt field, and also ends the
+// line items, as does what comes after the total, such as the payment.
+var receiptLabels = anyLabel(subtotalLabels, totalLabels, taxLabels, []label{
+	{pattern: regexp.MustCompile(`(?i)\b(?:balance|change|cash|tendered|card|visa|mastercard|amex|debit|credit|tip|gratuity)\b`)},
+})
+
+// ParseReceipt returns the fields and line items of the receipt recognized
+// in pages, which are those of one file. Line items are reconstructed from
+// the words of the receipt, which are split from sentences with
+// sight.SplitPageWords if need be: words are gathered into lines, and a
+// line which ends with an amount aligned with those of the lines around it
+// is an item, up to the first line with a label such as "Subtotal" or
+// "Total". A quantity is read from the start of a line ("2 Coffee") or
+// from before the unit price ("2 x 1.50", "2 @ 1.50"); two amounts at the
+// end of a line are its unit price and amount. A line of description
+// alone is joined to an item below it which has none.
+func ParseReceipt(pages []sight.RecognizedPage) Receipt {
+	es := elements(pages)
+	r := Receipt{
+		Merchant: letterhead(es),
+		Date:     firstDate(es),
+		Subtotal: best(findLabeled(es, subtotalLabels, receiptLabels, parseAmount)),
+		Tax:      best(findLabeled(es, taxLabels, receiptLabels, parseAmount)),
+		Total:    largest(findLabeled(es, totalLabels, receiptLabels, parseAmount)),
+	}
+	if a := findAmounts(r.Total.Source.Text); len(a) != 0 {
+		r.Currency = a[len(a)-1].currency
+	}
+	words := make([]sight.RecognizedPage, len(pages))
+	for i, p := range pages {
+		words[i] = sight.SplitPageWords(p)
+	}
+	r.Items = lineItems(lines(elements(words)))
+	return r
+}
+
+// firstDate returns the first date on a receipt, which rarely has a label.
+func firstDate(es []element) Field {
+	for _, e := range es {
+		if v, start, end, conf, ok := parseDate(e.text.Text); ok {
+			return e.field(v, start, end, 0.8*conf)
+		}
+	}
+	return Field{}
+}
+
+// lines gathers words into lines, from the top of each page down, and the
+// words of each line from left to right. A word is on a line if its middle
+// is within half its height of the middle of the last word added to it.
+func lines(ws []element) [][]element {
+	var all [][]element
+	for len(ws) != 0 {
+		n := 1
+		for n < len(ws) && ws[n].page == ws[0].page {
+			n++
+		}
+		page := append([]element(nil), ws[:n]...)
+		ws = ws[n:]
+		sort.SliceStable(page, func(i, j int) bool { return page[i].top+page[i].bottom < page[j].top+page[j].bottom })
+		var ls [][]element
+		for _, w := range page {
+			mid := (w.top + w.bottom) / 2
+			if k := len(ls) - 1; k >= 0 {
+				last := ls[k][len(ls[k])-1]
+				if math.Abs(mid-(last.top+last.bottom)/2) <= w.height()/2 {
+					ls[k] = append(ls[k], w)
+					continue
+				}
+			}
+			ls = append(ls, []element{w})
+		}
+		for _, l := range ls {
+			sort.SliceStable(l, func(i, j int) bool { return l[i].left < l[j].left })
+		}
+		all = append(all, ls...)
+	}
+	return all
+}
+
+var (
+	// quantityPattern matches a quantity written before a unit price, as
+	// in "2x", "2 x" or "2 @".
+	quantityPattern = regexp.MustCompile(`^(\d+(?:[.,]\d+)?)\s*[xX×@]$`)
+	// integerPattern matches a quantity at the start of a line.
+	integerPattern = regexp.MustCompile(`^\d{1,3}$`)
+	// taxCodePattern matches the tax code which some receipts print after
+	// each amount.
+	taxCodePattern = regexp.MustCompile(`^(?:[A-Z]|\*|[A-Z]\*)$`)
+)
+
+// price returns the amount of a word which is only an amount with cents.
+func price(w element) (string, bool) {
+	a := findAmounts(w.text.Text)
+	if len(a) != 1 || a[0].start != 0 || a[0].end != len(w.text.Text) || !strings.Contains(a[0].value, ".") {
+		return "", false
+	}
+	return a[0].value, true
+}
+
+// lineItems returns the items of a receipt among its lines.
+func lineItems(ls [][]element) []LineItem {
+	var items []LineItem
+	// rights and heights are the right edge and height of the amount of
+	// each item.
+	var rights, heights []float64
+	// pending is a line of description without an amount, which may be
+	// the start of the item below it.
+	var pending []element
+	for _, l := range ls {
+		if receiptLabels.MatchString(lineText(l)) {
+			if len(items) != 0 {
+				break
+			}
+			// Labels above the first item, such as "Card No." in the
+			// header, do not end the items.
+			pending = nil
+			continue
+		}
+		item, amount, ok := lineItem(l)
+		if !ok {
+			pending = nil
+			if letters(lineText(l)) >= 2 {
+				pending = l
+			}
+			continue
+		}
+		if item.Description == "" && pending != nil {
+			item.Description = lineText(pending)
+			item.Source = box(append(append([]element(nil), pending...), l...))
+		}
+		pending = nil
+		if item.Description == "" {
+			continue
+		}
+		items = append(items, item)
+		rights = append(rights, amount.right)
+		heights = append(heights, amount.height())
+	}
+	// Amounts are printed in a column: an item whose amount ends far from
+	// the middle of the column is less likely to be one.
+	if len(items) >= 3 {
+		sorted := append([]float64(nil), rights...)
+		sort.Float64s(sorted)
+		column := sorted[len(sorted)/2]
+		for i := range items {
+			if math.Abs(rights[i]-column) > 2*heights[i] {
+				items[i].Confidence *= 0.6
+			}
+		}
+	}
+	for i := range items {
+		items[i].Confidence = math.Round(items[i].Confidence*1000) / 1000
+	}
+	return items
+}
+
+// lineItem reads a line as an item, if it ends with an amount, which it
+// also returns.
+func lineItem(l []element) (LineItem, element, bool) {
+	words := l
+	if n := len(words); n > 1 && taxCodePattern.MatchString(words[n-1].text.Text) {
+		words = words[:n-1]
+	}
+	n := len(words)
+	amount, ok := price(words[n-1])
+	if !ok {
+		return LineItem{}, element{}, false
+	}
+	item := LineItem{Amount: amount, Confidence: 1, FileIndex: l[0].page.FileIndex, PageNumber: l[0].page.PageNumber}
+	used := make([]bool, n)
+	used[n-1] = true
+	for i := n - 2; i >= 0; i-- {
+		t := words[i].text.Text
+		if m := quantityPattern.FindStringSubmatch(t); m != nil && i+1 < n-1 {
+			// "2 x 1.50 3.00" or "2x 1.50 3.00"
+			if unit, ok := price(words[i+1]); ok {
+				item.Quantity, _ = normalizeAmount(m[1])
+				item.UnitPrice = unit
+				used[i], used[i+1] = true, true
+				break
+			}
+		}
+		if (t == "x" || t == "X" || t == "×" || t == "@") && i > 0 && i+1 < n-1 {
+			// "2 x 1.50 3.00"
+			if unit, ok := price(words[i+1]); ok && integerPattern.MatchString(words[i-1].text.Text) {
+				item.Quantity = words[i-1].text.Text
+				item.UnitPrice = unit
+				used[i-1], used[i], used[i+1] = true, true, true
+				break
+			}
+		}
+	}
+	if item.UnitPrice == "" && n >= 3 {
+		// "Coffee 1.50 3.00"
+		if unit, ok := price(words[n-2]); ok {
+			item.UnitPrice = unit
+			used[n-2] = true
+		}
+	}
+	if item.Quantity == "" && n >= 2 && !used[0] && integerPattern.MatchString(words[0].text.Text) {
+		if q, _ := strconv.Atoi(words[0].text.Text); q > 0 {
+			item.Quantity = words[0].text.Text
+			used[0] = true
+		}
+	}
+	var description []string
+	for i, w := range words {
+		if !used[i] {
+			description = append(description, w.text.Text)
+		}
+	}
+	if letters(strings.Join(description, "")) != 0 {
+		item.Description = strings.Join(description, " ")
+	}
+	if item.Quantity != "" && item.UnitPrice != "" {
+		q, _ := strconv.ParseFloat(item.Quantity, 64)
+		u, _ := strconv.ParseFloat(item.UnitPrice, 64)
+		a, _ := strconv.ParseFloat(item.Amount, 64)
+		if math.Abs(q*u-a) > 0.011 {
+			item.Confidence *= 0.7
+		}
+	}
+	var conf float64
+	for _, w := range l {
+		conf += w.confidence()
+	}
+	item.Confidence *= conf / float64(len(l))
+	item.Source = box(l)
+	return item, words[n-1], true
+}
+
+func lineText(l []element) string {
+	words := make([]string, len(l))
+	for i, w := range l {
+		words[i] = w.text.Text
+	}
+	return strings.Join(words, " ")
+}
+
+// box returns the text of words, in the smallest upright box around them,
+// with their mean confidence.
+func box(words []element) sight.RecognizedText {
+	left, top := math.Inf(1), math.Inf(1)
+	right, bottom := math.Inf(-1), math.Inf(-1)
+	var conf float64
+	for _, w := range words {
+		left, top = math.Min(left, w.left), math.Min(top, w.top)
+		right, bottom = math.Max(right, w.right), math.Max(bottom, w.bottom)
+		conf += w.text.Confidence
+	}
+	l, t, r, b := int(left), int(top), int(right), int(bottom)
+	return sight.RecognizedText{
+		Text:         lineText(words),
+		TopLeftX:     l,
+		TopLeftY:     t,
+		TopRightX:    r,
+		TopRightY:    t,
+		BottomLeftX:  l,
+		BottomLeftY:  b,
+		BottomRightX: r,
+		BottomRightY: b,
+		Confidence:   conf / float64(len(words)),
+	}
+}
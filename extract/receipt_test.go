@@ -0,0 +1,150 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package extract
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/siftrics/sight"
+)
+
+func TestParseReceipt(t *testing.T) {
+	page := sight.RecognizedPage{FileIndex: 1, PageNumber: 1, RecognizedText: []sight.RecognizedText{
+		el("Corner Cafe", 10, 10, 200, 40),
+		el("2021-05-12 14:03", 10, 50, 200, 70),
+		el("2 Coffee 3.00", 10, 100, 300, 120),
+		el("Catering tray 1,250.00", 10, 130, 300, 150),
+		el("Muffin 2 x 1.75 3.50", 10, 160, 300, 180),
+		// A description on a line of its own, above its amount and tax
+		// code.
+		el("Gift basket, large", 10, 190, 200, 210),
+		el("25.00 A", 240, 220, 300, 240),
+		el("Subtotal 1,281.50", 10, 260, 300, 280),
+		el("Tax 8% 102.52", 10, 290, 300, 310),
+		el("TOTAL $1,384.02", 10, 320, 300, 340),
+		el("Visa 1,384.02", 10, 350, 300, 370),
+	}}
+	r := ParseReceipt([]sight.RecognizedPage{page})
+	checkField(t, "Merchant", r.Merchant, "Corner Cafe", 0.5)
+	checkField(t, "Date", r.Date, "2021-05-12", 0.8)
+	checkField(t, "Subtotal", r.Subtotal, "1281.50", 0.9)
+	checkField(t, "Tax", r.Tax, "102.52", 0.9)
+	checkField(t, "Total", r.Total, "1384.02", 0.72)
+	if r.Currency != "USD" {
+		t.Errorf("Currency = %q, want USD", r.Currency)
+	}
+	want := []LineItem{
+		{Description: "Coffee", Quantity: "2", Amount: "3.00"},
+		{Description: "Catering tray", Amount: "1250.00"},
+		{Description: "Muffin", Quantity: "2", UnitPrice: "1.75", Amount: "3.50"},
+		{Description: "Gift basket, large", Amount: "25.00"},
+	}
+	if got := items(r.Items); !reflect.DeepEqual(got, want) {
+		t.Errorf("items = %+v, want %+v", got, want)
+	}
+	for _, item := range r.Items {
+		if item.Confidence != 1 || item.FileIndex != 1 || item.PageNumber != 1 {
+			t.Errorf("item %q has confidence %v, file %v, page %v; want 1, 1, 1", item.Description, item.Confidence, item.FileIndex, item.PageNumber)
+		}
+	}
+	if n := len(r.Items); n == 4 {
+		if src := r.Items[3].Source; src.Text != "Gift basket, large 25.00 A" || src.TopLeftY != 190 || src.BottomRightY != 240 {
+			t.Errorf("last item has source %q from y %v to %v", src.Text, src.TopLeftY, src.BottomRightY)
+		}
+	}
+}
+
+// items returns items without their confidences and sources.
+func items(items []LineItem) []LineItem {
+	var stripped []LineItem
+	for _, item := range items {
+		stripped = append(stripped, LineItem{Description: item.Description, Quantity: item.Quantity, UnitPrice: item.UnitPrice, Amount: item.Amount})
+	}
+	return stripped
+}
+
+func TestReceiptItemConfidence(t *testing.T) {
+	page := sight.RecognizedPage{PageNumber: 1, RecognizedText: []sight.RecognizedText{
+		el("Card No. 1234", 10, 10, 300, 30),
+		el("Bread 2.10", 10, 50, 300, 70),
+		// Its quantity times its unit price is not its amount.
+		el("Tea 3 x 1.00 2.00", 10, 80, 300, 100),
+		el("Milk 0.99", 10, 110, 300, 130),
+		// Its amount is out of the column of the others.
+		el("Jam 4.20", 10, 140, 150, 160),
+		el("Total 9.29", 10, 170, 300, 190),
+		el("Eggs 3.00", 10, 200, 300, 220),
+	}}
+	page.RecognizedText[3].Confidence = 0.5
+	r := ParseReceipt([]sight.RecognizedPage{page})
+	want := map[string]float64{"Bread": 1, "Tea": 0.7, "Milk": 0.5, "Jam": 0.6}
+	got := make(map[string]float64)
+	for _, item := range r.Items {
+		got[item.Description] = item.Confidence
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("item confidences = %v, want %v", got, want)
+	}
+	checkField(t, "Total", r.Total, "9.29", 0)
+}
+
+func TestParseReceiptNoItems(t *testing.T) {
+	page := sight.RecognizedPage{PageNumber: 1, RecognizedText: []sight.RecognizedText{
+		el("Thank you", 10, 10, 200, 30),
+	}}
+	r := ParseReceipt([]sight.RecognizedPage{page})
+	if len(r.Items) != 0 || r.Total.Value != "" || r.Subtotal.Value != "" || r.Tax.Value != "" || r.Currency != "" {
+		t.Errorf("ParseReceipt = %+v, want no items or amounts", r)
+	}
+}
+
+func TestFindAmounts(t *testing.T) {
+	tests := []struct {
+		s        string
+		values   []string
+		currency string
+	}{
+		{"1,250.00", []string{"1250.00"}, ""},
+		{"1.250,00 €", []string{"1250.00"}, "EUR"},
+		{"$1,234,567.89", []string{"1234567.89"}, "USD"},
+		{"USD 1,000", []string{"1000"}, "USD"},
+		{"CHF 1'000.50", []string{"1000.50"}, "CHF"},
+		{"£12,5", []string{"12.5"}, "GBP"},
+		{"-3.20", []string{"-3.20"}, ""},
+		{"VAT 20% 4.00", []string{"4.00"}, ""},
+		{"2 x 1.75 3.50", []string{"2", "1.75", "3.50"}, ""},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		var values []string
+		currency := ""
+		for _, a := range findAmounts(tt.s) {
+			values = append(values, a.value)
+			if a.currency != "" {
+				currency = a.currency
+			}
+		}
+		if !reflect.DeepEqual(values, tt.values) || currency != tt.currency {
+			t.Errorf("findAmounts(%q) = %q in %q, want %q in %q", tt.s, values, currency, tt.values, tt.currency)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+)
+
+// fileInfo is what RecognizedPage records of the file it came from.
+type fileInfo struct {
+	name, path, sha256 string
+	size               int64
+}
+
+// describeFiles sets the FileName, FilePath, FileSHA256 and FileSizeBytes of
+// each page from in to those of its file among files, and the Tags of each
+// page which has none to a copy of tags, shared by the pages.
+func describeFiles(in <-chan RecognizedPage, files []File, tags map[string]string) <-chan RecognizedPage {
+	infos := make([]fileInfo, len(files))
+	for i, f := range files {
+		digest := sha256.Sum256(f.Contents)
+		infos[i] = fileInfo{sha256: hex.EncodeToString(digest[:]), size: int64(len(f.Contents))}
+		if f.Name != "" {
+			infos[i].name, infos[i].path = filepath.Base(f.Name), f.Name
+		}
+	}
+	if len(tags) != 0 {
+		copied := make(map[string]string, len(tags))
+		for k, v := range tags {
+			copied[k] = v
+		}
+		tags = copied
+	}
+	out := make(chan RecognizedPage, 16)
+	go func() {
+		for p := range in {
+			if p.FileIndex >= 0 && p.FileIndex < len(infos) {
+				info := infos[p.FileIndex]
+				p.FileName, p.FilePath, p.FileSHA256, p.FileSizeBytes = info.name, info.path, info.sha256, info.size
+			}
+			if len(p.Tags) == 0 && len(tags) != 0 {
+				p.Tags = tags
+			}
+			out <- p
+		}
+		close(out)
+	}()
+	return out
+}
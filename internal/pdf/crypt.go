@@ -0,0 +1,382 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// ErrBadPassword is the error of Decrypt when the password is neither the
+// user password nor the owner password of the file.
+var ErrBadPassword = errors.New("pdf: incorrect password")
+
+// passwordPadding pads passwords of the RC4 and AES-128 security handlers.
+var passwordPadding = []byte("\x28\xbf\x4e\x5e\x4e\x75\x8a\x41\x64\x00\x4e\x56\xff\xfa\x01\x08\x2e\x2e\x00\xb6\xd0\x68\x3e\x80\x2f\x0c\xa9\xfe\x64\x53\x69\x7a")
+
+// crypt decrypts the strings and streams of an encrypted file.
+type crypt struct {
+	key []byte
+	// stmAES and strAES are whether streams and strings are encrypted
+	// with AES rather than RC4, and stmNone and strNone whether they are
+	// not encrypted at all (the Identity crypt filter).
+	stmAES, strAES   bool
+	stmNone, strNone bool
+	// aes256 is set for revisions 5 and 6, which use the file key for
+	// every object.
+	aes256          bool
+	encryptMetadata bool
+}
+
+// Decrypt opens an encrypted file with password, which may be its user or
+// its owner password, using the standard security handler. Afterwards,
+// strings and streams are returned decrypted, and Encrypted reports false.
+// It returns ErrBadPassword if the password is wrong.
+func (r *Reader) Decrypt(password string) error {
+	if r.crypt != nil || !r.Encrypted() {
+		return nil
+	}
+	o, err := r.Resolve(r.trailer["Encrypt"])
+	if err != nil {
+		return err
+	}
+	enc, ok := o.(Dict)
+	if !ok {
+		return errors.New("pdf: malformed encryption dictionary")
+	}
+	if enc["Filter"] != Name("Standard") {
+		return fmt.Errorf("pdf: unsupported security handler %v", enc["Filter"])
+	}
+	v, _ := enc["V"].(int64)
+	rev, _ := enc["R"].(int64)
+	ownerKey, _ := enc["O"].(String)
+	userKey, _ := enc["U"].(String)
+	c := &crypt{encryptMetadata: true}
+	if em, ok := enc["EncryptMetadata"].(bool); ok {
+		c.encryptMetadata = em
+	}
+	switch {
+	case v == 1 || v == 2:
+	case v == 4 || v == 5:
+		cf, _ := enc["CF"].(Dict)
+		method := func(name Object) (isAES, none bool, err error) {
+			if name == nil || name == Name("Identity") {
+				return false, true, nil
+			}
+			n, _ := name.(Name)
+			d, _ := cf[n].(Dict)
+			switch d["CFM"] {
+			case Name("V2"):
+				return false, false, nil
+			case Name("AESV2"), Name("AESV3"):
+				return true, false, nil
+			case Name("None"):
+				return false, true, nil
+			}
+			return false, false, fmt.Errorf("pdf: unsupported crypt filter method %v", d["CFM"])
+		}
+		if c.stmAES, c.stmNone, err = method(enc["StmF"]); err != nil {
+			return err
+		}
+		if c.strAES, c.strNone, err = method(enc["StrF"]); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("pdf: unsupported encryption version %v", v)
+	}
+	if rev >= 5 {
+		c.aes256 = true
+		oe, _ := enc["OE"].(String)
+		ue, _ := enc["UE"].(String)
+		if c.key, err = aes256Key([]byte(password), []byte(ownerKey), []byte(userKey), []byte(oe), []byte(ue), rev); err != nil {
+			return err
+		}
+	} else {
+		length := int64(40)
+		if v == 4 {
+			length = 128
+		}
+		if l, ok := enc["Length"].(int64); ok && v > 1 {
+			length = l
+		}
+		if length < 40 || length > 128 || length%8 != 0 {
+			return fmt.Errorf("pdf: invalid key length %v", length)
+		}
+		p, _ := enc["P"].(int64)
+		var id []byte
+		if ids, ok := r.trailer["ID"].(Array); ok && len(ids) != 0 {
+			s, _ := ids[0].(String)
+			id = []byte(s)
+		}
+		h := handler{rev: int(rev), n: int(length / 8), o: []byte(ownerKey), u: []byte(userKey), p: uint32(p), id: id, encryptMetadata: c.encryptMetadata}
+		if c.key = h.userKey([]byte(password)); c.key == nil {
+			if c.key = h.userKey(h.ownerPassword([]byte(password))); c.key == nil {
+				return ErrBadPassword
+			}
+		}
+	}
+	r.crypt = c
+	r.encryptRef, _ = r.trailer["Encrypt"].(Ref)
+	// Object streams read so far were read encrypted.
+	r.objStms = make(map[int][]Object)
+	return nil
+}
+
+// handler is the standard security handler of revisions 2 to 4.
+type handler struct {
+	rev, n          int
+	o, u, id        []byte
+	p               uint32
+	encryptMetadata bool
+}
+
+func pad(password []byte) []byte {
+	return append(append([]byte(nil), password...), passwordPadding...)[:32]
+}
+
+// fileKey computes the file encryption key from a user password.
+func (h handler) fileKey(password []byte) []byte {
+	m := md5.New()
+	m.Write(pad(password))
+	m.Write(h.o)
+	binary.Write(m, binary.LittleEndian, h.p)
+	m.Write(h.id)
+	if h.rev >= 4 && !h.encryptMetadata {
+		m.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	}
+	key := m.Sum(nil)
+	if h.rev >= 3 {
+		for i := 0; i < 50; i++ {
+			sum := md5.Sum(key[:h.n])
+			key = sum[:]
+		}
+	}
+	return key[:h.n]
+}
+
+// userKey returns the file key if password is the user password, and nil
+// otherwise.
+func (h handler) userKey(password []byte) []byte {
+	key := h.fileKey(password)
+	if h.rev == 2 {
+		if bytes.Equal(rc4Crypt(key, passwordPadding), h.u) {
+			return key
+		}
+		return nil
+	}
+	m := md5.New()
+	m.Write(passwordPadding)
+	m.Write(h.id)
+	data := m.Sum(nil)
+	for i := 0; i < 20; i++ {
+		data = rc4Crypt(xorKey(key, byte(i)), data)
+	}
+	if len(h.u) >= 16 && bytes.Equal(data, h.u[:16]) {
+		return key
+	}
+	return nil
+}
+
+// ownerPassword returns the user password recorded in O, given the owner
+// password.
+func (h handler) ownerPassword(password []byte) []byte {
+	sum := md5.Sum(pad(password))
+	key := sum[:]
+	if h.rev >= 3 {
+		for i := 0; i < 50; i++ {
+			sum = md5.Sum(key)
+			key = sum[:]
+		}
+	}
+	key = key[:h.n]
+	if h.rev == 2 {
+		return rc4Crypt(key, h.o)
+	}
+	data := h.o
+	for i := 19; i >= 0; i-- {
+		data = rc4Crypt(xorKey(key, byte(i)), data)
+	}
+	return data
+}
+
+func xorKey(key []byte, b byte) []byte {
+	k := make([]byte, len(key))
+	for i := range key {
+		k[i] = key[i] ^ b
+	}
+	return k
+}
+
+func rc4Crypt(key, data []byte) []byte {
+	c, err := rc4.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+// aes256Key returns the file key of revision 5 or 6, given the user or
+// owner password.
+func aes256Key(password, o, u, oe, ue []byte, rev int64) ([]byte, error) {
+	if len(password) > 127 {
+		password = password[:127]
+	}
+	if len(o) < 48 || len(u) < 48 || len(oe) != 32 || len(ue) != 32 {
+		return nil, errors.New("pdf: malformed encryption dictionary")
+	}
+	var encrypted []byte
+	var salt, udata []byte
+	switch {
+	case bytes.Equal(hash2B(password, u[32:40], nil, rev), u[:32]):
+		encrypted, salt = ue, u[40:48]
+	case bytes.Equal(hash2B(password, o[32:40], u[:48], rev), o[:32]):
+		encrypted, salt, udata = oe, o[40:48], u[:48]
+	default:
+		return nil, ErrBadPassword
+	}
+	block, err := aes.NewCipher(hash2B(password, salt, udata, rev))
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(key, encrypted)
+	return key, nil
+}
+
+// hash2B is the password hash of revision 6 (algorithm 2.B of ISO
+// 32000-2), or the plain SHA-256 of revision 5.
+func hash2B(password, salt, udata []byte, rev int64) []byte {
+	h := sha256.New()
+	h.Write(password)
+	h.Write(salt)
+	h.Write(udata)
+	k := h.Sum(nil)
+	if rev == 5 {
+		return k
+	}
+	for i := 0; ; i++ {
+		var k1 []byte
+		for j := 0; j < 64; j++ {
+			k1 = append(append(append(k1, password...), k...), udata...)
+		}
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+		sum := 0
+		for _, b := range e[:16] {
+			sum += int(b)
+		}
+		var next hash.Hash
+		switch sum % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		default:
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+		if i >= 63 && int(e[len(e)-1]) <= i-31 {
+			return k[:32]
+		}
+	}
+}
+
+// objectKey returns the key of the strings and streams of the object ref.
+func (c *crypt) objectKey(ref Ref, isAES bool) []byte {
+	if c.aes256 {
+		return c.key
+	}
+	m := md5.New()
+	m.Write(c.key)
+	m.Write([]byte{byte(ref.Num), byte(ref.Num >> 8), byte(ref.Num >> 16), byte(ref.Gen), byte(ref.Gen >> 8)})
+	if isAES {
+		m.Write([]byte("sAlT"))
+	}
+	key := m.Sum(nil)
+	if n := len(c.key) + 5; n < len(key) {
+		key = key[:n]
+	}
+	return key
+}
+
+func (c *crypt) decryptData(ref Ref, data []byte, isAES bool) []byte {
+	key := c.objectKey(ref, isAES)
+	if !isAES {
+		return rc4Crypt(key, data)
+	}
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil
+	}
+	out := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(out, data[aes.BlockSize:])
+	if n := int(out[len(out)-1]); n >= 1 && n <= aes.BlockSize && n <= len(out) {
+		out = out[:len(out)-n]
+	}
+	return out
+}
+
+// decrypt returns o, the object ref, with its strings and stream data
+// decrypted.
+func (c *crypt) decrypt(ref Ref, o Object) Object {
+	switch v := o.(type) {
+	case String:
+		if c.strNone {
+			return v
+		}
+		return String(c.decryptData(ref, []byte(v), c.strAES))
+	case Array:
+		a := make(Array, len(v))
+		for i, e := range v {
+			a[i] = c.decrypt(ref, e)
+		}
+		return a
+	case Dict:
+		d := make(Dict, len(v))
+		for k, e := range v {
+			d[k] = c.decrypt(ref, e)
+		}
+		return d
+	case Stream:
+		d := c.decrypt(ref, v.Dict).(Dict)
+		if c.stmNone || v.Dict["Type"] == Name("XRef") || v.Dict["Type"] == Name("Metadata") && !c.encryptMetadata {
+			return Stream{Dict: d, Data: v.Data}
+		}
+		return Stream{Dict: d, Data: c.decryptData(ref, v.Data, c.stmAES)}
+	}
+	return o
+}
@@ -0,0 +1,260 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pdf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// encryption is a configuration of the standard security handler, with
+// which the tests encrypt files.
+type encryption struct {
+	name string
+	v    int
+	rev  int
+	// n is the length of the file key in bytes.
+	n   int
+	aes bool
+}
+
+var encryptions = []encryption{
+	{"RC4 40-bit", 1, 2, 5, false},
+	{"RC4 128-bit", 2, 3, 16, false},
+	{"AES-128", 4, 4, 16, true},
+	{"AES-256", 5, 6, 32, true},
+}
+
+var fileID = []byte("0123456789abcdef")
+
+const permissions = -44
+
+func rc4Key(key, data []byte) []byte {
+	c, err := rc4.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	out := make([]byte, len(data))
+	c.XORKeyStream(out, data)
+	return out
+}
+
+// rc4Rounds encrypts data with key, then, for revision 3 and later, again
+// with key XORed with each of 1 to 19.
+func rc4Rounds(key, data []byte, rev int) []byte {
+	data = rc4Key(key, data)
+	if rev >= 3 {
+		for i := 1; i <= 19; i++ {
+			k := make([]byte, len(key))
+			for j := range key {
+				k[j] = key[j] ^ byte(i)
+			}
+			data = rc4Key(k, data)
+		}
+	}
+	return data
+}
+
+// md5Rounds returns the MD5 hash of data, hashed again 50 times, each time
+// of its first n bytes, for revision 3 and later.
+func md5Rounds(data []byte, n, rev int) []byte {
+	sum := md5.Sum(data)
+	key := sum[:]
+	if rev >= 3 {
+		for i := 0; i < 50; i++ {
+			sum = md5.Sum(key[:n])
+			key = sum[:]
+		}
+	}
+	return key[:n]
+}
+
+func padded(password string) []byte {
+	return append([]byte(password), passwordPadding...)[:32]
+}
+
+func aesCBC(key, iv, data []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+	return out
+}
+
+// keys returns the file key and the entries of the encryption dictionary
+// which record the user and owner passwords.
+func (e encryption) keys(user, owner string) (key []byte, entries string) {
+	if e.rev >= 5 {
+		key = bytes.Repeat([]byte{0x42}, 32)
+		userSalts := []byte("uvalsaltukeysalt")
+		u := append(hash2B([]byte(user), userSalts[:8], nil, int64(e.rev)), userSalts...)
+		ue := aesCBC(hash2B([]byte(user), userSalts[8:], nil, int64(e.rev)), make([]byte, 16), key)
+		ownerSalts := []byte("ovalsaltokeysalt")
+		o := append(hash2B([]byte(owner), ownerSalts[:8], u, int64(e.rev)), ownerSalts...)
+		oe := aesCBC(hash2B([]byte(owner), ownerSalts[8:], u, int64(e.rev)), make([]byte, 16), key)
+		return key, fmt.Sprintf("/O <%x> /U <%x> /OE <%x> /UE <%x> /Perms <%x>", o, u, oe, ue, make([]byte, 16))
+	}
+	o := rc4Rounds(md5Rounds(padded(owner), e.n, e.rev), padded(user), e.rev)
+	var p [4]byte
+	perms := int32(permissions)
+	binary.LittleEndian.PutUint32(p[:], uint32(perms))
+	key = md5Rounds(append(append(append(padded(user), o...), p[:]...), fileID...), e.n, e.rev)
+	var u []byte
+	if e.rev == 2 {
+		u = rc4Key(key, passwordPadding)
+	} else {
+		sum := md5.Sum(append(append([]byte(nil), passwordPadding...), fileID...))
+		u = append(rc4Rounds(key, sum[:], e.rev), make([]byte, 16)...)
+	}
+	return key, fmt.Sprintf("/O <%x> /U <%x>", o, u)
+}
+
+// encrypt returns data, of the object num, encrypted with the file key.
+func (e encryption) encrypt(key []byte, num int, data []byte) []byte {
+	if e.rev < 5 {
+		salt := []byte{byte(num), byte(num >> 8), byte(num >> 16), 0, 0}
+		if e.aes {
+			salt = append(salt, "sAlT"...)
+		}
+		sum := md5.Sum(append(append([]byte(nil), key...), salt...))
+		n := len(key) + 5
+		if n > 16 {
+			n = 16
+		}
+		key = sum[:n]
+	}
+	if !e.aes {
+		return rc4Key(key, data)
+	}
+	n := aes.BlockSize - len(data)%aes.BlockSize
+	data = append(append([]byte(nil), data...), bytes.Repeat([]byte{byte(n)}, n)...)
+	iv := []byte("initialvector123")
+	return append(iv, aesCBC(key, iv, data)...)
+}
+
+// build returns a file of one page, encrypted with the user and owner
+// passwords, whose catalog has the Lang "en-US" and whose page shows
+// "HI".
+func (e encryption) build(user, owner string) []byte {
+	key, entries := e.keys(user, owner)
+	dict := fmt.Sprintf("<< /Filter /Standard /V %v /R %v /Length %v /P %v %v", e.v, e.rev, e.n*8, permissions, entries)
+	if e.v >= 4 {
+		method := "AESV2"
+		if e.rev >= 5 {
+			method = "AESV3"
+		}
+		dict += fmt.Sprintf(" /CF << /StdCF << /CFM /%v /Length %v >> >> /StmF /StdCF /StrF /StdCF", method, e.n)
+	}
+	content := string(e.encrypt(key, 5, []byte("BT /F1 10 Tf (HI) Tj ET")))
+	objects := []string{
+		fmt.Sprintf("<< /Type /Catalog /Pages 2 0 R /Lang <%x> >>", e.encrypt(key, 1, []byte("en-US"))),
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 100] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		helvetica,
+		stream("", content),
+		dict + " >>",
+	}
+	id := hex.EncodeToString(fileID)
+	return buildPDF(objects, fmt.Sprintf("/Root 1 0 R /Encrypt 6 0 R /ID [<%v> <%v>]", id, id))
+}
+
+func TestDecrypt(t *testing.T) {
+	for _, e := range encryptions {
+		for _, tt := range []struct {
+			user, password string
+		}{
+			{"user", "user"},
+			{"user", "owner"},
+			{"", ""},
+			{"", "owner"},
+		} {
+			r, err := NewReader(e.build(tt.user, "owner"))
+			if err != nil {
+				t.Fatalf("%v: %v", e.name, err)
+			}
+			if !r.Encrypted() {
+				t.Fatalf("%v: Encrypted reports false before Decrypt", e.name)
+			}
+			if err := r.Decrypt(tt.password); err != nil {
+				t.Errorf("%v: Decrypt(%q) with user password %q: %v", e.name, tt.password, tt.user, err)
+				continue
+			}
+			if r.Encrypted() {
+				t.Errorf("%v: Encrypted reports true after Decrypt", e.name)
+			}
+			catalog, err := r.Catalog()
+			if err != nil {
+				t.Fatalf("%v: %v", e.name, err)
+			}
+			if catalog["Lang"] != String("en-US") {
+				t.Errorf("%v: decrypted Lang = %q; want %q", e.name, catalog["Lang"], "en-US")
+			}
+			pages, err := r.Pages()
+			if err != nil {
+				t.Fatalf("%v: %v", e.name, err)
+			}
+			content, err := r.PageContent(pages[0])
+			if err != nil {
+				t.Fatalf("%v: %v", e.name, err)
+			}
+			if got := joinText(content.Glyphs); got != "HI" {
+				t.Errorf("%v: decrypted text = %q; want %q", e.name, got, "HI")
+			}
+		}
+	}
+}
+
+func TestDecryptBadPassword(t *testing.T) {
+	for _, e := range encryptions {
+		r, err := NewReader(e.build("user", "owner"))
+		if err != nil {
+			t.Fatalf("%v: %v", e.name, err)
+		}
+		if err := r.Decrypt("wrong"); err != ErrBadPassword {
+			t.Errorf("%v: Decrypt(%q) = %v; want ErrBadPassword", e.name, "wrong", err)
+		}
+		if !r.Encrypted() {
+			t.Errorf("%v: Encrypted reports false after a wrong password", e.name)
+		}
+	}
+}
+
+func TestDecryptUnencrypted(t *testing.T) {
+	r, err := NewReader(onePage("BT /F1 10 Tf (HI) Tj ET", "/F1 4 0 R", helvetica))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Encrypted() {
+		t.Error("Encrypted reports true for a file which is not encrypted")
+	}
+	if err := r.Decrypt("any"); err != nil {
+		t.Errorf("Decrypt of a file which is not encrypted: %v", err)
+	}
+}
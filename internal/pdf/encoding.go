@@ -0,0 +1,106 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pdf
+
+import (
+	"strconv"
+	"strings"
+)
+
+// winAnsi80 are the characters of codes 0x80 to 0x9f in WinAnsiEncoding,
+// with 0 for unused codes. The other printable codes are those of Latin-1.
+var winAnsi80 = []rune("€\x00‚ƒ„…†‡ˆ‰Š‹Œ\x00Ž\x00\x00‘’“”•–—˜™š›œ\x00žŸ")
+
+// winAnsi returns the character of code in WinAnsiEncoding, or 0 if it has
+// none.
+func winAnsi(code int) rune {
+	switch {
+	case code < 0x20 || code == 0x7f || code > 0xff:
+		return 0
+	case code >= 0x80 && code < 0xa0:
+		return winAnsi80[code-0x80]
+	}
+	return rune(code)
+}
+
+// winAnsiNames are the glyph names of codes 0x20 to 0xff in WinAnsiEncoding,
+// separated by spaces, with "-" for unused codes.
+const winAnsiNames = `space exclam quotedbl numbersign dollar percent ampersand quotesingle
+parenleft parenright asterisk plus comma hyphen period slash zero one two three four five
+six seven eight nine colon semicolon less equal greater question at A B C D E F G H I J K L
+M N O P Q R S T U V W X Y Z bracketleft backslash bracketright asciicircum underscore grave
+a b c d e f g h i j k l m n o p q r s t u v w x y z braceleft bar braceright asciitilde -
+Euro - quotesinglbase florin quotedblbase ellipsis dagger daggerdbl circumflex perthousand
+Scaron guilsinglleft OE - Zcaron - - quoteleft quoteright quotedblleft quotedblright bullet
+endash emdash tilde trademark scaron guilsinglright oe - zcaron Ydieresis space exclamdown
+cent sterling currency yen brokenbar section dieresis copyright ordfeminine guillemotleft
+logicalnot hyphen registered macron degree plusminus twosuperior threesuperior acute mu
+paragraph periodcentered cedilla onesuperior ordmasculine guillemotright onequarter onehalf
+threequarters questiondown Agrave Aacute Acircumflex Atilde Adieresis Aring AE Ccedilla
+Egrave Eacute Ecircumflex Edieresis Igrave Iacute Icircumflex Idieresis Eth Ntilde Ograve
+Oacute Ocircumflex Otilde Odieresis multiply Oslash Ugrave Uacute Ucircumflex Udieresis
+Yacute Thorn germandbls agrave aacute acircumflex atilde adieresis aring ae ccedilla egrave
+eacute ecircumflex edieresis igrave iacute icircumflex idieresis eth ntilde ograve oacute
+ocircumflex otilde odieresis divide oslash ugrave uacute ucircumflex udieresis yacute thorn
+ydieresis`
+
+// glyphNames maps glyph names to their text: those of WinAnsiEncoding, and
+// a few others common in Differences arrays.
+var glyphNames = map[string]string{
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+	"minus": "−", "nbspace": " ", "sfthyphen": "­",
+	"dotlessi": "ı", "Lslash": "Ł", "lslash": "ł", "fraction": "⁄",
+}
+
+func init() {
+	for i, name := range strings.Fields(winAnsiNames) {
+		if c := winAnsi(0x20 + i); name != "-" && c != 0 {
+			if _, ok := glyphNames[name]; !ok {
+				glyphNames[name] = string(c)
+			}
+		}
+	}
+}
+
+// glyphText returns the text of the glyph named name: a known name, a
+// uniXXXX or uXXXX[XX] name, or a known name with a suffix such as ".sc".
+func glyphText(name string) (string, bool) {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+	if text, ok := glyphNames[name]; ok {
+		return text, true
+	}
+	var hex string
+	switch {
+	case strings.HasPrefix(name, "uni") && len(name) == 7:
+		hex = name[3:]
+	case strings.HasPrefix(name, "u") && len(name) >= 5 && len(name) <= 7:
+		hex = name[1:]
+	default:
+		return "", false
+	}
+	c, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || c > 0x10ffff {
+		return "", false
+	}
+	return string(rune(c)), true
+}
@@ -0,0 +1,167 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+)
+
+// imageComponents returns the number of color components of the image
+// XObject stm, which must be in a gray or RGB color space.
+func (r *Reader) imageComponents(stm Stream) (int, error) {
+	cs, err := r.Resolve(stm.Dict["ColorSpace"])
+	if err != nil {
+		return 0, err
+	}
+	switch cs {
+	case Name("DeviceGray"), Name("G"), Name("CalGray"):
+		return 1, nil
+	case Name("DeviceRGB"), Name("RGB"), Name("CalRGB"):
+		return 3, nil
+	}
+	if a, ok := cs.(Array); ok && len(a) >= 2 {
+		switch a[0] {
+		case Name("CalGray"):
+			return 1, nil
+		case Name("CalRGB"):
+			return 3, nil
+		case Name("ICCBased"):
+			o, err := r.Resolve(a[1])
+			if err != nil {
+				return 0, err
+			}
+			if icc, ok := o.(Stream); ok {
+				if n, _ := icc.Dict["N"].(int64); n == 1 || n == 3 {
+					return int(n), nil
+				}
+			}
+		}
+	}
+	return 0, fmt.Errorf("pdf: unsupported image color space %v", cs)
+}
+
+// isDCT reports whether stm is compressed with DCTDecode (JPEG) alone.
+func isDCT(stm Stream) bool {
+	f := stm.Dict["Filter"]
+	if a, ok := f.(Array); ok && len(a) == 1 {
+		f = a[0]
+	}
+	return f == Name("DCTDecode") || f == Name("DCT")
+}
+
+// DecodeImage decodes the image XObject stm. Only 8-bit gray and RGB
+// images, compressed with FlateDecode or DCTDecode or not at all, are
+// supported, which covers most scans apart from bilevel ones.
+func (r *Reader) DecodeImage(stm Stream) (draw.Image, error) {
+	if m, _ := stm.Dict["ImageMask"].(bool); m {
+		return nil, fmt.Errorf("pdf: unsupported image mask")
+	}
+	if _, ok := stm.Dict["Decode"]; ok {
+		return nil, fmt.Errorf("pdf: unsupported image decode array")
+	}
+	n, err := r.imageComponents(stm)
+	if err != nil {
+		return nil, err
+	}
+	if isDCT(stm) {
+		img, err := jpeg.Decode(bytes.NewReader(stm.Data))
+		if err != nil {
+			return nil, err
+		}
+		var dst draw.Image
+		if n == 1 {
+			dst = image.NewGray(img.Bounds())
+		} else {
+			dst = image.NewRGBA(img.Bounds())
+		}
+		draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+		return dst, nil
+	}
+	if bpc, _ := stm.Dict["BitsPerComponent"].(int64); bpc != 8 {
+		return nil, fmt.Errorf("pdf: unsupported image with %v bits per component", bpc)
+	}
+	w, _ := stm.Dict["Width"].(int64)
+	h, _ := stm.Dict["Height"].(int64)
+	data, err := r.decode(stm)
+	if err != nil {
+		return nil, err
+	}
+	if w <= 0 || h <= 0 || int64(len(data)) < w*h*int64(n) {
+		return nil, fmt.Errorf("pdf: image data is shorter than its size")
+	}
+	if n == 1 {
+		img := image.NewGray(image.Rect(0, 0, int(w), int(h)))
+		copy(img.Pix, data)
+		return img, nil
+	}
+	img := image.NewRGBA(image.Rect(0, 0, int(w), int(h)))
+	for i := 0; i < int(w*h); i++ {
+		copy(img.Pix[4*i:4*i+3], data[3*i:3*i+3])
+		img.Pix[4*i+3] = 0xff
+	}
+	return img, nil
+}
+
+// EncodeImage returns the image XObject stm with its pixels replaced by
+// img, which was decoded from it by DecodeImage. JPEG images stay JPEG
+// images; others are compressed with FlateDecode.
+func EncodeImage(stm Stream, img draw.Image) (Stream, error) {
+	d := make(Dict, len(stm.Dict))
+	for k, v := range stm.Dict {
+		d[k] = v
+	}
+	delete(d, "DecodeParms")
+	var buf bytes.Buffer
+	if isDCT(stm) {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return Stream{}, err
+		}
+		d["Filter"] = Name("DCTDecode")
+		return Stream{Dict: d, Data: buf.Bytes()}, nil
+	}
+	zw := zlib.NewWriter(&buf)
+	switch m := img.(type) {
+	case *image.Gray:
+		zw.Write(m.Pix)
+	case *image.RGBA:
+		row := make([]byte, 0, 3*m.Rect.Dx())
+		for y := 0; y < m.Rect.Dy(); y++ {
+			row = row[:0]
+			for x := 0; x < m.Rect.Dx(); x++ {
+				i := y*m.Stride + 4*x
+				row = append(row, m.Pix[i:i+3]...)
+			}
+			zw.Write(row)
+		}
+	default:
+		return Stream{}, fmt.Errorf("pdf: cannot encode %T", img)
+	}
+	if err := zw.Close(); err != nil {
+		return Stream{}, err
+	}
+	d["Filter"] = Name("FlateDecode")
+	return Stream{Dict: d, Data: buf.Bytes()}, nil
+}
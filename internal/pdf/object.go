@@ -0,0 +1,387 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package pdf is a small PDF reader and incremental writer. It understands
+// just enough of the file format (cross-reference tables and streams, object
+// streams, the page tree and Flate-compressed streams) for the Sight client
+// and command-line tool to inspect documents before uploading them and to
+// append annotations to them afterwards.
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+)
+
+// Object is a PDF object. Its dynamic type is one of nil, bool, int64,
+// float64, String, Name, Array, Dict, Stream, Ref or Keyword.
+type Object interface{}
+
+// Name is a PDF name object, without the leading slash.
+type Name string
+
+// String is a PDF string object. It holds raw bytes; use Text to decode a
+// text string.
+type String string
+
+// Array is a PDF array object.
+type Array []Object
+
+// Dict is a PDF dictionary object.
+type Dict map[Name]Object
+
+// Ref is a reference to an indirect object.
+type Ref struct {
+	Num, Gen int
+}
+
+// Stream is a PDF stream object. Data holds the stream contents exactly as
+// they appear in the file, i.e., still encoded with the filters in Dict.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// Keyword is a bare token such as obj, stream or a content stream operator.
+type Keyword string
+
+var errSyntax = errors.New("pdf: syntax error")
+
+func isWhite(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+type lexer struct {
+	b   []byte
+	pos int
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		if isWhite(c) {
+			l.pos++
+		} else if c == '%' {
+			for l.pos < len(l.b) && l.b[l.pos] != '\n' && l.b[l.pos] != '\r' {
+				l.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+func (l *lexer) regular() []byte {
+	start := l.pos
+	for l.pos < len(l.b) && !isWhite(l.b[l.pos]) && !isDelim(l.b[l.pos]) {
+		l.pos++
+	}
+	return l.b[start:l.pos]
+}
+
+// readObject reads the next object. Indirect references ("1 0 R") are
+// recognized; the "obj" and "stream" wrappers of indirect objects are not,
+// and are returned as Keywords.
+func (l *lexer) readObject() (Object, error) {
+	l.skipSpace()
+	if l.pos >= len(l.b) {
+		return nil, errSyntax
+	}
+	switch c := l.b[l.pos]; c {
+	case '/':
+		l.pos++
+		return Name(unescapeName(l.regular())), nil
+	case '(':
+		return l.literalString()
+	case '<':
+		if l.pos+1 < len(l.b) && l.b[l.pos+1] == '<' {
+			l.pos += 2
+			return l.dict()
+		}
+		return l.hexString()
+	case '[':
+		l.pos++
+		var a Array
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.b) {
+				return nil, errSyntax
+			}
+			if l.b[l.pos] == ']' {
+				l.pos++
+				return a, nil
+			}
+			o, err := l.readObject()
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, o)
+		}
+	case ']', ')', '>', '{', '}':
+		l.pos++
+		return Keyword(c), nil
+	}
+	tok := l.regular()
+	if len(tok) == 0 {
+		return nil, errSyntax
+	}
+	switch string(tok) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if c := tok[0]; c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+		if bytes.IndexByte(tok, '.') >= 0 {
+			f, err := strconv.ParseFloat(string(tok), 64)
+			if err != nil {
+				return nil, errSyntax
+			}
+			return f, nil
+		}
+		n, err := strconv.ParseInt(string(tok), 10, 64)
+		if err != nil {
+			return nil, errSyntax
+		}
+		// Look ahead for "gen R".
+		save := l.pos
+		l.skipSpace()
+		genTok := l.regular()
+		if gen, err := strconv.Atoi(string(genTok)); err == nil && len(genTok) > 0 && genTok[0] != '+' && genTok[0] != '-' {
+			l.skipSpace()
+			if l.pos < len(l.b) && l.b[l.pos] == 'R' && (l.pos+1 == len(l.b) || isWhite(l.b[l.pos+1]) || isDelim(l.b[l.pos+1])) {
+				l.pos++
+				return Ref{Num: int(n), Gen: gen}, nil
+			}
+		}
+		l.pos = save
+		return n, nil
+	}
+	return Keyword(tok), nil
+}
+
+func (l *lexer) dict() (Dict, error) {
+	d := make(Dict)
+	for {
+		l.skipSpace()
+		if l.pos+1 < len(l.b) && l.b[l.pos] == '>' && l.b[l.pos+1] == '>' {
+			l.pos += 2
+			return d, nil
+		}
+		k, err := l.readObject()
+		if err != nil {
+			return nil, err
+		}
+		name, ok := k.(Name)
+		if !ok {
+			return nil, errSyntax
+		}
+		v, err := l.readObject()
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			d[name] = v
+		}
+	}
+}
+
+func (l *lexer) literalString() (String, error) {
+	l.pos++
+	var buf []byte
+	depth := 1
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return String(buf), nil
+			}
+		case '\\':
+			if l.pos >= len(l.b) {
+				return "", errSyntax
+			}
+			c = l.b[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.b) && l.b[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					n := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.b) && l.b[l.pos] >= '0' && l.b[l.pos] <= '7'; i++ {
+						n = n*8 + int(l.b[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(n)
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+	return "", errSyntax
+}
+
+func (l *lexer) hexString() (String, error) {
+	l.pos++
+	var buf []byte
+	var hi byte
+	odd := false
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		l.pos++
+		if c == '>' {
+			if odd {
+				buf = append(buf, hi<<4)
+			}
+			return String(buf), nil
+		}
+		v, ok := unhex(c)
+		if !ok {
+			continue
+		}
+		if odd {
+			buf = append(buf, hi<<4|v)
+		} else {
+			hi = v
+		}
+		odd = !odd
+	}
+	return "", errSyntax
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func unescapeName(b []byte) string {
+	if bytes.IndexByte(b, '#') < 0 {
+		return string(b)
+	}
+	var out []byte
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i+2 < len(b) {
+			hi, ok1 := unhex(b[i+1])
+			lo, ok2 := unhex(b[i+2])
+			if ok1 && ok2 {
+				out = append(out, hi<<4|lo)
+				i += 2
+				continue
+			}
+		}
+		out = append(out, b[i])
+	}
+	return string(out)
+}
+
+// Text decodes a PDF text string, which is either UTF-16BE with a byte order
+// mark or (approximately) Latin-1.
+func (s String) Text() string {
+	b := []byte(s)
+	if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		u := make([]uint16, 0, len(b)/2)
+		for i := 2; i+1 < len(b); i += 2 {
+			u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// TextString encodes s as a PDF text string, using UTF-16BE when s is not
+// plain ASCII.
+func TextString(s string) String {
+	ascii := true
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return String(s)
+	}
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2, 2+2*len(u))
+	b[0], b[1] = 0xfe, 0xff
+	for _, v := range u {
+		b = append(b, byte(v>>8), byte(v))
+	}
+	return String(b)
+}
+
+// Num returns o as a float64 if it is a number.
+func Num(o Object) (float64, bool) {
+	switch v := o.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func (r Ref) String() string {
+	return fmt.Sprintf("%d %d R", r.Num, r.Gen)
+}
@@ -0,0 +1,206 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pdf
+
+import (
+	"errors"
+)
+
+// Page is a leaf of the page tree, with its inheritable attributes resolved.
+type Page struct {
+	Ref  Ref
+	Dict Dict
+	// MediaBox is the page boundary in default user space units (1/72 inch)
+	// as [llx lly urx ury].
+	MediaBox [4]float64
+	// Rotate is the number of degrees (a multiple of 90) by which the page
+	// is rotated clockwise when displayed.
+	Rotate    int
+	Resources Dict
+	// inherited holds the inheritable attributes as they appear in the
+	// page tree, unresolved, whether set on the page or on an ancestor.
+	inherited Dict
+}
+
+// Width and Height return the size of the page as displayed, in points,
+// taking Rotate into account.
+func (p Page) Width() float64 {
+	if p.Rotate%180 != 0 {
+		return p.MediaBox[3] - p.MediaBox[1]
+	}
+	return p.MediaBox[2] - p.MediaBox[0]
+}
+
+func (p Page) Height() float64 {
+	if p.Rotate%180 != 0 {
+		return p.MediaBox[2] - p.MediaBox[0]
+	}
+	return p.MediaBox[3] - p.MediaBox[1]
+}
+
+// ToUserSpace maps a point on the displayed page, measured in points from
+// the top-left corner, to default user space.
+func (p Page) ToUserSpace(u, v float64) (x, y float64) {
+	x0, y0, x1, y1 := p.MediaBox[0], p.MediaBox[1], p.MediaBox[2], p.MediaBox[3]
+	switch p.Rotate {
+	case 90:
+		return x0 + v, y0 + u
+	case 180:
+		return x1 - u, y0 + v
+	case 270:
+		return x1 - v, y1 - u
+	}
+	return x0 + u, y1 - v
+}
+
+// FromUserSpace is the inverse of ToUserSpace.
+func (p Page) FromUserSpace(x, y float64) (u, v float64) {
+	x0, y0, x1, y1 := p.MediaBox[0], p.MediaBox[1], p.MediaBox[2], p.MediaBox[3]
+	switch p.Rotate {
+	case 90:
+		return y - y0, x - x0
+	case 180:
+		return x1 - x, y - y0
+	case 270:
+		return y1 - y, x1 - x
+	}
+	return x - x0, y1 - y
+}
+
+// Catalog returns the document catalog.
+func (r *Reader) Catalog() (Dict, error) {
+	o, err := r.Resolve(r.trailer["Root"])
+	if err != nil {
+		return nil, err
+	}
+	d, ok := o.(Dict)
+	if !ok {
+		return nil, errors.New("pdf: missing document catalog")
+	}
+	return d, nil
+}
+
+// NumPages returns the number of pages in the document, as recorded in the
+// root of the page tree.
+func (r *Reader) NumPages() (int, error) {
+	cat, err := r.Catalog()
+	if err != nil {
+		return 0, err
+	}
+	o, err := r.Resolve(cat["Pages"])
+	if err != nil {
+		return 0, err
+	}
+	pages, ok := o.(Dict)
+	if !ok {
+		return 0, errors.New("pdf: missing page tree")
+	}
+	n, ok := pages["Count"].(int64)
+	if !ok {
+		o, err := r.Resolve(pages["Count"])
+		if err != nil {
+			return 0, err
+		}
+		if n, ok = o.(int64); !ok {
+			return 0, errors.New("pdf: page tree has no count")
+		}
+	}
+	return int(n), nil
+}
+
+// Pages walks the page tree and returns every page in order.
+func (r *Reader) Pages() ([]Page, error) {
+	cat, err := r.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	var pages []Page
+	seen := make(map[Ref]bool)
+	var walk func(node Object, inherited Dict) error
+	walk = func(node Object, inherited Dict) error {
+		ref, _ := node.(Ref)
+		if ref.Num != 0 {
+			if seen[ref] {
+				return errors.New("pdf: page tree contains a cycle")
+			}
+			seen[ref] = true
+		}
+		o, err := r.Resolve(node)
+		if err != nil {
+			return err
+		}
+		d, ok := o.(Dict)
+		if !ok {
+			return errors.New("pdf: malformed page tree")
+		}
+		attrs := make(Dict)
+		for k, v := range inherited {
+			attrs[k] = v
+		}
+		for _, k := range []Name{"MediaBox", "CropBox", "Rotate", "Resources"} {
+			if v, ok := d[k]; ok {
+				attrs[k] = v
+			}
+		}
+		if d["Type"] == Name("Pages") || d["Kids"] != nil && d["Type"] != Name("Page") {
+			kids, err := r.Resolve(d["Kids"])
+			if err != nil {
+				return err
+			}
+			ka, _ := kids.(Array)
+			for _, kid := range ka {
+				if err := walk(kid, attrs); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		p := Page{Ref: ref, Dict: d, MediaBox: [4]float64{0, 0, 612, 792}, inherited: attrs}
+		if mb, err := r.Resolve(attrs["MediaBox"]); err == nil {
+			if a, ok := mb.(Array); ok && len(a) == 4 {
+				for i := range a {
+					v, _ := r.Resolve(a[i])
+					p.MediaBox[i], _ = Num(v)
+				}
+				if p.MediaBox[0] > p.MediaBox[2] {
+					p.MediaBox[0], p.MediaBox[2] = p.MediaBox[2], p.MediaBox[0]
+				}
+				if p.MediaBox[1] > p.MediaBox[3] {
+					p.MediaBox[1], p.MediaBox[3] = p.MediaBox[3], p.MediaBox[1]
+				}
+			}
+		}
+		if rot, err := r.Resolve(attrs["Rotate"]); err == nil {
+			if n, ok := rot.(int64); ok {
+				p.Rotate = int(((n % 360) + 360) % 360)
+			}
+		}
+		if res, err := r.Resolve(attrs["Resources"]); err == nil {
+			p.Resources, _ = res.(Dict)
+		}
+		pages = append(pages, p)
+		return nil
+	}
+	if err := walk(cat["Pages"], nil); err != nil {
+		return nil, err
+	}
+	return pages, nil
+}
@@ -0,0 +1,507 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+)
+
+type xrefEntry struct {
+	// typ is 1 for an object at a byte offset and 2 for an object inside an
+	// object stream.
+	typ    byte
+	offset int64 // byte offset (typ 1) or object stream number (typ 2)
+	gen    int   // generation (typ 1) or index within the object stream (typ 2)
+}
+
+// Reader gives random access to the objects of a PDF file held in memory.
+type Reader struct {
+	data    []byte
+	xref    map[int]xrefEntry
+	trailer Dict
+	// startxref is the offset of the most recent cross-reference section
+	// and xrefStream is whether that section is a stream.
+	startxref  int64
+	xrefStream bool
+	objStms    map[int][]Object
+	// crypt decrypts the objects of an encrypted file once Decrypt has
+	// been called, and encryptRef is the encryption dictionary, which is
+	// not encrypted.
+	crypt      *crypt
+	encryptRef Ref
+}
+
+// NewReader parses the cross-reference sections of a PDF file.
+func NewReader(data []byte) (*Reader, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\f\r "), []byte("%PDF-")) {
+		return nil, errors.New("pdf: not a PDF file")
+	}
+	i := bytes.LastIndex(data, []byte("startxref"))
+	if i < 0 {
+		return nil, errors.New("pdf: missing startxref")
+	}
+	l := &lexer{b: data, pos: i + len("startxref")}
+	o, err := l.readObject()
+	if err != nil {
+		return nil, err
+	}
+	off, ok := o.(int64)
+	if !ok || off < 0 || off >= int64(len(data)) {
+		return nil, errors.New("pdf: invalid startxref")
+	}
+	r := &Reader{
+		data:      data,
+		xref:      make(map[int]xrefEntry),
+		startxref: off,
+		objStms:   make(map[int][]Object),
+	}
+	seen := make(map[int64]bool)
+	for first := true; ; first = false {
+		if seen[off] {
+			return nil, errors.New("pdf: cross-reference sections form a loop")
+		}
+		seen[off] = true
+		trailer, isStream, err := r.readXrefSection(off)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			r.trailer = trailer
+			r.xrefStream = isStream
+		}
+		// Hybrid files keep part of the table in a stream.
+		if stm, ok := trailer["XRefStm"].(int64); ok && !seen[stm] {
+			seen[stm] = true
+			if _, _, err := r.readXrefSection(stm); err != nil {
+				return nil, err
+			}
+		}
+		prev, ok := trailer["Prev"].(int64)
+		if !ok {
+			break
+		}
+		off = prev
+	}
+	return r, nil
+}
+
+// readXrefSection reads the cross-reference section at off. Entries already
+// present (from newer sections) take precedence.
+func (r *Reader) readXrefSection(off int64) (Dict, bool, error) {
+	l := &lexer{b: r.data, pos: int(off)}
+	l.skipSpace()
+	if bytes.HasPrefix(r.data[l.pos:], []byte("xref")) {
+		l.pos += len("xref")
+		for {
+			o, err := l.readObject()
+			if err != nil {
+				return nil, false, err
+			}
+			if kw, ok := o.(Keyword); ok && kw == "trailer" {
+				break
+			}
+			start, ok1 := o.(int64)
+			o, err = l.readObject()
+			if err != nil {
+				return nil, false, err
+			}
+			count, ok2 := o.(int64)
+			if !ok1 || !ok2 {
+				return nil, false, errors.New("pdf: malformed cross-reference table")
+			}
+			for i := int64(0); i < count; i++ {
+				l.skipSpace()
+				if l.pos+18 > len(r.data) {
+					return nil, false, errors.New("pdf: truncated cross-reference table")
+				}
+				line := r.data[l.pos : l.pos+18]
+				l.pos += 18
+				entryOff, err1 := strconv.ParseInt(string(line[0:10]), 10, 64)
+				gen, err2 := strconv.Atoi(string(line[11:16]))
+				if err1 != nil || err2 != nil {
+					return nil, false, errors.New("pdf: malformed cross-reference entry")
+				}
+				num := int(start + i)
+				if _, ok := r.xref[num]; ok {
+					continue
+				}
+				if line[17] == 'n' {
+					r.xref[num] = xrefEntry{typ: 1, offset: entryOff, gen: gen}
+				} else {
+					r.xref[num] = xrefEntry{}
+				}
+			}
+		}
+		o, err := l.readObject()
+		if err != nil {
+			return nil, false, err
+		}
+		trailer, ok := o.(Dict)
+		if !ok {
+			return nil, false, errors.New("pdf: malformed trailer")
+		}
+		return trailer, false, nil
+	}
+
+	o, err := r.readIndirect(off)
+	if err != nil {
+		return nil, false, err
+	}
+	stm, ok := o.(Stream)
+	if !ok || stm.Dict["Type"] != Name("XRef") {
+		return nil, false, errors.New("pdf: startxref does not point to a cross-reference section")
+	}
+	data, err := r.decode(stm)
+	if err != nil {
+		return nil, false, err
+	}
+	var w [3]int
+	wa, _ := stm.Dict["W"].(Array)
+	if len(wa) != 3 {
+		return nil, false, errors.New("pdf: malformed cross-reference stream")
+	}
+	for i := range w {
+		n, _ := wa[i].(int64)
+		w[i] = int(n)
+	}
+	index, _ := stm.Dict["Index"].(Array)
+	if index == nil {
+		size, _ := stm.Dict["Size"].(int64)
+		index = Array{int64(0), size}
+	}
+	field := func(b []byte) int64 {
+		var v int64
+		for _, c := range b {
+			v = v<<8 | int64(c)
+		}
+		return v
+	}
+	rowLen := w[0] + w[1] + w[2]
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := index[i].(int64)
+		count, _ := index[i+1].(int64)
+		for j := int64(0); j < count; j++ {
+			if pos+rowLen > len(data) {
+				return nil, false, errors.New("pdf: truncated cross-reference stream")
+			}
+			row := data[pos : pos+rowLen]
+			pos += rowLen
+			typ := int64(1)
+			if w[0] > 0 {
+				typ = field(row[:w[0]])
+			}
+			num := int(start + j)
+			if _, ok := r.xref[num]; ok {
+				continue
+			}
+			switch typ {
+			case 1, 2:
+				r.xref[num] = xrefEntry{typ: byte(typ), offset: field(row[w[0] : w[0]+w[1]]), gen: int(field(row[w[0]+w[1]:]))}
+			default:
+				r.xref[num] = xrefEntry{}
+			}
+		}
+	}
+	return stm.Dict, true, nil
+}
+
+// readIndirect reads the "num gen obj ... endobj" at off.
+func (r *Reader) readIndirect(off int64) (Object, error) {
+	if off < 0 || off >= int64(len(r.data)) {
+		return nil, fmt.Errorf("pdf: object offset %d out of range", off)
+	}
+	l := &lexer{b: r.data, pos: int(off)}
+	if _, err := l.readObject(); err != nil {
+		return nil, err
+	}
+	if _, err := l.readObject(); err != nil {
+		return nil, err
+	}
+	if kw, err := l.readObject(); err != nil || kw != Keyword("obj") {
+		return nil, fmt.Errorf("pdf: no object at offset %d", off)
+	}
+	o, err := l.readObject()
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := o.(Dict); ok {
+		save := l.pos
+		l.skipSpace()
+		if bytes.HasPrefix(r.data[l.pos:], []byte("stream")) {
+			l.pos += len("stream")
+			if l.pos < len(r.data) && r.data[l.pos] == '\r' {
+				l.pos++
+			}
+			if l.pos < len(r.data) && r.data[l.pos] == '\n' {
+				l.pos++
+			}
+			start := l.pos
+			length := int64(-1)
+			switch v := d["Length"].(type) {
+			case int64:
+				length = v
+			case Ref:
+				if lo, err := r.Resolve(v); err == nil {
+					length, _ = lo.(int64)
+				}
+			}
+			end := start + int(length)
+			if length < 0 || end > len(r.data) || !bytes.HasPrefix(bytes.TrimLeft(r.data[end:], "\r\n\t "), []byte("endstream")) {
+				// Fall back to searching for the end of the stream.
+				i := bytes.Index(r.data[start:], []byte("endstream"))
+				if i < 0 {
+					return nil, errSyntax
+				}
+				end = start + i
+				for end > start && (r.data[end-1] == '\n' || r.data[end-1] == '\r') {
+					end--
+				}
+			}
+			return Stream{Dict: d, Data: r.data[start:end]}, nil
+		}
+		l.pos = save
+	}
+	return o, nil
+}
+
+// Encrypted reports whether the file is encrypted and has not been
+// decrypted with Decrypt. Strings and streams of such files are returned
+// still encrypted.
+func (r *Reader) Encrypted() bool {
+	_, ok := r.trailer["Encrypt"]
+	return ok && r.crypt == nil
+}
+
+// Trailer returns the trailer dictionary of the most recent revision.
+func (r *Reader) Trailer() Dict {
+	return r.trailer
+}
+
+// Resolve follows o if it is a reference and returns o otherwise. Dangling
+// references resolve to nil, as the PDF specification requires.
+func (r *Reader) Resolve(o Object) (Object, error) {
+	for depth := 0; depth < 32; depth++ {
+		ref, ok := o.(Ref)
+		if !ok {
+			return o, nil
+		}
+		e, ok := r.xref[ref.Num]
+		switch {
+		case !ok || e.typ == 0:
+			return nil, nil
+		case e.typ == 1:
+			var err error
+			o, err = r.readIndirect(e.offset)
+			if err != nil {
+				return nil, err
+			}
+			if r.crypt != nil && ref.Num != r.encryptRef.Num {
+				o = r.crypt.decrypt(Ref{Num: ref.Num, Gen: e.gen}, o)
+			}
+		default:
+			objs, err := r.objStm(int(e.offset))
+			if err != nil {
+				return nil, err
+			}
+			if e.gen >= len(objs) {
+				return nil, nil
+			}
+			o = objs[e.gen]
+		}
+	}
+	return nil, errors.New("pdf: reference chain too long")
+}
+
+// objStm returns the objects in object stream num.
+func (r *Reader) objStm(num int) ([]Object, error) {
+	if objs, ok := r.objStms[num]; ok {
+		return objs, nil
+	}
+	o, err := r.Resolve(Ref{Num: num})
+	if err != nil {
+		return nil, err
+	}
+	stm, ok := o.(Stream)
+	if !ok {
+		return nil, fmt.Errorf("pdf: object %d is not an object stream", num)
+	}
+	data, err := r.decode(stm)
+	if err != nil {
+		return nil, err
+	}
+	n, _ := stm.Dict["N"].(int64)
+	first, _ := stm.Dict["First"].(int64)
+	if first < 0 || first > int64(len(data)) {
+		return nil, fmt.Errorf("pdf: malformed object stream %d", num)
+	}
+	l := &lexer{b: data}
+	offsets := make([]int64, 0, n)
+	for i := int64(0); i < n; i++ {
+		if _, err := l.readObject(); err != nil {
+			return nil, err
+		}
+		o, err := l.readObject()
+		if err != nil {
+			return nil, err
+		}
+		off, _ := o.(int64)
+		offsets = append(offsets, off)
+	}
+	objs := make([]Object, len(offsets))
+	for i, off := range offsets {
+		l.pos = int(first + off)
+		if objs[i], err = l.readObject(); err != nil {
+			return nil, err
+		}
+	}
+	r.objStms[num] = objs
+	return objs, nil
+}
+
+// Decode returns the decoded contents of a stream.
+func (r *Reader) Decode(stm Stream) ([]byte, error) {
+	return r.decode(stm)
+}
+
+func (r *Reader) decode(stm Stream) ([]byte, error) {
+	filters, err := r.Resolve(stm.Dict["Filter"])
+	if err != nil {
+		return nil, err
+	}
+	params, err := r.Resolve(stm.Dict["DecodeParms"])
+	if err != nil {
+		return nil, err
+	}
+	var fs, ps Array
+	switch f := filters.(type) {
+	case Name:
+		fs = Array{f}
+		ps = Array{params}
+	case Array:
+		fs = f
+		ps, _ = params.(Array)
+	}
+	data := stm.Data
+	for i, f := range fs {
+		var p Dict
+		if i < len(ps) {
+			po, _ := r.Resolve(ps[i])
+			p, _ = po.(Dict)
+		}
+		switch f {
+		case Name("FlateDecode"), Name("Fl"):
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			data, err = ioutil.ReadAll(zr)
+			if err != nil && len(data) == 0 {
+				return nil, err
+			}
+			if data, err = unpredict(data, p); err != nil {
+				return nil, err
+			}
+		case Name("ASCIIHexDecode"), Name("AHx"):
+			s, _ := (&lexer{b: append(append([]byte{'<'}, data...), '>')}).hexString()
+			data = []byte(s)
+		default:
+			return nil, fmt.Errorf("pdf: unsupported filter %v", f)
+		}
+	}
+	return data, nil
+}
+
+// unpredict reverses a PNG predictor, as used by cross-reference streams.
+func unpredict(data []byte, p Dict) ([]byte, error) {
+	pred, _ := p["Predictor"].(int64)
+	if pred < 10 {
+		return data, nil
+	}
+	columns := int64(1)
+	if c, ok := p["Columns"].(int64); ok {
+		columns = c
+	}
+	colors := int64(1)
+	if c, ok := p["Colors"].(int64); ok {
+		colors = c
+	}
+	bpc := int64(8)
+	if b, ok := p["BitsPerComponent"].(int64); ok {
+		bpc = b
+	}
+	bpp := int((colors*bpc + 7) / 8)
+	rowLen := int((columns*colors*bpc + 7) / 8)
+	if rowLen <= 0 {
+		return nil, errors.New("pdf: invalid predictor parameters")
+	}
+	var out []byte
+	prev := make([]byte, rowLen)
+	for len(data) > rowLen {
+		typ := data[0]
+		row := append([]byte(nil), data[1:rowLen+1]...)
+		data = data[rowLen+1:]
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch typ {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	} else if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
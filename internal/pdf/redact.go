@@ -0,0 +1,48 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pdf
+
+import (
+	"bytes"
+)
+
+// StripText returns the content of p without the glyphs for which strip
+// returns true: the text-showing operators which draw them are replaced by
+// TJ operators which draw the other glyphs and move over the stripped
+// ones, so that the rest of the text stays where it was. Text drawn by form
+// XObjects is left. Everything else is kept byte for byte.
+func (r *Reader) StripText(p Page, strip func(Glyph) bool) ([]byte, error) {
+	data, err := r.contentData(p)
+	if err != nil {
+		return nil, err
+	}
+	cr := &contentReader{r: r, content: &PageContent{}, fonts: make(map[Ref]*font), strip: strip}
+	cr.run(data, p.Resources, identity, 0)
+	var out bytes.Buffer
+	copied := 0
+	for _, e := range cr.edits {
+		out.Write(data[copied:e.start])
+		out.Write(e.text)
+		copied = e.end
+	}
+	out.Write(data[copied:])
+	return out.Bytes(), nil
+}
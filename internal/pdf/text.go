@@ -0,0 +1,775 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pdf
+
+import (
+	"bytes"
+	"math"
+	"unicode/utf16"
+)
+
+// Glyph is a character drawn on a page by a text-showing operator.
+type Glyph struct {
+	// Text is the Unicode text of the glyph, usually one character, or
+	// empty if the font does not tell.
+	Text string
+	// Quad is the box of the glyph in default user space: the bottom-left,
+	// bottom-right, top-right and top-left corners, where the bottom is
+	// the descent of the font below the baseline and the top its ascent.
+	Quad [4][2]float64
+	// Invisible is set for glyphs which are neither filled nor stroked
+	// (text rendering mode 3 or 7), as in the text layer of a scanned
+	// document.
+	Invisible bool
+}
+
+// PageContent is what the content stream of a page draws, as far as
+// PageContent understands it.
+type PageContent struct {
+	// Glyphs are the characters drawn, in the order they are drawn.
+	Glyphs []Glyph
+	// ImageArea is the area, in default user space, covered by images.
+	// Overlapping images are counted as often as they overlap.
+	ImageArea float64
+	// Images are the images drawn, in the order they are drawn.
+	Images []PlacedImage
+}
+
+// PlacedImage is an image drawn on a page.
+type PlacedImage struct {
+	// Ref is the image XObject, or the zero Ref for an inline image.
+	Ref Ref
+	// Matrix maps the unit square, where the image is drawn, to default
+	// user space, as [a b c d e f].
+	Matrix [6]float64
+}
+
+// maxFormDepth bounds the nesting of form XObjects, which may refer to
+// themselves.
+const maxFormDepth = 8
+
+// PageContent interprets the content stream of p, including the form
+// XObjects it draws, and returns the text and images drawn. Malformed
+// content is read up to the first error.
+func (r *Reader) PageContent(p Page) (*PageContent, error) {
+	data, err := r.contentData(p)
+	if err != nil {
+		return nil, err
+	}
+	cr := &contentReader{r: r, content: &PageContent{}, fonts: make(map[Ref]*font)}
+	cr.run(data, p.Resources, identity, 0)
+	return cr.content, nil
+}
+
+// contentData returns the decoded content streams of p, joined.
+func (r *Reader) contentData(p Page) ([]byte, error) {
+	o, err := r.Resolve(p.Dict["Contents"])
+	if err != nil {
+		return nil, err
+	}
+	var streams []Stream
+	switch v := o.(type) {
+	case Stream:
+		streams = append(streams, v)
+	case Array:
+		for _, e := range v {
+			so, err := r.Resolve(e)
+			if err != nil {
+				return nil, err
+			}
+			if s, ok := so.(Stream); ok {
+				streams = append(streams, s)
+			}
+		}
+	}
+	var data []byte
+	for _, s := range streams {
+		d, err := r.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		data = append(append(data, d...), '\n')
+	}
+	return data, nil
+}
+
+// matrix is a transformation matrix [a b c d e f], which maps (x, y) to
+// (ax + cy + e, bx + dy + f).
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns the matrix which applies m and then n.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2], m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2], m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4], m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) [2]float64 {
+	return [2]float64{m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]}
+}
+
+func translate(x, y float64) matrix {
+	return matrix{1, 0, 0, 1, x, y}
+}
+
+type textState struct {
+	font                                             *font
+	size, charSpace, wordSpace, scale, leading, rise float64
+	mode                                             int64
+}
+
+type graphicsState struct {
+	ctm  matrix
+	text textState
+}
+
+type contentReader struct {
+	r       *Reader
+	content *PageContent
+	fonts   map[Ref]*font
+	// strip, if set, selects glyphs which the text-showing operators of
+	// the page itself must no longer draw, and edits are the replacements
+	// of those operators; see StripText.
+	strip func(Glyph) bool
+	edits []edit
+}
+
+// edit replaces the bytes from start to end of a content stream.
+type edit struct {
+	start, end int
+	text       []byte
+}
+
+// numbers returns the last n operands as numbers, or nil if they are not.
+func numbers(operands []Object, n int) []float64 {
+	if len(operands) < n {
+		return nil
+	}
+	v := make([]float64, n)
+	for i, o := range operands[len(operands)-n:] {
+		f, ok := Num(o)
+		if !ok {
+			return nil
+		}
+		v[i] = f
+	}
+	return v
+}
+
+// run interprets the content stream data, with the resources res, drawn
+// with the transformation ctm.
+func (cr *contentReader) run(data []byte, res Dict, ctm matrix, depth int) {
+	l := &lexer{b: data}
+	gs := graphicsState{ctm: ctm, text: textState{scale: 1}}
+	var stack []graphicsState
+	tm, tlm := identity, identity
+	var operands []Object
+	// start is where the operands of the next operator start.
+	start := 0
+	nextLine := func(tx, ty float64) {
+		tlm = translate(tx, ty).mul(tlm)
+		tm = tlm
+	}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.b) {
+			return
+		}
+		if len(operands) == 0 {
+			start = l.pos
+		}
+		o, err := l.readObject()
+		if err != nil {
+			return
+		}
+		op, ok := o.(Keyword)
+		if !ok {
+			operands = append(operands, o)
+			continue
+		}
+		var b *textBuilder
+		if cr.strip != nil && depth == 0 {
+			b = &textBuilder{scale: gs.text.size * gs.text.scale}
+		}
+		switch op {
+		case "q":
+			stack = append(stack, gs)
+		case "Q":
+			if len(stack) != 0 {
+				gs = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if v := numbers(operands, 6); v != nil {
+				gs.ctm = matrix{v[0], v[1], v[2], v[3], v[4], v[5]}.mul(gs.ctm)
+			}
+		case "BT":
+			tm, tlm = identity, identity
+		case "Tf":
+			if len(operands) >= 2 {
+				name, _ := operands[len(operands)-2].(Name)
+				gs.text.font = cr.font(res, name)
+				gs.text.size, _ = Num(operands[len(operands)-1])
+			}
+		case "Tc", "Tw", "Tz", "TL", "Ts", "Tr":
+			v := numbers(operands, 1)
+			if v == nil {
+				break
+			}
+			switch op {
+			case "Tc":
+				gs.text.charSpace = v[0]
+			case "Tw":
+				gs.text.wordSpace = v[0]
+			case "Tz":
+				gs.text.scale = v[0] / 100
+			case "TL":
+				gs.text.leading = v[0]
+			case "Ts":
+				gs.text.rise = v[0]
+			case "Tr":
+				gs.text.mode = int64(v[0])
+			}
+		case "Td", "TD":
+			if v := numbers(operands, 2); v != nil {
+				if op == "TD" {
+					gs.text.leading = -v[1]
+				}
+				nextLine(v[0], v[1])
+			}
+		case "Tm":
+			if v := numbers(operands, 6); v != nil {
+				tlm = matrix{v[0], v[1], v[2], v[3], v[4], v[5]}
+				tm = tlm
+			}
+		case "T*":
+			nextLine(0, -gs.text.leading)
+		case "Tj", "'", "\"":
+			if len(operands) == 0 {
+				break
+			}
+			s, ok := operands[len(operands)-1].(String)
+			if !ok {
+				break
+			}
+			if op == "\"" {
+				if v := numbers(operands[:len(operands)-1], 2); v != nil {
+					gs.text.wordSpace, gs.text.charSpace = v[0], v[1]
+				}
+			}
+			if op != "Tj" {
+				nextLine(0, -gs.text.leading)
+			}
+			tm = cr.show(s, &gs, tm, b)
+			if b != nil && b.stripped {
+				var prefix []byte
+				if op != "Tj" {
+					// The replacement must still move to the next line
+					// and, for ", set the spacing.
+					var spacing bytes.Buffer
+					if op == "\"" && len(operands) >= 3 {
+						writeObject(&spacing, operands[len(operands)-3])
+						spacing.WriteString(" Tw ")
+						writeObject(&spacing, operands[len(operands)-2])
+						spacing.WriteString(" Tc ")
+					}
+					prefix = append(spacing.Bytes(), "T* "...)
+				}
+				cr.edits = append(cr.edits, edit{start, l.pos, append(prefix, b.bytes()...)})
+			}
+		case "TJ":
+			if len(operands) == 0 {
+				break
+			}
+			a, _ := operands[len(operands)-1].(Array)
+			for _, e := range a {
+				if s, ok := e.(String); ok {
+					tm = cr.show(s, &gs, tm, b)
+				} else if n, ok := Num(e); ok {
+					tx := -n / 1000 * gs.text.size * gs.text.scale
+					tm = translate(tx, 0).mul(tm)
+					if b != nil {
+						b.gap += tx
+					}
+				}
+			}
+			if b != nil && b.stripped {
+				cr.edits = append(cr.edits, edit{start, l.pos, b.bytes()})
+			}
+		case "Do":
+			if len(operands) != 0 {
+				name, _ := operands[len(operands)-1].(Name)
+				cr.xobject(res, name, gs.ctm, depth)
+			}
+		case "ID":
+			if !l.skipInlineImage() {
+				return
+			}
+			cr.content.ImageArea += area(gs.ctm)
+			cr.content.Images = append(cr.content.Images, PlacedImage{Matrix: gs.ctm})
+		}
+		operands = operands[:0]
+	}
+}
+
+// skipInlineImage skips the binary data of an inline image, which follows
+// the ID operator and runs to the next EI which stands alone. It reports
+// false if there is no such EI.
+func (l *lexer) skipInlineImage() bool {
+	for i := l.pos + 1; ; i++ {
+		j := bytes.Index(l.b[i:], []byte("EI"))
+		if j < 0 {
+			return false
+		}
+		i += j
+		if isWhite(l.b[i-1]) && (i+2 == len(l.b) || isWhite(l.b[i+2])) {
+			l.pos = i + 2
+			return true
+		}
+	}
+}
+
+// area returns the area of the unit square transformed by m, which is
+// where images are drawn.
+func area(m matrix) float64 {
+	return math.Abs(m[0]*m[3] - m[1]*m[2])
+}
+
+// xobject draws the XObject named name: an image adds to the image area,
+// and a form is interpreted.
+func (cr *contentReader) xobject(res Dict, name Name, ctm matrix, depth int) {
+	xobjects, _ := cr.r.Resolve(res["XObject"])
+	xd, _ := xobjects.(Dict)
+	o, _ := cr.r.Resolve(xd[name])
+	stm, ok := o.(Stream)
+	if !ok {
+		return
+	}
+	switch stm.Dict["Subtype"] {
+	case Name("Image"):
+		ref, _ := xd[name].(Ref)
+		cr.content.ImageArea += area(ctm)
+		cr.content.Images = append(cr.content.Images, PlacedImage{Ref: ref, Matrix: ctm})
+	case Name("Form"):
+		if depth >= maxFormDepth {
+			return
+		}
+		data, err := cr.r.Decode(stm)
+		if err != nil {
+			return
+		}
+		m := identity
+		if mo, _ := cr.r.Resolve(stm.Dict["Matrix"]); mo != nil {
+			if a, ok := mo.(Array); ok && len(a) == 6 {
+				if v := numbers([]Object(a), 6); v != nil {
+					m = matrix{v[0], v[1], v[2], v[3], v[4], v[5]}
+				}
+			}
+		}
+		formRes := res
+		if ro, _ := cr.r.Resolve(stm.Dict["Resources"]); ro != nil {
+			if d, ok := ro.(Dict); ok {
+				formRes = d
+			}
+		}
+		cr.run(data, formRes, m.mul(ctm), depth+1)
+	}
+}
+
+// show draws the string s with the text matrix tm and returns the text
+// matrix after it. If b is not nil, the glyphs are added to it, unless
+// cr.strip selects them.
+func (cr *contentReader) show(s String, gs *graphicsState, tm matrix, b *textBuilder) matrix {
+	ts := gs.text
+	f := ts.font
+	if f == nil {
+		if b != nil {
+			b.keep([]byte(s))
+		}
+		return tm
+	}
+	invisible := ts.mode == 3 || ts.mode == 7
+	for _, code := range f.codes(s) {
+		w := f.width(code)
+		trm := matrix{ts.size * ts.scale, 0, 0, ts.size, 0, ts.rise}.mul(tm).mul(gs.ctm)
+		g := Glyph{
+			Text: f.text(code),
+			Quad: [4][2]float64{
+				trm.apply(0, f.descent),
+				trm.apply(w, f.descent),
+				trm.apply(w, f.ascent),
+				trm.apply(0, f.ascent),
+			},
+			Invisible: invisible,
+		}
+		cr.content.Glyphs = append(cr.content.Glyphs, g)
+		tx := w*ts.size + ts.charSpace
+		if code == ' ' && !f.twoByte {
+			tx += ts.wordSpace
+		}
+		tm = translate(tx*ts.scale, 0).mul(tm)
+		switch {
+		case b == nil:
+		case cr.strip(g):
+			b.gap += tx * ts.scale
+			b.stripped = true
+		case f.twoByte:
+			b.keep([]byte{byte(code >> 8), byte(code)})
+		default:
+			b.keep([]byte{byte(code)})
+		}
+	}
+	return tm
+}
+
+// textBuilder builds a TJ operator which draws the glyphs of a
+// text-showing operator which are kept and moves over those which are
+// stripped.
+type textBuilder struct {
+	// scale is the font size times the horizontal scaling, by which the
+	// numbers of TJ are multiplied.
+	scale    float64
+	array    Array
+	gap      float64
+	stripped bool
+}
+
+// keep adds the bytes of kept glyphs, after the gap before them.
+func (b *textBuilder) keep(code []byte) {
+	b.addGap()
+	if n := len(b.array); n != 0 {
+		if s, ok := b.array[n-1].(String); ok {
+			b.array[n-1] = s + String(code)
+			return
+		}
+	}
+	b.array = append(b.array, String(code))
+}
+
+// addGap adds the gap, as a number of thousandths of a text space unit.
+func (b *textBuilder) addGap() {
+	if b.gap != 0 && b.scale != 0 {
+		b.array = append(b.array, math.Round(-b.gap/b.scale*1e6)/1e3)
+	}
+	b.gap = 0
+}
+
+// bytes returns the TJ operator.
+func (b *textBuilder) bytes() []byte {
+	b.addGap()
+	var buf bytes.Buffer
+	writeObject(&buf, b.array)
+	buf.WriteString(" TJ")
+	return buf.Bytes()
+}
+
+// font is what is needed of a font to place and decode its glyphs.
+type font struct {
+	// twoByte is set for composite (Type0) fonts, whose codes are assumed
+	// to be two bytes long, as with the Identity-H encoding.
+	twoByte bool
+	// widths are the advance widths of codes, in text space units, and
+	// defaultWidth is that of codes without a width.
+	widths       map[int]float64
+	defaultWidth float64
+	// toUnicode maps codes to text, from the ToUnicode CMap of the font
+	// or, for simple fonts, from its encoding.
+	toUnicode map[int]string
+	// ascent and descent are the extent of glyphs above and below the
+	// baseline, in text space units.
+	ascent, descent float64
+}
+
+// font returns the font named name in res, or nil if there is none.
+func (cr *contentReader) font(res Dict, name Name) *font {
+	fonts, _ := cr.r.Resolve(res["Font"])
+	fd, _ := fonts.(Dict)
+	ref, isRef := fd[name].(Ref)
+	if isRef {
+		if f, ok := cr.fonts[ref]; ok {
+			return f
+		}
+	}
+	o, _ := cr.r.Resolve(fd[name])
+	d, ok := o.(Dict)
+	if !ok {
+		return nil
+	}
+	f := cr.r.loadFont(d)
+	if isRef {
+		cr.fonts[ref] = f
+	}
+	return f
+}
+
+func (r *Reader) loadFont(d Dict) *font {
+	f := &font{widths: make(map[int]float64), defaultWidth: 0.5, ascent: 0.75, descent: -0.25}
+	desc := d
+	if d["Subtype"] == Name("Type0") {
+		f.twoByte = true
+		f.defaultWidth = 1
+		kids, _ := r.Resolve(d["DescendantFonts"])
+		if a, ok := kids.(Array); ok && len(a) != 0 {
+			kid, _ := r.Resolve(a[0])
+			if kd, ok := kid.(Dict); ok {
+				desc = kd
+				if dw, _ := r.Resolve(kd["DW"]); dw != nil {
+					if v, ok := Num(dw); ok {
+						f.defaultWidth = v / 1000
+					}
+				}
+				w, _ := r.Resolve(kd["W"])
+				wa, _ := w.(Array)
+				r.cidWidths(wa, f.widths)
+			}
+		}
+	} else {
+		// Type3 glyphs are measured in glyph space, which FontMatrix maps
+		// to text space; other fonts use units of 1/1000.
+		scale := 0.001
+		if fm, _ := r.Resolve(d["FontMatrix"]); fm != nil {
+			if a, ok := fm.(Array); ok && len(a) == 6 {
+				if v, ok := Num(a[0]); ok {
+					scale = v
+				}
+			}
+		}
+		first, _ := r.Resolve(d["FirstChar"])
+		fc, _ := first.(int64)
+		w, _ := r.Resolve(d["Widths"])
+		wa, _ := w.(Array)
+		for i, o := range wa {
+			o, _ = r.Resolve(o)
+			if v, ok := Num(o); ok {
+				f.widths[int(fc)+i] = v * scale
+			}
+		}
+		f.toUnicode = r.simpleEncoding(d["Encoding"])
+	}
+	if fd, _ := r.Resolve(desc["FontDescriptor"]); fd != nil {
+		if fdd, ok := fd.(Dict); ok {
+			if v, ok := Num(fdd["Ascent"]); ok && v > 0 {
+				f.ascent = v / 1000
+			}
+			if v, ok := Num(fdd["Descent"]); ok && v < 0 {
+				f.descent = v / 1000
+			}
+			if v, ok := Num(fdd["MissingWidth"]); ok && v > 0 && !f.twoByte {
+				f.defaultWidth = v / 1000
+			}
+		}
+	}
+	if tu, _ := r.Resolve(d["ToUnicode"]); tu != nil {
+		if stm, ok := tu.(Stream); ok {
+			if data, err := r.Decode(stm); err == nil {
+				cmap := parseCMap(data)
+				if f.toUnicode == nil {
+					f.toUnicode = cmap
+				} else {
+					for code, text := range cmap {
+						f.toUnicode[code] = text
+					}
+				}
+			}
+		}
+	}
+	return f
+}
+
+// cidWidths reads the W array of a CIDFont into widths.
+func (r *Reader) cidWidths(w Array, widths map[int]float64) {
+	for i := 0; i < len(w); {
+		first, _ := r.Resolve(w[i])
+		c, ok := first.(int64)
+		if !ok || i+1 >= len(w) {
+			return
+		}
+		next, _ := r.Resolve(w[i+1])
+		if a, ok := next.(Array); ok {
+			for k, o := range a {
+				o, _ = r.Resolve(o)
+				if v, ok := Num(o); ok {
+					widths[int(c)+k] = v / 1000
+				}
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		last, ok := next.(int64)
+		wo, _ := r.Resolve(w[i+2])
+		v, ok2 := Num(wo)
+		if !ok || !ok2 || last-c > 0xffff {
+			return
+		}
+		for code := c; code <= last; code++ {
+			widths[int(code)] = v / 1000
+		}
+		i += 3
+	}
+}
+
+// simpleEncoding returns the text of the codes of a simple font with the
+// encoding enc. Every base encoding is taken to be WinAnsiEncoding, which
+// agrees with the others on letters and digits; Differences are applied
+// where their glyph names are known.
+func (r *Reader) simpleEncoding(enc Object) map[int]string {
+	m := make(map[int]string, 256)
+	for code := 0x20; code < 0x100; code++ {
+		if c := winAnsi(code); c != 0 {
+			m[code] = string(c)
+		}
+	}
+	eo, _ := r.Resolve(enc)
+	ed, ok := eo.(Dict)
+	if !ok {
+		return m
+	}
+	diffs, _ := r.Resolve(ed["Differences"])
+	da, _ := diffs.(Array)
+	code := 0
+	for _, o := range da {
+		switch v := o.(type) {
+		case int64:
+			code = int(v)
+		case Name:
+			if text, ok := glyphText(string(v)); ok {
+				m[code] = text
+			} else {
+				delete(m, code)
+			}
+			code++
+		}
+	}
+	return m
+}
+
+func (f *font) codes(s String) []int {
+	var codes []int
+	if f.twoByte {
+		for i := 0; i+1 < len(s); i += 2 {
+			codes = append(codes, int(s[i])<<8|int(s[i+1]))
+		}
+		return codes
+	}
+	for i := 0; i < len(s); i++ {
+		codes = append(codes, int(s[i]))
+	}
+	return codes
+}
+
+func (f *font) width(code int) float64 {
+	if w, ok := f.widths[code]; ok {
+		return w
+	}
+	return f.defaultWidth
+}
+
+func (f *font) text(code int) string {
+	return f.toUnicode[code]
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap.
+func parseCMap(data []byte) map[int]string {
+	m := make(map[int]string)
+	l := &lexer{b: data}
+	next := func() Object {
+		l.skipSpace()
+		if l.pos >= len(l.b) {
+			return Keyword("")
+		}
+		o, err := l.readObject()
+		if err != nil {
+			l.pos = len(l.b)
+			return Keyword("")
+		}
+		return o
+	}
+	for l.pos < len(l.b) {
+		switch next() {
+		case Keyword(""):
+			return m
+		case Keyword("beginbfchar"):
+			for {
+				src, ok := next().(String)
+				if !ok {
+					break
+				}
+				if dst, ok := next().(String); ok {
+					m[code(src)] = utf16Text(dst)
+				}
+			}
+		case Keyword("beginbfrange"):
+			for {
+				lo, ok := next().(String)
+				if !ok {
+					break
+				}
+				hi, _ := next().(String)
+				first, last := code(lo), code(hi)
+				if last < first || last-first > 0xffff {
+					next()
+					continue
+				}
+				switch dst := next().(type) {
+				case String:
+					runes := []rune(utf16Text(dst))
+					if len(runes) == 0 {
+						continue
+					}
+					for c := first; c <= last; c++ {
+						m[c] = string(runes)
+						runes[len(runes)-1]++
+					}
+				case Array:
+					for k, o := range dst {
+						if s, ok := o.(String); ok && first+k <= last {
+							m[first+k] = utf16Text(s)
+						}
+					}
+				}
+			}
+		}
+	}
+	return m
+}
+
+func code(s String) int {
+	c := 0
+	for i := 0; i < len(s); i++ {
+		c = c<<8 | int(s[i])
+	}
+	return c
+}
+
+func utf16Text(s String) string {
+	u := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		u = append(u, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return string(utf16.Decode(u))
+}
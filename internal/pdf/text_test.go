@@ -0,0 +1,242 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// buildPDF returns a file of the objects, numbered from 1, with a
+// cross-reference table and a trailer of the Size and the entries of
+// trailer, e.g., "/Root 1 0 R".
+func buildPDF(objects []string, trailer string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(objects))
+	for i, o := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%v 0 obj\n%v\nendobj\n", i+1, o)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %v\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %v %v >>\nstartxref\n%v\n%%%%EOF\n", len(objects)+1, trailer, xref)
+	return buf.Bytes()
+}
+
+// stream returns a stream object of data, with the entries of dict.
+func stream(dict, data string) string {
+	return fmt.Sprintf("<< /Length %v %v >>\nstream\n%v\nendstream", len(data), dict, data)
+}
+
+// onePage returns the objects of a file with a single page, 200 by 100
+// points, which draws content with the fonts in fonts, e.g., "/F1 4 0 R",
+// followed by extra objects from 4 on.
+func onePage(content, fonts string, extra ...string) []byte {
+	objects := append([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 100] /Resources << /Font << %v >> >> /Contents %v 0 R >>", fonts, len(extra)+4),
+	}, extra...)
+	objects = append(objects, stream("", content))
+	return buildPDF(objects, "/Root 1 0 R")
+}
+
+// pageContent reads the first page of data.
+func pageContent(t *testing.T, data []byte) *PageContent {
+	t.Helper()
+	r, err := NewReader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("read %v pages; want 1", len(pages))
+	}
+	content, err := r.PageContent(pages[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func joinText(glyphs []Glyph) string {
+	var text strings.Builder
+	for _, g := range glyphs {
+		text.WriteString(g.Text)
+	}
+	return text.String()
+}
+
+const helvetica = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /FirstChar 72 /Widths [600 400 0] >>"
+
+func TestPageContentText(t *testing.T) {
+	content := pageContent(t, onePage("BT /F1 10 Tf 20 50 Td (HJI) Tj ET", "/F1 4 0 R", helvetica))
+	if got := joinText(content.Glyphs); got != "HJI" {
+		t.Fatalf("text = %q; want %q", got, "HJI")
+	}
+	// H is 600 units wide, I 400, and J, whose width is 0, is drawn with
+	// no advance. The default ascent is 750 units and descent -250.
+	want := [][4][2]float64{
+		{{20, 47.5}, {26, 47.5}, {26, 57.5}, {20, 57.5}},
+		{{26, 47.5}, {26, 47.5}, {26, 57.5}, {26, 57.5}},
+		{{26, 47.5}, {30, 47.5}, {30, 57.5}, {26, 57.5}},
+	}
+	for i, g := range content.Glyphs {
+		if !sameQuad(g.Quad, want[i]) {
+			t.Errorf("glyph %q has quad %v; want %v", g.Text, g.Quad, want[i])
+		}
+		if g.Invisible {
+			t.Errorf("glyph %q is invisible", g.Text)
+		}
+	}
+}
+
+func sameQuad(a, b [4][2]float64) bool {
+	for i := range a {
+		for j := range a[i] {
+			if math.Abs(a[i][j]-b[i][j]) > 1e-9 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestPageContentOperators(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		text    string
+		// x is the left of the last glyph.
+		x float64
+	}{
+		{"TJ adjustment", "BT /F1 10 Tf [(H) -1000 (I)] TJ ET", "HI", 16},
+		{"character spacing", "BT /F1 10 Tf 2 Tc (HI) Tj ET", "HI", 8},
+		{"horizontal scaling", "BT /F1 10 Tf 50 Tz (HI) Tj ET", "HI", 3},
+		{"next line", "BT /F1 10 Tf 12 TL (H) Tj T* (I) Tj ET", "HI", 0},
+		{"text matrix", "BT /F1 10 Tf 2 0 0 2 30 0 Tm (I) Tj ET", "I", 30},
+		{"current transformation matrix", "q 1 0 0 1 40 0 cm BT /F1 10 Tf (I) Tj ET Q", "I", 40},
+		{"restored graphics state", "q 1 0 0 1 40 0 cm Q BT /F1 10 Tf (I) Tj ET", "I", 0},
+	}
+	for _, tt := range tests {
+		content := pageContent(t, onePage(tt.content, "/F1 4 0 R", helvetica))
+		if got := joinText(content.Glyphs); got != tt.text {
+			t.Errorf("%v: text = %q; want %q", tt.name, got, tt.text)
+			continue
+		}
+		if x := content.Glyphs[len(content.Glyphs)-1].Quad[0][0]; math.Abs(x-tt.x) > 1e-9 {
+			t.Errorf("%v: last glyph starts at %v; want %v", tt.name, x, tt.x)
+		}
+	}
+}
+
+func TestPageContentInvisible(t *testing.T) {
+	content := pageContent(t, onePage("BT /F1 10 Tf (H) Tj 3 Tr (I) Tj 0 Tr (H) Tj ET", "/F1 4 0 R", helvetica))
+	var invisible []bool
+	for _, g := range content.Glyphs {
+		invisible = append(invisible, g.Invisible)
+	}
+	if fmt.Sprint(invisible) != "[false true false]" {
+		t.Errorf("invisible = %v; want [false true false]", invisible)
+	}
+}
+
+func TestPageContentEncoding(t *testing.T) {
+	font := "<< /Type /Font /Subtype /Type1 /BaseFont /Times-Roman /Encoding << /Type /Encoding /BaseEncoding /WinAnsiEncoding /Differences [65 /eacute /germandbls] >> >>"
+	content := pageContent(t, onePage(`BT /F1 10 Tf (AB\344C) Tj ET`, "/F1 4 0 R", font))
+	if got := joinText(content.Glyphs); got != "éßäC" {
+		t.Errorf("text = %q; want %q", got, "éßäC")
+	}
+}
+
+func TestPageContentToUnicode(t *testing.T) {
+	cmap := "/CIDInit /ProcSet findresource begin 12 dict begin begincmap\n" +
+		"2 beginbfchar <0001> <0048> <0002> <00660069> endbfchar\n" +
+		"1 beginbfrange <0010> <0012> <0061> endbfrange\n" +
+		"endcmap CMapName currentdict /CMap defineresource pop end end"
+	objects := []string{
+		"<< /Type /Font /Subtype /Type0 /BaseFont /Test /Encoding /Identity-H /DescendantFonts [5 0 R] /ToUnicode 6 0 R >>",
+		"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /Test /DW 500 /W [1 [700 800]] >>",
+		stream("", cmap),
+	}
+	content := pageContent(t, onePage("BT /F1 10 Tf <000100020010001100120003> Tj ET", "/F1 4 0 R", objects...))
+	if got := joinText(content.Glyphs); got != "Hfiabc" {
+		t.Errorf("text = %q; want %q", got, "Hfiabc")
+	}
+	// 7 + 8 + 3 * 5 points, then the glyph without text.
+	if x := content.Glyphs[len(content.Glyphs)-1].Quad[0][0]; math.Abs(x-30) > 1e-9 {
+		t.Errorf("last glyph starts at %v; want 30", x)
+	}
+}
+
+func TestPageContentCompressed(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write([]byte("BT /F1 10 Tf (HI) Tj ET"))
+	zw.Close()
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 100] /Resources << /Font << /F1 4 0 R >> >> /Contents [5 0 R] >>",
+		helvetica,
+		stream("/Filter /FlateDecode", compressed.String()),
+	}
+	content := pageContent(t, buildPDF(objects, "/Root 1 0 R"))
+	if got := joinText(content.Glyphs); got != "HI" {
+		t.Errorf("text = %q; want %q", got, "HI")
+	}
+}
+
+func TestPageContentForm(t *testing.T) {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 100] /Resources << /XObject << /X1 4 0 R /Im1 6 0 R >> >> /Contents 7 0 R >>",
+		stream("/Type /XObject /Subtype /Form /BBox [0 0 100 100] /Matrix [1 0 0 1 10 0] /Resources << /Font << /F1 5 0 R >> >>", "BT /F1 10 Tf (I) Tj ET"),
+		helvetica,
+		stream("/Type /XObject /Subtype /Image /Width 1 /Height 1 /ColorSpace /DeviceGray /BitsPerComponent 8", "\x80"),
+		stream("", "q 1 0 0 1 5 0 cm /X1 Do Q q 50 0 0 20 0 0 cm /Im1 Do Q"),
+	}
+	content := pageContent(t, buildPDF(objects, "/Root 1 0 R"))
+	if got := joinText(content.Glyphs); got != "I" {
+		t.Fatalf("text = %q; want %q", got, "I")
+	}
+	if x := content.Glyphs[0].Quad[0][0]; x != 15 {
+		t.Errorf("glyph of the form starts at %v; want 15", x)
+	}
+	if content.ImageArea != 1000 {
+		t.Errorf("image area = %v; want 1000", content.ImageArea)
+	}
+	if len(content.Images) != 1 || content.Images[0].Ref != (Ref{Num: 6}) {
+		t.Errorf("images = %+v; want the image 6 0 R", content.Images)
+	}
+}
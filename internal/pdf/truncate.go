@@ -0,0 +1,90 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pdf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Truncate returns an incremental update which cuts the document down to its
+// first n pages. See Select.
+func (r *Reader) Truncate(n int) (*Update, error) {
+	all, err := r.Pages()
+	if err != nil {
+		return nil, err
+	}
+	if n > len(all) {
+		n = len(all)
+	}
+	pages := make([]int, n)
+	for i := range pages {
+		pages[i] = i + 1
+	}
+	return r.Select(pages)
+}
+
+// Select returns an incremental update which leaves only the given pages
+// (numbered from 1) in the document, in the given order. The page tree is
+// replaced by a single node whose kids are those pages, and the attributes
+// they inherited from intermediate nodes are copied onto them. The pages
+// which are left out remain in the file, unreachable.
+func (r *Reader) Select(pageNumbers []int) (*Update, error) {
+	cat, err := r.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	root, ok := cat["Pages"].(Ref)
+	if !ok {
+		return nil, errors.New("pdf: page tree root is not an indirect object")
+	}
+	pages, err := r.Pages()
+	if err != nil {
+		return nil, err
+	}
+	u := r.NewUpdate()
+	kids := make(Array, len(pageNumbers))
+	for i, num := range pageNumbers {
+		if num < 1 || num > len(pages) {
+			return nil, fmt.Errorf("pdf: page %v does not exist; the document has %v pages", num, len(pages))
+		}
+		p := pages[num-1]
+		if p.Ref.Num == 0 {
+			return nil, errors.New("pdf: page is not an indirect object")
+		}
+		d := make(Dict, len(p.Dict)+len(p.inherited))
+		for k, v := range p.inherited {
+			d[k] = v
+		}
+		for k, v := range p.Dict {
+			d[k] = v
+		}
+		d["Parent"] = root
+		u.Set(p.Ref, d)
+		kids[i] = p.Ref
+	}
+	u.Set(root, Dict{
+		"Type":  Name("Pages"),
+		"Kids":  kids,
+		"Count": int64(len(pageNumbers)),
+	})
+	return u, nil
+}
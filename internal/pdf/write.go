@@ -0,0 +1,333 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Update is an incremental update: a set of new and replaced objects which
+// is appended to the original file, leaving the original bytes untouched.
+type Update struct {
+	r       *Reader
+	objects map[Ref]Object
+	size    int
+}
+
+// NewUpdate starts an incremental update of the file read by r.
+func (r *Reader) NewUpdate() *Update {
+	size, _ := r.trailer["Size"].(int64)
+	for num := range r.xref {
+		if num >= int(size) {
+			size = int64(num) + 1
+		}
+	}
+	return &Update{r: r, objects: make(map[Ref]Object), size: int(size)}
+}
+
+// Add adds a new object and returns a reference to it.
+func (u *Update) Add(o Object) Ref {
+	ref := Ref{Num: u.size}
+	u.size++
+	u.objects[ref] = o
+	return ref
+}
+
+// Set replaces the object referred to by ref.
+func (u *Update) Set(ref Ref, o Object) {
+	u.objects[ref] = o
+}
+
+// WriteTo writes the original file followed by the update.
+func (u *Update) WriteTo(w io.Writer) (int64, error) {
+	if u.r.Encrypted() {
+		return 0, errors.New("pdf: cannot update an encrypted file")
+	}
+	var buf bytes.Buffer
+	buf.Write(u.r.data)
+	if n := len(u.r.data); n > 0 && u.r.data[n-1] != '\n' && u.r.data[n-1] != '\r' {
+		buf.WriteByte('\n')
+	}
+	refs := make([]Ref, 0, len(u.objects))
+	for ref := range u.objects {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Num < refs[j].Num })
+	offsets := make(map[Ref]int, len(refs))
+	for _, ref := range refs {
+		offsets[ref] = buf.Len()
+		fmt.Fprintf(&buf, "%d %d obj\n", ref.Num, ref.Gen)
+		writeObject(&buf, u.objects[ref])
+		buf.WriteString("\nendobj\n")
+	}
+
+	trailer := Dict{"Prev": u.r.startxref}
+	for _, k := range []Name{"Root", "Info", "ID"} {
+		if v, ok := u.r.trailer[k]; ok {
+			trailer[k] = v
+		}
+	}
+	xrefOffset := buf.Len()
+	if u.r.xrefStream {
+		// A file using cross-reference streams must be updated with one.
+		self := Ref{Num: u.size}
+		refs = append(refs, self)
+		offsets[self] = xrefOffset
+		trailer["Type"] = Name("XRef")
+		trailer["Size"] = int64(u.size + 1)
+		trailer["W"] = Array{int64(1), int64(4), int64(2)}
+		var index Array
+		var data []byte
+		for _, sub := range subsections(refs) {
+			index = append(index, int64(sub[0].Num), int64(len(sub)))
+			for _, ref := range sub {
+				off := offsets[ref]
+				data = append(data, 1, byte(off>>24), byte(off>>16), byte(off>>8), byte(off), byte(ref.Gen>>8), byte(ref.Gen))
+			}
+		}
+		trailer["Index"] = index
+		fmt.Fprintf(&buf, "%d 0 obj\n", self.Num)
+		writeObject(&buf, Stream{Dict: trailer, Data: data})
+		buf.WriteString("\nendobj\n")
+	} else {
+		trailer["Size"] = int64(u.size)
+		buf.WriteString("xref\n")
+		for _, sub := range subsections(refs) {
+			fmt.Fprintf(&buf, "%d %d\n", sub[0].Num, len(sub))
+			for _, ref := range sub {
+				fmt.Fprintf(&buf, "%010d %05d n\r\n", offsets[ref], ref.Gen)
+			}
+		}
+		buf.WriteString("trailer\n")
+		writeObject(&buf, trailer)
+		buf.WriteByte('\n')
+	}
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xrefOffset)
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// subsections splits sorted refs into runs of consecutive object numbers.
+func subsections(refs []Ref) [][]Ref {
+	var subs [][]Ref
+	for i, ref := range refs {
+		if i == 0 || ref.Num != refs[i-1].Num+1 {
+			subs = append(subs, nil)
+		}
+		subs[len(subs)-1] = append(subs[len(subs)-1], ref)
+	}
+	return subs
+}
+
+func writeObject(buf *bytes.Buffer, o Object) {
+	switch v := o.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case int:
+		buf.WriteString(strconv.Itoa(v))
+	case int64:
+		buf.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		buf.WriteString(strconv.FormatFloat(v, 'f', -1, 64))
+	case Name:
+		buf.WriteByte('/')
+		for i := 0; i < len(v); i++ {
+			c := v[i]
+			if c <= ' ' || c >= 0x7f || c == '#' || isDelim(c) {
+				fmt.Fprintf(buf, "#%02X", c)
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	case String:
+		buf.WriteByte('(')
+		for i := 0; i < len(v); i++ {
+			switch c := v[i]; c {
+			case '(', ')', '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\n':
+				buf.WriteString(`\n`)
+			default:
+				buf.WriteByte(c)
+			}
+		}
+		buf.WriteByte(')')
+	case Array:
+		buf.WriteByte('[')
+		for i, e := range v {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writeObject(buf, e)
+		}
+		buf.WriteByte(']')
+	case Dict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		buf.WriteString("<<")
+		for _, k := range keys {
+			writeObject(buf, Name(k))
+			buf.WriteByte(' ')
+			writeObject(buf, v[Name(k)])
+		}
+		buf.WriteString(">>")
+	case Stream:
+		d := make(Dict, len(v.Dict)+1)
+		for k, e := range v.Dict {
+			d[k] = e
+		}
+		d["Length"] = int64(len(v.Data))
+		writeObject(buf, d)
+		buf.WriteString("\nstream\n")
+		buf.Write(v.Data)
+		buf.WriteString("\nendstream")
+	case Ref:
+		buf.WriteString(v.String())
+	case Keyword:
+		buf.WriteString(string(v))
+	default:
+		panic(fmt.Sprintf("pdf: cannot write object of type %T", o))
+	}
+}
+
+// Rewrite writes the file anew, as a single revision with a classic
+// cross-reference table, leaving out objects which are not reachable from
+// the trailer, such as object streams, cross-reference streams and the
+// encryption dictionary. Rewriting a file which has been decrypted with
+// Decrypt writes it unencrypted.
+func (r *Reader) Rewrite(w io.Writer) (int64, error) {
+	return r.rewrite(w, nil)
+}
+
+// Rewrite writes the file with the update applied as a single revision,
+// like Reader.Rewrite. Unlike WriteTo, it leaves no trace of the objects
+// which the update replaces or no longer refers to.
+func (u *Update) Rewrite(w io.Writer) (int64, error) {
+	return u.r.rewrite(w, u.objects)
+}
+
+// rewrite writes the objects reachable from the trailer, with those in
+// replaced written in place of the originals.
+func (r *Reader) rewrite(w io.Writer, replaced map[Ref]Object) (int64, error) {
+	if r.Encrypted() {
+		return 0, errors.New("pdf: cannot rewrite an encrypted file")
+	}
+	objects := make(map[int]Object)
+	refs := make(map[int]Ref)
+	var visit func(o Object) error
+	visit = func(o Object) error {
+		switch o := o.(type) {
+		case Ref:
+			if _, ok := refs[o.Num]; ok {
+				return nil
+			}
+			refs[o.Num] = o
+			obj, ok := replaced[o]
+			if !ok {
+				var err error
+				if obj, err = r.Resolve(o); err != nil {
+					return err
+				}
+			}
+			objects[o.Num] = obj
+			return visit(obj)
+		case Array:
+			for _, v := range o {
+				if err := visit(v); err != nil {
+					return err
+				}
+			}
+		case Dict:
+			for _, v := range o {
+				if err := visit(v); err != nil {
+					return err
+				}
+			}
+		case Stream:
+			return visit(o.Dict)
+		}
+		return nil
+	}
+	for _, k := range []Name{"Root", "Info"} {
+		if err := visit(r.trailer[k]); err != nil {
+			return 0, err
+		}
+	}
+	nums := make([]int, 0, len(refs))
+	size := 0
+	for num := range refs {
+		if objects[num] == nil {
+			// A reference to a missing object is a reference to null.
+			continue
+		}
+		nums = append(nums, num)
+		if num >= size {
+			size = num + 1
+		}
+	}
+	sort.Ints(nums)
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	var written []Ref
+	offsets := make(map[Ref]int)
+	for _, num := range nums {
+		ref := refs[num]
+		written = append(written, ref)
+		offsets[ref] = buf.Len()
+		fmt.Fprintf(&buf, "%d %d obj\n", ref.Num, ref.Gen)
+		writeObject(&buf, objects[num])
+		buf.WriteString("\nendobj\n")
+	}
+
+	trailer := Dict{"Size": int64(size)}
+	for _, k := range []Name{"Root", "Info", "ID"} {
+		if v, ok := r.trailer[k]; ok {
+			trailer[k] = v
+		}
+	}
+	xrefOffset := buf.Len()
+	buf.WriteString("xref\n0 1\n0000000000 65535 f\r\n")
+	for _, sub := range subsections(written) {
+		fmt.Fprintf(&buf, "%d %d\n", sub[0].Num, len(sub))
+		for _, ref := range sub {
+			fmt.Fprintf(&buf, "%010d %05d n\r\n", offsets[ref], ref.Gen)
+		}
+	}
+	buf.WriteString("trailer\n")
+	writeObject(&buf, trailer)
+	fmt.Fprintf(&buf, "\nstartxref\n%d\n%%%%EOF\n", xrefOffset)
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
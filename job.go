@@ -0,0 +1,144 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"fmt"
+	"time"
+)
+
+// Job is a job the Sight API started for some of the files passed to
+// RecognizeFiles. It is passed to Config.OnJobStarted, and can be saved (it
+// marshals to JSON) so that ResumeJob can receive the rest of its results
+// after the process which started it has exited.
+type Job struct {
+	// URL is polled for the results of the job.
+	URL string
+	// ID is the X-Job-Id header of the response which started the job, or
+	// empty if the Sight API did not send one; see RecognizedPage.JobID.
+	ID string `json:",omitempty"`
+	// SubmittedAt is when the Client started to send the request which
+	// started the job, or nil if it is not known; see
+	// RecognizedPage.SubmittedAt.
+	SubmittedAt *time.Time `json:",omitempty"`
+	// FileIndices are the indices, among the files passed to
+	// RecognizeFiles, of the files in the job. Files which were not
+	// submitted are not in the job.
+	FileIndices []int
+	// Selections are the pages selected from each file in the job (see
+	// File.Pages), or nil for files which were submitted whole.
+	Selections [][]int
+	// Duplicates maps the index of a file in the job to the indices of
+	// the files with the same contents, which were not submitted but are
+	// sent copies of its pages.
+	Duplicates map[int][]int `json:",omitempty"`
+
+	// key is the key of the KeyPool of the Client with which the job was
+	// started, and so is polled. It is not marshaled, to keep it out of
+	// job stores.
+	key string
+}
+
+// ResumeJob polls for the results of job which have not been received yet.
+// received are the pages of the job which were received earlier, as they
+// were sent by RecognizeFiles or an earlier call to ResumeJob; they are not
+// sent again. The pages sent are numbered as RecognizeFiles numbers them.
+//
+// If every page of the job was received, the returned channel is closed
+// without polling. Polling has no deadline.
+func (c *Client) ResumeJob(job Job, received ...RecognizedPage) (<-chan RecognizedPage, error) {
+	if job.URL == "" {
+		return nil, fmt.Errorf("the job has no URL")
+	}
+	if len(job.Selections) != len(job.FileIndices) {
+		return nil, fmt.Errorf("the job has %v page selections for %v files", len(job.Selections), len(job.FileIndices))
+	}
+	fileIndex2HaveSeenPage := make(map[int][]bool)
+	for _, p := range received {
+		fileIndex, pageNumber, ok := job.apiPage(p)
+		if !ok {
+			continue
+		}
+		if len(fileIndex2HaveSeenPage[fileIndex]) == 0 {
+			fileIndex2HaveSeenPage[fileIndex] = make([]bool, p.NumberOfPagesInFile)
+		}
+		if pageNumber <= len(fileIndex2HaveSeenPage[fileIndex]) {
+			fileIndex2HaveSeenPage[fileIndex][pageNumber-1] = true
+		}
+	}
+	pagesChan := make(chan RecognizedPage, 16)
+	if haveSeenEverything(fileIndex2HaveSeenPage, len(job.FileIndices)) {
+		close(pagesChan)
+		return pagesChan, nil
+	}
+	go c.pollJob(job, fileIndex2HaveSeenPage, newRequestID(), pollLimits{}, nil, pagesChan)
+	if len(job.Duplicates) == 0 {
+		return pagesChan, nil
+	}
+	return fanOut(pagesChan, func(p RecognizedPage) []int {
+		return append([]int{p.FileIndex}, job.Duplicates[p.FileIndex]...)
+	}), nil
+}
+
+// apiPage returns the FileIndex and PageNumber which the Sight API reported
+// for p, a page of the job as numbered for the caller of RecognizeFiles.
+// The API numbers files by their position in the job, and pages by their
+// position among the selected pages. ok is false if p is not in the job,
+// or was sent because polling for it was given up on.
+func (job Job) apiPage(p RecognizedPage) (fileIndex, pageNumber int, ok bool) {
+	if p.JobFailed {
+		return 0, 0, false
+	}
+	fileIndex = -1
+	for j, i := range job.FileIndices {
+		if i == p.FileIndex {
+			fileIndex = j
+			break
+		}
+	}
+	if fileIndex < 0 {
+		return 0, 0, false
+	}
+	pageNumber = p.PageNumber
+	if fileIndex < len(job.Selections) && len(job.Selections[fileIndex]) != 0 {
+		pageNumber = 0
+		for k, selected := range job.Selections[fileIndex] {
+			if selected == p.PageNumber {
+				pageNumber = k + 1
+			}
+		}
+	}
+	if pageNumber <= 0 || pageNumber > p.NumberOfPagesInFile {
+		return 0, 0, false
+	}
+	return fileIndex, pageNumber, true
+}
+
+// received sets the timings of p, a page of the job which has just been
+// received.
+func (job Job) received(p *RecognizedPage) {
+	now := time.Now()
+	p.FirstSeenAt = &now
+	if job.SubmittedAt != nil {
+		p.SubmittedAt = job.SubmittedAt
+		p.ProcessingDuration = now.Sub(*job.SubmittedAt)
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// JobStore stores the jobs a Client has started and the pages it has
+// received from them, so that a process which crashes with jobs in flight
+// can reattach to them with RecoverJobs. Jobs are identified by their URL.
+type JobStore interface {
+	// SaveJob stores a job which was started.
+	SaveJob(job Job) error
+	// SavePage stores a page received from job, as numbered for the
+	// caller of RecognizeFiles.
+	SavePage(job Job, page RecognizedPage) error
+	// DeleteJob removes a job whose pages have all been received.
+	DeleteJob(job Job) error
+	// Jobs returns the stored jobs with the pages received from each.
+	Jobs() ([]StoredJob, error)
+}
+
+// StoredJob is a job in a JobStore and the pages received from it.
+type StoredJob struct {
+	Job      Job
+	Received []RecognizedPage
+}
+
+// WithJobStore makes the Client store each job it starts in store, and each
+// page as it is sent on the channel returned by RecognizeFiles. A job is
+// deleted from store once all of its pages have been sent.
+func WithJobStore(store JobStore) Option {
+	return func(c *Client) {
+		c.jobStore = store
+	}
+}
+
+// RecoveredJob is a job reattached to by RecoverJobs.
+type RecoveredJob struct {
+	Job Job
+	// Received are the pages received from the job before, which are not
+	// sent on Pages. Pages which were sent on the channel returned by
+	// RecognizeFiles shortly before the crash are among them, whether or
+	// not the process which crashed handled them.
+	Received []RecognizedPage
+	// Pages receives the rest of the job's pages, as from ResumeJob.
+	Pages <-chan RecognizedPage
+}
+
+// RecoverJobs reattaches to the unfinished jobs in store, such as those a
+// crashed process started with WithJobStore, and polls for the pages of
+// each which were not received yet. Progress continues to be stored in
+// store. Jobs which cannot be resumed are logged and skipped.
+func (c *Client) RecoverJobs(store JobStore) ([]RecoveredJob, error) {
+	stored, err := store.Jobs()
+	if err != nil {
+		return nil, err
+	}
+	var recovered []RecoveredJob
+	for _, sj := range stored {
+		pages, err := c.ResumeJob(sj.Job, sj.Received...)
+		if err != nil {
+			c.logger.Warn("not recovering a stored job", "url", sj.Job.URL, "error", err)
+			continue
+		}
+		c.logger.Info("recovering a stored job", "url", sj.Job.URL, "received", len(sj.Received))
+		recovered = append(recovered, RecoveredJob{
+			Job:      sj.Job,
+			Received: sj.Received,
+			Pages:    c.storePages(store, sj.Job, sj.Received, pages),
+		})
+	}
+	return recovered, nil
+}
+
+// storePages saves each page of job from in to store as it is sent on the
+// returned channel, and deletes job from store once all of its pages have
+// been received (including those in received). If in is closed before
+// then, the job is left in store to be recovered.
+func (c *Client) storePages(store JobStore, job Job, received []RecognizedPage, in <-chan RecognizedPage) <-chan RecognizedPage {
+	seen := make(map[int][]bool)
+	see := func(p RecognizedPage) bool {
+		fileIndex, pageNumber, ok := job.apiPage(p)
+		if !ok {
+			return false
+		}
+		if len(seen[fileIndex]) == 0 {
+			seen[fileIndex] = make([]bool, p.NumberOfPagesInFile)
+		}
+		if pageNumber <= len(seen[fileIndex]) {
+			seen[fileIndex][pageNumber-1] = true
+		}
+		return true
+	}
+	for _, p := range received {
+		see(p)
+	}
+	out := make(chan RecognizedPage, 16)
+	go func() {
+		for p := range in {
+			out <- p
+			if !see(p) {
+				continue
+			}
+			if err := store.SavePage(job, p); err != nil {
+				c.logger.Warn("failed to store a page of a job", "url", job.URL, "error", err)
+			}
+		}
+		close(out)
+		if haveSeenEverything(seen, len(job.FileIndices)) {
+			if err := store.DeleteJob(job); err != nil {
+				c.logger.Warn("failed to delete a finished job from the job store", "url", job.URL, "error", err)
+			}
+		}
+	}()
+	return out
+}
+
+// DirJobStore is a JobStore which stores each job in a file in the
+// directory, named after a digest of its URL. The file holds one JSON
+// object per line: the job, followed by the pages received from it.
+type DirJobStore string
+
+func (d DirJobStore) path(job Job) string {
+	digest := sha256.Sum256([]byte(job.URL))
+	return filepath.Join(string(d), hex.EncodeToString(digest[:])+".job")
+}
+
+func (d DirJobStore) SaveJob(job Job) error {
+	if err := os.MkdirAll(string(d), 0755); err != nil {
+		return err
+	}
+	return d.append(job, job, os.O_CREATE|os.O_TRUNC)
+}
+
+func (d DirJobStore) SavePage(job Job, page RecognizedPage) error {
+	return d.append(job, page, 0)
+}
+
+// append writes v as a line of the file of job, opened with flag in
+// addition to os.O_WRONLY and os.O_APPEND. The line is written at once, so
+// that a crash leaves at worst a truncated last line.
+func (d DirJobStore) append(job Job, v interface{}, flag int) error {
+	buf, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(d.path(job), os.O_WRONLY|os.O_APPEND|flag, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(buf, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (d DirJobStore) DeleteJob(job Job) error {
+	err := os.Remove(d.path(job))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// Jobs returns the stored jobs, sorted by URL. A directory which does not
+// exist holds no jobs.
+func (d DirJobStore) Jobs() ([]StoredJob, error) {
+	entries, err := ioutil.ReadDir(string(d))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var jobs []StoredJob
+	for _, fi := range entries {
+		if !strings.HasSuffix(fi.Name(), ".job") {
+			continue
+		}
+		sj, err := readStoredJob(filepath.Join(string(d), fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		// The process crashed before the job was stored, so it was
+		// never told of the job either.
+		if sj.Job.URL == "" {
+			continue
+		}
+		jobs = append(jobs, sj)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Job.URL < jobs[j].Job.URL })
+	return jobs, nil
+}
+
+// readStoredJob reads a file written by DirJobStore. A last line which is
+// not valid JSON was cut short by a crash, and is ignored; if it is the
+// first, the returned job has no URL.
+func readStoredJob(path string) (StoredJob, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return StoredJob{}, err
+	}
+	defer f.Close()
+	var sj StoredJob
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 64<<20)
+	var lineErr error
+	for lineNumber := 1; sc.Scan(); lineNumber++ {
+		if lineErr != nil {
+			return StoredJob{}, lineErr
+		}
+		var err error
+		if lineNumber == 1 {
+			err = json.Unmarshal(sc.Bytes(), &sj.Job)
+		} else {
+			var p RecognizedPage
+			if err = json.Unmarshal(sc.Bytes(), &p); err == nil {
+				sj.Received = append(sj.Received, p)
+			}
+		}
+		if err != nil {
+			lineErr = fmt.Errorf("%v: line %v: %v", path, lineNumber, err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return StoredJob{}, err
+	}
+	return sj, nil
+}
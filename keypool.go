@@ -0,0 +1,195 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrNoAPIKeys is returned for requests made once the Sight API has
+// rejected every API key of a KeyPool.
+var ErrNoAPIKeys = errors.New("the Sight API rejected every API key of the pool")
+
+// KeySelection is how a KeyPool chooses the API key for each request.
+type KeySelection int
+
+const (
+	// KeyRoundRobin uses the keys in turn.
+	KeyRoundRobin KeySelection = iota
+	// KeyMostRemaining uses the key with the most requests remaining
+	// within its rate limit, as last reported by the X-RateLimit-Remaining
+	// header of a response to a request made with it. Keys for which no
+	// remainder is known, such as those not used yet or whose rate limit
+	// has since been reset, are used first, in turn.
+	KeyMostRemaining
+)
+
+// A KeyPool spreads the requests of a Client across several API keys, e.g.,
+// of accounts among which a workload is sharded, and fails over from one
+// which is rate limited or rejected. A key whose request is rate limited is
+// not used again until its Retry-After delay has passed, unless every key
+// is rate limited. A key which the Sight API rejects with 401 Unauthorized
+// is not used again. A KeyPool may be shared by several Clients (see
+// WithKeyPool), and is safe for concurrent use.
+type KeyPool struct {
+	selection KeySelection
+
+	mu   sync.Mutex
+	keys []pooledKey
+	// next is the position at which the next search for a key starts,
+	// so that keys are used in turn.
+	next int
+}
+
+type pooledKey struct {
+	key string
+	// remaining is the number of requests remaining until reset, if
+	// reset is not zero.
+	remaining int
+	reset     time.Time
+	// coolUntil is when the key stops being rate limited.
+	coolUntil time.Time
+	rejected  bool
+}
+
+// NewKeyPool returns a KeyPool of keys which chooses among them as selection
+// says. A key given more than once is only used as one.
+func NewKeyPool(selection KeySelection, keys ...string) *KeyPool {
+	p := &KeyPool{selection: selection}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			p.keys = append(p.keys, pooledKey{key: key})
+		}
+	}
+	return p
+}
+
+// WithKeyPool makes the Client send each request with a key of pool, instead
+// of the API key passed to NewClient or those of WithKeyProvider. The pages
+// of a job are polled with the key which started it, except when the job is
+// resumed with ResumeJob, which uses the keys of the pool.
+func WithKeyPool(pool *KeyPool) Option {
+	return func(c *Client) {
+		c.keyPool = pool
+	}
+}
+
+// pick returns the key with which to send a request. If every key not
+// rejected is rate limited, it returns the one which will be usable soonest.
+func (p *KeyPool) pick() (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	best, soonest := -1, -1
+	for n := 0; n < len(p.keys); n++ {
+		i := (p.next + n) % len(p.keys)
+		k := &p.keys[i]
+		if k.rejected {
+			continue
+		}
+		if now.Before(k.coolUntil) {
+			if soonest < 0 || k.coolUntil.Before(p.keys[soonest].coolUntil) {
+				soonest = i
+			}
+			continue
+		}
+		if best < 0 || p.selection == KeyMostRemaining && p.keys[best].remainingAt(now) < k.remainingAt(now) {
+			best = i
+		}
+		if p.selection == KeyRoundRobin {
+			break
+		}
+	}
+	if best < 0 {
+		best = soonest
+	}
+	if best < 0 {
+		return "", ErrNoAPIKeys
+	}
+	p.next = (best + 1) % len(p.keys)
+	return p.keys[best].key, nil
+}
+
+// remainingAt returns the number of requests k has remaining at now, or the
+// largest int if it is not known, so that keys whose remainder is not known
+// are preferred.
+func (k pooledKey) remainingAt(now time.Time) int {
+	if k.reset.IsZero() || now.After(k.reset) {
+		return int(^uint(0) >> 1)
+	}
+	return k.remaining
+}
+
+// usable reports whether a key is neither rejected nor rate limited.
+func (p *KeyPool) usable() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for _, k := range p.keys {
+		if !k.rejected && !now.Before(k.coolUntil) {
+			return true
+		}
+	}
+	return false
+}
+
+// observe records what resp says of key: its rate limit, whether it was
+// rate limited and whether it was rejected.
+func (p *KeyPool) observe(key string, resp *http.Response, logger Logger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range p.keys {
+		k := &p.keys[i]
+		if k.key != key {
+			continue
+		}
+		if rl, ok := rateLimitStatus(resp.Header); ok && !rl.Reset.IsZero() {
+			k.remaining, k.reset = rl.Remaining, rl.Reset
+		}
+		switch resp.StatusCode {
+		case 401:
+			if !k.rejected {
+				logger.Warn("API key of the pool rejected; no longer using it", "key", i)
+			}
+			k.rejected = true
+		case 429:
+			k.coolUntil = time.Now().Add(retryAfter(resp, 0))
+			logger.Debug("API key of the pool rate limited", "key", i, "until", k.coolUntil)
+		}
+		return
+	}
+}
+
+// apiKeyContextKey is the context key of the API key with which a request
+// must be sent; see withAPIKey.
+type apiKeyContextKey struct{}
+
+// withAPIKey returns a copy of ctx which makes the request it is the context
+// of be sent with key, rather than a key chosen by the KeyPool of the Client.
+func withAPIKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
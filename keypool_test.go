@@ -0,0 +1,162 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/sighttest"
+)
+
+// keyTransport answers requests as the Sight API would for several API
+// keys: "bad" is rejected, "busy" is rate limited, and the others are sent
+// on to a sighttest.Server with its key.
+type keyTransport struct {
+	// remaining is the X-RateLimit-Remaining reported for each key.
+	remaining map[string]int
+
+	mu sync.Mutex
+	// keys are the keys of the requests, in order, as "POST key" or
+	// "GET key".
+	keys []string
+}
+
+func (kt *keyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	key := strings.TrimPrefix(r.Header.Get("Authorization"), "Basic ")
+	kt.mu.Lock()
+	kt.keys = append(kt.keys, r.Method+" "+key)
+	kt.mu.Unlock()
+	respond := func(status int, header http.Header) (*http.Response, error) {
+		return &http.Response{StatusCode: status, Header: header, Body: ioutil.NopCloser(strings.NewReader("")), Request: r}, nil
+	}
+	switch key {
+	case "bad":
+		return respond(http.StatusUnauthorized, http.Header{})
+	case "busy":
+		return respond(http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}})
+	}
+	out := r.Clone(r.Context())
+	out.Header.Set("Authorization", "Basic "+sighttest.APIKey)
+	resp, err := http.DefaultTransport.RoundTrip(out)
+	if err == nil && kt.remaining != nil {
+		resp.Header.Set("X-RateLimit-Limit", "100")
+		resp.Header.Set("X-RateLimit-Remaining", strconv.Itoa(kt.remaining[key]))
+		resp.Header.Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	}
+	return resp, err
+}
+
+func (kt *keyTransport) requests() []string {
+	kt.mu.Lock()
+	defer kt.mu.Unlock()
+	keys := kt.keys
+	kt.keys = nil
+	return keys
+}
+
+// submitted returns the keys of the POST requests among keys.
+func submitted(keys []string) []string {
+	var posts []string
+	for _, k := range keys {
+		if strings.HasPrefix(k, "POST ") {
+			posts = append(posts, strings.TrimPrefix(k, "POST "))
+		}
+	}
+	return posts
+}
+
+func TestKeyPoolFailover(t *testing.T) {
+	srv := sighttest.NewServer()
+	defer srv.Close()
+	kt := &keyTransport{}
+	pool := sight.NewKeyPool(sight.KeyRoundRobin, "bad", "busy", "good1", "good2")
+	c := srv.Client(sight.WithTransport(kt), sight.WithKeyPool(pool))
+
+	// The first request fails over from the rejected and the rate limited
+	// key; the others use the good keys in turn, as neither of the others
+	// is used again.
+	want := [][]string{{"bad", "busy", "good1"}, {"good2"}, {"good1"}}
+	for _, keys := range want {
+		recognize(t, c)
+		got := kt.requests()
+		if posts := submitted(got); !reflect.DeepEqual(posts, keys) {
+			t.Errorf("submitted with keys %v; want %v", posts, keys)
+		}
+		// Pages are polled for with the key which submitted the job.
+		for _, k := range got {
+			if strings.HasPrefix(k, "GET ") && k != "GET "+keys[len(keys)-1] {
+				t.Errorf("polled with %q; want the key %v", k, keys[len(keys)-1])
+			}
+		}
+	}
+}
+
+func TestKeyPoolAllRejected(t *testing.T) {
+	srv := sighttest.NewServer()
+	defer srv.Close()
+	kt := &keyTransport{}
+	// A key given twice is rejected once.
+	c := srv.Client(sight.WithTransport(kt), sight.WithKeyPool(sight.NewKeyPool(sight.KeyRoundRobin, "bad", "bad")))
+	_, err := c.RecognizeFiles(sight.Config{}, testImage(t))
+	var submitErr *sight.SubmitError
+	if !errors.As(err, &submitErr) || submitErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("got error %v; want a SubmitError with status 401", err)
+	}
+	if keys := kt.requests(); len(keys) != 1 {
+		t.Errorf("sent %v; want a single request", keys)
+	}
+	if _, err := c.RecognizeFiles(sight.Config{}, testImage(t)); err != sight.ErrNoAPIKeys {
+		t.Errorf("got error %v; want ErrNoAPIKeys", err)
+	}
+	if keys := kt.requests(); len(keys) != 0 {
+		t.Errorf("sent %v once every key was rejected", keys)
+	}
+}
+
+func TestKeyPoolMostRemaining(t *testing.T) {
+	srv := sighttest.NewServer()
+	defer srv.Close()
+	srv.Immediate = true
+	kt := &keyTransport{remaining: map[string]int{"a": 10, "b": 50, "c": 30}}
+	pool := sight.NewKeyPool(sight.KeyMostRemaining, "a", "b", "c")
+	c := srv.Client(sight.WithTransport(kt), sight.WithKeyPool(pool))
+
+	// Keys whose remainder is not known are used first, in turn; then the
+	// key with the most requests remaining.
+	var posts []string
+	for i := 0; i < 5; i++ {
+		recognize(t, c)
+		posts = append(posts, submitted(kt.requests())...)
+	}
+	want := []string{"a", "b", "c", "b", "b"}
+	if !reflect.DeepEqual(posts, want) {
+		t.Errorf("submitted with keys %v; want %v", posts, want)
+	}
+}
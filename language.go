@@ -0,0 +1,77 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+// scriptLanguages maps script hint codes to the BCP 47 tag of the language
+// text in the script is taken to be in. Scripts written in many languages
+// map to an undetermined language in the script, such as "und-Latn".
+var scriptLanguages = map[string]string{
+	"latin":    "und-Latn",
+	"cyrillic": "und-Cyrl",
+	"greek":    "el",
+	"arab":     "und-Arab",
+	"hebrew":   "he",
+	"armenian": "hy",
+	"hindi":    "und-Deva",
+	"bengali":  "bn",
+	"gujarati": "gu",
+	"guru":     "pa",
+	"kannada":  "kn",
+	"malayam":  "ml",
+	"tamil":    "ta",
+	"telugu":   "te",
+	"thai":     "th",
+	"lao":      "lo",
+	"khmer":    "km",
+	"japanese": "ja",
+	"korean":   "ko",
+	"hans":     "und-Hani",
+}
+
+// DetectLanguage guesses the language of text from the scripts of its
+// characters, returning a BCP 47 tag, or "" if text has no letters of a
+// supported script. Only the script is detected for scripts written in many
+// languages, e.g., "und-Latn" for English or French; text with kana is
+// Japanese even if most of its characters are Han.
+func DetectLanguage(text string) string {
+	counts := CountScripts(text)
+	if counts["japanese"] > 0 {
+		return "ja"
+	}
+	best, bestCount := "", 0
+	for code, n := range counts {
+		if n > bestCount || (n == bestCount && code < best) {
+			best, bestCount = code, n
+		}
+	}
+	return scriptLanguages[best]
+}
+
+// detectLanguages sets the Language of each text element of p which the
+// Sight API did not set, using DetectLanguage.
+func detectLanguages(p RecognizedPage) RecognizedPage {
+	for i, t := range p.RecognizedText {
+		if t.Language == "" {
+			p.RecognizedText[i].Language = DetectLanguage(t.Text)
+		}
+	}
+	return p
+}
@@ -0,0 +1,113 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package layout
+
+import (
+	"unicode"
+)
+
+// rightToLeft are the scripts written from right to left. Only Arabic and
+// Hebrew are among SupportedScripts, but the others cost nothing.
+var rightToLeft = []*unicode.RangeTable{unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko}
+
+// direction returns the number of letters of s in right-to-left scripts
+// less the number in left-to-right ones: positive if s is mostly
+// right-to-left, negative if it is mostly left-to-right, and zero if it is
+// neither, e.g., if it is a number.
+func direction(s string) int {
+	d := 0
+	for _, r := range s {
+		switch {
+		case unicode.In(r, rightToLeft...):
+			d++
+		case unicode.IsLetter(r):
+			d--
+		}
+	}
+	return d
+}
+
+// logicalOrder returns the order in which to read elements whose visual
+// order, from left to right, is visual, and whose directions are dirs: from
+// left to right in a left-to-right line and from right to left in a
+// right-to-left one, except that runs of elements in the other direction,
+// such as a Latin brand name in a line of Hebrew, are read in their own
+// direction. Elements in neither direction, such as numbers, go with their
+// neighbours if those agree, and with the line otherwise. This is the Unicode
+// bidirectional algorithm in miniature, with elements for characters.
+func logicalOrder(visual []int, dirs []int, rtl bool) []int {
+	n := len(visual)
+	resolved := make([]bool, n) // whether each element is right-to-left
+	for i := 0; i < n; i++ {
+		d := dirs[visual[i]]
+		if d != 0 {
+			resolved[i] = d > 0
+			continue
+		}
+		before, after := rtl, rtl
+		for k := i - 1; k >= 0; k-- {
+			if d := dirs[visual[k]]; d != 0 {
+				before = d > 0
+				break
+			}
+		}
+		for k := i + 1; k < n; k++ {
+			if d := dirs[visual[k]]; d != 0 {
+				after = d > 0
+				break
+			}
+		}
+		resolved[i] = rtl
+		if before == after {
+			resolved[i] = before
+		}
+	}
+	order := make([]int, n)
+	for i := range visual {
+		order[i] = i
+	}
+	if rtl {
+		reverse(order)
+	}
+	// Reverse each run of elements against the direction of the line.
+	for i := 0; i < n; {
+		j := i
+		for j < n && resolved[order[j]] != rtl {
+			j++
+		}
+		if j > i {
+			reverse(order[i:j])
+			i = j
+		} else {
+			i++
+		}
+	}
+	for i, o := range order {
+		order[i] = visual[o]
+	}
+	return order
+}
+
+func reverse(a []int) {
+	for i, j := 0, len(a)-1; i < j; i, j = i+1, j-1 {
+		a[i], a[j] = a[j], a[i]
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package layout
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/siftrics/sight"
+)
+
+// row returns elements for words laid out from left to right, in visual
+// order, on a line from top to top+20.
+func row(top int, words ...string) []sight.RecognizedText {
+	elements := make([]sight.RecognizedText, len(words))
+	for i, w := range words {
+		elements[i] = el(w, 10+60*i, top, 60+60*i, top+20)
+	}
+	return elements
+}
+
+func TestRightToLeftLines(t *testing.T) {
+	tests := []struct {
+		name string
+		// visual are the words from left to right.
+		visual []string
+		want   string
+		rtl    bool
+	}{
+		{"pure right-to-left", []string{"עולם", "שלום"}, "שלום עולם", true},
+		{"Arabic", []string{"العالم", "مرحبا"}, "مرحبا العالم", true},
+		{"digits between right-to-left words", []string{"שקל", "100", "מחיר"}, "מחיר 100 שקל", true},
+		{"left-to-right run", []string{"היום", "LG", "TV", "קניתי"}, "קניתי LG TV היום", true},
+		{"digits ending a right-to-left line", []string{"2020", "בשנת", "נולד"}, "נולד בשנת 2020", true},
+		{"right-to-left run", []string{"the", "word", "עולם", "שלום", "means"}, "the word שלום עולם means", false},
+		{"digits in a left-to-right line", []string{"page", "12", "of", "30"}, "page 12 of 30", false},
+	}
+	for _, tt := range tests {
+		p := page(row(10, tt.visual...)...)
+		// The order of the elements on the page must not matter.
+		for i, j := 0, len(p.RecognizedText)-1; i < j; i, j = i+1, j-1 {
+			p.RecognizedText[i], p.RecognizedText[j] = p.RecognizedText[j], p.RecognizedText[i]
+		}
+		lines := Lines(p)
+		if len(lines) != 1 {
+			t.Errorf("%v: lines = %q, want one", tt.name, lineTexts(lines))
+			continue
+		}
+		if lines[0].Text != tt.want || lines[0].RightToLeft != tt.rtl {
+			t.Errorf("%v: line = %q, right-to-left %v; want %q, %v", tt.name, lines[0].Text, lines[0].RightToLeft, tt.want, tt.rtl)
+		}
+	}
+}
+
+func TestRightToLeftColumns(t *testing.T) {
+	// Columns of right-to-left lines are read from right to left.
+	p := page(
+		el("שמאל", 10, 10, 200, 30),
+		el("ימין", 240, 10, 430, 30),
+		el("שמאל שני", 10, 40, 200, 60),
+		el("ימין שני", 240, 40, 430, 60),
+	)
+	want := []string{"ימין", "ימין שני", "שמאל", "שמאל שני"}
+	if got := lineTexts(Lines(p)); !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestDirection(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"שלום", 4},
+		{"abc", -3},
+		{"123", 0},
+		{"abשלום", 2},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := direction(tt.s); got != tt.want {
+			t.Errorf("direction(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package layout
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/siftrics/sight"
+)
+
+// Column is a run of lines read from top to bottom. A page set in one
+// column is a single Column; a page set in several has a Column for each,
+// and one for each headline or other block which spans them.
+type Column struct {
+	// Lines are the lines of the column, from top to bottom, or from right
+	// to left if they are vertical.
+	Lines []Line
+	// Box bounds the lines.
+	Box
+}
+
+// minGutter is the narrowest gap between columns, in line heights.
+const minGutter = 0.8
+
+// Columns returns the columns of p in reading order: blocks from top to
+// bottom, and the columns of a block from left to right, or from right to
+// left if most of their lines are right-to-left, so that the lines of
+// adjacent columns are not interleaved. On a page set vertically, as in
+// traditional Japanese and Chinese, the lines of a column are read from
+// right to left, and its columns are bands from top to bottom.
+//
+// The page is cut recursively, as in the XY-cut algorithm. A region is
+// first cut into columns at vertical gaps between lines, and otherwise into
+// blocks at horizontal gaps. Consecutive blocks with the same columns, such
+// as the rows of lines of two columns whose baselines happen to align, are
+// kept together so that they are read column by column.
+func Columns(p sight.RecognizedPage) []Column {
+	cs, vertical := columns(p)
+	if vertical {
+		for i := range cs {
+			cs[i].Box = unturnBox(cs[i].Box)
+			unturnLines(cs[i].Lines)
+		}
+	}
+	return cs
+}
+
+// columns returns the columns of p, laid out turned if vertical; see
+// isVertical.
+func columns(p sight.RecognizedPage) (_ []Column, vertical bool) {
+	vertical = isVertical(p)
+	lines := findLines(p, vertical)
+	if len(lines) == 0 {
+		return nil, vertical
+	}
+	var cs []Column
+	for _, region := range cut(lines) {
+		sort.SliceStable(region, func(i, j int) bool {
+			if region[i].Top != region[j].Top {
+				return region[i].Top < region[j].Top
+			}
+			return region[i].Left < region[j].Left
+		})
+		r := toRect(region[0].Box)
+		for _, l := range region[1:] {
+			r = r.union(toRect(l.Box))
+		}
+		cs = append(cs, Column{Lines: region, Box: r.box()})
+	}
+	return cs, vertical
+}
+
+// cut returns lines cut into regions of one column each, in reading order.
+func cut(lines []Line) [][]Line {
+	if columns := verticalCut(lines); len(columns) > 1 {
+		if rightToLeftLines(lines) {
+			for i, j := 0, len(columns)-1; i < j; i, j = i+1, j-1 {
+				columns[i], columns[j] = columns[j], columns[i]
+			}
+		}
+		var regions [][]Line
+		for _, c := range columns {
+			regions = append(regions, cut(c)...)
+		}
+		return regions
+	}
+	// Gather the blocks between horizontal gaps into groups which all have
+	// the same columns, or all have none.
+	var groups [][]Line
+	columned := false
+	for _, block := range horizontalCut(lines) {
+		n := len(groups)
+		if n > 0 {
+			merged := append(append([]Line(nil), groups[n-1]...), block...)
+			hasColumns := len(verticalCut(merged)) > 1
+			if hasColumns || !columned && len(verticalCut(block)) <= 1 {
+				groups[n-1] = merged
+				columned = hasColumns
+				continue
+			}
+		}
+		groups = append(groups, block)
+		columned = len(verticalCut(block)) > 1
+	}
+	if len(groups) == 1 {
+		return groups
+	}
+	var regions [][]Line
+	for _, g := range groups {
+		regions = append(regions, cut(g)...)
+	}
+	return regions
+}
+
+// verticalCut returns lines cut at the vertical gaps between them which are
+// at least minGutter line heights wide, from left to right.
+func verticalCut(lines []Line) [][]Line {
+	return split(lines, minGutter*medianHeight(lines), func(b Box) (float64, float64) {
+		return float64(b.Left), float64(b.Right)
+	})
+}
+
+// horizontalCut returns lines cut at the horizontal gaps between them, from
+// top to bottom.
+func horizontalCut(lines []Line) [][]Line {
+	return split(lines, 0, func(b Box) (float64, float64) {
+		return float64(b.Top), float64(b.Bottom)
+	})
+}
+
+// split projects the boxes of lines onto an axis with extent, and returns
+// the lines cut at gaps in the projection wider than minGap, in order along
+// the axis.
+func split(lines []Line, minGap float64, extent func(Box) (float64, float64)) [][]Line {
+	sorted := append([]Line(nil), lines...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, _ := extent(sorted[i].Box)
+		b, _ := extent(sorted[j].Box)
+		return a < b
+	})
+	var parts [][]Line
+	end := math.Inf(-1)
+	for _, l := range sorted {
+		start, stop := extent(l.Box)
+		if len(parts) == 0 || start-end > minGap {
+			parts = append(parts, nil)
+		}
+		parts[len(parts)-1] = append(parts[len(parts)-1], l)
+		end = math.Max(end, stop)
+	}
+	return parts
+}
+
+// rightToLeftLines reports whether most lines are right-to-left, so that
+// their columns are read from right to left.
+func rightToLeftLines(lines []Line) bool {
+	n := 0
+	for _, l := range lines {
+		if l.RightToLeft {
+			n++
+		}
+	}
+	return 2*n > len(lines)
+}
+
+func medianHeight(lines []Line) float64 {
+	heights := make([]float64, len(lines))
+	for i, l := range lines {
+		heights[i] = float64(l.Bottom - l.Top)
+	}
+	sort.Float64s(heights)
+	return heights[len(heights)/2]
+}
+
+// ReadingOrder returns p with its text in reading order: line by line, and
+// column by column; see Columns. Text elements without text are left at
+// the end. It is a sight.PostProcessorFunc.
+func ReadingOrder(p sight.RecognizedPage) sight.RecognizedPage {
+	ordered := make([]sight.RecognizedText, 0, len(p.RecognizedText))
+	for _, l := range Lines(p) {
+		ordered = append(ordered, l.Elements...)
+	}
+	for _, t := range p.RecognizedText {
+		if strings.TrimSpace(t.Text) == "" {
+			ordered = append(ordered, t)
+		}
+	}
+	p.RecognizedText = ordered
+	return p
+}
@@ -0,0 +1,106 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package layout
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/siftrics/sight"
+)
+
+// columnTexts returns the text of the lines of each column.
+func columnTexts(cs []Column) [][]string {
+	texts := make([][]string, len(cs))
+	for i, c := range cs {
+		texts[i] = lineTexts(c.Lines)
+	}
+	return texts
+}
+
+// twoColumns returns the elements of n rows of two columns, whose lines
+// are aligned, starting at top: "L1" and "R1" and so on.
+func twoColumns(top, n int) []sight.RecognizedText {
+	var elements []sight.RecognizedText
+	for i := 0; i < n; i++ {
+		y := top + 30*i
+		elements = append(elements,
+			el(fmt.Sprintf("R%v", i+1), 240, y, 430, y+20),
+			el(fmt.Sprintf("L%v", i+1), 10, y, 200, y+20))
+	}
+	return elements
+}
+
+func TestColumnsTwoColumns(t *testing.T) {
+	cs := Columns(page(twoColumns(10, 3)...))
+	want := [][]string{{"L1", "L2", "L3"}, {"R1", "R2", "R3"}}
+	if got := columnTexts(cs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("columns = %q, want %q", got, want)
+	}
+	if want := (Box{240, 10, 430, 90}); cs[1].Box != want {
+		t.Errorf("right column has box %v, want %v", cs[1].Box, want)
+	}
+}
+
+func TestColumnsHeading(t *testing.T) {
+	elements := append([]sight.RecognizedText{
+		el("Footer", 10, 200, 430, 220),
+		el("A heading across both columns", 10, 10, 430, 40),
+	}, twoColumns(60, 3)...)
+	want := [][]string{
+		{"A heading across both columns"},
+		{"L1", "L2", "L3"},
+		{"R1", "R2", "R3"},
+		{"Footer"},
+	}
+	if got := columnTexts(Columns(page(elements...))); !reflect.DeepEqual(got, want) {
+		t.Errorf("columns = %q, want %q", got, want)
+	}
+	var lines []string
+	for _, c := range want {
+		lines = append(lines, c...)
+	}
+	if got := lineTexts(Lines(page(elements...))); !reflect.DeepEqual(got, lines) {
+		t.Errorf("lines = %q, want %q", got, lines)
+	}
+}
+
+func TestColumnsSingleColumn(t *testing.T) {
+	// Words of ragged lines, whose gaps, both between words and at the
+	// ends of short lines, must not be taken for gutters.
+	p := page(
+		el("A", 10, 10, 30, 30), el("ragged", 40, 10, 140, 30), el("line", 150, 10, 220, 30),
+		el("short", 10, 40, 90, 60),
+		el("and", 10, 70, 60, 90), el("a", 70, 70, 85, 90), el("longer", 95, 70, 190, 90), el("one", 200, 70, 260, 90),
+		el("end", 120, 100, 180, 120),
+	)
+	want := [][]string{{"A ragged line", "short", "and a longer one", "end"}}
+	if got := columnTexts(Columns(p)); !reflect.DeepEqual(got, want) {
+		t.Errorf("columns = %q, want %q", got, want)
+	}
+}
+
+func TestColumnsEmpty(t *testing.T) {
+	if cs := Columns(page()); len(cs) != 0 {
+		t.Errorf("columns = %q, want none", columnTexts(cs))
+	}
+}
@@ -0,0 +1,363 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package layout reconstructs the lines and paragraphs of recognized pages,
+// to turn the sentences (or words) reported by the Sight API into clean
+// prose for summarization, classification and other NLP pipelines:
+//
+//	for _, para := range layout.Paragraphs(page) {
+//		fmt.Println(para.Text)
+//	}
+//
+// Text elements are gathered into lines by their bounding boxes, lines into
+// columns, which are read one after another, and the lines of a column into
+// paragraphs by their spacing, indentation and size. Words hyphenated
+// across a line break are joined. The heuristics suit printed prose; the
+// cells of tables come out as lines and paragraphs of their own.
+package layout
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/siftrics/sight"
+)
+
+// Box is an upright rectangle in the pixels of a page.
+type Box struct {
+	Left, Top, Right, Bottom int
+}
+
+// Line is a line of text: text elements side by side.
+type Line struct {
+	// Text is the text of the elements, separated by spaces, except
+	// between words of scripts written without them, such as Japanese.
+	Text string
+	// Elements are the text elements of the line, in the order they are
+	// read: from left to right, or from right to left if RightToLeft.
+	Elements []sight.RecognizedText
+	// RightToLeft is whether the line is mostly in a right-to-left script,
+	// such as Arabic or Hebrew. Runs of elements in the other direction,
+	// such as numbers and Latin words, are still read in their own
+	// direction.
+	RightToLeft bool
+	// Vertical is whether the line is set vertically, as in traditional
+	// Japanese and Chinese, and so read from top to bottom. Vertical lines
+	// are read from right to left.
+	Vertical bool
+	// Box bounds the elements.
+	Box
+}
+
+// Paragraph is a block of lines.
+type Paragraph struct {
+	// Text is the text of the lines, separated by spaces, except that a
+	// word hyphenated across a line break is joined.
+	Text string
+	// Lines are the lines of the paragraph, from top to bottom.
+	Lines []Line
+	// Box bounds the lines.
+	Box
+}
+
+// rect is a Box in floating point, which is what the heuristics work in.
+type rect struct {
+	left, top, right, bottom float64
+}
+
+func (r rect) height() float64 { return r.bottom - r.top }
+func (r rect) width() float64  { return r.right - r.left }
+
+func (r rect) union(s rect) rect {
+	return rect{math.Min(r.left, s.left), math.Min(r.top, s.top), math.Max(r.right, s.right), math.Max(r.bottom, s.bottom)}
+}
+
+func (r rect) box() Box {
+	return Box{int(math.Round(r.left)), int(math.Round(r.top)), int(math.Round(r.right)), int(math.Round(r.bottom))}
+}
+
+// overlap returns the length of the overlap of the intervals a0 to a1 and
+// b0 to b1, which is negative if they are apart.
+func overlap(a0, a1, b0, b1 float64) float64 {
+	return math.Min(a1, b1) - math.Max(a0, b0)
+}
+
+// bounds returns the upright bounding box of t.
+func bounds(t sight.RecognizedText) rect {
+	xs := []float64{float64(t.TopLeftX), float64(t.TopRightX), float64(t.BottomLeftX), float64(t.BottomRightX)}
+	ys := []float64{float64(t.TopLeftY), float64(t.TopRightY), float64(t.BottomLeftY), float64(t.BottomRightY)}
+	r := rect{xs[0], ys[0], xs[0], ys[0]}
+	for i := 1; i < 4; i++ {
+		r = r.union(rect{xs[i], ys[i], xs[i], ys[i]})
+	}
+	return r
+}
+
+// line is a Line being built.
+type line struct {
+	elements []sight.RecognizedText
+	rects    []rect
+	rect
+}
+
+const (
+	// maxWordGap is the widest gap between elements of a line, in line
+	// heights. Wider gaps, such as those between columns, split lines.
+	maxWordGap = 1.5
+	// maxLeading is the widest gap between lines of a paragraph, in line
+	// heights.
+	maxLeading = 0.75
+	// maxIndent is how far right of a paragraph a line may start and
+	// still belong to it, in line heights; further right, it is the
+	// indented first line of the next paragraph.
+	maxIndent = 1.0
+	// maxHeightRatio is the largest ratio of the heights of lines of a
+	// paragraph, so that headings are paragraphs of their own.
+	maxHeightRatio = 1.4
+)
+
+// Lines returns the lines of p in reading order: column by column, and from
+// top to bottom, or right to left for vertical lines, within a column; see
+// Columns. Elements whose vertical centers are within half a height of each
+// other, and which are not far apart, are on the same line.
+func Lines(p sight.RecognizedPage) []Line {
+	var lines []Line
+	for _, c := range Columns(p) {
+		lines = append(lines, c.Lines...)
+	}
+	return lines
+}
+
+// findLines returns the lines of p, in no particular order. If vertical,
+// the page is laid out turned, and the boxes of the lines are turned too.
+func findLines(p sight.RecognizedPage, vertical bool) []Line {
+	box := func(t sight.RecognizedText) rect {
+		if vertical {
+			return turn(bounds(t))
+		}
+		return bounds(t)
+	}
+	var elements []sight.RecognizedText
+	for _, t := range p.RecognizedText {
+		if strings.TrimSpace(t.Text) != "" {
+			elements = append(elements, t)
+		}
+	}
+	sort.SliceStable(elements, func(i, j int) bool {
+		a, b := box(elements[i]), box(elements[j])
+		return a.top+a.bottom < b.top+b.bottom
+	})
+	var ls []*line
+	for _, t := range elements {
+		r := box(t)
+		var best *line
+		bestGap := math.Inf(1)
+		for _, l := range ls {
+			h := math.Max(r.height(), l.height())
+			if overlap(r.top, r.bottom, l.top, l.bottom) < 0.5*math.Min(r.height(), l.height()) ||
+				overlap(r.left, r.right, l.left, l.right) > 0.3*math.Min(r.width(), l.width()) {
+				continue
+			}
+			gap := -overlap(r.left, r.right, l.left, l.right)
+			if gap <= maxWordGap*h && gap < bestGap {
+				best, bestGap = l, gap
+			}
+		}
+		if best == nil {
+			ls = append(ls, &line{rect: r})
+			best = ls[len(ls)-1]
+		}
+		best.elements = append(best.elements, t)
+		best.rects = append(best.rects, r)
+		best.rect = best.rect.union(r)
+	}
+	lines := make([]Line, len(ls))
+	for i, l := range ls {
+		order := make([]int, len(l.elements))
+		for k := range order {
+			order[k] = k
+		}
+		sort.SliceStable(order, func(a, b int) bool { return l.rects[order[a]].left < l.rects[order[b]].left })
+		dirs := make([]int, len(l.elements))
+		total := 0
+		for k, t := range l.elements {
+			dirs[k] = direction(t.Text)
+			total += dirs[k]
+		}
+		order = logicalOrder(order, dirs, total > 0)
+		text := ""
+		elements := make([]sight.RecognizedText, len(order))
+		for k, o := range order {
+			elements[k] = l.elements[o]
+			t := strings.TrimSpace(l.elements[o].Text)
+			if k > 0 {
+				text += separator(text, t)
+			}
+			text += t
+		}
+		lines[i] = Line{Text: text, Elements: elements, RightToLeft: total > 0, Vertical: vertical, Box: l.box()}
+	}
+	return lines
+}
+
+func toRect(b Box) rect {
+	return rect{float64(b.Left), float64(b.Top), float64(b.Right), float64(b.Bottom)}
+}
+
+// paragraph is a Paragraph being built.
+type paragraph struct {
+	lines []Line
+	rect
+}
+
+// continues reports whether l continues the paragraph.
+func (para *paragraph) continues(l Line) (gap float64, ok bool) {
+	last := toRect(para.lines[len(para.lines)-1].Box)
+	r := toRect(l.Box)
+	h := math.Min(r.height(), last.height())
+	if h <= 0 || math.Max(r.height(), last.height()) > maxHeightRatio*h {
+		return 0, false
+	}
+	if overlap(r.left, r.right, para.left, para.right) <= 0 {
+		return 0, false
+	}
+	gap = r.top - last.bottom
+	if gap < -0.5*h || gap > maxLeading*h {
+		return 0, false
+	}
+	// Lines of right-to-left scripts are indented, and end short, on the
+	// other side.
+	rtl := para.lines[0].RightToLeft
+	if !rtl && r.left > para.left+maxIndent*h || rtl && r.right < para.right-maxIndent*h {
+		return 0, false
+	}
+	// A line which ends a sentence well short of the edge of the paragraph
+	// ends the paragraph.
+	text := para.lines[len(para.lines)-1].Text
+	short := last.right < para.right-3*h
+	if rtl {
+		short = last.left > para.left+3*h
+	}
+	if len(para.lines) > 1 && short && strings.ContainsAny(lastRune(text), ".!?:\u061f") {
+		return 0, false
+	}
+	return gap, true
+}
+
+func lastRune(s string) string {
+	_, n := utf8.DecodeLastRuneInString(s)
+	return s[len(s)-n:]
+}
+
+// Paragraphs returns the paragraphs of p in reading order. A line belongs
+// to the paragraph above it in its column if they overlap horizontally, are
+// about as tall, and are close; unless it is indented, or the line above
+// ends a sentence short of the edge of the paragraph. In right-to-left
+// scripts, the edges are mirrored.
+func Paragraphs(p sight.RecognizedPage) []Paragraph {
+	cs, vertical := columns(p)
+	var result []Paragraph
+	for _, c := range cs {
+		paras := paragraphs(c.Lines)
+		if vertical {
+			for i := range paras {
+				paras[i].Box = unturnBox(paras[i].Box)
+				unturnLines(paras[i].Lines)
+			}
+		}
+		result = append(result, paras...)
+	}
+	return result
+}
+
+// paragraphs groups lines, which are from top to bottom, into paragraphs.
+func paragraphs(lines []Line) []Paragraph {
+	var paras []*paragraph
+	for _, l := range lines {
+		var best *paragraph
+		bestGap := math.Inf(1)
+		for _, para := range paras {
+			if gap, ok := para.continues(l); ok && gap < bestGap {
+				best, bestGap = para, gap
+			}
+		}
+		if best == nil {
+			paras = append(paras, &paragraph{rect: toRect(l.Box)})
+			best = paras[len(paras)-1]
+		}
+		best.lines = append(best.lines, l)
+		best.rect = best.rect.union(toRect(l.Box))
+	}
+	result := make([]Paragraph, len(paras))
+	for i, para := range paras {
+		text := ""
+		for k, l := range para.lines {
+			if k == 0 {
+				text = l.Text
+			} else {
+				text = JoinLines(text, l.Text)
+			}
+		}
+		result[i] = Paragraph{Text: text, Lines: para.lines, Box: para.box()}
+	}
+	return result
+}
+
+// hyphens are the characters which hyphenate a word across a line break.
+const hyphens = "-\u00ad\u2010"
+
+// JoinLines joins two consecutive lines of text with a space, or without
+// one if the first ends with a word hyphenated across the line break, or
+// both are in scripts written without spaces, such as Japanese. The
+// hyphen is removed if the second line continues the word in lower case,
+// as in "recog-" and "nized", and kept otherwise, as in "Jean-" and "Paul".
+// A soft hyphen is always removed.
+func JoinLines(a, b string) string {
+	a, b = strings.TrimRightFunc(a, unicode.IsSpace), strings.TrimLeftFunc(b, unicode.IsSpace)
+	if a == "" || b == "" {
+		return a + b
+	}
+	hyphen, n := utf8.DecodeLastRuneInString(a)
+	if !strings.ContainsRune(hyphens, hyphen) {
+		return a + separator(a, b) + b
+	}
+	before, _ := utf8.DecodeLastRuneInString(a[:len(a)-n])
+	next, _ := utf8.DecodeRuneInString(b)
+	if !unicode.IsLetter(before) {
+		return a + " " + b
+	}
+	if hyphen == '\u00ad' || unicode.IsLower(next) {
+		return a[:len(a)-n] + b
+	}
+	return a + b
+}
+
+// Text returns the text of p as paragraphs separated by blank lines.
+func Text(p sight.RecognizedPage) string {
+	paras := Paragraphs(p)
+	texts := make([]string, len(paras))
+	for i, para := range paras {
+		texts[i] = para.Text
+	}
+	return strings.Join(texts, "\n\n")
+}
@@ -0,0 +1,197 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package layout
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/siftrics/sight"
+)
+
+// el returns a text element with the box from left, top to right, bottom.
+func el(text string, left, top, right, bottom int) sight.RecognizedText {
+	return sight.RecognizedText{
+		Text:         text,
+		TopLeftX:     left,
+		TopLeftY:     top,
+		TopRightX:    right,
+		TopRightY:    top,
+		BottomLeftX:  left,
+		BottomLeftY:  bottom,
+		BottomRightX: right,
+		BottomRightY: bottom,
+		Confidence:   1,
+	}
+}
+
+func page(elements ...sight.RecognizedText) sight.RecognizedPage {
+	return sight.RecognizedPage{RecognizedText: elements}
+}
+
+func lineTexts(lines []Line) []string {
+	texts := make([]string, len(lines))
+	for i, l := range lines {
+		texts[i] = l.Text
+	}
+	return texts
+}
+
+func paragraphTexts(paras []Paragraph) []string {
+	texts := make([]string, len(paras))
+	for i, p := range paras {
+		texts[i] = p.Text
+	}
+	return texts
+}
+
+func TestLines(t *testing.T) {
+	p := page(
+		el("line", 130, 42, 170, 62),
+		el("world", 70, 10, 120, 30),
+		el("Second", 10, 40, 120, 60),
+		// Slightly lower than the rest of its line.
+		el("there", 130, 14, 180, 34),
+		el("Hello", 10, 10, 60, 30),
+		el("  ", 200, 10, 220, 30),
+	)
+	lines := Lines(p)
+	if got, want := lineTexts(lines), []string{"Hello world there", "Second line"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+	if want := (Box{10, 10, 180, 34}); lines[0].Box != want {
+		t.Errorf("first line has box %v, want %v", lines[0].Box, want)
+	}
+	if lines[0].RightToLeft || lines[0].Vertical {
+		t.Errorf("first line is right-to-left %v, vertical %v", lines[0].RightToLeft, lines[0].Vertical)
+	}
+}
+
+func TestLinesEmpty(t *testing.T) {
+	if lines := Lines(page(el(" ", 0, 0, 10, 10))); len(lines) != 0 {
+		t.Errorf("lines = %q, want none", lineTexts(lines))
+	}
+}
+
+func TestParagraphs(t *testing.T) {
+	p := page(
+		// A heading, taller than the body.
+		el("Results", 10, 10, 200, 50),
+		el("The recog-", 10, 70, 300, 90),
+		el("nized text is in", 10, 100, 300, 120),
+		// A sentence ending at the edge does not end the paragraph.
+		el("reading order.", 10, 130, 300, 150),
+		el("It was written", 10, 160, 300, 180),
+		el("by Jean-", 10, 190, 300, 210),
+		// One ending short of the edge does.
+		el("Paul Sartre.", 10, 220, 120, 240),
+		el("Next one.", 10, 250, 290, 270),
+		// An indented line starts a paragraph.
+		el("Indented first", 50, 280, 300, 300),
+		el("line, and a non-hyphen 1-", 10, 310, 300, 330),
+		el("2 split.", 10, 340, 300, 360),
+		// A wide gap starts one too.
+		el("Far below.", 10, 500, 300, 520),
+	)
+	want := []string{
+		"Results",
+		"The recognized text is in reading order. It was written by Jean-Paul Sartre.",
+		"Next one.",
+		"Indented first line, and a non-hyphen 1- 2 split.",
+		"Far below.",
+	}
+	paras := Paragraphs(p)
+	if got := paragraphTexts(paras); !reflect.DeepEqual(got, want) {
+		t.Fatalf("paragraphs = %q, want %q", got, want)
+	}
+	if want := (Box{10, 70, 300, 240}); paras[1].Box != want {
+		t.Errorf("second paragraph has box %v, want %v", paras[1].Box, want)
+	}
+	if n := len(paras[1].Lines); n != 6 {
+		t.Errorf("second paragraph has %v lines, want 6", n)
+	}
+}
+
+func TestJoinLines(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"plain", "text", "plain text"},
+		{"trailing  ", "  space", "trailing space"},
+		{"", "b", "b"},
+		{"a", "", "a"},
+		// A hyphenated word continued in lower case is joined.
+		{"the recog-", "nized text", "the recognized text"},
+		{"the recog‐", "nized", "the recognized"},
+		// A real hyphen is kept.
+		{"Jean-", "Paul", "Jean-Paul"},
+		{"pre-", "2020", "pre-2020"},
+		// A soft hyphen is always removed.
+		{"Soft­", "Ware", "SoftWare"},
+		// A dash after something other than a letter is not a hyphen.
+		{"pages 1-", "5", "pages 1- 5"},
+		{"a -", "b", "a - b"},
+		// Scripts written without spaces are joined without them.
+		{"日本", "語です", "日本語です"},
+		{"日本。", "語", "日本。語"},
+		{"日本", "Go", "日本 Go"},
+	}
+	for _, tt := range tests {
+		if got := JoinLines(tt.a, tt.b); got != tt.want {
+			t.Errorf("JoinLines(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	p := page(
+		el("second", 10, 100, 100, 120),
+		el("First para-", 10, 10, 200, 30),
+		el("graph.", 10, 40, 100, 60),
+	)
+	if got, want := Text(p), "First paragraph.\n\nsecond"; got != want {
+		t.Errorf("Text = %q, want %q", got, want)
+	}
+}
+
+func TestReadingOrder(t *testing.T) {
+	p := page(
+		el("c", 10, 40, 30, 60),
+		el("", 0, 0, 0, 0),
+		el("b", 40, 10, 60, 30),
+		el("a", 10, 10, 30, 30),
+	)
+	p.PageNumber = 3
+	got := ReadingOrder(p)
+	var texts []string
+	for _, t := range got.RecognizedText {
+		texts = append(texts, t.Text)
+	}
+	if want := []string{"a", "b", "c", ""}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("ReadingOrder = %q, want %q", texts, want)
+	}
+	if got.PageNumber != 3 {
+		t.Errorf("PageNumber = %v, want 3", got.PageNumber)
+	}
+	if p.RecognizedText[0].Text != "c" {
+		t.Errorf("ReadingOrder modified the page passed to it")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package layout
+
+import (
+	"math"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/siftrics/sight"
+)
+
+// unspaced are the scripts written without spaces between words, so that
+// neither the elements of a line nor the lines of a paragraph are joined
+// with spaces. Hangul is written with spaces.
+var unspaced = []*unicode.RangeTable{unicode.Han, unicode.Hiragana, unicode.Katakana}
+
+// isUnspaced reports whether s consists mostly of characters of unspaced
+// scripts.
+func isUnspaced(s string) bool {
+	n, total := 0, 0
+	for _, r := range s {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) {
+			continue
+		}
+		total++
+		if unicode.In(r, unspaced...) {
+			n++
+		}
+	}
+	return total > 0 && 2*n >= total
+}
+
+// separator returns what to put between a and b, consecutive elements or
+// lines of text: a space, unless both sides are in scripts written without
+// spaces, such as Japanese and Chinese.
+func separator(a, b string) string {
+	last, _ := utf8.DecodeLastRuneInString(a)
+	first, _ := utf8.DecodeRuneInString(b)
+	if (unicode.In(last, unspaced...) || unicode.IsPunct(last) && isUnspaced(a)) && unicode.In(first, unspaced...) {
+		return ""
+	}
+	return " "
+}
+
+// isVertical reports whether the text of p is set vertically, as in
+// traditional Japanese and Chinese: read from top to bottom, in lines from
+// right to left. It is if most elements of several characters in unspaced
+// scripts are taller than they are wide or, if there are none, e.g., in
+// word-level results, if most such elements are closest to one above or
+// below them. A page is either vertical or not; horizontal headings on a
+// vertical page are treated as vertical lines of their own.
+func isVertical(p sight.RecognizedPage) bool {
+	var rects []rect
+	votes := 0
+	for _, t := range p.RecognizedText {
+		if !isUnspaced(t.Text) {
+			continue
+		}
+		r := bounds(t)
+		rects = append(rects, r)
+		if utf8.RuneCountInString(t.Text) < 2 {
+			continue
+		}
+		if r.height() > 1.5*r.width() {
+			votes++
+		} else if r.width() > 1.5*r.height() {
+			votes--
+		}
+	}
+	if votes != 0 {
+		return votes > 0
+	}
+	for i, r := range rects {
+		nearest := math.Inf(1)
+		var dx, dy float64
+		for j, s := range rects {
+			x := (s.left + s.right - r.left - r.right) / 2
+			y := (s.top + s.bottom - r.top - r.bottom) / 2
+			if d := math.Hypot(x, y); i != j && d < nearest {
+				nearest, dx, dy = d, x, y
+			}
+		}
+		if math.IsInf(nearest, 1) {
+			continue
+		}
+		if math.Abs(dy) > math.Abs(dx) {
+			votes++
+		} else {
+			votes--
+		}
+	}
+	return votes > 0
+}
+
+// turn turns r a quarter turn counterclockwise, so that vertical lines read
+// from top to bottom, and from right to left, become horizontal lines read
+// from left to right, and from top to bottom. Vertical pages are laid out
+// turned, with the heuristics for horizontal ones.
+func turn(r rect) rect {
+	return rect{left: r.top, top: -r.right, right: r.bottom, bottom: -r.left}
+}
+
+// unturn undoes turn.
+func unturn(r rect) rect {
+	return rect{left: -r.bottom, top: r.left, right: -r.top, bottom: r.right}
+}
+
+func unturnBox(b Box) Box {
+	return unturn(toRect(b)).box()
+}
+
+func unturnLines(lines []Line) {
+	for i := range lines {
+		lines[i].Box = unturnBox(lines[i].Box)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package layout
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/siftrics/sight"
+)
+
+func TestVerticalLines(t *testing.T) {
+	p := page(
+		el("テスト", 340, 10, 360, 90),
+		el("日本語の", 400, 10, 420, 110),
+		el("縦書きです", 370, 10, 390, 130),
+	)
+	lines := Lines(p)
+	if got, want := lineTexts(lines), []string{"日本語の", "縦書きです", "テスト"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("lines = %q, want %q", got, want)
+	}
+	for _, l := range lines {
+		if !l.Vertical {
+			t.Errorf("line %q is not vertical", l.Text)
+		}
+	}
+	if want := (Box{400, 10, 420, 110}); lines[0].Box != want {
+		t.Errorf("first line has box %v, want %v", lines[0].Box, want)
+	}
+	paras := Paragraphs(p)
+	if got, want := paragraphTexts(paras), []string{"日本語の縦書きですテスト"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("paragraphs = %q, want %q", got, want)
+	}
+	if want := (Box{340, 10, 420, 130}); len(paras) == 1 && paras[0].Box != want {
+		t.Errorf("paragraph has box %v, want %v", paras[0].Box, want)
+	}
+}
+
+func TestVerticalCharacters(t *testing.T) {
+	// Single characters, whose shape does not tell, are vertical because
+	// each is closest to the one above or below it.
+	var elements []sight.RecognizedText
+	for i, r := range []rune("日本語") {
+		elements = append(elements, el(string(r), 400, 10+22*i, 420, 30+22*i))
+	}
+	for i, r := range []rune("縦書き") {
+		elements = append(elements, el(string(r), 370, 10+22*i, 390, 30+22*i))
+	}
+	lines := Lines(page(elements...))
+	if got, want := lineTexts(lines), []string{"日本語", "縦書き"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+	if len(lines) != 0 && !lines[0].Vertical {
+		t.Errorf("lines are not vertical")
+	}
+}
+
+func TestHorizontalJapanese(t *testing.T) {
+	p := page(
+		el("二行目です", 10, 40, 110, 60),
+		el("日本語の", 10, 10, 90, 30),
+		el("横書き", 100, 10, 160, 30),
+	)
+	lines := Lines(p)
+	if got, want := lineTexts(lines), []string{"日本語の横書き", "二行目です"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+	if len(lines) != 0 && lines[0].Vertical {
+		t.Errorf("lines are vertical")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/siftrics/sight/internal/pdf"
+)
+
+// limitPages enforces cfg.MaxPagesPerFile on f, the i-th file, which is a
+// PDF. It returns the contents to submit: f.Contents, or a truncated copy
+// if f is too long and cfg.TruncateLongFiles is set.
+func (c *Client) limitPages(cfg Config, f File, i int) ([]byte, error) {
+	r, err := pdf.NewReader(f.Contents)
+	if err != nil {
+		c.logger.Warn("failed to count the pages of a PDF; submitting it as it is", "file", fileName(f, i), "error", err)
+		return f.Contents, nil
+	}
+	n, err := r.NumPages()
+	if err != nil {
+		c.logger.Warn("failed to count the pages of a PDF; submitting it as it is", "file", fileName(f, i), "error", err)
+		return f.Contents, nil
+	}
+	if n <= cfg.MaxPagesPerFile {
+		return f.Contents, nil
+	}
+	if !cfg.TruncateLongFiles {
+		return nil, fmt.Errorf("%v has %v pages, more than the maximum of %v pages per file", fileName(f, i), n, cfg.MaxPagesPerFile)
+	}
+	u, err := r.Truncate(cfg.MaxPagesPerFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to truncate %v to %v pages: %v", fileName(f, i), cfg.MaxPagesPerFile, err)
+	}
+	var buf bytes.Buffer
+	if _, err := u.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("failed to truncate %v to %v pages: %v", fileName(f, i), cfg.MaxPagesPerFile, err)
+	}
+	c.logger.Info("truncated a PDF with too many pages", "file", fileName(f, i), "pages", n, "kept", cfg.MaxPagesPerFile)
+	return buf.Bytes(), nil
+}
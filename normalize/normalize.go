@@ -0,0 +1,149 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package normalize normalizes recognized text, so that it matches text
+// from other sources, such as databases, byte for byte. It is separate
+// from package sight so that only programs which use it depend on
+// golang.org/x/text.
+package normalize
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/siftrics/sight"
+)
+
+// Mode is a set of ways to normalize recognized text. It is a
+// sight.PostProcessor, so that a Client normalizes the text of the pages
+// it sends if it is added to Config.PostProcessors.
+type Mode uint
+
+const (
+	// NFC puts text into Unicode Normalization Form C, in which an
+	// accented letter is a single character where one exists, rather
+	// than a letter followed by a combining accent.
+	NFC Mode = 1 << iota
+	// Space replaces each run of whitespace, such as no-break, thin and
+	// ideographic spaces, tabs and line breaks, with a single space, and
+	// trims whitespace from the ends of text.
+	Space
+	// Punctuation replaces curly and other typographic quotation marks
+	// with straight ones, and dashes and minus signs with the
+	// hyphen-minus, "-".
+	Punctuation
+	// ZeroWidth removes zero-width characters: zero-width spaces, joiners
+	// and non-joiners, word joiners, byte order marks and soft hyphens.
+	// Zero-width joiners and non-joiners affect the rendering of some
+	// scripts, such as Persian, and of emoji.
+	ZeroWidth
+	// All is every normalization.
+	All = NFC | Space | Punctuation | ZeroWidth
+)
+
+// modeNames are the names of normalizations, as parsed by Parse.
+var modeNames = []struct {
+	name string
+	m    Mode
+}{
+	{"nfc", NFC},
+	{"space", Space},
+	{"punctuation", Punctuation},
+	{"zero-width", ZeroWidth},
+	{"all", All},
+}
+
+// Parse parses a comma-separated list of normalizations: nfc, space,
+// punctuation and zero-width, or all of them.
+func Parse(s string) (Mode, error) {
+	var m Mode
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for _, mn := range modeNames {
+			if mn.name == name {
+				m |= mn.m
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("%q is not a normalization; expected nfc, space, punctuation, zero-width or all", name)
+		}
+	}
+	return m, nil
+}
+
+// punctuationReplacer replaces typographic quotation marks and dashes.
+var punctuationReplacer = strings.NewReplacer(
+	"\u2018", "'", "\u2019", "'", "\u201a", "'", "\u201b", "'", "\u2032", "'",
+	"\u2039", "'", "\u203a", "'", "\uff07", "'",
+	"\u201c", `"`, "\u201d", `"`, "\u201e", `"`, "\u201f", `"`, "\u2033", `"`,
+	"\u00ab", `"`, "\u00bb", `"`, "\uff02", `"`,
+	"\u2010", "-", "\u2011", "-", "\u2012", "-", "\u2013", "-", "\u2014", "-",
+	"\u2015", "-", "\u2212", "-", "\ufe58", "-", "\ufe63", "-", "\uff0d", "-",
+)
+
+// zeroWidth reports whether r is a zero-width character removed by
+// ZeroWidth.
+func zeroWidth(r rune) bool {
+	switch r {
+	case '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff', '\u00ad':
+		return true
+	}
+	return false
+}
+
+// Text returns text normalized in the ways of m. Zero-width characters are
+// stripped first, so that they do not split runs of whitespace.
+func Text(text string, m Mode) string {
+	if m&ZeroWidth != 0 {
+		text = strings.Map(func(r rune) rune {
+			if zeroWidth(r) {
+				return -1
+			}
+			return r
+		}, text)
+	}
+	if m&NFC != 0 {
+		text = norm.NFC.String(text)
+	}
+	if m&Punctuation != 0 {
+		text = punctuationReplacer.Replace(text)
+	}
+	if m&Space != 0 {
+		// unicode.IsSpace includes no-break, thin, ideographic and
+		// other spaces.
+		text = strings.Join(strings.FieldsFunc(text, unicode.IsSpace), " ")
+	}
+	return text
+}
+
+// Process normalizes the text of each text element of p in the ways of m.
+func (m Mode) Process(p sight.RecognizedPage) sight.RecognizedPage {
+	for i, t := range p.RecognizedText {
+		p.RecognizedText[i].Text = Text(t.Text, m)
+	}
+	return p
+}
+
+var _ sight.PostProcessor = Mode(0)
@@ -0,0 +1,87 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package normalize
+
+import (
+	"testing"
+
+	"github.com/siftrics/sight"
+)
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		text string
+		m    Mode
+		want string
+	}{
+		{"Cafe\u0301", NFC, "Caf\u00e9"},
+		{"Cafe\u0301", Space, "Cafe\u0301"},
+		{" a\u00a0b\u2009c\t\nd\u3000 ", Space, "a b c d"},
+		{"\u201cit\u2019s\u201d \u2013 5\u22123", Punctuation, `"it's" - 5-3`},
+		{"in\u200bvoice\u00ad", ZeroWidth, "invoice"},
+		// Zero-width characters are stripped before whitespace is
+		// collapsed, so that they do not split a run of it.
+		{"a \u200b b", ZeroWidth | Space, "a b"},
+		{" \u201cCafe\u0301\u201d\u200b ", All, "\"Caf\u00e9\""},
+		{"Cafe\u0301 \u2013", 0, "Cafe\u0301 \u2013"},
+	}
+	for _, tt := range tests {
+		if got := Text(tt.text, tt.m); got != tt.want {
+			t.Errorf("Text(%q, %v) = %q, want %q", tt.text, tt.m, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Mode
+	}{
+		{"nfc", NFC},
+		{"space,punctuation", Space | Punctuation},
+		{" NFC , zero-width", NFC | ZeroWidth},
+		{"all", All},
+		{"nfc,all", All},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("Parse(%q) = %v, %v; want %v", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "nfd", "space,"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) succeeded", s)
+		}
+	}
+}
+
+func TestProcess(t *testing.T) {
+	p := sight.RecognizedPage{RecognizedText: []sight.RecognizedText{
+		{Text: "  Total\u00a0due "},
+		{Text: "\u2014"},
+	}}
+	var pp sight.PostProcessor = Space | Punctuation
+	p = pp.Process(p)
+	if p.RecognizedText[0].Text != "Total due" || p.RecognizedText[1].Text != "-" {
+		t.Errorf("Process = %q, %q", p.RecognizedText[0].Text, p.RecognizedText[1].Text)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+// TextOrientation returns the direction in which t runs, as the number of
+// degrees (0, 90, 180 or 270) its baseline is rotated clockwise from
+// left-to-right. Upright text is 0; text reading from top to bottom is 90.
+func TextOrientation(t RecognizedText) int {
+	dx := float64(t.TopRightX - t.TopLeftX)
+	dy := float64(t.TopRightY - t.TopLeftY)
+	deg := math.Atan2(dy, dx) * 180 / math.Pi
+	return (int(math.Round(deg/90))*90 + 360) % 360
+}
+
+// PageOrientation returns the orientation (see TextOrientation) of most of
+// the text on p, weighting each text element by its number of characters.
+// A page without text is reported as 0.
+func PageOrientation(p RecognizedPage) int {
+	var weights [4]int
+	for _, t := range p.RecognizedText {
+		n := utf8.RuneCountInString(t.Text)
+		if n == 0 {
+			n = 1
+		}
+		weights[TextOrientation(t)/90] += n
+	}
+	best := 0
+	for i, w := range weights {
+		if w > weights[best] {
+			best = i
+		}
+	}
+	return best * 90
+}
+
+// RotateText returns t as it lies after an image of width by height pixels
+// is rotated clockwise by degrees, a multiple of 90. The corners keep their
+// names, which refer to the text rather than the image.
+func RotateText(t RecognizedText, degrees, width, height int) RecognizedText {
+	rotate := func(x, y int) (int, int) {
+		switch (degrees%360 + 360) % 360 {
+		case 90:
+			return height - y, x
+		case 180:
+			return width - x, height - y
+		case 270:
+			return y, width - x
+		}
+		return x, y
+	}
+	r := t
+	r.TopLeftX, r.TopLeftY = rotate(t.TopLeftX, t.TopLeftY)
+	r.TopRightX, r.TopRightY = rotate(t.TopRightX, t.TopRightY)
+	r.BottomLeftX, r.BottomLeftY = rotate(t.BottomLeftX, t.BottomLeftY)
+	r.BottomRightX, r.BottomRightY = rotate(t.BottomRightX, t.BottomRightY)
+	return r
+}
+
+// OriginalText maps t, recognized on p, back into the coordinates of the
+// image as it was submitted, undoing the rotation the Sight API applied for
+// Config.DoExifRotate or DoAutoRotate (see AppliedRotationDegrees). EXIF
+// orientations which mirror the image are not undone. It returns
+// ErrNoDimensions if p was rotated but its size is not known.
+func OriginalText(p RecognizedPage, t RecognizedText) (RecognizedText, error) {
+	if p.AppliedRotationDegrees%360 == 0 {
+		return t, nil
+	}
+	if p.Width <= 0 || p.Height <= 0 {
+		return t, ErrNoDimensions
+	}
+	return RotateText(t, -p.AppliedRotationDegrees, p.Width, p.Height), nil
+}
+
+// RotatedText is the inverse of OriginalText: it maps t, in the coordinates
+// of the image as it was submitted, into those of the recognized page p.
+func RotatedText(p RecognizedPage, t RecognizedText) (RecognizedText, error) {
+	if p.AppliedRotationDegrees%360 == 0 {
+		return t, nil
+	}
+	if p.Width <= 0 || p.Height <= 0 {
+		return t, ErrNoDimensions
+	}
+	// The size of the submitted image is that of p, turned back.
+	width, height := p.Width, p.Height
+	if p.AppliedRotationDegrees%180 != 0 {
+		width, height = height, width
+	}
+	return RotateText(t, p.AppliedRotationDegrees, width, height), nil
+}
@@ -0,0 +1,97 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/siftrics/sight/internal/pdf"
+)
+
+// ParsePageRanges parses a comma-separated list of page numbers and ranges,
+// such as "1-3,7", into sorted, distinct page numbers for File.Pages.
+func ParsePageRanges(s string) ([]int, error) {
+	var pages []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		from, to := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			from, to = part[:i], part[i+1:]
+		}
+		first, err1 := strconv.Atoi(strings.TrimSpace(from))
+		last, err2 := strconv.Atoi(strings.TrimSpace(to))
+		if err1 != nil || err2 != nil || first < 1 || last < first {
+			return nil, fmt.Errorf("invalid page range %q; expected e.g. 1-3,7", part)
+		}
+		for p := first; p <= last; p++ {
+			pages = append(pages, p)
+		}
+	}
+	return uniquePages(pages), nil
+}
+
+// uniquePages sorts pages and removes duplicates, in place.
+func uniquePages(pages []int) []int {
+	sort.Ints(pages)
+	n := 0
+	for _, p := range pages {
+		if n == 0 || pages[n-1] != p {
+			pages[n] = p
+			n++
+		}
+	}
+	return pages[:n]
+}
+
+// selectPages returns the contents of f, the i-th file, cut down to the
+// pages in f.Pages, along with those page numbers sorted and deduplicated.
+func selectPages(f File, i int, mimeType string) ([]byte, []int, error) {
+	if mimeType != "application/pdf" {
+		return nil, nil, fmt.Errorf("pages of %v were selected, but only pages of PDFs can be selected", fileName(f, i))
+	}
+	pages := uniquePages(append([]int(nil), f.Pages...))
+	r, err := pdf.NewReader(f.Contents)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to select pages of %v: %v", fileName(f, i), err)
+	}
+	u, err := r.Select(pages)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to select pages of %v: %v", fileName(f, i), err)
+	}
+	var buf bytes.Buffer
+	if _, err := u.WriteTo(&buf); err != nil {
+		return nil, nil, fmt.Errorf("failed to select pages of %v: %v", fileName(f, i), err)
+	}
+	return buf.Bytes(), pages, nil
+}
+
+// originalPageNumber maps the number of a page of the PDF which was
+// submitted back to its number in the whole PDF, given the pages selected.
+func originalPageNumber(selected []int, pageNumber int) int {
+	if pageNumber < 1 || pageNumber > len(selected) {
+		return pageNumber
+	}
+	return selected[pageNumber-1]
+}
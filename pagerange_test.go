@@ -0,0 +1,137 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/internal/pdf"
+	"github.com/siftrics/sight/sighttest"
+)
+
+func TestParsePageRanges(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []int
+	}{
+		{"1", []int{1}},
+		{"1-3,7", []int{1, 2, 3, 7}},
+		{" 2 - 4 , 1 ", []int{1, 2, 3, 4}},
+		{"5,3-4,4,1-1", []int{1, 3, 4, 5}},
+		{"3-3", []int{3}},
+	}
+	for _, tt := range tests {
+		got, err := sight.ParsePageRanges(tt.s)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParsePageRanges(%q) = %v, %v; want %v", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "0", "-1", "3-1", "1-", "a", "1,,2", "1-2-3", "1;2"} {
+		if got, err := sight.ParsePageRanges(s); err == nil {
+			t.Errorf("ParsePageRanges(%q) = %v; want an error", s, got)
+		}
+	}
+}
+
+// testPDF returns a PDF of n empty pages.
+func testPDF(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	var offsets []int
+	object := func(format string, args ...interface{}) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%v 0 obj\n", len(offsets))
+		fmt.Fprintf(&buf, format, args...)
+		buf.WriteString("\nendobj\n")
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	var kids bytes.Buffer
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&kids, "%v 0 R ", i+3)
+	}
+	object("<< /Type /Pages /Kids [%v] /Count %v >>", kids.String(), n)
+	for i := 0; i < n; i++ {
+		object("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] >>")
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %v\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %v /Root 1 0 R >>\nstartxref\n%v\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+func TestFilePages(t *testing.T) {
+	srv := sighttest.NewServer()
+	defer srv.Close()
+	f := sight.File{Name: "a.pdf", MimeType: "application/pdf", Contents: testPDF(5), Pages: []int{4, 2, 4}}
+	pages, err := srv.Client().RecognizeFiles(sight.Config{}, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var numbers []int
+	for p := range pages {
+		if p.Error != "" {
+			t.Fatal(p.Error)
+		}
+		if p.NumberOfPagesInFile != 2 {
+			t.Errorf("page %v has NumberOfPagesInFile %v; want 2", p.PageNumber, p.NumberOfPagesInFile)
+		}
+		numbers = append(numbers, p.PageNumber)
+	}
+	sort.Ints(numbers)
+	if !reflect.DeepEqual(numbers, []int{2, 4}) {
+		t.Errorf("received pages %v; want 2 and 4", numbers)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 1 || len(requests[0].Files) != 1 {
+		t.Fatalf("server received %v requests; want 1 of 1 file", len(requests))
+	}
+	contents, err := base64.StdEncoding.DecodeString(requests[0].Files[0].Base64File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := pdf.NewReader(contents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.NumPages(); err != nil || n != 2 {
+		t.Errorf("submitted PDF has %v pages (%v); want 2", n, err)
+	}
+}
+
+func TestFilePagesOfImage(t *testing.T) {
+	srv := sighttest.NewServer()
+	defer srv.Close()
+	f := testImage(t)
+	f.Pages = []int{1}
+	if _, err := srv.Client().RecognizeFiles(sight.Config{}, f); err == nil {
+		t.Error("selected pages of an image")
+	}
+}
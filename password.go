@@ -0,0 +1,92 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/siftrics/sight/internal/pdf"
+)
+
+// pdfPasswords returns the passwords to try for the PDF f: the empty
+// password, which opens files encrypted only to restrict what may be done
+// with them, then those given for f by name, then those given for every
+// file.
+func pdfPasswords(cfg Config, f File) []string {
+	passwords := []string{""}
+	if f.Name != "" {
+		passwords = append(passwords, cfg.PDFPasswords[f.Name]...)
+	}
+	return append(passwords, cfg.PDFPasswords[""]...)
+}
+
+// openPDF reads the PDF contents, decrypting it with one of passwords if
+// it is encrypted.
+func openPDF(contents []byte, passwords []string) (*pdf.Reader, error) {
+	r, err := pdf.NewReader(contents)
+	if err != nil {
+		return nil, err
+	}
+	if err := decrypt(r, passwords); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// decrypt decrypts the PDF read by r with the first of passwords which
+// opens it, if it is encrypted.
+func decrypt(r *pdf.Reader, passwords []string) error {
+	if !r.Encrypted() {
+		return nil
+	}
+	for _, password := range passwords {
+		if err := r.Decrypt(password); err != pdf.ErrBadPassword {
+			return err
+		}
+	}
+	if len(passwords) > 1 {
+		return errors.New("the PDF is protected by a password, and none of those given for it opens it")
+	}
+	return errors.New("the PDF is protected by a password, and none was given for it")
+}
+
+// decryptPDF returns the contents of the PDF f, decrypted with one of the
+// passwords given for it in cfg.PDFPasswords if it is encrypted. The Sight
+// API cannot read encrypted PDFs. Files which cannot be parsed are returned
+// unchanged, for the Sight API to judge.
+func decryptPDF(cfg Config, f File) ([]byte, error) {
+	if !bytes.Contains(f.Contents, []byte("/Encrypt")) {
+		return f.Contents, nil
+	}
+	r, err := pdf.NewReader(f.Contents)
+	if err != nil || !r.Encrypted() {
+		return f.Contents, nil
+	}
+	if err := decrypt(r, pdfPasswords(cfg, f)); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := r.Rewrite(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
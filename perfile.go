@@ -0,0 +1,97 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"fmt"
+	"sync"
+)
+
+// recognizePerFile implements Config.OneJobPerFile: each distinct file is
+// submitted in a request of its own, which starts a job of its own, and the
+// pages of every job are sent on one channel. A file whose submission fails
+// is sent a page whose Error says why, unless every submission fails, in
+// which case the first error is returned.
+func (c *Client) recognizePerFile(cfg Config, files []File) (<-chan RecognizedPage, error) {
+	unique, copies := dedupFiles(files)
+	onJobStarted := cfg.OnJobStarted
+	channels := make([]<-chan RecognizedPage, len(unique))
+	var failed []RecognizedPage
+	var firstErr error
+	for u, f := range unique {
+		fileCfg := cfg
+		if onJobStarted != nil {
+			fileCopies := [][]int{copies[u]}
+			fileCfg.OnJobStarted = func(job Job) {
+				onJobStarted(job.withCopies(fileCopies))
+			}
+		}
+		if cfg.IdempotencyKey != "" {
+			fileCfg.IdempotencyKey = fmt.Sprintf("%v-%v", cfg.IdempotencyKey, u)
+		}
+		pages, err := c.recognizeStored(fileCfg, []File{f})
+		if err != nil {
+			c.logger.Warn("failed to submit a file", "file", fileName(f, copies[u][0]), "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			for _, i := range copies[u] {
+				failed = append(failed, RecognizedPage{
+					Error:               fmt.Sprintf("%v was not submitted: %v", fileName(files[i], i), err),
+					FileIndex:           i,
+					PageNumber:          1,
+					NumberOfPagesInFile: 1,
+					err:                 err,
+				})
+			}
+			continue
+		}
+		channels[u] = pages
+	}
+	if len(failed) == len(files) && firstErr != nil {
+		return nil, firstErr
+	}
+	pagesChan := make(chan RecognizedPage, 16)
+	var wg sync.WaitGroup
+	for u, pages := range channels {
+		if pages == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(u int, pages <-chan RecognizedPage) {
+			defer wg.Done()
+			for p := range pages {
+				for _, i := range copies[u] {
+					p.FileIndex = i
+					pagesChan <- p
+				}
+			}
+		}(u, pages)
+	}
+	go func() {
+		for _, p := range failed {
+			pagesChan <- p
+		}
+		wg.Wait()
+		close(pagesChan)
+	}()
+	return pagesChan, nil
+}
@@ -0,0 +1,210 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package pii finds personal data, such as email addresses and credit card
+// numbers, in recognized text, so that it can be reported, masked or
+// redacted:
+//
+//	for _, f := range pii.FindPage(page) {
+//		fmt.Printf("%v on page %v at (%v, %v)\n", f.Category, f.PageNumber, f.TopLeftX, f.TopLeftY)
+//	}
+//
+// Matches are checked where there is a checksum (credit card numbers and
+// IBANs) or a rule of issuance (SSNs), so that other numbers of the same
+// shape are not reported. Each finding has a bounding box estimated from
+// that of the text it is part of, as by sight.SubText.
+package pii
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/siftrics/sight"
+)
+
+// Category is a kind of personal data.
+type Category string
+
+const (
+	Email      Category = "email"
+	IBAN       Category = "iban"
+	CreditCard Category = "credit-card"
+	SSN        Category = "ssn"
+	Phone      Category = "phone"
+)
+
+// Categories are the built-in categories, in the order in which their
+// detectors take precedence over one another: where matches overlap, such
+// as the digits of an IBAN which look like a phone number, only the first
+// is reported.
+var Categories = []Category{Email, IBAN, CreditCard, SSN, Phone}
+
+// Detector finds personal data of one category in text.
+type Detector struct {
+	Category Category
+	pattern  *regexp.Regexp
+	// whole matches all of a candidate, for one shortened by find.
+	whole *regexp.Regexp
+	// valid, if set, rejects matches which are not personal data.
+	valid func(string) bool
+}
+
+// NewDetector returns a Detector of text matching pattern, as personal data
+// of category.
+func NewDetector(category Category, pattern *regexp.Regexp) Detector {
+	return newDetector(category, pattern, nil)
+}
+
+func newDetector(category Category, pattern *regexp.Regexp, valid func(string) bool) Detector {
+	return Detector{
+		Category: category,
+		pattern:  pattern,
+		whole:    regexp.MustCompile(`^(?:` + pattern.String() + `)$`),
+		valid:    valid,
+	}
+}
+
+var detectors = map[Category]Detector{
+	Email:      newDetector(Email, regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`), nil),
+	IBAN:       newDetector(IBAN, regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`), validIBAN),
+	CreditCard: newDetector(CreditCard, regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), validCardNumber),
+	SSN:        newDetector(SSN, regexp.MustCompile(`\b\d{3}[- ]\d{2}[- ]\d{4}\b`), validSSN),
+	Phone:      newDetector(Phone, regexp.MustCompile(`\+\d{1,3}(?:[ .-]?\(?\d{1,4}\)?){2,5}|\(?\b\d{3}\)?[ .-]?\d{3}[ .-]\d{4}\b`), validPhone),
+}
+
+// DetectorFor returns the Detector of a built-in category.
+func DetectorFor(c Category) (Detector, bool) {
+	d, ok := detectors[c]
+	return d, ok
+}
+
+// ParseCategories returns the detectors of a comma-delimited list of
+// built-in categories, e.g., "ssn,credit-card".
+func ParseCategories(s string) ([]Detector, error) {
+	var ds []Detector
+	for _, name := range strings.Split(s, ",") {
+		d, ok := detectors[Category(strings.TrimSpace(name))]
+		if !ok {
+			names := make([]string, len(Categories))
+			for i, c := range Categories {
+				names[i] = string(c)
+			}
+			return nil, fmt.Errorf("%q is not a category of personal data; expected %v", name, strings.Join(names, ", "))
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+// find returns the byte ranges of the personal data in s. A match which is
+// not valid is shortened to its last space or hyphen until it is, so that
+// a number which runs into the next is still found.
+func (d Detector) find(s string) [][2]int {
+	var found [][2]int
+	for _, m := range d.pattern.FindAllStringIndex(s, -1) {
+		for end := m[1]; end > m[0]; {
+			candidate := s[m[0]:end]
+			if d.whole.MatchString(candidate) && (d.valid == nil || d.valid(candidate)) {
+				found = append(found, [2]int{m[0], end})
+				break
+			}
+			i := strings.LastIndexAny(candidate, " -")
+			if i < 0 {
+				break
+			}
+			end = m[0] + i
+		}
+	}
+	return found
+}
+
+// Span is personal data found in a string, from the byte offset Start to
+// End.
+type Span struct {
+	Category   Category
+	Start, End int
+}
+
+// Find returns the personal data found in s by detectors, or by the
+// detectors of all built-in categories if none are given, in order. Where
+// matches overlap, that of the earlier detector is kept.
+func Find(s string, detectors ...Detector) []Span {
+	if len(detectors) == 0 {
+		detectors = builtin()
+	}
+	var spans []Span
+	for _, d := range detectors {
+	matches:
+		for _, m := range d.find(s) {
+			for _, sp := range spans {
+				if m[0] < sp.End && sp.Start < m[1] {
+					continue matches
+				}
+			}
+			spans = append(spans, Span{Category: d.Category, Start: m[0], End: m[1]})
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	return spans
+}
+
+func builtin() []Detector {
+	ds := make([]Detector, len(Categories))
+	for i, c := range Categories {
+		ds[i] = detectors[c]
+	}
+	return ds
+}
+
+// Finding is personal data found in a recognized page. Its RecognizedText
+// is the text found, with a bounding box estimated from that of the text
+// element it is part of, and the confidence of that element.
+type Finding struct {
+	Category   Category
+	FileIndex  int
+	PageNumber int
+	// TextIndex is the index of the element in the RecognizedText of the
+	// page, and Start and End the byte offsets of the finding in its Text.
+	TextIndex  int
+	Start, End int
+	sight.RecognizedText
+}
+
+// FindPage returns the personal data found in the recognized text of p by
+// detectors, as by Find.
+func FindPage(p sight.RecognizedPage, detectors ...Detector) []Finding {
+	var findings []Finding
+	for i, t := range p.RecognizedText {
+		for _, sp := range Find(t.Text, detectors...) {
+			findings = append(findings, Finding{
+				Category:       sp.Category,
+				FileIndex:      p.FileIndex,
+				PageNumber:     p.PageNumber,
+				TextIndex:      i,
+				Start:          sp.Start,
+				End:            sp.End,
+				RecognizedText: sight.SubText(t, sp.Start, sp.End),
+			})
+		}
+	}
+	return findings
+}
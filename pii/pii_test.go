@@ -0,0 +1,114 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pii
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/siftrics/sight"
+)
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []Span
+	}{
+		{"no personal data here", nil},
+		{"mail jane.doe@example.co.uk today", []Span{{Email, 5, 27}}},
+		{"IBAN GB82 WEST 1234 5698 7654 32.", []Span{{IBAN, 5, 32}}},
+		{"card 4111 1111 1111 1111 exp 12/29", []Span{{CreditCard, 5, 24}}},
+		// The Luhn check fails.
+		{"order 4111 1111 1111 1112", nil},
+		{"SSN 123-45-6789", []Span{{SSN, 4, 15}}},
+		{"SSN 666-45-6789", nil},
+		{"call (555) 123-4567 or +44 20 7946 0958", []Span{{Phone, 5, 19}, {Phone, 23, 39}}},
+		// A card number followed by more digits is shortened until it
+		// passes the Luhn check.
+		{"4111 1111 1111 1111 2024", []Span{{CreditCard, 0, 19}}},
+	}
+	for _, tt := range tests {
+		if got := Find(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Find(%q) = %v; want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestFindPrecedence(t *testing.T) {
+	// The digits of the IBAN would also match as a phone number, and the
+	// SSN as one too.
+	s := "DE89 3704 0044 0532 0130 00 and 123-45-6789"
+	want := []Span{{IBAN, 0, 27}, {SSN, 32, 43}}
+	if got := Find(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("Find(%q) = %v; want %v", s, got, want)
+	}
+	phone, _ := DetectorFor(Phone)
+	if got := Find("123-45-6789 555-123-4567", phone); !reflect.DeepEqual(got, []Span{{Phone, 12, 24}}) {
+		t.Errorf("Find with only the phone detector = %v; want the phone number", got)
+	}
+}
+
+func TestNewDetector(t *testing.T) {
+	d := NewDetector("employee-id", regexp.MustCompile(`\bE-\d{6}\b`))
+	want := []Span{{"employee-id", 9, 17}}
+	if got := Find("employee E-123456", d); !reflect.DeepEqual(got, want) {
+		t.Errorf("Find = %v; want %v", got, want)
+	}
+}
+
+func TestParseCategories(t *testing.T) {
+	ds, err := ParseCategories("ssn, credit-card")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ds) != 2 || ds[0].Category != SSN || ds[1].Category != CreditCard {
+		t.Errorf("ParseCategories returned %v detectors; want ssn and credit-card", len(ds))
+	}
+	if _, err := ParseCategories("ssn,passport"); err == nil {
+		t.Error("ParseCategories accepted an unknown category")
+	}
+}
+
+func TestFindPage(t *testing.T) {
+	p := sight.RecognizedPage{
+		FileIndex:  1,
+		PageNumber: 2,
+		RecognizedText: []sight.RecognizedText{
+			{Text: "Name: Jane Doe"},
+			{Text: "SSN: 123-45-6789", TopLeftX: 0, TopRightX: 160, BottomRightX: 160, BottomLeftX: 0, BottomLeftY: 20, BottomRightY: 20, Confidence: 0.9},
+		},
+	}
+	findings := FindPage(p)
+	if len(findings) != 1 {
+		t.Fatalf("FindPage found %v; want the SSN", findings)
+	}
+	f := findings[0]
+	if f.Category != SSN || f.FileIndex != 1 || f.PageNumber != 2 || f.TextIndex != 1 || f.Start != 5 || f.End != 16 {
+		t.Errorf("FindPage found %+v; want the SSN in text 1 from 5 to 16", f)
+	}
+	if f.Text != "123-45-6789" || f.Confidence != 0.9 {
+		t.Errorf("finding has text %q and confidence %v; want %q and 0.9", f.Text, f.Confidence, "123-45-6789")
+	}
+	if f.TopLeftX <= 0 || f.TopRightX > 160 {
+		t.Errorf("finding spans x %v to %v; want within the right of the text element", f.TopLeftX, f.TopRightX)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package pii
+
+import "testing"
+
+func TestValidCardNumber(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"4111 1111 1111 1111", true},
+		{"4111-1111-1111-1111", true},
+		{"378282246310005", true},
+		{"6011 0009 9013 9424", true},
+		{"4111 1111 1111 1112", false},
+		// The Luhn check alone passes, but the number is too short.
+		{"4111 1111 1117", false},
+		{"41111111111111111111", false},
+	}
+	for _, tt := range tests {
+		if got := validCardNumber(tt.s); got != tt.want {
+			t.Errorf("validCardNumber(%q) = %v; want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestValidIBAN(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"GB82 WEST 1234 5698 7654 32", true},
+		{"GB82WEST12345698765432", true},
+		{"DE89 3704 0044 0532 0130 00", true},
+		{"NO93 8601 1117 947", true},
+		{"GB82 WEST 1234 5698 7654 33", false},
+		{"GB28 WEST 1234 5698 7654 32", false},
+		{"gb82 west 1234 5698 7654 32", false},
+		{"DE89 3704 0044", false},
+	}
+	for _, tt := range tests {
+		if got := validIBAN(tt.s); got != tt.want {
+			t.Errorf("validIBAN(%q) = %v; want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestValidSSN(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"123-45-6789", true},
+		{"123 45 6789", true},
+		{"123-45 6789", false},
+		{"000-45-6789", false},
+		{"666-45-6789", false},
+		{"900-45-6789", false},
+		{"123-00-6789", false},
+		{"123-45-0000", false},
+	}
+	for _, tt := range tests {
+		if got := validSSN(tt.s); got != tt.want {
+			t.Errorf("validSSN(%q) = %v; want %v", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestValidPhone(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"555-0100", true},
+		{"(555) 123-4567", true},
+		{"+44 20 7946 0958", true},
+		{"+1 234 567 890 123 456", false},
+		{"12-34", false},
+	}
+	for _, tt := range tests {
+		if got := validPhone(tt.s); got != tt.want {
+			t.Errorf("validPhone(%q) = %v; want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// PingResult is the outcome of a successful Ping.
+type PingResult struct {
+	// Latency is how long the request took.
+	Latency time.Duration
+	// APIVersion is the version of the Sight API, from the X-API-Version
+	// header of its response, or empty if it did not report one.
+	APIVersion string
+	RateLimit  RateLimitStatus
+}
+
+// Ping checks that the Sight API can be reached and accepts the Client's
+// API key, without submitting anything, so that it is not billed. It is
+// meant for health checks. The error is ErrUnauthorized if the key was
+// rejected.
+func (c *Client) Ping(ctx context.Context) (PingResult, error) {
+	requestID := newRequestID()
+	url := strings.TrimSuffix(c.endpoint, "/") + "/usage"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return PingResult{}, err
+	}
+	c.waitForRateLimit(0, requestID)
+	c.logger.Debug("pinging the Sight API", "request", requestID, "url", url)
+	start := time.Now()
+	resp, err := c.do(req, 0)
+	if err != nil {
+		c.logger.Error("ping failed", "request", requestID, "error", err)
+		return PingResult{}, err
+	}
+	defer resp.Body.Close()
+	defer drain(resp.Body)
+	result := PingResult{Latency: time.Since(start), APIVersion: resp.Header.Get("X-API-Version")}
+	if rl, ok := rateLimitStatus(resp.Header); ok {
+		result.RateLimit = rl
+	}
+	switch {
+	case resp.StatusCode == 401:
+		return result, ErrUnauthorized
+	case resp.StatusCode != 200:
+		return result, fmt.Errorf("Non-200 response from ping to the Sight API. Status: %v.", resp.StatusCode)
+	}
+	return result, nil
+}
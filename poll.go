@@ -0,0 +1,406 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnauthorized is the error of polling for a job, or of Ping or
+	// Usage, when the Sight API rejects the API key, e.g., because it was
+	// revoked.
+	ErrUnauthorized = errors.New("the API key was rejected")
+	// ErrJobExpired is the error of polling for a job which the Sight API
+	// no longer knows of, e.g., because its results expired.
+	ErrJobExpired = errors.New("the job was not found; its results may have expired")
+	// ErrJobDeadline is the error of polling for a job which did not
+	// finish before Config.JobDeadline.
+	ErrJobDeadline = errors.New("the job did not finish before its deadline")
+)
+
+// PollError is a failure to poll for the results of a job. Temporary
+// failures, such as network errors and server errors, are retried with
+// backoff; polling is given up on after a fatal failure, or after too many
+// temporary failures in a row. Pages sent in place of those which were not
+// received then carry the PollError; see RecognizedPage.Err.
+type PollError struct {
+	// URL is the URL of the job.
+	URL string
+	// StatusCode is the status of the response, or 0 if none was
+	// received.
+	StatusCode int
+	// Err is what went wrong: ErrUnauthorized, ErrJobExpired, or another
+	// error such as that of the network.
+	Err error
+	// RequestID is the X-Request-Id header of the response, or empty if
+	// none was received or it had none.
+	RequestID string
+
+	temporary bool
+}
+
+func (e *PollError) Error() string {
+	msg := fmt.Sprintf("polling %v: %v", e.URL, e.Err)
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf("polling %v: status %v: %v", e.URL, e.StatusCode, e.Err)
+	}
+	if e.RequestID != "" {
+		msg += fmt.Sprintf(" (request ID %v)", e.RequestID)
+	}
+	return msg
+}
+
+func (e *PollError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether polling again may succeed: whether the request
+// failed without a response, was rate limited, met an error of the server
+// (5xx) or received a response which could not be decoded.
+func (e *PollError) Temporary() bool {
+	return e.temporary
+}
+
+const (
+	// pollInterval is the time between polling requests for a job, unless
+	// its Poller spaces them out further.
+	pollInterval = 500 * time.Millisecond
+	// maxPollFailures is the number of temporary failures in a row after
+	// which polling is given up on.
+	maxPollFailures = 10
+)
+
+// maxPollBackoff is the longest time between polling requests after
+// temporary failures. It is a variable so that tests need not wait for it.
+var maxPollBackoff = 30 * time.Second
+
+// pollLimits bounds polling for a job; see Config.RequestTimeout and
+// Config.JobDeadline. Polling is also given up on once ctx, if it is not
+// nil, is done. The zero value sets no bounds.
+type pollLimits struct {
+	requestTimeout time.Duration
+	deadline       time.Time
+	ctx            context.Context
+}
+
+// context returns l.ctx, or the background context if it is nil.
+func (l pollLimits) context() context.Context {
+	if l.ctx == nil {
+		return context.Background()
+	}
+	return l.ctx
+}
+
+// expireWithin reports whether the deadline passes within d.
+func (l pollLimits) expireWithin(d time.Duration) bool {
+	return !l.deadline.IsZero() && time.Now().Add(d).After(l.deadline)
+}
+
+// clamp returns d, shortened so that it ends at the deadline. ok is false if
+// the deadline has passed.
+func (l pollLimits) clamp(d time.Duration) (_ time.Duration, ok bool) {
+	if l.deadline.IsZero() {
+		return d, true
+	}
+	left := time.Until(l.deadline)
+	if left <= 0 {
+		return 0, false
+	}
+	if d > left {
+		d = left
+	}
+	return d, true
+}
+
+// sleep waits for d, or until ctx is done. It reports whether it waited
+// for all of d.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// pollJob polls for the results of job until every page of its files has
+// been received, sending them to pagesChan and then closing it.
+// fileIndex2HaveSeenPage records the pages already received, indexed by
+// the FileIndex and PageNumber reported by the Sight API. If polling is
+// given up on, a page with JobFailed set is sent for each page which was
+// not received; see abandonJob. onPoll, if not nil, is called after each
+// polling request; see Config.OnPoll.
+func (c *Client) pollJob(job Job, fileIndex2HaveSeenPage map[int][]bool, requestID string, limits pollLimits, onPoll func(attempt, status int), pagesChan chan<- RecognizedPage) {
+	log := c.logger
+	log.Info("polling for results", "request", requestID, "url", job.URL)
+	c.poller.begin()
+	defer c.poller.end()
+	failures, rateLimited := 0, 0
+	wait := c.poller.interval()
+	ctx := limits.context()
+	for attempt := 1; ; attempt++ {
+		var ok bool
+		if wait, ok = limits.clamp(wait); !ok {
+			err := &PollError{URL: job.URL, Err: ErrJobDeadline}
+			log.Error("polling did not finish before the deadline; giving up", "request", requestID, "attempt", attempt)
+			c.abandonJob(job, fileIndex2HaveSeenPage, err, fmt.Sprintf("gave up polling for results: %v", err.Err), pagesChan)
+			return
+		}
+		if !sleep(ctx, wait) {
+			err := &PollError{URL: job.URL, Err: ctx.Err()}
+			log.Warn("the context of the job is done; giving up polling", "request", requestID, "attempt", attempt, "error", err.Err)
+			c.abandonJob(job, fileIndex2HaveSeenPage, err, fmt.Sprintf("gave up polling for results: %v", err.Err), pagesChan)
+			return
+		}
+		wait = c.poller.interval()
+		c.waitForRateLimit(0, requestID)
+		// Pages are sent on as they are decoded, so that a response with
+		// hundreds of pages is never held in memory at once.
+		numPages := 0
+		resp, err := c.poll(ctx, job.URL, job.key, limits.requestTimeout, func(p RecognizedPage) {
+			numPages++
+			haveSeenPage, ok := fileIndex2HaveSeenPage[p.FileIndex]
+			if (!ok || len(haveSeenPage) == 0) && p.NumberOfPagesInFile >= 0 {
+				haveSeenPage = make([]bool, p.NumberOfPagesInFile)
+				fileIndex2HaveSeenPage[p.FileIndex] = haveSeenPage
+			}
+			if p.PageNumber > 0 && p.PageNumber <= len(haveSeenPage) {
+				haveSeenPage[p.PageNumber-1] = true
+			} else if p.PageNumber != 0 {
+				// The page is sent on, but cannot be told apart from
+				// the pages still to come.
+				log.Warn("the Sight API sent a page whose number is out of range", "request", requestID, "file", p.FileIndex, "page", p.PageNumber, "pages", p.NumberOfPagesInFile)
+			}
+			if p.FileIndex >= 0 && p.FileIndex < len(job.FileIndices) {
+				p.PageNumber = originalPageNumber(job.Selections[p.FileIndex], p.PageNumber)
+				p.FileIndex = job.FileIndices[p.FileIndex]
+			}
+			p.JobID = job.ID
+			job.received(&p)
+			fillDimensions(&p)
+			if p.Error != "" {
+				// The page is sent on with its Error, but a consumer
+				// which only counts pages would never see why.
+				log.Info("the Sight API reported an error for a page", "request", requestID, "file", p.FileIndex, "page", p.PageNumber, "error", p.Error)
+			}
+			pagesChan <- p
+		})
+		if onPoll != nil {
+			status := 0
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			onPoll(attempt, status)
+		}
+		if err != nil && resp != nil && resp.StatusCode == 429 {
+			// Being rate limited is not a failure; it only means waiting.
+			wait = retryAfter(resp, rateLimited)
+			rateLimited++
+			log.Warn("polling was rate limited by the Sight API; waiting", "request", requestID, "attempt", attempt, "wait", wait)
+			continue
+		}
+		rateLimited = 0
+		if err != nil && !err.Temporary() {
+			log.Error("polling failed; giving up", "request", requestID, "attempt", attempt, "error", err)
+			c.abandonJob(job, fileIndex2HaveSeenPage, err, fmt.Sprintf("gave up polling for results: %v", err.Err), pagesChan)
+			return
+		}
+		if err != nil {
+			failures++
+			if failures >= maxPollFailures {
+				log.Error("giving up polling after too many errors", "request", requestID, "attempt", attempt, "error", err)
+				c.abandonJob(job, fileIndex2HaveSeenPage, err, fmt.Sprintf("gave up polling for results after %v errors in a row; the last was: %v", failures, err), pagesChan)
+				return
+			}
+			wait = pollInterval << uint(failures)
+			if wait > maxPollBackoff {
+				wait = maxPollBackoff
+			}
+			log.Warn("polling failed; trying again", "request", requestID, "attempt", attempt, "errors", failures, "wait", wait, "error", err)
+			continue
+		}
+		failures = 0
+		log.Debug("polled for results", "request", requestID, "attempt", attempt, "status", resp.StatusCode, "pages", numPages)
+		if haveSeenEverything(fileIndex2HaveSeenPage, len(job.FileIndices)) {
+			log.Info("received all pages", "request", requestID, "attempts", attempt)
+			close(pagesChan)
+			return
+		}
+	}
+}
+
+// poll makes one polling request for the job at url, with key if it is not
+// empty (see Job.key), which times out after timeout if it is positive, and
+// calls page with each page of the response as it is decoded. resp is the
+// response, whose body has been read and closed, if one was received. If
+// the response is cut short or malformed, the pages before the fault have
+// already been passed to page. The request is canceled if ctx is done.
+func (c *Client) poll(ctx context.Context, url, key string, timeout time.Duration, page func(RecognizedPage)) (*http.Response, *PollError) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, &PollError{URL: url, Err: err}
+	}
+	if key != "" {
+		req = req.WithContext(withAPIKey(req.Context(), key))
+	}
+	c.poller.acquire()
+	resp, err := c.do(req, timeout)
+	c.poller.release()
+	if err != nil {
+		return nil, &PollError{URL: url, Err: err, temporary: true}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		defer drain(resp.Body)
+	}
+	requestID := resp.Header.Get(requestIDHeader)
+	switch code := resp.StatusCode; {
+	case code == 200:
+	case code == 401:
+		return resp, &PollError{URL: url, StatusCode: code, Err: ErrUnauthorized, RequestID: requestID}
+	case code == 404:
+		return resp, &PollError{URL: url, StatusCode: code, Err: ErrJobExpired, RequestID: requestID}
+	case code == 429 || code >= 500:
+		return resp, &PollError{URL: url, StatusCode: code, Err: errors.New(http.StatusText(code)), RequestID: requestID, temporary: true}
+	default:
+		return resp, &PollError{URL: url, StatusCode: code, Err: errors.New(http.StatusText(code)), RequestID: requestID}
+	}
+	err = decodePages(json.NewDecoder(resp.Body), func(p RecognizedPage) {
+		p.RequestID = requestID
+		page(p)
+	})
+	if err != nil {
+		return resp, &PollError{URL: url, StatusCode: resp.StatusCode, Err: fmt.Errorf("invalid response: %v", err), RequestID: requestID, temporary: true}
+	}
+	drain(resp.Body)
+	return resp, nil
+}
+
+// decodePages decodes a polling response, {"Pages":[...]}, from dec,
+// calling page with each page as soon as it is decoded rather than once
+// the whole response has been. Other fields are skipped. Field names are
+// matched without regard to case, as by json.Unmarshal.
+func decodePages(dec *json.Decoder, page func(RecognizedPage)) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key, _ := tok.(string); !strings.EqualFold(key, "Pages") {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		tok, err = dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == nil {
+			continue
+		}
+		if tok != json.Delim('[') {
+			return fmt.Errorf("Pages is %v, not an array", tok)
+		}
+		for dec.More() {
+			var p RecognizedPage
+			if err := dec.Decode(&p); err != nil {
+				return err
+			}
+			page(p)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+// expectDelim reads the next token of dec, which must be delim.
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, found %v", delim, tok)
+	}
+	return nil
+}
+
+// abandonJob sends a page with JobFailed set, err as its Err and reason as
+// its Error for each page of job which has not been received, and closes
+// pagesChan, so that a job which was given up on cannot be mistaken for a
+// finished one.
+// The number of pages of a file none of whose pages were received is not
+// known unless pages were selected from it, so otherwise a single page,
+// numbered 1 of 0, is sent for it.
+func (c *Client) abandonJob(job Job, fileIndex2HaveSeenPage map[int][]bool, err *PollError, reason string, pagesChan chan<- RecognizedPage) {
+	for j, fileIndex := range job.FileIndices {
+		haveSeenPage := fileIndex2HaveSeenPage[j]
+		if len(haveSeenPage) == 0 && len(job.Selections[j]) != 0 {
+			haveSeenPage = make([]bool, len(job.Selections[j]))
+		}
+		if len(haveSeenPage) == 0 {
+			pagesChan <- RecognizedPage{
+				Error:       reason,
+				FileIndex:   fileIndex,
+				PageNumber:  originalPageNumber(job.Selections[j], 1),
+				JobFailed:   true,
+				RequestID:   err.RequestID,
+				JobID:       job.ID,
+				SubmittedAt: job.SubmittedAt,
+				err:         err,
+			}
+			continue
+		}
+		for k, seen := range haveSeenPage {
+			if seen {
+				continue
+			}
+			pagesChan <- RecognizedPage{
+				Error:               reason,
+				FileIndex:           fileIndex,
+				PageNumber:          originalPageNumber(job.Selections[j], k+1),
+				NumberOfPagesInFile: len(haveSeenPage),
+				JobFailed:           true,
+				RequestID:           err.RequestID,
+				JobID:               job.ID,
+				SubmittedAt:         job.SubmittedAt,
+				err:                 err,
+			}
+		}
+	}
+	close(pagesChan)
+}
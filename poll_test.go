@@ -0,0 +1,342 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// onePage is a polling response with the only page of a job of one file.
+const onePage = `{"Pages":[{"FileIndex":0,"PageNumber":1,"NumberOfPagesInFile":1,"RecognizedText":[{"Text":"page 1"}]}]}`
+
+// pollServer is a job whose polling requests are answered by respond,
+// which is passed the number of the request, from 1.
+type pollServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	polls int
+}
+
+func newPollServer(respond func(n int, w http.ResponseWriter)) *pollServer {
+	s := &pollServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.polls++
+		n := s.polls
+		s.mu.Unlock()
+		respond(n, w)
+	}))
+	return s
+}
+
+func (s *pollServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.polls
+}
+
+// resume polls for the job of s, of one file, and returns the pages sent.
+func (s *pollServer) resume(t *testing.T) []RecognizedPage {
+	t.Helper()
+	job := Job{URL: s.URL, FileIndices: []int{0}, Selections: [][]int{nil}}
+	pagesChan, err := NewClient("key").ResumeJob(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages []RecognizedPage
+	for p := range pagesChan {
+		pages = append(pages, p)
+	}
+	return pages
+}
+
+// shortBackoff shortens the backoff after temporary failures for the rest
+// of the test.
+func shortBackoff(t *testing.T) {
+	backoff := maxPollBackoff
+	maxPollBackoff = time.Millisecond
+	t.Cleanup(func() { maxPollBackoff = backoff })
+}
+
+// pollError returns the PollError of a page sent in place of one which was
+// not received.
+func pollError(t *testing.T, pages []RecognizedPage) *PollError {
+	t.Helper()
+	if len(pages) != 1 || !pages[0].JobFailed {
+		t.Fatalf("received %+v, want a single page with JobFailed set", pages)
+	}
+	var err *PollError
+	if !errors.As(pages[0].Err(), &err) {
+		t.Fatalf("page has error %v, want a *PollError", pages[0].Err())
+	}
+	return err
+}
+
+func TestPollErrorStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		err       error
+		temporary bool
+	}{
+		{http.StatusUnauthorized, ErrUnauthorized, false},
+		{http.StatusNotFound, ErrJobExpired, false},
+		{http.StatusBadRequest, nil, false},
+		{http.StatusForbidden, nil, false},
+		{http.StatusGone, nil, false},
+		{http.StatusTooManyRequests, nil, true},
+		{http.StatusInternalServerError, nil, true},
+		{http.StatusBadGateway, nil, true},
+		{http.StatusServiceUnavailable, nil, true},
+		{http.StatusGatewayTimeout, nil, true},
+	}
+	c := NewClient("key")
+	for _, tt := range tests {
+		s := newPollServer(func(n int, w http.ResponseWriter) {
+			w.Header().Set(requestIDHeader, "req-1")
+			http.Error(w, "failed", tt.status)
+		})
+		resp, err := c.poll(context.Background(), s.URL, "", 0, func(RecognizedPage) {})
+		s.Close()
+		if err == nil {
+			t.Errorf("status %v: no error", tt.status)
+			continue
+		}
+		if resp == nil || err.StatusCode != tt.status || err.RequestID != "req-1" || err.Temporary() != tt.temporary {
+			t.Errorf("status %v: %v with status %v, request ID %q, temporary %v; want temporary %v",
+				tt.status, err, err.StatusCode, err.RequestID, err.Temporary(), tt.temporary)
+		}
+		if tt.err != nil && !errors.Is(err, tt.err) {
+			t.Errorf("status %v: %v, want %v", tt.status, err, tt.err)
+		}
+	}
+}
+
+func TestPollErrorNoResponse(t *testing.T) {
+	s := newPollServer(func(int, http.ResponseWriter) {})
+	s.Close()
+	resp, err := NewClient("key").poll(context.Background(), s.URL, "", 0, func(RecognizedPage) {})
+	if resp != nil || err == nil || err.StatusCode != 0 || !err.Temporary() {
+		t.Errorf("polling a closed server = %v, %v; want a temporary error without a response", resp, err)
+	}
+}
+
+func TestPollRateLimited(t *testing.T) {
+	// More responses are rate limited than the temporary failures after
+	// which polling is given up on, but being rate limited is not a
+	// failure.
+	s := newPollServer(func(n int, w http.ResponseWriter) {
+		if n <= maxPollFailures+2 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, onePage)
+	})
+	defer s.Close()
+	pages := s.resume(t)
+	if len(pages) != 1 || pages[0].Err() != nil || pages[0].PageNumber != 1 {
+		t.Errorf("received %+v, want page 1", pages)
+	}
+	if n := s.count(); n != maxPollFailures+3 {
+		t.Errorf("polled %v times, want %v", n, maxPollFailures+3)
+	}
+}
+
+func TestPollTemporaryFailures(t *testing.T) {
+	shortBackoff(t)
+	s := newPollServer(func(n int, w http.ResponseWriter) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	defer s.Close()
+	err := pollError(t, s.resume(t))
+	if err.StatusCode != http.StatusServiceUnavailable || !err.Temporary() {
+		t.Errorf("page has error %v, want a temporary failure with status 503", err)
+	}
+	if n := s.count(); n != maxPollFailures {
+		t.Errorf("polled %v times, want %v", n, maxPollFailures)
+	}
+}
+
+func TestPollFailuresReset(t *testing.T) {
+	// Temporary failures only count while they are in a row.
+	shortBackoff(t)
+	s := newPollServer(func(n int, w http.ResponseWriter) {
+		switch {
+		case n == 3*maxPollFailures:
+			fmt.Fprint(w, onePage)
+		case n%maxPollFailures == 0:
+			fmt.Fprint(w, `{"Pages":[]}`)
+		default:
+			http.Error(w, "failed", http.StatusInternalServerError)
+		}
+	})
+	defer s.Close()
+	pages := s.resume(t)
+	if len(pages) != 1 || pages[0].Err() != nil {
+		t.Errorf("received %+v, want page 1", pages)
+	}
+	if n := s.count(); n != 3*maxPollFailures {
+		t.Errorf("polled %v times, want %v", n, 3*maxPollFailures)
+	}
+}
+
+func TestPollPermanentFailure(t *testing.T) {
+	s := newPollServer(func(n int, w http.ResponseWriter) {
+		http.Error(w, "no such job", http.StatusNotFound)
+	})
+	defer s.Close()
+	err := pollError(t, s.resume(t))
+	if !errors.Is(err, ErrJobExpired) || err.Temporary() {
+		t.Errorf("page has error %v, want %v", err, ErrJobExpired)
+	}
+	if n := s.count(); n != 1 {
+		t.Errorf("polled %v times, want 1", n)
+	}
+}
+
+// pageJSON returns page n of a job of one file of pages pages.
+func pageJSON(n, pages int) string {
+	return fmt.Sprintf(`{"FileIndex":0,"PageNumber":%v,"NumberOfPagesInFile":%v,"RecognizedText":[{"Text":"page %v"}]}`, n, pages, n)
+}
+
+func TestDecodePages(t *testing.T) {
+	tests := []struct {
+		body  string
+		pages []int
+		err   bool
+	}{
+		{`{"Pages":[` + pageJSON(1, 2) + `,` + pageJSON(2, 2) + `]}`, []int{1, 2}, false},
+		// Other fields are skipped, and names are matched without
+		// regard to case.
+		{`{"Status":{"done":[1,2]},"pages":[` + pageJSON(1, 1) + `],"Next":null}`, []int{1}, false},
+		{`{"Pages":null}`, nil, false},
+		{`{"Pages":[]}`, nil, false},
+		{`{}`, nil, false},
+		{`{"Pages":3}`, nil, true},
+		{`[]`, nil, true},
+		{`{"Pages":[` + pageJSON(1, 2) + `,{"PageNumber":"two"}]}`, []int{1}, true},
+		// A body cut short: the pages before the cut are passed on.
+		{`{"Pages":[` + pageJSON(1, 2) + `,{"FileIndex":0,"Page`, []int{1}, true},
+		{`{"Pages":[` + pageJSON(1, 2), []int{1}, true},
+		{``, nil, true},
+	}
+	for _, tt := range tests {
+		var got []int
+		err := decodePages(json.NewDecoder(strings.NewReader(tt.body)), func(p RecognizedPage) {
+			got = append(got, p.PageNumber)
+		})
+		if !reflect.DeepEqual(got, tt.pages) || (err != nil) != tt.err {
+			t.Errorf("decodePages(%#q) passed pages %v, error %v; want %v, error %v", tt.body, got, err, tt.pages, tt.err)
+		}
+	}
+}
+
+func TestPollStreamsPages(t *testing.T) {
+	// The response is written a few bytes at a time, so that pages are
+	// split across reads, and the rest of it only once the first page has
+	// been passed on.
+	first := make(chan struct{})
+	s := newPollServer(func(n int, w http.ResponseWriter) {
+		write := func(s string) {
+			for len(s) > 0 {
+				k := 7
+				if k > len(s) {
+					k = len(s)
+				}
+				fmt.Fprint(w, s[:k])
+				w.(http.Flusher).Flush()
+				s = s[k:]
+			}
+		}
+		write(`{"Pages":[` + pageJSON(1, 2) + `,`)
+		select {
+		case <-first:
+		case <-time.After(5 * time.Second):
+		}
+		write(pageJSON(2, 2) + `]}`)
+	})
+	defer s.Close()
+	var got []string
+	_, err := NewClient("key").poll(context.Background(), s.URL, "", 0, func(p RecognizedPage) {
+		got = append(got, p.RecognizedText[0].Text)
+		if p.PageNumber == 1 {
+			close(first)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"page 1", "page 2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("passed %q, want %q", got, want)
+	}
+}
+
+func TestPollTruncated(t *testing.T) {
+	s := newPollServer(func(n int, w http.ResponseWriter) {
+		fmt.Fprint(w, `{"Pages":[`+pageJSON(1, 2)+`,{"FileIndex":0,"Page`)
+	})
+	defer s.Close()
+	n := 0
+	_, err := NewClient("key").poll(context.Background(), s.URL, "", 0, func(RecognizedPage) { n++ })
+	if err == nil || !err.Temporary() || err.StatusCode != 200 {
+		t.Errorf("polling a truncated response = %v, want a temporary error", err)
+	}
+	if n != 1 {
+		t.Errorf("passed %v pages, want the 1 before the truncation", n)
+	}
+}
+
+func TestPollPageNumberOutOfRange(t *testing.T) {
+	s := newPollServer(func(n int, w http.ResponseWriter) {
+		switch n {
+		case 1:
+			fmt.Fprint(w, `{"Pages":[`+pageJSON(1, -1)+`,`+pageJSON(5, 1)+`,`+pageJSON(-1, 1)+`]}`)
+		default:
+			fmt.Fprint(w, onePage)
+		}
+	})
+	defer s.Close()
+	var got []int
+	for _, p := range s.resume(t) {
+		if p.JobFailed {
+			t.Errorf("page %v has JobFailed set: %v", p.PageNumber, p.Err())
+		}
+		got = append(got, p.PageNumber)
+	}
+	// The pages out of range are sent on, and polling goes on until the
+	// pages in range have been received.
+	if want := []int{1, 5, -1, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("received pages %v, want %v", got, want)
+	}
+	if n := s.count(); n != 2 {
+		t.Errorf("polled %v times, want 2", n)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"sync"
+	"time"
+)
+
+// A Poller schedules the polling requests of every job in flight, so that
+// hundreds of jobs, such as those of a large batch submitted one file at a
+// time, do not poll the Sight API all at once. It bounds the number of
+// polling requests awaiting a response at once and the number made per
+// second, and lengthens the interval at which each job is polled as more
+// jobs are in flight, so that the jobs take turns rather than queueing for
+// the rate limit. A Poller may be shared by several Clients (see
+// WithPoller), and is safe for concurrent use.
+type Poller struct {
+	// slots holds a token for each polling request awaiting a response,
+	// or is nil if their number is not bounded.
+	slots chan struct{}
+	// rate is nil if the rate of polling requests is not limited.
+	rate      *tokenBucket
+	perSecond float64
+
+	mu   sync.Mutex
+	jobs int
+}
+
+// NewPoller returns a Poller which lets at most maxConcurrent polling
+// requests await a response at once and makes at most pollsPerSecond
+// polling requests per second. Either may be 0 for no limit.
+func NewPoller(maxConcurrent int, pollsPerSecond float64) *Poller {
+	p := &Poller{}
+	if maxConcurrent > 0 {
+		p.slots = make(chan struct{}, maxConcurrent)
+	}
+	if pollsPerSecond > 0 {
+		p.rate = newTokenBucket(pollsPerSecond, 1)
+		p.perSecond = pollsPerSecond
+	}
+	return p
+}
+
+// WithPoller makes the Client schedule its polling requests with p. By
+// default each Client has a Poller of its own which sets no limits, so that
+// each job is polled every half second.
+func WithPoller(p *Poller) Option {
+	return func(c *Client) {
+		c.poller = p
+	}
+}
+
+// begin and end count the jobs being polled for.
+func (p *Poller) begin() {
+	p.mu.Lock()
+	p.jobs++
+	p.mu.Unlock()
+}
+
+func (p *Poller) end() {
+	p.mu.Lock()
+	p.jobs--
+	p.mu.Unlock()
+}
+
+// interval returns how long a job waits between polling requests: long
+// enough for every job in flight to be polled once in that time within the
+// rate limit, but no less than pollInterval.
+func (p *Poller) interval() time.Duration {
+	if p.rate == nil {
+		return pollInterval
+	}
+	p.mu.Lock()
+	jobs := p.jobs
+	p.mu.Unlock()
+	if d := time.Duration(float64(jobs) / p.perSecond * float64(time.Second)); d > pollInterval {
+		return d
+	}
+	return pollInterval
+}
+
+// acquire blocks until a polling request may be sent. release must be
+// called once its response has been received, or it has failed. The slot
+// is not held while the body of the response is read, so that a job whose
+// pages are not being consumed cannot hold up the others.
+func (p *Poller) acquire() {
+	if p.slots != nil {
+		p.slots <- struct{}{}
+	}
+	if p.rate != nil {
+		if wait := p.rate.reserve(1); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+}
+
+func (p *Poller) release() {
+	if p.slots != nil {
+		<-p.slots
+	}
+}
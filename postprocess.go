@@ -0,0 +1,77 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+// PostProcessor transforms each page sent by RecognizeFiles, e.g., to
+// normalize, correct or filter its text. See Config.PostProcessors.
+//
+// Process is given a copy of the RecognizedText of the page, which it may
+// modify in place, so that copies of the page sent for duplicate files are
+// not affected. It may remove text elements, but not the page itself, as
+// every page of every file is sent. Pages are processed one at a time, in
+// the order in which they are sent.
+type PostProcessor interface {
+	Process(p RecognizedPage) RecognizedPage
+}
+
+// PostProcessorFunc is a function which is a PostProcessor.
+type PostProcessorFunc func(p RecognizedPage) RecognizedPage
+
+func (f PostProcessorFunc) Process(p RecognizedPage) RecognizedPage {
+	return f(p)
+}
+
+// postProcessors returns the PostProcessors which implement cfg, followed
+// by cfg.PostProcessors.
+func (c *Client) postProcessors(cfg Config, files []File) []PostProcessor {
+	var processors []PostProcessor
+	if cfg.DetectBarcodes {
+		processors = append(processors, c.barcodeDetector(cfg, files))
+	}
+	if len(cfg.Vocabulary) > 0 {
+		processors = append(processors, NewVocabulary(cfg.Vocabulary))
+	}
+	if cfg.DetectLanguage {
+		processors = append(processors, PostProcessorFunc(detectLanguages))
+	}
+	if cfg.RotatedImageWriter != nil {
+		processors = append(processors, c.rotatedImageWriter(cfg.RotatedImageWriter))
+	}
+	return append(processors, cfg.PostProcessors...)
+}
+
+// postProcess applies processors, in order, to each page from in.
+func postProcess(processors []PostProcessor, in <-chan RecognizedPage) <-chan RecognizedPage {
+	out := make(chan RecognizedPage, 16)
+	go func() {
+		for p := range in {
+			// The text elements may be shared with copies of the page
+			// sent for duplicate files, so they are copied.
+			p.RecognizedText = append([]RecognizedText(nil), p.RecognizedText...)
+			for _, pp := range processors {
+				p = pp.Process(p)
+			}
+			out <- p
+		}
+		close(out)
+	}()
+	return out
+}
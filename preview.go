@@ -0,0 +1,136 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"math"
+)
+
+// ErrNoPageImage is returned by PagePreview for a page of a PDF which has no
+// auto-rotated image, as PDFs are not rendered by this package.
+var ErrNoPageImage = errors.New("the page has no image to preview; PDF pages have one only if auto-rotated")
+
+// PreviewOptions configure PagePreview.
+type PreviewOptions struct {
+	// MaxWidth and MaxHeight bound the size of the preview, which keeps
+	// the aspect ratio of the page and is never larger than it. Either
+	// defaults to 256 if it is not positive.
+	MaxWidth, MaxHeight int
+	// Boxes draws the bounding box of each text element of the page in
+	// BoxColor, which defaults to red.
+	Boxes    bool
+	BoxColor color.Color
+}
+
+// PagePreview returns a downscaled image of p, e.g., for a review UI, with
+// its bounding boxes drawn in if opts.Boxes is set. The image is that of p
+// (see DecodeRotatedImage) if it has one, or else f, the file p came from,
+// if it is an image. The pixels are averaged rather than sampled, so text
+// stays legible in small previews. The error is ErrNoPageImage for pages
+// of PDFs without an image of their own.
+func PagePreview(p RecognizedPage, f File, opts PreviewOptions) (image.Image, error) {
+	texts := p.RecognizedText
+	img, err := DecodeRotatedImage(p)
+	if err == ErrNoRotatedImage {
+		if isPDF(f) {
+			return nil, ErrNoPageImage
+		}
+		if img, _, err = image.Decode(bytes.NewReader(f.Contents)); err != nil {
+			return nil, err
+		}
+		// The boxes are of the page as the Sight API rotated it, and the
+		// file is as it was submitted.
+		if opts.Boxes {
+			texts = make([]RecognizedText, len(p.RecognizedText))
+			for i, t := range p.RecognizedText {
+				if texts[i], err = OriginalText(p, t); err != nil {
+					return nil, err
+				}
+			}
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	if opts.MaxWidth <= 0 {
+		opts.MaxWidth = 256
+	}
+	if opts.MaxHeight <= 0 {
+		opts.MaxHeight = 256
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return image.NewRGBA(image.Rectangle{}), nil
+	}
+	scale := math.Min(1, math.Min(float64(opts.MaxWidth)/float64(w), float64(opts.MaxHeight)/float64(h)))
+	pw, ph := int(math.Max(1, math.Round(float64(w)*scale))), int(math.Max(1, math.Round(float64(h)*scale)))
+	preview := image.NewRGBA(image.Rect(0, 0, pw, ph))
+	for y := 0; y < ph; y++ {
+		y0, y1 := bounds.Min.Y+y*h/ph, bounds.Min.Y+(y+1)*h/ph
+		for x := 0; x < pw; x++ {
+			x0, x1 := bounds.Min.X+x*w/pw, bounds.Min.X+(x+1)*w/pw
+			var sum [4]uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, b, a := img.At(sx, sy).RGBA()
+					sum[0], sum[1], sum[2], sum[3] = sum[0]+uint64(r), sum[1]+uint64(g), sum[2]+uint64(b), sum[3]+uint64(a)
+				}
+			}
+			n := uint64((x1-x0)*(y1-y0)) * 257
+			preview.SetRGBA(x, y, color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), uint8(sum[3] / n)})
+		}
+	}
+	if opts.Boxes {
+		c := opts.BoxColor
+		if c == nil {
+			c = color.RGBA{R: 255, A: 255}
+		}
+		sx, sy := float64(pw)/float64(w), float64(ph)/float64(h)
+		for _, t := range texts {
+			corners := [][2]int{{t.TopLeftX, t.TopLeftY}, {t.TopRightX, t.TopRightY}, {t.BottomRightX, t.BottomRightY}, {t.BottomLeftX, t.BottomLeftY}}
+			for i, from := range corners {
+				to := corners[(i+1)%len(corners)]
+				drawLine(preview, float64(from[0])*sx, float64(from[1])*sy, float64(to[0])*sx, float64(to[1])*sy, c)
+			}
+		}
+	}
+	return preview, nil
+}
+
+// drawLine draws a line one pixel wide from (x0, y0) to (x1, y1) on img,
+// clipped to its bounds.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 float64, c color.Color) {
+	steps := int(math.Ceil(math.Max(math.Abs(x1-x0), math.Abs(y1-y0))))
+	for i := 0; i <= steps; i++ {
+		f := 0.0
+		if steps > 0 {
+			f = float64(i) / float64(steps)
+		}
+		x, y := int(x0+(x1-x0)*f), int(y0+(y1-y0)*f)
+		if (image.Point{x, y}).In(img.Bounds()) {
+			img.Set(x, y, c)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import "fmt"
+
+// Priority is a hint of how urgently the Sight API should process a
+// request, so that a document someone is waiting for need not queue behind
+// batch traffic. It is a hint only: requests are not refused or billed
+// differently because of it.
+type Priority string
+
+const (
+	// PriorityHigh is for interactive requests, such as a single document
+	// uploaded by someone waiting for its text.
+	PriorityHigh Priority = "high"
+	// PriorityLow is for batch traffic which may wait for others.
+	PriorityLow Priority = "low"
+)
+
+// validate returns an error unless p is a Priority the Sight API accepts.
+func (p Priority) validate() error {
+	switch p {
+	case "", PriorityHigh, PriorityLow:
+		return nil
+	}
+	return fmt.Errorf("unsupported priority %q; it must be %q or %q", string(p), PriorityHigh, PriorityLow)
+}
@@ -0,0 +1,70 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"sort"
+)
+
+// notifyPages calls onPage, if not nil, with each page from in before
+// sending it on, and onFileComplete, if not nil, with the FileIndex of each
+// file once its last page has been sent: once as many distinct pages of it
+// have been as its NumberOfPagesInFile, or, for files whose pages were not
+// all received, when in is closed.
+func notifyPages(in <-chan RecognizedPage, onPage func(RecognizedPage), onFileComplete func(fileIndex int)) <-chan RecognizedPage {
+	out := make(chan RecognizedPage, 16)
+	go func() {
+		// seen maps the index of each incomplete file to the numbers of
+		// its pages which have been sent.
+		seen := make(map[int]map[int]bool)
+		complete := make(map[int]bool)
+		for p := range in {
+			if onPage != nil {
+				onPage(p)
+			}
+			out <- p
+			if onFileComplete == nil || complete[p.FileIndex] {
+				continue
+			}
+			if seen[p.FileIndex] == nil {
+				seen[p.FileIndex] = make(map[int]bool)
+			}
+			seen[p.FileIndex][p.PageNumber] = true
+			if len(seen[p.FileIndex]) >= p.NumberOfPagesInFile {
+				delete(seen, p.FileIndex)
+				complete[p.FileIndex] = true
+				onFileComplete(p.FileIndex)
+			}
+		}
+		if onFileComplete != nil {
+			incomplete := make([]int, 0, len(seen))
+			for i := range seen {
+				incomplete = append(incomplete, i)
+			}
+			sort.Ints(incomplete)
+			for _, i := range incomplete {
+				onFileComplete(i)
+			}
+		}
+		close(out)
+	}()
+	return out
+}
@@ -0,0 +1,125 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WithRateLimit limits the rate at which the Client makes requests to the
+// Sight API to requestsPerSecond (polls included), and the rate at which it
+// submits pages to pagesPerMinute. Either may be 0 for no limit. The limits
+// are shared by every call on the Client, so one Client can be used by a
+// pool of goroutines without tripping the limits of the Sight API.
+//
+// Responses of 429 Too Many Requests are retried after the delay in their
+// Retry-After header whether or not a limit is set.
+func WithRateLimit(requestsPerSecond, pagesPerMinute float64) Option {
+	return func(c *Client) {
+		c.requestLimit, c.pageLimit = nil, nil
+		if requestsPerSecond > 0 {
+			c.requestLimit = newTokenBucket(requestsPerSecond, math.Max(1, requestsPerSecond))
+		}
+		if pagesPerMinute > 0 {
+			c.pageLimit = newTokenBucket(pagesPerMinute/60, pagesPerMinute)
+		}
+	}
+}
+
+// tokenBucket holds up to capacity tokens and gains perSecond tokens every
+// second. It is safe for concurrent use.
+type tokenBucket struct {
+	mu        sync.Mutex
+	perSecond float64
+	capacity  float64
+	tokens    float64
+	last      time.Time
+}
+
+func newTokenBucket(perSecond, capacity float64) *tokenBucket {
+	return &tokenBucket{perSecond: perSecond, capacity: capacity, tokens: capacity, last: time.Now()}
+}
+
+// reserve takes n tokens from b and returns how long to wait before using
+// them. Tokens are taken even if b does not hold enough, so that later
+// callers wait their turn; n greater than the capacity of b waits only for a
+// full bucket, since it would otherwise wait forever.
+func (b *tokenBucket) reserve(n float64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.perSecond)
+	b.last = now
+	var wait time.Duration
+	if need := math.Min(n, b.capacity); b.tokens < need {
+		wait = time.Duration((need - b.tokens) / b.perSecond * float64(time.Second))
+	}
+	b.tokens -= n
+	return wait
+}
+
+// waitForRateLimit blocks until the Client may make one request to the
+// Sight API which submits pages pages.
+func (c *Client) waitForRateLimit(pages int, requestID string) {
+	var wait time.Duration
+	if c.requestLimit != nil {
+		wait = c.requestLimit.reserve(1)
+	}
+	if c.pageLimit != nil && pages > 0 {
+		if w := c.pageLimit.reserve(float64(pages)); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		c.logger.Debug("waiting for the rate limit", "request", requestID, "wait", wait)
+		time.Sleep(wait)
+	}
+}
+
+// maxRateLimitedRetries is the number of times a request which received 429
+// Too Many Requests is retried before giving up.
+const maxRateLimitedRetries = 10
+
+// retryAfter returns how long to wait before retrying a request whose
+// response, resp, was 429 Too Many Requests, given that it is the retry-th
+// retry. It follows the Retry-After header, in seconds or as a date, and
+// otherwise backs off exponentially from one second up to one minute.
+func retryAfter(resp *http.Response, retry int) time.Duration {
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		if seconds, err := strconv.Atoi(s); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+		if t, err := http.ParseTime(s); err == nil {
+			if d := time.Until(t); d > 0 {
+				return d
+			}
+			return 0
+		}
+	}
+	if retry >= 6 {
+		return time.Minute
+	}
+	return time.Second << uint(retry)
+}
@@ -0,0 +1,251 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// WithRecording makes the Client save every HTTP request it sends to the
+// Sight API, and the response, as a JSON file in dir, so that the exchange
+// can be replayed offline with WithReplay, e.g., as a test fixture.
+//
+// Recordings do not contain the API key or the contents of the files
+// submitted, which are replaced by their SHA-256 digests, nor images
+// returned by the API.
+func WithRecording(dir string) Option {
+	return func(c *Client) {
+		c.recordDir = dir
+	}
+}
+
+// WithReplay makes the Client answer its HTTP requests with the responses
+// recorded in dir by WithRecording, without any network access. A request
+// which was not recorded fails. Requests for the same URL with the same
+// body are answered with the responses recorded for them in turn, so that
+// polling replays as it happened.
+func WithReplay(dir string) Option {
+	return func(c *Client) {
+		c.replayDir = dir
+	}
+}
+
+// exchange is a recorded HTTP request and its response.
+type exchange struct {
+	Method   string
+	URL      string
+	Request  string `json:",omitempty"`
+	Status   int
+	Response string
+}
+
+// key identifies requests which are answered alike.
+func (e exchange) key() string {
+	return e.Method + " " + e.URL + "\n" + e.Request
+}
+
+// readRequest reads the body of req, leaving it to be read again, and
+// returns the exchange recording it.
+func readRequest(req *http.Request) (exchange, error) {
+	e := exchange{Method: req.Method, URL: req.URL.String()}
+	if req.Body == nil {
+		return e, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return e, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	e.Request = redactRequest(body)
+	return e, nil
+}
+
+// redactRequest replaces the contents of the files in a request body with
+// their digests.
+func redactRequest(body []byte) string {
+	var sr SightRequest
+	if err := json.Unmarshal(body, &sr); err != nil {
+		return string(body)
+	}
+	for i, f := range sr.Files {
+		digest := sha256.Sum256([]byte(f.Base64File))
+		sr.Files[i].Base64File = "sha256:" + hex.EncodeToString(digest[:])
+	}
+	redacted, err := json.Marshal(&sr)
+	if err != nil {
+		return string(body)
+	}
+	return string(redacted)
+}
+
+// redactResponse removes the images from a response body.
+func redactResponse(body []byte) string {
+	var v interface{}
+	if err := json.Unmarshal(body, &v); err != nil {
+		return string(body)
+	}
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, w := range v {
+				if k == "Base64Image" {
+					v[k] = ""
+				} else {
+					walk(w)
+				}
+			}
+		case []interface{}:
+			for _, w := range v {
+				walk(w)
+			}
+		}
+	}
+	walk(v)
+	redacted, err := json.Marshal(v)
+	if err != nil {
+		return string(body)
+	}
+	return string(redacted)
+}
+
+// recorder is the transport of a Client made with WithRecording.
+type recorder struct {
+	base http.RoundTripper
+	dir  string
+
+	mu sync.Mutex
+	n  int
+}
+
+func (r *recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	e, err := readRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	base := r.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	e.Status = resp.StatusCode
+	e.Response = redactResponse(body)
+	buf, err := json.MarshalIndent(e, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.n == 0 {
+		if err := os.MkdirAll(r.dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	r.n++
+	name := filepath.Join(r.dir, fmt.Sprintf("%04d.json", r.n))
+	if err := ioutil.WriteFile(name, buf, 0644); err != nil {
+		return nil, fmt.Errorf("failed to record HTTP exchange: %v", err)
+	}
+	return resp, nil
+}
+
+// replayer is the transport of a Client made with WithReplay.
+type replayer struct {
+	dir string
+
+	mu sync.Mutex
+	// exchanges holds the recorded exchanges not replayed yet, by key, in
+	// the order they were recorded. It is loaded on first use.
+	exchanges map[string][]exchange
+}
+
+func (r *replayer) load() error {
+	names, err := filepath.Glob(filepath.Join(r.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	r.exchanges = make(map[string][]exchange)
+	for _, name := range names {
+		buf, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		var e exchange
+		if err := json.Unmarshal(buf, &e); err != nil {
+			return fmt.Errorf("%v: %v", name, err)
+		}
+		r.exchanges[e.key()] = append(r.exchanges[e.key()], e)
+	}
+	return nil
+}
+
+func (r *replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	e, err := readRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.exchanges == nil {
+		if err := r.load(); err != nil {
+			return nil, fmt.Errorf("failed to load recorded HTTP exchanges: %v", err)
+		}
+	}
+	recorded := r.exchanges[e.key()]
+	if len(recorded) == 0 {
+		return nil, fmt.Errorf("no recorded response to %v %v in %v", e.Method, e.URL, r.dir)
+	}
+	r.exchanges[e.key()] = recorded[1:]
+	return &http.Response{
+		Status:        fmt.Sprintf("%v %v", recorded[0].Status, http.StatusText(recorded[0].Status)),
+		StatusCode:    recorded[0].Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(recorded[0].Response)),
+		ContentLength: int64(len(recorded[0].Response)),
+		Request:       req,
+	}, nil
+}
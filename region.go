@@ -0,0 +1,59 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import "fmt"
+
+// Region is a region in which the Sight API processes documents. Files
+// submitted to the endpoint of a region are processed, and their results
+// kept, only within it, e.g., for data processing agreements under the
+// GDPR.
+type Region string
+
+const (
+	RegionEU Region = "eu"
+	RegionUS Region = "us"
+)
+
+// RegionEndpoints maps each Region to the URL of the Sight API in it.
+var RegionEndpoints = map[Region]string{
+	RegionEU: "https://eu.siftrics.com/api/sight/",
+	RegionUS: "https://us.siftrics.com/api/sight/",
+}
+
+// WithRegion makes the Client send every request to the endpoint of region,
+// as listed in RegionEndpoints, instead of to Endpoint, whose region is not
+// guaranteed. If region is not in RegionEndpoints, every request fails
+// rather than being sent elsewhere. WithRegion and WithEndpoint override
+// each other: whichever is passed last applies.
+//
+// Jobs are polled at the URLs the Sight API returns for them, which are in
+// the region in which they were started.
+func WithRegion(region Region) Option {
+	return func(c *Client) {
+		endpoint, ok := RegionEndpoints[region]
+		if !ok {
+			c.endpoint, c.endpointErr = "", fmt.Errorf("unknown region %q", string(region))
+			return
+		}
+		c.endpoint, c.endpointErr = endpoint, nil
+	}
+}
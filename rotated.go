@@ -0,0 +1,69 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"encoding/base64"
+	"errors"
+	"image"
+	"io"
+	"strings"
+)
+
+// ErrNoRotatedImage is returned by DecodeRotatedImage for a page which has
+// no auto-rotated image.
+var ErrNoRotatedImage = errors.New("the page has no auto-rotated image")
+
+// RotatedImageReader returns a reader of the encoded bytes of the
+// auto-rotated image of p, which the Sight API sends with each page if
+// Config.DoAutoRotate is set, or nil if p has none. The image is in the
+// format of the file submitted, e.g., PNG or JPEG.
+func RotatedImageReader(p RecognizedPage) io.Reader {
+	if p.Base64Image == "" {
+		return nil
+	}
+	return base64.NewDecoder(base64.StdEncoding, strings.NewReader(p.Base64Image))
+}
+
+// DecodeRotatedImage decodes the auto-rotated image of p. The error is
+// ErrNoRotatedImage if p has none.
+func DecodeRotatedImage(p RecognizedPage) (image.Image, error) {
+	r := RotatedImageReader(p)
+	if r == nil {
+		return nil, ErrNoRotatedImage
+	}
+	img, _, err := image.Decode(r)
+	return img, err
+}
+
+// rotatedImageWriter returns a PostProcessor which passes the auto-rotated
+// image of each page which has one to write. Errors are logged, and the
+// page is sent regardless.
+func (c *Client) rotatedImageWriter(write func(fileIndex, page int, r io.Reader) error) PostProcessorFunc {
+	return func(p RecognizedPage) RecognizedPage {
+		if r := RotatedImageReader(p); r != nil {
+			if err := write(p.FileIndex, p.PageNumber, r); err != nil {
+				c.logger.Error("failed to write an auto-rotated image", "file_index", p.FileIndex, "page", p.PageNumber, "error", err)
+			}
+		}
+		return p
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"path"
+	"strings"
+	"sync"
+)
+
+// An InputHandler turns one kind of input, such as an email, into the files
+// the Sight API accepts. RouteInput picks the handler for an input by
+// sniffing its contents, so the name of an input (and its extension) is only
+// used to name the files it yields.
+type InputHandler interface {
+	// Match reports whether the handler handles an input with contents.
+	Match(contents []byte) bool
+	// Files returns the files to submit for the input named name. An
+	// error means the input cannot be submitted at all.
+	Files(name string, contents []byte) ([]File, error)
+}
+
+var (
+	inputHandlersMu sync.RWMutex
+	// inputHandlers are tried in order, most recently registered first.
+	inputHandlers = []InputHandler{
+		// Archives come first, as their contents may look like a PDF to
+		// pdfHandler, which allows junk before the header.
+		archiveHandler{},
+		pdfHandler{},
+		imageHandler{},
+		tiffHandler{},
+		officeHandler{},
+		emailHandler{},
+	}
+)
+
+// RegisterInputHandler adds h to the handlers RouteInput chooses from. It is
+// tried before every handler registered before it, including the built-in
+// ones, so it can also replace how an input type is handled.
+func RegisterInputHandler(h InputHandler) {
+	inputHandlersMu.Lock()
+	defer inputHandlersMu.Unlock()
+	inputHandlers = append([]InputHandler{h}, inputHandlers...)
+}
+
+// ErrUnsupportedInput is reported by errors.Is for the errors of RouteInput
+// which mean that the input is of a type the Sight API does not accept, such
+// as plain text, a TIFF image or an office document, rather than that it is
+// broken.
+var ErrUnsupportedInput = errors.New("unsupported input type")
+
+// unsupportedError is an error of RouteInput which is ErrUnsupportedInput.
+type unsupportedError string
+
+func (e unsupportedError) Error() string {
+	return string(e)
+}
+
+func (e unsupportedError) Is(target error) bool {
+	return target == ErrUnsupportedInput
+}
+
+// RouteInput sniffs contents, the input named name, and returns the files to
+// submit for it, as given by the first InputHandler which matches. PDFs and
+// images yield themselves, emails yield their attachments, ZIP, tar and
+// gzipped tar archives yield the files in them, and TIFF images and office
+// documents are refused with an error saying how to convert them. Inputs of
+// types which are not accepted are refused with errors which are
+// ErrUnsupportedInput.
+func RouteInput(name string, contents []byte) ([]File, error) {
+	if len(contents) == 0 {
+		return nil, errors.New("the file is empty")
+	}
+	inputHandlersMu.RLock()
+	handlers := inputHandlers
+	inputHandlersMu.RUnlock()
+	for _, h := range handlers {
+		if h.Match(contents) {
+			return h.Files(name, contents)
+		}
+	}
+	return nil, unsupportedError(fmt.Sprintf("unsupported input type %v", http.DetectContentType(contents)))
+}
+
+type pdfHandler struct{}
+
+func (pdfHandler) Match(contents []byte) bool {
+	// Readers accept junk before the header, within the first 1024 bytes.
+	if len(contents) > 1024 {
+		contents = contents[:1024]
+	}
+	return bytes.Contains(contents, []byte("%PDF-"))
+}
+
+func (pdfHandler) Files(name string, contents []byte) ([]File, error) {
+	return []File{{Name: name, MimeType: "application/pdf", Contents: contents}}, nil
+}
+
+type imageHandler struct{}
+
+func (imageHandler) mimeType(contents []byte) string {
+	if bytes.HasPrefix(contents, []byte("BM")) && len(contents) >= 26 {
+		return "image/bmp"
+	}
+	switch t := http.DetectContentType(contents); t {
+	case "image/gif", "image/jpeg", "image/png":
+		return t
+	}
+	return ""
+}
+
+func (h imageHandler) Match(contents []byte) bool {
+	return h.mimeType(contents) != ""
+}
+
+func (h imageHandler) Files(name string, contents []byte) ([]File, error) {
+	return []File{{Name: name, MimeType: h.mimeType(contents), Contents: contents}}, nil
+}
+
+type tiffHandler struct{}
+
+func (tiffHandler) Match(contents []byte) bool {
+	return bytes.HasPrefix(contents, []byte("II*\x00")) || bytes.HasPrefix(contents, []byte("MM\x00*"))
+}
+
+func (tiffHandler) Files(name string, contents []byte) ([]File, error) {
+	return nil, unsupportedError("TIFF images are not supported by the Sight API; convert them to PDF or PNG first")
+}
+
+type officeHandler struct{}
+
+func (officeHandler) Match(contents []byte) bool {
+	// Compound File Binary (.doc, .xls, .ppt) or an OOXML zip (.docx,
+	// .xlsx, .pptx), which lists its content types near the start.
+	if bytes.HasPrefix(contents, []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1")) {
+		return true
+	}
+	if len(contents) > 2048 {
+		contents = contents[:2048]
+	}
+	return bytes.HasPrefix(contents, []byte("PK\x03\x04")) && bytes.Contains(contents, []byte("[Content_Types].xml"))
+}
+
+func (officeHandler) Files(name string, contents []byte) ([]File, error) {
+	return nil, unsupportedError("office documents are not supported by the Sight API; convert them to PDF first")
+}
+
+type emailHandler struct{}
+
+// emailHeaders are header fields of which at least one starts every email.
+var emailHeaders = []string{
+	"received:", "return-path:", "delivered-to:", "from:", "to:", "date:",
+	"subject:", "message-id:", "mime-version:", "x-",
+}
+
+func (emailHandler) Match(contents []byte) bool {
+	line := contents
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	lower := strings.ToLower(string(line))
+	for _, h := range emailHeaders {
+		if strings.HasPrefix(lower, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// Files returns the attachments of the email, each routed as an input of its
+// own, named name/filename. Attachments which cannot be submitted, such as
+// signatures, are skipped, unless no attachment can be submitted.
+func (emailHandler) Files(name string, contents []byte) ([]File, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(contents))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email: %v", err)
+	}
+	var files []File
+	var skipped []string
+	err = walkMIME(msg.Header, msg.Body, func(filename string, data []byte) {
+		fs, err := RouteInput(path.Join(name, filename), data)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("%v (%v)", filename, err))
+			return
+		}
+		files = append(files, fs...)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email: %v", err)
+	}
+	if len(files) == 0 {
+		if len(skipped) != 0 {
+			return nil, fmt.Errorf("no attachment of the email can be submitted: %v", strings.Join(skipped, ", "))
+		}
+		return nil, errors.New("the email has no attachments")
+	}
+	return files, nil
+}
+
+// walkMIME calls attachment with the file name and decoded contents of every
+// part of a MIME entity which has a file name, descending into multipart
+// entities. Parts without a file name, such as the text of an email, are
+// skipped.
+func walkMIME(header interface{ Get(string) string }, body io.Reader, attachment func(filename string, data []byte)) error {
+	mediaType, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := walkMIME(part.Header, part, attachment); err != nil {
+				return err
+			}
+		}
+	}
+	var filename string
+	if _, dparams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		filename = dparams["filename"]
+	}
+	if filename == "" {
+		filename = params["name"]
+	}
+	if filename == "" {
+		return nil
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+	// multipart.Reader decodes quoted-printable parts itself, but not
+	// base64 ones, nor the body of a message which is not multipart.
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	attachment(path.Base(filename), data)
+	return nil
+}
@@ -0,0 +1,263 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// scriptTables maps script hint codes to the Unicode ranges of their
+// characters. Han characters are counted as "hans" because simplified and
+// traditional Chinese cannot be told apart character by character.
+var scriptTables = []struct {
+	code  string
+	table *unicode.RangeTable
+}{
+	{"latin", unicode.Latin},
+	{"cyrillic", unicode.Cyrillic},
+	{"greek", unicode.Greek},
+	{"arab", unicode.Arabic},
+	{"hebrew", unicode.Hebrew},
+	{"armenian", unicode.Armenian},
+	{"hindi", unicode.Devanagari},
+	{"bengali", unicode.Bengali},
+	{"gujarati", unicode.Gujarati},
+	{"guru", unicode.Gurmukhi},
+	{"kannada", unicode.Kannada},
+	{"malayam", unicode.Malayalam},
+	{"tamil", unicode.Tamil},
+	{"telugu", unicode.Telugu},
+	{"thai", unicode.Thai},
+	{"lao", unicode.Lao},
+	{"khmer", unicode.Khmer},
+	{"japanese", unicode.Hiragana},
+	{"japanese", unicode.Katakana},
+	{"korean", unicode.Hangul},
+	{"hans", unicode.Han},
+}
+
+// ScriptOf returns the script hint code of the script r is written in, or ""
+// if r is not a letter of a supported script (e.g., digits and punctuation).
+func ScriptOf(r rune) string {
+	for _, st := range scriptTables {
+		if unicode.Is(st.table, r) {
+			return st.code
+		}
+	}
+	return ""
+}
+
+// CountScripts counts the characters of text by script hint code. Characters
+// which do not belong to a supported script are not counted.
+func CountScripts(text string) map[string]int {
+	counts := make(map[string]int)
+	for _, r := range text {
+		if code := ScriptOf(r); code != "" {
+			counts[code]++
+		}
+	}
+	return counts
+}
+
+// MinScriptShare is the fraction of all counted characters a script must
+// make up to be suggested by SuggestScriptHints. Scripts below it are
+// usually stray misrecognitions rather than text in that script.
+const MinScriptShare = 0.05
+
+// SuggestScriptHints inspects the characters recognized on pages and returns
+// the script hint codes, sorted, which make up at least MinScriptShare of
+// them. It is meant to be run on a sample of a corpus recognized without
+// script hints, so that the rest of the corpus can be recognized with
+// better ones. It returns nil if no characters of a supported script were
+// recognized.
+func SuggestScriptHints(pages ...RecognizedPage) []string {
+	counts := make(map[string]int)
+	for _, p := range pages {
+		for _, t := range p.RecognizedText {
+			for code, n := range CountScripts(t.Text) {
+				counts[code] += n
+			}
+		}
+	}
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	var hints []string
+	for code, n := range counts {
+		if float64(n) >= MinScriptShare*float64(total) {
+			hints = append(hints, code)
+		}
+	}
+	sort.Strings(hints)
+	return hints
+}
+
+// SupportedScriptCodes returns the codes in SupportedScripts, sorted.
+func SupportedScriptCodes() []string {
+	codes := make([]string, 0, len(SupportedScripts))
+	for code := range SupportedScripts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// scriptAliases maps names people commonly use for scripts and languages to
+// their script hint codes, for suggestions.
+var scriptAliases = map[string]string{
+	"arabic":      "arab",
+	"chinese":     "hans",
+	"simplified":  "hans",
+	"traditional": "hant",
+	"devanagari":  "hindi",
+	"gurmukhi":    "guru",
+	"punjabi":     "guru",
+	"malayalam":   "malayam",
+	"norwegian":   "bokmal",
+	"russian":     "cyrillic",
+	"english":     "latin",
+	"hiragana":    "japanese",
+	"katakana":    "japanese",
+	"hangul":      "korean",
+}
+
+// ValidateScriptHints returns an error naming the first hint which is not
+// in SupportedScripts, with a suggestion if one is close to it.
+func ValidateScriptHints(hints []string) error {
+	return validateScriptHints(hints, SupportedScripts)
+}
+
+func validateScriptHints(hints []string, supported map[string]bool) error {
+	for _, hint := range hints {
+		if supported[hint] {
+			continue
+		}
+		if suggestion := suggestScript(hint, supported); suggestion != "" {
+			return fmt.Errorf(`"%v" is not a supported script; did you mean "%v"?`, hint, suggestion)
+		}
+		return fmt.Errorf(`"%v" is not a supported script`, hint)
+	}
+	return nil
+}
+
+// suggestScript returns the supported code which hint was most likely meant
+// to be, or "" if none is close.
+func suggestScript(hint string, supported map[string]bool) string {
+	lower := strings.ToLower(strings.TrimSpace(hint))
+	if supported[lower] {
+		return lower
+	}
+	if code, ok := scriptAliases[lower]; ok && supported[code] {
+		return code
+	}
+	best, bestDistance := "", 3
+	for code := range supported {
+		if strings.HasPrefix(code, lower) && len(lower) >= 3 {
+			return code
+		}
+		if d := editDistance(lower, code); d < bestDistance || (d == bestDistance && code < best) {
+			best, bestDistance = code, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// FetchSupportedScripts asks the Sight API for the script hint codes it
+// supports, which may be more recent than SupportedScripts. The Client then
+// validates script hints against them instead of SupportedScripts.
+func (c *Client) FetchSupportedScripts(ctx context.Context) ([]string, error) {
+	url := strings.TrimSuffix(c.endpoint, "/") + "/scripts"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("Non-200 response from request for supported scripts to the Sight API. Status: %v.", resp.StatusCode)
+	}
+	var scripts struct {
+		Scripts []string
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&scripts); err != nil {
+		return nil, fmt.Errorf("failed to decode supported scripts from the Sight API: %v", err)
+	}
+	if len(scripts.Scripts) == 0 {
+		return nil, fmt.Errorf("the Sight API reported no supported scripts")
+	}
+	supported := make(map[string]bool, len(scripts.Scripts))
+	for _, code := range scripts.Scripts {
+		supported[code] = true
+	}
+	c.scriptsMu.Lock()
+	c.scripts = supported
+	c.scriptsMu.Unlock()
+	sort.Strings(scripts.Scripts)
+	return scripts.Scripts, nil
+}
+
+// supportedScripts returns the script hint codes last fetched by
+// FetchSupportedScripts, or SupportedScripts if none were.
+func (c *Client) supportedScripts() map[string]bool {
+	c.scriptsMu.Lock()
+	defer c.scriptsMu.Unlock()
+	if c.scripts != nil {
+		return c.scripts
+	}
+	return SupportedScripts
+}
@@ -0,0 +1,83 @@
+//go:build go1.23
+
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"context"
+	"iter"
+)
+
+// RecognizeSeq is RecognizeFiles as an iterator, for Go 1.23 and later:
+//
+//	for page, err := range c.RecognizeSeq(ctx, cfg, files...) {
+//		if err != nil {
+//			...
+//		}
+//	}
+//
+// The files are submitted when iteration starts, and each page is yielded
+// as it is received, with its Err. If the files cannot be submitted, or ctx
+// is done before every page has been received, a single zero page is
+// yielded with the error and iteration ends. The requests which submit the
+// files and poll for their results are made with ctx, so once it is done,
+// they are canceled and polling is given up on.
+//
+// Breaking out of the loop ends iteration but not the job: the Sight API
+// finishes it, and its remaining pages are received and discarded in the
+// background, so that nothing is left blocked.
+func (c *Client) RecognizeSeq(ctx context.Context, cfg Config, files ...File) iter.Seq2[RecognizedPage, error] {
+	return func(yield func(RecognizedPage, error) bool) {
+		if err := ctx.Err(); err != nil {
+			yield(RecognizedPage{}, err)
+			return
+		}
+		cfg.ctx = ctx
+		pages, err := c.RecognizeFiles(cfg, files...)
+		if err != nil {
+			yield(RecognizedPage{}, err)
+			return
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				go discardPages(pages)
+				yield(RecognizedPage{}, ctx.Err())
+				return
+			case page, ok := <-pages:
+				if !ok {
+					return
+				}
+				if !yield(page, page.Err()) {
+					go discardPages(pages)
+					return
+				}
+			}
+		}
+	}
+}
+
+// discardPages receives the rest of pages.
+func discardPages(pages <-chan RecognizedPage) {
+	for range pages {
+	}
+}
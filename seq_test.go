@@ -0,0 +1,150 @@
+//go:build go1.23
+
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/sighttest"
+)
+
+// hangingPolls sends submissions on to a sighttest.Server, but holds each
+// polling request until it is canceled.
+type hangingPolls struct {
+	// polling receives a value when each polling request is sent.
+	polling chan struct{}
+
+	mu    sync.Mutex
+	polls int
+}
+
+func (h *hangingPolls) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Method != "GET" {
+		return http.DefaultTransport.RoundTrip(r)
+	}
+	h.mu.Lock()
+	h.polls++
+	h.mu.Unlock()
+	h.polling <- struct{}{}
+	<-r.Context().Done()
+	return nil, r.Context().Err()
+}
+
+func (h *hangingPolls) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.polls
+}
+
+func TestRecognizeSeqCancelPolling(t *testing.T) {
+	s := sighttest.NewServer()
+	defer s.Close()
+	h := &hangingPolls{polling: make(chan struct{}, 10)}
+	c := s.Client(sight.WithTransport(h))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		var errs []error
+		for _, err := range c.RecognizeSeq(ctx, sight.Config{}, testImage(t)) {
+			errs = append(errs, err)
+		}
+		if len(errs) != 1 {
+			done <- errors.New("want a single error")
+			return
+		}
+		done <- errs[0]
+	}()
+
+	select {
+	case <-h.polling:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no polling request was sent")
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("iteration ended with %v; want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("iteration did not end after the context was canceled")
+	}
+
+	// The polling request in flight is canceled, and no more are sent.
+	time.Sleep(time.Second)
+	if n := h.count(); n != 1 {
+		t.Errorf("sent %v polling requests; want 1", n)
+	}
+}
+
+func TestRecognizeSeqCanceledContext(t *testing.T) {
+	s := sighttest.NewServer()
+	defer s.Close()
+	c := s.Client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n := 0
+	for page, err := range c.RecognizeSeq(ctx, sight.Config{}, testImage(t)) {
+		n++
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("yielded %+v, %v; want %v", page, err, context.Canceled)
+		}
+	}
+	if n != 1 {
+		t.Errorf("yielded %v times; want 1", n)
+	}
+	if reqs := s.Requests(); len(reqs) != 0 {
+		t.Errorf("submitted %v requests; want none", len(reqs))
+	}
+}
+
+func TestRecognizeSeq(t *testing.T) {
+	s := sighttest.NewServer()
+	defer s.Close()
+	s.PagesPerPoll = 1
+	c := s.Client()
+
+	file := testImage(t)
+	n := 0
+	for page, err := range c.RecognizeSeq(context.Background(), sight.Config{}, file, file) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page.FileIndex != n {
+			t.Errorf("page %v has FileIndex %v", n, page.FileIndex)
+		}
+		n++
+	}
+	if n != 2 {
+		t.Errorf("yielded %v pages; want 2", n)
+	}
+}
@@ -22,18 +22,31 @@ package sight
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/siftrics/sight/barcode"
 )
 
+// Endpoint is the URL of the Sight API, to which files are submitted.
+const Endpoint = "https://siftrics.com/api/sight/"
+
 // SupportedScripts is the set of all supported script hint codes.
 // A script hint code can be used to tell the Sight API to only detect
-// text from that script. It is passed into RecognizeCfg.
+// text from that script. It is passed into RecognizeCfg. The Sight API may
+// support codes added since this package was released; see
+// Client.FetchSupportedScripts.
 var SupportedScripts = map[string]bool{
 	"arab":     true,
 	"armenian": true,
@@ -69,6 +82,125 @@ type Config struct {
 	DoAutoRotate  bool
 	DoAsync       bool
 	ScriptHints   []string
+	// OnUploadProgress, if not nil, is called as the initial HTTP request
+	// is sent, with the number of bytes sent so far and the total size of
+	// the request. It may be called from a different goroutine.
+	OnUploadProgress func(bytesSent, total int64)
+	// MaxPagesPerFile, if positive, is the most pages a PDF may have. Longer
+	// PDFs are refused with an error before anything is uploaded, unless
+	// TruncateLongFiles is set, in which case only their first
+	// MaxPagesPerFile pages are submitted. PDFs whose pages cannot be
+	// counted are submitted as they are.
+	MaxPagesPerFile   int
+	TruncateLongFiles bool
+	// OnJobStarted, if not nil, is called with the job the Sight API
+	// started for the files, once they have been accepted. Its URL
+	// identifies the job, so it is worth recording with the results, and
+	// the job can be passed to ResumeJob if the process exits before all
+	// of its pages have been received. It is not called if the results
+	// are returned immediately.
+	OnJobStarted func(job Job)
+	// OnPage, if not nil, is called with each page just before it is sent
+	// on the channel, e.g., to log it or drive a progress bar.
+	OnPage func(page RecognizedPage)
+	// OnFileComplete, if not nil, is called with the FileIndex of each
+	// file once its last page has been sent on the channel, so that
+	// callers need not count pages against NumberOfPagesInFile. A file
+	// some of whose pages never arrive is reported when the channel is
+	// closed.
+	OnFileComplete func(fileIndex int)
+	// OnPoll, if not nil, is called after each polling request with the
+	// number of the attempt, counting from 1, and the HTTP status of the
+	// response, or 0 if none was received.
+	OnPoll func(attempt, status int)
+	// ChannelBuffer, if positive, is the number of pages which the
+	// channel of results holds until they are read, instead of 16. While
+	// it is full, polling waits, and a job whose pages are not read for
+	// long enough may expire; see SpillDir.
+	ChannelBuffer int
+	// SpillDir, if not empty, is a directory in which pages beyond
+	// ChannelBuffer are kept in a temporary file until they are read, so
+	// that polling never waits for a slow reader. The file is removed
+	// once the channel is closed.
+	SpillDir string
+	// IdempotencyKey is sent with the initial HTTP request in the
+	// Idempotency-Key header, so that if the request is sent again after
+	// a network failure left it unknown whether the first one arrived,
+	// the Sight API starts (and bills) only one job. If it is empty, a
+	// random UUID is used, which suffices unless the files may be
+	// submitted again by another process. Each call must use a new key.
+	IdempotencyKey string
+	// RequestTimeout, if positive, bounds each HTTP request, including
+	// the upload of the files in the initial request. Polling requests
+	// which time out are retried like other network errors.
+	RequestTimeout time.Duration
+	// JobDeadline, if positive, bounds the time from the call to
+	// RecognizeFiles until every page has been received. If it passes,
+	// polling is given up on with ErrJobDeadline (see
+	// RecognizedPage.JobFailed), or RecognizeFiles returns an error if
+	// the files have not been accepted yet.
+	JobDeadline time.Duration
+	// DetectLanguage makes the Client set the Language of each text
+	// element which the Sight API did not set with DetectLanguage.
+	DetectLanguage bool
+	// DetectBarcodes makes the Client decode the QR codes and Code 128
+	// and Code 39 barcodes on each page itself, with ScanBarcodes, and
+	// set the Barcodes of the page to those found.
+	DetectBarcodes bool
+	// Vocabulary lists terms, such as product codes, part numbers and
+	// names, which the Sight API may misrecognize because they are not
+	// words. The Client replaces words of the recognized text which
+	// nearly match a term with the term; see Vocabulary.Correct.
+	Vocabulary []string
+	// PostProcessors are applied, in order, to each page before it is
+	// sent, after DetectBarcodes, Vocabulary and DetectLanguage, e.g., to
+	// normalize, correct or filter its text.
+	PostProcessors []PostProcessor
+	// SkipTextPDFs makes the Client extract the text of PDF pages which
+	// already have a text layer, such as those of born-digital documents,
+	// instead of submitting them. Only the pages without one, such as
+	// scanned pages, are submitted and paid for. Extracted text has a
+	// Confidence of 1, and is located at 72 DPI, where a pixel is a PDF
+	// point. Pages whose text cannot be decoded, and pages mostly covered
+	// by images, are submitted.
+	SkipTextPDFs bool
+	// PDFPasswords are the passwords of encrypted PDFs, which are
+	// decrypted before they are submitted, as the Sight API cannot read
+	// them. It maps the Name of a File to the passwords to try for it;
+	// those under "" are tried for every file. The empty password is
+	// always tried first. An encrypted PDF which none of them opens is
+	// not submitted; a single page with an Error is sent for it instead.
+	PDFPasswords map[string][]string
+	// OneJobPerFile makes the Client submit each file in a request of its
+	// own, so that each starts a job of its own, with its own polling
+	// URL, which can be resumed (see ResumeJob and WithJobStore) or
+	// retried by itself. OnJobStarted is called for each job, and
+	// OnUploadProgress for each request in turn. A file whose
+	// submission fails is sent a single page with an Error, rather than
+	// failing the others, unless every submission fails. Duplicate files
+	// are still submitted once. IdempotencyKey, if set, is suffixed with
+	// the position of each distinct file, so that each request has a key
+	// of its own.
+	OneJobPerFile bool
+	// Priority hints how urgently the Sight API should process the
+	// request; see Priority. The zero value is the normal priority.
+	Priority Priority
+	// Tags are sent with the request, so that the Sight API can
+	// attribute it, e.g., to a tenant, and are echoed in the Tags of each
+	// page. They do not affect recognition, so cached results are shared
+	// by requests with different Tags.
+	Tags map[string]string
+	// RotatedImageWriter, if not nil, is called with the auto-rotated
+	// image of each page which has one (see DoAutoRotate and
+	// RotatedImageReader), before the page is sent on the channel, e.g.,
+	// to save it to a file. The page is sent with its Base64Image even so.
+	// Errors are logged. Pages are passed to it one at a time, before
+	// PostProcessors.
+	RotatedImageWriter func(fileIndex, page int, r io.Reader) error
+
+	// ctx, if not nil, is the context of the requests which submit the
+	// files and poll for their results; see RecognizeSeq.
+	ctx context.Context
 }
 
 type SightRequest struct {
@@ -78,6 +210,8 @@ type SightRequest struct {
 	DoAutoRotate  bool
 	DoAsync       bool
 	ScriptHints   []string
+	Priority      Priority          `json:",omitempty"`
+	Tags          map[string]string `json:",omitempty"`
 }
 
 type SightRequestFile struct {
@@ -91,7 +225,78 @@ type RecognizedPage struct {
 	PageNumber          int
 	NumberOfPagesInFile int
 	RecognizedText      []RecognizedText
-	Base64Image         string `json:",omitempty"`
+	Base64Image         string `json:",omitempty" msgpack:",omitempty"`
+	// Width and Height are the size in pixels of the page image in whose
+	// coordinates the RecognizedText is located, and DPI is its
+	// resolution. AppliedRotationDegrees is how far the page was rotated
+	// clockwise (by Config.DoExifRotate or DoAutoRotate) before it was
+	// recognized. They are zero if the Sight API did not report them,
+	// except that Width, Height and DPI are read from Base64Image if
+	// there is one.
+	Width                  int `json:",omitempty" msgpack:",omitempty"`
+	Height                 int `json:",omitempty" msgpack:",omitempty"`
+	DPI                    int `json:",omitempty" msgpack:",omitempty"`
+	AppliedRotationDegrees int `json:",omitempty" msgpack:",omitempty"`
+	// Barcodes are the barcodes found on the page if
+	// Config.DetectBarcodes is set, located like the RecognizedText of
+	// PDF pages and of images which were not rotated; see ScanBarcodes.
+	Barcodes []barcode.Barcode `json:",omitempty" msgpack:",omitempty"`
+	// JobFailed is set on the pages sent in place of those which were
+	// never received because polling for them was given up on, e.g.,
+	// after repeated network errors. Their Error says why. The job may
+	// still be resumed with ResumeJob, which polls for these pages.
+	JobFailed bool `json:",omitempty" msgpack:",omitempty"`
+	// RequestID is the X-Request-Id header of the response in which the
+	// page was received, and JobID the X-Job-Id header of the response
+	// which started its job, if the Sight API sent them. They identify
+	// the requests on the servers of Siftrics, so quote them when
+	// reporting a problem with the page.
+	RequestID string `json:",omitempty" msgpack:",omitempty"`
+	JobID     string `json:",omitempty" msgpack:",omitempty"`
+	// FilePath is the Name of the file the page came from, as passed to
+	// RecognizeFiles (or the path passed to RecognizeCfg), FileName is
+	// its last element, and FileSHA256 and FileSizeBytes are the
+	// hex-encoded SHA-256 digest and the size of its contents. They are
+	// set by the Client, so that results can be traced to their files
+	// without FileIndex, except on pages first sent by ResumeJob, which
+	// does not have the files.
+	FileName      string `json:",omitempty" msgpack:",omitempty"`
+	FilePath      string `json:",omitempty" msgpack:",omitempty"`
+	FileSHA256    string `json:",omitempty" msgpack:",omitempty"`
+	FileSizeBytes int64  `json:",omitempty" msgpack:",omitempty"`
+	// SubmittedAt is when the Client started to send the request which
+	// submitted the page's file, FirstSeenAt is when the page was
+	// received, and ProcessingDuration is the time between them. They
+	// are measured by the Client, and are nil or zero for pages which were
+	// not received from the Sight API, such as cached pages or those of
+	// files which were not submitted. Pages first sent by ResumeJob have
+	// them only if the Job records when it was submitted.
+	SubmittedAt        *time.Time    `json:",omitempty" msgpack:",omitempty"`
+	FirstSeenAt        *time.Time    `json:",omitempty" msgpack:",omitempty"`
+	ProcessingDuration time.Duration `json:",omitempty" msgpack:",omitempty"`
+	// Tags are the Config.Tags of the request which submitted the page's
+	// file, as echoed by the Sight API or, if it did not echo them, set
+	// by the Client. Pages first sent by ResumeJob have only those the
+	// Sight API echoed.
+	Tags map[string]string `json:",omitempty" msgpack:",omitempty"`
+
+	// err is the error of a page with JobFailed set; see Err.
+	err error
+}
+
+// Err returns the error of p, or nil if it has none. For a page with
+// JobFailed set, it is the *PollError which made polling give up, so that
+// errors.Is(p.Err(), ErrUnauthorized) reports whether the API key was
+// rejected. Otherwise it is an error with the text of p.Error. The
+// PollError is lost if p is marshaled.
+func (p RecognizedPage) Err() error {
+	if p.err != nil {
+		return p.err
+	}
+	if p.Error != "" {
+		return errors.New(p.Error)
+	}
+	return nil
 }
 
 type RecognizedText struct {
@@ -99,14 +304,120 @@ type RecognizedText struct {
 	TopLeftX, TopLeftY, TopRightX, TopRightY             int
 	BottomLeftX, BottomLeftY, BottomRightX, BottomRightY int
 	Confidence                                           float64
+	// Language is the BCP 47 tag of the language of Text, if the Sight
+	// API reported it or Config.DetectLanguage is set.
+	Language string `json:",omitempty" msgpack:",omitempty"`
+}
+
+// Redacted returns a copy of p without any recognized text, text of barcodes
+// or image, keeping only counts and geometry. It is meant for logs and
+// reports about documents whose content must not be retained.
+func (p RecognizedPage) Redacted() RecognizedPage {
+	rp := p
+	rp.Base64Image = ""
+	rp.RecognizedText = make([]RecognizedText, len(p.RecognizedText))
+	for i, t := range p.RecognizedText {
+		rp.RecognizedText[i] = t
+		rp.RecognizedText[i].Text = ""
+	}
+	if p.Barcodes != nil {
+		rp.Barcodes = make([]barcode.Barcode, len(p.Barcodes))
+		for i, b := range p.Barcodes {
+			rp.Barcodes[i] = b
+			rp.Barcodes[i].Text = ""
+		}
+	}
+	return rp
 }
 
 type Client struct {
-	apiKey string
+	apiKey   string
+	endpoint string
+	// endpointErr is set by WithRegion if its region is unknown, and
+	// returned for every request.
+	endpointErr error
+	transport   http.RoundTripper
+	logger      Logger
+	// recordDir and replayDir are set by WithRecording and WithReplay.
+	recordDir, replayDir string
+	cache                Cache
+	// requestLimit and pageLimit are set by WithRateLimit.
+	requestLimit, pageLimit *tokenBucket
+	proxy                   *url.URL
+	tlsConfig               *tls.Config
+	poller                  *Poller
+	// debugOut is set by WithDebugTransport.
+	debugOut io.Writer
+	// appName is set by WithAppName.
+	appName string
+	// authScheme and keyProvider are set by WithAuthScheme and
+	// WithKeyProvider.
+	authScheme  AuthScheme
+	keyProvider KeyProvider
+	keyPool     *KeyPool
+	jobStore    JobStore
+	// httpClient sends every request, so that connections are reused.
+	httpClient *http.Client
+	// scripts are the script hint codes fetched by FetchSupportedScripts.
+	scriptsMu sync.Mutex
+	scripts   map[string]bool
 }
 
-func NewClient(apiKey string) *Client {
-	return &Client{apiKey: apiKey}
+// Recognizer is the set of methods of Client which recognize text. Code
+// which depends on a Recognizer rather than a *Client can be given a fake in
+// its tests (or a Client wired to the fake server in the sighttest package).
+type Recognizer interface {
+	Recognize(filePaths ...string) (<-chan RecognizedPage, error)
+	RecognizeWords(filePaths ...string) (<-chan RecognizedPage, error)
+	RecognizeCfg(cfg Config, filePaths ...string) (<-chan RecognizedPage, error)
+	RecognizeFiles(cfg Config, files ...File) (<-chan RecognizedPage, error)
+	ResumeJob(job Job, received ...RecognizedPage) (<-chan RecognizedPage, error)
+}
+
+var _ Recognizer = (*Client)(nil)
+
+// Option configures a Client. Options are passed to NewClient.
+type Option func(*Client)
+
+// WithTransport makes the Client send its HTTP requests through rt instead of
+// http.DefaultTransport. It is mostly useful in tests; see the chaos package.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) {
+		c.transport = rt
+	}
+}
+
+// WithEndpoint makes the Client submit files to url instead of Endpoint,
+// e.g., to a fake of the Sight API; see the sighttest package. See also
+// WithRegion.
+func WithEndpoint(url string) Option {
+	return func(c *Client) {
+		c.endpoint, c.endpointErr = url, nil
+	}
+}
+
+func NewClient(apiKey string, opts ...Option) *Client {
+	c := &Client{apiKey: apiKey, endpoint: Endpoint, authScheme: AuthBasic, logger: nopLogger{}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.poller == nil {
+		c.poller = NewPoller(0, 0)
+	}
+	c.configureTransport()
+	// Recording and replay wrap whichever transport was chosen, whatever
+	// the order of the options, and debugging wraps them in turn, so that
+	// replayed exchanges are described too.
+	if c.replayDir != "" {
+		c.transport = &replayer{dir: c.replayDir}
+	} else if c.recordDir != "" {
+		c.transport = &recorder{base: c.transport, dir: c.recordDir}
+	}
+	if c.debugOut != nil {
+		c.transport = &debugTransport{base: c.transport, w: c.debugOut}
+	}
+	c.httpClient = &http.Client{Transport: c.transport}
+	return c
 }
 
 // Recognize is shorthand for calling RecognizeCfg with all the default config values.
@@ -138,6 +449,57 @@ func (c *Client) RecognizeWords(filePaths ...string) (<-chan RecognizedPage, err
 	)
 }
 
+// File is an input document held in memory, for callers whose documents do
+// not live on disk (e.g., uploads, or data read from stdin).
+type File struct {
+	// Name identifies the file in error messages. If MimeType is empty,
+	// the MIME type is inferred from the extension of Name, if it has one.
+	Name string
+	// MimeType is the MIME type of Contents. If it is empty and cannot be
+	// inferred from Name, it is sniffed from Contents.
+	MimeType string
+	Contents []byte
+	// Pages, if not empty, selects the pages of a PDF to submit, numbered
+	// from 1; see ParsePageRanges. The PageNumber of each RecognizedPage
+	// is still the number of the page in the whole PDF, and its
+	// NumberOfPagesInFile is the number of pages selected.
+	Pages []int
+}
+
+// SupportedMimeTypes is the set of MIME types accepted by the Sight API.
+var SupportedMimeTypes = map[string]bool{
+	"application/pdf": true,
+	"image/bmp":       true,
+	"image/gif":       true,
+	"image/jpeg":      true,
+	"image/jpg":       true,
+	"image/png":       true,
+}
+
+// mimeTypeFromPath infers a MIME type from the suffix (extension) of fp.
+func mimeTypeFromPath(fp string) (string, error) {
+	if len(fp) < 4 {
+		return "", fmt.Errorf("failed to infer MIME type from file path: %v", fp)
+	}
+	switch strings.ToLower(fp[len(fp)-4 : len(fp)]) {
+	case ".bmp":
+		return "image/bmp", nil
+	case ".gif":
+		return "image/gif", nil
+	case ".pdf":
+		return "application/pdf", nil
+	case ".png":
+		return "image/png", nil
+	case ".jpg":
+		return "image/jpg", nil
+	default:
+		if len(fp) >= 5 && strings.ToLower(fp[len(fp)-5:len(fp)]) == ".jpeg" {
+			return "image/jpeg", nil
+		}
+		return "", fmt.Errorf("failed to infer MIME type from file path: %v", fp)
+	}
+}
+
 // RecognizeCfg uses the Sight API to recognize all the text in the given files.
 //
 // If err != nil, then ioutil.ReadAll failed on a given file, a MIME type was
@@ -151,175 +513,500 @@ func (c *Client) RecognizeWords(filePaths ...string) (<-chan RecognizedPage, err
 // nature of the initial network request, this function must be run in a separate
 // goroutine.
 func (c *Client) RecognizeCfg(cfg Config, filePaths ...string) (<-chan RecognizedPage, error) {
-	sr := SightRequest{
-		Files:         make([]SightRequestFile, len(filePaths), len(filePaths)),
-		MakeSentences: cfg.MakeSentences,
-		DoExifRotate:  cfg.DoExifRotate,
-		DoAutoRotate:  cfg.DoAutoRotate,
-		DoAsync:       cfg.DoAsync,
-		ScriptHints:   cfg.ScriptHints,
-	}
-	for _, hint := range sr.ScriptHints {
-		if _, ok := SupportedScripts[hint]; !ok {
-			return nil, fmt.Errorf(`"%v" is not a supported script`, hint)
-		}
-	}
+	files := make([]File, len(filePaths), len(filePaths))
 	for i, fp := range filePaths {
-		if len(fp) < 4 {
-			return nil, fmt.Errorf("failed to infer MIME type from file path: %v", fp)
-		}
-		switch strings.ToLower(fp[len(fp)-4 : len(fp)]) {
-		case ".bmp":
-			sr.Files[i].MimeType = "image/bmp"
-		case ".gif":
-			sr.Files[i].MimeType = "image/gif"
-		case ".pdf":
-			sr.Files[i].MimeType = "application/pdf"
-		case ".png":
-			sr.Files[i].MimeType = "image/png"
-		case ".jpg":
-			sr.Files[i].MimeType = "image/jpg"
-		default:
-			if len(fp) >= 5 && strings.ToLower(fp[len(fp)-5:len(fp)]) == ".jpeg" {
-				sr.Files[i].MimeType = "image/jpeg"
-			} else {
-				return nil, fmt.Errorf("failed to infer MIME type from file path: %v", fp)
-			}
+		mimeType, err := mimeTypeFromPath(fp)
+		if err != nil {
+			return nil, err
 		}
+		files[i].Name = fp
+		files[i].MimeType = mimeType
 	}
 	for i, fp := range filePaths {
 		fileContents, err := ioutil.ReadFile(fp)
 		if err != nil {
 			return nil, err
 		}
-		sr.Files[i].Base64File = base64.StdEncoding.EncodeToString(fileContents)
+		files[i].Contents = fileContents
 	}
-	buf, err := json.Marshal(&sr)
-	if err != nil {
-		return nil, err
+	return c.RecognizeFiles(cfg, files...)
+}
+
+// RecognizeFiles is like RecognizeCfg, but the files are given in memory
+// rather than as paths. The FileIndex of each RecognizedPage is an index into
+// files.
+//
+// If err != nil, then the MIME type of a given file was not supported or
+// could not be determined, or there was an error with the _initial_ HTTP
+// request or response.
+//
+// Files which are empty or whose contents do not match their MIME type
+// (e.g., a truncated image or a .pdf file which is not a PDF) are not
+// submitted. Instead, a single RecognizedPage whose Error says what is
+// wrong is sent for each of them. Neither are files whose results are in
+// the Client's Cache (see WithCache); their cached pages are sent instead.
+//
+// Files with the same contents (and the same MIME type and selected pages)
+// are submitted, and paid for, once; each of them is sent a copy of the
+// pages.
+//
+// If the Client has a JobStore (see WithJobStore), the job started for the
+// files and the pages received from it are stored in it.
+func (c *Client) RecognizeFiles(cfg Config, files ...File) (<-chan RecognizedPage, error) {
+	if cfg.OnPage != nil || cfg.OnFileComplete != nil {
+		onPage, onFileComplete := cfg.OnPage, cfg.OnFileComplete
+		cfg.OnPage, cfg.OnFileComplete = nil, nil
+		pages, err := c.RecognizeFiles(cfg, files...)
+		if err != nil {
+			return nil, err
+		}
+		return notifyPages(pages, onPage, onFileComplete), nil
 	}
-	req, err := http.NewRequest("POST", "https://siftrics.com/api/sight/", bytes.NewReader(buf))
-	if err != nil {
-		return nil, err
+	if cfg.ChannelBuffer > 0 || cfg.SpillDir != "" {
+		buffer, dir := cfg.ChannelBuffer, cfg.SpillDir
+		cfg.ChannelBuffer, cfg.SpillDir = 0, ""
+		pages, err := c.RecognizeFiles(cfg, files...)
+		if err != nil {
+			return nil, err
+		}
+		return c.bufferPages(pages, buffer, dir), nil
+	}
+	if processors := c.postProcessors(cfg, files); len(processors) > 0 {
+		cfg.DetectBarcodes, cfg.Vocabulary, cfg.DetectLanguage, cfg.PostProcessors = false, nil, false, nil
+		cfg.RotatedImageWriter = nil
+		pages, err := c.RecognizeFiles(cfg, files...)
+		if err != nil {
+			return nil, err
+		}
+		return postProcess(processors, pages), nil
+	}
+	var pages <-chan RecognizedPage
+	var err error
+	if cfg.OneJobPerFile {
+		pages, err = c.recognizePerFile(cfg, files)
+	} else {
+		pages, err = c.recognizeStored(cfg, files)
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Basic %v", c.apiKey))
-	var httpClient http.Client
-	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode == 401 {
-		return nil, fmt.Errorf("Invalid API key; Received 401 Unauthorzied from initial HTTP request to the Sight API.\n")
-	} else if resp.StatusCode != 200 {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("Non-200 response from intial HTTP request to the Sight API. Status of inital HTTP response: %v. Furthermore, failed to read body of initial HTTP response.", resp.StatusCode)
+	return describeFiles(pages, files, cfg.Tags), nil
+}
+
+// recognizeStored is RecognizeFiles without post-processing: it saves the
+// job, if any, and the pages received in the job store, if the Client has
+// one.
+func (c *Client) recognizeStored(cfg Config, files []File) (<-chan RecognizedPage, error) {
+	if c.jobStore == nil {
+		return c.recognizeUnique(cfg, files)
+	}
+	// OnJobStarted is called before recognizeUnique returns, if at all.
+	var started *Job
+	onJobStarted := cfg.OnJobStarted
+	cfg.OnJobStarted = func(job Job) {
+		if err := c.jobStore.SaveJob(job); err != nil {
+			c.logger.Warn("failed to store a job", "url", job.URL, "error", err)
+		}
+		started = &job
+		if onJobStarted != nil {
+			onJobStarted(job)
 		}
-		return nil, fmt.Errorf("Non-200 response from intial HTTP request to the Sight API. Status of inital HTTP response: %v. Body of initial HTTP response:\n%v", resp.StatusCode, string(body))
 	}
-	var either struct {
-		PollingURL     string
-		RecognizedText []RecognizedText
-		Base64Image    string
+	pages, err := c.recognizeUnique(cfg, files)
+	if err != nil || started == nil {
+		return pages, err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&either); err != nil {
-		return nil, fmt.Errorf("This should never happen and is not your fault: failed to decode body of initial HTTP request; error: %v", err)
+	return c.storePages(c.jobStore, *started, nil, pages), nil
+}
+
+// recognizeUnique is RecognizeFiles without the job store: it submits each
+// distinct file once.
+func (c *Client) recognizeUnique(cfg Config, files []File) (<-chan RecognizedPage, error) {
+	if cfg.SkipTextPDFs {
+		cfg.SkipTextPDFs = false
+		return c.recognizeTextPDFs(cfg, files)
+	}
+	unique, copies := dedupFiles(files)
+	if len(unique) == len(files) {
+		return c.recognizeFiles(cfg, files)
+	}
+	c.logger.Info("submitting duplicate files once", "files", len(files), "unique", len(unique))
+	if onJobStarted := cfg.OnJobStarted; onJobStarted != nil {
+		cfg.OnJobStarted = func(job Job) {
+			onJobStarted(job.withCopies(copies))
+		}
+	}
+	pages, err := c.recognizeFiles(cfg, unique)
+	if err != nil {
+		return nil, err
 	}
+	return fanOut(pages, func(p RecognizedPage) []int { return copies[p.FileIndex] }), nil
+}
 
-	pagesChan := make(chan RecognizedPage, 16)
-	go func() {
-		if either.PollingURL == "" {
-			pagesChan <- RecognizedPage{
-				Error:               "",
-				FileIndex:           0,
+func (c *Client) recognizeFiles(cfg Config, files []File) (<-chan RecognizedPage, error) {
+	if c.endpointErr != nil {
+		return nil, c.endpointErr
+	}
+	limits := pollLimits{requestTimeout: cfg.RequestTimeout, ctx: cfg.ctx}
+	if cfg.JobDeadline > 0 {
+		limits.deadline = time.Now().Add(cfg.JobDeadline)
+	}
+	sr := SightRequest{
+		Files:         make([]SightRequestFile, 0, len(files)),
+		MakeSentences: cfg.MakeSentences,
+		DoExifRotate:  cfg.DoExifRotate,
+		DoAutoRotate:  cfg.DoAutoRotate,
+		DoAsync:       cfg.DoAsync,
+		ScriptHints:   cfg.ScriptHints,
+		Priority:      cfg.Priority,
+		Tags:          cfg.Tags,
+	}
+	if err := validateScriptHints(sr.ScriptHints, c.supportedScripts()); err != nil {
+		return nil, err
+	}
+	if err := cfg.Priority.validate(); err != nil {
+		return nil, err
+	}
+	// submitted maps indices into sr.Files to indices into files, and
+	// selections maps them to the pages selected from each file, if any.
+	var submitted []int
+	var selections [][]int
+	var rejected []RecognizedPage
+	// cached are the pages of files found in c.cache, and cacheKeys are
+	// the keys under which the results of submitted files are stored.
+	var cached []RecognizedPage
+	var cacheKeys []string
+	// numPages is the number of pages submitted, counted only for
+	// c.pageLimit.
+	numPages := 0
+	for i, f := range files {
+		mimeType := f.MimeType
+		if mimeType == "" && f.Name != "" {
+			mimeType, _ = mimeTypeFromPath(f.Name)
+		}
+		if mimeType == "" {
+			mimeType = http.DetectContentType(f.Contents)
+			if !SupportedMimeTypes[mimeType] {
+				return nil, fmt.Errorf("failed to infer MIME type of %v from its contents; it does not look like a PDF, BMP, GIF, JPEG or PNG file", fileName(f, i))
+			}
+		}
+		if !SupportedMimeTypes[mimeType] {
+			return nil, fmt.Errorf("the MIME type %v of %v is not supported", mimeType, fileName(f, i))
+		}
+		if err := checkContents(mimeType, f.Contents); err != nil {
+			rejected = append(rejected, RecognizedPage{
+				Error:               fmt.Sprintf("%v was not submitted: %v", fileName(f, i), err),
+				FileIndex:           i,
 				PageNumber:          1,
 				NumberOfPagesInFile: 1,
-				RecognizedText:      either.RecognizedText,
-				Base64Image:         either.Base64Image,
-			}
-			close(pagesChan)
-			return
+			})
+			continue
 		}
-		fileIndex2HaveSeenPage := make(map[int][]bool)
-		errorCount := 0
-		for {
-			time.Sleep(time.Millisecond * 500)
-			req, err := http.NewRequest("GET", either.PollingURL, nil)
+		if mimeType == "application/pdf" {
+			contents, err := decryptPDF(cfg, f)
 			if err != nil {
-				errorCount++
-				if errorCount >= 5 {
-					close(pagesChan)
-					return
-				}
+				rejected = append(rejected, RecognizedPage{
+					Error:               fmt.Sprintf("%v was not submitted: %v", fileName(f, i), err),
+					FileIndex:           i,
+					PageNumber:          1,
+					NumberOfPagesInFile: 1,
+				})
 				continue
 			}
-			req.Header.Set("Authorization", fmt.Sprintf("Basic %v", c.apiKey))
-			var httpClient http.Client
-			resp, err := httpClient.Do(req)
-			if err != nil {
-				errorCount++
-				if errorCount >= 5 {
-					close(pagesChan)
-					return
-				}
-				continue
+			f.Contents = contents
+		}
+		var selected []int
+		if len(f.Pages) != 0 {
+			var err error
+			if f.Contents, selected, err = selectPages(f, i, mimeType); err != nil {
+				return nil, err
+			}
+		}
+		contents := f.Contents
+		if cfg.MaxPagesPerFile > 0 && mimeType == "application/pdf" {
+			var err error
+			if contents, err = c.limitPages(cfg, f, i); err != nil {
+				return nil, err
 			}
-			if resp.StatusCode == 401 {
-				close(pagesChan)
-				return
-			} else if resp.StatusCode != 200 {
-				if errorCount >= 5 {
-					close(pagesChan)
-					return
+		}
+		if c.cache != nil {
+			key := CacheKey(cfg, mimeType, contents)
+			if pages, ok := c.cache.Get(key); ok {
+				for _, p := range pages {
+					p.FileIndex = i
+					p.PageNumber = originalPageNumber(selected, p.PageNumber)
+					// The page was not received for this request, and
+					// its Tags are those of the request which was.
+					p.SubmittedAt, p.FirstSeenAt, p.ProcessingDuration = nil, nil, 0
+					p.Tags = nil
+					cached = append(cached, p)
 				}
 				continue
 			}
-			var pages struct {
-				Pages []RecognizedPage
+			cacheKeys = append(cacheKeys, key)
+		}
+		if c.pageLimit != nil {
+			n, err := CountPages(File{MimeType: mimeType, Contents: contents})
+			if err != nil {
+				n = 1
 			}
-			if err := json.NewDecoder(resp.Body).Decode(&pages); err != nil {
-				errorCount++
-				if errorCount >= 5 {
-					close(pagesChan)
-					return
-				}
-				continue
+			numPages += n
+		}
+		submitted = append(submitted, i)
+		selections = append(selections, selected)
+		sr.Files = append(sr.Files, SightRequestFile{
+			MimeType:   mimeType,
+			Base64File: base64.StdEncoding.EncodeToString(contents),
+		})
+	}
+	requestID := newRequestID()
+	log := c.logger
+	for _, p := range rejected {
+		log.Warn("not submitting invalid file", "request", requestID, "file", fileName(files[p.FileIndex], p.FileIndex), "error", p.Error)
+	}
+	if len(cached) != 0 {
+		log.Info("using cached results", "request", requestID, "pages", len(cached))
+	}
+	rejected = append(rejected, cached...)
+	if len(submitted) == 0 {
+		pagesChan := make(chan RecognizedPage, len(rejected))
+		for _, p := range rejected {
+			pagesChan <- p
+		}
+		close(pagesChan)
+		return pagesChan, nil
+	}
+	buf, err := json.Marshal(&sr)
+	if err != nil {
+		return nil, err
+	}
+	idempotencyKey := cfg.IdempotencyKey
+	if idempotencyKey == "" {
+		idempotencyKey = newUUID()
+	}
+	log.Info("submitting files to the Sight API", "request", requestID, "files", len(sr.Files), "bytes", len(buf), "idempotency_key", idempotencyKey)
+	var resp *http.Response
+	// The request is safe to send again, thanks to its idempotency key,
+	// when it is rate limited or fails without a response.
+	failures, rateLimited := 0, 0
+	submittedAt := time.Now()
+	// key is the key of c.keyPool with which the request is sent, and so
+	// its job polled.
+	var key string
+	ctx := limits.context()
+	for {
+		c.waitForRateLimit(numPages, requestID)
+		var body io.Reader = bytes.NewReader(buf)
+		if cfg.OnUploadProgress != nil {
+			body = &progressReader{r: body, total: int64(len(buf)), onProgress: cfg.OnUploadProgress}
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, body)
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = int64(len(buf))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+		if c.keyPool != nil {
+			if key, err = c.keyPool.pick(); err != nil {
+				return nil, err
 			}
-			for _, p := range pages.Pages {
-				haveSeenPage, ok := fileIndex2HaveSeenPage[p.FileIndex]
-				if !ok || len(haveSeenPage) == 0 {
-					fileIndex2HaveSeenPage[p.FileIndex] = make([]bool, p.NumberOfPagesInFile, p.NumberOfPagesInFile)
-				}
-				if p.PageNumber > 0 {
-					fileIndex2HaveSeenPage[p.FileIndex][p.PageNumber-1] = true
-				}
-				pagesChan <- p
+			req = req.WithContext(withAPIKey(req.Context(), key))
+		}
+		if resp, err = c.do(req, cfg.RequestTimeout); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
 			}
-			haveSeenEverything := true
-			for fileIndex := 0; fileIndex < len(filePaths); fileIndex++ {
-				haveSeenPage, ok := fileIndex2HaveSeenPage[fileIndex]
-				if !ok {
-					haveSeenEverything = false
-					break
-				}
-				haveSeenAllPagesInThisFile := true
-				for _, v := range haveSeenPage {
-					if !v {
-						haveSeenAllPagesInThisFile = false
-						break
-					}
-				}
-				if !haveSeenAllPagesInThisFile {
-					haveSeenEverything = false
-					break
-				}
+			if failures == maxSubmitFailures {
+				log.Error("initial HTTP request failed", "request", requestID, "error", err)
+				return nil, err
+			}
+			wait := time.Second << uint(failures)
+			if limits.expireWithin(wait) {
+				log.Error("initial HTTP request failed", "request", requestID, "error", err)
+				return nil, fmt.Errorf("%v, and there is no time left to send it again: %v", ErrJobDeadline, err)
 			}
-			if haveSeenEverything {
-				close(pagesChan)
-				break
+			failures++
+			log.Warn("initial HTTP request failed; sending it again", "request", requestID, "failures", failures, "wait", wait, "error", err)
+			if !sleep(ctx, wait) {
+				return nil, ctx.Err()
 			}
+			continue
+		}
+		if resp.StatusCode == 401 && c.keyPool != nil && c.keyPool.usable() {
+			drain(resp.Body)
+			resp.Body.Close()
+			log.Warn("API key rejected by the Sight API; submitting with another", "request", requestID)
+			continue
+		}
+		if resp.StatusCode != 429 || rateLimited == maxRateLimitedRetries {
+			break
+		}
+		wait := retryAfter(resp, rateLimited)
+		if c.keyPool != nil && c.keyPool.usable() {
+			// Another key of the pool is not rate limited.
+			wait = 0
+		}
+		if limits.expireWithin(wait) {
+			break
 		}
+		rateLimited++
+		drain(resp.Body)
+		resp.Body.Close()
+		log.Warn("rate limited by the Sight API; submitting again later", "request", requestID, "retry", rateLimited, "wait", wait)
+		if !sleep(ctx, wait) {
+			return nil, ctx.Err()
+		}
+	}
+	defer resp.Body.Close()
+	serverRequestID := resp.Header.Get(requestIDHeader)
+	log.Debug("received initial HTTP response", "request", requestID, "status", resp.StatusCode, "server_request", serverRequestID)
+	if resp.StatusCode != 200 {
+		body, err := ioutil.ReadAll(resp.Body)
+		return nil, &SubmitError{StatusCode: resp.StatusCode, RequestID: serverRequestID, Body: string(body), readErr: err}
+	}
+	var either struct {
+		PollingURL             string
+		RecognizedText         []RecognizedText
+		Base64Image            string
+		Width, Height, DPI     int
+		AppliedRotationDegrees int
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&either); err != nil {
+		return nil, fmt.Errorf("This should never happen and is not your fault: failed to decode body of initial HTTP request; error: %v", err)
+	}
+	job := Job{URL: either.PollingURL, ID: resp.Header.Get(jobIDHeader), SubmittedAt: &submittedAt, FileIndices: submitted, Selections: selections, key: key}
+	if job.URL != "" && cfg.OnJobStarted != nil {
+		cfg.OnJobStarted(job)
+	}
+
+	pagesChan := make(chan RecognizedPage, 16)
+	go func() {
+		for _, p := range rejected {
+			pagesChan <- p
+		}
+		if either.PollingURL == "" {
+			log.Info("received results in the initial HTTP response", "request", requestID)
+			page := RecognizedPage{
+				Error:                  "",
+				FileIndex:              0,
+				PageNumber:             1,
+				NumberOfPagesInFile:    1,
+				RecognizedText:         either.RecognizedText,
+				Base64Image:            either.Base64Image,
+				Width:                  either.Width,
+				Height:                 either.Height,
+				DPI:                    either.DPI,
+				AppliedRotationDegrees: either.AppliedRotationDegrees,
+				RequestID:              serverRequestID,
+				JobID:                  job.ID,
+			}
+			job.received(&page)
+			fillDimensions(&page)
+			if c.cache != nil {
+				c.putCache(cacheKeys[0], []RecognizedPage{page}, requestID)
+			}
+			page.FileIndex = submitted[0]
+			page.PageNumber = originalPageNumber(selections[0], 1)
+			pagesChan <- page
+			close(pagesChan)
+			return
+		}
+		if c.cache == nil {
+			c.pollJob(job, make(map[int][]bool), requestID, limits, cfg.OnPoll, pagesChan)
+			return
+		}
+		polled := make(chan RecognizedPage, 16)
+		go c.pollJob(job, make(map[int][]bool), requestID, limits, cfg.OnPoll, polled)
+		c.cachePages(job, cacheKeys, requestID, polled, pagesChan)
 	}()
 	return pagesChan, nil
 }
+
+// maxSubmitFailures is the number of times the initial HTTP request is sent
+// again after failing without a response before giving up.
+const maxSubmitFailures = 3
+
+const (
+	// requestIDHeader identifies a response on the servers of Siftrics.
+	requestIDHeader = "X-Request-Id"
+	// jobIDHeader identifies the job started by an initial request.
+	jobIDHeader = "X-Job-Id"
+)
+
+// SubmitError is a response to the initial HTTP request, which submits the
+// files, whose status is not 200 OK. It unwraps to ErrUnauthorized if the
+// API key was rejected.
+type SubmitError struct {
+	StatusCode int
+	// RequestID is the X-Request-Id header of the response, or empty if
+	// it had none. Quote it when reporting the problem to Siftrics.
+	RequestID string
+	// Body is the body of the response.
+	Body string
+
+	readErr error
+}
+
+func (e *SubmitError) Error() string {
+	var msg string
+	switch {
+	case e.StatusCode == 401:
+		msg = "Invalid API key; Received 401 Unauthorized from initial HTTP request to the Sight API."
+	case e.readErr != nil:
+		msg = fmt.Sprintf("Non-200 response from initial HTTP request to the Sight API. Status of initial HTTP response: %v. Furthermore, failed to read body of initial HTTP response.", e.StatusCode)
+	default:
+		msg = fmt.Sprintf("Non-200 response from initial HTTP request to the Sight API. Status of initial HTTP response: %v. Body of initial HTTP response:\n%v", e.StatusCode, e.Body)
+	}
+	if e.RequestID != "" {
+		msg += fmt.Sprintf("\nRequest ID: %v", e.RequestID)
+	}
+	return msg
+}
+
+func (e *SubmitError) Unwrap() error {
+	if e.StatusCode == 401 {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+func haveSeenEverything(fileIndex2HaveSeenPage map[int][]bool, numFiles int) bool {
+	for fileIndex := 0; fileIndex < numFiles; fileIndex++ {
+		haveSeenPage, ok := fileIndex2HaveSeenPage[fileIndex]
+		if !ok {
+			return false
+		}
+		for _, v := range haveSeenPage {
+			if !v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fileName returns a name for f, the i-th file, for use in error messages.
+func fileName(f File, i int) string {
+	if f.Name != "" {
+		return f.Name
+	}
+	return fmt.Sprintf("file %v", i)
+}
+
+// progressReader reports the number of bytes read from r.
+type progressReader struct {
+	r          io.Reader
+	sent       int64
+	total      int64
+	onProgress func(bytesSent, total int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.sent += int64(n)
+		pr.onProgress(pr.sent, pr.total)
+	}
+	return n, err
+}
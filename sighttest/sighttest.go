@@ -0,0 +1,279 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package sighttest runs an in-process fake of the Sight API, so that code
+// built on a sight.Client can be tested without network access or an API
+// key. The fake speaks the same protocol as the Sight API: files are
+// submitted in an initial request, and their pages are polled for.
+//
+//	srv := sighttest.NewServer()
+//	defer srv.Close()
+//	pages, err := srv.Client().RecognizeFiles(cfg, files...)
+package sighttest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/internal/pdf"
+)
+
+// APIKey is the API key the Server accepts, as a Basic or Bearer
+// credential. Requests with any other key are answered with 401
+// Unauthorized.
+const APIKey = "00000000-0000-0000-0000-000000000000"
+
+// APIVersion is the version the Server reports in the X-API-Version header
+// of every response.
+const APIVersion = "1"
+
+// Server is a fake of the Sight API. Its fields configure how it responds
+// and must not be changed while it is serving requests.
+type Server struct {
+	*httptest.Server
+
+	// Pages returns the pages recognized in a submitted file. The Server
+	// sets their FileIndex, PageNumber and NumberOfPagesInFile. If nil,
+	// DefaultPages is used.
+	Pages func(file sight.SightRequestFile) []sight.RecognizedPage
+	// PagesPerPoll is the most pages sent in each polling response, so
+	// that results arrive over several polls. If zero, all of a job's
+	// pages are sent in the first.
+	PagesPerPoll int
+	// Immediate makes the Server send the results of a request for a
+	// single one-page file in the initial response, as the Sight API
+	// may, rather than a polling URL.
+	Immediate bool
+	// SubmitStatus, if not zero, is the status of the response to every
+	// initial request, e.g., http.StatusServiceUnavailable.
+	SubmitStatus int
+	// PollErrors is the number of polling requests for each job which are
+	// answered with 500 Internal Server Error before its pages are sent.
+	PollErrors int
+	// PageQuota is the quota reported by GET /api/sight/usage, whose
+	// PagesProcessed counts the pages of every submitted file.
+	PageQuota int
+
+	mu       sync.Mutex
+	requests []sight.SightRequest
+	jobs     map[string]*job
+	pages    int
+	// responses holds the response to each request with an
+	// Idempotency-Key header, by key, so that the same response is sent
+	// if the request is sent again.
+	responses map[string]response
+	// served counts responses, to number their X-Request-Id headers.
+	served uint64
+}
+
+// response is the response to an initial request: its body and the
+// X-Job-Id header, if it started a job.
+type response struct {
+	jobID string
+	body  []byte
+}
+
+// job is a submitted request whose pages have not all been polled for.
+type job struct {
+	pages  []sight.RecognizedPage
+	errors int
+}
+
+// NewServer starts a Server. Call Close when done with it.
+func NewServer() *Server {
+	s := &Server{jobs: make(map[string]*job), responses: make(map[string]response)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Client returns a Client which submits files to s.
+func (s *Server) Client(opts ...sight.Option) *sight.Client {
+	opts = append([]sight.Option{sight.WithEndpoint(s.URL + "/api/sight/")}, opts...)
+	return sight.NewClient(APIKey, opts...)
+}
+
+// Requests returns the requests submitted so far, in order. A request sent
+// again with the same Idempotency-Key header is answered as it was the
+// first time and is not included again.
+func (s *Server) Requests() []sight.SightRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sight.SightRequest(nil), s.requests...)
+}
+
+// DefaultPages returns a page for each page of a PDF, or a single page for
+// an image. Each page has one RecognizedText, "page N", with confidence 1.
+// A PDF which cannot be read yields a single page with an Error.
+func DefaultPages(file sight.SightRequestFile) []sight.RecognizedPage {
+	n := 1
+	if file.MimeType == "application/pdf" {
+		contents, err := base64.StdEncoding.DecodeString(file.Base64File)
+		if err != nil {
+			return []sight.RecognizedPage{{Error: fmt.Sprintf("invalid base64: %v", err)}}
+		}
+		r, err := pdf.NewReader(contents)
+		if err == nil {
+			n, err = r.NumPages()
+		}
+		if err != nil {
+			return []sight.RecognizedPage{{Error: fmt.Sprintf("failed to read PDF: %v", err)}}
+		}
+	}
+	pages := make([]sight.RecognizedPage, n)
+	for i := range pages {
+		pages[i].RecognizedText = []sight.RecognizedText{{
+			Text:         fmt.Sprintf("page %v", i+1),
+			TopLeftX:     10,
+			TopLeftY:     10,
+			TopRightX:    110,
+			TopRightY:    10,
+			BottomLeftX:  10,
+			BottomLeftY:  30,
+			BottomRightX: 110,
+			BottomRightY: 30,
+			Confidence:   1,
+		}}
+	}
+	return pages
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-API-Version", APIVersion)
+	w.Header().Set("X-Request-Id", fmt.Sprintf("req-%v", atomic.AddUint64(&s.served, 1)))
+	if auth := r.Header.Get("Authorization"); auth != "Basic "+APIKey && auth != "Bearer "+APIKey {
+		http.Error(w, "invalid API key", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case r.Method == "POST" && r.URL.Path == "/api/sight/":
+		s.submit(w, r)
+	case r.Method == "GET" && r.URL.Path == "/api/sight/usage":
+		s.usage(w)
+	case r.Method == "GET" && r.URL.Path == "/api/sight/scripts":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(struct {
+			Scripts []string
+		}{sight.SupportedScriptCodes()})
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/poll/"):
+		s.poll(w, strings.TrimPrefix(r.URL.Path, "/poll/"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) submit(w http.ResponseWriter, r *http.Request) {
+	if s.SubmitStatus != 0 {
+		http.Error(w, http.StatusText(s.SubmitStatus), s.SubmitStatus)
+		return
+	}
+	var sr sight.SightRequest
+	if err := json.NewDecoder(r.Body).Decode(&sr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pagesOf := s.Pages
+	if pagesOf == nil {
+		pagesOf = DefaultPages
+	}
+	var pages []sight.RecognizedPage
+	for i, f := range sr.Files {
+		filePages := pagesOf(f)
+		for j := range filePages {
+			filePages[j].FileIndex = i
+			filePages[j].PageNumber = j + 1
+			filePages[j].NumberOfPagesInFile = len(filePages)
+			// Echo the tags of the request, as the Sight API does.
+			filePages[j].Tags = sr.Tags
+		}
+		pages = append(pages, filePages...)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	key := r.Header.Get("Idempotency-Key")
+	resp, ok := s.responses[key]
+	if !ok || key == "" {
+		s.requests = append(s.requests, sr)
+		s.pages += len(pages)
+		if s.Immediate && len(pages) == 1 && pages[0].Error == "" {
+			resp.body, _ = json.Marshal(struct {
+				RecognizedText []sight.RecognizedText
+			}{pages[0].RecognizedText})
+		} else {
+			id := fmt.Sprint(len(s.requests))
+			s.jobs[id] = &job{pages: pages}
+			resp.jobID = "job-" + id
+			resp.body, _ = json.Marshal(struct {
+				PollingURL string
+			}{s.URL + "/poll/" + id})
+		}
+		if key != "" {
+			s.responses[key] = resp
+		}
+	}
+	if resp.jobID != "" {
+		w.Header().Set("X-Job-Id", resp.jobID)
+	}
+	w.Write(resp.body)
+}
+
+func (s *Server) poll(w http.ResponseWriter, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		http.Error(w, "no such job", http.StatusNotFound)
+		return
+	}
+	if j.errors < s.PollErrors {
+		j.errors++
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+	n := len(j.pages)
+	if s.PagesPerPoll > 0 && s.PagesPerPoll < n {
+		n = s.PagesPerPoll
+	}
+	pages := j.pages[:n]
+	j.pages = j.pages[n:]
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Pages []sight.RecognizedPage
+	}{pages})
+}
+
+func (s *Server) usage(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := sight.Usage{PagesProcessed: s.pages, PageQuota: s.PageQuota}
+	if s.pages < s.PageQuota {
+		u.PagesRemaining = s.PageQuota - s.pages
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(u)
+}
@@ -0,0 +1,140 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"database/sql"
+)
+
+// Sink stores recognized pages as they are received, e.g., in a database,
+// as an alternative to collecting them into one large JSON document.
+type Sink interface {
+	// WritePage stores page, which was recognized in the file named
+	// file. Pages arrive in no particular order.
+	WritePage(file string, page RecognizedPage) error
+	// Close finishes writing. WritePage is not called after it.
+	Close() error
+}
+
+// SQLiteSink is a Sink which writes pages and their text elements into the
+// tables pages and texts of a SQLite database, which are created if they do
+// not exist, so that results can be queried in SQL:
+//
+//	SELECT p.file, p.page_number, t.text FROM texts t
+//	JOIN pages p ON p.id = t.page_id WHERE t.text LIKE 'Invoice%';
+//
+// The text and file columns are indexed. The database is opened by the
+// caller with whichever SQLite driver it links, and is not closed by Close.
+type SQLiteSink struct {
+	db *sql.DB
+}
+
+var _ Sink = (*SQLiteSink)(nil)
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS pages (
+		id INTEGER PRIMARY KEY,
+		file TEXT NOT NULL,
+		file_index INTEGER NOT NULL,
+		page_number INTEGER NOT NULL,
+		pages_in_file INTEGER NOT NULL,
+		error TEXT NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS pages_file ON pages (file, page_number)`,
+	`CREATE TABLE IF NOT EXISTS texts (
+		id INTEGER PRIMARY KEY,
+		page_id INTEGER NOT NULL REFERENCES pages (id),
+		position INTEGER NOT NULL,
+		text TEXT NOT NULL,
+		confidence REAL NOT NULL,
+		language TEXT NOT NULL,
+		top_left_x INTEGER NOT NULL,
+		top_left_y INTEGER NOT NULL,
+		top_right_x INTEGER NOT NULL,
+		top_right_y INTEGER NOT NULL,
+		bottom_left_x INTEGER NOT NULL,
+		bottom_left_y INTEGER NOT NULL,
+		bottom_right_x INTEGER NOT NULL,
+		bottom_right_y INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS texts_text ON texts (text)`,
+	`CREATE INDEX IF NOT EXISTS texts_page ON texts (page_id)`,
+}
+
+// NewSQLiteSink creates the tables of a SQLiteSink in db if they do not
+// exist. Pages are added to those already there.
+func NewSQLiteSink(db *sql.DB) (*SQLiteSink, error) {
+	for _, stmt := range sqliteSchema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, err
+		}
+	}
+	return &SQLiteSink{db: db}, nil
+}
+
+// WritePage inserts page and its text elements in one transaction,
+// replacing any page already stored with the same file and page number,
+// e.g., one which failed and was retried.
+func (s *SQLiteSink) WritePage(file string, page RecognizedPage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM texts WHERE page_id IN (SELECT id FROM pages WHERE file = ? AND page_number = ?)`, file, page.PageNumber); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM pages WHERE file = ? AND page_number = ?`, file, page.PageNumber); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`INSERT INTO pages (file, file_index, page_number, pages_in_file, error, width, height) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		file, page.FileIndex, page.PageNumber, page.NumberOfPagesInFile, page.Error, page.Width, page.Height)
+	if err != nil {
+		return err
+	}
+	pageID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO texts (page_id, position, text, confidence, language,
+		top_left_x, top_left_y, top_right_x, top_right_y,
+		bottom_left_x, bottom_left_y, bottom_right_x, bottom_right_y)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for i, t := range page.RecognizedText {
+		if _, err := stmt.Exec(pageID, i, t.Text, t.Confidence, t.Language,
+			t.TopLeftX, t.TopLeftY, t.TopRightX, t.TopRightY,
+			t.BottomLeftX, t.BottomLeftY, t.BottomRightX, t.BottomRightY); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Close does nothing; the database belongs to the caller.
+func (s *SQLiteSink) Close() error {
+	return nil
+}
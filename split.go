@@ -0,0 +1,105 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+// RecognizeEach is RecognizeFiles with a channel for each file instead of
+// one for all of them; see SplitByFile.
+func (c *Client) RecognizeEach(cfg Config, files ...File) ([]<-chan RecognizedPage, error) {
+	pages, err := c.RecognizeFiles(cfg, files...)
+	if err != nil {
+		return nil, err
+	}
+	return SplitByFile(pages, len(files)), nil
+}
+
+// SplitByFile splits pages, e.g., from RecognizeFiles or ResumeJob, into a
+// channel for each of numFiles files, so that each document can be
+// processed on its own without checking FileIndex. The channel of a file
+// is closed once as many distinct pages of it have been sent as its
+// NumberOfPagesInFile, or once pages is closed.
+//
+// Each channel queues its pages for as long as it is not read, without
+// holding up the others, so the files may be processed one after another,
+// in any order, or each in a goroutine of its own. Pages whose FileIndex
+// is not below numFiles are dropped.
+func SplitByFile(pages <-chan RecognizedPage, numFiles int) []<-chan RecognizedPage {
+	ins := make([]chan RecognizedPage, numFiles)
+	outs := make([]<-chan RecognizedPage, numFiles)
+	for i := range ins {
+		ins[i] = make(chan RecognizedPage)
+		outs[i] = queuePages(ins[i])
+	}
+	go func() {
+		seen := make([]map[int]bool, numFiles)
+		for p := range pages {
+			i := p.FileIndex
+			if i < 0 || i >= numFiles || ins[i] == nil {
+				continue
+			}
+			ins[i] <- p
+			if seen[i] == nil {
+				seen[i] = make(map[int]bool)
+			}
+			seen[i][p.PageNumber] = true
+			if len(seen[i]) >= p.NumberOfPagesInFile {
+				close(ins[i])
+				ins[i] = nil
+			}
+		}
+		for _, in := range ins {
+			if in != nil {
+				close(in)
+			}
+		}
+	}()
+	return outs
+}
+
+// queuePages sends the pages from in on the channel it returns, queueing
+// as many as are not read yet, and closes it after in is closed.
+func queuePages(in <-chan RecognizedPage) <-chan RecognizedPage {
+	out := make(chan RecognizedPage)
+	go func() {
+		var queue []RecognizedPage
+		for in != nil || len(queue) > 0 {
+			// Sending on a nil channel blocks, so nothing is sent while
+			// the queue is empty.
+			var send chan<- RecognizedPage
+			var next RecognizedPage
+			if len(queue) > 0 {
+				send, next = out, queue[0]
+			}
+			select {
+			case p, ok := <-in:
+				if !ok {
+					in = nil
+					continue
+				}
+				queue = append(queue, p)
+			case send <- next:
+				queue[0] = RecognizedPage{}
+				queue = queue[1:]
+			}
+		}
+		close(out)
+	}()
+	return out
+}
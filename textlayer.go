@@ -0,0 +1,302 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"math"
+	"strings"
+	"unicode"
+
+	"github.com/siftrics/sight/internal/pdf"
+)
+
+const (
+	// textLayerDPI is the resolution of the page coordinates of text
+	// extracted from PDFs: at 72 DPI, a pixel is a PDF point.
+	textLayerDPI = 72
+	// minTextLayerChars is the fewest characters a page must draw for its
+	// text layer to be used.
+	minTextLayerChars = 16
+	// wordGap and sentenceGap are the widest gaps, relative to the height
+	// of the text, between glyphs of one word and between words of one
+	// sentence.
+	wordGap     = 0.2
+	sentenceGap = 0.8
+)
+
+// recognizeTextPDFs implements Config.SkipTextPDFs: the text layer of each
+// page of a PDF which has one is extracted locally, and only the other files
+// and pages are submitted.
+func (c *Client) recognizeTextPDFs(cfg Config, files []File) (<-chan RecognizedPage, error) {
+	var extracted []RecognizedPage
+	var submit []File
+	// indices maps indices into submit to indices into files, and
+	// numPages holds the NumberOfPagesInFile of the PDFs whose text was
+	// partly extracted, which the Sight API would count as only the pages
+	// submitted.
+	var indices []int
+	numPages := make(map[int]int)
+	for i, f := range files {
+		if !isPDF(f) {
+			submit = append(submit, f)
+			indices = append(indices, i)
+			continue
+		}
+		pages, scanned, n, err := textLayerPages(f, pdfPasswords(cfg, f), cfg.MakeSentences)
+		if err != nil || len(pages) == 0 {
+			if err != nil {
+				c.logger.Debug("failed to read the text layer of a PDF; submitting it", "file", fileName(f, i), "error", err)
+			}
+			submit = append(submit, f)
+			indices = append(indices, i)
+			continue
+		}
+		c.logger.Info("extracted the text layer of a PDF", "file", fileName(f, i), "pages", len(pages), "submitted", len(scanned))
+		for _, p := range pages {
+			p.FileIndex = i
+			p.NumberOfPagesInFile = n
+			extracted = append(extracted, p)
+		}
+		if len(scanned) != 0 {
+			f.Pages = scanned
+			submit = append(submit, f)
+			indices = append(indices, i)
+			numPages[i] = n
+		}
+	}
+	pagesChan := make(chan RecognizedPage, 16)
+	if len(submit) == 0 {
+		go func() {
+			for _, p := range extracted {
+				pagesChan <- p
+			}
+			close(pagesChan)
+		}()
+		return pagesChan, nil
+	}
+	if onJobStarted := cfg.OnJobStarted; onJobStarted != nil {
+		cfg.OnJobStarted = func(job Job) {
+			onJobStarted(job.withIndices(indices))
+		}
+	}
+	pages, err := c.recognizeUnique(cfg, submit)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for _, p := range extracted {
+			pagesChan <- p
+		}
+		for p := range pages {
+			if p.FileIndex >= 0 && p.FileIndex < len(indices) {
+				p.FileIndex = indices[p.FileIndex]
+			}
+			if n, ok := numPages[p.FileIndex]; ok {
+				p.NumberOfPagesInFile = n
+			}
+			pagesChan <- p
+		}
+		close(pagesChan)
+	}()
+	return pagesChan, nil
+}
+
+// withIndices returns job, a job for some of the files passed to
+// RecognizeFiles, where indices maps their positions among those files to
+// their indices among all the files, as a job for all the files.
+func (job Job) withIndices(indices []int) Job {
+	fileIndices := make([]int, len(job.FileIndices))
+	for j, i := range job.FileIndices {
+		fileIndices[j] = indices[i]
+	}
+	job.FileIndices = fileIndices
+	if job.Duplicates != nil {
+		duplicates := make(map[int][]int, len(job.Duplicates))
+		for i, copies := range job.Duplicates {
+			mapped := make([]int, len(copies))
+			for k, c := range copies {
+				mapped[k] = indices[c]
+			}
+			duplicates[indices[i]] = mapped
+		}
+		job.Duplicates = duplicates
+	}
+	return job
+}
+
+// textLayerPages reads the text layer of the pages of the PDF f which are
+// selected by f.Pages, or of all its pages, decrypting it with one of
+// passwords if it is encrypted. pages are those whose text was
+// extracted, and scanned the numbers of those without a usable text layer,
+// which must be recognized. numPages is the number of pages considered.
+func textLayerPages(f File, passwords []string, makeSentences bool) (pages []RecognizedPage, scanned []int, numPages int, err error) {
+	r, err := openPDF(f.Contents, passwords)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	all, err := r.Pages()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	numbers := uniquePages(append([]int(nil), f.Pages...))
+	if len(numbers) == 0 {
+		for n := 1; n <= len(all); n++ {
+			numbers = append(numbers, n)
+		}
+	}
+	for _, n := range numbers {
+		if n < 1 || n > len(all) {
+			// Left for selectPages to report.
+			scanned = append(scanned, n)
+			continue
+		}
+		page := all[n-1]
+		content, err := r.PageContent(page)
+		if err != nil {
+			scanned = append(scanned, n)
+			continue
+		}
+		texts, ok := textLayer(page, content, makeSentences)
+		if !ok {
+			scanned = append(scanned, n)
+			continue
+		}
+		pages = append(pages, RecognizedPage{
+			PageNumber:     n,
+			RecognizedText: texts,
+			Width:          int(math.Round(page.Width() * textLayerDPI / 72)),
+			Height:         int(math.Round(page.Height() * textLayerDPI / 72)),
+			DPI:            textLayerDPI,
+		})
+	}
+	return pages, scanned, len(numbers), nil
+}
+
+// textLayer groups the glyphs drawn on page into words, or sentences if
+// makeSentences is set, in page coordinates. ok is false if the page has
+// no usable text layer: if it draws too few characters, if too many of
+// them cannot be decoded, or if it is mostly covered by images over which
+// the text is drawn visibly, as a stamp or header on a scanned page would
+// be.
+func textLayer(page pdf.Page, content *pdf.PageContent, makeSentences bool) (texts []RecognizedText, ok bool) {
+	var decoded, unknown, invisible int
+	for _, g := range content.Glyphs {
+		switch {
+		case g.Text == "":
+			unknown++
+		case strings.TrimSpace(g.Text) != "":
+			decoded++
+			if g.Invisible {
+				invisible++
+			}
+		}
+	}
+	if decoded < minTextLayerChars || unknown*10 > decoded {
+		return nil, false
+	}
+	if content.ImageArea > page.Width()*page.Height()/2 && invisible*2 < decoded {
+		return nil, false
+	}
+	scale := float64(textLayerDPI) / 72
+	var words []textRun
+	breakWord := true
+	for _, g := range content.Glyphs {
+		if strings.TrimFunc(g.Text, unicode.IsSpace) == "" {
+			breakWord = true
+			continue
+		}
+		var quad [4][2]float64
+		for k, p := range g.Quad {
+			u, v := page.FromUserSpace(p[0], p[1])
+			quad[k] = [2]float64{u * scale, v * scale}
+		}
+		if !breakWord && words[len(words)-1].continuedBy(quad, wordGap) {
+			words[len(words)-1].extend(g.Text, quad)
+		} else {
+			words = append(words, textRun{text: g.Text, quad: quad})
+		}
+		breakWord = false
+	}
+	runs := words
+	if makeSentences {
+		runs = nil
+		for _, w := range words {
+			if len(runs) != 0 && runs[len(runs)-1].continuedBy(w.quad, sentenceGap) {
+				runs[len(runs)-1].extend(" "+w.text, w.quad)
+			} else {
+				runs = append(runs, w)
+			}
+		}
+	}
+	for _, run := range runs {
+		texts = append(texts, run.recognizedText())
+	}
+	return texts, true
+}
+
+// textRun is a word or sentence of a text layer, with its bottom-left,
+// bottom-right, top-right and top-left corners in page coordinates.
+type textRun struct {
+	text string
+	quad [4][2]float64
+}
+
+// continuedBy reports whether a glyph or word with the corners quad
+// continues the run: whether it starts on the run's baseline, within gap
+// times the height of the run from its end.
+func (r *textRun) continuedBy(quad [4][2]float64, gap float64) bool {
+	bl, br, tr := r.quad[0], r.quad[1], r.quad[2]
+	height := math.Hypot(tr[0]-br[0], tr[1]-br[1])
+	if height == 0 {
+		return false
+	}
+	// The direction of the baseline is perpendicular to the sides.
+	ux, uy := bl[1]-r.quad[3][1], r.quad[3][0]-bl[0]
+	ux, uy = ux/height, uy/height
+	if ux*(br[0]-bl[0])+uy*(br[1]-bl[1]) < 0 {
+		ux, uy = -ux, -uy
+	}
+	dx, dy := quad[0][0]-br[0], quad[0][1]-br[1]
+	along := dx*ux + dy*uy
+	across := dy*ux - dx*uy
+	return math.Abs(across) < 0.3*height && along > -0.3*height && along < gap*height
+}
+
+func (r *textRun) extend(text string, quad [4][2]float64) {
+	r.text += text
+	r.quad[1], r.quad[2] = quad[1], quad[2]
+}
+
+func (r textRun) recognizedText() RecognizedText {
+	round := func(v float64) int { return int(math.Round(v)) }
+	return RecognizedText{
+		Text:         r.text,
+		BottomLeftX:  round(r.quad[0][0]),
+		BottomLeftY:  round(r.quad[0][1]),
+		BottomRightX: round(r.quad[1][0]),
+		BottomRightY: round(r.quad[1][1]),
+		TopRightX:    round(r.quad[2][0]),
+		TopRightY:    round(r.quad[2][1]),
+		TopLeftX:     round(r.quad[3][0]),
+		TopLeftY:     round(r.quad[3][1]),
+		Confidence:   1,
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/sighttest"
+)
+
+func TestPageTimings(t *testing.T) {
+	s := sighttest.NewServer()
+	defer s.Close()
+	c := s.Client()
+
+	pages, err := c.RecognizeFiles(sight.Config{}, testImage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for p := range pages {
+		if p.SubmittedAt == nil || p.FirstSeenAt == nil {
+			t.Fatalf("page has SubmittedAt %v and FirstSeenAt %v; want both", p.SubmittedAt, p.FirstSeenAt)
+		}
+		if p.FirstSeenAt.Before(*p.SubmittedAt) || p.ProcessingDuration != p.FirstSeenAt.Sub(*p.SubmittedAt) {
+			t.Errorf("page has SubmittedAt %v, FirstSeenAt %v and ProcessingDuration %v", p.SubmittedAt, p.FirstSeenAt, p.ProcessingDuration)
+		}
+	}
+}
+
+func TestPageTimingsOmitted(t *testing.T) {
+	b, err := json.Marshal(sight.RecognizedPage{FileName: "a.png"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"SubmittedAt", "FirstSeenAt", "ProcessingDuration"} {
+		if strings.Contains(string(b), field) {
+			t.Errorf("%s contains %v", b, field)
+		}
+	}
+}
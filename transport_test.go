@@ -0,0 +1,279 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/sighttest"
+)
+
+// testProxy is an HTTP proxy which requires the credentials in its URL. It
+// forwards plain requests to forward, whatever their host, and tunnels
+// CONNECT requests to tunnel, so that clients may use hosts which do not
+// resolve.
+type testProxy struct {
+	*httptest.Server
+	forward *url.URL
+	tunnel  string
+
+	mu sync.Mutex
+	// seen holds the method and host of each request with valid
+	// credentials, in order.
+	seen []string
+	// rejected counts requests without valid credentials.
+	rejected int
+}
+
+func newTestProxy(forward, tunnel string) *testProxy {
+	p := &testProxy{tunnel: tunnel}
+	p.forward, _ = url.Parse(forward)
+	p.Server = httptest.NewServer(http.HandlerFunc(p.serveHTTP))
+	return p
+}
+
+// proxyURL returns the URL of p with user and password.
+func (p *testProxy) proxyURL(user, password string) *url.URL {
+	u, _ := url.Parse(p.URL)
+	u.User = url.UserPassword(user, password)
+	return u
+}
+
+func (p *testProxy) requests() ([]string, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.seen...), p.rejected
+}
+
+func (p *testProxy) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	want := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:secret"))
+	p.mu.Lock()
+	if r.Header.Get("Proxy-Authorization") != want {
+		p.rejected++
+		p.mu.Unlock()
+		w.Header().Set("Proxy-Authenticate", `Basic realm="test"`)
+		http.Error(w, "proxy authentication required", http.StatusProxyAuthRequired)
+		return
+	}
+	p.seen = append(p.seen, r.Method+" "+r.Host)
+	p.mu.Unlock()
+
+	if r.Method == http.MethodConnect {
+		p.connect(w)
+		return
+	}
+	if !r.URL.IsAbs() {
+		http.Error(w, "request is not for a proxy", http.StatusBadRequest)
+		return
+	}
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.URL.Scheme = p.forward.Scheme
+	out.URL.Host = p.forward.Host
+	out.Host = ""
+	out.Header.Del("Proxy-Authorization")
+	resp, err := http.DefaultTransport.RoundTrip(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+func (p *testProxy) connect(w http.ResponseWriter) {
+	upstream, err := net.Dial("tcp", p.tunnel)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	rw.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+	rw.Flush()
+	go func() {
+		io.Copy(upstream, rw)
+		upstream.Close()
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+}
+
+func testImage(t *testing.T) sight.File {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 10, 10))); err != nil {
+		t.Fatal(err)
+	}
+	return sight.File{Name: "a.png", MimeType: "image/png", Contents: buf.Bytes()}
+}
+
+// recognize recognizes a single image with c and fails t if any page has
+// an error.
+func recognize(t *testing.T, c *sight.Client) {
+	t.Helper()
+	pages, err := c.RecognizeFiles(sight.Config{}, testImage(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for p := range pages {
+		if p.Error != "" {
+			t.Fatal(p.Error)
+		}
+		n++
+	}
+	if n != 1 {
+		t.Fatalf("received %v pages; want 1", n)
+	}
+}
+
+func TestWithProxy(t *testing.T) {
+	srv := sighttest.NewServer()
+	defer srv.Close()
+	proxy := newTestProxy(srv.URL, "")
+	defer proxy.Close()
+
+	c := sight.NewClient(sighttest.APIKey,
+		sight.WithEndpoint("http://sight.test/api/sight/"),
+		sight.WithProxy(proxy.proxyURL("user", "secret")))
+	recognize(t, c)
+	seen, rejected := proxy.requests()
+	if len(seen) < 2 || seen[0] != "POST sight.test" {
+		t.Errorf("proxy received %q; want the initial request to sight.test and polling requests", seen)
+	}
+	if rejected != 0 {
+		t.Errorf("proxy rejected %v requests", rejected)
+	}
+}
+
+func TestWithProxyWrongPassword(t *testing.T) {
+	srv := sighttest.NewServer()
+	defer srv.Close()
+	proxy := newTestProxy(srv.URL, "")
+	defer proxy.Close()
+
+	c := sight.NewClient(sighttest.APIKey,
+		sight.WithEndpoint("http://sight.test/api/sight/"),
+		sight.WithProxy(proxy.proxyURL("user", "wrong")))
+	_, err := c.RecognizeFiles(sight.Config{}, testImage(t))
+	var submitErr *sight.SubmitError
+	if !errors.As(err, &submitErr) || submitErr.StatusCode != http.StatusProxyAuthRequired {
+		t.Fatalf("got error %v; want a SubmitError with status 407", err)
+	}
+	if seen, rejected := proxy.requests(); len(seen) != 0 || rejected != 1 {
+		t.Errorf("proxy accepted %q and rejected %v requests; want 0 and 1", seen, rejected)
+	}
+}
+
+func TestWithProxyConnect(t *testing.T) {
+	srv := sighttest.NewServer()
+	defer srv.Close()
+	srv.Immediate = true
+	tlsSrv := httptest.NewTLSServer(srv.Config.Handler)
+	defer tlsSrv.Close()
+	proxy := newTestProxy("", tlsSrv.Listener.Addr().String())
+	defer proxy.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(tlsSrv.Certificate())
+	// The certificate of httptest is valid for example.com.
+	c := sight.NewClient(sighttest.APIKey,
+		sight.WithEndpoint("https://example.com/api/sight/"),
+		sight.WithProxy(proxy.proxyURL("user", "secret")),
+		sight.WithTLSConfig(&tls.Config{RootCAs: roots}))
+	recognize(t, c)
+	seen, rejected := proxy.requests()
+	if len(seen) != 1 || seen[0] != "CONNECT example.com:443" {
+		t.Errorf("proxy received %q; want a single CONNECT to example.com:443", seen)
+	}
+	if rejected != 0 {
+		t.Errorf("proxy rejected %v requests", rejected)
+	}
+
+	c = sight.NewClient(sighttest.APIKey,
+		sight.WithEndpoint("https://example.com/api/sight/"),
+		sight.WithProxy(proxy.proxyURL("user", "wrong")),
+		sight.WithTLSConfig(&tls.Config{RootCAs: roots}))
+	// The deadline stops the Client from sending the request again.
+	cfg := sight.Config{JobDeadline: time.Second}
+	if _, err := c.RecognizeFiles(cfg, testImage(t)); err == nil {
+		t.Error("recognized through a proxy which rejected the CONNECT request")
+	}
+}
+
+// TestProxyFromEnvironment runs TestProxyFromEnvironmentHelper in a new
+// process, as net/http reads the proxy environment variables only once.
+func TestProxyFromEnvironment(t *testing.T) {
+	if os.Getenv("SIGHT_TEST_ENDPOINT") != "" {
+		t.Skip("running as the helper process")
+	}
+	srv := sighttest.NewServer()
+	defer srv.Close()
+	proxy := newTestProxy(srv.URL, "")
+	defer proxy.Close()
+
+	for _, name := range []string{"HTTP_PROXY", "http_proxy"} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestProxyFromEnvironmentHelper$", "-test.v")
+		cmd.Env = append(os.Environ(),
+			"HTTP_PROXY=", "http_proxy=", "NO_PROXY=", "no_proxy=", "REQUEST_METHOD=",
+			name+"="+proxy.proxyURL("user", "secret").String(),
+			"SIGHT_TEST_ENDPOINT=http://sight.test/api/sight/")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("with %v: %v\n%s", name, err, out)
+		}
+		seen, _ := proxy.requests()
+		if len(seen) == 0 || seen[len(seen)-1] != "POST sight.test" {
+			t.Errorf("with %v, proxy received %q; want the initial request to sight.test", name, seen)
+		}
+	}
+}
+
+func TestProxyFromEnvironmentHelper(t *testing.T) {
+	endpoint := os.Getenv("SIGHT_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("run by TestProxyFromEnvironment")
+	}
+	recognize(t, sight.NewClient(sighttest.APIKey, sight.WithEndpoint(endpoint)))
+}
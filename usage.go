@@ -0,0 +1,108 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Usage is the usage of an account in its current billing period, as
+// reported by the Sight API.
+type Usage struct {
+	PeriodStart time.Time
+	PeriodEnd   time.Time
+	// PagesProcessed is the number of pages recognized this period.
+	PagesProcessed int
+	// PageQuota is the number of pages included in the period, or 0 if
+	// the account has no quota.
+	PageQuota int
+	// PagesRemaining is the number of pages which can be recognized
+	// before the quota is exceeded and overage is charged.
+	PagesRemaining int
+	RateLimit      RateLimitStatus
+}
+
+// RateLimitStatus is the state of the rate limit of an account, taken from
+// the X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset headers
+// of a response. Limit is 0 if the Sight API did not report it.
+type RateLimitStatus struct {
+	// Limit is the number of requests allowed until Reset.
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Usage returns the usage of the Client's account in the current billing
+// period. It is not billed, so it can be called before submitting a batch
+// to make sure the batch fits within the quota. The error is
+// ErrUnauthorized if the API key was rejected.
+func (c *Client) Usage(ctx context.Context) (Usage, error) {
+	requestID := newRequestID()
+	url := strings.TrimSuffix(c.endpoint, "/") + "/usage"
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return Usage{}, err
+	}
+	c.waitForRateLimit(0, requestID)
+	c.logger.Debug("requesting usage", "request", requestID, "url", url)
+	resp, err := c.do(req, 0)
+	if err != nil {
+		c.logger.Error("usage request failed", "request", requestID, "error", err)
+		return Usage{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == 401 {
+		return Usage{}, ErrUnauthorized
+	} else if resp.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return Usage{}, fmt.Errorf("non-200 response from usage request to the Sight API; status: %v; body: %v", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var u Usage
+	if err := json.NewDecoder(resp.Body).Decode(&u); err != nil {
+		return Usage{}, fmt.Errorf("failed to decode usage response from the Sight API: %v", err)
+	}
+	if rl, ok := rateLimitStatus(resp.Header); ok {
+		u.RateLimit = rl
+	}
+	return u, nil
+}
+
+// rateLimitStatus parses the rate limit headers of a response. ok is false
+// if there are none.
+func rateLimitStatus(h http.Header) (rl RateLimitStatus, ok bool) {
+	limit, err := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return RateLimitStatus{}, false
+	}
+	rl.Limit = limit
+	rl.Remaining, _ = strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rl.Reset = time.Unix(reset, 0)
+	}
+	return rl, true
+}
@@ -0,0 +1,81 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/siftrics/sight"
+	"github.com/siftrics/sight/sighttest"
+)
+
+func TestUsage(t *testing.T) {
+	s := sighttest.NewServer()
+	defer s.Close()
+	s.PageQuota = 10
+	c := s.Client()
+	recognize(t, c)
+
+	u, err := c.Usage(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.PagesProcessed != 1 || u.PageQuota != 10 || u.PagesRemaining != 9 {
+		t.Errorf("usage = %+v, want 1 page processed of a quota of 10", u)
+	}
+}
+
+func TestUsageUnauthorized(t *testing.T) {
+	s := sighttest.NewServer()
+	defer s.Close()
+	c := sight.NewClient("revoked", sight.WithEndpoint(s.URL+"/api/sight/"))
+
+	if _, err := c.Usage(context.Background()); !errors.Is(err, sight.ErrUnauthorized) {
+		t.Errorf("Usage with a rejected API key returned %v, want %v", err, sight.ErrUnauthorized)
+	}
+}
+
+func TestUsageError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+	c := sight.NewClient(sighttest.APIKey, sight.WithEndpoint(s.URL+"/api/sight/"))
+
+	_, err := c.Usage(context.Background())
+	if err == nil {
+		t.Fatal("Usage succeeded, want an error")
+	}
+	msg := err.Error()
+	if !strings.Contains(msg, "503") || !strings.Contains(msg, "down for maintenance") {
+		t.Errorf("error %q does not give the status and body of the response", msg)
+	}
+	// Error strings are not capitalized and do not end with punctuation,
+	// as they are usually printed after other context.
+	if first := msg[:1]; first != strings.ToLower(first) || strings.HasSuffix(strings.TrimSpace(msg), ".") {
+		t.Errorf("error %q is capitalized or ends with a period", msg)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"runtime/debug"
+)
+
+// modulePath is the path of this module, by which its version is found in
+// the build information of the program.
+const modulePath = "github.com/siftrics/sight"
+
+// Version is the version of this package, as recorded in the build
+// information of the program which uses it, e.g., "v1.4.0", or "devel" if
+// it was not built as a versioned module dependency.
+var Version = moduleVersion()
+
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	for _, m := range info.Deps {
+		if m.Path == modulePath {
+			if m.Replace != nil && m.Replace.Version != "" {
+				return m.Replace.Version
+			}
+			return m.Version
+		}
+	}
+	return "devel"
+}
+
+// WithAppName adds app, the name (and, ideally, version) of the program
+// using the Client, to the User-Agent header of every request, as in
+// "sight-go/v1.4.0 (invoice-importer/2.1)", so that Siftrics support can tell
+// its traffic apart from that of other programs using the same API key.
+func WithAppName(app string) Option {
+	return func(c *Client) {
+		c.appName = app
+	}
+}
+
+// userAgent returns the User-Agent header of the Client's requests.
+func (c *Client) userAgent() string {
+	ua := "sight-go/" + Version
+	if c.appName != "" {
+		ua += " (" + c.appName + ")"
+	}
+	return ua
+}
@@ -0,0 +1,76 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// imageFormats maps MIME types to the format names of the image package.
+var imageFormats = map[string]string{
+	"image/gif":  "gif",
+	"image/jpeg": "jpeg",
+	"image/jpg":  "jpeg",
+	"image/png":  "png",
+}
+
+// checkContents reports why contents, of the given MIME type, would be
+// wasted on the Sight API: they are empty, they do not start with the magic
+// bytes of the type, or the header of the image cannot be decoded.
+func checkContents(mimeType string, contents []byte) error {
+	if len(contents) == 0 {
+		return errors.New("the file is empty")
+	}
+	switch mimeType {
+	case "application/pdf":
+		// Readers accept junk before the header, within the first 1024 bytes.
+		head := contents
+		if len(head) > 1024 {
+			head = head[:1024]
+		}
+		if !bytes.Contains(head, []byte("%PDF-")) {
+			return errors.New("the file does not start with a PDF header")
+		}
+	case "image/bmp":
+		if len(contents) < 26 || !bytes.HasPrefix(contents, []byte("BM")) {
+			return errors.New("the file does not start with a BMP header")
+		}
+	default:
+		want, ok := imageFormats[mimeType]
+		if !ok {
+			return nil
+		}
+		_, format, err := image.DecodeConfig(bytes.NewReader(contents))
+		if err != nil {
+			return fmt.Errorf("the image header could not be decoded: %v", err)
+		}
+		if format != want {
+			return fmt.Errorf("the file is a %v image, not %v", format, mimeType)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Vocabulary corrects recognized text against known terms, such as product
+// codes, part numbers and names, which the Sight API may misrecognize
+// because they are not words. See Config.Vocabulary.
+type Vocabulary struct {
+	// exact maps each term, folded to lower case, to the term.
+	exact map[string]string
+	// byLength holds the terms by their length in runes, folded.
+	byLength map[int][]vocabularyTerm
+	// maxWords is the number of words of the longest term.
+	maxWords int
+}
+
+type vocabularyTerm struct {
+	term   string
+	folded []rune
+}
+
+// NewVocabulary returns a Vocabulary of terms. Runs of spaces within a term
+// are taken as one space, and empty terms are ignored.
+func NewVocabulary(terms []string) *Vocabulary {
+	v := &Vocabulary{exact: make(map[string]string), byLength: make(map[int][]vocabularyTerm)}
+	for _, t := range terms {
+		t = strings.Join(strings.Fields(t), " ")
+		if t == "" {
+			continue
+		}
+		folded := strings.ToLower(t)
+		if _, ok := v.exact[folded]; ok {
+			continue
+		}
+		v.exact[folded] = t
+		n := utf8.RuneCountInString(folded)
+		v.byLength[n] = append(v.byLength[n], vocabularyTerm{t, []rune(folded)})
+		if words := strings.Count(t, " ") + 1; words > v.maxWords {
+			v.maxWords = words
+		}
+	}
+	return v
+}
+
+// confusable holds the pairs of characters, folded to lower case, which are
+// often mistaken for each other in recognized text. Substituting one for
+// the other costs half an edit.
+var confusable = map[[2]rune]bool{}
+
+func init() {
+	for _, pair := range []string{"o0", "q0", "d0", "i1", "l1", "il", "s5", "b8", "z2", "g6", "g9", "uv", "a4", "t7"} {
+		a, b := rune(pair[0]), rune(pair[1])
+		confusable[[2]rune{a, b}] = true
+		confusable[[2]rune{b, a}] = true
+	}
+}
+
+// maxCost returns the largest cost of edits, in half edits, which turns
+// a word of n runes into a term: one character mistaken for a similar one
+// in a word of up to three runes, one edit in a word of up to seven and two
+// edits in longer ones.
+func maxCost(n int) int {
+	switch {
+	case n <= 3:
+		return 1
+	case n <= 7:
+		return 2
+	}
+	return 4
+}
+
+// editCost returns the cost, in half edits, of turning a into b by
+// inserting, deleting and substituting characters, or a number above max
+// if it is more than max.
+func editCost(a, b []rune, max int) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = 2 * j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = 2 * i
+		lowest := cur[0]
+		for j := 1; j <= len(b); j++ {
+			sub := 0
+			if a[i-1] != b[j-1] {
+				sub = 2
+				if confusable[[2]rune{a[i-1], b[j-1]}] {
+					sub = 1
+				}
+			}
+			c := prev[j-1] + sub
+			if d := prev[j] + 2; d < c {
+				c = d
+			}
+			if d := cur[j-1] + 2; d < c {
+				c = d
+			}
+			cur[j] = c
+			if c < lowest {
+				lowest = c
+			}
+		}
+		if lowest > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// match returns the term which s nearly matches. If two terms match s
+// equally nearly, neither is returned.
+func (v *Vocabulary) match(s string) (string, bool) {
+	folded := strings.ToLower(s)
+	if t, ok := v.exact[folded]; ok {
+		return t, true
+	}
+	runes := []rune(folded)
+	max := maxCost(len(runes))
+	best, bestCost, tied := "", max+1, false
+	for n := len(runes) - max/2; n <= len(runes)+max/2; n++ {
+		for _, t := range v.byLength[n] {
+			// The allowance depends on the length of the term as well,
+			// so that a short term is not matched by a longer word.
+			limit := maxCost(len(t.folded))
+			if limit > max {
+				limit = max
+			}
+			c := editCost(runes, t.folded, limit)
+			if c > limit {
+				continue
+			}
+			if c < bestCost {
+				best, bestCost, tied = t.term, c, false
+			} else if c == bestCost && t.term != best {
+				tied = true
+			}
+		}
+	}
+	return best, best != "" && !tied
+}
+
+var (
+	vocabularyWordPattern = regexp.MustCompile(`\S+`)
+	// vocabularyTrim are the characters which are stripped from the ends
+	// of words before they are matched, as they are usually punctuation
+	// rather than part of a term.
+	vocabularyTrim = `.,;:!?()[]{}"'`
+)
+
+// Correct returns text with each word, or run of as many words as a term
+// has, which nearly matches a term replaced by the term. Words match terms
+// regardless of case, after punctuation at their ends is stripped. A word
+// nearly matches a term if one character of a word of up to three
+// characters, one of a word of up to seven, or two of a longer word, were
+// inserted, deleted or substituted, where a character mistaken for a
+// similar one, such as O for 0, counts as half. Words which nearly match
+// several terms equally are left alone.
+func (v *Vocabulary) Correct(text string) string {
+	if v == nil || len(v.exact) == 0 {
+		return text
+	}
+	words := vocabularyWordPattern.FindAllStringIndex(text, -1)
+	var b strings.Builder
+	last := 0
+	for i := 0; i < len(words); i++ {
+		for n := v.maxWords; n >= 1; n-- {
+			if i+n > len(words) {
+				continue
+			}
+			start, end := words[i][0], words[i+n-1][1]
+			phrase := text[start:end]
+			core := strings.TrimLeft(phrase, vocabularyTrim)
+			start += len(phrase) - len(core)
+			core = strings.TrimRight(core, vocabularyTrim)
+			end = start + len(core)
+			if core == "" {
+				continue
+			}
+			if n > 1 {
+				core = strings.Join(strings.Fields(core), " ")
+			}
+			t, ok := v.match(core)
+			if !ok {
+				continue
+			}
+			b.WriteString(text[last:start])
+			b.WriteString(t)
+			last = end
+			i += n - 1
+			break
+		}
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Process corrects the text of each text element of p with v, so that a
+// Vocabulary is a PostProcessor.
+func (v *Vocabulary) Process(p RecognizedPage) RecognizedPage {
+	for i, t := range p.RecognizedText {
+		p.RecognizedText[i].Text = v.Correct(t.Text)
+	}
+	return p
+}
@@ -0,0 +1,97 @@
+// Copyright © 2020 Siftrics
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sight
+
+import (
+	"math"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SplitWords divides a sentence-level bounding box into word-level bounding
+// boxes. It is a best-effort approximation for callers who received sentence
+// results but need word boxes without submitting the document again: words
+// are split on whitespace and each character is assumed to take up the same
+// width, so boxes drift for proportional fonts. The top and bottom edges of
+// the sentence are interpolated separately, so rotated and skewed boxes are
+// handled. Each word gets the confidence of its sentence.
+func SplitWords(t RecognizedText) []RecognizedText {
+	runes := []rune(t.Text)
+	n := float64(len(runes))
+	var words []RecognizedText
+	start := -1
+	for i := 0; i <= len(runes); i++ {
+		if i < len(runes) && !unicode.IsSpace(runes[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start < 0 {
+			continue
+		}
+		words = append(words, span(t, string(runes[start:i]), float64(start)/n, float64(i)/n))
+		start = -1
+	}
+	return words
+}
+
+// SubText returns the part of t from the byte offset start to end, such as
+// a match of a regular expression in its text, with a bounding box
+// approximated as by SplitWords.
+func SubText(t RecognizedText, start, end int) RecognizedText {
+	n := float64(utf8.RuneCountInString(t.Text))
+	f0 := float64(utf8.RuneCountInString(t.Text[:start])) / n
+	f1 := float64(utf8.RuneCountInString(t.Text[:end])) / n
+	return span(t, t.Text[start:end], f0, f1)
+}
+
+// span returns text with the part of the box of t from the fraction f0 of
+// its width to f1.
+func span(t RecognizedText, text string, f0, f1 float64) RecognizedText {
+	lerp := func(a, b int, f float64) int {
+		return int(math.Round(float64(a) + (float64(b)-float64(a))*f))
+	}
+	return RecognizedText{
+		Text:         text,
+		TopLeftX:     lerp(t.TopLeftX, t.TopRightX, f0),
+		TopLeftY:     lerp(t.TopLeftY, t.TopRightY, f0),
+		TopRightX:    lerp(t.TopLeftX, t.TopRightX, f1),
+		TopRightY:    lerp(t.TopLeftY, t.TopRightY, f1),
+		BottomLeftX:  lerp(t.BottomLeftX, t.BottomRightX, f0),
+		BottomLeftY:  lerp(t.BottomLeftY, t.BottomRightY, f0),
+		BottomRightX: lerp(t.BottomLeftX, t.BottomRightX, f1),
+		BottomRightY: lerp(t.BottomLeftY, t.BottomRightY, f1),
+		Confidence:   t.Confidence,
+		Language:     t.Language,
+	}
+}
+
+// SplitPageWords returns a copy of p in which every recognized text element
+// has been divided into words with SplitWords.
+func SplitPageWords(p RecognizedPage) RecognizedPage {
+	wp := p
+	wp.RecognizedText = nil
+	for _, t := range p.RecognizedText {
+		wp.RecognizedText = append(wp.RecognizedText, SplitWords(t)...)
+	}
+	return wp
+}